@@ -53,6 +53,11 @@ func testConnections(ctx context.Context, rt *runtime.Runtime) error {
 	} else {
 		log.Info("attachments bucket ok")
 	}
+	if err := rt.S3.Test(ctx, c.S3ExportsBucket); err != nil {
+		log.Error("exports bucket not accessible", "error", err)
+	} else {
+		log.Info("exports bucket ok")
+	}
 
 	// test Elasticsearch
 	if ping, err := rt.ES.Client.Ping().Do(ctx); err != nil {
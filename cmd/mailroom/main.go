@@ -7,6 +7,7 @@ import (
 	_ "github.com/nyaruka/mailroom/v26/core/runner/handlers"
 	_ "github.com/nyaruka/mailroom/v26/core/runner/hooks"
 	_ "github.com/nyaruka/mailroom/v26/services/airtime/dtone"
+	_ "github.com/nyaruka/mailroom/v26/services/airtime/reloadly"
 	_ "github.com/nyaruka/mailroom/v26/services/ivr/bandwidth"
 	_ "github.com/nyaruka/mailroom/v26/services/ivr/twiml"
 	_ "github.com/nyaruka/mailroom/v26/services/ivr/vonage"
@@ -18,15 +19,19 @@ import (
 	_ "github.com/nyaruka/mailroom/v26/web/campaign"
 	_ "github.com/nyaruka/mailroom/v26/web/channel"
 	_ "github.com/nyaruka/mailroom/v26/web/contact"
+	_ "github.com/nyaruka/mailroom/v26/web/email"
+	_ "github.com/nyaruka/mailroom/v26/web/experiment"
 	_ "github.com/nyaruka/mailroom/v26/web/flow"
 	_ "github.com/nyaruka/mailroom/v26/web/llm"
 	_ "github.com/nyaruka/mailroom/v26/web/msg"
 	_ "github.com/nyaruka/mailroom/v26/web/notification"
 	_ "github.com/nyaruka/mailroom/v26/web/org"
 	_ "github.com/nyaruka/mailroom/v26/web/public"
+	_ "github.com/nyaruka/mailroom/v26/web/schedule"
 	_ "github.com/nyaruka/mailroom/v26/web/simulation"
 	_ "github.com/nyaruka/mailroom/v26/web/socket"
 	_ "github.com/nyaruka/mailroom/v26/web/ticket"
+	_ "github.com/nyaruka/mailroom/v26/web/trigger"
 )
 
 var (
@@ -2,6 +2,7 @@ package cmd
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	ulog "log"
 	"log/slog"
@@ -115,6 +116,18 @@ func startService(rt *runtime.Runtime) (*service, error) {
 		return nil, err
 	}
 
+	// values of sensitive fields can't be written without a key to encrypt them with
+	if c.FieldsEncryptionKey == "" {
+		hasSensitive, err := models.AnyOrgHasSensitiveFields(s.ctx, rt.DB)
+		if err != nil {
+			return nil, err
+		}
+		if hasSensitive {
+			return nil, errors.New("orgs have sensitive fields configured but no fields encryption key is set")
+		}
+		log.Warn("fields encryption key not configured, sensitive fields can't be used")
+	}
+
 	// create the services which are only enabled in some deployments - a failure to create one leaves it nil, which
 	// is how callers know the feature is unavailable, so it must not be assigned to on the error path
 	if c.AndroidCredentialsFile != "" {
@@ -7,6 +7,7 @@ import (
 	"time"
 
 	valkey "github.com/gomodule/redigo/redis"
+	"github.com/nyaruka/gocommon/dates"
 	"github.com/nyaruka/goflow/core"
 	"github.com/nyaruka/mailroom/v26/core/models"
 	"github.com/nyaruka/mailroom/v26/runtime"
@@ -24,7 +25,7 @@ func (c *EndIncidentsCron) Next(last time.Time) time.Time {
 
 // EndIncidents checks open incidents and end any that no longer apply
 func (c *EndIncidentsCron) Run(ctx context.Context, rt *runtime.Runtime) (map[string]any, error) {
-	incidents, err := models.GetOpenIncidents(ctx, rt.DB, []models.IncidentType{models.IncidentTypeWebhooksUnhealthy})
+	incidents, err := models.GetOpenIncidents(ctx, rt.DB, []models.IncidentType{models.IncidentTypeWebhooksUnhealthy, models.IncidentTypeAirtimeLimit})
 	if err != nil {
 		return nil, fmt.Errorf("error fetching open incidents: %w", err)
 	}
@@ -40,12 +41,38 @@ func (c *EndIncidentsCron) Run(ctx context.Context, rt *runtime.Runtime) (map[st
 			if ended {
 				numEnded++
 			}
+		} else if incident.Type == models.IncidentTypeAirtimeLimit {
+			ended, err := c.checkAirtimeLimitIncident(ctx, rt, incident)
+			if err != nil {
+				return nil, fmt.Errorf("error checking airtime limit incident #%d: %w", incident.ID, err)
+			}
+			if ended {
+				numEnded++
+			}
 		}
 	}
 
 	return map[string]any{"ended": numEnded}, nil
 }
 
+// airtime limits are daily in the org's timezone so once it's a new day there, the limit has reset
+func (c *EndIncidentsCron) checkAirtimeLimitIncident(ctx context.Context, rt *runtime.Runtime, incident *models.Incident) (bool, error) {
+	oa, err := models.GetOrgAssets(ctx, rt, incident.OrgID)
+	if err != nil {
+		return false, fmt.Errorf("error loading org assets: %w", err)
+	}
+
+	tz := oa.Env().Timezone()
+	if dates.Now().In(tz).Format(time.DateOnly) == incident.StartedOn.In(tz).Format(time.DateOnly) {
+		return false, nil
+	}
+
+	if err := incident.End(ctx, rt.DB); err != nil {
+		return false, fmt.Errorf("error ending incident: %w", err)
+	}
+	return true, nil
+}
+
 func (c *EndIncidentsCron) checkWebhookIncident(ctx context.Context, rt *runtime.Runtime, incident *models.Incident) (bool, error) {
 	nodeUUIDs, err := c.getWebhookIncidentNodes(rt, incident)
 
@@ -63,3 +63,35 @@ func TestEndIncidents(t *testing.T) {
 	assertvk.SMembers(t, vc, fmt.Sprintf("incident:%d:nodes", id1), []string{"3c703019-8c92-4d28-9be0-a926a934486b"})
 	assertvk.SMembers(t, vc, fmt.Sprintf("incident:%d:nodes", id2), []string{}) // healthy node removed
 }
+
+func TestEndAirtimeLimitIncidents(t *testing.T) {
+	ctx, rt := testsuite.Runtime(t)
+
+	defer dates.SetNowFunc(time.Now)
+
+	oa := testdb.Org1.Load(t, rt)
+
+	// limit reached at 11pm in the org's timezone
+	dates.SetNowFunc(dates.NewFixedNow(time.Date(2025, 5, 5, 6, 0, 0, 0, time.UTC)))
+
+	id, _, err := models.IncidentAirtimeLimitReached(ctx, rt.DB, oa, "")
+	require.NoError(t, err)
+
+	cron := &crons.EndIncidentsCron{}
+
+	// still the same day in the org's timezone
+	dates.SetNowFunc(dates.NewFixedNow(time.Date(2025, 5, 5, 6, 30, 0, 0, time.UTC)))
+
+	res, err := cron.Run(ctx, rt)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]any{"ended": 0}, res)
+
+	// limits reset at midnight in the org's timezone
+	dates.SetNowFunc(dates.NewFixedNow(time.Date(2025, 5, 5, 7, 30, 0, 0, time.UTC)))
+
+	res, err = cron.Run(ctx, rt)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]any{"ended": 1}, res)
+
+	assertdb.Query(t, rt.DB, `SELECT count(*) FROM notifications_incident WHERE id = $1 AND ended_on IS NOT NULL`, id).Returns(1)
+}
@@ -10,6 +10,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/nyaruka/gocommon/dates"
 	"github.com/nyaruka/goflow/core"
 	"github.com/nyaruka/goflow/flows"
 	"github.com/nyaruka/mailroom/v26/core/models"
@@ -33,7 +34,8 @@ func (c *FireContactsCron) Next(last time.Time) time.Time {
 
 func (c *FireContactsCron) Run(ctx context.Context, rt *runtime.Runtime) (map[string]any, error) {
 	start := time.Now()
-	numWaitTimeouts, numWaitExpires, numSessionExpires, numCampaignPoints := 0, 0, 0, 0
+	numWaitTimeouts, numWaitExpires, numSessionExpires, numCampaignPoints, numCampaignDeferred, numCampaignCapped := 0, 0, 0, 0, 0, 0
+	numDripSteps, numDripExits, numBroadcastSends := 0, 0, 0
 
 	for {
 		fires, err := models.LoadDueContactfires(ctx, rt, c.FetchBatchSize)
@@ -68,6 +70,10 @@ func (c *FireContactsCron) Run(ctx context.Context, rt *runtime.Runtime) (map[st
 
 				pointID, _ := c.parseCampaignFireScope(f.Scope)
 				pointIDs[pointID] = true
+			case models.ContactFireTypeDripStep:
+				og.grouping = "drip:" + f.Scope
+			case models.ContactFireTypeBroadcast:
+				og.grouping = "broadcast:" + f.Scope
 			default:
 				return nil, fmt.Errorf("unknown contact fire type: %s", f.Type)
 			}
@@ -81,6 +87,30 @@ func (c *FireContactsCron) Run(ctx context.Context, rt *runtime.Runtime) (map[st
 		}
 
 		for og, fs := range grouped {
+			var cappedOn time.Time // when sends were reserved against frequency caps for campaign fires
+
+			// campaign fires which are outside of the send window of their point are deferred rather than fired
+			if strings.HasPrefix(og.grouping, "campaign:") {
+				var numDeferred int
+				fs, numDeferred, err = c.deferOutsideSendWindow(ctx, rt, og.orgID, strings.TrimPrefix(og.grouping, "campaign:"), fs)
+				if err != nil {
+					return nil, err
+				}
+				numCampaignDeferred += numDeferred
+
+				// fires for message points are also subject to the org's frequency caps
+				pointID, _ := c.parseCampaignFireScope(strings.TrimPrefix(og.grouping, "campaign:"))
+				if pointTypes[pointID] == models.PointTypeMessage {
+					var numCapped int
+					cappedOn = dates.Now()
+					fs, numCapped, err = c.capCampaignFires(ctx, rt, og.orgID, fs, cappedOn)
+					if err != nil {
+						return nil, err
+					}
+					numCampaignCapped += numCapped
+				}
+			}
+
 			for batch := range slices.Chunk(fs, c.TaskBatchSize) {
 				if og.grouping == "wait_timeouts" {
 					// turn wait timeouts into bulk wait timeout tasks
@@ -135,11 +165,43 @@ func (c *FireContactsCron) Run(ctx context.Context, rt *runtime.Runtime) (map[st
 
 					for _, cidBatch := range cidBatches {
 						// queue to throttled queue but high priority
-						if err := tasks.Queue(ctx, rt, rt.Queues.Throttled, og.orgID, &tasks.BulkCampaignTrigger{PointID: pointID, FireVersion: fireVersion, ContactIDs: cidBatch}, true); err != nil {
+						if err := tasks.Queue(ctx, rt, rt.Queues.Throttled, og.orgID, &tasks.BulkCampaignTrigger{PointID: pointID, FireVersion: fireVersion, ContactIDs: cidBatch, CappedOn: cappedOn}, true); err != nil {
 							return nil, fmt.Errorf("error queuing bulk campaign trigger task for org #%d: %w", og.orgID, err)
 						}
 					}
 					numCampaignPoints += len(batch)
+				} else if strings.HasPrefix(og.grouping, "drip:") {
+					// turn drip step fires for contacts which haven't exited the sequence into bulk drip step tasks
+					seqUUID, step := c.parseDripFireScope(strings.TrimPrefix(og.grouping, "drip:"))
+
+					cids, err := c.filterDripExits(ctx, rt, og.orgID, seqUUID, step, batch)
+					if err != nil {
+						return nil, err
+					}
+
+					if len(cids) > 0 {
+						// queue to throttled queue but high priority
+						if err := tasks.Queue(ctx, rt, rt.Queues.Throttled, og.orgID, &tasks.BulkDripStep{SequenceUUID: seqUUID, Step: step, ContactIDs: cids}, true); err != nil {
+							return nil, fmt.Errorf("error queuing bulk drip step task for org #%d: %w", og.orgID, err)
+						}
+					}
+					numDripSteps += len(cids)
+					numDripExits += len(batch) - len(cids)
+				} else if strings.HasPrefix(og.grouping, "broadcast:") {
+					// turn deferred broadcast sends into broadcast batch tasks
+					cids := make([]models.ContactID, len(batch))
+					for i, f := range batch {
+						cids[i] = f.ContactID
+					}
+
+					bcastID, variantUUID, created, capped := c.parseBroadcastFireScope(strings.TrimPrefix(og.grouping, "broadcast:"))
+
+					// queue to throttled queue but high priority
+					task := &tasks.SendBroadcastBatch{BroadcastBatch: models.CreateDeferredBatch(bcastID, variantUUID, cids, created, capped)}
+					if err := tasks.Queue(ctx, rt, rt.Queues.Throttled, og.orgID, task, true); err != nil {
+						return nil, fmt.Errorf("error queuing broadcast batch task for org #%d: %w", og.orgID, err)
+					}
+					numBroadcastSends += len(batch)
 				}
 
 				if err := models.DeleteContactFires(ctx, rt, batch); err != nil {
@@ -154,7 +216,65 @@ func (c *FireContactsCron) Run(ctx context.Context, rt *runtime.Runtime) (map[st
 		}
 	}
 
-	return map[string]any{"wait_timeouts": numWaitTimeouts, "wait_expires": numWaitExpires, "session_expires": numSessionExpires, "campaign_points": numCampaignPoints}, nil
+	return map[string]any{"wait_timeouts": numWaitTimeouts, "wait_expires": numWaitExpires, "session_expires": numSessionExpires, "campaign_points": numCampaignPoints, "campaign_deferred": numCampaignDeferred, "campaign_capped": numCampaignCapped, "drip_steps": numDripSteps, "drip_exits": numDripExits, "broadcast_sends": numBroadcastSends}, nil
+}
+
+func (c *FireContactsCron) deferOutsideSendWindow(ctx context.Context, rt *runtime.Runtime, orgID models.OrgID, scope string, fires []*models.ContactFire) ([]*models.ContactFire, int, error) {
+	oa, err := models.GetOrgAssets(ctx, rt, orgID)
+	if err != nil {
+		return nil, 0, fmt.Errorf("error loading org assets for org #%d: %w", orgID, err)
+	}
+
+	// if point no longer exists, let the trigger task deal with it
+	pointID, _ := c.parseCampaignFireScope(scope)
+	point := oa.CampaignPointByID(pointID)
+	if point == nil {
+		return fires, 0, nil
+	}
+
+	due, numDeferred, err := models.DeferCampaignFires(ctx, rt.DB, oa, point, fires, dates.Now())
+	if err != nil {
+		return nil, 0, fmt.Errorf("error deferring campaign fires for point #%d: %w", pointID, err)
+	}
+	return due, numDeferred, nil
+}
+
+func (c *FireContactsCron) capCampaignFires(ctx context.Context, rt *runtime.Runtime, orgID models.OrgID, fires []*models.ContactFire, now time.Time) ([]*models.ContactFire, int, error) {
+	oa, err := models.GetOrgAssets(ctx, rt, orgID)
+	if err != nil {
+		return nil, 0, fmt.Errorf("error loading org assets for org #%d: %w", orgID, err)
+	}
+
+	due, numCapped, err := models.CapCampaignFires(ctx, rt, oa, fires, now)
+	if err != nil {
+		return nil, 0, fmt.Errorf("error applying frequency caps to campaign fires: %w", err)
+	}
+	return due, numCapped, nil
+}
+
+// returns the IDs of the contacts of the given drip step fires which haven't met an exit condition of the sequence
+func (c *FireContactsCron) filterDripExits(ctx context.Context, rt *runtime.Runtime, orgID models.OrgID, seqUUID models.DripSequenceUUID, step int, fires []*models.ContactFire) ([]models.ContactID, error) {
+	oa, err := models.GetOrgAssets(ctx, rt, orgID)
+	if err != nil {
+		return nil, fmt.Errorf("error loading org assets for org #%d: %w", orgID, err)
+	}
+
+	// if sequence or step no longer exists, nobody continues
+	seq := oa.Org().DripSequence(seqUUID)
+	if seq == nil || step >= len(seq.Steps) {
+		return nil, nil
+	}
+
+	remaining, err := models.FilterDripExits(ctx, rt.DB, oa, seq, step, fires)
+	if err != nil {
+		return nil, fmt.Errorf("error checking exits for drip sequence %s: %w", seqUUID, err)
+	}
+
+	cids := make([]models.ContactID, len(remaining))
+	for i, f := range remaining {
+		cids[i] = f.ContactID
+	}
+	return cids, nil
 }
 
 var campaignEventScopePattern = regexp.MustCompile(`^(\d+):(\d+)$`)
@@ -171,3 +291,30 @@ func (c *FireContactsCron) parseCampaignFireScope(scope string) (models.PointID,
 
 	return models.PointID(pointID), fireVersion
 }
+
+func (c *FireContactsCron) parseDripFireScope(scope string) (models.DripSequenceUUID, int) {
+	seqUUID, step, _ := strings.Cut(scope, ":")
+	stepNum, _ := strconv.Atoi(step)
+
+	return models.DripSequenceUUID(seqUUID), stepNum
+}
+
+func (c *FireContactsCron) parseBroadcastFireScope(scope string) (models.BroadcastID, models.VariantUUID, bool, bool) {
+	parts := strings.Split(scope, ":")
+	bcastID, _ := strconv.Atoi(parts[0])
+
+	var variantUUID models.VariantUUID
+	var created, capped bool
+	for _, p := range parts[1:] {
+		switch p {
+		case "created":
+			created = true
+		case "capped":
+			capped = true
+		default:
+			variantUUID = models.VariantUUID(p)
+		}
+	}
+
+	return models.BroadcastID(bcastID), variantUUID, created, capped
+}
@@ -8,8 +8,10 @@ import (
 	"time"
 
 	"github.com/nyaruka/gocommon/dbutil/assertdb"
+	"github.com/nyaruka/gocommon/i18n"
 	"github.com/nyaruka/gocommon/jsonx"
 	"github.com/nyaruka/goflow/core"
+	"github.com/nyaruka/goflow/core/events"
 	"github.com/nyaruka/goflow/flows"
 	"github.com/nyaruka/mailroom/v26/core/crons"
 	"github.com/nyaruka/mailroom/v26/core/models"
@@ -19,6 +21,7 @@ import (
 	"github.com/nyaruka/mailroom/v26/testsuite/testdb"
 	"github.com/nyaruka/mailroom/v26/utils/queues"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestFireContacts(t *testing.T) {
@@ -41,7 +44,7 @@ func TestFireContacts(t *testing.T) {
 	cron := &crons.FireContactsCron{FetchBatchSize: 3, TaskBatchSize: 5, FlowBatchSize: 2}
 	res, err := cron.Run(ctx, rt)
 	assert.NoError(t, err)
-	assert.Equal(t, map[string]any{"wait_timeouts": 2, "wait_expires": 2, "session_expires": 1, "campaign_points": 1}, res)
+	assert.Equal(t, map[string]any{"wait_timeouts": 2, "wait_expires": 2, "session_expires": 1, "campaign_points": 1, "campaign_deferred": 0, "campaign_capped": 0, "drip_steps": 0, "drip_exits": 0, "broadcast_sends": 0}, res)
 
 	// should have created 4 tasks in throttled queue.. unfortunately order is not guaranteed so we sort them
 	var ts []*queues.Task
@@ -97,7 +100,7 @@ func TestFireContacts(t *testing.T) {
 
 	res, err = cron.Run(ctx, rt)
 	assert.NoError(t, err)
-	assert.Equal(t, map[string]any{"wait_timeouts": 0, "wait_expires": 0, "session_expires": 0, "campaign_points": 0}, res)
+	assert.Equal(t, map[string]any{"wait_timeouts": 0, "wait_expires": 0, "session_expires": 0, "campaign_points": 0, "campaign_deferred": 0, "campaign_capped": 0, "drip_steps": 0, "drip_exits": 0, "broadcast_sends": 0}, res)
 }
 
 func TestFireContactsCampaignBatching(t *testing.T) {
@@ -122,7 +125,7 @@ func TestFireContactsCampaignBatching(t *testing.T) {
 	cron := &crons.FireContactsCron{FetchBatchSize: 100, TaskBatchSize: 100, FlowBatchSize: 2}
 	res, err := cron.Run(ctx, rt)
 	assert.NoError(t, err)
-	assert.Equal(t, map[string]any{"wait_timeouts": 0, "wait_expires": 0, "session_expires": 0, "campaign_points": 8}, res)
+	assert.Equal(t, map[string]any{"wait_timeouts": 0, "wait_expires": 0, "session_expires": 0, "campaign_points": 8, "campaign_deferred": 0, "campaign_capped": 0, "drip_steps": 0, "drip_exits": 0, "broadcast_sends": 0}, res)
 
 	// pop all tasks from throttled queue
 	var ts []*queues.Task
@@ -167,3 +170,141 @@ func TestFireContactsCampaignBatching(t *testing.T) {
 
 	assertdb.Query(t, rt.DB, `SELECT COUNT(*) FROM contacts_contactfire`).Returns(0)
 }
+
+func TestFireContactsSendWindows(t *testing.T) {
+	ctx, rt := testsuite.Runtime(t)
+
+	// give point 1 a send window which excludes today
+	la, _ := time.LoadLocation("America/Los_Angeles")
+	today := time.Now().In(la).Weekday()
+	days := make([]time.Weekday, 0, 6)
+	for d := time.Sunday; d <= time.Saturday; d++ {
+		if d != today {
+			days = append(days, d)
+		}
+	}
+	config := map[string]any{"campaign_send_windows": map[string]any{"points": map[string]any{string(testdb.RemindersPoint1.UUID): map[string]any{"start": "00:00", "end": "23:59", "days": days}}}}
+	rt.DB.MustExec(`UPDATE orgs_org SET config = config || $2::jsonb WHERE id = $1`, testdb.Org1.ID, string(jsonx.MustMarshal(config)))
+
+	testdb.InsertContactFire(t, rt, testdb.Org1, testdb.Ann, models.ContactFireTypeCampaignPoint, fmt.Sprintf("%d:1", testdb.RemindersPoint1.ID), time.Now().Add(-time.Second), "")
+	testdb.InsertContactFire(t, rt, testdb.Org1, testdb.Bob, models.ContactFireTypeCampaignPoint, fmt.Sprintf("%d:1", testdb.RemindersPoint2.ID), time.Now().Add(-time.Second), "")
+
+	cron := &crons.FireContactsCron{FetchBatchSize: 100, TaskBatchSize: 100, FlowBatchSize: 2}
+	res, err := cron.Run(ctx, rt)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]any{"wait_timeouts": 0, "wait_expires": 0, "session_expires": 0, "campaign_points": 1, "campaign_deferred": 1, "campaign_capped": 0, "drip_steps": 0, "drip_exits": 0, "broadcast_sends": 0}, res)
+
+	assert.Equal(t, map[string][]string{"throttled/1": {"bulk_campaign_trigger"}}, testsuite.GetQueuedTaskTypes(t, rt))
+
+	// Ann's fire has been pushed back to tomorrow
+	assertdb.Query(t, rt.DB, `SELECT contact_id FROM contacts_contactfire WHERE fire_on > NOW()`).Returns(int64(testdb.Ann.ID))
+}
+
+func TestFireContactsDripSteps(t *testing.T) {
+	ctx, rt := testsuite.Runtime(t)
+
+	rt.DB.MustExec(`UPDATE orgs_org SET config = config || '{"drip_sequences": {"6c3b2f4e-8a1d-4e5f-9b7c-2d4e6f8a0b1c": {"name": "Onboarding", "steps": [{"offset": 1, "unit": "D", "flow_uuid": "9de3663f-c5c5-4c92-9f45-ecbc09abcc85"}], "exit": {"replied": true}}}}'::jsonb WHERE id = $1`, testdb.Org1.ID)
+
+	// Bob has replied since the sequence started, Ann has only been seen through a channel event
+	rt.DB.MustExec(`UPDATE contacts_contact SET last_seen_on = NOW() WHERE id = $1`, testdb.Ann.ID)
+	testdb.InsertIncomingMsg(t, rt, testdb.Org1, events.NewEventUUID(), testdb.TwilioChannel, testdb.Bob, "hi", models.MsgStatusHandled, "")
+
+	testdb.InsertContactFire(t, rt, testdb.Org1, testdb.Ann, models.ContactFireTypeDripStep, "6c3b2f4e-8a1d-4e5f-9b7c-2d4e6f8a0b1c:0", time.Now().Add(-time.Second), "")
+	testdb.InsertContactFire(t, rt, testdb.Org1, testdb.Bob, models.ContactFireTypeDripStep, "6c3b2f4e-8a1d-4e5f-9b7c-2d4e6f8a0b1c:0", time.Now().Add(-time.Second), "")
+
+	cron := &crons.FireContactsCron{FetchBatchSize: 100, TaskBatchSize: 100, FlowBatchSize: 2}
+	res, err := cron.Run(ctx, rt)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]any{"wait_timeouts": 0, "wait_expires": 0, "session_expires": 0, "campaign_points": 0, "campaign_deferred": 0, "campaign_capped": 0, "drip_steps": 1, "drip_exits": 1, "broadcast_sends": 0}, res)
+
+	queued := testsuite.GetQueuedTasks(t, rt)
+	assert.Len(t, queued["throttled/1"], 1)
+	assert.Equal(t, "bulk_drip_step", queued["throttled/1"][0].Type)
+	assert.JSONEq(t, `{"sequence_uuid": "6c3b2f4e-8a1d-4e5f-9b7c-2d4e6f8a0b1c", "step": 0, "contact_ids": [10000]}`, string(queued["throttled/1"][0].Payload))
+
+	assertdb.Query(t, rt.DB, `SELECT count(*) FROM contacts_contactfire`).Returns(0)
+}
+
+func TestFireContactsBroadcastSends(t *testing.T) {
+	ctx, rt := testsuite.Runtime(t)
+
+	bcast := testdb.InsertBroadcast(t, rt, testdb.Org1, "0199f6a8-2b3c-7d4e-8f5a-6b7c8d9e0f1a", "eng", map[i18n.Language]string{"eng": "Hi"}, models.NilScheduleID, nil, nil)
+
+	// Ann and Bob's sends are due, Cat's is still deferred
+	testdb.InsertContactFire(t, rt, testdb.Org1, testdb.Ann, models.ContactFireTypeBroadcast, fmt.Sprint(bcast.ID), time.Now().Add(-time.Second), "")
+	testdb.InsertContactFire(t, rt, testdb.Org1, testdb.Bob, models.ContactFireTypeBroadcast, fmt.Sprint(bcast.ID), time.Now().Add(-time.Second), "")
+	testdb.InsertContactFire(t, rt, testdb.Org1, testdb.Cat, models.ContactFireTypeBroadcast, fmt.Sprint(bcast.ID), time.Now().Add(time.Hour), "")
+
+	// Dan's send is due and was for a variant of an experiment, Dan was created resolving the recipients and has already
+	// been counted as capped
+	testdb.InsertContactFire(t, rt, testdb.Org1, testdb.Dan, models.ContactFireTypeBroadcast, fmt.Sprintf("%d:0199f6a8-5e6f-7a8b-8c9d-0e1f2a3b4c5d:created:capped", bcast.ID), time.Now().Add(-time.Second), "")
+
+	cron := &crons.FireContactsCron{FetchBatchSize: 100, TaskBatchSize: 100, FlowBatchSize: 2}
+	res, err := cron.Run(ctx, rt)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]any{"wait_timeouts": 0, "wait_expires": 0, "session_expires": 0, "campaign_points": 0, "campaign_deferred": 0, "campaign_capped": 0, "drip_steps": 0, "drip_exits": 0, "broadcast_sends": 3}, res)
+
+	queued := testsuite.GetQueuedTasks(t, rt)
+	require.Len(t, queued["throttled/1"], 2)
+
+	payloads := make([]string, 0, 2)
+	for _, task := range queued["throttled/1"] {
+		assert.Equal(t, "send_broadcast_batch", task.Type)
+		payloads = append(payloads, string(task.Payload))
+	}
+	slices.Sort(payloads)
+
+	assert.JSONEq(t, fmt.Sprintf(`{"broadcast_id": %d, "contact_ids": [10000, 10001], "deferred": true}`, bcast.ID), payloads[0])
+	assert.JSONEq(t, fmt.Sprintf(`{"broadcast_id": %d, "contact_ids": [%d], "created_contact_ids": [%d], "variant_uuid": "0199f6a8-5e6f-7a8b-8c9d-0e1f2a3b4c5d", "capped_contact_ids": [%d], "deferred": true}`, bcast.ID, testdb.Dan.ID, testdb.Dan.ID, testdb.Dan.ID), payloads[1])
+
+	assertdb.Query(t, rt.DB, `SELECT count(*) FROM contacts_contactfire`).Returns(1)
+}
+
+func TestFireContactsFrequencyCaps(t *testing.T) {
+	ctx, rt := testsuite.Runtime(t)
+
+	rt.DB.MustExec(`UPDATE orgs_org SET config = config || '{"frequency_caps": {"week": 1, "defer": true}}'::jsonb WHERE id = $1`, testdb.Org1.ID)
+
+	oa, err := models.GetOrgAssetsWithRefresh(ctx, rt, testdb.Org1.ID, models.RefreshOrg)
+	require.NoError(t, err)
+
+	// Ann has already been sent a message this week
+	allowed, _, err := oa.Org().FrequencyCaps().Reserve(ctx, rt, oa, []models.ContactID{testdb.Ann.ID}, time.Now())
+	require.NoError(t, err)
+	assert.Len(t, allowed, 1)
+
+	// caps apply to fires for message points but not flow points
+	testdb.InsertContactFire(t, rt, testdb.Org1, testdb.Ann, models.ContactFireTypeCampaignPoint, fmt.Sprintf("%d:1", testdb.RemindersPoint2.ID), time.Now().Add(-time.Second), "")
+	testdb.InsertContactFire(t, rt, testdb.Org1, testdb.Bob, models.ContactFireTypeCampaignPoint, fmt.Sprintf("%d:1", testdb.RemindersPoint2.ID), time.Now().Add(-time.Second), "")
+	testdb.InsertContactFire(t, rt, testdb.Org1, testdb.Ann, models.ContactFireTypeCampaignPoint, fmt.Sprintf("%d:1", testdb.RemindersPoint1.ID), time.Now().Add(-time.Second), "")
+
+	cron := &crons.FireContactsCron{FetchBatchSize: 100, TaskBatchSize: 100, FlowBatchSize: 2}
+	res, err := cron.Run(ctx, rt)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]any{"wait_timeouts": 0, "wait_expires": 0, "session_expires": 0, "campaign_points": 2, "campaign_deferred": 0, "campaign_capped": 1, "drip_steps": 0, "drip_exits": 0, "broadcast_sends": 0}, res)
+
+	// Ann's fire for the message point has been pushed back to tomorrow
+	assertdb.Query(t, rt.DB, `SELECT count(*) FROM contacts_contactfire WHERE contact_id = $1 AND scope = $2 AND fire_on > NOW()`, testdb.Ann.ID, fmt.Sprintf("%d:1", testdb.RemindersPoint2.ID)).Returns(1)
+	assertdb.Query(t, rt.DB, `SELECT count(*) FROM contacts_contactfire`).Returns(1)
+
+	// and Bob's send for the message point was counted against the caps when it was allowed
+	_, capped, err := oa.Org().FrequencyCaps().Reserve(ctx, rt, oa, []models.ContactID{testdb.Bob.ID}, time.Now())
+	require.NoError(t, err)
+	assert.Equal(t, []models.ContactID{testdb.Bob.ID}, capped)
+
+	// the task queued for the message point carries when sends were reserved
+	queued := testsuite.GetQueuedTasks(t, rt)
+	var trigger *tasks.BulkCampaignTrigger
+	for _, task := range queued["throttled/1"] {
+		if task.Type == "bulk_campaign_trigger" {
+			tr := &tasks.BulkCampaignTrigger{}
+			jsonx.MustUnmarshal(task.Payload, tr)
+			if tr.PointID == testdb.RemindersPoint2.ID {
+				trigger = tr
+			}
+		}
+	}
+	require.NotNil(t, trigger)
+	assert.Equal(t, []models.ContactID{testdb.Bob.ID}, trigger.ContactIDs)
+	assert.False(t, trigger.CappedOn.IsZero())
+}
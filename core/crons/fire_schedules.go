@@ -39,11 +39,26 @@ func (c *FireSchedulesCron) Run(ctx context.Context, rt *runtime.Runtime) (map[s
 	broadcasts := 0
 	triggers := 0
 	noops := 0
+	holidays := 0
 
 	for _, s := range unfired {
 		log := log.With("schedule_id", s.ID)
 		now := time.Now()
 
+		// repeating schedules don't fire on holidays but are instead skipped or shifted to the next day
+		holidayFire, onHoliday, err := s.RescheduleForHoliday()
+		if err != nil {
+			log.Error("error checking schedule fire against holidays", "error", err)
+			continue
+		}
+		if onHoliday {
+			if err := s.UpdateNextFire(ctx, rt.DB, holidayFire); err != nil {
+				log.Error("error updating next fire for schedule on holiday", "error", err)
+			}
+			holidays++
+			continue
+		}
+
 		// calculate our next fire
 		nextFire, err := s.GetNextFire(now)
 		if err != nil {
@@ -88,6 +103,15 @@ func (c *FireSchedulesCron) Run(ctx context.Context, rt *runtime.Runtime) (map[s
 				continue
 			}
 
+			// smart starts are linked to their trigger so that their fires can be reported
+			if start.TriggerID != models.NilTriggerID {
+				if err := models.InsertSmartStartLink(ctx, rt, start); err != nil {
+					log.Error("error linking flow start to trigger", "error", err)
+					tx.Rollback()
+					continue
+				}
+			}
+
 			// add our flow start task
 			task = &tasks.StartFlow{FlowStart: start}
 			triggers++
@@ -131,5 +155,5 @@ func (c *FireSchedulesCron) Run(ctx context.Context, rt *runtime.Runtime) (map[s
 		}
 	}
 
-	return map[string]any{"broadcasts": broadcasts, "triggers": triggers, "noops": noops}, nil
+	return map[string]any{"broadcasts": broadcasts, "triggers": triggers, "noops": noops, "holidays": holidays}, nil
 }
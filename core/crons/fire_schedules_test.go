@@ -6,6 +6,7 @@ import (
 
 	"github.com/nyaruka/gocommon/dbutil/assertdb"
 	"github.com/nyaruka/gocommon/i18n"
+	"github.com/nyaruka/gocommon/jsonx"
 	"github.com/nyaruka/mailroom/v26/core/crons"
 	"github.com/nyaruka/mailroom/v26/core/models"
 	"github.com/nyaruka/mailroom/v26/testsuite"
@@ -41,7 +42,7 @@ func TestFireSchedules(t *testing.T) {
 	cron := &crons.FireSchedulesCron{}
 	res, err := cron.Run(ctx, rt)
 	assert.NoError(t, err)
-	assert.Equal(t, map[string]any{"broadcasts": 2, "triggers": 2, "noops": 1}, res)
+	assert.Equal(t, map[string]any{"broadcasts": 2, "triggers": 2, "noops": 1, "holidays": 0}, res)
 
 	// should have 2 flow starts added to our DB ready to go
 	assertdb.Query(t, rt.DB, `SELECT count(*) FROM flows_flowstart WHERE flow_id = $1 AND start_type = 'T' AND status = 'P'`, testdb.Favorites.ID).Returns(2)
@@ -82,3 +83,72 @@ func TestFireSchedules(t *testing.T) {
 	// check the tasks created
 	testsuite.AssertBatchTasks(t, rt, testdb.Org1.ID, map[string]int{"start_flow": 2, "send_broadcast": 2})
 }
+
+func TestFireSchedulesCronAndHolidays(t *testing.T) {
+	ctx, rt := testsuite.Runtime(t)
+
+	// add a repeating schedule which uses a cron expression that fires every 30 minutes
+	s1 := testdb.InsertSchedule(t, rt, testdb.Org1, models.RepeatPeriodDaily, time.Now().Add(-time.Hour))
+	testdb.InsertScheduledTrigger(t, rt, testdb.Org1, testdb.Favorites, s1, nil, nil, []*testdb.Contact{testdb.Ann})
+	rt.DB.MustExec(`UPDATE orgs_org SET config = config || jsonb_build_object('schedule_crons', jsonb_build_object($2::text, '*/30 * * * *')) WHERE id = $1`, testdb.Org1.ID, s1)
+
+	cron := &crons.FireSchedulesCron{}
+	res, err := cron.Run(ctx, rt)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]any{"broadcasts": 0, "triggers": 1, "noops": 0, "holidays": 0}, res)
+
+	assertdb.Query(t, rt.DB, `SELECT count(*) FROM schedules_schedule WHERE id = $1 AND next_fire > NOW() AND next_fire <= NOW() + INTERVAL '31 minutes'`, s1).Returns(1)
+
+	// make today a holiday in the org timezone and add a repeating schedule which is due
+	today := time.Now().Add(-time.Hour).In(testdb.Org1.Load(t, rt).Env().Timezone()).Format(time.DateOnly)
+	rt.DB.MustExec(`UPDATE orgs_org SET config = config || jsonb_build_object('holidays', jsonb_build_object('dates', jsonb_build_array($2::text))) WHERE id = $1`, testdb.Org1.ID, today)
+
+	s2 := testdb.InsertSchedule(t, rt, testdb.Org1, models.RepeatPeriodDaily, time.Now().Add(-time.Hour))
+	testdb.InsertBroadcast(t, rt, testdb.Org1, "0199877e-0ed2-790b-b474-35099cea401c", "eng", map[i18n.Language]string{"eng": "Hi"}, s2, []*testdb.Contact{testdb.Ann}, nil)
+
+	res, err = cron.Run(ctx, rt)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]any{"broadcasts": 0, "triggers": 0, "noops": 0, "holidays": 1}, res)
+
+	// schedule should have been moved to its next fire which isn't a holiday without firing
+	assertdb.Query(t, rt.DB, `SELECT count(*) FROM schedules_schedule WHERE id = $1 AND next_fire > NOW() AND last_fire IS NULL`, s2).Returns(1)
+	assertdb.Query(t, rt.DB, `SELECT count(*) FROM msgs_broadcast WHERE parent_id IS NOT NULL`).Returns(0)
+}
+
+func TestFireSchedulesSmartStarts(t *testing.T) {
+	ctx, rt := testsuite.Runtime(t)
+
+	// add a repeating schedule with a trigger which is a smart start
+	s1 := testdb.InsertSchedule(t, rt, testdb.Org1, models.RepeatPeriodWeekly, time.Now().Add(-time.Hour))
+	t1 := testdb.InsertScheduledTrigger(t, rt, testdb.Org1, testdb.Favorites, s1, nil, nil, nil)
+	rt.DB.MustExec(`UPDATE schedules_schedule SET repeat_days_of_week = 'M' WHERE id = $1`, s1)
+	rt.DB.MustExec(`UPDATE orgs_org SET config = config || jsonb_build_object('smart_starts', jsonb_build_object($2::text, '{"query": "enrolled = yes", "exclude_started_previously": true, "exclude_in_a_flow": true, "limit": 100}'::jsonb)) WHERE id = $1`, testdb.Org1.ID, t1)
+
+	cron := &crons.FireSchedulesCron{}
+	res, err := cron.Run(ctx, rt)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]any{"broadcasts": 0, "triggers": 1, "noops": 0, "holidays": 0}, res)
+
+	// flow start should have been created with the query and exclusions
+	assertdb.Query(t, rt.DB, `SELECT count(*) FROM flows_flowstart WHERE flow_id = $1 AND start_type = 'T' AND query = 'enrolled = yes' AND exclusions->>'started_previously' = 'true' AND exclusions->>'in_a_flow' = 'true'`, testdb.Favorites.ID).Returns(1)
+
+	// and the task should carry the limit and the trigger
+	queued := testsuite.GetQueuedTasks(t, rt)
+	assert.Len(t, queued["batch/1"], 1)
+	assert.Equal(t, "start_flow", queued["batch/1"][0].Type)
+
+	payload := &models.FlowStart{}
+	jsonx.MustUnmarshal(queued["batch/1"][0].Payload, payload)
+	assert.Equal(t, "enrolled = yes", payload.Query)
+	assert.Equal(t, 100, payload.Limit)
+	assert.Equal(t, t1, payload.TriggerID)
+
+	// and the start should be linked to the trigger so its fire is reported
+	fires, err := models.GetSmartStartFires(ctx, rt, testdb.Org1.ID, t1)
+	assert.NoError(t, err)
+	if assert.Len(t, fires, 1) {
+		assert.Equal(t, payload.UUID, fires[0].StartUUID)
+	}
+
+	assertdb.Query(t, rt.DB, `SELECT count(*) FROM schedules_schedule WHERE id = $1 AND next_fire > NOW() AND last_fire < NOW()`, s1).Returns(1)
+}
@@ -0,0 +1,37 @@
+package crons
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/nyaruka/mailroom/v26/core/models"
+	"github.com/nyaruka/mailroom/v26/core/tasks"
+	"github.com/nyaruka/mailroom/v26/runtime"
+)
+
+func init() {
+	Register("recompute_fields", &RecomputeFieldsCron{})
+}
+
+// RecomputeFieldsCron queues tasks to re-evaluate time dependent computed fields in orgs which have computed fields
+type RecomputeFieldsCron struct{}
+
+func (c *RecomputeFieldsCron) Next(last time.Time) time.Time {
+	return Next(last, time.Hour)
+}
+
+func (c *RecomputeFieldsCron) Run(ctx context.Context, rt *runtime.Runtime) (map[string]any, error) {
+	orgIDs, err := models.GetComputedFieldsOrgIDs(ctx, rt.DB)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, orgID := range orgIDs {
+		if err := tasks.Queue(ctx, rt, rt.Queues.Batch, orgID, &tasks.RecomputeFields{}, false); err != nil {
+			return nil, fmt.Errorf("error queuing recompute fields task for org #%d: %w", orgID, err)
+		}
+	}
+
+	return map[string]any{"orgs": len(orgIDs)}, nil
+}
@@ -0,0 +1,30 @@
+package crons_test
+
+import (
+	"testing"
+
+	"github.com/nyaruka/mailroom/v26/core/crons"
+	"github.com/nyaruka/mailroom/v26/testsuite"
+	"github.com/nyaruka/mailroom/v26/testsuite/testdb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecomputeFieldsCron(t *testing.T) {
+	ctx, rt := testsuite.Runtime(t)
+
+	cron := &crons.RecomputeFieldsCron{}
+
+	// no orgs have computed fields
+	res, err := cron.Run(ctx, rt)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]any{"orgs": 0}, res)
+	assert.Equal(t, map[string][]string{}, testsuite.GetQueuedTaskTypes(t, rt))
+
+	rt.DB.MustExec(`UPDATE orgs_org SET config = config || '{"computed_fields": {"age": "@(datetime_diff(fields.joined, today(), \"Y\"))"}}'::jsonb WHERE id = $1`, testdb.Org2.ID)
+
+	res, err = cron.Run(ctx, rt)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]any{"orgs": 1}, res)
+	assert.Equal(t, map[string][]string{"batch/2": {"recompute_fields"}}, testsuite.GetQueuedTaskTypes(t, rt))
+}
@@ -0,0 +1,144 @@
+package crons
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	valkey "github.com/gomodule/redigo/redis"
+	"github.com/nyaruka/gocommon/dates"
+	"github.com/nyaruka/gocommon/httpx"
+	"github.com/nyaruka/goflow/core"
+	"github.com/nyaruka/mailroom/v26/core/models"
+	"github.com/nyaruka/mailroom/v26/runtime"
+)
+
+func init() {
+	Register("reconcile_airtime", &ReconcileAirtimeCron{StuckAfter: time.Hour, GiveUpAfter: time.Hour * 24 * 30, BatchSize: 1000})
+}
+
+const reconcileAirtimeCursorKey = "airtime_reconcile_cursor"
+
+var reconcileAirtimeHTTPRetries = httpx.NewFixedRetries(time.Second*5, time.Second*10)
+
+// ReconcileAirtimeCron asks providers for the status of airtime transfers which have been in a non-final status for
+// longer than we'd expect, e.g. because a status callback was lost.
+type ReconcileAirtimeCron struct {
+	StuckAfter  time.Duration // how long a transfer can go without a final status before we ask the provider
+	GiveUpAfter time.Duration // how old a transfer can be before we stop asking
+	BatchSize   int
+}
+
+func (c *ReconcileAirtimeCron) Next(last time.Time) time.Time {
+	return Next(last, time.Minute*15)
+}
+
+func (c *ReconcileAirtimeCron) Run(ctx context.Context, rt *runtime.Runtime) (map[string]any, error) {
+	now := dates.Now()
+
+	vc := rt.VK.Get()
+	defer vc.Close()
+
+	// we work through stuck transfers in id order from where the last run left off, so that transfers which stay stuck
+	// don't keep getting checked ahead of the others
+	cursor, err := valkey.Int(vc.Do("GET", reconcileAirtimeCursorKey))
+	if err != nil && err != valkey.ErrNil {
+		return nil, fmt.Errorf("error reading airtime reconcile cursor: %w", err)
+	}
+
+	transfers, err := models.LoadAirtimeTransfersToReconcile(ctx, rt.DB, now.Add(-c.GiveUpAfter), now.Add(-c.StuckAfter), models.AirtimeTransferID(cursor), c.BatchSize)
+	if err != nil {
+		return nil, fmt.Errorf("error loading airtime transfers to reconcile: %w", err)
+	}
+
+	// if this was the last batch, start again from the beginning next time
+	cursor = 0
+	if len(transfers) == c.BatchSize {
+		cursor = int(transfers[len(transfers)-1].ID())
+	}
+	if _, err := vc.Do("SET", reconcileAirtimeCursorKey, cursor); err != nil {
+		return nil, fmt.Errorf("error writing airtime reconcile cursor: %w", err)
+	}
+
+	byOrg := make(map[models.OrgID][]*models.AirtimeTransfer)
+	for _, t := range transfers {
+		byOrg[t.OrgID()] = append(byOrg[t.OrgID()], t)
+	}
+
+	numUpdated, numErrored := 0, 0
+	var logs []*models.HTTPLog
+
+	for orgID, orgTransfers := range byOrg {
+		updated, errored, orgLogs, err := c.reconcileOrg(ctx, rt, orgID, orgTransfers)
+		if err != nil {
+			slog.Error("error reconciling airtime transfers", "org_id", orgID, "error", err)
+			errored = len(orgTransfers) - updated
+		}
+
+		numUpdated += updated
+		numErrored += errored
+		logs = append(logs, orgLogs...)
+	}
+
+	if err := models.InsertHTTPLogs(ctx, rt.DB, logs); err != nil {
+		return nil, fmt.Errorf("error inserting airtime transfer http logs: %w", err)
+	}
+
+	return map[string]any{"checked": len(transfers), "updated": numUpdated, "errored": numErrored}, nil
+}
+
+func (c *ReconcileAirtimeCron) reconcileOrg(ctx context.Context, rt *runtime.Runtime, orgID models.OrgID, transfers []*models.AirtimeTransfer) (int, int, []*models.HTTPLog, error) {
+	oa, err := models.GetOrgAssets(ctx, rt, orgID)
+	if err != nil {
+		return 0, 0, nil, fmt.Errorf("error loading org assets: %w", err)
+	}
+
+	svc, err := oa.Org().AirtimeService(rt, rt.HTTP.Services, reconcileAirtimeHTTPRetries)
+	if err != nil {
+		return 0, 0, nil, fmt.Errorf("error getting airtime service: %w", err)
+	}
+
+	checker, ok := svc.(models.AirtimeStatusChecker)
+	if !ok {
+		return 0, 0, nil, fmt.Errorf("airtime provider %s doesn't support status checks", oa.Org().AirtimeProvider())
+	}
+
+	numUpdated, numErrored := 0, 0
+	var logs []*models.HTTPLog
+
+	for _, transfer := range transfers {
+		logger := &core.HTTPLogger{}
+		name, checkErr := checker.CheckStatus(ctx, transfer.ExternalID(), logger.Log)
+
+		for _, l := range logger.Logs {
+			log := models.NewAirtimeTransferredLog(orgID, l.URL, l.StatusCode, l.Request, l.Response, l.Status != core.CallStatusSuccess, time.Duration(l.ElapsedMS)*time.Millisecond, l.Retries, l.CreatedOn)
+			log.SetAirtimeTransferID(transfer.ID())
+			logs = append(logs, log)
+		}
+
+		if checkErr != nil {
+			slog.Warn("unable to check status of airtime transfer", "transfer", transfer.UUID(), "org_id", orgID, "error", checkErr)
+			numErrored++
+			continue
+		}
+
+		status, _ := models.AirtimeTransferStatusFromName(name)
+		if status == "" || status == transfer.Status() {
+			continue
+		}
+
+		tag, err := models.UpdateAirtimeTransferStatus(ctx, rt.DB, transfer.UUID(), transfer.ExternalID(), status)
+		if err != nil {
+			return numUpdated, numErrored, logs, fmt.Errorf("error updating airtime transfer status: %w", err)
+		}
+		if tag != nil {
+			if _, err := rt.Dynamo.History.Queue(tag); err != nil {
+				return numUpdated, numErrored, logs, fmt.Errorf("error queuing airtime status tag: %w", err)
+			}
+			numUpdated++
+		}
+	}
+
+	return numUpdated, numErrored, logs, nil
+}
@@ -0,0 +1,155 @@
+package crons_test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/nyaruka/gocommon/dbutil/assertdb"
+	"github.com/nyaruka/gocommon/httpx"
+	"github.com/nyaruka/gocommon/urns"
+	"github.com/nyaruka/goflow/core"
+	"github.com/nyaruka/goflow/core/events"
+	"github.com/nyaruka/mailroom/v26/core/crons"
+	"github.com/nyaruka/mailroom/v26/core/models"
+	"github.com/nyaruka/mailroom/v26/testsuite"
+	"github.com/nyaruka/mailroom/v26/testsuite/testdb"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReconcileAirtime(t *testing.T) {
+	ctx, rt := testsuite.Runtime(t)
+	rt.Config.Domain = "mailroom.example.com"
+
+	rt.DB.MustExec(`UPDATE orgs_org SET config = '{"dtone_key": "key123", "dtone_secret": "sesame"}'::jsonb WHERE id = $1`, testdb.Org1.ID)
+
+	insertTransfer := func(externalID string, age time.Duration) *models.AirtimeTransfer {
+		tr := models.NewAirtimeTransfer(testdb.Org1.ID, testdb.Ann.ID, events.NewAirtimeCreated(events.NewEventUUID(), &core.AirtimeTransfer{
+			ExternalID: externalID,
+			Sender:     urns.URN("tel:+250700000001"),
+			Recipient:  urns.URN("tel:+250700000002"),
+			Currency:   "RWF",
+			Amount:     decimal.RequireFromString("100"),
+		}, nil))
+		require.NoError(t, models.InsertAirtimeTransfers(ctx, rt.DB, []*models.AirtimeTransfer{tr}))
+		rt.DB.MustExec(`UPDATE airtime_airtimetransfer SET created_on = NOW() - $2::interval WHERE id = $1`, tr.ID(), fmt.Sprintf("%d seconds", int(age.Seconds())))
+		return tr
+	}
+
+	stuck1 := insertTransfer("2237512891", 2*time.Hour)      // provider says it completed
+	stuck2 := insertTransfer("2237512892", 3*time.Hour)      // provider errors
+	stuck3 := insertTransfer("2237512893", 4*time.Hour)      // provider says it's still submitted
+	recent := insertTransfer("2237512894", 5*time.Minute)    // too recent to be considered stuck
+	ancient := insertTransfer("2237512895", 24*time.Hour*60) // too old to keep asking about
+	done := insertTransfer("2237512896", 2*time.Hour)
+	rt.DB.MustExec(`UPDATE airtime_airtimetransfer SET status = 'S' WHERE id = $1`, done.ID())
+
+	rt.HTTP.Services.Transport, _ = testsuite.MockTransport(map[string][]*httpx.MockResponse{
+		"https://dvs-api.dtone.com/v1/transactions/2237512891": {
+			httpx.NewMockResponse(200, nil, []byte(`{"id":2237512891,"status":{"class":{"id":7,"message":"COMPLETED"},"message":"COMPLETED"}}`)),
+		},
+		"https://dvs-api.dtone.com/v1/transactions/2237512892": {
+			httpx.NewMockResponse(404, nil, []byte(`{"errors":[{"code":1003001,"message":"Transaction not found"}]}`)),
+		},
+		"https://dvs-api.dtone.com/v1/transactions/2237512893": {
+			httpx.NewMockResponse(200, nil, []byte(`{"id":2237512893,"status":{"class":{"id":5,"message":"SUBMITTED"},"message":"SUBMITTED"}}`)),
+		},
+	})
+
+	// start from a clean history table so we can assert exactly what the cron writes
+	testsuite.GetHistoryItems(t, rt, true, time.Time{})
+
+	cron := &crons.ReconcileAirtimeCron{StuckAfter: time.Hour, GiveUpAfter: time.Hour * 24 * 30, BatchSize: 100}
+	res, err := cron.Run(ctx, rt)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]any{"checked": 3, "updated": 2, "errored": 1}, res)
+
+	assertdb.Query(t, rt.DB, `SELECT status FROM airtime_airtimetransfer WHERE id = $1`, stuck1.ID()).Returns("S")
+	assertdb.Query(t, rt.DB, `SELECT status FROM airtime_airtimetransfer WHERE id = $1`, stuck2.ID()).Returns("P")
+	assertdb.Query(t, rt.DB, `SELECT status FROM airtime_airtimetransfer WHERE id = $1`, stuck3.ID()).Returns("B")
+	assertdb.Query(t, rt.DB, `SELECT status FROM airtime_airtimetransfer WHERE id = $1`, recent.ID()).Returns("P")
+	assertdb.Query(t, rt.DB, `SELECT status FROM airtime_airtimetransfer WHERE id = $1`, ancient.ID()).Returns("P")
+
+	// every status check is logged against its transfer
+	assertdb.Query(t, rt.DB, `SELECT count(*) FROM request_logs_httplog WHERE airtime_transfer_id = ANY(ARRAY[$1, $2, $3]::int[])`, stuck1.ID(), stuck2.ID(), stuck3.ID()).Returns(3)
+
+	// and the changes are recorded in the contact's history
+	items := testsuite.GetHistoryItems(t, rt, true, time.Time{})
+	if assert.Len(t, items, 2) {
+		sks := []string{items[0].SK, items[1].SK}
+		assert.Contains(t, sks, fmt.Sprintf("evt#%s#sts", stuck1.UUID()))
+		assert.Contains(t, sks, fmt.Sprintf("evt#%s#sts", stuck3.UUID()))
+	}
+
+	// running again only checks the transfers which are still stuck
+	rt.HTTP.Services.Transport, _ = testsuite.MockTransport(map[string][]*httpx.MockResponse{
+		"https://dvs-api.dtone.com/v1/transactions/2237512892": {
+			httpx.NewMockResponse(200, nil, []byte(`{"id":2237512892,"status":{"class":{"id":4,"message":"CANCELLED"},"message":"CANCELLED"}}`)),
+		},
+		"https://dvs-api.dtone.com/v1/transactions/2237512893": {
+			httpx.NewMockResponse(200, nil, []byte(`{"id":2237512893,"status":{"class":{"id":5,"message":"SUBMITTED"},"message":"SUBMITTED"}}`)),
+		},
+	})
+
+	res, err = cron.Run(ctx, rt)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]any{"checked": 2, "updated": 1, "errored": 0}, res)
+
+	assertdb.Query(t, rt.DB, `SELECT status FROM airtime_airtimetransfer WHERE id = $1`, stuck2.ID()).Returns("A")
+	assertdb.Query(t, rt.DB, `SELECT status FROM airtime_airtimetransfer WHERE id = $1`, stuck3.ID()).Returns("B")
+}
+
+func TestReconcileAirtimeCursor(t *testing.T) {
+	ctx, rt := testsuite.Runtime(t)
+	rt.Config.Domain = "mailroom.example.com"
+
+	rt.DB.MustExec(`UPDATE orgs_org SET config = '{"dtone_key": "key123", "dtone_secret": "sesame"}'::jsonb WHERE id = $1`, testdb.Org1.ID)
+
+	transfers := make([]*models.AirtimeTransfer, 3)
+	mocks := make(map[string][]*httpx.MockResponse)
+
+	for i := range transfers {
+		externalID := fmt.Sprintf("223751290%d", i)
+		transfers[i] = models.NewAirtimeTransfer(testdb.Org1.ID, testdb.Ann.ID, events.NewAirtimeCreated(events.NewEventUUID(), &core.AirtimeTransfer{
+			ExternalID: externalID,
+			Sender:     urns.URN("tel:+250700000001"),
+			Recipient:  urns.URN("tel:+250700000002"),
+			Currency:   "RWF",
+			Amount:     decimal.RequireFromString("100"),
+		}, nil))
+		require.NoError(t, models.InsertAirtimeTransfers(ctx, rt.DB, []*models.AirtimeTransfer{transfers[i]}))
+
+		submitted := httpx.NewMockResponse(200, nil, fmt.Appendf(nil, `{"id":%s,"status":{"class":{"id":5,"message":"SUBMITTED"},"message":"SUBMITTED"}}`, externalID))
+		mocks["https://dvs-api.dtone.com/v1/transactions/"+externalID] = []*httpx.MockResponse{submitted, submitted}
+	}
+	rt.DB.MustExec(`UPDATE airtime_airtimetransfer SET created_on = NOW() - INTERVAL '2 hours'`)
+
+	rt.HTTP.Services.Transport, _ = testsuite.MockTransport(mocks)
+
+	checks := func(tr *models.AirtimeTransfer) int {
+		var count int
+		require.NoError(t, rt.DB.Get(&count, `SELECT count(*) FROM request_logs_httplog WHERE airtime_transfer_id = $1`, tr.ID()))
+		return count
+	}
+
+	cron := &crons.ReconcileAirtimeCron{StuckAfter: time.Hour, GiveUpAfter: time.Hour * 24 * 30, BatchSize: 2}
+
+	// first run checks the first two transfers
+	res, err := cron.Run(ctx, rt)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]any{"checked": 2, "updated": 0, "errored": 0}, res)
+
+	// second run continues with the third rather than checking the first two again
+	res, err = cron.Run(ctx, rt)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]any{"checked": 1, "updated": 0, "errored": 0}, res)
+	assert.Equal(t, []int{1, 1, 1}, []int{checks(transfers[0]), checks(transfers[1]), checks(transfers[2])})
+
+	// and then we start over from the beginning
+	res, err = cron.Run(ctx, rt)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]any{"checked": 2, "updated": 0, "errored": 0}, res)
+	assert.Equal(t, []int{2, 2, 1}, []int{checks(transfers[0]), checks(transfers[1]), checks(transfers[2])})
+}
@@ -119,6 +119,29 @@ func ImportBatch(ctx context.Context, rt *runtime.Runtime, oa *models.OrgAssets,
 func getOrCreateContacts(ctx context.Context, db *sqlx.DB, oa *models.OrgAssets, userID models.UserID, imports []*importContact) error {
 	sa := oa.SessionAssets()
 
+	fromURNs := func(spec *models.ContactSpec) (*models.Contact, *core.Contact, bool, error) {
+		return models.GetOrCreateContact(ctx, db, oa, userID, spec.URNs, models.NilChannelID)
+	}
+
+	if err := resolveContacts(ctx, db, oa, imports, fromURNs); err != nil {
+		return err
+	}
+
+	for _, imp := range imports {
+		if imp.contact != nil {
+			imp.mods = append(imp.mods, modifiers.NewURNs(imp.spec.URNs, modifiers.URNsAppend))
+
+			addSpecModifiers(sa, imp)
+		}
+	}
+
+	return nil
+}
+
+// resolves the contact of each import, by UUID if it has one, or otherwise from its URNs using the given function which
+// returns the contact, its engine contact and whether it was created. Imports whose contact can't be resolved are given
+// an error and left without a contact.
+func resolveContacts(ctx context.Context, db *sqlx.DB, oa *models.OrgAssets, imports []*importContact, fromURNs func(*models.ContactSpec) (*models.Contact, *core.Contact, bool, error)) error {
 	// build map of UUIDs to contacts
 	contactsByUUID, err := loadContactsByUUID(ctx, db, oa, imports)
 	if err != nil {
@@ -126,17 +149,13 @@ func getOrCreateContacts(ctx context.Context, db *sqlx.DB, oa *models.OrgAssets,
 	}
 
 	for _, imp := range imports {
-		addModifier := func(m flows.Modifier) { imp.mods = append(imp.mods, m) }
 		addError := func(s string, args ...any) { imp.errors = append(imp.errors, fmt.Sprintf(s, args...)) }
 		spec := imp.spec
 
-		isActive := spec.Status == "" || spec.Status == core.ContactStatusActive
-
-		uuid := spec.UUID
-		if uuid != "" {
-			imp.mc = contactsByUUID[uuid]
+		if spec.UUID != "" {
+			imp.mc = contactsByUUID[spec.UUID]
 			if imp.mc == nil {
-				addError("Unable to find contact with UUID '%s'", uuid)
+				addError("Unable to find contact with UUID '%s'", spec.UUID)
 				continue
 			}
 
@@ -144,65 +163,72 @@ func getOrCreateContacts(ctx context.Context, db *sqlx.DB, oa *models.OrgAssets,
 			if err != nil {
 				return fmt.Errorf("error creating engine contact for %d: %w", imp.mc.ID(), err)
 			}
-
 		} else {
-			imp.mc, imp.contact, imp.created, err = models.GetOrCreateContact(ctx, db, oa, userID, spec.URNs, models.NilChannelID)
+			imp.mc, imp.contact, imp.created, err = fromURNs(spec)
 			if err != nil {
+				imp.mc, imp.contact, imp.created = nil, nil, false
+
 				urnStrs := make([]string, len(spec.URNs))
 				for i := range spec.URNs {
 					urnStrs[i] = string(spec.URNs[i].Identity())
 				}
 
 				addError("Unable to find or create contact with URNs %s", strings.Join(urnStrs, ", "))
-				continue
 			}
 		}
+	}
 
-		addModifier(modifiers.NewURNs(spec.URNs, modifiers.URNsAppend))
+	return nil
+}
 
-		if spec.Name != nil {
-			addModifier(modifiers.NewName(*spec.Name))
-		}
-		if spec.Language != nil {
-			lang, err := i18n.ParseLanguage(*spec.Language)
-			if err != nil {
-				addError("'%s' is not a valid language code", *spec.Language)
-			} else {
-				addModifier(modifiers.NewLanguage(lang))
-			}
+// adds the modifiers for the name, language, status, fields and groups of the import's spec
+func addSpecModifiers(sa flows.SessionAssets, imp *importContact) {
+	addModifier := func(m flows.Modifier) { imp.mods = append(imp.mods, m) }
+	addError := func(s string, args ...any) { imp.errors = append(imp.errors, fmt.Sprintf(s, args...)) }
+	spec := imp.spec
+
+	isActive := spec.Status == "" || spec.Status == core.ContactStatusActive
+
+	if spec.Name != nil {
+		addModifier(modifiers.NewName(*spec.Name))
+	}
+	if spec.Language != nil {
+		lang, err := i18n.ParseLanguage(*spec.Language)
+		if err != nil {
+			addError("'%s' is not a valid language code", *spec.Language)
+		} else {
+			addModifier(modifiers.NewLanguage(lang))
 		}
-		if !isActive {
-			if spec.Status == core.ContactStatusArchived || spec.Status == core.ContactStatusBlocked || spec.Status == core.ContactStatusStopped {
-				addModifier(modifiers.NewStatus(spec.Status))
-			} else {
-				addError("'%s' is not a valid status", spec.Status)
-			}
+	}
+	if !isActive {
+		if spec.Status == core.ContactStatusArchived || spec.Status == core.ContactStatusBlocked || spec.Status == core.ContactStatusStopped {
+			addModifier(modifiers.NewStatus(spec.Status))
+		} else {
+			addError("'%s' is not a valid status", spec.Status)
 		}
+	}
 
-		for key, value := range spec.Fields {
-			field := sa.Fields().Get(key)
-			if field == nil {
-				addError("'%s' is not a valid contact field key", key)
-			} else {
-				addModifier(modifiers.NewField(field, value))
-			}
+	for key, value := range spec.Fields {
+		field := sa.Fields().Get(key)
+		if field == nil {
+			addError("'%s' is not a valid contact field key", key)
+		} else {
+			addModifier(modifiers.NewField(field, value))
 		}
+	}
 
-		if len(spec.Groups) > 0 && isActive {
-			groups := make([]*core.Group, 0, len(spec.Groups))
-			for _, uuid := range spec.Groups {
-				group := sa.Groups().Get(uuid)
-				if group == nil {
-					addError("'%s' is not a valid contact group UUID", uuid)
-				} else {
-					groups = append(groups, group)
-				}
+	if len(spec.Groups) > 0 && isActive {
+		groups := make([]*core.Group, 0, len(spec.Groups))
+		for _, uuid := range spec.Groups {
+			group := sa.Groups().Get(uuid)
+			if group == nil {
+				addError("'%s' is not a valid contact group UUID", uuid)
+			} else {
+				groups = append(groups, group)
 			}
-			addModifier(modifiers.NewGroups(groups, modifiers.GroupsAdd))
 		}
+		addModifier(modifiers.NewGroups(groups, modifiers.GroupsAdd))
 	}
-
-	return nil
 }
 
 // loads any import contacts for which we have UUIDs
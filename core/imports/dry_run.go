@@ -0,0 +1,197 @@
+package imports
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/nyaruka/gocommon/dates"
+	"github.com/nyaruka/gocommon/i18n"
+	"github.com/nyaruka/gocommon/urns"
+	"github.com/nyaruka/goflow/assets"
+	"github.com/nyaruka/goflow/core"
+	"github.com/nyaruka/goflow/core/events"
+	"github.com/nyaruka/goflow/flows"
+	"github.com/nyaruka/goflow/flows/modifiers"
+	"github.com/nyaruka/mailroom/v26/core/goflow"
+	"github.com/nyaruka/mailroom/v26/core/models"
+	"github.com/nyaruka/mailroom/v26/runtime"
+)
+
+// DryRunReport is what importing a set of contact specs would do
+type DryRunReport struct {
+	NumCreated    int                  `json:"num_created"`    // records which would create contacts without errors
+	NumUpdated    int                  `json:"num_updated"`    // records which would update contacts without errors
+	NumErrored    int                  `json:"num_errored"`    // records with errors, whether or not they match a contact
+	URNConflicts  int                  `json:"urn_conflicts"`  // URNs which belong to other contacts
+	InvalidFields int                  `json:"invalid_fields"` // values which can't be parsed as their field's type
+	GroupsAdded   int                  `json:"groups_added"`   // group memberships added
+	GroupsRemoved int                  `json:"groups_removed"` // group memberships removed, e.g. by blocking
+	Errors        []models.ImportError `json:"errors"`
+}
+
+// DryRun matches the given specs to contacts and applies their modifiers to in-memory copies of those contacts, in the
+// same way as an import, but without creating or changing anything in the database.
+func DryRun(ctx context.Context, rt *runtime.Runtime, oa *models.OrgAssets, specs []*models.ContactSpec) (*DryRunReport, error) {
+	imports := make([]*importContact, len(specs))
+	for i := range imports {
+		imports[i] = &importContact{record: i, spec: specs[i]}
+	}
+
+	report := &DryRunReport{Errors: make([]models.ImportError, 0, 10)}
+
+	if err := matchContacts(ctx, rt, oa, imports, report); err != nil {
+		return nil, fmt.Errorf("error matching contacts: %w", err)
+	}
+
+	env := flows.NewAssetsEnvironment(oa.Env(), oa.SessionAssets())
+	eng := goflow.Engine(rt)
+
+	for _, imp := range imports {
+		if imp.contact != nil {
+			imp.mods = append(imp.mods, modifiers.NewURNs(imp.spec.URNs, modifiers.URNsAppend))
+
+			addSpecModifiers(oa.SessionAssets(), imp)
+
+			evtLog := func(e events.Event) {
+				switch typed := e.(type) {
+				case *events.ContactGroupsChanged:
+					report.GroupsAdded += len(typed.GroupsAdded)
+					report.GroupsRemoved += len(typed.GroupsRemoved)
+				case *events.Error:
+					imp.errors = append(imp.errors, typed.Text)
+				}
+			}
+
+			for _, mod := range imp.mods {
+				if _, err := modifiers.Apply(ctx, eng, env, oa.SessionAssets(), imp.contact, mod, evtLog); err != nil {
+					return nil, fmt.Errorf("error applying %s modifier to contact %s: %w", mod.Type(), imp.contact.UUID(), err)
+				}
+			}
+
+			for key, value := range imp.spec.Fields {
+				if f := oa.FieldByKey(key); f != nil && !isValidFieldValue(f, imp.contact.Fields()[key]) {
+					imp.errors = append(imp.errors, fmt.Sprintf("'%s' is not a valid value for field '%s'", value, key))
+					report.InvalidFields++
+				}
+			}
+		}
+
+		// each record is counted once, as errored if it has any errors
+		if len(imp.errors) > 0 {
+			report.NumErrored++
+		} else if imp.created {
+			report.NumCreated++
+		} else {
+			report.NumUpdated++
+		}
+
+		for _, e := range imp.errors {
+			report.Errors = append(report.Errors, models.ImportError{Record: imp.record, Row: imp.spec.ImportRow, Message: e})
+		}
+	}
+
+	return report, nil
+}
+
+// like getOrCreateContacts but doesn't create contacts, and looks for URNs that would be taken from other contacts
+// rather than leaving that to the engine, which would record claims on them
+func matchContacts(ctx context.Context, rt *runtime.Runtime, oa *models.OrgAssets, imports []*importContact, report *DryRunReport) error {
+	allURNs := make([]urns.URN, 0, len(imports))
+	for _, imp := range imports {
+		allURNs = append(allURNs, imp.spec.URNs...)
+	}
+
+	owners, err := models.GetContactIDsFromURNs(ctx, rt.DB, oa.OrgID(), allURNs)
+	if err != nil {
+		return fmt.Errorf("error looking up contacts for URNs: %w", err)
+	}
+
+	ownerIDs := make([]models.ContactID, 0, len(owners))
+	for _, id := range owners {
+		if id != models.NilContactID {
+			ownerIDs = append(ownerIDs, id)
+		}
+	}
+	owned, err := models.LoadContacts(ctx, rt.DB, oa, ownerIDs)
+	if err != nil {
+		return fmt.Errorf("error loading contacts by URN: %w", err)
+	}
+	ownersByID := make(map[models.ContactID]*models.Contact, len(owned))
+	for _, c := range owned {
+		ownersByID[c.ID()] = c
+	}
+
+	// finds the contact which owns the URNs, or creates an in-memory contact if none do
+	fromURNs := func(spec *models.ContactSpec) (*models.Contact, *core.Contact, bool, error) {
+		var mc *models.Contact
+		matched := make(map[models.ContactID]bool, len(spec.URNs))
+		for _, u := range spec.URNs {
+			if owner := owners[u]; owner != models.NilContactID {
+				matched[owner] = true
+				mc = ownersByID[owner]
+			}
+		}
+
+		if len(matched) > 1 {
+			report.URNConflicts++
+			return nil, nil, false, errors.New("URNs belong to different contacts")
+		}
+
+		if mc == nil {
+			contact, err := newContact(oa, spec.URNs)
+			return nil, contact, true, err
+		}
+
+		contact, err := mc.EngineContact(oa)
+		return mc, contact, false, err
+	}
+
+	if err := resolveContacts(ctx, rt.DB, oa, imports, fromURNs); err != nil {
+		return err
+	}
+
+	// contacts matched by UUID will take any URNs which belong to other contacts
+	for _, imp := range imports {
+		if imp.mc != nil && imp.spec.UUID != "" {
+			for _, u := range imp.spec.URNs {
+				if owner := owners[u]; owner != models.NilContactID && owner != imp.mc.ID() {
+					imp.errors = append(imp.errors, fmt.Sprintf("URN %s already taken by another contact", u.Identity()))
+					report.URNConflicts++
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// creates an in-memory engine contact as a contact created by an import would be
+func newContact(oa *models.OrgAssets, urnz []urns.URN) (*core.Contact, error) {
+	contact, err := core.NewContact(oa.SessionAssets(), core.NewContactUUID(), 0, "", i18n.NilLanguage, core.ContactStatusActive, oa.Env().Timezone(), dates.Now(), nil, urnz, nil, nil, nil, assets.IgnoreMissing)
+	if err != nil {
+		return nil, fmt.Errorf("error creating engine contact: %w", err)
+	}
+	return contact, nil
+}
+
+// checks that a field value set by an import was parsed as the field's type, e.g. a number for a number field
+func isValidFieldValue(f *models.Field, v *core.Value) bool {
+	if v == nil {
+		return true // value was empty and so cleared the field
+	}
+
+	switch f.Type() {
+	case assets.FieldTypeNumber:
+		return v.Number != nil
+	case assets.FieldTypeDatetime:
+		return v.Datetime != nil
+	case assets.FieldTypeState:
+		return v.State != ""
+	case assets.FieldTypeDistrict:
+		return v.District != ""
+	case assets.FieldTypeWard:
+		return v.Ward != ""
+	}
+	return true
+}
@@ -0,0 +1,80 @@
+package imports_test
+
+import (
+	"testing"
+
+	"github.com/nyaruka/gocommon/dbutil/assertdb"
+	"github.com/nyaruka/gocommon/urns"
+	"github.com/nyaruka/goflow/assets"
+	"github.com/nyaruka/goflow/core"
+	"github.com/nyaruka/mailroom/v26/core/imports"
+	"github.com/nyaruka/mailroom/v26/core/models"
+	"github.com/nyaruka/mailroom/v26/testsuite"
+	"github.com/nyaruka/mailroom/v26/testsuite/testdb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDryRun(t *testing.T) {
+	ctx, rt := testsuite.Runtime(t)
+
+	oa := testdb.Org1.Load(t, rt)
+
+	norbert := "Norbert"
+	daniel := "Daniel"
+
+	specs := []*models.ContactSpec{
+		{ // new contact
+			Name:      &norbert,
+			URNs:      []urns.URN{"tel:+16055740001"},
+			Fields:    map[string]string{"gender": "M"},
+			Groups:    []assets.GroupUUID{testdb.TestersGroup.UUID},
+			ImportRow: 2,
+		},
+		{ // Ann matched by URN but with an invalid age
+			URNs:      []urns.URN{"tel:+16055741111"},
+			Fields:    map[string]string{"age": "old"},
+			ImportRow: 3,
+		},
+		{ // Bob matched by UUID but given Cat's URN
+			UUID:      testdb.Bob.UUID,
+			URNs:      []urns.URN{"tel:+16055743333"},
+			ImportRow: 4,
+		},
+		{ // URNs belong to different contacts
+			URNs:      []urns.URN{"tel:+16055741111", "tel:+16055743333"},
+			ImportRow: 5,
+		},
+		{ // no such contact
+			UUID:      core.ContactUUID("cd5ab8de-9d7b-4f3f-9d7c-4d5bbfa6d0a4"),
+			ImportRow: 6,
+		},
+		{ // Dan matched by UUID, renamed and given a new URN
+			UUID:      testdb.Dan.UUID,
+			Name:      &daniel,
+			URNs:      []urns.URN{"tel:+16055740002"},
+			ImportRow: 7,
+		},
+	}
+
+	report, err := imports.DryRun(ctx, rt, oa, specs)
+	require.NoError(t, err)
+
+	assert.Equal(t, 1, report.NumCreated)
+	assert.Equal(t, 1, report.NumUpdated)
+	assert.Equal(t, 4, report.NumErrored)
+	assert.Equal(t, 2, report.URNConflicts)
+	assert.Equal(t, 1, report.InvalidFields)
+	assert.Equal(t, 1, report.GroupsAdded)
+	assert.Equal(t, 0, report.GroupsRemoved)
+	assert.Equal(t, []models.ImportError{
+		{Record: 1, Row: 3, Message: "'old' is not a valid value for field 'age'"},
+		{Record: 2, Row: 4, Message: "URN tel:+16055743333 already taken by another contact"},
+		{Record: 3, Row: 5, Message: "Unable to find or create contact with URNs tel:+16055741111, tel:+16055743333"},
+		{Record: 4, Row: 6, Message: "Unable to find contact with UUID 'cd5ab8de-9d7b-4f3f-9d7c-4d5bbfa6d0a4'"},
+	}, report.Errors)
+
+	// nothing should have been changed in the database
+	assertdb.Query(t, rt.DB, `SELECT count(*) FROM contacts_contacturn WHERE identity IN ('tel:+16055740001', 'tel:+16055740002')`).Returns(0)
+	assertdb.Query(t, rt.DB, `SELECT count(*) FROM contacts_contacturn WHERE identity = 'tel:+16055743333' AND contact_id = $1`, testdb.Cat.ID).Returns(1)
+}
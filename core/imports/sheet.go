@@ -0,0 +1,356 @@
+package imports
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/nyaruka/gocommon/i18n"
+	"github.com/nyaruka/gocommon/urns"
+	"github.com/nyaruka/gocommon/uuids"
+	"github.com/nyaruka/goflow/assets"
+	"github.com/nyaruka/goflow/core"
+	"github.com/nyaruka/mailroom/v26/core/models"
+	"github.com/nyaruka/mailroom/v26/runtime"
+	"github.com/nyaruka/mailroom/v26/utils/sheets"
+)
+
+// MappingType is the type of a column mapping
+type MappingType string
+
+const (
+	MappingTypeAttribute MappingType = "attribute"
+	MappingTypeScheme    MappingType = "scheme"
+	MappingTypeField     MappingType = "field"
+	MappingTypeGroup     MappingType = "group"
+	MappingTypeIgnore    MappingType = "ignore"
+)
+
+// Mapping is how the values in a column are imported, e.g. {"type": "scheme", "scheme": "tel"}
+type Mapping struct {
+	Type   MappingType      `json:"type"`
+	Name   string           `json:"name,omitempty"`   // attribute: uuid, name, language or status
+	Scheme string           `json:"scheme,omitempty"` // URN scheme
+	Key    string           `json:"key,omitempty"`    // field key
+	Group  assets.GroupUUID `json:"group,omitempty"`  // group UUID
+}
+
+// Column is a column in an import file and its mapping, as saved on the import
+type Column struct {
+	Header  string   `json:"header"`
+	Mapping *Mapping `json:"mapping"`
+}
+
+var importAttributes = []string{"uuid", "name", "language", "status"}
+
+var importStatuses = map[string]core.ContactStatus{
+	"active":   core.ContactStatusActive,
+	"blocked":  core.ContactStatusBlocked,
+	"stopped":  core.ContactStatusStopped,
+	"archived": core.ContactStatusArchived,
+}
+
+// FileError is a problem with the content of an import file, as opposed to an error reading it
+type FileError struct {
+	err error
+}
+
+func (e *FileError) Error() string { return e.err.Error() }
+func (e *FileError) Unwrap() error { return e.err }
+
+// ParseFile fetches a CSV or XLSX import file from S3 and parses its rows into contact specs using the given mappings,
+// or if those are nil, mappings derived from its header row. Returns the columns of the file with their mappings, and
+// the specs and errors of its rows. Problems with the file itself are returned as a *FileError.
+func ParseFile(ctx context.Context, rt *runtime.Runtime, oa *models.OrgAssets, path, filename string, mappings []*Mapping) ([]*Column, []*models.ContactSpec, []models.ImportError, error) {
+	format, err := sheets.FormatFromFilename(filename)
+	if err != nil {
+		return nil, nil, nil, &FileError{err}
+	}
+
+	data, err := fetchFile(ctx, rt, path)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	rows, err := sheets.ReadRows(format, data)
+	if err != nil {
+		return nil, nil, nil, &FileError{err}
+	}
+	if len(rows) == 0 {
+		return nil, nil, nil, &FileError{errors.New("import file has no header row")}
+	}
+
+	header, rows := rows[0], rows[1:]
+
+	if mappings == nil {
+		mappings = AutoMapColumns(oa, header)
+	}
+	if err := ValidateMappings(oa, header, mappings); err != nil {
+		return nil, nil, nil, &FileError{err}
+	}
+
+	columns := make([]*Column, len(header))
+	for i := range header {
+		columns[i] = &Column{Header: header[i], Mapping: mappings[i]}
+	}
+
+	specs, errs := ParseRows(oa, rows, mappings)
+
+	return columns, specs, errs, nil
+}
+
+// fetches an import file from S3, refusing to load one larger than the maximum size into memory
+func fetchFile(ctx context.Context, rt *runtime.Runtime, path string) ([]byte, error) {
+	tooLarge := &FileError{fmt.Errorf("import file is larger than the maximum of %d MB", sheets.MaxFileSize>>20)}
+
+	obj, err := rt.S3.Client.GetObject(ctx, &s3.GetObjectInput{Bucket: aws.String(rt.Config.S3ExportsBucket), Key: aws.String(path)})
+	if err != nil {
+		return nil, fmt.Errorf("error fetching import file: %w", err)
+	}
+	defer obj.Body.Close()
+
+	if aws.ToInt64(obj.ContentLength) > sheets.MaxFileSize {
+		return nil, tooLarge
+	}
+
+	data, err := io.ReadAll(io.LimitReader(obj.Body, sheets.MaxFileSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("error fetching import file: %w", err)
+	}
+	if len(data) > sheets.MaxFileSize {
+		return nil, tooLarge
+	}
+	return data, nil
+}
+
+// AutoMapColumns creates mappings for the given header row using the same headers as contact exports, e.g. "Name",
+// "URN:tel", "Field:age" and "Group:Testers". Unrecognized headers are ignored.
+func AutoMapColumns(oa *models.OrgAssets, header []string) []*Mapping {
+	mappings := make([]*Mapping, len(header))
+
+	for i, h := range header {
+		h = strings.TrimSpace(h)
+		prefix, name, hasPrefix := strings.Cut(h, ":")
+		prefix = strings.ToLower(prefix)
+
+		mappings[i] = &Mapping{Type: MappingTypeIgnore}
+
+		if !hasPrefix {
+			switch attr := strings.ToLower(h); attr {
+			case "contact uuid", "uuid":
+				mappings[i] = &Mapping{Type: MappingTypeAttribute, Name: "uuid"}
+			case "name", "language", "status":
+				mappings[i] = &Mapping{Type: MappingTypeAttribute, Name: attr}
+			}
+			continue
+		}
+
+		name = strings.TrimSpace(name)
+
+		switch prefix {
+		case "urn":
+			if scheme := strings.ToLower(name); urns.IsValidScheme(scheme) {
+				mappings[i] = &Mapping{Type: MappingTypeScheme, Scheme: scheme}
+			}
+		case "field":
+			if f := fieldByKeyOrName(oa, name); f != nil {
+				mappings[i] = &Mapping{Type: MappingTypeField, Key: f.Key()}
+			}
+		case "group":
+			if g := groupByName(oa, name); g != nil {
+				mappings[i] = &Mapping{Type: MappingTypeGroup, Group: g.UUID()}
+			}
+		}
+	}
+
+	return mappings
+}
+
+// ValidateMappings checks that the given mappings can be used to import from a file with the given header row
+func ValidateMappings(oa *models.OrgAssets, header []string, mappings []*Mapping) error {
+	if len(mappings) != len(header) {
+		return fmt.Errorf("expected %d column mappings, got %d", len(header), len(mappings))
+	}
+
+	identifiable := false
+
+	for i, m := range mappings {
+		switch m.Type {
+		case MappingTypeAttribute:
+			if !slices.Contains(importAttributes, m.Name) {
+				return fmt.Errorf("column '%s' is mapped to invalid attribute '%s'", header[i], m.Name)
+			}
+			if m.Name == "uuid" {
+				identifiable = true
+			}
+		case MappingTypeScheme:
+			if !urns.IsValidScheme(m.Scheme) {
+				return fmt.Errorf("column '%s' is mapped to invalid URN scheme '%s'", header[i], m.Scheme)
+			}
+			identifiable = true
+		case MappingTypeField:
+			if oa.FieldByKey(m.Key) == nil {
+				return fmt.Errorf("column '%s' is mapped to invalid field '%s'", header[i], m.Key)
+			}
+		case MappingTypeGroup:
+			if g := oa.GroupByUUID(m.Group); g == nil || g.Query() != "" {
+				return fmt.Errorf("column '%s' is mapped to invalid group '%s'", header[i], m.Group)
+			}
+		case MappingTypeIgnore:
+		default:
+			return fmt.Errorf("column '%s' has invalid mapping type '%s'", header[i], m.Type)
+		}
+	}
+
+	if !identifiable {
+		return errors.New("import must have a UUID or URN column")
+	}
+	return nil
+}
+
+// ParseRows converts the data rows of an import file into contact specs using the given column mappings, which should
+// already be validated. Rows with invalid values are skipped and reported as errors, with rows numbered as they appear
+// in the file, i.e. the first data row is row 2.
+func ParseRows(oa *models.OrgAssets, rows [][]string, mappings []*Mapping) ([]*models.ContactSpec, []models.ImportError) {
+	specs := make([]*models.ContactSpec, 0, len(rows))
+	errs := make([]models.ImportError, 0, 10)
+	urnRows := make(map[urns.URN]int, len(rows))
+	country := oa.Env().DefaultCountry()
+
+	for i, row := range rows {
+		rowNum := i + 2
+		spec := &models.ContactSpec{ImportRow: rowNum}
+		var rowErrs []string
+		var rowURNs []urns.URN
+		empty := true
+
+		for col, m := range mappings {
+			if col >= len(row) {
+				break
+			}
+			value := strings.TrimSpace(row[col])
+			if value == "" {
+				continue
+			}
+			empty = false
+
+			switch m.Type {
+			case MappingTypeAttribute:
+				switch m.Name {
+				case "uuid":
+					if !uuids.Is(strings.ToLower(value)) {
+						rowErrs = append(rowErrs, fmt.Sprintf("'%s' is not a valid UUID", value))
+					} else {
+						spec.UUID = core.ContactUUID(strings.ToLower(value))
+					}
+				case "name":
+					spec.Name = &value
+				case "language":
+					if _, err := i18n.ParseLanguage(value); err != nil {
+						rowErrs = append(rowErrs, fmt.Sprintf("'%s' is not a valid language code", value))
+					} else {
+						spec.Language = &value
+					}
+				case "status":
+					if status, ok := importStatuses[strings.ToLower(value)]; ok {
+						spec.Status = status
+					} else {
+						rowErrs = append(rowErrs, fmt.Sprintf("'%s' is not a valid status", value))
+					}
+				}
+			case MappingTypeScheme:
+				urn, err := parseURN(m.Scheme, value, country)
+				if err != nil {
+					rowErrs = append(rowErrs, fmt.Sprintf("'%s' is not a valid %s URN", value, m.Scheme))
+				} else if prevRow, seen := urnRows[urn.Identity()]; seen {
+					rowErrs = append(rowErrs, fmt.Sprintf("URN %s is repeated from row %d", urn.Identity(), prevRow))
+				} else {
+					rowURNs = append(rowURNs, urn)
+				}
+			case MappingTypeField:
+				if spec.Fields == nil {
+					spec.Fields = make(map[string]string)
+				}
+				spec.Fields[m.Key] = value
+			case MappingTypeGroup:
+				if isTruthy(value) {
+					spec.Groups = append(spec.Groups, m.Group)
+				}
+			}
+		}
+
+		if empty {
+			continue
+		}
+
+		if len(rowErrs) > 0 {
+			for _, e := range rowErrs {
+				errs = append(errs, models.ImportError{Record: i, Row: rowNum, Message: e})
+			}
+			continue
+		}
+
+		for _, u := range rowURNs {
+			urnRows[u.Identity()] = rowNum
+		}
+		spec.URNs = rowURNs
+		specs = append(specs, spec)
+	}
+
+	return specs, errs
+}
+
+// parseURN parses a URN value from an import, allowing phone numbers in local format for the org's country
+func parseURN(scheme, value string, country i18n.Country) (urns.URN, error) {
+	if scheme == urns.Phone.Prefix {
+		return urns.ParsePhone(value, country, true, false)
+	}
+
+	urn, err := urns.NewFromParts(scheme, value, nil, "")
+	if err != nil {
+		return urns.NilURN, err
+	}
+
+	urn = urn.Normalize()
+	if err := urn.Validate(); err != nil {
+		return urns.NilURN, err
+	}
+	return urn, nil
+}
+
+func isTruthy(value string) bool {
+	switch strings.ToLower(value) {
+	case "true", "yes", "y", "1", "x":
+		return true
+	}
+	return false
+}
+
+func fieldByKeyOrName(oa *models.OrgAssets, keyOrName string) *models.Field {
+	if f := oa.FieldByKey(strings.ToLower(keyOrName)); f != nil {
+		return f
+	}
+
+	fields, _ := oa.Fields()
+	for _, f := range fields {
+		if strings.EqualFold(f.Name(), keyOrName) {
+			return f.(*models.Field)
+		}
+	}
+	return nil
+}
+
+func groupByName(oa *models.OrgAssets, name string) *models.Group {
+	groups, _ := oa.Groups()
+	for _, g := range groups {
+		if strings.EqualFold(g.Name(), name) && g.Query() == "" {
+			return g.(*models.Group)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,100 @@
+package imports_test
+
+import (
+	"testing"
+
+	"github.com/nyaruka/gocommon/urns"
+	"github.com/nyaruka/goflow/assets"
+	"github.com/nyaruka/goflow/core"
+	"github.com/nyaruka/mailroom/v26/core/imports"
+	"github.com/nyaruka/mailroom/v26/core/models"
+	"github.com/nyaruka/mailroom/v26/testsuite"
+	"github.com/nyaruka/mailroom/v26/testsuite/testdb"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAutoMapColumns(t *testing.T) {
+	_, rt := testsuite.Runtime(t)
+
+	oa := testdb.Org1.Load(t, rt)
+
+	mappings := imports.AutoMapColumns(oa, []string{"Contact UUID", "Name", "language", "URN:Tel", "URN:xyz", "Field:Gender", "Field:age", "Field:Unknown", "Group:testers", "Notes"})
+	assert.Equal(t, []*imports.Mapping{
+		{Type: imports.MappingTypeAttribute, Name: "uuid"},
+		{Type: imports.MappingTypeAttribute, Name: "name"},
+		{Type: imports.MappingTypeAttribute, Name: "language"},
+		{Type: imports.MappingTypeScheme, Scheme: "tel"},
+		{Type: imports.MappingTypeIgnore},
+		{Type: imports.MappingTypeField, Key: "gender"},
+		{Type: imports.MappingTypeField, Key: "age"},
+		{Type: imports.MappingTypeIgnore},
+		{Type: imports.MappingTypeGroup, Group: testdb.TestersGroup.UUID},
+		{Type: imports.MappingTypeIgnore},
+	}, mappings)
+
+	assert.NoError(t, imports.ValidateMappings(oa, []string{"Name", "Phone"}, []*imports.Mapping{{Type: imports.MappingTypeAttribute, Name: "name"}, {Type: imports.MappingTypeScheme, Scheme: "tel"}}))
+	assert.EqualError(t, imports.ValidateMappings(oa, []string{"Name", "Phone"}, []*imports.Mapping{{Type: imports.MappingTypeAttribute, Name: "name"}}), "expected 2 column mappings, got 1")
+	assert.EqualError(t, imports.ValidateMappings(oa, []string{"Name"}, []*imports.Mapping{{Type: imports.MappingTypeAttribute, Name: "name"}}), "import must have a UUID or URN column")
+	assert.EqualError(t, imports.ValidateMappings(oa, []string{"Phone"}, []*imports.Mapping{{Type: imports.MappingTypeScheme, Scheme: "xyz"}}), "column 'Phone' is mapped to invalid URN scheme 'xyz'")
+	assert.EqualError(t, imports.ValidateMappings(oa, []string{"UUID", "Foo"}, []*imports.Mapping{{Type: imports.MappingTypeAttribute, Name: "uuid"}, {Type: imports.MappingTypeField, Key: "foo"}}), "column 'Foo' is mapped to invalid field 'foo'")
+	assert.EqualError(t, imports.ValidateMappings(oa, []string{"UUID", "Foo"}, []*imports.Mapping{{Type: imports.MappingTypeAttribute, Name: "uuid"}, {Type: imports.MappingTypeAttribute, Name: "foo"}}), "column 'Foo' is mapped to invalid attribute 'foo'")
+	assert.EqualError(t, imports.ValidateMappings(oa, []string{"UUID", "Foo"}, []*imports.Mapping{{Type: imports.MappingTypeAttribute, Name: "uuid"}, {Type: "xxx"}}), "column 'Foo' has invalid mapping type 'xxx'")
+}
+
+func TestParseRows(t *testing.T) {
+	_, rt := testsuite.Runtime(t)
+
+	oa := testdb.Org1.Load(t, rt)
+
+	mappings := []*imports.Mapping{
+		{Type: imports.MappingTypeAttribute, Name: "uuid"},
+		{Type: imports.MappingTypeAttribute, Name: "name"},
+		{Type: imports.MappingTypeAttribute, Name: "language"},
+		{Type: imports.MappingTypeAttribute, Name: "status"},
+		{Type: imports.MappingTypeScheme, Scheme: "tel"},
+		{Type: imports.MappingTypeScheme, Scheme: "mailto"},
+		{Type: imports.MappingTypeField, Key: "gender"},
+		{Type: imports.MappingTypeGroup, Group: testdb.TestersGroup.UUID},
+		{Type: imports.MappingTypeIgnore},
+	}
+
+	specs, errs := imports.ParseRows(oa, [][]string{
+		{"", "Ann", "eng", "", "+16055741111", "ann@example.com", "F", "yes", "blah"},
+		{"A393ABC0-283D-4C9B-A1B3-641A035C34BF", " Bob ", "", "Blocked", "", "", "", "no"},
+		{},
+		{"", "Cat", "xx1", "", "+16055741111", "", "", ""},
+		{"", "Dan", "", "Gone", "call me", "not an email"},
+		{"", "", "", "", "+16055749999"},
+	}, mappings)
+
+	ann, bob := "Ann", "Bob"
+	eng := "eng"
+	assert.Equal(t, []*models.ContactSpec{
+		{
+			Name:      &ann,
+			Language:  &eng,
+			URNs:      []urns.URN{"tel:+16055741111", "mailto:ann@example.com"},
+			Fields:    map[string]string{"gender": "F"},
+			Groups:    []assets.GroupUUID{testdb.TestersGroup.UUID},
+			ImportRow: 2,
+		},
+		{
+			UUID:      "a393abc0-283d-4c9b-a1b3-641a035c34bf",
+			Name:      &bob,
+			Status:    core.ContactStatusBlocked,
+			ImportRow: 3,
+		},
+		{
+			URNs:      []urns.URN{"tel:+16055749999"},
+			ImportRow: 7,
+		},
+	}, specs)
+
+	assert.Equal(t, []models.ImportError{
+		{Record: 3, Row: 5, Message: "'xx1' is not a valid language code"},
+		{Record: 3, Row: 5, Message: "URN tel:+16055741111 is repeated from row 2"},
+		{Record: 4, Row: 6, Message: "'Gone' is not a valid status"},
+		{Record: 4, Row: 6, Message: "'call me' is not a valid tel URN"},
+		{Record: 4, Row: 6, Message: "'not an email' is not a valid mailto URN"},
+	}, errs)
+}
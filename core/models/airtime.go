@@ -5,14 +5,17 @@ import (
 	"database/sql"
 	"database/sql/driver"
 	"errors"
+	"fmt"
 	"time"
 
+	"github.com/lib/pq"
 	"github.com/nyaruka/gocommon/dates"
 	"github.com/nyaruka/gocommon/urns"
 	"github.com/nyaruka/goflow/core"
 	"github.com/nyaruka/goflow/core/events"
 	"github.com/nyaruka/null/v3"
 	"github.com/shopspring/decimal"
+	"github.com/vinovest/sqlx"
 )
 
 // AirtimeTransferID is the type for airtime transfer IDs
@@ -71,6 +74,25 @@ var airtimeTransferStatusNames = map[AirtimeTransferStatus]string{
 	AirtimeTransferStatusDeclined:  "declined",
 }
 
+// airtimeTransferNonFinal are the statuses which a transfer can be in whilst still waiting on the provider
+var airtimeTransferNonFinal = []AirtimeTransferStatus{AirtimeTransferStatusCreated, AirtimeTransferStatusConfirmed, AirtimeTransferStatusSubmitted}
+
+// AirtimeTransferStatusFromName returns the status with the given name as written to the history table
+func AirtimeTransferStatusFromName(name string) (AirtimeTransferStatus, bool) {
+	for s, n := range airtimeTransferStatusNames {
+		if n == name {
+			return s, true
+		}
+	}
+	return "", false
+}
+
+// AirtimeStatusChecker is implemented by airtime services which can be asked for the current status of a transfer
+// by its provider transaction id. The status is returned using the same names as are written to the history table.
+type AirtimeStatusChecker interface {
+	CheckStatus(ctx context.Context, externalID string, logHTTP core.HTTPLogCallback) (string, error)
+}
+
 // AirtimeTransfer is our type for an airtime transfer
 type AirtimeTransfer struct {
 	t struct {
@@ -88,7 +110,8 @@ type AirtimeTransfer struct {
 		CreatedOn     time.Time             `db:"created_on"`
 	}
 
-	Logs []*HTTPLog
+	Logs         []*HTTPLog
+	cancelReason string
 }
 
 // NewAirtimeTransfer creates a new airtime transfer in the pending state, with the provider's transaction id
@@ -117,6 +140,10 @@ func (t *AirtimeTransfer) UUID() events.EventUUID {
 	return t.t.UUID
 }
 
+func (t *AirtimeTransfer) OrgID() OrgID {
+	return t.t.OrgID
+}
+
 func (t *AirtimeTransfer) ExternalID() string {
 	return string(t.t.ExternalID)
 }
@@ -125,6 +152,29 @@ func (t *AirtimeTransfer) Status() AirtimeTransferStatus {
 	return t.t.Status
 }
 
+func (t *AirtimeTransfer) Recipient() urns.URN {
+	return t.t.Recipient
+}
+
+func (t *AirtimeTransfer) Currency() string {
+	return string(t.t.Currency)
+}
+
+func (t *AirtimeTransfer) Amount() decimal.Decimal {
+	return t.t.ActualAmount
+}
+
+// Cancel marks this transfer as cancelled for the given reason before it's inserted, for when it won't be confirmed
+func (t *AirtimeTransfer) Cancel(reason string) {
+	t.t.Status = AirtimeTransferStatusCancelled
+	t.cancelReason = reason
+}
+
+// CancelReason returns the reason this transfer was cancelled, if it was cancelled before being inserted
+func (t *AirtimeTransfer) CancelReason() string {
+	return t.cancelReason
+}
+
 func (t *AirtimeTransfer) AddLog(l *HTTPLog) {
 	t.Logs = append(t.Logs, l)
 }
@@ -149,6 +199,47 @@ func InsertAirtimeTransfers(ctx context.Context, db DBorTx, transfers []*Airtime
 	return BulkQuery(ctx, "inserted airtime transfers", db, sqlInsertAirtimeTransfers, ts)
 }
 
+const sqlSelectAirtimeTransfersToReconcile = `
+  SELECT id, uuid, org_id, status, external_id, contact_id, sender, recipient, currency, desired_amount, actual_amount, created_on
+    FROM airtime_airtimetransfer
+   WHERE status = ANY($1) AND external_id IS NOT NULL AND created_on > $2 AND created_on < $3 AND id > $4
+ORDER BY id
+   LIMIT $5`
+
+// LoadAirtimeTransfersToReconcile loads up to limit transfers after the given id which were created in the given window
+// but are still in a non-final status, i.e. we've yet to hear from the provider about whether they were delivered.
+func LoadAirtimeTransfersToReconcile(ctx context.Context, db *sqlx.DB, createdAfter, createdBefore time.Time, afterID AirtimeTransferID, limit int) ([]*AirtimeTransfer, error) {
+	rows, err := db.QueryxContext(ctx, sqlSelectAirtimeTransfersToReconcile, pq.Array(airtimeTransferNonFinal), createdAfter, createdBefore, afterID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("error selecting airtime transfers to reconcile: %w", err)
+	}
+	defer rows.Close()
+
+	transfers := make([]*AirtimeTransfer, 0, 10)
+	for rows.Next() {
+		t := &AirtimeTransfer{}
+		if err := rows.StructScan(&t.t); err != nil {
+			return nil, fmt.Errorf("error scanning airtime transfer: %w", err)
+		}
+		transfers = append(transfers, t)
+	}
+
+	return transfers, rows.Err()
+}
+
+const sqlUpdateAirtimeTransferExternalID = `UPDATE airtime_airtimetransfer SET external_id = $2 WHERE id = $1`
+
+// UpdateAirtimeTransferExternalID updates the provider transaction id of the given transfer, for providers which only
+// assign one when the transfer is confirmed
+func UpdateAirtimeTransferExternalID(ctx context.Context, db DBorTx, transfer *AirtimeTransfer, externalID string) error {
+	if _, err := db.ExecContext(ctx, sqlUpdateAirtimeTransferExternalID, transfer.t.ID, externalID); err != nil {
+		return fmt.Errorf("error updating airtime transfer external id: %w", err)
+	}
+
+	transfer.t.ExternalID = null.String(externalID)
+	return nil
+}
+
 const sqlUpdateAirtimeTransferStatus = `
    UPDATE airtime_airtimetransfer t SET status = $2
      FROM contacts_contact c
@@ -193,6 +284,14 @@ func NewAirtimeStatusTag(orgID OrgID, contactUUID core.ContactUUID, transferUUID
 	}
 }
 
+// NewAirtimeCancelledTag creates the history-table event tag that records a transfer being cancelled by us before it was
+// confirmed with the provider, along with the reason
+func NewAirtimeCancelledTag(orgID OrgID, contactUUID core.ContactUUID, transferUUID events.EventUUID, reason string) *EventTag {
+	tag := NewAirtimeStatusTag(orgID, contactUUID, transferUUID, AirtimeTransferStatusCancelled)
+	tag.Data["reason"] = reason
+	return tag
+}
+
 func (i *AirtimeTransferID) Scan(value any) error         { return null.ScanInt(value, i) }
 func (i AirtimeTransferID) Value() (driver.Value, error)  { return null.IntValue(i) }
 func (i *AirtimeTransferID) UnmarshalJSON(b []byte) error { return null.UnmarshalInt(b, i) }
@@ -0,0 +1,370 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	valkey "github.com/gomodule/redigo/redis"
+	"github.com/nyaruka/gocommon/dates"
+	"github.com/nyaruka/gocommon/jsonx"
+	"github.com/nyaruka/gocommon/urns"
+	"github.com/nyaruka/goflow/assets"
+	"github.com/nyaruka/goflow/core"
+	"github.com/nyaruka/goflow/core/events"
+	"github.com/nyaruka/goflow/flows"
+	"github.com/nyaruka/mailroom/v26/runtime"
+	"github.com/shopspring/decimal"
+)
+
+const configAirtimeLimits = "airtime_limits"
+
+// how long we keep daily usage counters around for - long enough to outlast the day in any timezone
+const airtimeUsageExpiry = time.Hour * 48
+
+// AirtimeLimits are the daily limits an org can put on the airtime its flows send, configured as airtime_limits in the
+// org config, e.g. {"daily_amounts": {"USD": 100}, "daily_per_contact": 2, "flows": {"<flow-uuid>": {...}}}. Days
+// are in the org's timezone.
+type AirtimeLimits struct {
+	DailyAmounts    map[string]decimal.Decimal         `json:"daily_amounts,omitempty"`
+	DailyPerContact int                                `json:"daily_per_contact,omitempty"`
+	Flows           map[assets.FlowUUID]*AirtimeLimits `json:"flows,omitempty"`
+}
+
+// AirtimeLimitError is the error returned when a transfer would exceed an airtime limit
+type AirtimeLimitError struct {
+	msg string
+}
+
+func (e *AirtimeLimitError) Error() string { return e.msg }
+
+// AirtimeLimits returns the airtime limits configured for this org, or nil if there are none
+func (o *Org) AirtimeLimits() *AirtimeLimits {
+	raw, ok := o.o.Config[configAirtimeLimits]
+	if !ok || raw == nil {
+		return nil
+	}
+
+	limits := &AirtimeLimits{}
+	if err := jsonx.Unmarshal(jsonx.MustMarshal(raw), limits); err != nil {
+		slog.Error("invalid airtime limits in org config", "org_id", o.ID(), "error", err)
+		return nil
+	}
+	return limits
+}
+
+// airtimeFlowKey is the context key for the flow which airtime transfers are being created for
+type airtimeFlowKey struct{}
+
+// WithAirtimeFlow returns a copy of the given context which tells the org's airtime service that any transfers it
+// creates are for the given flow, so that the flow's own limits can be enforced before they're created.
+func WithAirtimeFlow(ctx context.Context, flowUUID assets.FlowUUID) context.Context {
+	return context.WithValue(ctx, airtimeFlowKey{}, flowUUID)
+}
+
+// AirtimeFlowFromContext returns the flow set on the given context by WithAirtimeFlow, if any
+func AirtimeFlowFromContext(ctx context.Context) assets.FlowUUID {
+	flowUUID, _ := ctx.Value(airtimeFlowKey{}).(assets.FlowUUID)
+	return flowUUID
+}
+
+// airtimeLimitScope is a set of limits along with the usage they apply to, which is either the org as a whole or a
+// single flow
+type airtimeLimitScope struct {
+	limits *AirtimeLimits
+	scope  string // empty for the org as a whole or a flow UUID
+	what   string
+}
+
+// returns the scopes whose limits apply to transfers created for the given flow
+func (l *AirtimeLimits) scopes(flowUUID assets.FlowUUID) []*airtimeLimitScope {
+	scopes := []*airtimeLimitScope{{limits: l, scope: "", what: "workspace"}}
+	if flowLimits := l.Flows[flowUUID]; flowUUID != "" && flowLimits != nil {
+		scopes = append(scopes, &airtimeLimitScope{limits: flowLimits, scope: string(flowUUID), what: "flow"})
+	}
+	return scopes
+}
+
+// returns the error for when this scope's per contact limit or amount limits for the given currencies are reached
+func (s *airtimeLimitScope) limitError(perContact bool, currencies []string) error {
+	if perContact {
+		return &AirtimeLimitError{fmt.Sprintf("daily limit of %d airtime transfers per contact reached for this %s", s.limits.DailyPerContact, s.what)}
+	}
+
+	exceeded := make([]string, 0, len(currencies))
+	for _, c := range currencies {
+		if limit, hasLimit := s.limits.DailyAmounts[c]; hasLimit {
+			exceeded = append(exceeded, fmt.Sprintf("%s %s", limit, c))
+		}
+	}
+	slices.Sort(exceeded)
+
+	return &AirtimeLimitError{fmt.Sprintf("daily airtime limit of %s reached for this %s", strings.Join(exceeded, ", "), s.what)}
+}
+
+// key for the hash of today's usage within the given scope, which is empty for the org as a whole or a flow UUID
+func airtimeUsageKey(oa *OrgAssets, scope string) string {
+	day := dates.Now().In(oa.Env().Timezone()).Format("2006-01-02")
+	if scope == "" {
+		return fmt.Sprintf("airtime_usage:%d:%s", oa.OrgID(), day)
+	}
+	return fmt.Sprintf("airtime_usage:%d:%s:%s", oa.OrgID(), scope, day)
+}
+
+// checks the usage in each scope against its limits and if there is still at least one of the given amounts which can
+// be sent, reserves it in every scope. Amounts are reserved for all currencies still allowed because we don't know yet
+// which the provider will use.
+//
+//	KEYS: usage key of each scope
+//	ARGV: expiry, count field, number of currencies, currencies..., amounts..., then for each scope its per contact
+//	      limit (0 for none) followed by its limit for each currency ("" for none)
+//
+// Returns {"ok", allowed currencies...} or {"contact"|"amount", index of the scope whose limit was reached}.
+var airtimeReserveScript = valkey.NewScript(-1, `
+local expiry, count_field, num_currencies = tonumber(ARGV[1]), ARGV[2], tonumber(ARGV[3])
+local currencies, amounts, allowed = {}, {}, {}
+for j = 1, num_currencies do
+	currencies[j] = ARGV[3 + j]
+	amounts[j] = ARGV[3 + num_currencies + j]
+	allowed[j] = true
+end
+
+local pos = 4 + 2 * num_currencies
+for i = 1, #KEYS do
+	local per_contact = tonumber(ARGV[pos])
+	pos = pos + 1
+
+	if per_contact > 0 and tonumber(redis.call("HGET", KEYS[i], count_field) or "0") >= per_contact then
+		return {"contact", tostring(i)}
+	end
+
+	local num_allowed = 0
+	for j = 1, num_currencies do
+		local limit = ARGV[pos + j - 1]
+		if limit ~= "" then
+			local used = tonumber(redis.call("HGET", KEYS[i], "amount:" .. currencies[j]) or "0")
+			if used + tonumber(amounts[j]) > tonumber(limit) then
+				allowed[j] = false
+			end
+		end
+		if allowed[j] then
+			num_allowed = num_allowed + 1
+		end
+	end
+	pos = pos + num_currencies
+
+	if num_currencies > 0 and num_allowed == 0 then
+		return {"amount", tostring(i)}
+	end
+end
+
+local result = {"ok"}
+for j = 1, num_currencies do
+	if allowed[j] then
+		table.insert(result, currencies[j])
+	end
+end
+
+for i = 1, #KEYS do
+	redis.call("HINCRBY", KEYS[i], count_field, 1)
+	for j = 1, num_currencies do
+		if allowed[j] then
+			redis.call("HINCRBYFLOAT", KEYS[i], "amount:" .. currencies[j], amounts[j])
+		end
+	end
+	redis.call("EXPIRE", KEYS[i], expiry)
+end
+
+return result
+`)
+
+// airtimeReservation is a transfer to a recipient which has been counted against the usage of one or more scopes
+// before it has been created
+type airtimeReservation struct {
+	keys       []string
+	countField string
+	amounts    map[string]decimal.Decimal
+}
+
+// reserveAirtime atomically checks a transfer of one of the given amounts against the limits of each of the given
+// scopes and if none of them have been reached, reserves it against all of them. If a limit has been reached, an
+// incident is started for its scope and an AirtimeLimitError is returned.
+func reserveAirtime(ctx context.Context, rt *runtime.Runtime, oa *OrgAssets, scopes []*airtimeLimitScope, amounts map[string]decimal.Decimal, recipient urns.URN) (*airtimeReservation, error) {
+	currencies := slices.Sorted(maps.Keys(amounts))
+	countField := "count:" + recipient.Identity()
+
+	keys := make([]string, len(scopes))
+	args := valkey.Args{}.Add(len(scopes))
+	for i, s := range scopes {
+		keys[i] = airtimeUsageKey(oa, s.scope)
+		args = args.Add(keys[i])
+	}
+
+	args = args.Add(int(airtimeUsageExpiry/time.Second), countField, len(currencies))
+	for _, c := range currencies {
+		args = args.Add(c)
+	}
+	for _, c := range currencies {
+		args = args.Add(amounts[c].String())
+	}
+	for _, s := range scopes {
+		args = args.Add(s.limits.DailyPerContact)
+		for _, c := range currencies {
+			if limit, hasLimit := s.limits.DailyAmounts[c]; hasLimit {
+				args = args.Add(limit.String())
+			} else {
+				args = args.Add("")
+			}
+		}
+	}
+
+	vc := rt.VK.Get()
+	defer vc.Close()
+
+	result, err := valkey.Strings(airtimeReserveScript.DoContext(ctx, vc, args...))
+	if err != nil {
+		return nil, fmt.Errorf("error reserving airtime usage: %w", err)
+	}
+
+	if result[0] != "ok" {
+		i, _ := strconv.Atoi(result[1])
+		scope := scopes[i-1]
+
+		airtimeLimitReached(ctx, rt, oa, scope.scope)
+
+		return nil, scope.limitError(result[0] == "contact", currencies)
+	}
+
+	reserved := make(map[string]decimal.Decimal, len(result)-1)
+	for _, c := range result[1:] {
+		reserved[c] = amounts[c]
+	}
+
+	return &airtimeReservation{keys: keys, countField: countField, amounts: reserved}, nil
+}
+
+// settle replaces the reserved amounts with the actual amount of the created transfer, or releases the reservation
+// entirely if the currency is empty because the transfer wasn't created.
+func (r *airtimeReservation) settle(ctx context.Context, rt *runtime.Runtime, currency string, amount decimal.Decimal) error {
+	deltas := make(map[string]decimal.Decimal, len(r.amounts)+1)
+	for c, a := range r.amounts {
+		deltas[c] = a.Neg()
+	}
+	if currency != "" {
+		deltas[currency] = deltas[currency].Add(amount)
+	}
+
+	vc := rt.VK.Get()
+	defer vc.Close()
+
+	vc.Send("MULTI")
+	for _, key := range r.keys {
+		if currency == "" {
+			vc.Send("HINCRBY", key, r.countField, -1)
+		}
+		for c, d := range deltas {
+			if !d.IsZero() {
+				vc.Send("HINCRBYFLOAT", key, "amount:"+c, d.String())
+			}
+		}
+	}
+
+	if _, err := valkey.DoContext(vc, ctx, "EXEC"); err != nil {
+		return fmt.Errorf("error settling airtime usage: %w", err)
+	}
+	return nil
+}
+
+// airtimeLimitReached starts an incident for a tripped limit, notifying admins if it's new
+func airtimeLimitReached(ctx context.Context, rt *runtime.Runtime, oa *OrgAssets, scope string) {
+	_, notifications, err := IncidentAirtimeLimitReached(ctx, rt.DB, oa, scope)
+	if err != nil {
+		slog.Error("error creating airtime limit incident", "org_id", oa.OrgID(), "scope", scope, "error", err)
+		return
+	}
+	if err := PublishNotifications(ctx, rt, oa, notifications); err != nil {
+		slog.Error("error publishing airtime limit notifications", "org_id", oa.OrgID(), "error", err)
+	}
+}
+
+// limitedAirtimeService wraps an org's airtime service to enforce its limits before a transfer is created. Org-wide
+// limits always apply and the limits of the flow set on the context with WithAirtimeFlow apply if it has any. Usage is
+// reserved before the transfer is created and settled afterwards, so concurrent transfers can't exceed limits.
+type limitedAirtimeService struct {
+	flows.AirtimeService
+
+	rt     *runtime.Runtime
+	oa     *OrgAssets
+	limits *AirtimeLimits
+}
+
+func (s *limitedAirtimeService) Create(ctx context.Context, transferUUID events.EventUUID, sender urns.URN, recipient urns.URN, amounts map[string]decimal.Decimal, logHTTP core.HTTPLogCallback) (*core.AirtimeTransfer, error) {
+	failed := &core.AirtimeTransfer{Sender: sender, Recipient: recipient, Amount: decimal.Zero}
+
+	reservation, err := reserveAirtime(ctx, s.rt, s.oa, s.limits.scopes(AirtimeFlowFromContext(ctx)), amounts, recipient)
+	if err != nil {
+		return failed, err
+	}
+
+	transfer, err := s.AirtimeService.Create(ctx, transferUUID, sender, recipient, reservation.amounts, logHTTP)
+	if err != nil {
+		if err := reservation.settle(ctx, s.rt, "", decimal.Zero); err != nil {
+			slog.Error("error releasing airtime usage", "org_id", s.oa.OrgID(), "error", err)
+		}
+		return transfer, err
+	}
+
+	if err := reservation.settle(ctx, s.rt, transfer.Currency, transfer.Amount); err != nil {
+		slog.Error("error settling airtime usage", "org_id", s.oa.OrgID(), "error", err)
+	}
+
+	return transfer, nil
+}
+
+// CheckFlowAirtimeLimits checks a created transfer against any limits configured for the flow which created it and
+// records it against that flow's usage if it's within them. This is only needed for transfers created by a flow other
+// than the one the service was told about with WithAirtimeFlow, i.e. a subflow entered in the same sprint.
+func CheckFlowAirtimeLimits(ctx context.Context, rt *runtime.Runtime, oa *OrgAssets, flowUUID assets.FlowUUID, transfer *AirtimeTransfer) error {
+	limits := oa.Org().AirtimeLimits()
+	if limits == nil || limits.Flows[flowUUID] == nil {
+		return nil
+	}
+
+	scope := &airtimeLimitScope{limits: limits.Flows[flowUUID], scope: string(flowUUID), what: "flow"}
+
+	_, err := reserveAirtime(ctx, rt, oa, []*airtimeLimitScope{scope}, map[string]decimal.Decimal{string(transfer.t.Currency): transfer.t.ActualAmount}, transfer.t.Recipient)
+	return err
+}
+
+// ReleaseAirtimeUsage releases the usage recorded for a created transfer against the limits of the org and the flow set
+// on the context with WithAirtimeFlow, for when the transfer won't be confirmed.
+func ReleaseAirtimeUsage(ctx context.Context, rt *runtime.Runtime, oa *OrgAssets, transfer *AirtimeTransfer) error {
+	limits := oa.Org().AirtimeLimits()
+	if limits == nil {
+		return nil
+	}
+
+	scopes := limits.scopes(AirtimeFlowFromContext(ctx))
+	reservation := &airtimeReservation{
+		keys:       make([]string, len(scopes)),
+		countField: "count:" + transfer.t.Recipient.Identity(),
+		amounts:    map[string]decimal.Decimal{string(transfer.t.Currency): transfer.t.ActualAmount},
+	}
+	for i, s := range scopes {
+		reservation.keys[i] = airtimeUsageKey(oa, s.scope)
+	}
+
+	return reservation.settle(ctx, rt, "", decimal.Zero)
+}
+
+// IsAirtimeLimitError returns whether the given error is the result of an airtime limit being reached
+func IsAirtimeLimitError(err error) bool {
+	var limitErr *AirtimeLimitError
+	return errors.As(err, &limitErr)
+}
@@ -0,0 +1,138 @@
+package models_test
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"github.com/nyaruka/gocommon/dbutil/assertdb"
+	"github.com/nyaruka/gocommon/httpx"
+	"github.com/nyaruka/gocommon/urns"
+	"github.com/nyaruka/goflow/core"
+	"github.com/nyaruka/goflow/core/events"
+	"github.com/nyaruka/mailroom/v26/core/goflow"
+	"github.com/nyaruka/mailroom/v26/core/models"
+	"github.com/nyaruka/mailroom/v26/testsuite"
+	"github.com/nyaruka/mailroom/v26/testsuite/testdb"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAirtimeLimits(t *testing.T) {
+	ctx, rt := testsuite.Runtime(t)
+
+	tokenResponse := `{"access_token": "tok123", "scope": "send-topups", "expires_in": 86400, "token_type": "Bearer"}`
+	operatorResponse := `{"operatorId": 341, "name": "Airtel Rwanda", "denominationType": "RANGE", "supportsLocalAmounts": true, "destinationCurrencyCode": "RWF", "localMinAmount": 50, "localMaxAmount": 50000}`
+
+	rt.HTTP.Services.Transport, _ = testsuite.MockTransport(map[string][]*httpx.MockResponse{
+		"https://auth.reloadly.com/oauth/token":                                          slices.Repeat([]*httpx.MockResponse{httpx.NewMockResponse(200, nil, []byte(tokenResponse))}, 6),
+		"https://topups.reloadly.com/operators/auto-detect/phone/788123456/countries/RW": slices.Repeat([]*httpx.MockResponse{httpx.NewMockResponse(200, nil, []byte(operatorResponse))}, 2),
+		"https://topups.reloadly.com/operators/auto-detect/phone/788000001/countries/RW": {httpx.NewMockResponse(200, nil, []byte(operatorResponse))},
+		"https://topups.reloadly.com/operators/auto-detect/phone/788000002/countries/RW": {
+			httpx.NewMockResponse(404, nil, []byte(`{"errorCode": "COULD_NOT_AUTO_DETECT_OPERATOR", "message": "Could not auto detect operator"}`)),
+			httpx.NewMockResponse(200, nil, []byte(operatorResponse)),
+		},
+		"https://topups.reloadly.com/operators/auto-detect/phone/788000004/countries/RW": {httpx.NewMockResponse(200, nil, []byte(operatorResponse))},
+	})
+
+	rt.DB.MustExec(`UPDATE orgs_org SET config = '{"airtime_provider": "reloadly", "reloadly_client_id": "id123", "reloadly_client_secret": "sesame", "airtime_limits": {"daily_amounts": {"RWF": 1500}, "daily_per_contact": 2, "flows": {"9de3663f-c5c5-4c92-9f45-ecbc09abcc85": {"daily_amounts": {"RWF": 1000}}}}}' WHERE id = $1`, testdb.Org1.ID)
+
+	oa := testdb.Org1.Load(t, rt)
+
+	limits := oa.Org().AirtimeLimits()
+	require.NotNil(t, limits)
+	assert.Equal(t, 2, limits.DailyPerContact)
+	assert.Equal(t, "1500", limits.DailyAmounts["RWF"].String())
+	assert.Equal(t, "1000", limits.Flows[testdb.Favorites.UUID].DailyAmounts["RWF"].String())
+
+	transfer := func(ctx context.Context, recipient urns.URN, amount string) (*core.AirtimeTransfer, error) {
+		svc, err := goflow.Engine(rt).Services().Airtime(oa.SessionAssets())
+		require.NoError(t, err)
+
+		logger := &core.HTTPLogger{}
+		return svc.Create(ctx, events.NewEventUUID(), urns.NilURN, recipient, map[string]decimal.Decimal{"RWF": decimal.RequireFromString(amount)}, logger.Log)
+	}
+
+	// transfers for a flow with its own limits are checked against those as well as the org's
+	flowCtx := models.WithAirtimeFlow(ctx, testdb.Favorites.UUID)
+	assert.Equal(t, testdb.Favorites.UUID, models.AirtimeFlowFromContext(flowCtx))
+
+	tr, err := transfer(flowCtx, "tel:+250788123456", "600")
+	assert.NoError(t, err)
+	assert.Equal(t, "600", tr.Amount.String())
+
+	tr, err = transfer(flowCtx, "tel:+250788000001", "600")
+	assert.EqualError(t, err, "daily airtime limit of 1000 RWF reached for this flow")
+	assert.True(t, models.IsAirtimeLimitError(err))
+	assert.True(t, tr.Amount.IsZero())
+
+	// other flows only have the org's limits
+	tr, err = transfer(models.WithAirtimeFlow(ctx, testdb.IVRFlow.UUID), "tel:+250788000001", "600")
+	assert.NoError(t, err)
+	assert.Equal(t, "600", tr.Amount.String())
+
+	// another contact can't be sent more than the org's daily amount
+	tr, err = transfer(ctx, "tel:+250788000002", "600")
+	assert.EqualError(t, err, "daily airtime limit of 1500 RWF reached for this workspace")
+	assert.True(t, tr.Amount.IsZero())
+
+	// but can be sent what's left
+	tr, err = transfer(ctx, "tel:+250788123456", "100")
+	assert.NoError(t, err)
+	assert.Equal(t, "100", tr.Amount.String())
+
+	// first contact has now had their two transfers for today
+	_, err = transfer(ctx, "tel:+250788123456", "100")
+	assert.EqualError(t, err, "daily limit of 2 airtime transfers per contact reached for this workspace")
+
+	// a transfer which the provider fails doesn't count towards limits
+	_, err = transfer(ctx, "tel:+250788000002", "200")
+	assert.Error(t, err)
+	assert.False(t, models.IsAirtimeLimitError(err))
+
+	tr, err = transfer(ctx, "tel:+250788000002", "200")
+	assert.NoError(t, err)
+	assert.Equal(t, "200", tr.Amount.String())
+
+	// tripping limits started a single incident per scope and notified admins
+	assertdb.Query(t, rt.DB, `SELECT count(*) FROM notifications_incident WHERE org_id = $1 AND incident_type = 'airtime:limit' AND scope = ''`, testdb.Org1.ID).Returns(1)
+	assertdb.Query(t, rt.DB, `SELECT count(*) FROM notifications_incident WHERE org_id = $1 AND incident_type = 'airtime:limit' AND scope = $2`, testdb.Org1.ID, testdb.Favorites.UUID).Returns(1)
+
+	// transfers by a subflow can only be checked against its limits after they've been created
+	newTransfer := func(amount string) *models.AirtimeTransfer {
+		return models.NewAirtimeTransfer(testdb.Org1.ID, testdb.Ann.ID, events.NewAirtimeCreated(events.NewEventUUID(), &core.AirtimeTransfer{
+			ExternalID: "4602847",
+			Recipient:  urns.URN("tel:+250788000003"),
+			Currency:   "RWF",
+			Amount:     decimal.RequireFromString(amount),
+		}, nil))
+	}
+
+	err = models.CheckFlowAirtimeLimits(ctx, rt, oa, testdb.Favorites.UUID, newTransfer("400"))
+	assert.NoError(t, err)
+
+	err = models.CheckFlowAirtimeLimits(ctx, rt, oa, testdb.Favorites.UUID, newTransfer("100"))
+	assert.EqualError(t, err, "daily airtime limit of 1000 RWF reached for this flow")
+
+	err = models.CheckFlowAirtimeLimits(ctx, rt, oa, testdb.IVRFlow.UUID, newTransfer("600"))
+	assert.NoError(t, err)
+
+	// the org's daily amount has been reached
+	_, err = transfer(ctx, "tel:+250788000004", "200")
+	assert.EqualError(t, err, "daily airtime limit of 1500 RWF reached for this workspace")
+
+	// but releasing a transfer which won't be confirmed frees up what it was counted as
+	released := models.NewAirtimeTransfer(testdb.Org1.ID, testdb.Ann.ID, events.NewAirtimeCreated(events.NewEventUUID(), &core.AirtimeTransfer{
+		ExternalID: "reserved:341:01970fa4-1e58-79d5-bca8-1234567890ab",
+		Recipient:  urns.URN("tel:+250788000002"),
+		Currency:   "RWF",
+		Amount:     decimal.RequireFromString("200"),
+	}, nil))
+	err = models.ReleaseAirtimeUsage(ctx, rt, oa, released)
+	assert.NoError(t, err)
+
+	tr, err = transfer(ctx, "tel:+250788000004", "200")
+	assert.NoError(t, err)
+	assert.Equal(t, "200", tr.Amount.String())
+}
@@ -100,3 +100,11 @@ func TestNewAirtimeStatusTag(t *testing.T) {
 		assert.NotEmpty(t, tag.Data["status"], "status %q has no external name", status)
 	}
 }
+
+func TestNewAirtimeCancelledTag(t *testing.T) {
+	tag := models.NewAirtimeCancelledTag(testdb.Org1.ID, testdb.Ann.UUID, "0197b335-6ded-79a4-95a6-3af85b57f108", "daily airtime limit of 1000 RWF reached for this flow")
+	assert.Equal(t, events.EventUUID("0197b335-6ded-79a4-95a6-3af85b57f108"), tag.EventUUID)
+	assert.Equal(t, "sts", tag.Tag)
+	assert.Equal(t, "cancelled", tag.Data["status"])
+	assert.Equal(t, "daily airtime limit of 1000 RWF reached for this flow", tag.Data["reason"])
+}
@@ -423,6 +423,15 @@ func (a *OrgAssets) Campaigns() ([]assets.Campaign, error) {
 	return a.campaigns, nil
 }
 
+func (a *OrgAssets) CampaignByID(id CampaignID) *Campaign {
+	for _, c := range a.campaigns {
+		if c.(*Campaign).ID() == id {
+			return c.(*Campaign)
+		}
+	}
+	return nil
+}
+
 func (a *OrgAssets) CampaignByGroupID(groupID GroupID) []*Campaign {
 	return a.campaignsByGroup[groupID]
 }
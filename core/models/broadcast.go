@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"slices"
 
 	"github.com/lib/pq"
 	"github.com/nyaruka/gocommon/i18n"
@@ -54,6 +55,8 @@ type Broadcast struct {
 	CreatedByID       UserID                     `json:"created_by_id,omitempty"`
 	ScheduleID        ScheduleID                 `json:"schedule_id,omitempty"`
 	ParentID          BroadcastID                `json:"parent_id,omitempty"`
+	Variants          []*Variant                 `json:"variants,omitempty"`        // experiment variants aren't saved in the db, only carried by the task
+	OptimizeWithin    int                        `json:"optimize_within,omitempty"` // hours within which sends are deferred to contacts' active hours
 }
 
 type dbBroadcast struct {
@@ -138,12 +141,29 @@ type BroadcastBatch struct {
 	// subset of contact_ids that were created resolving the broadcast's URN recipients - they won't generate change
 	// events so need to be explicitly indexed
 	CreatedContactIDs []ContactID `json:"created_contact_ids,omitempty"`
+
+	// if the broadcast is an experiment, the variant that these contacts were assigned - deferred batches only carry
+	// the UUID of the variant and its content is loaded from the experiment
+	Variant     *Variant    `json:"variant,omitempty"`
+	VariantUUID VariantUUID `json:"variant_uuid,omitempty"`
+
+	// subset of contact_ids that have already been counted as capped by a frequency cap and deferred, so that they're
+	// only counted once if they're capped again
+	CappedContactIDs []ContactID `json:"capped_contact_ids,omitempty"`
+
+	// whether the broadcast optimizes send times, and whether these contacts had their sends deferred to their
+	// active hour or by a frequency cap - in which case the batch isn't part of the set of batches queued when the
+	// broadcast was sent
+	Optimized bool `json:"optimized,omitempty"`
+	Deferred  bool `json:"deferred,omitempty"`
 }
 
-func (b *Broadcast) CreateBatch(contactIDs, createdContactIDs []ContactID) *BroadcastBatch {
+func (b *Broadcast) CreateBatch(contactIDs, createdContactIDs []ContactID, variant *Variant) *BroadcastBatch {
 	bb := &BroadcastBatch{
 		ContactIDs:        contactIDs,
 		CreatedContactIDs: createdContactIDs,
+		Variant:           variant,
+		Optimized:         b.OptimizeWithin > 0,
 	}
 
 	if b.ID != NilBroadcastID {
@@ -155,6 +175,47 @@ func (b *Broadcast) CreateBatch(contactIDs, createdContactIDs []ContactID) *Broa
 	return bb
 }
 
+// CreateDeferredBatch creates a batch for the given contacts whose sends of the given persisted broadcast were deferred
+// to their active hour or by a frequency cap, with the variant they were assigned, whether they were created resolving
+// the broadcast's recipients and whether they've already been counted as capped
+func CreateDeferredBatch(bcastID BroadcastID, variantUUID VariantUUID, contactIDs []ContactID, created, capped bool) *BroadcastBatch {
+	bb := &BroadcastBatch{BroadcastID: bcastID, ContactIDs: contactIDs, VariantUUID: variantUUID, Deferred: true}
+	if created {
+		bb.CreatedContactIDs = contactIDs
+	}
+	if capped {
+		bb.CappedContactIDs = contactIDs
+	}
+	return bb
+}
+
+// ForContacts returns a copy of this batch for the given subset of its contacts
+func (b *BroadcastBatch) ForContacts(contactIDs []ContactID) *BroadcastBatch {
+	c := *b
+	c.ContactIDs = contactIDs
+	c.CreatedContactIDs = nil
+	c.CappedContactIDs = nil
+
+	for _, id := range b.CreatedContactIDs {
+		if slices.Contains(contactIDs, id) {
+			c.CreatedContactIDs = append(c.CreatedContactIDs, id)
+		}
+	}
+	for _, id := range b.CappedContactIDs {
+		if slices.Contains(contactIDs, id) {
+			c.CappedContactIDs = append(c.CappedContactIDs, id)
+		}
+	}
+	return &c
+}
+
+// ForVariant returns a copy of this broadcast which sends the translations of the given experiment variant
+func (b *Broadcast) ForVariant(v *Variant) *Broadcast {
+	c := *b
+	c.Translations = v.Translations
+	return &c
+}
+
 // SetStarted sets the status of this broadcast to QUEUED, if it's not already set to INTERRUPTED
 func (b *Broadcast) SetQueued(ctx context.Context, db DBorTx, contactCount int) error {
 	if b.Status != BroadcastStatusInterrupted {
@@ -316,17 +377,12 @@ func GetBroadcastByID(ctx context.Context, db DBorTx, bcastID BroadcastID) (*Bro
 }
 
 // Send creates a message event for the given contact - can return nil if resultant message has no content and thus is a noop
-func (b *Broadcast) Send(ctx context.Context, rt *runtime.Runtime, oa *OrgAssets, contact *core.Contact) (*events.MsgCreated, error) {
+func (b *Broadcast) Send(ctx context.Context, rt *runtime.Runtime, oa *OrgAssets, contact *core.Contact, windows OpenSessionWindows) (*events.MsgCreated, error) {
 	content, locale := b.Translations.ForContact(oa.Env(), contact, b.BaseLanguage)
 
 	var expressionsContext *types.XObject
 	if b.Expressions {
-		expressionsContext = types.NewXObject(map[string]types.XValue{
-			"contact": core.Context(oa.Env(), contact),
-			"fields":  core.Context(oa.Env(), contact.Fields()),
-			"globals": core.Context(oa.Env(), oa.SessionAssets().Globals()),
-			"urns":    core.ContextFunc(oa.Env(), contact.URNs().MapContext),
-		})
+		expressionsContext = ExpressionsContext(oa, contact)
 	}
 
 	// don't create a message if we have no content
@@ -334,7 +390,7 @@ func (b *Broadcast) Send(ctx context.Context, rt *runtime.Runtime, oa *OrgAssets
 		return nil, nil
 	}
 
-	out, err := CreateMsgOut(ctx, rt, oa, contact, content, b.TemplateID, b.TemplateVariables, locale, expressionsContext)
+	out, err := CreateMsgOut(ctx, rt, oa, contact, content, b.TemplateID, b.TemplateVariables, locale, expressionsContext, windows)
 	if err != nil {
 		return nil, fmt.Errorf("error creating message content: %w", err)
 	}
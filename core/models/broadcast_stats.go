@@ -0,0 +1,147 @@
+package models
+
+import (
+	"cmp"
+	"context"
+	"database/sql"
+	"fmt"
+	"math"
+	"slices"
+	"time"
+
+	"github.com/nyaruka/gocommon/i18n"
+	"github.com/nyaruka/goflow/assets"
+	"github.com/nyaruka/null/v3"
+)
+
+var msgStatusNames = map[MsgStatus]string{
+	MsgStatusInitializing: "initializing",
+	MsgStatusQueued:       "queued",
+	MsgStatusWired:        "wired",
+	MsgStatusSent:         "sent",
+	MsgStatusDelivered:    "delivered",
+	MsgStatusRead:         "read",
+	MsgStatusErrored:      "errored",
+	MsgStatusFailed:       "failed",
+}
+
+var msgFailedReasonNames = map[MsgFailedReason]string{
+	NilMsgFailedReason:      "unknown",
+	MsgFailedContact:        "contact",
+	MsgFailedNoDestination:  "no_destination",
+	MsgFailedSuspended:      "suspended",
+	MsgFailedLooping:        "looping",
+	MsgFailedErrorLimit:     "error_limit",
+	MsgFailedTooOld:         "too_old",
+	MsgFailedChannelRemoved: "channel_removed",
+	MsgFailedWindowClosed:   "window_closed",
+}
+
+// BroadcastStats is a summary of how the messages of a broadcast have fared
+type BroadcastStats struct {
+	Total         int                   `json:"total"`
+	Statuses      map[string]int        `json:"statuses"`
+	FailedReasons map[string]int        `json:"failed_reasons"`
+	Channels      []*BroadcastChannel   `json:"channels"`
+	Languages     map[i18n.Language]int `json:"languages"`
+	Contacts      int                   `json:"contacts"`
+	Replied       int                   `json:"replied"`
+	ReplyRate     float64               `json:"reply_rate"`
+	Capped        int                   `json:"capped"`
+}
+
+// BroadcastChannel is the number of messages of a broadcast sent via a channel, which is empty for messages which
+// had no channel
+type BroadcastChannel struct {
+	UUID  assets.ChannelUUID `json:"uuid,omitempty"`
+	Name  string             `json:"name,omitempty"`
+	Count int                `json:"count"`
+}
+
+const sqlSelectBroadcastMsgCounts = `
+  SELECT status, failed_reason, channel_id, LEFT(locale, 3) AS language, count(*) AS count
+    FROM msgs_msg
+   WHERE broadcast_id = $1 AND direction = 'O'
+GROUP BY 1, 2, 3, 4`
+
+const sqlSelectBroadcastReplies = `
+SELECT count(DISTINCT m.contact_id) AS contacts,
+       count(DISTINCT m.contact_id) FILTER (WHERE EXISTS (
+           SELECT 1 FROM msgs_msg r WHERE r.contact_id = m.contact_id AND r.direction = 'I' AND r.created_on > m.created_on AND r.created_on <= m.created_on + make_interval(secs => $2)
+       )) AS replied
+  FROM msgs_msg m
+ WHERE m.broadcast_id = $1 AND m.direction = 'O'`
+
+// GetBroadcastStats aggregates the messages of the given broadcast by status, failure reason, channel and language,
+// and counts the contacts who replied within the given window of being sent a message
+func GetBroadcastStats(ctx context.Context, db *sql.DB, oa *OrgAssets, bcastID BroadcastID, replyWindow time.Duration) (*BroadcastStats, error) {
+	stats := &BroadcastStats{
+		Statuses:      make(map[string]int),
+		FailedReasons: make(map[string]int),
+		Channels:      []*BroadcastChannel{},
+		Languages:     make(map[i18n.Language]int),
+	}
+
+	rows, err := db.QueryContext(ctx, sqlSelectBroadcastMsgCounts, bcastID)
+	if err != nil {
+		return nil, fmt.Errorf("error querying broadcast message counts: %w", err)
+	}
+	defer rows.Close()
+
+	byChannel := make(map[ChannelID]int)
+
+	for rows.Next() {
+		var status MsgStatus
+		var failedReason MsgFailedReason
+		var channelID ChannelID
+		var language null.String
+		var count int
+
+		if err := rows.Scan(&status, &failedReason, &channelID, &language, &count); err != nil {
+			return nil, fmt.Errorf("error scanning broadcast message counts: %w", err)
+		}
+
+		stats.Total += count
+		stats.Statuses[msgStatusNames[status]] += count
+		if status == MsgStatusFailed {
+			stats.FailedReasons[msgFailedReasonNames[failedReason]] += count
+		}
+		byChannel[channelID] += count
+
+		lang := i18n.Language(language)
+		if lang == i18n.NilLanguage {
+			lang = "und"
+		}
+		stats.Languages[lang] += count
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error reading broadcast message counts: %w", err)
+	}
+
+	for channelID, count := range byChannel {
+		bc := &BroadcastChannel{Count: count}
+		if ch := oa.ChannelByID(channelID); ch != nil {
+			bc.UUID, bc.Name = ch.UUID(), ch.Name()
+		}
+		stats.Channels = append(stats.Channels, bc)
+	}
+	slices.SortFunc(stats.Channels, func(a, b *BroadcastChannel) int {
+		return cmp.Or(cmp.Compare(b.Count, a.Count), cmp.Compare(a.UUID, b.UUID))
+	})
+
+	if err := db.QueryRowContext(ctx, sqlSelectBroadcastReplies, bcastID, replyWindow.Seconds()).Scan(&stats.Contacts, &stats.Replied); err != nil {
+		return nil, fmt.Errorf("error counting broadcast replies: %w", err)
+	}
+
+	stats.ReplyRate = broadcastStatsRate(stats.Replied, stats.Contacts)
+
+	return stats, nil
+}
+
+// rate of n out of total rounded to 3 decimal places
+func broadcastStatsRate(n, total int) float64 {
+	if total == 0 {
+		return 0
+	}
+	return math.Round(float64(n)/float64(total)*1000) / 1000
+}
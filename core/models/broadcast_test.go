@@ -117,7 +117,7 @@ func TestNonPersistentBroadcasts(t *testing.T) {
 	assert.Equal(t, "", bcast.Query)
 	assert.Equal(t, models.NoExclusions, bcast.Exclusions)
 
-	batch := bcast.CreateBatch([]models.ContactID{testdb.Dan.ID, testdb.Bob.ID}, []models.ContactID{testdb.Dan.ID})
+	batch := bcast.CreateBatch([]models.ContactID{testdb.Dan.ID, testdb.Bob.ID}, []models.ContactID{testdb.Dan.ID}, nil)
 
 	assert.Equal(t, models.NilBroadcastID, batch.BroadcastID)
 	assert.NotNil(t, testdb.Org1.ID, batch.Broadcast)
@@ -317,9 +317,49 @@ func TestBroadcastSend(t *testing.T) {
 
 		_, ec, _ := contact.Load(t, rt, oa)
 
-		evt, err := bcast.Send(ctx, rt, oa, ec)
+		evt, err := bcast.Send(ctx, rt, oa, ec, nil)
 		require.NoError(t, err)
 
 		assert.JSONEq(t, string(tc.expected), string(jsonx.MustMarshal(evt)), "%d: msg json mismatch", i)
 	}
 }
+
+func TestGetBroadcastStats(t *testing.T) {
+	ctx, rt := testsuite.Runtime(t)
+
+	oa := testdb.Org1.Load(t, rt)
+	bcast := testdb.InsertBroadcast(t, rt, testdb.Org1, "0199f6a8-2b3c-7d4e-8f5a-6b7c8d9e0f1a", "eng", map[i18n.Language]string{"eng": "Hi"}, models.NilScheduleID, nil, nil)
+
+	// a broadcast with no messages has empty stats
+	stats, err := models.GetBroadcastStats(ctx, rt.ReadonlyDB, oa, bcast.ID, 24*time.Hour)
+	require.NoError(t, err)
+	assert.Equal(t, &models.BroadcastStats{
+		Statuses:      map[string]int{},
+		FailedReasons: map[string]int{},
+		Channels:      []*models.BroadcastChannel{},
+		Languages:     map[i18n.Language]int{},
+	}, stats)
+
+	out1 := testdb.InsertOutgoingMsg(t, rt, testdb.Org1, "0199f6a9-1a2b-7c3d-8e4f-5a6b7c8d9e0f", testdb.TwilioChannel, testdb.Ann, "Hi", nil, models.MsgStatusRead, false)
+	out2 := testdb.InsertOutgoingMsg(t, rt, testdb.Org1, "0199f6a9-3c4d-7e5f-8a6b-7c8d9e0f1a2b", testdb.TwilioChannel, testdb.Bob, "Hi", nil, models.MsgStatusFailed, false)
+	rt.DB.MustExec(`UPDATE msgs_msg SET broadcast_id = $1, created_on = NOW() - INTERVAL '2 hours' WHERE id IN ($2, $3)`, bcast.ID, out1.ID, out2.ID)
+	rt.DB.MustExec(`UPDATE msgs_msg SET locale = NULL, failed_reason = 'E' WHERE id = $1`, out2.ID)
+	testdb.InsertIncomingMsg(t, rt, testdb.Org1, "0199f6aa-7a8b-7c9d-8e0f-1a2b3c4d5e6f", testdb.TwilioChannel, testdb.Bob, "Hello", models.MsgStatusHandled, "")
+	rt.DB.MustExec(`UPDATE msgs_msg SET created_on = NOW() - INTERVAL '1 hour' WHERE direction = 'I'`)
+
+	stats, err = models.GetBroadcastStats(ctx, rt.ReadonlyDB, oa, bcast.ID, 24*time.Hour)
+	require.NoError(t, err)
+	assert.Equal(t, 2, stats.Total)
+	assert.Equal(t, map[string]int{"read": 1, "failed": 1}, stats.Statuses)
+	assert.Equal(t, map[string]int{"error_limit": 1}, stats.FailedReasons)
+	assert.Equal(t, []*models.BroadcastChannel{{UUID: testdb.TwilioChannel.UUID, Name: "Twilio", Count: 2}}, stats.Channels)
+	assert.Equal(t, map[i18n.Language]int{"eng": 1, "und": 1}, stats.Languages)
+	assert.Equal(t, 2, stats.Contacts)
+	assert.Equal(t, 1, stats.Replied)
+	assert.Equal(t, 0.5, stats.ReplyRate)
+
+	// replies outside of the window aren't counted
+	stats, err = models.GetBroadcastStats(ctx, rt.ReadonlyDB, oa, bcast.ID, 30*time.Minute)
+	require.NoError(t, err)
+	assert.Equal(t, 0, stats.Replied)
+}
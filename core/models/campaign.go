@@ -170,16 +170,7 @@ func (p *CampaignPoint) ScheduleForTime(tz *time.Location, now, start time.Time)
 	}
 
 	// create our offset
-	switch p.Unit {
-	case PointUnitMinutes:
-		scheduled = scheduled.Add(time.Minute * time.Duration(p.Offset))
-	case PointUnitHours:
-		scheduled = scheduled.Add(time.Hour * time.Duration(p.Offset))
-	case PointUnitDays:
-		scheduled = scheduled.AddDate(0, 0, p.Offset)
-	case PointUnitWeeks:
-		scheduled = scheduled.AddDate(0, 0, p.Offset*7)
-	}
+	scheduled = addPointOffset(scheduled, p.Offset, p.Unit)
 
 	// now set our delivery hour if set
 	if p.DeliveryHour != NilDeliveryHour {
@@ -196,6 +187,21 @@ func (p *CampaignPoint) ScheduleForTime(tz *time.Location, now, start time.Time)
 
 func (p *CampaignPoint) Campaign() *Campaign { return p.campaign }
 
+// adds the given offset in the given unit to the given time
+func addPointOffset(t time.Time, offset int, unit PointUnit) time.Time {
+	switch unit {
+	case PointUnitMinutes:
+		return t.Add(time.Minute * time.Duration(offset))
+	case PointUnitHours:
+		return t.Add(time.Hour * time.Duration(offset))
+	case PointUnitDays:
+		return t.AddDate(0, 0, offset)
+	case PointUnitWeeks:
+		return t.AddDate(0, 0, offset*7)
+	}
+	return t
+}
+
 // loadCampaigns loads all the campaigns for the passed in org
 func loadCampaigns(ctx context.Context, db *sql.DB, orgID OrgID) ([]assets.Campaign, error) {
 	rows, err := db.QueryContext(ctx, sqlSelectCampaignsByOrg, orgID)
@@ -320,6 +326,11 @@ func campaignPointEligibleContacts(ctx context.Context, db *sqlx.DB, groupID Gro
 		query = sqlEligibleContactsForLastSeenOn
 		params = []any{groupID}
 	default:
+		// values of sensitive fields are encrypted so can't be read here
+		if field.Sensitive() {
+			return nil, fmt.Errorf("campaign points can't be relative to sensitive field %s", field.Key())
+		}
+
 		query = sqlEligibleContactsForField
 		params = []any{groupID, field.UUID()}
 	}
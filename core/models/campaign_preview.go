@@ -0,0 +1,364 @@
+package models
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"slices"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/nyaruka/gocommon/dates"
+	"github.com/nyaruka/goflow/assets"
+	"github.com/nyaruka/goflow/core"
+	"github.com/nyaruka/mailroom/v26/runtime"
+)
+
+// CampaignPreview is a projection of when campaign points would fire for their eligible contacts
+type CampaignPreview struct {
+	Total   int                      `json:"total"`
+	Days    []*CampaignPreviewDay    `json:"days"`
+	Peak    *CampaignPreviewPeak     `json:"peak"`
+	Samples []*CampaignPreviewSample `json:"samples"`
+}
+
+// CampaignPreviewDay is the number of projected fires on a day, in the org's timezone, broken down by hour
+type CampaignPreviewDay struct {
+	Date  string  `json:"date"`
+	Count int     `json:"count"`
+	Hours [24]int `json:"hours"`
+}
+
+// CampaignPreviewPeak is the hour with the most projected fires
+type CampaignPreviewPeak struct {
+	Date  string `json:"date"`
+	Hour  int    `json:"hour"`
+	Count int    `json:"count"`
+}
+
+// CampaignPreviewSample is a projected fire for a single contact
+type CampaignPreviewSample struct {
+	Contact   *core.ContactReference `json:"contact"`
+	PointID   PointID                `json:"point_id"`
+	Scheduled time.Time              `json:"scheduled"`
+}
+
+type projectedFire struct {
+	contactID ContactID
+	point     *CampaignPoint
+	scheduled time.Time
+}
+
+// number of eligible contacts loaded at a time when projecting fires
+const campaignPreviewBatchSize = 5000
+
+const sqlSelectCampaignPreviewContactsPage = `
+    SELECT c.id, c.created_on, c.last_seen_on, COALESCE((
+             SELECT jsonb_object_agg(f, (c.fields->f->>'datetime')::timestamptz) FROM unnest($2::text[]) f WHERE c.fields->f ? 'datetime'
+           ), '{}') AS field_values
+      FROM contacts_contact c
+INNER JOIN contacts_contactgroup_contacts gc ON gc.contact_id = c.id
+     WHERE gc.contactgroup_id = $1 AND c.is_active = TRUE AND c.id > $3
+  ORDER BY c.id
+     LIMIT $4`
+
+type previewContact struct {
+	id          ContactID
+	createdOn   time.Time
+	lastSeenOn  *time.Time
+	fieldValues map[assets.FieldUUID]time.Time
+}
+
+// PreviewCampaignPoints projects the fires of the given campaign points for their currently eligible contacts over the
+// given number of days, including the earliest numSamples fires as samples. Fires are deferred or dropped by send
+// windows and frequency caps as they would be when fired. Contacts are read in pages from the readonly database and
+// only the counts and samples are kept.
+func PreviewCampaignPoints(ctx context.Context, rt *runtime.Runtime, oa *OrgAssets, points []*CampaignPoint, days int, numSamples int) (*CampaignPreview, error) {
+	now := dates.Now()
+	until := now.AddDate(0, 0, days)
+
+	// points of the same campaign share the group of eligible contacts
+	byGroup := make(map[GroupID][]*CampaignPoint)
+	groupIDs := make([]GroupID, 0, 1)
+	fieldUUIDs := make([]assets.FieldUUID, 0, len(points))
+
+	for _, p := range points {
+		field := oa.FieldByKey(p.RelativeToKey)
+		if field == nil {
+			return nil, fmt.Errorf("can't find field with key %s", p.RelativeToKey)
+		}
+		if p.RelativeToKey != CreatedOnKey && p.RelativeToKey != LastSeenOnKey {
+			// values of sensitive fields are encrypted so can't be read here
+			if field.Sensitive() {
+				return nil, fmt.Errorf("campaign points can't be relative to sensitive field %s", field.Key())
+			}
+			fieldUUIDs = append(fieldUUIDs, field.UUID())
+		}
+
+		groupID := p.campaign.GroupID()
+		if _, seen := byGroup[groupID]; !seen {
+			groupIDs = append(groupIDs, groupID)
+		}
+		byGroup[groupID] = append(byGroup[groupID], p)
+	}
+
+	proj := &campaignProjector{oa: oa, windows: oa.Org().CampaignSendWindows(), caps: oa.Org().FrequencyCaps(), now: now, until: until}
+	agg := newPreviewAggregator(oa.Env().Timezone(), numSamples)
+
+	for _, groupID := range groupIDs {
+		var afterID ContactID
+
+		for {
+			contacts, err := loadPreviewContactsPage(ctx, rt.ReadonlyDB, groupID, fieldUUIDs, afterID, campaignPreviewBatchSize)
+			if err != nil {
+				return nil, err
+			}
+			if len(contacts) == 0 {
+				break
+			}
+
+			fires, err := proj.project(ctx, rt, byGroup[groupID], contacts)
+			if err != nil {
+				return nil, err
+			}
+			agg.add(fires)
+
+			afterID = contacts[len(contacts)-1].id
+		}
+	}
+
+	preview := agg.preview(days)
+
+	contactIDs := make([]ContactID, len(agg.samples))
+	for i, f := range agg.samples {
+		contactIDs[i] = f.contactID
+	}
+
+	refs, err := loadContactReferences(ctx, rt, oa.OrgID(), contactIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	preview.Samples = make([]*CampaignPreviewSample, len(agg.samples))
+	for i, f := range agg.samples {
+		preview.Samples[i] = &CampaignPreviewSample{Contact: refs[f.contactID], PointID: f.point.ID, Scheduled: f.scheduled}
+	}
+
+	return preview, nil
+}
+
+// loads the next page of contacts in the given group with their values of the given datetime fields
+func loadPreviewContactsPage(ctx context.Context, db Queryer, groupID GroupID, fieldUUIDs []assets.FieldUUID, afterID ContactID, limit int) ([]*previewContact, error) {
+	rows, err := db.QueryContext(ctx, sqlSelectCampaignPreviewContactsPage, groupID, pq.Array(fieldUUIDs), afterID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("error querying eligible contacts for preview: %w", err)
+	}
+	defer rows.Close()
+
+	contacts := make([]*previewContact, 0, limit)
+
+	for rows.Next() {
+		c := &previewContact{}
+		var valuesJSON []byte
+		if err := rows.Scan(&c.id, &c.createdOn, &c.lastSeenOn, &valuesJSON); err != nil {
+			return nil, fmt.Errorf("error scanning eligible contact for preview: %w", err)
+		}
+		if err := json.Unmarshal(valuesJSON, &c.fieldValues); err != nil {
+			return nil, fmt.Errorf("error unmarshaling field values of contact #%d: %w", c.id, err)
+		}
+		contacts = append(contacts, c)
+	}
+
+	return contacts, rows.Err()
+}
+
+// projects the fires of campaign points, applying the same send windows and frequency caps as the contact fires cron
+type campaignProjector struct {
+	oa         *OrgAssets
+	windows    *CampaignSendWindows
+	caps       *FrequencyCaps
+	now, until time.Time
+}
+
+func (p *campaignProjector) project(ctx context.Context, rt *runtime.Runtime, points []*CampaignPoint, contacts []*previewContact) ([]*projectedFire, error) {
+	orgTZ := p.oa.Env().Timezone()
+
+	contactIDs := make([]ContactID, len(contacts))
+	for i, c := range contacts {
+		contactIDs[i] = c.id
+	}
+
+	var tzs map[ContactID]*time.Location
+	if slices.ContainsFunc(points, func(pt *CampaignPoint) bool { return p.windows.ForPoint(pt) != nil }) {
+		var err error
+		if tzs, err = p.windows.ContactTimezones(ctx, rt.ReadonlyDB, p.oa, contactIDs); err != nil {
+			return nil, err
+		}
+	}
+
+	var counts map[ContactID]map[string]int
+	if p.caps != nil && slices.ContainsFunc(points, func(pt *CampaignPoint) bool { return pt.Type == PointTypeMessage }) {
+		var err error
+		if counts, err = p.caps.sendCounts(ctx, rt, p.oa, contactIDs, p.now); err != nil {
+			return nil, err
+		}
+	}
+
+	fires := make([]*projectedFire, 0, len(contacts))
+
+	for _, c := range contacts {
+		tz := cmp.Or(tzs[c.id], orgTZ)
+		contactFires := make([]*projectedFire, 0, len(points))
+
+		for _, pt := range points {
+			var relTo *time.Time
+			switch pt.RelativeToKey {
+			case CreatedOnKey:
+				relTo = &c.createdOn
+			case LastSeenOnKey:
+				relTo = c.lastSeenOn
+			default:
+				if v, ok := c.fieldValues[p.oa.FieldByKey(pt.RelativeToKey).UUID()]; ok {
+					relTo = &v
+				}
+			}
+			if relTo == nil {
+				continue
+			}
+
+			if scheduled := pt.ScheduleForTime(orgTZ, p.now, *relTo); scheduled != nil {
+				contactFires = append(contactFires, &projectedFire{contactID: c.id, point: pt, scheduled: p.applyWindow(pt, *scheduled, tz)})
+			}
+		}
+
+		fires = append(fires, p.applyCaps(contactFires, counts[c.id], tz)...)
+	}
+
+	return fires, nil
+}
+
+// defers the given time to the next time allowed by the send window of the given point, if it has one
+func (p *campaignProjector) applyWindow(pt *CampaignPoint, t time.Time, tz *time.Location) time.Time {
+	if window := p.windows.ForPoint(pt); window != nil {
+		return window.Next(t, tz)
+	}
+	return t
+}
+
+// applies frequency caps to the given fires of a single contact in the order they would fire, deferring or dropping
+// message fires for which the contact has reached a cap, and returns those which fall before the end of the preview
+func (p *campaignProjector) applyCaps(fires []*projectedFire, counts map[string]int, tz *time.Location) []*projectedFire {
+	if counts == nil {
+		counts = make(map[string]int)
+	}
+
+	pending := slices.Clone(fires)
+	projected := make([]*projectedFire, 0, len(fires))
+
+	for len(pending) > 0 {
+		slices.SortFunc(pending, compareProjectedFires)
+		f := pending[0]
+		pending = pending[1:]
+
+		if !f.scheduled.Before(p.until) {
+			continue
+		}
+
+		if p.caps != nil && f.point.Type == PointTypeMessage {
+			if p.caps.reached(p.oa, counts, f.scheduled) {
+				if p.caps.Defer {
+					f.scheduled = p.applyWindow(f.point, p.caps.DeferUntil(p.oa, f.scheduled), tz)
+					pending = append(pending, f)
+				}
+				continue
+			}
+			counts[f.scheduled.In(p.oa.Env().Timezone()).Format("2006-01-02")]++
+		}
+
+		projected = append(projected, f)
+	}
+
+	return projected
+}
+
+func compareProjectedFires(a, b *projectedFire) int {
+	return cmp.Or(a.scheduled.Compare(b.scheduled), cmp.Compare(a.contactID, b.contactID), cmp.Compare(a.point.ID, b.point.ID))
+}
+
+// aggregates projected fires into counts per day and hour, keeping only the earliest fires as samples
+type previewAggregator struct {
+	tz         *time.Location
+	numSamples int
+	total      int
+	days       map[string]*CampaignPreviewDay
+	samples    []*projectedFire
+}
+
+func newPreviewAggregator(tz *time.Location, numSamples int) *previewAggregator {
+	return &previewAggregator{tz: tz, numSamples: numSamples, days: make(map[string]*CampaignPreviewDay)}
+}
+
+func (a *previewAggregator) add(fires []*projectedFire) {
+	for _, f := range fires {
+		local := f.scheduled.In(a.tz)
+		date := local.Format(time.DateOnly)
+
+		day := a.days[date]
+		if day == nil {
+			day = &CampaignPreviewDay{Date: date}
+			a.days[date] = day
+		}
+		day.Count++
+		day.Hours[local.Hour()]++
+	}
+	a.total += len(fires)
+
+	a.samples = append(a.samples, fires...)
+	slices.SortFunc(a.samples, compareProjectedFires)
+	a.samples = a.samples[:min(a.numSamples, len(a.samples))]
+}
+
+func (a *previewAggregator) preview(days int) *CampaignPreview {
+	preview := &CampaignPreview{Total: a.total, Days: make([]*CampaignPreviewDay, 0, days+1)}
+	for _, date := range slices.Sorted(maps.Keys(a.days)) {
+		day := a.days[date]
+		preview.Days = append(preview.Days, day)
+
+		for hour, count := range day.Hours {
+			if preview.Peak == nil || count > preview.Peak.Count {
+				preview.Peak = &CampaignPreviewPeak{Date: date, Hour: hour, Count: count}
+			}
+		}
+	}
+	return preview
+}
+
+const sqlSelectContactReferences = `SELECT id, uuid, COALESCE(name, '') FROM contacts_contact WHERE org_id = $1 AND id = ANY($2)`
+
+// loads references for the given contacts
+func loadContactReferences(ctx context.Context, rt *runtime.Runtime, orgID OrgID, ids []ContactID) (map[ContactID]*core.ContactReference, error) {
+	refs := make(map[ContactID]*core.ContactReference, len(ids))
+	if len(ids) == 0 {
+		return refs, nil
+	}
+
+	rows, err := rt.ReadonlyDB.QueryContext(ctx, sqlSelectContactReferences, orgID, pq.Array(ids))
+	if err != nil {
+		return nil, fmt.Errorf("error querying contact references: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id ContactID
+		var uuid core.ContactUUID
+		var name string
+		if err := rows.Scan(&id, &uuid, &name); err != nil {
+			return nil, fmt.Errorf("error scanning contact reference: %w", err)
+		}
+		refs[id] = core.NewContactReference(uuid, name)
+	}
+
+	return refs, rows.Err()
+}
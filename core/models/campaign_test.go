@@ -5,6 +5,7 @@ import (
 	"time"
 
 	"github.com/lib/pq"
+	"github.com/nyaruka/gocommon/dates"
 	"github.com/nyaruka/goflow/core"
 	"github.com/nyaruka/mailroom/v26/core/models"
 	"github.com/nyaruka/mailroom/v26/testsuite"
@@ -125,3 +126,89 @@ func TestScheduleForTime(t *testing.T) {
 		}
 	}
 }
+
+func TestPreviewCampaignPoints(t *testing.T) {
+	ctx, rt := testsuite.Runtime(t)
+
+	dates.SetNowFunc(dates.NewFixedNow(time.Date(2029, 12, 30, 0, 0, 0, 0, time.UTC)))
+	defer dates.SetNowFunc(time.Now)
+
+	testdb.DoctorsGroup.Add(rt, testdb.Bob, testdb.Cat, testdb.Dan)
+
+	// Bob joins within the preview window, Cat joins after it and Dan joined in the past
+	rt.DB.MustExec(`UPDATE contacts_contact SET fields = '{"d83aae24-4bbf-49d0-ab85-6bfd201eac6d": {"datetime": "2030-01-01T00:00:00Z"}}' WHERE id = $1`, testdb.Bob.ID)
+	rt.DB.MustExec(`UPDATE contacts_contact SET fields = '{"d83aae24-4bbf-49d0-ab85-6bfd201eac6d": {"datetime": "2030-08-18T11:31:30Z"}}' WHERE id = $1`, testdb.Cat.ID)
+	rt.DB.MustExec(`UPDATE contacts_contact SET fields = '{"d83aae24-4bbf-49d0-ab85-6bfd201eac6d": {"datetime": "2015-01-01T00:00:00Z"}}' WHERE id = $1`, testdb.Dan.ID)
+
+	oa := testdb.Org1.Load(t, rt)
+	p1 := oa.CampaignPointByID(testdb.RemindersPoint1.ID) // joined + 5 days at 12:00
+	p2 := oa.CampaignPointByID(testdb.RemindersPoint2.ID) // joined + 10 minutes
+
+	preview, err := models.PreviewCampaignPoints(ctx, rt, oa, []*models.CampaignPoint{p1, p2}, 30, 10)
+	require.NoError(t, err)
+
+	assert.Equal(t, 2, preview.Total)
+	require.Len(t, preview.Days, 2)
+	assert.Equal(t, "2029-12-31", preview.Days[0].Date) // days and hours are in the org timezone
+	assert.Equal(t, 1, preview.Days[0].Count)
+	assert.Equal(t, 1, preview.Days[0].Hours[16])
+	assert.Equal(t, "2030-01-05", preview.Days[1].Date)
+	assert.Equal(t, 1, preview.Days[1].Count)
+	assert.Equal(t, 1, preview.Days[1].Hours[12])
+	assert.Equal(t, &models.CampaignPreviewPeak{Date: "2029-12-31", Hour: 16, Count: 1}, preview.Peak)
+
+	require.Len(t, preview.Samples, 2)
+	assert.Equal(t, testdb.Bob.UUID, preview.Samples[0].Contact.UUID)
+	assert.Equal(t, testdb.RemindersPoint2.ID, preview.Samples[0].PointID)
+	assert.Equal(t, time.Date(2030, 1, 1, 0, 10, 0, 0, time.UTC), preview.Samples[0].Scheduled.UTC())
+	assert.Equal(t, testdb.RemindersPoint1.ID, preview.Samples[1].PointID)
+	assert.Equal(t, time.Date(2030, 1, 5, 20, 0, 0, 0, time.UTC), preview.Samples[1].Scheduled.UTC())
+
+	// with a shorter window only the first fire is included
+	preview, err = models.PreviewCampaignPoints(ctx, rt, oa, []*models.CampaignPoint{p1, p2}, 3, 10)
+	require.NoError(t, err)
+	assert.Equal(t, 1, preview.Total)
+	assert.Len(t, preview.Samples, 1)
+
+	// fires outside of the send window of their point are deferred to the next allowed time
+	rt.DB.MustExec(`UPDATE orgs_org SET config = config || '{"campaign_send_windows": {"points": {"f2a3f8c5-e831-4df3-b046-8d8cdb90f178": {"start": "09:00", "end": "12:00"}}}}'::jsonb WHERE id = $1`, testdb.Org1.ID)
+	oa, err = models.GetOrgAssetsWithRefresh(ctx, rt, testdb.Org1.ID, models.RefreshOrg)
+	require.NoError(t, err)
+
+	preview, err = models.PreviewCampaignPoints(ctx, rt, oa, []*models.CampaignPoint{p1, p2}, 30, 10)
+	require.NoError(t, err)
+	assert.Equal(t, 2, preview.Total)
+	require.Len(t, preview.Days, 2)
+	assert.Equal(t, "2030-01-01", preview.Days[0].Date)
+	assert.Equal(t, 1, preview.Days[0].Hours[9])
+	assert.Equal(t, time.Date(2030, 1, 1, 17, 0, 0, 0, time.UTC), preview.Samples[0].Scheduled.UTC())
+
+	// message fires for contacts who have reached a frequency cap are dropped...
+	dates.SetNowFunc(dates.NewFixedNow(time.Date(2029, 12, 31, 20, 0, 0, 0, time.UTC)))
+
+	rt.DB.MustExec(`UPDATE orgs_org SET config = config - 'campaign_send_windows' || '{"frequency_caps": {"day": 1}}'::jsonb WHERE id = $1`, testdb.Org1.ID)
+	oa, err = models.GetOrgAssetsWithRefresh(ctx, rt, testdb.Org1.ID, models.RefreshOrg)
+	require.NoError(t, err)
+
+	_, capped, err := oa.Org().FrequencyCaps().Reserve(ctx, rt, oa, []models.ContactID{testdb.Bob.ID}, dates.Now())
+	require.NoError(t, err)
+	assert.Len(t, capped, 0)
+
+	preview, err = models.PreviewCampaignPoints(ctx, rt, oa, []*models.CampaignPoint{p1, p2}, 30, 10)
+	require.NoError(t, err)
+	assert.Equal(t, 1, preview.Total)
+	require.Len(t, preview.Samples, 1)
+	assert.Equal(t, testdb.RemindersPoint1.ID, preview.Samples[0].PointID)
+
+	// ... or deferred to the next day
+	rt.DB.MustExec(`UPDATE orgs_org SET config = config || '{"frequency_caps": {"day": 1, "defer": true}}'::jsonb WHERE id = $1`, testdb.Org1.ID)
+	oa, err = models.GetOrgAssetsWithRefresh(ctx, rt, testdb.Org1.ID, models.RefreshOrg)
+	require.NoError(t, err)
+
+	preview, err = models.PreviewCampaignPoints(ctx, rt, oa, []*models.CampaignPoint{p1, p2}, 30, 10)
+	require.NoError(t, err)
+	assert.Equal(t, 2, preview.Total)
+	require.Len(t, preview.Samples, 2)
+	assert.Equal(t, testdb.RemindersPoint2.ID, preview.Samples[0].PointID)
+	assert.Equal(t, time.Date(2030, 1, 1, 8, 0, 0, 0, time.UTC), preview.Samples[0].Scheduled.UTC())
+}
@@ -305,6 +305,14 @@ func LoadContacts(ctx context.Context, db Queryer, oa *OrgAssets, ids []ContactI
 			field := f.(*Field)
 			cv, found := e.Fields[field.UUID()]
 			if found {
+				// a value we can't decrypt, e.g. because its key has been retired, shouldn't stop the contact loading
+				if cv.Enc != "" {
+					if err := oa.Org().DecryptFieldValue(field.UUID(), cv.Enc, &cv); err != nil {
+						slog.Error("error decrypting contact field value", "contact", e.UUID, "field", field.UUID(), "error", err)
+						continue
+					}
+				}
+
 				value := core.NewValue(
 					cv.Text,
 					cv.Datetime,
@@ -414,6 +422,28 @@ func ContactExists(ctx context.Context, db DBorTx, orgID OrgID, uuid core.Contac
 	return exists, nil
 }
 
+const sqlSelectContactReleased = `SELECT EXISTS(SELECT 1 FROM contacts_contact WHERE org_id = $1 AND uuid = $2 AND is_active = FALSE)`
+
+// IsContactReleased returns whether a contact with the given UUID exists in the given org and has been released
+func IsContactReleased(ctx context.Context, db DBorTx, orgID OrgID, uuid core.ContactUUID) (bool, error) {
+	var released bool
+	if err := db.GetContext(ctx, &released, sqlSelectContactReleased, orgID, uuid); err != nil {
+		return false, fmt.Errorf("error querying contact released: %w", err)
+	}
+	return released, nil
+}
+
+const sqlSelectContactCreatedOn = `SELECT created_on FROM contacts_contact WHERE org_id = $1 AND uuid = $2`
+
+// GetContactCreatedOn returns when the contact with the given UUID in the given org was created
+func GetContactCreatedOn(ctx context.Context, db DBorTx, orgID OrgID, uuid core.ContactUUID) (time.Time, error) {
+	var createdOn time.Time
+	if err := db.GetContext(ctx, &createdOn, sqlSelectContactCreatedOn, orgID, uuid); err != nil {
+		return time.Time{}, fmt.Errorf("error querying contact created on: %w", err)
+	}
+	return createdOn, nil
+}
+
 // utility to query contact IDs
 func queryContactIDs(ctx context.Context, db Queryer, query string, args ...any) ([]ContactID, error) {
 	rows, err := db.QueryContext(ctx, query, args...)
@@ -437,6 +467,36 @@ func GetContactIDsPage(ctx context.Context, db Queryer, orgID OrgID, afterID Con
 	return queryContactIDs(ctx, db, sqlSelectContactIDsPage, orgID, int(afterID), limit)
 }
 
+const sqlSelectContactIDsWithFieldsPage = `SELECT id FROM contacts_contact WHERE org_id = $1 AND is_active = TRUE AND id > $2 AND fields ?| $3 ORDER BY id LIMIT $4`
+
+// GetContactIDsWithFieldsPage returns a page of IDs of contacts with a value for any of the given fields, using
+// cursor-based pagination.
+func GetContactIDsWithFieldsPage(ctx context.Context, db Queryer, orgID OrgID, fieldUUIDs []assets.FieldUUID, afterID ContactID, limit int) ([]ContactID, error) {
+	return queryContactIDs(ctx, db, sqlSelectContactIDsWithFieldsPage, orgID, int(afterID), pq.Array(fieldUUIDs), limit)
+}
+
+const sqlSelectContactIDsModifiedSincePage = `SELECT id FROM contacts_contact WHERE org_id = $1 AND is_active = TRUE AND modified_on > $2 AND id > $3 ORDER BY id LIMIT $4`
+
+// GetContactIDsModifiedSincePage returns a page of IDs of contacts created or modified since the given time, using
+// cursor-based pagination.
+func GetContactIDsModifiedSincePage(ctx context.Context, db Queryer, orgID OrgID, since time.Time, afterID ContactID, limit int) ([]ContactID, error) {
+	return queryContactIDs(ctx, db, sqlSelectContactIDsModifiedSincePage, orgID, since, int(afterID), limit)
+}
+
+const sqlReleaseContacts = `
+UPDATE contacts_contact
+   SET is_active = FALSE, modified_on = NOW(), modified_by_id = $2
+ WHERE id = ANY($1) AND is_active = TRUE`
+
+// ReleaseContacts marks the given contacts as released. Callers should have already removed their URNs and group
+// memberships through the runner so that those changes have the usual events and hooks.
+func ReleaseContacts(ctx context.Context, db DBorTx, userID UserID, contactIDs []ContactID) error {
+	if _, err := db.ExecContext(ctx, sqlReleaseContacts, pq.Array(contactIDs), userID); err != nil {
+		return fmt.Errorf("error releasing contacts: %w", err)
+	}
+	return nil
+}
+
 type ContactURN struct {
 	ID         URNID            `json:"id"          db:"id"`
 	OrgID      OrgID            `                   db:"org_id"`
@@ -487,6 +547,7 @@ type contactEnvelope struct {
 		State    envs.LocationPath `json:"state,omitempty"`
 		District envs.LocationPath `json:"district,omitempty"`
 		Ward     envs.LocationPath `json:"ward,omitempty"`
+		Enc      string            `json:"enc,omitempty"` // value of a sensitive field is encrypted
 	} `json:"fields"`
 	GroupIDs []GroupID `json:"group_ids"`
 	Tickets  []struct {
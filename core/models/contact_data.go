@@ -0,0 +1,221 @@
+package models
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/nyaruka/gocommon/dates"
+	"github.com/nyaruka/gocommon/jsonx"
+	"github.com/nyaruka/gocommon/uuids"
+	"github.com/nyaruka/goflow/core"
+	"github.com/nyaruka/mailroom/v26/runtime"
+)
+
+// ContactData is everything we hold about a single contact, e.g. for a subject access request
+type ContactData struct {
+	Contact    json.RawMessage  `json:"contact"`
+	Tickets    json.RawMessage  `json:"tickets"`
+	Runs       json.RawMessage  `json:"runs"`
+	History    []map[string]any `json:"history"`
+	ExportedOn time.Time        `json:"exported_on"`
+}
+
+const sqlSelectContactTickets = `
+SELECT COALESCE(json_agg(row_to_json(r) ORDER BY r.opened_on), '[]'::json) FROM (
+    SELECT t.uuid, t.status, json_build_object('uuid', tp.uuid, 'name', tp.name) AS topic, t.opened_on, t.replied_on, t.closed_on
+      FROM tickets_ticket t
+INNER JOIN tickets_topic tp ON tp.id = t.topic_id
+     WHERE t.contact_id = $1
+) r`
+
+const sqlSelectContactRuns = `
+SELECT COALESCE(json_agg(row_to_json(r) ORDER BY r.created_on), '[]'::json) FROM (
+    SELECT r.uuid, json_build_object('uuid', f.uuid, 'name', f.name) AS flow, r.status, r.created_on, r.modified_on, r.exited_on, r.responded, r.results::jsonb AS results
+      FROM flows_flowrun r
+INNER JOIN flows_flow f ON f.id = r.flow_id
+     WHERE r.contact_id = $1
+) r`
+
+// LoadContactData loads the contact record, tickets, flow runs and full event history of the given contact
+func LoadContactData(ctx context.Context, rt *runtime.Runtime, oa *OrgAssets, contact *Contact) (*ContactData, error) {
+	ec, err := contact.EngineContact(oa)
+	if err != nil {
+		return nil, err
+	}
+
+	d := &ContactData{ExportedOn: dates.Now()}
+
+	if d.Contact, err = jsonx.Marshal(ec); err != nil {
+		return nil, fmt.Errorf("error marshaling contact: %w", err)
+	}
+	if err := rt.ReadonlyDB.QueryRowContext(ctx, sqlSelectContactTickets, contact.ID()).Scan(&d.Tickets); err != nil {
+		return nil, fmt.Errorf("error loading tickets for contact: %w", err)
+	}
+	if err := rt.ReadonlyDB.QueryRowContext(ctx, sqlSelectContactRuns, contact.ID()).Scan(&d.Runs); err != nil {
+		return nil, fmt.Errorf("error loading runs for contact: %w", err)
+	}
+	if d.History, err = LoadContactHistory(ctx, rt, oa.OrgID(), contact.UUID()); err != nil {
+		return nil, fmt.Errorf("error loading history for contact: %w", err)
+	}
+
+	return d, nil
+}
+
+// WriteContactData writes the given contact data to our private exports bucket as a JSON file, or if withAttachments is
+// set, as a zip file which also contains any message attachments stored in our attachments bucket. The file is written
+// to a temporary file first so that attachments needn't be held in memory. Returns the path of the written file.
+func WriteContactData(ctx context.Context, rt *runtime.Runtime, orgID OrgID, contact *Contact, d *ContactData, withAttachments bool) (string, error) {
+	dataJSON, err := jsonx.MarshalPretty(d)
+	if err != nil {
+		return "", fmt.Errorf("error marshaling contact data: %w", err)
+	}
+
+	file, err := os.CreateTemp("", "contact-data-*")
+	if err != nil {
+		return "", fmt.Errorf("error creating temporary file: %w", err)
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	basePath := contactDataPrefix(orgID, contact.UUID()) + string(uuids.NewV4())
+	filePath, contentType := basePath+".json", "application/json"
+
+	if withAttachments {
+		zw := zip.NewWriter(file)
+
+		if err := writeZipFile(zw, "contact.json", bytes.NewReader(dataJSON)); err != nil {
+			return "", err
+		}
+
+		for i, key := range historyAttachmentKeys(rt, d.History) {
+			obj, err := rt.S3.Client.GetObject(ctx, &s3.GetObjectInput{Bucket: aws.String(rt.Config.S3AttachmentsBucket), Key: aws.String(key)})
+			if err != nil {
+				return "", fmt.Errorf("error fetching attachment %s: %w", key, err)
+			}
+			err = writeZipFile(zw, fmt.Sprintf("attachments/%d-%s", i+1, path.Base(key)), obj.Body)
+			obj.Body.Close()
+			if err != nil {
+				return "", err
+			}
+		}
+
+		if err := zw.Close(); err != nil {
+			return "", fmt.Errorf("error writing contact data zip: %w", err)
+		}
+
+		filePath, contentType = basePath+".zip", "application/zip"
+	} else if _, err := file.Write(dataJSON); err != nil {
+		return "", fmt.Errorf("error writing contact data: %w", err)
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		return "", fmt.Errorf("error reading contact data file: %w", err)
+	}
+	if _, err := file.Seek(0, 0); err != nil {
+		return "", fmt.Errorf("error reading contact data file: %w", err)
+	}
+
+	_, err = rt.S3.Client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:        aws.String(rt.Config.S3ExportsBucket),
+		Key:           aws.String(filePath),
+		Body:          file,
+		ContentType:   aws.String(contentType),
+		ContentLength: aws.Int64(info.Size()),
+		ACL:           types.ObjectCannedACLPrivate,
+	})
+	if err != nil {
+		return "", fmt.Errorf("error uploading contact data: %w", err)
+	}
+
+	return filePath, nil
+}
+
+// gets the prefix under which the data exports of a contact are written
+func contactDataPrefix(orgID OrgID, contactUUID core.ContactUUID) string {
+	return fmt.Sprintf("contact_data/%d/%s/", orgID, contactUUID)
+}
+
+// DeleteContactData deletes all the data exports of the given contact, returning the number of files deleted
+func DeleteContactData(ctx context.Context, rt *runtime.Runtime, orgID OrgID, contactUUID core.ContactUUID) (int, error) {
+	numDeleted := 0
+
+	pager := s3.NewListObjectsV2Paginator(rt.S3.Client, &s3.ListObjectsV2Input{
+		Bucket: aws.String(rt.Config.S3ExportsBucket),
+		Prefix: aws.String(contactDataPrefix(orgID, contactUUID)),
+	})
+	for pager.HasMorePages() {
+		page, err := pager.NextPage(ctx)
+		if err != nil {
+			return 0, fmt.Errorf("error listing contact data: %w", err)
+		}
+		if len(page.Contents) == 0 {
+			continue
+		}
+
+		objects := make([]types.ObjectIdentifier, len(page.Contents))
+		for i, obj := range page.Contents {
+			objects[i] = types.ObjectIdentifier{Key: obj.Key}
+		}
+
+		resp, err := rt.S3.Client.DeleteObjects(ctx, &s3.DeleteObjectsInput{
+			Bucket: aws.String(rt.Config.S3ExportsBucket),
+			Delete: &types.Delete{Objects: objects, Quiet: aws.Bool(true)},
+		})
+		if err != nil {
+			return 0, fmt.Errorf("error deleting contact data: %w", err)
+		}
+		if len(resp.Errors) > 0 {
+			return 0, fmt.Errorf("error deleting contact data %s: %s", aws.ToString(resp.Errors[0].Key), aws.ToString(resp.Errors[0].Message))
+		}
+
+		numDeleted += len(objects)
+	}
+
+	return numDeleted, nil
+}
+
+// gets the keys of attachments on messages in a contact's history which are stored in our attachments bucket
+func historyAttachmentKeys(rt *runtime.Runtime, history []map[string]any) []string {
+	prefix := rt.S3.ObjectURL(rt.Config.S3AttachmentsBucket, "")
+	keys := make([]string, 0)
+	seen := make(map[string]bool)
+
+	for _, evt := range history {
+		msg, _ := evt["msg"].(map[string]any)
+		attachments, _ := msg["attachments"].([]any)
+
+		for _, a := range attachments {
+			s, _ := a.(string)
+			_, url, _ := strings.Cut(s, ":")
+
+			if key, ok := strings.CutPrefix(url, prefix); ok && key != "" && !seen[key] {
+				keys = append(keys, key)
+				seen[key] = true
+			}
+		}
+	}
+	return keys
+}
+
+func writeZipFile(zw *zip.Writer, name string, content io.Reader) error {
+	f, err := zw.Create(name)
+	if err != nil {
+		return fmt.Errorf("error creating %s in zip: %w", name, err)
+	}
+	if _, err := io.Copy(f, content); err != nil {
+		return fmt.Errorf("error writing %s to zip: %w", name, err)
+	}
+	return nil
+}
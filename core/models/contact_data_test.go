@@ -0,0 +1,122 @@
+package models_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/nyaruka/gocommon/aws/dynamo"
+	"github.com/nyaruka/goflow/core/events"
+	"github.com/nyaruka/mailroom/v26/core/models"
+	"github.com/nyaruka/mailroom/v26/testsuite"
+	"github.com/nyaruka/mailroom/v26/testsuite/testdb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type rawHistoryItem dynamo.Item
+
+func (i *rawHistoryItem) MarshalDynamo() (*dynamo.Item, error) { return (*dynamo.Item)(i), nil }
+
+func TestContactData(t *testing.T) {
+	ctx, rt := testsuite.Runtime(t)
+
+	oa := testdb.Org1.Load(t, rt)
+
+	testdb.InsertClosedTicket(t, rt, "01992f54-5ab6-717a-a39e-e8ca91fb7262", testdb.Org1, testdb.Ann, testdb.SupportTopic, nil)
+	sessionUUID := testdb.InsertFlowSession(t, rt, testdb.Ann, models.FlowTypeMessaging, models.SessionStatusCompleted, nil, testdb.Favorites)
+	testdb.InsertFlowRun(t, rt, testdb.Org1, sessionUUID, testdb.Ann, testdb.Favorites, models.RunStatusCompleted, "")
+
+	attachmentURL, err := rt.S3.PutObject(ctx, rt.Config.S3AttachmentsBucket, "attachments/1/photo.jpg", "image/jpeg", []byte("JPEG"), types.ObjectCannedACLPublicRead)
+	require.NoError(t, err)
+
+	// a msg event with an attachment in our bucket and one elsewhere, and a deletion tag on it
+	msgItem := &rawHistoryItem{
+		Key:   dynamo.Key{PK: "con#" + string(testdb.Ann.UUID), SK: "evt#0198ab67-9c2e-7b7a-a0b3-7e3e8d7a1a01"},
+		OrgID: int(testdb.Org1.ID),
+		Data: map[string]any{
+			"type":       "msg_received",
+			"created_on": "2025-05-04T12:30:45.123456789Z",
+			"msg":        map[string]any{"text": "Hi", "attachments": []any{"image/jpeg:" + attachmentURL, "image/png:https://example.com/other.png"}},
+		},
+	}
+	tagItem := &rawHistoryItem{
+		Key:   dynamo.Key{PK: "con#" + string(testdb.Ann.UUID), SK: "evt#0198ab67-9c2e-7b7a-a0b3-7e3e8d7a1a01#del"},
+		OrgID: int(testdb.Org1.ID),
+		Data:  map[string]any{"by_contact": true},
+	}
+	otherOrgItem := &rawHistoryItem{
+		Key:   dynamo.Key{PK: "con#" + string(testdb.Ann.UUID), SK: "evt#0198ab67-9c2e-7b7a-a0b3-7e3e8d7a1a02"},
+		OrgID: int(testdb.Org2.ID),
+		Data:  map[string]any{"type": "contact_name_changed", "name": "Other"},
+	}
+
+	// and a large event which will be compressed
+	nameEvent := &models.Event{Event: events.NewContactNameChanged(strings.Repeat("Ann", 400)), OrgID: testdb.Org1.ID, ContactUUID: testdb.Ann.UUID}
+
+	for _, item := range []dynamo.ItemMarshaler{msgItem, tagItem, otherOrgItem, nameEvent} {
+		_, err := rt.Dynamo.History.Queue(item)
+		require.NoError(t, err)
+	}
+	rt.Dynamo.History.Flush()
+
+	contact, err := models.LoadContact(ctx, rt.DB, oa, testdb.Ann.ID)
+	require.NoError(t, err)
+
+	data, err := models.LoadContactData(ctx, rt, oa, contact)
+	require.NoError(t, err)
+
+	assert.Contains(t, string(data.Contact), `"uuid":"a393abc0-283d-4c9b-a1b3-641a035c34bf"`)
+
+	var tickets, runs []map[string]any
+	require.NoError(t, json.Unmarshal(data.Tickets, &tickets))
+	require.NoError(t, json.Unmarshal(data.Runs, &runs))
+	assert.Len(t, tickets, 1)
+	assert.Equal(t, "01992f54-5ab6-717a-a39e-e8ca91fb7262", tickets[0]["uuid"])
+	assert.Equal(t, "Support", tickets[0]["topic"].(map[string]any)["name"])
+	assert.Len(t, runs, 1)
+	assert.Equal(t, "Favorites", runs[0]["flow"].(map[string]any)["name"])
+
+	require.Len(t, data.History, 2)
+	assert.Equal(t, "0198ab67-9c2e-7b7a-a0b3-7e3e8d7a1a01", data.History[0]["uuid"])
+	assert.Equal(t, "msg_received", data.History[0]["type"])
+	assert.Equal(t, map[string]any{"del": map[string]any{"by_contact": true}}, data.History[0]["tags"])
+	assert.Equal(t, string(nameEvent.UUID()), data.History[1]["uuid"])
+	assert.Equal(t, "contact_name_changed", data.History[1]["type"])
+	assert.Equal(t, strings.Repeat("Ann", 400), data.History[1]["name"])
+
+	// write as plain JSON
+	path, err := models.WriteContactData(ctx, rt, testdb.Org1.ID, contact, data, false)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(path, "contact_data/1/a393abc0-283d-4c9b-a1b3-641a035c34bf/"))
+	assert.True(t, strings.HasSuffix(path, ".json"))
+
+	contentType, body, err := rt.S3.GetObject(ctx, rt.Config.S3ExportsBucket, path)
+	require.NoError(t, err)
+	assert.Equal(t, "application/json", contentType)
+	assert.Contains(t, string(body), `"history": [`)
+
+	// write as zip with attachments from our bucket
+	path, err = models.WriteContactData(ctx, rt, testdb.Org1.ID, contact, data, true)
+	require.NoError(t, err)
+	assert.True(t, strings.HasSuffix(path, ".zip"))
+
+	_, body, err = rt.S3.GetObject(ctx, rt.Config.S3ExportsBucket, path)
+	require.NoError(t, err)
+
+	zr, err := zip.NewReader(bytes.NewReader(body), int64(len(body)))
+	require.NoError(t, err)
+	require.Len(t, zr.File, 2)
+	assert.Equal(t, "contact.json", zr.File[0].Name)
+	assert.Equal(t, "attachments/1-photo.jpg", zr.File[1].Name)
+
+	f, err := zr.File[1].Open()
+	require.NoError(t, err)
+	content, err := io.ReadAll(f)
+	require.NoError(t, err)
+	assert.Equal(t, "JPEG", string(content))
+}
@@ -0,0 +1,443 @@
+package models
+
+import (
+	"cmp"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"maps"
+	"math"
+	"net/mail"
+	"slices"
+	"strings"
+	"time"
+
+	valkey "github.com/gomodule/redigo/redis"
+	"github.com/lib/pq"
+	"github.com/nyaruka/gocommon/urns"
+	"github.com/nyaruka/mailroom/v26/runtime"
+)
+
+// how long the scan cursor is kept for an org which stops running duplicate detection, after which the next run is a
+// full scan
+const contactDuplicatesExpiry = time.Hour * 24 * 30
+
+// the maximum number of contacts with a single duplicate key for it to be used, beyond which it's too common to be
+// useful and would give us too many pairs
+const contactDuplicatesKeyMax = 100
+
+// the minimum number of digits for a phone number suffix to be considered a variant of another number, which lets us
+// match numbers in local format with ones in international format
+const phoneSuffixLength = 9
+
+// DuplicateReason is why two contacts are considered probable duplicates
+type DuplicateReason string
+
+const (
+	DuplicateReasonPhone      DuplicateReason = "phone"
+	DuplicateReasonEmail      DuplicateReason = "email"
+	DuplicateReasonNameFields DuplicateReason = "name_fields"
+)
+
+// how likely a single reason alone means two contacts are the same person
+var duplicateReasonScores = map[DuplicateReason]float64{
+	DuplicateReasonPhone:      0.9,
+	DuplicateReasonEmail:      0.9,
+	DuplicateReasonNameFields: 0.6,
+}
+
+// ContactDuplicate is a pair of contacts which are probably the same person
+type ContactDuplicate struct {
+	ContactIDs [2]ContactID      `json:"contact_ids"`
+	Score      float64           `json:"score"`
+	Reasons    []DuplicateReason `json:"reasons"`
+}
+
+func newContactDuplicate(id1, id2 ContactID, reasons []DuplicateReason) *ContactDuplicate {
+	if id1 > id2 {
+		id1, id2 = id2, id1
+	}
+
+	slices.Sort(reasons)
+	reasons = slices.Compact(reasons)
+
+	// each reason is treated as independent evidence so more reasons give a higher score
+	notDup := 1.0
+	for _, r := range reasons {
+		notDup *= 1 - duplicateReasonScores[r]
+	}
+
+	return &ContactDuplicate{ContactIDs: [2]ContactID{id1, id2}, Score: math.Round((1-notDup)*1000) / 1000, Reasons: reasons}
+}
+
+func comparePairs(a, b [2]ContactID) int {
+	return cmp.Or(cmp.Compare(a[0], b[0]), cmp.Compare(a[1], b[1]))
+}
+
+func contactDuplicatesStateKey(orgID OrgID) string {
+	return fmt.Sprintf("contact_dups_state:%d", orgID)
+}
+
+// duplicateKeys returns the keys which any other contact having would make them a probable duplicate of this contact,
+// mapped to the reason that would be
+func duplicateKeys(c *Contact) map[string]DuplicateReason {
+	keys := make(map[string]DuplicateReason)
+
+	for _, u := range c.urns {
+		scheme, path, _, _ := u.Identity.ToParts()
+
+		switch scheme {
+		case urns.Phone.Prefix, urns.WhatsApp.Prefix:
+			digits := strings.Map(func(r rune) rune {
+				if r >= '0' && r <= '9' {
+					return r
+				}
+				return -1
+			}, path)
+
+			if digits != "" {
+				keys["phone:"+digits] = DuplicateReasonPhone
+			}
+			if len(digits) >= phoneSuffixLength {
+				keys["phone:*"+digits[len(digits)-phoneSuffixLength:]] = DuplicateReasonPhone
+			}
+		case urns.Email.Prefix:
+			keys["email:"+strings.ToLower(path)] = DuplicateReasonEmail
+		}
+	}
+
+	// email addresses are often also saved in fields
+	fieldValues := make([]string, 0, len(c.fields))
+	for _, key := range slices.Sorted(maps.Keys(c.fields)) {
+		value := c.fields[key]
+		if value == nil || value.Text.Native() == "" {
+			continue
+		}
+
+		text := strings.ToLower(strings.TrimSpace(value.Text.Native()))
+		if strings.Contains(text, "@") {
+			if addr, err := mail.ParseAddress(text); err == nil {
+				keys["email:"+addr.Address] = DuplicateReasonEmail
+			}
+		}
+
+		fieldValues = append(fieldValues, key+"="+text)
+	}
+
+	name := duplicateName(c)
+	if name != "" && len(fieldValues) > 0 {
+		hash := sha256.Sum256([]byte(name + "\n" + strings.Join(fieldValues, "\n")))
+		keys["name_fields:"+hex.EncodeToString(hash[:16])] = DuplicateReasonNameFields
+	}
+
+	return keys
+}
+
+// ContactDuplicates are stored in the contacts_contactduplicate table with each pair ordered by contact id:
+//
+//	id, org_id, contact1_id, contact2_id, score, reasons, created_on, modified_on
+//	UNIQUE (contact1_id, contact2_id), INDEX (org_id, score DESC)
+type dbContactDuplicate struct {
+	OrgID      OrgID          `db:"org_id"`
+	Contact1ID ContactID      `db:"contact1_id"`
+	Contact2ID ContactID      `db:"contact2_id"`
+	Score      float64        `db:"score"`
+	Reasons    pq.StringArray `db:"reasons"`
+}
+
+// finds every contact in the org which could share a key with the given contacts, so the candidates are a superset of
+// the actual duplicates, and the keys of each candidate are then compared exactly
+const sqlSelectContactDuplicateCandidates = `
+SELECT contact_id FROM contacts_contacturn
+ WHERE org_id = $1 AND identity = ANY($2) AND contact_id IS NOT NULL
+ UNION
+SELECT contact_id FROM contacts_contacturn
+ WHERE org_id = $1 AND scheme IN ('tel', 'whatsapp') AND right(regexp_replace(path, '\D', '', 'g'), $3) = ANY($4) AND contact_id IS NOT NULL
+ UNION
+SELECT id FROM contacts_contact
+ WHERE org_id = $1 AND is_active = TRUE AND lower(regexp_replace(btrim(name), '\s+', ' ', 'g')) = ANY($5)
+ UNION
+SELECT c.id FROM contacts_contact c, jsonb_each(c.fields) f
+ WHERE c.org_id = $1 AND c.is_active = TRUE AND lower(btrim(f.value->>'text')) = ANY($6)`
+
+const sqlDeleteContactDuplicatesForContacts = `
+DELETE FROM contacts_contactduplicate WHERE org_id = $1 AND (contact1_id = ANY($2) OR contact2_id = ANY($2))`
+
+const sqlInsertContactDuplicates = `
+INSERT INTO contacts_contactduplicate( org_id,  contact1_id,  contact2_id,  score,  reasons, created_on, modified_on)
+                               VALUES(:org_id, :contact1_id, :contact2_id, :score, :reasons, NOW(),      NOW())
+ON CONFLICT (contact1_id, contact2_id) DO UPDATE SET score = EXCLUDED.score, reasons = EXCLUDED.reasons, modified_on = NOW()`
+
+// normalizes the name of a contact for comparison, which must match how names are normalized in SQL
+func duplicateName(c *Contact) string {
+	return strings.Join(strings.Fields(strings.ToLower(c.name)), " ")
+}
+
+// RecordContactDuplicates finds probable duplicates of the given contacts among all the contacts in the org and saves
+// them as candidate pairs, replacing any previous pairs for those contacts. Returns the number of pairs found.
+func RecordContactDuplicates(ctx context.Context, rt *runtime.Runtime, oa *OrgAssets, contacts []*Contact) (int, error) {
+	if len(contacts) == 0 {
+		return 0, nil
+	}
+
+	contactIDs := make([]ContactID, len(contacts))
+	contactKeys := make(map[ContactID]map[string]DuplicateReason, len(contacts))
+	for i, c := range contacts {
+		contactIDs[i] = c.ID()
+		contactKeys[c.ID()] = duplicateKeys(c)
+	}
+
+	candidateIDs, err := findDuplicateCandidates(ctx, rt, oa.OrgID(), contacts, contactKeys)
+	if err != nil {
+		return 0, err
+	}
+
+	// load any candidates we don't already have and work out their keys too
+	candidateIDs = slices.DeleteFunc(candidateIDs, func(id ContactID) bool {
+		_, has := contactKeys[id]
+		return has
+	})
+	candidates, err := LoadContacts(ctx, rt.ReadonlyDB, oa, candidateIDs)
+	if err != nil {
+		return 0, fmt.Errorf("error loading duplicate candidates: %w", err)
+	}
+
+	allKeys := maps.Clone(contactKeys)
+	for _, c := range candidates {
+		allKeys[c.ID()] = duplicateKeys(c)
+	}
+
+	members := make(map[string][]ContactID)
+	for _, id := range slices.Sorted(maps.Keys(allKeys)) {
+		for k := range allKeys[id] {
+			members[k] = append(members[k], id)
+		}
+	}
+
+	// pair each contact with every other contact which has one of its keys, ignoring keys too common to be useful
+	pairReasons := make(map[[2]ContactID][]DuplicateReason)
+
+	for _, c := range contacts {
+		for k, reason := range contactKeys[c.ID()] {
+			if len(members[k]) > contactDuplicatesKeyMax {
+				continue
+			}
+			for _, other := range members[k] {
+				if other != c.ID() {
+					pair := [2]ContactID{min(other, c.ID()), max(other, c.ID())}
+					pairReasons[pair] = append(pairReasons[pair], reason)
+				}
+			}
+		}
+	}
+
+	dbDups := make([]*dbContactDuplicate, 0, len(pairReasons))
+	for _, pair := range slices.SortedFunc(maps.Keys(pairReasons), comparePairs) {
+		dup := newContactDuplicate(pair[0], pair[1], pairReasons[pair])
+		reasons := make([]string, len(dup.Reasons))
+		for i, r := range dup.Reasons {
+			reasons[i] = string(r)
+		}
+		dbDups = append(dbDups, &dbContactDuplicate{OrgID: oa.OrgID(), Contact1ID: pair[0], Contact2ID: pair[1], Score: dup.Score, Reasons: reasons})
+	}
+
+	tx, err := rt.DB.BeginTxx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("error beginning transaction: %w", err)
+	}
+
+	if _, err := tx.ExecContext(ctx, sqlDeleteContactDuplicatesForContacts, oa.OrgID(), pq.Array(contactIDs)); err != nil {
+		tx.Rollback()
+		return 0, fmt.Errorf("error deleting previous contact duplicates: %w", err)
+	}
+	if err := BulkQueryBatches(ctx, "inserted contact duplicates", tx, sqlInsertContactDuplicates, 1000, dbDups); err != nil {
+		tx.Rollback()
+		return 0, fmt.Errorf("error inserting contact duplicates: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("error committing contact duplicates: %w", err)
+	}
+
+	return len(dbDups), nil
+}
+
+// finds the ids of all contacts in the org which could share one of the keys of the given contacts
+func findDuplicateCandidates(ctx context.Context, rt *runtime.Runtime, orgID OrgID, contacts []*Contact, contactKeys map[ContactID]map[string]DuplicateReason) ([]ContactID, error) {
+	var identities, phones, names, emails []string
+
+	for _, c := range contacts {
+		for k, reason := range contactKeys[c.ID()] {
+			if reason == DuplicateReasonNameFields {
+				names = append(names, duplicateName(c))
+				continue
+			}
+
+			typ, value, _ := strings.Cut(k, ":")
+
+			switch typ {
+			case "phone":
+				if suffix, isSuffix := strings.CutPrefix(value, "*"); isSuffix {
+					phones = append(phones, suffix)
+				} else if len(value) < phoneSuffixLength {
+					phones = append(phones, value) // short numbers can only match exactly
+				}
+			case "email":
+				identities = append(identities, urns.Email.Prefix+":"+value)
+				emails = append(emails, value)
+			}
+		}
+	}
+
+	return queryContactIDs(ctx, rt.ReadonlyDB, sqlSelectContactDuplicateCandidates, orgID, pq.Array(identities), phoneSuffixLength, pq.Array(phones), pq.Array(names), pq.Array(emails))
+}
+
+const sqlSelectContactDuplicatesPage = `
+SELECT contact1_id, contact2_id FROM contacts_contactduplicate WHERE org_id = $1 ORDER BY score DESC, contact1_id, contact2_id OFFSET $2 LIMIT $3`
+
+const sqlDeleteContactDuplicates = `
+DELETE FROM contacts_contactduplicate WHERE org_id = $1 AND (contact1_id, contact2_id) IN (SELECT unnest($2::int[]), unnest($3::int[]))`
+
+// GetContactDuplicates returns up to limit of the highest scoring duplicate pairs for the org. Pairs are re-checked
+// against the current state of both contacts, and any which no longer match or include a released contact are removed.
+func GetContactDuplicates(ctx context.Context, rt *runtime.Runtime, oa *OrgAssets, limit int) ([]*ContactDuplicate, error) {
+	duplicates := make([]*ContactDuplicate, 0, limit)
+
+	for offset := 0; len(duplicates) < limit; offset += limit {
+		pairs, err := getContactDuplicatePairs(ctx, rt.DB, oa.OrgID(), offset, limit)
+		if err != nil {
+			return nil, err
+		}
+		if len(pairs) == 0 {
+			break
+		}
+
+		contactIDs := make([]ContactID, 0, len(pairs)*2)
+		for _, pair := range pairs {
+			contactIDs = append(contactIDs, pair[0], pair[1])
+		}
+
+		contacts, err := LoadContacts(ctx, rt.ReadonlyDB, oa, contactIDs)
+		if err != nil {
+			return nil, fmt.Errorf("error loading contacts: %w", err)
+		}
+
+		byID := make(map[ContactID]*Contact, len(contacts))
+		for _, c := range contacts {
+			byID[c.ID()] = c
+		}
+
+		var stale1, stale2 []ContactID
+
+		for _, pair := range pairs {
+			c1, c2 := byID[pair[0]], byID[pair[1]]
+			if c1 == nil || c2 == nil {
+				stale1, stale2 = append(stale1, pair[0]), append(stale2, pair[1])
+				continue
+			}
+
+			keys1, keys2 := duplicateKeys(c1), duplicateKeys(c2)
+			var reasons []DuplicateReason
+			for k, reason := range keys1 {
+				if _, ok := keys2[k]; ok {
+					reasons = append(reasons, reason)
+				}
+			}
+			if len(reasons) == 0 {
+				stale1, stale2 = append(stale1, pair[0]), append(stale2, pair[1])
+				continue
+			}
+
+			if len(duplicates) < limit {
+				duplicates = append(duplicates, newContactDuplicate(pair[0], pair[1], reasons))
+			}
+		}
+
+		if len(stale1) > 0 {
+			if _, err := rt.DB.ExecContext(ctx, sqlDeleteContactDuplicates, oa.OrgID(), pq.Array(stale1), pq.Array(stale2)); err != nil {
+				return nil, fmt.Errorf("error removing stale contact duplicates: %w", err)
+			}
+			offset -= len(stale1) // removed pairs no longer take up space in the table
+		}
+	}
+
+	// re-checking can change scores so re-sort
+	slices.SortFunc(duplicates, func(a, b *ContactDuplicate) int {
+		return cmp.Or(cmp.Compare(b.Score, a.Score), comparePairs(a.ContactIDs, b.ContactIDs))
+	})
+
+	return duplicates, nil
+}
+
+func getContactDuplicatePairs(ctx context.Context, db Queryer, orgID OrgID, offset, limit int) ([][2]ContactID, error) {
+	rows, err := db.QueryContext(ctx, sqlSelectContactDuplicatesPage, orgID, offset, limit)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching contact duplicates: %w", err)
+	}
+	defer rows.Close()
+
+	pairs := make([][2]ContactID, 0, limit)
+	for rows.Next() {
+		var pair [2]ContactID
+		if err := rows.Scan(&pair[0], &pair[1]); err != nil {
+			return nil, fmt.Errorf("error scanning contact duplicate: %w", err)
+		}
+		pairs = append(pairs, pair)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error fetching contact duplicates: %w", err)
+	}
+	return pairs, nil
+}
+
+// GetContactDuplicatesScannedOn returns when the last complete duplicate detection run for the org started, or the
+// zero time if there hasn't been one
+func GetContactDuplicatesScannedOn(ctx context.Context, rt *runtime.Runtime, orgID OrgID) (time.Time, error) {
+	vc := rt.VK.Get()
+	defer vc.Close()
+
+	value, err := valkey.String(valkey.DoContext(vc, ctx, "HGET", contactDuplicatesStateKey(orgID), "scanned_on"))
+	if err == valkey.ErrNil {
+		return time.Time{}, nil
+	} else if err != nil {
+		return time.Time{}, fmt.Errorf("error getting contact duplicates state: %w", err)
+	}
+
+	t, err := time.Parse(time.RFC3339Nano, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid contact duplicates state: %w", err)
+	}
+	return t, nil
+}
+
+// SetContactDuplicatesScannedOn records when a complete duplicate detection run for the org started
+func SetContactDuplicatesScannedOn(ctx context.Context, rt *runtime.Runtime, orgID OrgID, t time.Time) error {
+	vc := rt.VK.Get()
+	defer vc.Close()
+
+	key := contactDuplicatesStateKey(orgID)
+
+	vc.Send("MULTI")
+	vc.Send("HSET", key, "scanned_on", t.UTC().Format(time.RFC3339Nano))
+	vc.Send("EXPIRE", key, int(contactDuplicatesExpiry/time.Second))
+
+	if _, err := valkey.DoContext(vc, ctx, "EXEC"); err != nil {
+		return fmt.Errorf("error setting contact duplicates state: %w", err)
+	}
+	return nil
+}
+
+// ResetContactDuplicates deletes all duplicate pairs and the scan cursor for the org so that the next run is a full scan
+func ResetContactDuplicates(ctx context.Context, rt *runtime.Runtime, orgID OrgID) error {
+	if _, err := rt.DB.ExecContext(ctx, `DELETE FROM contacts_contactduplicate WHERE org_id = $1`, orgID); err != nil {
+		return fmt.Errorf("error deleting contact duplicates: %w", err)
+	}
+
+	vc := rt.VK.Get()
+	defer vc.Close()
+
+	if _, err := valkey.DoContext(vc, ctx, "DEL", contactDuplicatesStateKey(orgID)); err != nil {
+		return fmt.Errorf("error resetting contact duplicates state: %w", err)
+	}
+	return nil
+}
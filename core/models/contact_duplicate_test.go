@@ -0,0 +1,108 @@
+package models_test
+
+import (
+	"testing"
+
+	"github.com/nyaruka/gocommon/dbutil/assertdb"
+	"github.com/nyaruka/gocommon/urns"
+	"github.com/nyaruka/mailroom/v26/core/models"
+	"github.com/nyaruka/mailroom/v26/testsuite"
+	"github.com/nyaruka/mailroom/v26/testsuite/testdb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestContactDuplicates(t *testing.T) {
+	ctx, rt := testsuite.Runtime(t)
+
+	// Cat has Ann's number as a WhatsApp URN, and Bob and Dan have the same name and field values, one of which is an email
+	testdb.InsertContactURN(t, rt, testdb.Org1, testdb.Cat, urns.URN("whatsapp:16055741111"), 999, nil)
+	rt.DB.MustExec(`UPDATE contacts_contact SET name = '', fields = '{}' WHERE org_id = $1`, testdb.Org1.ID)
+	rt.DB.MustExec(`UPDATE contacts_contact SET name = 'Bob Smith', fields = '{"3a5891e4-756e-4dc9-8e12-b7a766168824": {"text": "M"}, "903f51da-2717-47c7-a0d3-f2f32877013d": {"text": "Bob@Example.com"}}' WHERE id = $1`, testdb.Bob.ID)
+	rt.DB.MustExec(`UPDATE contacts_contact SET name = 'bob  SMITH', fields = '{"3a5891e4-756e-4dc9-8e12-b7a766168824": {"text": "m"}, "903f51da-2717-47c7-a0d3-f2f32877013d": {"text": " bob@example.com"}}' WHERE id = $1`, testdb.Dan.ID)
+
+	oa := testdb.Org1.Load(t, rt)
+
+	dups, err := models.GetContactDuplicates(ctx, rt, oa, 10)
+	require.NoError(t, err)
+	assert.Len(t, dups, 0)
+
+	contacts, err := models.LoadContacts(ctx, rt.DB, oa, []models.ContactID{testdb.Ann.ID, testdb.Bob.ID, testdb.Cat.ID})
+	require.NoError(t, err)
+
+	// contacts are matched against every contact in the org, so Bob is paired with Dan even though Dan isn't recorded
+	found, err := models.RecordContactDuplicates(ctx, rt, oa, contacts)
+	require.NoError(t, err)
+	assert.Equal(t, 2, found)
+
+	contacts, err = models.LoadContacts(ctx, rt.DB, oa, []models.ContactID{testdb.Dan.ID})
+	require.NoError(t, err)
+
+	found, err = models.RecordContactDuplicates(ctx, rt, oa, contacts)
+	require.NoError(t, err)
+	assert.Equal(t, 1, found)
+
+	// re-recording a contact doesn't pair it with itself
+	found, err = models.RecordContactDuplicates(ctx, rt, oa, contacts)
+	require.NoError(t, err)
+	assert.Equal(t, 1, found)
+
+	dups, err = models.GetContactDuplicates(ctx, rt, oa, 10)
+	require.NoError(t, err)
+	assert.Equal(t, []*models.ContactDuplicate{
+		{ContactIDs: [2]models.ContactID{testdb.Bob.ID, testdb.Dan.ID}, Score: 0.96, Reasons: []models.DuplicateReason{"email", "name_fields"}},
+		{ContactIDs: [2]models.ContactID{testdb.Ann.ID, testdb.Cat.ID}, Score: 0.9, Reasons: []models.DuplicateReason{"phone"}},
+	}, dups)
+
+	dups, err = models.GetContactDuplicates(ctx, rt, oa, 1)
+	require.NoError(t, err)
+	assert.Len(t, dups, 1)
+	assert.Equal(t, [2]models.ContactID{testdb.Bob.ID, testdb.Dan.ID}, dups[0].ContactIDs)
+
+	// if Dan changes his name, he's still a duplicate because of his email, and if Cat is released, her pair is removed
+	rt.DB.MustExec(`UPDATE contacts_contact SET name = 'Dan' WHERE id = $1`, testdb.Dan.ID)
+	rt.DB.MustExec(`UPDATE contacts_contact SET is_active = FALSE WHERE id = $1`, testdb.Cat.ID)
+
+	dups, err = models.GetContactDuplicates(ctx, rt, oa, 10)
+	require.NoError(t, err)
+	assert.Equal(t, []*models.ContactDuplicate{
+		{ContactIDs: [2]models.ContactID{testdb.Bob.ID, testdb.Dan.ID}, Score: 0.9, Reasons: []models.DuplicateReason{"email"}},
+	}, dups)
+
+	assertdb.Query(t, rt.DB, `SELECT count(*) FROM contacts_contactduplicate WHERE org_id = $1`, testdb.Org1.ID).Returns(1)
+
+	scannedOn, err := models.GetContactDuplicatesScannedOn(ctx, rt, testdb.Org1.ID)
+	require.NoError(t, err)
+	assert.True(t, scannedOn.IsZero())
+
+	require.NoError(t, models.ResetContactDuplicates(ctx, rt, testdb.Org1.ID))
+
+	dups, err = models.GetContactDuplicates(ctx, rt, oa, 10)
+	require.NoError(t, err)
+	assert.Len(t, dups, 0)
+
+	// if Ann, Bob and Cat all share a number, each is paired with every other contact regardless of recording order
+	rt.DB.MustExec(`UPDATE contacts_contact SET is_active = TRUE WHERE id = $1`, testdb.Cat.ID)
+	testdb.InsertContactURN(t, rt, testdb.Org1, testdb.Bob, urns.URN("tel:16055741111"), 998, nil)
+
+	recordOne := func(contactID models.ContactID) int {
+		contacts, err := models.LoadContacts(ctx, rt.DB, oa, []models.ContactID{contactID})
+		require.NoError(t, err)
+
+		found, err := models.RecordContactDuplicates(ctx, rt, oa, contacts)
+		require.NoError(t, err)
+		return found
+	}
+
+	assert.Equal(t, 2, recordOne(testdb.Ann.ID))
+	assert.Equal(t, 3, recordOne(testdb.Bob.ID)) // Bob also still shares an email with Dan
+	assert.Equal(t, 2, recordOne(testdb.Cat.ID))
+
+	// if Cat loses the number, her pairs are removed when she's re-recorded
+	rt.DB.MustExec(`DELETE FROM contacts_contacturn WHERE contact_id = $1 AND identity = 'whatsapp:16055741111'`, testdb.Cat.ID)
+
+	assert.Equal(t, 0, recordOne(testdb.Cat.ID))
+	assert.Equal(t, 2, recordOne(testdb.Bob.ID))
+
+	assertdb.Query(t, rt.DB, `SELECT count(*) FROM contacts_contactduplicate WHERE org_id = $1 AND $2 IN (contact1_id, contact2_id)`, testdb.Org1.ID, testdb.Cat.ID).Returns(0)
+}
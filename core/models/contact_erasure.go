@@ -0,0 +1,81 @@
+package models
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/nyaruka/gocommon/aws/dynamo"
+	"github.com/nyaruka/gocommon/dates"
+	"github.com/nyaruka/goflow/core"
+	"github.com/nyaruka/mailroom/v26/runtime"
+)
+
+// ContactErasure is the receipt we keep when all the data of a contact is erased
+type ContactErasure struct {
+	OrgID        OrgID
+	ContactUUID  core.ContactUUID
+	UserID       UserID
+	HistoryItems int
+	FieldChanges int
+	Attachments  int
+	DataExports  int
+	HTTPLogs     int
+	ErasedOn     time.Time
+}
+
+// NewContactErasure creates a new erasure receipt for the given contact
+func NewContactErasure(orgID OrgID, contactUUID core.ContactUUID, userID UserID) *ContactErasure {
+	return &ContactErasure{OrgID: orgID, ContactUUID: contactUUID, UserID: userID, ErasedOn: dates.Now()}
+}
+
+// DynamoKey returns the PK+SK combo used for persistence
+func (e *ContactErasure) DynamoKey() dynamo.Key {
+	return dynamo.Key{PK: fmt.Sprintf("org#%d", e.OrgID), SK: fmt.Sprintf("era#%s", e.ContactUUID)}
+}
+
+func (e *ContactErasure) MarshalDynamo() (*dynamo.Item, error) {
+	return &dynamo.Item{
+		Key:   e.DynamoKey(),
+		OrgID: int(e.OrgID),
+		Data: map[string]any{
+			"user_id":       int(e.UserID),
+			"history_items": e.HistoryItems,
+			"field_changes": e.FieldChanges,
+			"attachments":   e.Attachments,
+			"data_exports":  e.DataExports,
+			"http_logs":     e.HTTPLogs,
+			"erased_on":     e.ErasedOn,
+		},
+	}, nil
+}
+
+// DeleteContactAttachments deletes the attachments on messages in the given contact history which are stored in our
+// attachments bucket, returning the number of attachments deleted
+func DeleteContactAttachments(ctx context.Context, rt *runtime.Runtime, history []map[string]any) (int, error) {
+	keys := historyAttachmentKeys(rt, history)
+
+	for batch := range slices.Chunk(keys, 1000) {
+		objects := make([]types.ObjectIdentifier, len(batch))
+		for i, key := range batch {
+			objects[i] = types.ObjectIdentifier{Key: aws.String(key)}
+		}
+
+		resp, err := rt.S3.Client.DeleteObjects(ctx, &s3.DeleteObjectsInput{
+			Bucket: aws.String(rt.Config.S3AttachmentsBucket),
+			Delete: &types.Delete{Objects: objects, Quiet: aws.Bool(true)},
+		})
+		if err != nil {
+			return 0, fmt.Errorf("error deleting attachments: %w", err)
+		}
+		if len(resp.Errors) > 0 {
+			return 0, fmt.Errorf("error deleting attachment %s: %s", aws.ToString(resp.Errors[0].Key), aws.ToString(resp.Errors[0].Message))
+		}
+	}
+
+	return len(keys), nil
+}
@@ -3,6 +3,7 @@ package models
 import (
 	"context"
 	"fmt"
+	"slices"
 	"time"
 
 	"github.com/lib/pq"
@@ -20,6 +21,8 @@ const (
 	ContactFireTypeWaitExpiration    ContactFireType = "E"
 	ContactFireTypeSessionExpiration ContactFireType = "S"
 	ContactFireTypeCampaignPoint     ContactFireType = "C"
+	ContactFireTypeDripStep          ContactFireType = "Q"
+	ContactFireTypeBroadcast         ContactFireType = "B"
 )
 
 type ContactFire struct {
@@ -53,6 +56,29 @@ func NewContactFireForCampaign(orgID OrgID, contactID ContactID, ce *CampaignPoi
 	return newContactFire(orgID, contactID, ContactFireTypeCampaignPoint, fmt.Sprintf("%d:%d", ce.ID, ce.FireVersion), fireOn, "", "")
 }
 
+func NewContactFireForDripStep(orgID OrgID, contactID ContactID, seq *DripSequence, step int, fireOn time.Time) *ContactFire {
+	return newContactFire(orgID, contactID, ContactFireTypeDripStep, fmt.Sprintf("%s:%d", seq.UUID, step), fireOn, "", "")
+}
+
+// NewContactFireForBroadcast creates a fire for a deferred send of a broadcast to a contact in the given batch, whose
+// scope is the broadcast id, followed by the UUID of the batch's variant if it has one, a created suffix if the contact
+// was created resolving the broadcast's recipients, and a capped suffix if the contact has already been counted as
+// capped by a frequency cap, e.g. 123, 123:<uuid>, 123:<uuid>:created or 123:created:capped
+func NewContactFireForBroadcast(orgID OrgID, contactID ContactID, batch *BroadcastBatch, fireOn time.Time) *ContactFire {
+	scope := fmt.Sprint(batch.BroadcastID)
+	if batch.Variant != nil {
+		scope += ":" + string(batch.Variant.UUID)
+	}
+	if slices.Contains(batch.CreatedContactIDs, contactID) {
+		scope += ":created"
+	}
+	if slices.Contains(batch.CappedContactIDs, contactID) {
+		scope += ":capped"
+	}
+
+	return newContactFire(orgID, contactID, ContactFireTypeBroadcast, scope, fireOn, "", "")
+}
+
 const sqlSelectDueContactFires = `
   SELECT id, org_id, contact_id, fire_type, scope, session_uuid, sprint_uuid, fire_on
     FROM contacts_contactfire
@@ -0,0 +1,222 @@
+package models
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/nyaruka/gocommon/jsonx"
+	"github.com/nyaruka/gocommon/uuids"
+	"github.com/nyaruka/goflow/assets"
+)
+
+// DripSequenceUUID is the UUID of a drip sequence
+type DripSequenceUUID uuids.UUID
+
+const configDripSequences = "drip_sequences"
+
+// DripSequence is a sequence of flows which contacts are taken through one step at a time, with each step scheduled
+// relative to when the previous step was sent, until they reach the end or meet one of its exit conditions. Orgs
+// define sequences in the drip_sequences config key, e.g. {"<uuid>": {"name": "Onboarding", "steps": [{"offset": 1,
+// "unit": "D", "flow_uuid": "<flow-uuid>"}], "exit": {"replied": true, "group_uuid": "<group-uuid>", "field_key": "registered"}}}.
+type DripSequence struct {
+	UUID  DripSequenceUUID `json:"-"`
+	Name  string           `json:"name"`
+	Steps []*DripStep      `json:"steps"`
+	Exit  DripExit         `json:"exit"`
+}
+
+// DripStep is a step in a drip sequence
+type DripStep struct {
+	Offset    int             `json:"offset"`
+	Unit      PointUnit       `json:"unit"`
+	FlowUUID  assets.FlowUUID `json:"flow_uuid"`
+	StartMode StartMode       `json:"start_mode,omitempty"`
+}
+
+// DripExit is the conditions on which a contact leaves a drip sequence, checked when each step is due. A contact has
+// replied if they've sent a message since the previous step was sent, or since they were enrolled for the first step.
+type DripExit struct {
+	Replied   bool             `json:"replied,omitempty"`
+	GroupUUID assets.GroupUUID `json:"group_uuid,omitempty"`
+	FieldKey  string           `json:"field_key,omitempty"`
+}
+
+// DripSequence returns the drip sequence with the given UUID configured for this org, or nil if there isn't one
+func (o *Org) DripSequence(uuid DripSequenceUUID) *DripSequence {
+	raw, ok := o.o.Config[configDripSequences]
+	if !ok || raw == nil {
+		return nil
+	}
+
+	sequences := make(map[DripSequenceUUID]*DripSequence)
+	if err := jsonx.Unmarshal(jsonx.MustMarshal(raw), &sequences); err != nil {
+		slog.Error("invalid drip sequences in org config", "org_id", o.ID(), "error", err)
+		return nil
+	}
+
+	s := sequences[uuid]
+	if s == nil {
+		return nil
+	}
+
+	s.UUID = uuid
+	for _, step := range s.Steps {
+		if step.StartMode == "" {
+			step.StartMode = StartModeInterrupt
+		}
+	}
+	return s
+}
+
+// FireOn returns when this step should fire if the previous step was sent at the given time
+func (s *DripStep) FireOn(from time.Time) time.Time {
+	return addPointOffset(from, s.Offset, s.Unit)
+}
+
+// EnrollInDripSequence enrolls those of the given contacts which are active in the org in the given sequence by
+// scheduling its first step, replacing any existing enrollment in that sequence, and returns the IDs of those enrolled
+func EnrollInDripSequence(ctx context.Context, db DBorTx, oa *OrgAssets, seq *DripSequence, contactIDs []ContactID, now time.Time) ([]ContactID, error) {
+	enrolled, err := selectDripEligible(ctx, db, oa, contactIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := DeleteDripSequenceFires(ctx, db, seq, enrolled); err != nil {
+		return nil, err
+	}
+	if err := insertDripStepFires(ctx, db, oa, seq, 0, enrolled, now); err != nil {
+		return nil, err
+	}
+
+	return enrolled, nil
+}
+
+// ScheduleDripStep schedules the given step of the given sequence for those of the given contacts which are still
+// active in the org, relative to the given time at which the previous step was sent. Does nothing if the sequence has
+// no such step.
+func ScheduleDripStep(ctx context.Context, db DBorTx, oa *OrgAssets, seq *DripSequence, step int, contactIDs []ContactID, from time.Time) error {
+	if step >= len(seq.Steps) {
+		return nil
+	}
+
+	eligible, err := selectDripEligible(ctx, db, oa, contactIDs)
+	if err != nil {
+		return err
+	}
+
+	return insertDripStepFires(ctx, db, oa, seq, step, eligible, from)
+}
+
+// selects those of the given contacts which are active in the org and so can be taken through a drip sequence
+func selectDripEligible(ctx context.Context, db DBorTx, oa *OrgAssets, contactIDs []ContactID) ([]ContactID, error) {
+	eligible := make([]ContactID, 0, len(contactIDs))
+	if err := db.SelectContext(ctx, &eligible, `SELECT id FROM contacts_contact WHERE id = ANY($1) AND org_id = $2 AND is_active = TRUE AND status = 'A' ORDER BY id`, pq.Array(contactIDs), oa.OrgID()); err != nil {
+		return nil, fmt.Errorf("error selecting contacts eligible for drip sequence: %w", err)
+	}
+	return eligible, nil
+}
+
+func insertDripStepFires(ctx context.Context, db DBorTx, oa *OrgAssets, seq *DripSequence, step int, contactIDs []ContactID, from time.Time) error {
+	fireOn := seq.Steps[step].FireOn(from)
+	fires := make([]*ContactFire, len(contactIDs))
+	for i, contactID := range contactIDs {
+		fires[i] = NewContactFireForDripStep(oa.OrgID(), contactID, seq, step, fireOn)
+	}
+
+	if err := InsertContactFires(ctx, db, fires); err != nil {
+		return fmt.Errorf("error inserting fires for step %d of drip sequence %s: %w", step, seq.UUID, err)
+	}
+	return nil
+}
+
+// DeleteDripSequenceFires deletes all fires for the given sequence for the given contacts
+func DeleteDripSequenceFires(ctx context.Context, db DBorTx, seq *DripSequence, contactIDs []ContactID) error {
+	_, err := db.ExecContext(ctx, `DELETE FROM contacts_contactfire WHERE contact_id = ANY($1) AND fire_type = 'Q' AND scope LIKE $2`, pq.Array(contactIDs), fmt.Sprintf("%s:%%", seq.UUID))
+	if err != nil {
+		return fmt.Errorf("error deleting drip sequence fires: %w", err)
+	}
+	return nil
+}
+
+const sqlSelectDripExitInfo = `
+SELECT c.id,
+       (SELECT max(m.created_on) FROM msgs_msg m WHERE m.contact_id = c.id AND m.direction = 'I' AND m.created_on > $4) AS replied_on,
+       EXISTS(SELECT 1 FROM contacts_contactgroup_contacts gc WHERE gc.contact_id = c.id AND gc.contactgroup_id = $2) AS in_group,
+       c.fields->$3 IS NOT NULL AS has_field
+  FROM contacts_contact c
+ WHERE c.id = ANY($1) AND c.is_active = TRUE AND c.status = 'A'`
+
+// FilterDripExits returns those of the given due fires for the given step of the given sequence whose contacts are
+// still active and haven't met any of its exit conditions
+func FilterDripExits(ctx context.Context, db Queryer, oa *OrgAssets, seq *DripSequence, step int, fires []*ContactFire) ([]*ContactFire, error) {
+	var groupID GroupID
+	if g := oa.GroupByUUID(seq.Exit.GroupUUID); g != nil {
+		groupID = g.ID()
+	}
+	var fieldUUID assets.FieldUUID
+	if f := oa.FieldByKey(seq.Exit.FieldKey); f != nil {
+		fieldUUID = f.UUID()
+	}
+
+	// work back from when this step is due to when the previous step was sent
+	sentOn := func(f *ContactFire) time.Time {
+		return addPointOffset(f.FireOn, -seq.Steps[step].Offset, seq.Steps[step].Unit)
+	}
+
+	// only look for replies since the earliest of those, and not at all if replying isn't an exit condition
+	var repliedSince *time.Time
+	contactIDs := make([]ContactID, len(fires))
+	for i, f := range fires {
+		contactIDs[i] = f.ContactID
+
+		if s := sentOn(f); seq.Exit.Replied && (repliedSince == nil || s.Before(*repliedSince)) {
+			repliedSince = &s
+		}
+	}
+
+	rows, err := db.QueryContext(ctx, sqlSelectDripExitInfo, pq.Array(contactIDs), groupID, fieldUUID, repliedSince)
+	if err != nil {
+		return nil, fmt.Errorf("error querying drip sequence exits: %w", err)
+	}
+	defer rows.Close()
+
+	type exitInfo struct {
+		repliedOn *time.Time // last incoming message
+		inGroup   bool
+		hasField  bool
+	}
+	infos := make(map[ContactID]*exitInfo, len(contactIDs))
+
+	for rows.Next() {
+		var contactID ContactID
+		info := &exitInfo{}
+		if err := rows.Scan(&contactID, &info.repliedOn, &info.inGroup, &info.hasField); err != nil {
+			return nil, fmt.Errorf("error scanning drip sequence exit: %w", err)
+		}
+		infos[contactID] = info
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error querying drip sequence exits: %w", err)
+	}
+
+	remaining := make([]*ContactFire, 0, len(fires))
+	for _, f := range fires {
+		info := infos[f.ContactID]
+		if info == nil {
+			continue // contact no longer exists or is no longer active
+		}
+
+		if seq.Exit.Replied && info.repliedOn != nil && info.repliedOn.After(sentOn(f)) {
+			continue
+		}
+		if info.inGroup || info.hasField {
+			continue
+		}
+		remaining = append(remaining, f)
+	}
+
+	return remaining, nil
+}
@@ -0,0 +1,84 @@
+package models_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nyaruka/gocommon/dates"
+	"github.com/nyaruka/gocommon/dbutil/assertdb"
+	"github.com/nyaruka/mailroom/v26/core/models"
+	"github.com/nyaruka/mailroom/v26/testsuite"
+	"github.com/nyaruka/mailroom/v26/testsuite/testdb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDripSequences(t *testing.T) {
+	ctx, rt := testsuite.Runtime(t)
+
+	defer dates.SetNowFunc(time.Now)
+	dates.SetNowFunc(dates.NewFixedNow(time.Date(2025, 5, 5, 12, 0, 0, 0, time.UTC)))
+
+	rt.DB.MustExec(`UPDATE orgs_org SET config = config || '{"drip_sequences": {"6c3b2f4e-8a1d-4e5f-9b7c-2d4e6f8a0b1c": {"name": "Onboarding", "steps": [{"offset": 1, "unit": "D", "flow_uuid": "9de3663f-c5c5-4c92-9f45-ecbc09abcc85"}, {"offset": 2, "unit": "H", "flow_uuid": "5890fe3a-f204-4661-b74d-025be4ee019c", "start_mode": "S"}], "exit": {"replied": true, "group_uuid": "5e9d8fab-5e7e-4f51-b533-261af5dea70d", "field_key": "joined"}}}}'::jsonb WHERE id = $1`, testdb.Org1.ID)
+
+	oa := testdb.Org1.Load(t, rt)
+
+	assert.Nil(t, oa.Org().DripSequence("d5a8c7e4-1f2b-4c3d-8e9f-0a1b2c3d4e5f"))
+
+	seq := oa.Org().DripSequence("6c3b2f4e-8a1d-4e5f-9b7c-2d4e6f8a0b1c")
+	require.NotNil(t, seq)
+	assert.Equal(t, models.DripSequenceUUID("6c3b2f4e-8a1d-4e5f-9b7c-2d4e6f8a0b1c"), seq.UUID)
+	assert.Equal(t, "Onboarding", seq.Name)
+	assert.Len(t, seq.Steps, 2)
+	assert.Equal(t, models.StartModeInterrupt, seq.Steps[0].StartMode)
+	assert.Equal(t, models.StartModeSkip, seq.Steps[1].StartMode)
+
+	// contacts from other orgs aren't enrolled
+	enrolled, err := models.EnrollInDripSequence(ctx, rt.DB, oa, seq, []models.ContactID{testdb.Ann.ID, testdb.Bob.ID, testdb.Cat.ID, testdb.Dan.ID, testdb.Org2Contact.ID}, dates.Now())
+	require.NoError(t, err)
+	assert.Equal(t, []models.ContactID{testdb.Ann.ID, testdb.Bob.ID, testdb.Cat.ID, testdb.Dan.ID}, enrolled)
+
+	assertdb.Query(t, rt.DB, `SELECT count(*) FROM contacts_contactfire WHERE fire_type = 'Q' AND scope = '6c3b2f4e-8a1d-4e5f-9b7c-2d4e6f8a0b1c:0' AND fire_on = '2025-05-06T12:00:00Z'`).Returns(4)
+
+	// re-enrolling replaces the existing fire
+	_, err = models.EnrollInDripSequence(ctx, rt.DB, oa, seq, []models.ContactID{testdb.Ann.ID}, dates.Now())
+	require.NoError(t, err)
+
+	assertdb.Query(t, rt.DB, `SELECT count(*) FROM contacts_contactfire WHERE fire_type = 'Q'`).Returns(4)
+
+	// Bob replies after enrolling, Ann only replied before enrolling but has been seen since through a channel event,
+	// Cat joins the exit group and Dan gets the exit field set
+	testdb.InsertIncomingMsg(t, rt, testdb.Org1, "0196a19a-d100-7000-8000-000000000001", testdb.TwilioChannel, testdb.Bob, "stop", models.MsgStatusHandled, "")
+	testdb.InsertIncomingMsg(t, rt, testdb.Org1, "01969c74-7500-7000-8000-000000000001", testdb.TwilioChannel, testdb.Ann, "hi", models.MsgStatusHandled, "")
+	rt.DB.MustExec(`UPDATE contacts_contact SET last_seen_on = '2025-05-05T18:00:00Z' WHERE id = $1`, testdb.Ann.ID)
+	testdb.TestersGroup.Add(rt, testdb.Cat)
+	rt.DB.MustExec(`UPDATE contacts_contact SET fields = fields || jsonb_build_object($2::text, jsonb_build_object('text', '2025-05-05', 'datetime', '2025-05-05T00:00:00Z')) WHERE id = $1`, testdb.Dan.ID, testdb.JoinedField.UUID)
+
+	fires, err := models.LoadDueContactfires(ctx, rt, 10)
+	require.NoError(t, err)
+	require.Len(t, fires, 4)
+
+	remaining, err := models.FilterDripExits(ctx, rt.DB, oa, seq, 0, fires)
+	require.NoError(t, err)
+	require.Len(t, remaining, 1)
+	assert.Equal(t, testdb.Ann.ID, remaining[0].ContactID)
+
+	// schedule the next step relative to when the first was sent
+	err = models.ScheduleDripStep(ctx, rt.DB, oa, seq, 1, []models.ContactID{testdb.Ann.ID}, time.Date(2025, 5, 6, 12, 0, 0, 0, time.UTC))
+	require.NoError(t, err)
+
+	assertdb.Query(t, rt.DB, `SELECT count(*) FROM contacts_contactfire WHERE contact_id = $1 AND scope = '6c3b2f4e-8a1d-4e5f-9b7c-2d4e6f8a0b1c:1' AND fire_on = '2025-05-06T14:00:00Z'`, testdb.Ann.ID).Returns(1)
+
+	// no more steps after that
+	err = models.ScheduleDripStep(ctx, rt.DB, oa, seq, 2, []models.ContactID{testdb.Ann.ID}, time.Date(2025, 5, 6, 14, 0, 0, 0, time.UTC))
+	require.NoError(t, err)
+
+	assertdb.Query(t, rt.DB, `SELECT count(*) FROM contacts_contactfire WHERE fire_type = 'Q'`).Returns(5)
+
+	// contacts who are no longer active have exited
+	rt.DB.MustExec(`UPDATE contacts_contact SET status = 'S' WHERE id = $1`, testdb.Ann.ID)
+
+	remaining, err = models.FilterDripExits(ctx, rt.DB, oa, seq, 0, fires)
+	require.NoError(t, err)
+	assert.Len(t, remaining, 0)
+}
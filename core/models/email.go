@@ -0,0 +1,151 @@
+package models
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	valkey "github.com/gomodule/redigo/redis"
+	"github.com/nyaruka/gocommon/dates"
+	"github.com/nyaruka/gocommon/jsonx"
+	"github.com/nyaruka/goflow/core"
+	"github.com/nyaruka/goflow/core/events"
+	"github.com/nyaruka/goflow/flows"
+	"github.com/nyaruka/mailroom/v26/runtime"
+)
+
+const (
+	// how long a sent message id waits for its email_sent event to be handled
+	emailPendingExpiry = time.Minute * 15
+
+	// how long we can match delivery events from providers to email_sent events
+	emailMessageExpiry = time.Hour * 24 * 30
+)
+
+// delivery statuses of emails sent via API providers, as written to the history table
+const (
+	EmailDeliveryDelivered  = "delivered"
+	EmailDeliveryBounced    = "bounced"
+	EmailDeliveryComplained = "complained"
+	EmailDeliveryFailed     = "failed"
+)
+
+// EmailMessageSender is implemented by email services which can tell us the provider's id for a sent message, which
+// is what their delivery events refer to it by
+type EmailMessageSender interface {
+	SendMessage(ctx context.Context, addresses []string, subject, body string) (string, error)
+}
+
+// trackedEmailService wraps an email service to remember the provider's ids for sent messages until the email_sent
+// events for them are handled. The engine doesn't give services the event, so we match them by their content.
+type trackedEmailService struct {
+	sender EmailMessageSender
+
+	rt *runtime.Runtime
+	oa *OrgAssets
+}
+
+func (s *trackedEmailService) Send(ctx context.Context, addresses []string, subject, body string) error {
+	messageID, err := s.sender.SendMessage(ctx, addresses, subject, body)
+	if err != nil {
+		return err
+	}
+
+	if messageID != "" {
+		vc := s.rt.VK.Get()
+		defer vc.Close()
+
+		key := emailPendingKey(s.oa.OrgID(), addresses, subject, body)
+
+		vc.Send("MULTI")
+		vc.Send("RPUSH", key, messageID)
+		vc.Send("EXPIRE", key, int(emailPendingExpiry/time.Second))
+		if _, err := valkey.DoContext(vc, ctx, "EXEC"); err != nil {
+			slog.Error("error recording sent email message id", "org_id", s.oa.OrgID(), "message_id", messageID, "error", err)
+		}
+	}
+
+	return nil
+}
+
+func newTrackedEmailService(rt *runtime.Runtime, oa *OrgAssets, svc flows.EmailService) flows.EmailService {
+	if sender, ok := svc.(EmailMessageSender); ok {
+		return &trackedEmailService{sender: sender, rt: rt, oa: oa}
+	}
+	return svc
+}
+
+func emailPendingKey(orgID OrgID, addresses []string, subject, body string) string {
+	hash := sha256.Sum256([]byte(strings.Join(addresses, ",") + "\n" + subject + "\n" + body))
+	return fmt.Sprintf("email_pending:%d:%s", orgID, hex.EncodeToString(hash[:16]))
+}
+
+func emailMessageKey(messageID string) string {
+	return fmt.Sprintf("email_message:%s", messageID)
+}
+
+// SentEmail is an email_sent event which we can match delivery events to
+type SentEmail struct {
+	OrgID       OrgID            `json:"org_id"`
+	ContactUUID core.ContactUUID `json:"contact_uuid"`
+	EventUUID   events.EventUUID `json:"event_uuid"`
+}
+
+// RecordEmailSent matches an email_sent event to the provider's id for the message it sent, if it gave us one, so
+// that delivery events for that message can later be recorded against the event.
+func RecordEmailSent(ctx context.Context, rt *runtime.Runtime, orgID OrgID, contactUUID core.ContactUUID, event *events.EmailSent) error {
+	vc := rt.VK.Get()
+	defer vc.Close()
+
+	messageID, err := valkey.String(valkey.DoContext(vc, ctx, "LPOP", emailPendingKey(orgID, event.To, event.Subject, event.Body)))
+	if err == valkey.ErrNil {
+		return nil // sent by a service which doesn't give us ids
+	} else if err != nil {
+		return fmt.Errorf("error popping sent email message id: %w", err)
+	}
+
+	sent := jsonx.MustMarshal(&SentEmail{OrgID: orgID, ContactUUID: contactUUID, EventUUID: event.UUID()})
+
+	if _, err := valkey.DoContext(vc, ctx, "SET", emailMessageKey(messageID), sent, "EX", int(emailMessageExpiry/time.Second)); err != nil {
+		return fmt.Errorf("error recording sent email: %w", err)
+	}
+	return nil
+}
+
+// GetSentEmail looks up the email_sent event for the given provider message id, returning nil if there isn't one
+func GetSentEmail(ctx context.Context, rt *runtime.Runtime, messageID string) (*SentEmail, error) {
+	vc := rt.VK.Get()
+	defer vc.Close()
+
+	data, err := valkey.Bytes(valkey.DoContext(vc, ctx, "GET", emailMessageKey(messageID)))
+	if err == valkey.ErrNil {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("error looking up sent email: %w", err)
+	}
+
+	sent := &SentEmail{}
+	if err := jsonx.Unmarshal(data, sent); err != nil {
+		return nil, fmt.Errorf("error unmarshaling sent email: %w", err)
+	}
+	return sent, nil
+}
+
+// NewEmailStatusTag creates the history-table event tag that records the delivery status of an email_sent event. As
+// with airtime, later statuses overwrite earlier ones.
+func NewEmailStatusTag(sent *SentEmail, status string) *EventTag {
+	return &EventTag{
+		OrgID:       sent.OrgID,
+		ContactUUID: sent.ContactUUID,
+		EventUUID:   sent.EventUUID,
+		Tag:         eventTagStatus,
+		Data: map[string]any{
+			"created_on": dates.Now(),
+			"status":     status,
+		},
+	}
+}
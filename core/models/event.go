@@ -3,15 +3,23 @@ package models
 import (
 	"bytes"
 	"compress/gzip"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
+	"slices"
+	"strings"
 	"time"
 
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
 	"github.com/nyaruka/gocommon/aws/dynamo"
 	"github.com/nyaruka/gocommon/dates"
 	"github.com/nyaruka/goflow/core"
 	"github.com/nyaruka/goflow/core/events"
+	"github.com/nyaruka/mailroom/v26/runtime"
 )
 
 type Via string
@@ -44,6 +52,7 @@ var eventPersistence = map[string]time.Duration{
 	events.TypeContactNameChanged:     time.Hour * 24 * 365, // 1 year
 	events.TypeContactStatusChanged:   eternity,
 	events.TypeContactURNsChanged:     time.Hour * 24 * 365, // 1 year
+	events.TypeEmailSent:              eternity,
 	events.TypeError:                  time.Hour * 24 * 365, // 1 year (additional filtering on error code below)
 	events.TypeFailure:                eternity,
 	events.TypeIVRCreated:             eternity,
@@ -91,6 +100,16 @@ type Event struct {
 
 	OrgID       OrgID
 	ContactUUID core.ContactUUID
+	Redact      bool // whether the event's value should be redacted, e.g. for a sensitive field
+}
+
+// IsSensitiveEvent returns whether the given event contains the value of a sensitive field
+func IsSensitiveEvent(oa *OrgAssets, e events.Event) bool {
+	if typed, ok := e.(*events.ContactFieldChanged); ok {
+		field := oa.FieldByKey(typed.Field.Key)
+		return field != nil && field.Sensitive()
+	}
+	return false
 }
 
 // DynamoKey returns the PK+SK combo used for persistence
@@ -113,6 +132,12 @@ func (e *Event) MarshalDynamo() (*dynamo.Item, error) {
 		return nil, fmt.Errorf("error marshaling event: %w", err)
 	}
 
+	if e.Redact {
+		if eJSON, err = redactEventValue(eJSON); err != nil {
+			return nil, err
+		}
+	}
+
 	var data map[string]any
 	var dataGz []byte
 
@@ -145,6 +170,20 @@ func (e *Event) MarshalDynamo() (*dynamo.Item, error) {
 	}, nil
 }
 
+// replaces the value in the given event JSON with the redaction mask
+func redactEventValue(eJSON []byte) ([]byte, error) {
+	var data map[string]any
+	if err := json.Unmarshal(eJSON, &data); err != nil {
+		return nil, fmt.Errorf("error unmarshaling event json: %w", err)
+	}
+
+	if data["value"] != nil {
+		data["value"] = map[string]any{"text": core.RedactionMask}
+	}
+
+	return json.Marshal(data)
+}
+
 // EventTag is a record of additional information associated with an existing event
 type EventTag struct {
 	OrgID       OrgID
@@ -184,3 +223,196 @@ func NewMsgDeletionTag(orgID OrgID, contactUUID core.ContactUUID, msgUUID events
 		Data:        data,
 	}
 }
+
+// historyItem lets us queue items we've read back from the history table
+type historyItem dynamo.Item
+
+func (i *historyItem) MarshalDynamo() (*dynamo.Item, error) { return (*dynamo.Item)(i), nil }
+
+// CopyContactHistory copies all history items for one contact to another, e.g. when merging contacts, returning the
+// number of items copied. Items for the given events to skip, and any tags on them, aren't copied. Items keep their
+// TTLs and the originals are left to expire or be purged with their contact.
+func CopyContactHistory(ctx context.Context, rt *runtime.Runtime, orgID OrgID, from, to core.ContactUUID, skip map[events.EventUUID]bool) (int, error) {
+	numCopied := 0
+
+	err := queryContactHistory(ctx, rt, orgID, from, func(item *dynamo.Item) error {
+		eventUUID, _, _ := strings.Cut(strings.TrimPrefix(item.SK, "evt#"), "#")
+		if skip[events.EventUUID(eventUUID)] {
+			return nil
+		}
+
+		item.PK = fmt.Sprintf("con#%s", to)
+
+		if _, err := rt.Dynamo.History.Queue((*historyItem)(item)); err != nil {
+			return fmt.Errorf("error queuing history item: %w", err)
+		}
+		numCopied++
+		return nil
+	})
+
+	return numCopied, err
+}
+
+// LoadContactHistory loads all the events in the history of the given contact in order. Any tags on an event, e.g. a
+// deletion, are included on the event as "tags".
+func LoadContactHistory(ctx context.Context, rt *runtime.Runtime, orgID OrgID, contactUUID core.ContactUUID) ([]map[string]any, error) {
+	history := make([]map[string]any, 0, 100)
+	byUUID := make(map[string]map[string]any)
+
+	err := queryContactHistory(ctx, rt, orgID, contactUUID, func(item *dynamo.Item) error {
+		eventUUID, tag, isTag := strings.Cut(strings.TrimPrefix(item.SK, "evt#"), "#")
+
+		if isTag {
+			if evt := byUUID[eventUUID]; evt != nil {
+				tags, _ := evt["tags"].(map[string]any)
+				if tags == nil {
+					tags = make(map[string]any, 1)
+					evt["tags"] = tags
+				}
+				tags[tag] = item.Data
+			}
+			return nil
+		}
+
+		evt := item.Data
+		if len(item.DataGZ) > 0 {
+			r, err := gzip.NewReader(bytes.NewReader(item.DataGZ))
+			if err != nil {
+				return fmt.Errorf("error decompressing history item: %w", err)
+			}
+			evt = nil
+			if err := json.NewDecoder(r).Decode(&evt); err != nil {
+				return fmt.Errorf("error decoding history item: %w", err)
+			}
+		}
+		if evt == nil {
+			evt = make(map[string]any, 1)
+		}
+		evt["uuid"] = eventUUID
+
+		history = append(history, evt)
+		byUUID[eventUUID] = evt
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return history, nil
+}
+
+// DeleteContactHistory deletes all history items for the given contact, returning the number of items deleted
+func DeleteContactHistory(ctx context.Context, rt *runtime.Runtime, orgID OrgID, contactUUID core.ContactUUID) (int, error) {
+	keys := make([]dynamo.Key, 0, 100)
+
+	err := queryContactHistory(ctx, rt, orgID, contactUUID, func(item *dynamo.Item) error {
+		keys = append(keys, item.Key)
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	if err := deleteDynamoItems(ctx, rt.Dynamo.History, keys); err != nil {
+		return 0, fmt.Errorf("error deleting history items: %w", err)
+	}
+
+	return len(keys), nil
+}
+
+const (
+	dynamoWriteMaxRetries = 10
+	dynamoWriteBackoff    = 100 * time.Millisecond
+	dynamoWriteMaxBackoff = 5 * time.Second
+)
+
+// deletes the items with the given keys from the table of the given writer
+func deleteDynamoItems(ctx context.Context, w *dynamo.Writer, keys []dynamo.Key) error {
+	requests := make([]types.WriteRequest, len(keys))
+	for i, key := range keys {
+		requests[i] = types.WriteRequest{DeleteRequest: &types.DeleteRequest{Key: map[string]types.AttributeValue{
+			"PK": &types.AttributeValueMemberS{Value: key.PK},
+			"SK": &types.AttributeValueMemberS{Value: key.SK},
+		}}}
+	}
+
+	return batchWriteDynamo(ctx, w, requests)
+}
+
+// writes the given items to the table of the given writer, without waiting for them to be spooled
+func putDynamoItems(ctx context.Context, w *dynamo.Writer, items []*dynamo.Item) error {
+	requests := make([]types.WriteRequest, len(items))
+	for i, item := range items {
+		attrs, err := attributevalue.MarshalMap(item)
+		if err != nil {
+			return fmt.Errorf("error marshaling item: %w", err)
+		}
+		requests[i] = types.WriteRequest{PutRequest: &types.PutRequest{Item: attrs}}
+	}
+
+	return batchWriteDynamo(ctx, w, requests)
+}
+
+// makes the given write requests against the table of the given writer in batches
+func batchWriteDynamo(ctx context.Context, w *dynamo.Writer, requests []types.WriteRequest) error {
+	for batch := range slices.Chunk(requests, 25) {
+		// keep going until nothing is left unprocessed, backing off between attempts since unprocessed items usually
+		// mean we're being throttled
+		unprocessed := map[string][]types.WriteRequest{w.Table(): batch}
+		for attempt := 0; len(unprocessed) > 0; attempt++ {
+			if attempt > 0 {
+				if attempt > dynamoWriteMaxRetries {
+					return fmt.Errorf("items still unprocessed after %d retries", dynamoWriteMaxRetries)
+				}
+
+				select {
+				case <-time.After(min(dynamoWriteBackoff<<(attempt-1), dynamoWriteMaxBackoff)):
+				case <-ctx.Done():
+					return ctx.Err()
+				}
+			}
+
+			resp, err := w.Client().BatchWriteItem(ctx, &dynamodb.BatchWriteItemInput{RequestItems: unprocessed})
+			if err != nil {
+				return err
+			}
+			unprocessed = resp.UnprocessedItems
+		}
+	}
+
+	return nil
+}
+
+// queries all history items for the given contact, calling fn for each item which belongs to the given org
+func queryContactHistory(ctx context.Context, rt *runtime.Runtime, orgID OrgID, contactUUID core.ContactUUID, fn func(*dynamo.Item) error) error {
+	paginator := dynamodb.NewQueryPaginator(rt.Dynamo.History.Client(), &dynamodb.QueryInput{
+		TableName:              aws.String(rt.Dynamo.History.Table()),
+		KeyConditionExpression: aws.String("PK = :pk"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":pk": &types.AttributeValueMemberS{Value: fmt.Sprintf("con#%s", contactUUID)},
+		},
+	})
+
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return fmt.Errorf("error querying contact history: %w", err)
+		}
+
+		for _, attrs := range page.Items {
+			item := &dynamo.Item{}
+			if err := attributevalue.UnmarshalMap(attrs, item); err != nil {
+				return fmt.Errorf("error unmarshaling history item: %w", err)
+			}
+			if item.OrgID != int(orgID) {
+				continue
+			}
+
+			if err := fn(item); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
@@ -95,6 +95,29 @@ func TestEventToDynamo(t *testing.T) {
 	}
 }
 
+func TestRedactedEventToDynamo(t *testing.T) {
+	ctx, rt := testsuite.Runtime(t)
+
+	rt.DB.MustExec(`UPDATE orgs_org SET config = config || '{"sensitive_fields": ["gender"]}'::jsonb WHERE id = $1`, testdb.Org1.ID)
+
+	oa, err := models.GetOrgAssetsWithRefresh(ctx, rt, testdb.Org1.ID, models.RefreshFields)
+	require.NoError(t, err)
+
+	gender, err := events.Read([]byte(`{"uuid": "0197b335-6ded-79a4-95a6-3af85b57f108", "type": "contact_field_changed", "created_on": "2025-05-04T12:30:56.123456789Z", "field": {"key": "gender", "name": "Gender"}, "value": {"text": "Positive"}}`))
+	require.NoError(t, err)
+	age, err := events.Read([]byte(`{"uuid": "0197b335-6ded-79a4-95a6-3af85b57f109", "type": "contact_field_changed", "created_on": "2025-05-04T12:30:56.123456789Z", "field": {"key": "age", "name": "Age"}, "value": {"text": "44"}}`))
+	require.NoError(t, err)
+
+	assert.True(t, models.IsSensitiveEvent(oa, gender))
+	assert.False(t, models.IsSensitiveEvent(oa, age))
+	assert.False(t, models.IsSensitiveEvent(oa, events.NewContactNameChanged("Bobby")))
+
+	item, err := (&models.Event{Event: gender, OrgID: testdb.Org1.ID, ContactUUID: testdb.Ann.UUID, Redact: true}).MarshalDynamo()
+	require.NoError(t, err)
+	assert.Equal(t, map[string]any{"text": core.RedactionMask}, item.Data["value"])
+	assert.Equal(t, map[string]any{"key": "gender", "name": "Gender"}, item.Data["field"])
+}
+
 func TestEventTagToDynamo(t *testing.T) {
 	tcs := []struct {
 		EventUUID events.EventUUID `json:"event_uuid"`
@@ -171,3 +194,33 @@ func TestEventTags(t *testing.T) {
 		"status":     "completed",
 	}, tag.Data)
 }
+
+func TestCopyContactHistory(t *testing.T) {
+	ctx, rt := testsuite.Runtime(t)
+
+	evt1, err := events.Read([]byte(`{"uuid": "0197b335-6ded-79a4-95a6-3af85b57f108", "type": "contact_name_changed", "created_on": "2025-05-04T12:30:56.123456789Z", "name": "Bobby"}`))
+	require.NoError(t, err)
+	evt2, err := events.Read([]byte(`{"uuid": "0197b335-6ded-79a4-95a6-3af85b57f109", "type": "contact_name_changed", "created_on": "2025-05-04T12:30:57.123456789Z", "name": "Robert"}`))
+	require.NoError(t, err)
+
+	for _, e := range []events.Event{evt1, evt2} {
+		_, err := rt.Dynamo.History.Queue(&models.Event{Event: e, OrgID: testdb.Org1.ID, ContactUUID: testdb.Bob.UUID})
+		require.NoError(t, err)
+	}
+	_, err = rt.Dynamo.History.Queue(models.NewMsgDeletionTag(testdb.Org1.ID, testdb.Bob.UUID, evt2.UUID(), true, nil))
+	require.NoError(t, err)
+	rt.Dynamo.History.Flush()
+
+	// events to skip aren't copied, nor are their tags
+	numCopied, err := models.CopyContactHistory(ctx, rt, testdb.Org1.ID, testdb.Bob.UUID, testdb.Ann.UUID, map[events.EventUUID]bool{evt2.UUID(): true})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, numCopied)
+
+	rt.Dynamo.History.Flush()
+
+	history, err := models.LoadContactHistory(ctx, rt, testdb.Org1.ID, testdb.Ann.UUID)
+	assert.NoError(t, err)
+	if assert.Len(t, history, 1) {
+		assert.Equal(t, "0197b335-6ded-79a4-95a6-3af85b57f108", history[0]["uuid"])
+	}
+}
@@ -0,0 +1,360 @@
+package models
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	dbtypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/lib/pq"
+	"github.com/nyaruka/gocommon/aws/dynamo"
+	"github.com/nyaruka/gocommon/dates"
+	"github.com/nyaruka/gocommon/jsonx"
+	"github.com/nyaruka/gocommon/uuids"
+	"github.com/nyaruka/goflow/core"
+	"github.com/nyaruka/mailroom/v26/runtime"
+)
+
+// VariantUUID is the UUID of a variant in an experiment
+type VariantUUID uuids.UUID
+
+// NewVariantUUID generates a new UUID for a variant
+func NewVariantUUID() VariantUUID { return VariantUUID(uuids.NewV4()) }
+
+// Variant is one arm of an experiment on a broadcast or flow start which is used for the given percentage of its
+// recipients. Broadcast variants have their own translations and flow start variants can start a different flow.
+type Variant struct {
+	UUID         VariantUUID                `json:"uuid"`
+	Name         string                     `json:"name"                   validate:"required"`
+	Percent      int                        `json:"percent"                validate:"min=1,max=100"`
+	Translations core.BroadcastTranslations `json:"translations,omitempty"`
+	FlowID       FlowID                     `json:"flow_id,omitempty"`
+}
+
+// ValidateVariants checks that the given variants make a valid experiment
+func ValidateVariants(variants []*Variant) error {
+	if len(variants) < 2 {
+		return errors.New("experiments must have at least 2 variants")
+	}
+
+	total := 0
+	names := make(map[string]bool, len(variants))
+	for _, v := range variants {
+		if names[strings.ToLower(v.Name)] {
+			return fmt.Errorf("variant name '%s' is not unique", v.Name)
+		}
+		names[strings.ToLower(v.Name)] = true
+		total += v.Percent
+	}
+
+	if total != 100 {
+		return fmt.Errorf("variant percentages must add up to 100, got %d", total)
+	}
+	return nil
+}
+
+// SplitVariants splits the given contacts between the given variants of an experiment according to their percentages,
+// returning the contacts for each variant in the same order as the variants. The split is deterministic so a contact
+// is always assigned the same variant in the same experiment.
+func SplitVariants(experimentUUID uuids.UUID, variants []*Variant, contactIDs []ContactID) [][]ContactID {
+	split := make([][]ContactID, len(variants))
+
+	for _, contactID := range contactIDs {
+		i := assignVariant(experimentUUID, variants, contactID)
+		split[i] = append(split[i], contactID)
+	}
+
+	return split
+}
+
+func assignVariant(experimentUUID uuids.UUID, variants []*Variant, contactID ContactID) int {
+	h := fnv.New32a()
+	fmt.Fprintf(h, "%s:%d", experimentUUID, contactID)
+	bucket := int(h.Sum32() % 100)
+
+	for i, v := range variants {
+		if bucket -= v.Percent; bucket < 0 {
+			return i
+		}
+	}
+	return len(variants) - 1
+}
+
+// Experiment is the record we keep of an experiment on a broadcast or flow start, whose UUID it shares, so that we can
+// report results per variant
+type Experiment struct {
+	OrgID     OrgID
+	UUID      uuids.UUID
+	Variants  []*Variant
+	CreatedOn time.Time
+}
+
+// NewExperiment creates a new experiment record for the broadcast or flow start with the given UUID
+func NewExperiment(orgID OrgID, uuid uuids.UUID, variants []*Variant) *Experiment {
+	return &Experiment{OrgID: orgID, UUID: uuid, Variants: variants, CreatedOn: dates.Now()}
+}
+
+// DynamoKey returns the PK+SK combo used for persistence
+func (e *Experiment) DynamoKey() dynamo.Key {
+	return dynamo.Key{PK: fmt.Sprintf("exp#%s", e.UUID), SK: "def"}
+}
+
+func (e *Experiment) MarshalDynamo() (*dynamo.Item, error) {
+	return marshalExperimentItem(e.DynamoKey(), e.OrgID, &experimentData{Variants: e.Variants, CreatedOn: e.CreatedOn})
+}
+
+// VariantAssignment is the record of a batch of contacts being assigned a variant in an experiment
+type VariantAssignment struct {
+	OrgID          OrgID
+	ExperimentUUID uuids.UUID
+	VariantUUID    VariantUUID
+	Batch          int
+	ContactIDs     []ContactID
+}
+
+// NewVariantAssignment creates a new assignment of the given contacts to a variant, where batch identifies the batch
+// of contacts within the experiment
+func NewVariantAssignment(orgID OrgID, experimentUUID uuids.UUID, variant *Variant, batch int, contactIDs []ContactID) *VariantAssignment {
+	return &VariantAssignment{OrgID: orgID, ExperimentUUID: experimentUUID, VariantUUID: variant.UUID, Batch: batch, ContactIDs: contactIDs}
+}
+
+// DynamoKey returns the PK+SK combo used for persistence
+func (a *VariantAssignment) DynamoKey() dynamo.Key {
+	return dynamo.Key{PK: fmt.Sprintf("exp#%s", a.ExperimentUUID), SK: fmt.Sprintf("asg#%s#%d", a.VariantUUID, a.Batch)}
+}
+
+func (a *VariantAssignment) MarshalDynamo() (*dynamo.Item, error) {
+	return marshalExperimentItem(a.DynamoKey(), a.OrgID, &assignmentData{ContactIDs: a.ContactIDs})
+}
+
+// InsertExperiment writes the given experiment and the given assignments of its contacts to variants, without waiting
+// for them to be spooled, so that the caller knows they've been recorded before sending anything
+func InsertExperiment(ctx context.Context, rt *runtime.Runtime, exp *Experiment, assignments []*VariantAssignment) error {
+	items := make([]*dynamo.Item, 0, len(assignments)+1)
+
+	item, err := exp.MarshalDynamo()
+	if err != nil {
+		return err
+	}
+	items = append(items, item)
+
+	for _, a := range assignments {
+		if item, err = a.MarshalDynamo(); err != nil {
+			return err
+		}
+		items = append(items, item)
+	}
+
+	if err := putDynamoItems(ctx, rt.Dynamo.Main, items); err != nil {
+		return fmt.Errorf("error writing experiment %s: %w", exp.UUID, err)
+	}
+	return nil
+}
+
+type experimentData struct {
+	Variants  []*Variant `json:"variants"`
+	CreatedOn time.Time  `json:"created_on"`
+}
+
+type assignmentData struct {
+	ContactIDs []ContactID `json:"contact_ids"`
+}
+
+func marshalExperimentItem(key dynamo.Key, orgID OrgID, d any) (*dynamo.Item, error) {
+	var data map[string]any
+	if err := json.Unmarshal(jsonx.MustMarshal(d), &data); err != nil {
+		return nil, fmt.Errorf("error marshaling experiment item: %w", err)
+	}
+
+	return &dynamo.Item{Key: key, OrgID: int(orgID), Data: data}, nil
+}
+
+// LoadExperiment loads the experiment with the given UUID and the contacts assigned to each of its variants, returning
+// nil if there is no such experiment
+func LoadExperiment(ctx context.Context, rt *runtime.Runtime, orgID OrgID, uuid uuids.UUID) (*Experiment, map[VariantUUID][]ContactID, error) {
+	var exp *Experiment
+	assignments := make(map[VariantUUID][]ContactID)
+
+	paginator := dynamodb.NewQueryPaginator(rt.Dynamo.Main.Client(), &dynamodb.QueryInput{
+		TableName:              aws.String(rt.Dynamo.Main.Table()),
+		KeyConditionExpression: aws.String("PK = :pk"),
+		ExpressionAttributeValues: map[string]dbtypes.AttributeValue{
+			":pk": &dbtypes.AttributeValueMemberS{Value: fmt.Sprintf("exp#%s", uuid)},
+		},
+	})
+
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, nil, fmt.Errorf("error querying experiment: %w", err)
+		}
+
+		for _, attrs := range page.Items {
+			item := &dynamo.Item{}
+			if err := attributevalue.UnmarshalMap(attrs, item); err != nil {
+				return nil, nil, fmt.Errorf("error unmarshaling experiment item: %w", err)
+			}
+			if item.OrgID != int(orgID) {
+				continue
+			}
+
+			if item.SK == "def" {
+				d := &experimentData{}
+				if err := jsonx.Unmarshal(jsonx.MustMarshal(item.Data), d); err != nil {
+					return nil, nil, fmt.Errorf("error unmarshaling experiment: %w", err)
+				}
+				exp = &Experiment{OrgID: orgID, UUID: uuid, Variants: d.Variants, CreatedOn: d.CreatedOn}
+			} else if rest, ok := strings.CutPrefix(item.SK, "asg#"); ok {
+				variantUUID, _, _ := strings.Cut(rest, "#")
+
+				d := &assignmentData{}
+				if err := jsonx.Unmarshal(jsonx.MustMarshal(item.Data), d); err != nil {
+					return nil, nil, fmt.Errorf("error unmarshaling variant assignment: %w", err)
+				}
+				assignments[VariantUUID(variantUUID)] = append(assignments[VariantUUID(variantUUID)], d.ContactIDs...)
+			}
+		}
+	}
+
+	if exp == nil {
+		return nil, nil, nil
+	}
+	return exp, assignments, nil
+}
+
+// GetExperimentVariant gets the variant with the given UUID of the experiment with the given UUID, returning nil if
+// there is no such experiment or variant
+func GetExperimentVariant(ctx context.Context, rt *runtime.Runtime, orgID OrgID, uuid uuids.UUID, variantUUID VariantUUID) (*Variant, error) {
+	exp := &Experiment{UUID: uuid}
+
+	item, err := dynamo.GetItem(ctx, rt.Dynamo.Main.Client(), rt.Dynamo.Main.Table(), exp.DynamoKey())
+	if err != nil {
+		return nil, fmt.Errorf("error fetching experiment %s: %w", uuid, err)
+	}
+	if item == nil || item.OrgID != int(orgID) {
+		return nil, nil
+	}
+
+	d := &experimentData{}
+	if err := jsonx.Unmarshal(jsonx.MustMarshal(item.Data), d); err != nil {
+		return nil, fmt.Errorf("error unmarshaling experiment: %w", err)
+	}
+
+	for _, v := range d.Variants {
+		if v.UUID == variantUUID {
+			return v, nil
+		}
+	}
+	return nil, nil
+}
+
+// VariantResults is the results of a variant in an experiment
+type VariantResults struct {
+	UUID     VariantUUID `json:"uuid"`
+	Name     string      `json:"name"`
+	Percent  int         `json:"percent"`
+	Contacts int         `json:"contacts"`
+
+	// for broadcasts
+	Delivered    *int     `json:"delivered,omitempty"`
+	DeliveryRate *float64 `json:"delivery_rate,omitempty"`
+
+	// for flow starts
+	Completed      *int     `json:"completed,omitempty"`
+	CompletionRate *float64 `json:"completion_rate,omitempty"`
+
+	Replied   int     `json:"replied"`
+	ReplyRate float64 `json:"reply_rate"`
+}
+
+const sqlSelectBroadcastVariantResults = `
+SELECT count(*) FILTER (WHERE m.status IN ('D', 'R')) AS delivered,
+       count(*) FILTER (WHERE EXISTS (SELECT 1 FROM msgs_msg r WHERE r.contact_id = m.contact_id AND r.direction = 'I' AND r.created_on > m.created_on)) AS replied
+  FROM msgs_msg m
+ WHERE m.broadcast_id = $1 AND m.contact_id = ANY($2) AND m.direction = 'O'`
+
+// GetBroadcastVariantResults gets the delivery and reply rates of each variant of the given experiment on a broadcast
+func GetBroadcastVariantResults(ctx context.Context, db DBorTx, bcastID BroadcastID, exp *Experiment, assignments map[VariantUUID][]ContactID) ([]*VariantResults, error) {
+	results := make([]*VariantResults, len(exp.Variants))
+
+	for i, v := range exp.Variants {
+		contactIDs := assignments[v.UUID]
+		var counts struct {
+			Delivered int `db:"delivered"`
+			Replied   int `db:"replied"`
+		}
+
+		if err := db.GetContext(ctx, &counts, sqlSelectBroadcastVariantResults, bcastID, pq.Array(contactIDs)); err != nil {
+			return nil, fmt.Errorf("error querying results for variant %s: %w", v.UUID, err)
+		}
+		delivered, replied := counts.Delivered, counts.Replied
+
+		deliveryRate := experimentRate(delivered, len(contactIDs))
+		results[i] = &VariantResults{
+			UUID:         v.UUID,
+			Name:         v.Name,
+			Percent:      v.Percent,
+			Contacts:     len(contactIDs),
+			Delivered:    &delivered,
+			DeliveryRate: &deliveryRate,
+			Replied:      replied,
+			ReplyRate:    experimentRate(replied, len(contactIDs)),
+		}
+	}
+
+	return results, nil
+}
+
+const sqlSelectStartVariantResults = `
+SELECT count(*) FILTER (WHERE status = 'C') AS completed,
+       count(*) FILTER (WHERE responded) AS replied
+  FROM flows_flowrun
+ WHERE start_id = $1 AND contact_id = ANY($2)`
+
+// GetStartVariantResults gets the completion and reply rates of each variant of the given experiment on a flow start
+func GetStartVariantResults(ctx context.Context, db DBorTx, startID StartID, exp *Experiment, assignments map[VariantUUID][]ContactID) ([]*VariantResults, error) {
+	results := make([]*VariantResults, len(exp.Variants))
+
+	for i, v := range exp.Variants {
+		contactIDs := assignments[v.UUID]
+		var counts struct {
+			Completed int `db:"completed"`
+			Replied   int `db:"replied"`
+		}
+
+		if err := db.GetContext(ctx, &counts, sqlSelectStartVariantResults, startID, pq.Array(contactIDs)); err != nil {
+			return nil, fmt.Errorf("error querying results for variant %s: %w", v.UUID, err)
+		}
+		completed, replied := counts.Completed, counts.Replied
+
+		completionRate := experimentRate(completed, len(contactIDs))
+		results[i] = &VariantResults{
+			UUID:           v.UUID,
+			Name:           v.Name,
+			Percent:        v.Percent,
+			Contacts:       len(contactIDs),
+			Completed:      &completed,
+			CompletionRate: &completionRate,
+			Replied:        replied,
+			ReplyRate:      experimentRate(replied, len(contactIDs)),
+		}
+	}
+
+	return results, nil
+}
+
+// rate of n out of total rounded to 3 decimal places
+func experimentRate(n, total int) float64 {
+	if total == 0 {
+		return 0
+	}
+	return math.Round(float64(n)/float64(total)*1000) / 1000
+}
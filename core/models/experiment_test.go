@@ -0,0 +1,137 @@
+package models_test
+
+import (
+	"testing"
+
+	"github.com/lib/pq"
+	"github.com/nyaruka/gocommon/aws/dynamo"
+	"github.com/nyaruka/gocommon/i18n"
+	"github.com/nyaruka/gocommon/uuids"
+	"github.com/nyaruka/goflow/core"
+	"github.com/nyaruka/mailroom/v26/core/models"
+	"github.com/nyaruka/mailroom/v26/testsuite"
+	"github.com/nyaruka/mailroom/v26/testsuite/testdb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExperiments(t *testing.T) {
+	ctx, rt := testsuite.Runtime(t)
+
+	a := &models.Variant{UUID: "2c1a7c1e-4f5b-4c8e-9d3a-6b7e8f9a0b1c", Name: "A", Percent: 30}
+	b := &models.Variant{UUID: "8e3b4d2f-1a6c-4e7d-8f9a-0b1c2d3e4f5a", Name: "B", Percent: 70}
+
+	assert.EqualError(t, models.ValidateVariants([]*models.Variant{a}), "experiments must have at least 2 variants")
+	assert.EqualError(t, models.ValidateVariants([]*models.Variant{a, {Name: "C", Percent: 60}}), "variant percentages must add up to 100, got 90")
+	assert.EqualError(t, models.ValidateVariants([]*models.Variant{a, {Name: "a", Percent: 70}}), "variant name 'a' is not unique")
+	assert.NoError(t, models.ValidateVariants([]*models.Variant{a, b}))
+
+	// split 1000 contacts between the variants
+	contactIDs := make([]models.ContactID, 1000)
+	for i := range contactIDs {
+		contactIDs[i] = models.ContactID(i + 1)
+	}
+
+	experimentUUID := uuids.UUID("f4b0e6a2-7c3d-4e5f-8a9b-0c1d2e3f4a5b")
+	split := models.SplitVariants(experimentUUID, []*models.Variant{a, b}, contactIDs)
+	require.Len(t, split, 2)
+	assert.Equal(t, 1000, len(split[0])+len(split[1]))
+	assert.InDelta(t, 300, len(split[0]), 50)
+	assert.InDelta(t, 700, len(split[1]), 50)
+
+	// split is deterministic
+	assert.Equal(t, split, models.SplitVariants(experimentUUID, []*models.Variant{a, b}, contactIDs))
+	assert.Equal(t, split[0][:10], models.SplitVariants(experimentUUID, []*models.Variant{a, b}, split[0][:10])[0])
+
+	// but differs between experiments
+	assert.NotEqual(t, split, models.SplitVariants(uuids.UUID("0a1b2c3d-4e5f-4a6b-8c7d-9e0f1a2b3c4d"), []*models.Variant{a, b}, contactIDs))
+
+	// record an experiment on a broadcast where Ann and Bob got A and Cat got B
+	bcast := testdb.InsertBroadcast(t, rt, testdb.Org1, "0199f6a8-2b3c-7d4e-8f5a-6b7c8d9e0f1a", "eng", map[i18n.Language]string{"eng": "Hi"}, models.NilScheduleID, nil, nil)
+
+	for _, item := range []dynamo.ItemMarshaler{
+		models.NewExperiment(testdb.Org1.ID, uuids.UUID(bcast.UUID), []*models.Variant{a, b}),
+		models.NewVariantAssignment(testdb.Org1.ID, uuids.UUID(bcast.UUID), a, 0, []models.ContactID{testdb.Ann.ID, testdb.Bob.ID}),
+		models.NewVariantAssignment(testdb.Org1.ID, uuids.UUID(bcast.UUID), b, 1, []models.ContactID{testdb.Cat.ID}),
+	} {
+		_, err := rt.Dynamo.Main.Queue(item)
+		require.NoError(t, err)
+	}
+	rt.Dynamo.Main.Flush()
+
+	exp, assignments, err := models.LoadExperiment(ctx, rt, testdb.Org1.ID, uuids.UUID(bcast.UUID))
+	require.NoError(t, err)
+	require.NotNil(t, exp)
+	assert.Equal(t, []*models.Variant{a, b}, exp.Variants)
+	assert.Equal(t, map[models.VariantUUID][]models.ContactID{a.UUID: {testdb.Ann.ID, testdb.Bob.ID}, b.UUID: {testdb.Cat.ID}}, assignments)
+
+	// experiment can't be loaded from another org
+	exp, _, err = models.LoadExperiment(ctx, rt, testdb.Org2.ID, uuids.UUID(bcast.UUID))
+	assert.NoError(t, err)
+	assert.Nil(t, exp)
+
+	// variants can be fetched individually, but also not from another org
+	variant, err := models.GetExperimentVariant(ctx, rt, testdb.Org1.ID, uuids.UUID(bcast.UUID), b.UUID)
+	assert.NoError(t, err)
+	assert.Equal(t, b, variant)
+
+	variant, err = models.GetExperimentVariant(ctx, rt, testdb.Org2.ID, uuids.UUID(bcast.UUID), b.UUID)
+	assert.NoError(t, err)
+	assert.Nil(t, variant)
+
+	// Ann's and Cat's messages are delivered but only Ann replies
+	out1 := testdb.InsertOutgoingMsg(t, rt, testdb.Org1, "0199f6a9-1a2b-7c3d-8e4f-5a6b7c8d9e0f", testdb.TwilioChannel, testdb.Ann, "Hi", nil, models.MsgStatusDelivered, false)
+	out2 := testdb.InsertOutgoingMsg(t, rt, testdb.Org1, "0199f6a9-3c4d-7e5f-8a6b-7c8d9e0f1a2b", testdb.TwilioChannel, testdb.Bob, "Hi", nil, models.MsgStatusSent, false)
+	out3 := testdb.InsertOutgoingMsg(t, rt, testdb.Org1, "0199f6a9-5e6f-7a8b-9c0d-1e2f3a4b5c6d", testdb.TwilioChannel, testdb.Cat, "Hi", nil, models.MsgStatusDelivered, false)
+	rt.DB.MustExec(`UPDATE msgs_msg SET broadcast_id = $1, created_on = NOW() - INTERVAL '1 hour' WHERE id = ANY($2)`, bcast.ID, pq.Array([]models.MsgID{out1.ID, out2.ID, out3.ID}))
+	testdb.InsertIncomingMsg(t, rt, testdb.Org1, "0199f6aa-7a8b-7c9d-8e0f-1a2b3c4d5e6f", testdb.TwilioChannel, testdb.Ann, "Hello", models.MsgStatusHandled, "")
+
+	exp, assignments, err = models.LoadExperiment(ctx, rt, testdb.Org1.ID, uuids.UUID(bcast.UUID))
+	require.NoError(t, err)
+
+	results, err := models.GetBroadcastVariantResults(ctx, rt.DB, bcast.ID, exp, assignments)
+	require.NoError(t, err)
+	require.Len(t, results, 2)
+	assert.Equal(t, "A", results[0].Name)
+	assert.Equal(t, 2, results[0].Contacts)
+	assert.Equal(t, 1, *results[0].Delivered)
+	assert.Equal(t, 0.5, *results[0].DeliveryRate)
+	assert.Equal(t, 1, results[0].Replied)
+	assert.Equal(t, 0.5, results[0].ReplyRate)
+	assert.Equal(t, "B", results[1].Name)
+	assert.Equal(t, 1, results[1].Contacts)
+	assert.Equal(t, 1.0, *results[1].DeliveryRate)
+	assert.Equal(t, 0.0, results[1].ReplyRate)
+	assert.Nil(t, results[1].Completed)
+
+	// record an experiment on a flow start where Ann got A and Bob got B, and only Ann completed the flow
+	startID := testdb.InsertFlowStart(t, rt, testdb.Org1, testdb.Admin, testdb.Favorites, []*testdb.Contact{testdb.Ann, testdb.Bob})
+	start, err := models.GetFlowStartByID(ctx, rt.DB, startID)
+	require.NoError(t, err)
+
+	_, err = rt.Dynamo.Main.Queue(models.NewExperiment(testdb.Org1.ID, start.UUID, []*models.Variant{a, b}))
+	require.NoError(t, err)
+	_, err = rt.Dynamo.Main.Queue(models.NewVariantAssignment(testdb.Org1.ID, start.UUID, a, 0, []models.ContactID{testdb.Ann.ID}))
+	require.NoError(t, err)
+	_, err = rt.Dynamo.Main.Queue(models.NewVariantAssignment(testdb.Org1.ID, start.UUID, b, 1, []models.ContactID{testdb.Bob.ID}))
+	require.NoError(t, err)
+	rt.Dynamo.Main.Flush()
+
+	session1 := testdb.InsertFlowSession(t, rt, testdb.Ann, models.FlowTypeMessaging, models.SessionStatusCompleted, nil, testdb.Favorites)
+	testdb.InsertFlowRun(t, rt, testdb.Org1, session1, testdb.Ann, testdb.Favorites, models.RunStatusCompleted, "")
+	session2 := testdb.InsertFlowSession(t, rt, testdb.Bob, models.FlowTypeMessaging, models.SessionStatusWaiting, nil, testdb.Favorites)
+	testdb.InsertFlowRun(t, rt, testdb.Org1, session2, testdb.Bob, testdb.Favorites, models.RunStatusWaiting, core.NodeUUID("b699f5fe-5b10-4fe7-9c66-c7e2de9b5a5c"))
+	rt.DB.MustExec(`UPDATE flows_flowrun SET start_id = $1`, startID)
+
+	exp, assignments, err = models.LoadExperiment(ctx, rt, testdb.Org1.ID, start.UUID)
+	require.NoError(t, err)
+
+	results, err = models.GetStartVariantResults(ctx, rt.DB, startID, exp, assignments)
+	require.NoError(t, err)
+	require.Len(t, results, 2)
+	assert.Equal(t, 1, *results[0].Completed)
+	assert.Equal(t, 1.0, *results[0].CompletionRate)
+	assert.Equal(t, 0, *results[1].Completed)
+	assert.Equal(t, 0.0, *results[1].CompletionRate)
+	assert.Nil(t, results[0].Delivered)
+}
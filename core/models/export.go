@@ -0,0 +1,127 @@
+package models
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+
+	"github.com/nyaruka/gocommon/jsonx"
+	"github.com/nyaruka/gocommon/uuids"
+	"github.com/nyaruka/null/v3"
+	"github.com/vinovest/sqlx"
+)
+
+// ExportID is the type for export IDs
+type ExportID int
+
+func (i *ExportID) Scan(value any) error         { return null.ScanInt(value, i) }
+func (i ExportID) Value() (driver.Value, error)  { return null.IntValue(i) }
+func (i *ExportID) UnmarshalJSON(b []byte) error { return null.UnmarshalInt(b, i) }
+func (i ExportID) MarshalJSON() ([]byte, error)  { return null.MarshalInt(i) }
+
+// ExportStatus is the status of an export
+type ExportStatus string
+
+// export status constants
+const (
+	ExportStatusPending    ExportStatus = "P"
+	ExportStatusProcessing ExportStatus = "O"
+	ExportStatusComplete   ExportStatus = "C"
+	ExportStatusFailed     ExportStatus = "F"
+)
+
+// ExportType is the type of an export
+type ExportType string
+
+const (
+	ExportTypeContact     ExportType = "contact"
+	ExportTypeContactData ExportType = "contact_data"
+)
+
+// Export is an export of org data to a file, created by the UI and performed by mailroom
+type Export struct {
+	ID          ExportID        `db:"id"`
+	UUID        uuids.UUID      `db:"uuid"`
+	OrgID       OrgID           `db:"org_id"`
+	Type        ExportType      `db:"export_type"`
+	Status      ExportStatus    `db:"status"`
+	NumRecords  null.Int        `db:"num_records"`
+	Path        null.String     `db:"path"`
+	Config      json.RawMessage `db:"config"`
+	CreatedByID UserID          `db:"created_by_id"`
+}
+
+// ContactExportConfig is the config of a contact export
+type ContactExportConfig struct {
+	GroupID    GroupID   `json:"group_id"`
+	Search     string    `json:"search"`
+	WithFields []string  `json:"with_fields"` // field keys
+	WithGroups []GroupID `json:"with_groups"`
+	WithURNs   []string  `json:"with_urns"` // URN schemes
+	Format     string    `json:"format"`
+}
+
+// ContactDataExportConfig is the config of an export of everything we hold about a single contact
+type ContactDataExportConfig struct {
+	ContactID       ContactID `json:"contact_id"`
+	WithAttachments bool      `json:"with_attachments"`
+}
+
+const sqlInsertExport = `
+INSERT INTO orgs_export(uuid, org_id, export_type, status, config, created_on, created_by_id, modified_on)
+     VALUES($1, $2, $3, 'P', $4, NOW(), $5, NOW())
+  RETURNING id`
+
+// InsertExport creates a new pending export
+func InsertExport(ctx context.Context, db DBorTx, orgID OrgID, typ ExportType, config any, userID UserID) (*Export, error) {
+	e := &Export{UUID: uuids.NewV4(), OrgID: orgID, Type: typ, Status: ExportStatusPending, Config: jsonx.MustMarshal(config), CreatedByID: userID}
+
+	if err := db.GetContext(ctx, &e.ID, sqlInsertExport, e.UUID, e.OrgID, e.Type, e.Config, e.CreatedByID); err != nil {
+		return nil, fmt.Errorf("error inserting export: %w", err)
+	}
+	return e, nil
+}
+
+const sqlLoadExport = `
+SELECT id, uuid, org_id, export_type, status, num_records, path, config, created_by_id
+  FROM orgs_export
+ WHERE id = $1`
+
+// LoadExport loads an export by ID
+func LoadExport(ctx context.Context, db *sqlx.DB, id ExportID) (*Export, error) {
+	e := &Export{}
+	if err := db.GetContext(ctx, e, sqlLoadExport, id); err != nil {
+		return nil, fmt.Errorf("error fetching export by id %d: %w", id, err)
+	}
+	return e, nil
+}
+
+func (e *Export) SetProcessing(ctx context.Context, db DBorTx) error {
+	e.Status = ExportStatusProcessing
+
+	if _, err := db.ExecContext(ctx, `UPDATE orgs_export SET status = $2, modified_on = NOW() WHERE id = $1`, e.ID, e.Status); err != nil {
+		return fmt.Errorf("error marking export as processing: %w", err)
+	}
+	return nil
+}
+
+func (e *Export) SetComplete(ctx context.Context, db DBorTx, path string, numRecords int) error {
+	e.Status = ExportStatusComplete
+	e.Path = null.String(path)
+	e.NumRecords = null.Int(numRecords)
+
+	if _, err := db.ExecContext(ctx, `UPDATE orgs_export SET status = $2, path = $3, num_records = $4, modified_on = NOW() WHERE id = $1`, e.ID, e.Status, e.Path, e.NumRecords); err != nil {
+		return fmt.Errorf("error marking export as complete: %w", err)
+	}
+	return nil
+}
+
+func (e *Export) SetFailed(ctx context.Context, db DBorTx) error {
+	e.Status = ExportStatusFailed
+
+	if _, err := db.ExecContext(ctx, `UPDATE orgs_export SET status = $2, modified_on = NOW() WHERE id = $1`, e.ID, e.Status); err != nil {
+		return fmt.Errorf("error marking export as failed: %w", err)
+	}
+	return nil
+}
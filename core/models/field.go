@@ -4,8 +4,15 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
+	"slices"
+	"strings"
+	"sync"
 
 	"github.com/nyaruka/goflow/assets"
+	"github.com/nyaruka/goflow/core"
+	"github.com/nyaruka/goflow/excellent/tools"
+	"github.com/nyaruka/mailroom/v26/core/goflow"
+	"github.com/nyaruka/mailroom/v26/runtime"
 )
 
 // FieldID is our type for the database field ID
@@ -19,6 +26,23 @@ type Field struct {
 	Name_  string           `json:"name"`
 	Type_  assets.FieldType `json:"field_type"`
 	Proxy_ bool             `json:"is_proxy"`
+
+	Sensitive_  bool   `json:"is_sensitive"`
+	Expression_ string `json:"expression"`
+
+	inputs     *fieldInputs
+	inputsOnce sync.Once
+}
+
+// the top level names of the context that computed field expressions are evaluated with
+var computedFieldContext = []string{"contact", "fields", "globals", "urns"}
+
+// what the expression of a computed field depends on
+type fieldInputs struct {
+	fieldKeys []string // keys of the fields it reads
+	other     bool     // whether it reads anything other than fields, e.g. the contact name
+	now       bool     // whether it calls now()
+	today     bool     // whether it calls today()
 }
 
 // ID returns the ID of this field
@@ -39,6 +63,107 @@ func (f *Field) Type() assets.FieldType { return f.Type_ }
 // Proxy returns whether this is a proxy field, e.g. created_on
 func (f *Field) Proxy() bool { return f.Proxy_ }
 
+// Sensitive returns whether values of this field are sensitive, i.e. encrypted at rest, not indexed and redacted from
+// history and logs. Orgs mark fields as sensitive by listing their keys in the sensitive_fields config key.
+func (f *Field) Sensitive() bool { return f.Sensitive_ }
+
+// Expression returns the expression used to compute values of this field, or empty if it isn't a computed field. Orgs
+// define computed fields by mapping field keys to expressions in the computed_fields config key.
+func (f *Field) Expression() string { return f.Expression_ }
+
+// Computed returns whether values of this field are computed from an expression
+func (f *Field) Computed() bool { return f.Expression_ != "" }
+
+// TimeDependent returns whether this is a computed field whose value can change with the passage of time alone, e.g.
+// an age computed from a date of birth, and so needs to be periodically re-evaluated
+func (f *Field) TimeDependent() bool {
+	in := f.expressionInputs()
+	return in.now || in.today
+}
+
+// DependsOnNow returns whether this is a computed field whose value can change within a day, i.e. it calls now(), as
+// opposed to one which only calls today() and so only needs to be re-evaluated once a day
+func (f *Field) DependsOnNow() bool {
+	return f.expressionInputs().now
+}
+
+// InputFieldKeys returns the keys of the fields that the expression of this computed field reads, and whether those
+// are its only inputs from the contact, in which case contacts without values for any of them can be skipped
+func (f *Field) InputFieldKeys() ([]string, bool) {
+	in := f.expressionInputs()
+	return in.fieldKeys, !in.other
+}
+
+// parses the expression of a computed field to find what it depends on. Function calls are references to top level
+// names which aren't in the context, e.g. ["today"] for today().
+func (f *Field) expressionInputs() *fieldInputs {
+	f.inputsOnce.Do(func() {
+		in := &fieldInputs{}
+		if !f.Computed() {
+			f.inputs = in
+			return
+		}
+
+		addField := func(key string) {
+			key = strings.ToLower(key)
+			if !slices.Contains(in.fieldKeys, key) {
+				in.fieldKeys = append(in.fieldKeys, key)
+			}
+		}
+
+		err := tools.FindContextRefsInTemplate(f.Expression_, computedFieldContext, func(path []string) {
+			switch strings.ToLower(path[0]) {
+			case "now":
+				in.now = true
+			case "today":
+				in.today = true
+			case "fields":
+				if len(path) > 1 {
+					addField(path[1])
+				} else {
+					in.other = true
+				}
+			case "contact":
+				if len(path) > 2 && strings.ToLower(path[1]) == "fields" {
+					addField(path[2])
+				} else {
+					in.other = true
+				}
+			case "globals", "urns":
+				in.other = true
+			}
+		})
+		if err != nil {
+			in.other = true // an invalid expression can't be evaluated, but treat it as depending on everything
+		}
+
+		f.inputs = in
+	})
+	return f.inputs
+}
+
+// ComputeFieldValue evaluates the expression of the given computed field for the given contact
+func ComputeFieldValue(ctx context.Context, rt *runtime.Runtime, oa *OrgAssets, field *Field, contact *core.Contact) (string, error) {
+	value, _, err := goflow.Engine(rt).Evaluator().Template(ctx, oa.Env(), ExpressionsContext(oa, contact), field.Expression(), nil)
+	if err != nil {
+		return "", fmt.Errorf("error evaluating expression for computed field %s: %w", field.Key(), err)
+	}
+	return value, nil
+}
+
+// SensitiveFieldValues returns the values of sensitive fields on the given contact, e.g. to redact from logs
+func SensitiveFieldValues(oa *OrgAssets, contact *core.Contact) []string {
+	values := make([]string, 0, 2)
+	for key, fv := range contact.Fields() {
+		if field := oa.FieldByKey(key); field != nil && field.Sensitive() && fv != nil && fv.Value != nil {
+			if text := fv.Value.Text.Native(); text != "" {
+				values = append(values, text)
+			}
+		}
+	}
+	return values
+}
+
 // loadFields loads the assets for the passed in db
 func loadFields(ctx context.Context, db *sql.DB, orgID OrgID) ([]assets.Field, error) {
 	rows, err := db.QueryContext(ctx, sqlSelectFieldsByOrg, orgID)
@@ -51,8 +176,11 @@ func loadFields(ctx context.Context, db *sql.DB, orgID OrgID) ([]assets.Field, e
 
 const sqlSelectFieldsByOrg = `
 SELECT ROW_TO_JSON(f) FROM (
-      SELECT id, uuid, key, name, (CASE value_type WHEN 'T' THEN 'text' WHEN 'N' THEN 'number' WHEN 'D' THEN 'datetime' WHEN 'S' THEN 'state' WHEN 'I' THEN 'district' WHEN 'W' THEN 'ward' END) AS field_type, is_proxy
-        FROM contacts_contactfield 
-       WHERE org_id = $1 AND is_active = TRUE
-    ORDER BY key ASC
+      SELECT f.id, f.uuid, f.key, f.name, (CASE f.value_type WHEN 'T' THEN 'text' WHEN 'N' THEN 'number' WHEN 'D' THEN 'datetime' WHEN 'S' THEN 'state' WHEN 'I' THEN 'district' WHEN 'W' THEN 'ward' END) AS field_type, f.is_proxy,
+             COALESCE(o.config->'sensitive_fields' @> to_jsonb(f.key), FALSE) AS is_sensitive,
+             COALESCE(o.config->'computed_fields'->>f.key, '') AS expression
+        FROM contacts_contactfield f
+  INNER JOIN orgs_org o ON o.id = f.org_id
+       WHERE f.org_id = $1 AND f.is_active = TRUE
+    ORDER BY f.key ASC
 ) f;`
@@ -0,0 +1,276 @@
+package models
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	dbtypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/nyaruka/gocommon/aws/dynamo"
+	"github.com/nyaruka/gocommon/jsonx"
+	"github.com/nyaruka/goflow/assets"
+	"github.com/nyaruka/goflow/core"
+	"github.com/nyaruka/goflow/core/events"
+	"github.com/nyaruka/goflow/envs"
+	"github.com/nyaruka/goflow/excellent/types"
+	"github.com/nyaruka/mailroom/v26/runtime"
+)
+
+// FieldChange is a change to the value of a field on a contact. Unlike contact_field_changed events in the history
+// table, these are kept forever and are keyed by field so that we can get the value of a field at any point in time.
+type FieldChange struct {
+	OrgID       OrgID
+	ContactUUID core.ContactUUID
+	UUID        events.EventUUID // UUID of the event which made the change
+	Field       *assets.FieldReference
+	OldValue    *core.Value
+	NewValue    *core.Value
+	Flow        *assets.FlowReference
+	UserID      UserID
+	ChangedOn   time.Time
+
+	org   *Org // for encrypting values of sensitive fields
+	field *Field
+}
+
+// NewFieldChange creates a new field change from the given event
+func NewFieldChange(oa *OrgAssets, contactUUID core.ContactUUID, field *Field, event *events.ContactFieldChanged, oldValue *core.Value, userID UserID) *FieldChange {
+	var flow *assets.FlowReference
+	if step := event.Step(); step != nil {
+		flow = step.Flow
+	}
+
+	return &FieldChange{
+		OrgID:       oa.OrgID(),
+		ContactUUID: contactUUID,
+		UUID:        event.UUID(),
+		Field:       event.Field,
+		OldValue:    oldValue,
+		NewValue:    event.Value,
+		Flow:        flow,
+		UserID:      userID,
+		ChangedOn:   event.CreatedOn(),
+		org:         oa.Org(),
+		field:       field,
+	}
+}
+
+// the stored form of a field value, i.e. the same as in the fields JSON of a contact
+type storedFieldValue struct {
+	Text     *types.XText      `json:"text"`
+	Datetime *types.XDateTime  `json:"datetime,omitempty"`
+	Number   *types.XNumber    `json:"number,omitempty"`
+	State    envs.LocationPath `json:"state,omitempty"`
+	District envs.LocationPath `json:"district,omitempty"`
+	Ward     envs.LocationPath `json:"ward,omitempty"`
+	Enc      string            `json:"enc,omitempty"` // value of a sensitive field is encrypted
+}
+
+type fieldChangeData struct {
+	Field     *assets.FieldReference `json:"field"`
+	Old       json.RawMessage        `json:"old,omitempty"`
+	New       json.RawMessage        `json:"new,omitempty"`
+	Flow      *assets.FlowReference  `json:"flow,omitempty"`
+	UserID    UserID                 `json:"user_id,omitempty"`
+	ChangedOn time.Time              `json:"changed_on"`
+}
+
+// DynamoKey returns the PK+SK combo used for persistence
+func (c *FieldChange) DynamoKey() dynamo.Key {
+	return dynamo.Key{PK: fmt.Sprintf("con#%s", c.ContactUUID), SK: fmt.Sprintf("fld#%s#%s", c.field.UUID(), c.UUID)}
+}
+
+func (c *FieldChange) MarshalDynamo() (*dynamo.Item, error) {
+	d := &fieldChangeData{Field: c.Field, Flow: c.Flow, UserID: c.UserID, ChangedOn: c.ChangedOn}
+	var err error
+
+	if d.Old, err = c.org.marshalFieldValue(c.field, c.OldValue); err != nil {
+		return nil, err
+	}
+	if d.New, err = c.org.marshalFieldValue(c.field, c.NewValue); err != nil {
+		return nil, err
+	}
+
+	dJSON, err := json.Marshal(d)
+	if err != nil {
+		return nil, fmt.Errorf("error marshaling field change: %w", err)
+	}
+
+	var data map[string]any
+	if err := json.Unmarshal(dJSON, &data); err != nil {
+		return nil, fmt.Errorf("error unmarshaling field change json: %w", err)
+	}
+
+	return &dynamo.Item{
+		Key:   c.DynamoKey(),
+		OrgID: int(c.OrgID),
+		Data:  data,
+	}, nil
+}
+
+// LoadFieldChanges loads the changes to the given field on the given contact, or changes to all fields if field is nil,
+// in the order they were made
+func LoadFieldChanges(ctx context.Context, rt *runtime.Runtime, oa *OrgAssets, contactUUID core.ContactUUID, field *Field) ([]*FieldChange, error) {
+	prefix := "fld#"
+	if field != nil {
+		prefix = fmt.Sprintf("fld#%s#", field.UUID())
+	}
+
+	changes := make([]*FieldChange, 0, 10)
+
+	err := queryFieldChanges(ctx, rt, oa.OrgID(), contactUUID, prefix, func(item *dynamo.Item) error {
+		fieldUUID, eventUUID, _ := strings.Cut(strings.TrimPrefix(item.SK, "fld#"), "#")
+
+		f := oa.FieldByUUID(assets.FieldUUID(fieldUUID))
+		if f == nil {
+			return nil // field has since been deleted
+		}
+
+		d := &fieldChangeData{}
+		if err := jsonx.Unmarshal(jsonx.MustMarshal(item.Data), d); err != nil {
+			return fmt.Errorf("error unmarshaling field change: %w", err)
+		}
+
+		c := &FieldChange{
+			OrgID:       oa.OrgID(),
+			ContactUUID: contactUUID,
+			UUID:        events.EventUUID(eventUUID),
+			Field:       d.Field,
+			Flow:        d.Flow,
+			UserID:      d.UserID,
+			ChangedOn:   d.ChangedOn,
+			org:         oa.Org(),
+			field:       f,
+		}
+
+		var err error
+		if c.OldValue, err = oa.Org().unmarshalFieldValue(f, d.Old); err != nil {
+			return err
+		}
+		if c.NewValue, err = oa.Org().unmarshalFieldValue(f, d.New); err != nil {
+			return err
+		}
+
+		changes = append(changes, c)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// changes to different fields are grouped by field so put everything in time order
+	slices.SortStableFunc(changes, func(a, b *FieldChange) int { return a.ChangedOn.Compare(b.ChangedOn) })
+
+	return changes, nil
+}
+
+// FieldValueAt gets the value of a field at the given time from the changes made to that field and its current value
+func FieldValueAt(changes []*FieldChange, current *core.Value, t time.Time) *core.Value {
+	for i, c := range changes {
+		if c.ChangedOn.After(t) {
+			if i == 0 {
+				return c.OldValue // time is before first recorded change
+			}
+			return changes[i-1].NewValue
+		}
+	}
+	if len(changes) > 0 {
+		return changes[len(changes)-1].NewValue
+	}
+	return current
+}
+
+// DeleteFieldChanges deletes all field changes for the given contact, returning the number of items deleted
+func DeleteFieldChanges(ctx context.Context, rt *runtime.Runtime, orgID OrgID, contactUUID core.ContactUUID) (int, error) {
+	keys := make([]dynamo.Key, 0, 10)
+
+	err := queryFieldChanges(ctx, rt, orgID, contactUUID, "fld#", func(item *dynamo.Item) error {
+		keys = append(keys, item.Key)
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	if err := deleteDynamoItems(ctx, rt.Dynamo.Main, keys); err != nil {
+		return 0, fmt.Errorf("error deleting field changes: %w", err)
+	}
+
+	return len(keys), nil
+}
+
+// queries the field change items for the given contact with the given SK prefix, calling fn for each item which
+// belongs to the given org
+func queryFieldChanges(ctx context.Context, rt *runtime.Runtime, orgID OrgID, contactUUID core.ContactUUID, prefix string, fn func(*dynamo.Item) error) error {
+	paginator := dynamodb.NewQueryPaginator(rt.Dynamo.Main.Client(), &dynamodb.QueryInput{
+		TableName:              aws.String(rt.Dynamo.Main.Table()),
+		KeyConditionExpression: aws.String("PK = :pk AND begins_with(SK, :prefix)"),
+		ExpressionAttributeValues: map[string]dbtypes.AttributeValue{
+			":pk":     &dbtypes.AttributeValueMemberS{Value: fmt.Sprintf("con#%s", contactUUID)},
+			":prefix": &dbtypes.AttributeValueMemberS{Value: prefix},
+		},
+	})
+
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return fmt.Errorf("error querying field changes: %w", err)
+		}
+
+		for _, attrs := range page.Items {
+			item := &dynamo.Item{}
+			if err := attributevalue.UnmarshalMap(attrs, item); err != nil {
+				return fmt.Errorf("error unmarshaling field change item: %w", err)
+			}
+			if item.OrgID != int(orgID) {
+				continue
+			}
+
+			if err := fn(item); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// marshals a field value to its stored form, encrypting it if the field is sensitive
+func (o *Org) marshalFieldValue(field *Field, value *core.Value) (json.RawMessage, error) {
+	if value == nil {
+		return nil, nil
+	}
+	if field != nil && field.Sensitive() {
+		enc, err := o.EncryptFieldValue(field.UUID(), value)
+		if err != nil {
+			return nil, fmt.Errorf("error encrypting field value: %w", err)
+		}
+		return json.Marshal(enc)
+	}
+	return json.Marshal(value)
+}
+
+// unmarshals a field value from its stored form, decrypting it if necessary
+func (o *Org) unmarshalFieldValue(field *Field, raw json.RawMessage) (*core.Value, error) {
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil, nil
+	}
+
+	v := &storedFieldValue{}
+	if err := json.Unmarshal(raw, v); err != nil {
+		return nil, fmt.Errorf("error unmarshaling field value: %w", err)
+	}
+	if v.Enc != "" {
+		if err := o.DecryptFieldValue(field.UUID(), v.Enc, v); err != nil {
+			return nil, err
+		}
+	}
+
+	return core.NewValue(v.Text, v.Datetime, v.Number, v.State, v.District, v.Ward), nil
+}
@@ -0,0 +1,103 @@
+package models_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nyaruka/gocommon/aws/dynamo/dyntest"
+	"github.com/nyaruka/goflow/core/events"
+	"github.com/nyaruka/mailroom/v26/core/models"
+	"github.com/nyaruka/mailroom/v26/testsuite"
+	"github.com/nyaruka/mailroom/v26/testsuite/testdb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFieldChanges(t *testing.T) {
+	ctx, rt := testsuite.Runtime(t)
+
+	rt.DB.MustExec(`UPDATE orgs_org SET config = config || '{"sensitive_fields": ["gender"]}'::jsonb WHERE id = $1`, testdb.Org1.ID)
+
+	oa, err := models.GetOrgAssetsWithRefresh(ctx, rt, testdb.Org1.ID, models.RefreshFields)
+	require.NoError(t, err)
+
+	readEvent := func(s string) *events.ContactFieldChanged {
+		e, err := events.Read([]byte(s))
+		require.NoError(t, err)
+		return e.(*events.ContactFieldChanged)
+	}
+
+	gender := oa.FieldByKey("gender")
+	age := oa.FieldByKey("age")
+	gender1 := readEvent(`{"uuid": "0197b335-6ded-79a4-95a6-3af85b57f101", "type": "contact_field_changed", "created_on": "2025-05-01T12:00:00Z", "field": {"key": "gender", "name": "Gender"}, "value": {"text": "Male"}}`)
+	age1 := readEvent(`{"uuid": "0197b335-6ded-79a4-95a6-3af85b57f102", "type": "contact_field_changed", "created_on": "2025-05-02T12:00:00Z", "field": {"key": "age", "name": "Age"}, "value": {"text": "44", "number": 44}}`)
+	gender2 := readEvent(`{"uuid": "0197b335-6ded-79a4-95a6-3af85b57f103", "type": "contact_field_changed", "created_on": "2025-05-03T12:00:00Z", "field": {"key": "gender", "name": "Gender"}, "value": {"text": "Female"}}`)
+
+	for _, c := range []*models.FieldChange{
+		models.NewFieldChange(oa, testdb.Ann.UUID, gender, gender1, nil, models.NilUserID),
+		models.NewFieldChange(oa, testdb.Ann.UUID, age, age1, nil, testdb.Admin.ID),
+		models.NewFieldChange(oa, testdb.Ann.UUID, gender, gender2, gender1.Value, models.NilUserID),
+	} {
+		_, err := rt.Dynamo.Main.Queue(c)
+		require.NoError(t, err)
+	}
+	rt.Dynamo.Main.Flush()
+
+	// values of sensitive fields are encrypted at rest
+	items := dyntest.ScanAll(t, rt.Dynamo.Main.Client(), rt.Dynamo.Main.Table())
+	require.Len(t, items, 3)
+	assert.Equal(t, "con#a393abc0-283d-4c9b-a1b3-641a035c34bf", items[0].PK)
+	assert.Equal(t, "fld#3a5891e4-756e-4dc9-8e12-b7a766168824#0197b335-6ded-79a4-95a6-3af85b57f101", items[0].SK)
+	assert.Contains(t, items[0].Data["new"], "enc")
+	assert.NotContains(t, items[0].Data, "old")
+	assert.Equal(t, map[string]any{"text": "44", "number": float64(44)}, items[2].Data["new"])
+
+	// load changes to all fields in time order
+	changes, err := models.LoadFieldChanges(ctx, rt, oa, testdb.Ann.UUID, nil)
+	require.NoError(t, err)
+	require.Len(t, changes, 3)
+	assert.Equal(t, "gender", changes[0].Field.Key)
+	assert.Nil(t, changes[0].OldValue)
+	assert.Equal(t, "Male", changes[0].NewValue.Text.Native())
+	assert.Equal(t, "age", changes[1].Field.Key)
+	assert.Equal(t, testdb.Admin.ID, changes[1].UserID)
+	assert.Equal(t, "Male", changes[2].OldValue.Text.Native())
+	assert.Equal(t, "Female", changes[2].NewValue.Text.Native())
+
+	// load changes to a single field
+	changes, err = models.LoadFieldChanges(ctx, rt, oa, testdb.Ann.UUID, gender)
+	require.NoError(t, err)
+	require.Len(t, changes, 2)
+
+	valueAt := func(s string) any {
+		at, err := time.Parse(time.RFC3339, s)
+		require.NoError(t, err)
+
+		v := models.FieldValueAt(changes, nil, at)
+		if v == nil {
+			return nil
+		}
+		return v.Text.Native()
+	}
+
+	assert.Nil(t, valueAt("2025-04-30T12:00:00Z"))
+	assert.Equal(t, "Male", valueAt("2025-05-01T12:00:00Z"))
+	assert.Equal(t, "Male", valueAt("2025-05-02T12:00:00Z"))
+	assert.Equal(t, "Female", valueAt("2025-05-04T12:00:00Z"))
+
+	// with no recorded changes, value is the current value
+	assert.Equal(t, gender1.Value, models.FieldValueAt(nil, gender1.Value, time.Now()))
+
+	// other contacts have no changes
+	changes, err = models.LoadFieldChanges(ctx, rt, oa, testdb.Bob.UUID, nil)
+	require.NoError(t, err)
+	assert.Len(t, changes, 0)
+
+	numDeleted, err := models.DeleteFieldChanges(ctx, rt, testdb.Org1.ID, testdb.Ann.UUID)
+	require.NoError(t, err)
+	assert.Equal(t, 3, numDeleted)
+
+	changes, err = models.LoadFieldChanges(ctx, rt, oa, testdb.Ann.UUID, nil)
+	require.NoError(t, err)
+	assert.Len(t, changes, 0)
+}
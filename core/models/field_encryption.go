@@ -0,0 +1,243 @@
+package models
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/lib/pq"
+	"github.com/nyaruka/gocommon/jsonx"
+	"github.com/nyaruka/goflow/assets"
+)
+
+// EncryptedFieldValue is how the value of a sensitive field is stored in the fields JSON of a contact. The value JSON
+// is encrypted with AES-GCM using the org's fields key and the field UUID as additional data, so that a value can't be
+// moved to another field or org and still decrypt. It's prefixed with the id of the key, e.g. 1a2b3c4d:<base64>, so
+// that values can be decrypted during a key rotation.
+type EncryptedFieldValue struct {
+	Enc string `json:"enc"`
+}
+
+// fieldsKey is an org's key for encrypting field values, derived from a configured fields encryption key
+type fieldsKey struct {
+	id  string // identifies the configured key it was derived from, the same for all orgs
+	key []byte
+}
+
+const sqlSelectAnyOrgHasSensitiveFields = `
+SELECT EXISTS(
+    SELECT 1 FROM orgs_org WHERE is_active AND jsonb_array_length(COALESCE(config->'sensitive_fields', '[]')) > 0
+)`
+
+// AnyOrgHasSensitiveFields returns whether any active org has sensitive fields configured, i.e. whether we need a
+// fields encryption key to be able to write their values
+func AnyOrgHasSensitiveFields(ctx context.Context, db DBorTx) (bool, error) {
+	var has bool
+	if err := db.GetContext(ctx, &has, sqlSelectAnyOrgHasSensitiveFields); err != nil {
+		return false, fmt.Errorf("error checking for orgs with sensitive fields: %w", err)
+	}
+	return has, nil
+}
+
+// derives an org's fields keys from the configured fields encryption keys, the current key first then the old key if
+// there is one
+func deriveFieldsKeys(orgID OrgID, current, old []byte) []*fieldsKey {
+	if len(current) == 0 {
+		return nil
+	}
+
+	keys := []*fieldsKey{deriveFieldsKey(current, orgID)}
+	if len(old) > 0 {
+		keys = append(keys, deriveFieldsKey(old, orgID))
+	}
+	return keys
+}
+
+func deriveFieldsKey(master []byte, orgID OrgID) *fieldsKey {
+	idMac := hmac.New(sha256.New, master)
+	idMac.Write([]byte("id"))
+
+	mac := hmac.New(sha256.New, master)
+	fmt.Fprintf(mac, "fields:%d", orgID)
+
+	return &fieldsKey{id: hex.EncodeToString(idMac.Sum(nil)[:4]), key: mac.Sum(nil)}
+}
+
+// EncryptFieldValue encrypts the given value of the given field with the current key
+func (o *Org) EncryptFieldValue(fieldUUID assets.FieldUUID, value any) (*EncryptedFieldValue, error) {
+	if len(o.fieldsKeys) == 0 {
+		return nil, errors.New("no fields encryption key configured")
+	}
+
+	aead, err := o.fieldsKeys[0].cipher()
+	if err != nil {
+		return nil, err
+	}
+
+	plain, err := json.Marshal(value)
+	if err != nil {
+		return nil, fmt.Errorf("error marshaling field value: %w", err)
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("error generating nonce: %w", err)
+	}
+
+	sealed := aead.Seal(nonce, nonce, plain, []byte(fieldUUID))
+
+	return &EncryptedFieldValue{Enc: o.fieldsKeys[0].id + ":" + base64.StdEncoding.EncodeToString(sealed)}, nil
+}
+
+// DecryptFieldValue decrypts the given encrypted value of the given field into dst, using whichever of the current or
+// old keys it was encrypted with
+func (o *Org) DecryptFieldValue(fieldUUID assets.FieldUUID, enc string, dst any) error {
+	if len(o.fieldsKeys) == 0 {
+		return errors.New("no fields encryption key configured")
+	}
+
+	keyID, data, _ := strings.Cut(enc, ":")
+
+	var key *fieldsKey
+	for _, k := range o.fieldsKeys {
+		if k.id == keyID {
+			key = k
+		}
+	}
+	if key == nil {
+		return fmt.Errorf("value for field %s is encrypted with unknown key %s", fieldUUID, keyID)
+	}
+
+	aead, err := key.cipher()
+	if err != nil {
+		return err
+	}
+
+	sealed, err := base64.StdEncoding.DecodeString(data)
+	if err != nil || len(sealed) < aead.NonceSize() {
+		return fmt.Errorf("invalid encrypted value for field %s", fieldUUID)
+	}
+
+	plain, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], []byte(fieldUUID))
+	if err != nil {
+		return fmt.Errorf("error decrypting value for field %s: %w", fieldUUID, err)
+	}
+
+	if err := json.Unmarshal(plain, dst); err != nil {
+		return fmt.Errorf("error unmarshaling value for field %s: %w", fieldUUID, err)
+	}
+	return nil
+}
+
+// returns whether the given encrypted value was encrypted with the current key
+func (o *Org) isFieldValueCurrent(enc string) bool {
+	return len(o.fieldsKeys) > 0 && strings.HasPrefix(enc, o.fieldsKeys[0].id+":")
+}
+
+func (k *fieldsKey) cipher() (cipher.AEAD, error) {
+	block, err := aes.NewCipher(k.key)
+	if err != nil {
+		return nil, fmt.Errorf("error creating fields cipher: %w", err)
+	}
+	return cipher.NewGCM(block)
+}
+
+const sqlSelectContactFieldsToEncryptPage = `
+SELECT id, fields
+  FROM contacts_contact
+ WHERE org_id = $1 AND is_active = TRUE AND id > $2 AND EXISTS(
+    SELECT 1 FROM unnest($3::text[]) f WHERE fields->f ? 'text' OR fields->f->>'enc' NOT LIKE $4
+ )
+ ORDER BY id
+ LIMIT $5`
+
+const sqlUpdateContactFieldsEncrypted = `
+UPDATE contacts_contact c
+   SET fields = c.fields || r.updates
+  FROM (VALUES(:contact_id::int, :updates::jsonb)) AS r(contact_id, updates)
+ WHERE c.id = r.contact_id`
+
+type encryptedFieldsUpdate struct {
+	ContactID ContactID `db:"contact_id"`
+	Updates   string    `db:"updates"`
+}
+
+// EncryptContactFieldsPage encrypts any values of sensitive fields which are stored in plaintext, e.g. because the field
+// was marked sensitive after they were written, or re-encrypts those encrypted with the old key, for the next page of
+// contacts after the given ID. Returns the IDs of the contacts which were updated, which is empty once there are no
+// more such contacts.
+func EncryptContactFieldsPage(ctx context.Context, db DBorTx, oa *OrgAssets, afterID ContactID, limit int) ([]ContactID, error) {
+	fields, _ := oa.Fields()
+	sensitive := make([]assets.FieldUUID, 0, 2)
+	for _, f := range fields {
+		if f.(*Field).Sensitive() {
+			sensitive = append(sensitive, f.UUID())
+		}
+	}
+	if len(sensitive) == 0 || len(oa.Org().fieldsKeys) == 0 {
+		return nil, nil
+	}
+
+	rows, err := db.QueryContext(ctx, sqlSelectContactFieldsToEncryptPage, oa.OrgID(), afterID, pq.Array(sensitive), oa.Org().fieldsKeys[0].id+":%", limit)
+	if err != nil {
+		return nil, fmt.Errorf("error querying contacts with plaintext sensitive fields: %w", err)
+	}
+	defer rows.Close()
+
+	contactIDs := make([]ContactID, 0, limit)
+	updates := make([]*encryptedFieldsUpdate, 0, limit)
+
+	for rows.Next() {
+		var contactID ContactID
+		var fieldsJSON []byte
+		if err := rows.Scan(&contactID, &fieldsJSON); err != nil {
+			return nil, fmt.Errorf("error scanning contact fields: %w", err)
+		}
+
+		values := make(map[assets.FieldUUID]*storedFieldValue)
+		if err := json.Unmarshal(fieldsJSON, &values); err != nil {
+			return nil, fmt.Errorf("error unmarshaling fields of contact #%d: %w", contactID, err)
+		}
+
+		encrypted := make(map[assets.FieldUUID]*EncryptedFieldValue, len(sensitive))
+		for _, fieldUUID := range sensitive {
+			v := values[fieldUUID]
+			if v == nil || oa.Org().isFieldValueCurrent(v.Enc) {
+				continue
+			}
+			if v.Enc != "" {
+				if err := oa.Org().DecryptFieldValue(fieldUUID, v.Enc, v); err != nil {
+					slog.Error("error decrypting field value to re-encrypt", "contact", contactID, "field", fieldUUID, "error", err)
+					continue
+				}
+				v.Enc = ""
+			}
+
+			if encrypted[fieldUUID], err = oa.Org().EncryptFieldValue(fieldUUID, v); err != nil {
+				return nil, fmt.Errorf("error encrypting field value: %w", err)
+			}
+		}
+
+		contactIDs = append(contactIDs, contactID)
+		updates = append(updates, &encryptedFieldsUpdate{ContactID: contactID, Updates: string(jsonx.MustMarshal(encrypted))})
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating contacts with plaintext sensitive fields: %w", err)
+	}
+
+	if err := BulkQuery(ctx, "encrypting contact field values", db, sqlUpdateContactFieldsEncrypted, updates); err != nil {
+		return nil, fmt.Errorf("error encrypting contact field values: %w", err)
+	}
+
+	return contactIDs, nil
+}
@@ -1,8 +1,12 @@
 package models_test
 
 import (
+	"bytes"
+	"strings"
 	"testing"
 
+	"github.com/nyaruka/gocommon/dbutil/assertdb"
+	"github.com/nyaruka/gocommon/jsonx"
 	"github.com/nyaruka/goflow/assets"
 	"github.com/nyaruka/mailroom/v26/core/models"
 	"github.com/nyaruka/mailroom/v26/testsuite"
@@ -49,3 +53,125 @@ func TestFields(t *testing.T) {
 		assert.Equal(t, tc.valueType, field.Type())
 	}
 }
+
+func TestSensitiveFields(t *testing.T) {
+	ctx, rt := testsuite.Runtime(t)
+
+	rt.DB.MustExec(`UPDATE orgs_org SET config = config || '{"sensitive_fields": ["gender"]}'::jsonb WHERE id = $1`, testdb.Org1.ID)
+
+	oa, err := models.GetOrgAssetsWithRefresh(ctx, rt, testdb.Org1.ID, models.RefreshFields)
+	require.NoError(t, err)
+
+	assert.True(t, oa.FieldByKey("gender").Sensitive())
+	assert.False(t, oa.FieldByKey("age").Sensitive())
+
+	enc, err := oa.Org().EncryptFieldValue(testdb.GenderField.UUID, map[string]any{"text": "F"})
+	require.NoError(t, err)
+
+	// value can't be decrypted as another field
+	var decrypted map[string]any
+	assert.Error(t, oa.Org().DecryptFieldValue(testdb.AgeField.UUID, enc.Enc, &decrypted))
+	assert.NoError(t, oa.Org().DecryptFieldValue(testdb.GenderField.UUID, enc.Enc, &decrypted))
+	assert.Equal(t, map[string]any{"text": "F"}, decrypted)
+
+	// encrypted values are decrypted when contacts are loaded
+	rt.DB.MustExec(`UPDATE contacts_contact SET fields = fields || jsonb_build_object($2::text, $3::jsonb) WHERE id = $1`, testdb.Ann.ID, testdb.GenderField.UUID, string(jsonx.MustMarshal(enc)))
+
+	contact, err := models.LoadContact(ctx, rt.DB, oa, testdb.Ann.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "F", contact.Fields()["gender"].Text.Native())
+
+	ec, err := contact.EngineContact(oa)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"F"}, models.SensitiveFieldValues(oa, ec))
+
+	// rotate the key so that the value was encrypted with the old key
+	oldKey := rt.Config.FieldsEncryptionKeyParsed
+	defer func() {
+		rt.Config.FieldsEncryptionKeyParsed = oldKey
+		rt.Config.FieldsEncryptionKeyOldParsed = nil
+	}()
+
+	rt.Config.FieldsEncryptionKeyOldParsed = oldKey
+	rt.Config.FieldsEncryptionKeyParsed = bytes.Repeat([]byte{0x42}, 32)
+
+	oa, err = models.GetOrgAssetsWithRefresh(ctx, rt, testdb.Org1.ID, models.RefreshOrg)
+	require.NoError(t, err)
+
+	contact, err = models.LoadContact(ctx, rt.DB, oa, testdb.Ann.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "F", contact.Fields()["gender"].Text.Native())
+
+	// new values are encrypted with the new key, and old values are re-encrypted with it
+	newEnc, err := oa.Org().EncryptFieldValue(testdb.GenderField.UUID, map[string]any{"text": "M"})
+	require.NoError(t, err)
+	assert.NotEqual(t, strings.Split(enc.Enc, ":")[0], strings.Split(newEnc.Enc, ":")[0])
+
+	contactIDs, err := models.EncryptContactFieldsPage(ctx, rt.DB, oa, models.NilContactID, 100)
+	require.NoError(t, err)
+	assert.Contains(t, contactIDs, testdb.Ann.ID)
+
+	assertdb.Query(t, rt.DB, `SELECT count(*) FROM contacts_contact WHERE id = $1 AND fields->$2->>'enc' LIKE $3`, testdb.Ann.ID, testdb.GenderField.UUID, strings.Split(newEnc.Enc, ":")[0]+":%").Returns(1)
+
+	// once the old key is retired, values still encrypted with it are skipped rather than failing the load
+	rt.DB.MustExec(`UPDATE contacts_contact SET fields = fields || jsonb_build_object($2::text, $3::jsonb) WHERE id = $1`, testdb.Bob.ID, testdb.GenderField.UUID, string(jsonx.MustMarshal(enc)))
+	rt.Config.FieldsEncryptionKeyOldParsed = nil
+
+	oa, err = models.GetOrgAssetsWithRefresh(ctx, rt, testdb.Org1.ID, models.RefreshOrg)
+	require.NoError(t, err)
+
+	contacts, err := models.LoadContacts(ctx, rt.DB, oa, []models.ContactID{testdb.Ann.ID, testdb.Bob.ID})
+	require.NoError(t, err)
+	require.Len(t, contacts, 2)
+	assert.Equal(t, "F", contacts[0].Fields()["gender"].Text.Native())
+	assert.Nil(t, contacts[1].Fields()["gender"])
+}
+
+func TestComputedFields(t *testing.T) {
+	ctx, rt := testsuite.Runtime(t)
+
+	rt.DB.MustExec(`UPDATE orgs_org SET config = config || '{"computed_fields": {"gender": "@(upper(contact.name))", "age": "@(datetime_diff(fields.joined, today(), \"Y\"))"}}'::jsonb WHERE id = $1`, testdb.Org1.ID)
+
+	oa, err := models.GetOrgAssetsWithRefresh(ctx, rt, testdb.Org1.ID, models.RefreshFields)
+	require.NoError(t, err)
+
+	gender, age, joined := oa.FieldByKey("gender"), oa.FieldByKey("age"), oa.FieldByKey("joined")
+
+	assert.Equal(t, "@(upper(contact.name))", gender.Expression())
+	assert.True(t, gender.Computed())
+	assert.False(t, gender.TimeDependent())
+	assert.True(t, age.Computed())
+	assert.True(t, age.TimeDependent())
+	assert.False(t, age.DependsOnNow())
+	assert.Equal(t, "", joined.Expression())
+	assert.False(t, joined.Computed())
+	assert.False(t, joined.TimeDependent())
+
+	contact, err := models.LoadContact(ctx, rt.DB, oa, testdb.Ann.ID)
+	require.NoError(t, err)
+	ec, err := contact.EngineContact(oa)
+	require.NoError(t, err)
+
+	value, err := models.ComputeFieldValue(ctx, rt, oa, gender, ec)
+	assert.NoError(t, err)
+	assert.Equal(t, "ANN", value)
+
+	// inputs are found by parsing the expression, so a mention of a function in a string isn't a call
+	rt.DB.MustExec(`UPDATE orgs_org SET config = config || '{"computed_fields": {"gender": "@(upper(contact.name)) today()", "age": "@(datetime_diff(contact.fields.joined, now(), \"h\"))"}}'::jsonb WHERE id = $1`, testdb.Org1.ID)
+
+	oa, err = models.GetOrgAssetsWithRefresh(ctx, rt, testdb.Org1.ID, models.RefreshFields)
+	require.NoError(t, err)
+
+	gender, age = oa.FieldByKey("gender"), oa.FieldByKey("age")
+
+	assert.False(t, gender.TimeDependent())
+	keys, only := gender.InputFieldKeys()
+	assert.Len(t, keys, 0)
+	assert.False(t, only)
+
+	assert.True(t, age.TimeDependent())
+	assert.True(t, age.DependsOnNow())
+	keys, only = age.InputFieldKeys()
+	assert.Equal(t, []string{"joined"}, keys)
+	assert.True(t, only)
+}
@@ -0,0 +1,292 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"time"
+
+	valkey "github.com/gomodule/redigo/redis"
+	"github.com/nyaruka/gocommon/jsonx"
+	"github.com/nyaruka/mailroom/v26/runtime"
+)
+
+const configFrequencyCaps = "frequency_caps"
+
+// how long we keep daily send counters around for - long enough to outlast a week in any timezone
+const frequencySendsExpiry = time.Hour * 24 * 8
+
+// FrequencyCaps limit how many broadcast and campaign messages each contact can be sent, configured as frequency_caps
+// in the org config, e.g. {"day": 2, "week": 5, "defer": true}. Days are in the org's timezone and weeks are the last
+// 7 days including today. Contacts who have reached a cap are skipped, or if defer is set, have their sends deferred
+// to the start of the next day.
+type FrequencyCaps struct {
+	Day   int  `json:"day,omitempty"`
+	Week  int  `json:"week,omitempty"`
+	Defer bool `json:"defer,omitempty"`
+}
+
+// FrequencyCaps returns the frequency caps configured for this org, or nil if there are none
+func (o *Org) FrequencyCaps() *FrequencyCaps {
+	raw, ok := o.o.Config[configFrequencyCaps]
+	if !ok || raw == nil {
+		return nil
+	}
+
+	caps := &FrequencyCaps{}
+	if err := jsonx.Unmarshal(jsonx.MustMarshal(raw), caps); err != nil {
+		slog.Error("invalid frequency caps in org config", "org_id", o.ID(), "error", err)
+		return nil
+	}
+	if caps.Day <= 0 && caps.Week <= 0 {
+		return nil
+	}
+	return caps
+}
+
+// key for the hash of the number of capped messages sent to each contact on the given day
+func frequencySendsKey(oa *OrgAssets, day time.Time) string {
+	return fmt.Sprintf("frequency_sends:%d:%s", oa.OrgID(), day.Format("2006-01-02"))
+}
+
+// fetches the counts of each contact for today and the 6 days before that, and reserves a send for each contact who
+// hasn't reached a cap by incrementing their count for today, so that checking and recording sends is atomic
+//
+//	KEYS: the daily counts key of today and each of the 6 days before
+//	ARGV: day cap (0 for none), week cap (0 for none), expiry, contact ids...
+//
+// Returns 1 for each contact who has reached a cap, 0 for each contact who has had a send reserved.
+var frequencyReserveScript = valkey.NewScript(7, `
+local day_cap, week_cap, expiry = tonumber(ARGV[1]), tonumber(ARGV[2]), tonumber(ARGV[3])
+local result = {}
+
+for i = 4, #ARGV do
+	local day = tonumber(redis.call("HGET", KEYS[1], ARGV[i]) or "0")
+	local week = day
+	for k = 2, #KEYS do
+		week = week + tonumber(redis.call("HGET", KEYS[k], ARGV[i]) or "0")
+	end
+
+	if (day_cap > 0 and day >= day_cap) or (week_cap > 0 and week >= week_cap) then
+		table.insert(result, 1)
+	else
+		redis.call("HINCRBY", KEYS[1], ARGV[i], 1)
+		table.insert(result, 0)
+	end
+end
+
+redis.call("EXPIRE", KEYS[1], expiry)
+return result
+`)
+
+// releases sends previously reserved for each contact, without letting counts go negative
+//
+//	KEYS: the daily counts key of the day the sends were reserved
+//	ARGV: contact ids...
+var frequencyReleaseScript = valkey.NewScript(1, `
+for i = 1, #ARGV do
+	if tonumber(redis.call("HGET", KEYS[1], ARGV[i]) or "0") > 0 then
+		redis.call("HINCRBY", KEYS[1], ARGV[i], -1)
+	end
+end
+return 0
+`)
+
+// Reserve splits the given contacts into those who can be sent another message and those who have reached a cap, and
+// counts a send towards the caps of each contact who can be sent one. Sends which end up not being made should be
+// released with ReleaseFrequencySends using the same time.
+func (c *FrequencyCaps) Reserve(ctx context.Context, rt *runtime.Runtime, oa *OrgAssets, contactIDs []ContactID, now time.Time) ([]ContactID, []ContactID, error) {
+	if len(contactIDs) == 0 {
+		return contactIDs, nil, nil
+	}
+
+	vc := rt.VK.Get()
+	defer vc.Close()
+
+	today := now.In(oa.Env().Timezone())
+	args := valkey.Args{}
+	for d := range 7 {
+		args = args.Add(frequencySendsKey(oa, today.AddDate(0, 0, -d)))
+	}
+	args = args.Add(c.Day, c.Week, int(frequencySendsExpiry/time.Second))
+	for _, id := range contactIDs {
+		args = args.Add(int64(id))
+	}
+
+	results, err := valkey.Ints(frequencyReserveScript.DoContext(ctx, vc, args...))
+	if err != nil {
+		return nil, nil, fmt.Errorf("error reserving frequency sends: %w", err)
+	}
+
+	allowed := make([]ContactID, 0, len(contactIDs))
+	var capped []ContactID
+
+	for i, id := range contactIDs {
+		if results[i] == 1 {
+			capped = append(capped, id)
+		} else {
+			allowed = append(allowed, id)
+		}
+	}
+
+	return allowed, capped, nil
+}
+
+// DeferUntil returns when sends to contacts who have reached a cap are deferred until, which is the start of the next
+// day in the org timezone
+func (c *FrequencyCaps) DeferUntil(oa *OrgAssets, now time.Time) time.Time {
+	local := now.In(oa.Env().Timezone())
+	return time.Date(local.Year(), local.Month(), local.Day()+1, 0, 0, 0, 0, local.Location())
+}
+
+// reads the counts of each of the given contacts for the day of the given time and the 6 days before that, keyed by
+// date in the org timezone, without reserving any sends
+func (c *FrequencyCaps) sendCounts(ctx context.Context, rt *runtime.Runtime, oa *OrgAssets, contactIDs []ContactID, now time.Time) (map[ContactID]map[string]int, error) {
+	counts := make(map[ContactID]map[string]int, len(contactIDs))
+	if len(contactIDs) == 0 {
+		return counts, nil
+	}
+
+	vc := rt.VK.Get()
+	defer vc.Close()
+
+	today := now.In(oa.Env().Timezone())
+
+	for d := range 7 {
+		day := today.AddDate(0, 0, -d)
+		args := valkey.Args{}.Add(frequencySendsKey(oa, day))
+		for _, id := range contactIDs {
+			args = args.Add(int64(id))
+		}
+
+		dayCounts, err := valkey.Ints(valkey.DoContext(vc, ctx, "HMGET", args...))
+		if err != nil {
+			return nil, fmt.Errorf("error reading frequency sends: %w", err)
+		}
+
+		for i, id := range contactIDs {
+			if dayCounts[i] > 0 {
+				if counts[id] == nil {
+					counts[id] = make(map[string]int, 7)
+				}
+				counts[id][day.Format("2006-01-02")] = dayCounts[i]
+			}
+		}
+	}
+
+	return counts, nil
+}
+
+// returns whether a contact with the given daily counts, keyed by date in the org timezone, has reached a cap at the
+// given time, using the same rules as the reserve script
+func (c *FrequencyCaps) reached(oa *OrgAssets, counts map[string]int, t time.Time) bool {
+	local := t.In(oa.Env().Timezone())
+	day := counts[local.Format("2006-01-02")]
+	week := day
+	for d := 1; d < 7; d++ {
+		week += counts[local.AddDate(0, 0, -d).Format("2006-01-02")]
+	}
+
+	return (c.Day > 0 && day >= c.Day) || (c.Week > 0 && week >= c.Week)
+}
+
+// ReleaseFrequencySends releases the sends reserved for the given contacts at the given time which weren't made
+func ReleaseFrequencySends(ctx context.Context, rt *runtime.Runtime, oa *OrgAssets, contactIDs []ContactID, reservedOn time.Time) error {
+	if len(contactIDs) == 0 {
+		return nil
+	}
+
+	vc := rt.VK.Get()
+	defer vc.Close()
+
+	args := valkey.Args{}.Add(frequencySendsKey(oa, reservedOn.In(oa.Env().Timezone())))
+	for _, id := range contactIDs {
+		args = args.Add(int64(id))
+	}
+
+	if _, err := frequencyReleaseScript.DoContext(ctx, vc, args...); err != nil {
+		return fmt.Errorf("error releasing frequency sends: %w", err)
+	}
+	return nil
+}
+
+// the item count scope used to count the contacts capped by a broadcast
+func broadcastCappedScope(bcastID BroadcastID) string {
+	return fmt.Sprintf("broadcast:%d:capped", bcastID)
+}
+
+const sqlInsertBroadcastCapped = `INSERT INTO orgs_itemcount(org_id, scope, count, is_squashed) VALUES($1, $2, $3, FALSE)`
+
+// RecordBroadcastCapped adds to the count of contacts who were skipped or deferred by the given broadcast because they
+// had reached a frequency cap. Counts are stored as item counts of the broadcast so that they live as long as it does.
+func RecordBroadcastCapped(ctx context.Context, db DBorTx, bcast *Broadcast, count int) error {
+	if _, err := db.ExecContext(ctx, sqlInsertBroadcastCapped, bcast.OrgID, broadcastCappedScope(bcast.ID), count); err != nil {
+		return fmt.Errorf("error recording capped contacts for broadcast #%d: %w", bcast.ID, err)
+	}
+	return nil
+}
+
+const sqlSelectBroadcastCapped = `SELECT COALESCE(SUM(count), 0) FROM orgs_itemcount WHERE org_id = $1 AND scope = $2`
+
+// GetBroadcastCapped returns the number of contacts who were skipped or deferred by the given broadcast because they
+// had reached a frequency cap
+func GetBroadcastCapped(ctx context.Context, db *sql.DB, bcast *Broadcast) (int, error) {
+	var count int
+	if err := db.QueryRowContext(ctx, sqlSelectBroadcastCapped, bcast.OrgID, broadcastCappedScope(bcast.ID)).Scan(&count); err != nil {
+		return 0, fmt.Errorf("error reading capped contacts for broadcast #%d: %w", bcast.ID, err)
+	}
+	return count, nil
+}
+
+// CapCampaignFires applies the org's frequency caps to the given due fires for a message campaign point. Fires for
+// contacts who have reached a cap are either deferred to the next day or deleted. Returns the fires which can be
+// fired now, which have had sends reserved, and the number which were capped.
+func CapCampaignFires(ctx context.Context, rt *runtime.Runtime, oa *OrgAssets, fires []*ContactFire, now time.Time) ([]*ContactFire, int, error) {
+	caps := oa.Org().FrequencyCaps()
+	if caps == nil {
+		return fires, 0, nil
+	}
+
+	contactIDs := make([]ContactID, len(fires))
+	for i, f := range fires {
+		contactIDs[i] = f.ContactID
+	}
+
+	_, capped, err := caps.Reserve(ctx, rt, oa, contactIDs, now)
+	if err != nil {
+		return nil, 0, err
+	}
+	if len(capped) == 0 {
+		return fires, 0, nil
+	}
+
+	isCapped := make(map[ContactID]bool, len(capped))
+	for _, id := range capped {
+		isCapped[id] = true
+	}
+
+	due := make([]*ContactFire, 0, len(fires))
+	cappedFires := make([]*ContactFire, 0, len(capped))
+	for _, f := range fires {
+		if isCapped[f.ContactID] {
+			cappedFires = append(cappedFires, f)
+		} else {
+			due = append(due, f)
+		}
+	}
+
+	if caps.Defer {
+		until := caps.DeferUntil(oa, now)
+		for _, f := range cappedFires {
+			f.FireOn = until
+		}
+		if err := BulkQueryBatches(ctx, "deferring capped campaign fires", rt.DB, sqlUpdateContactFireOn, 1000, cappedFires); err != nil {
+			return nil, 0, err
+		}
+	} else if err := DeleteContactFires(ctx, rt, cappedFires); err != nil {
+		return nil, 0, err
+	}
+
+	return due, len(cappedFires), nil
+}
@@ -0,0 +1,123 @@
+package models_test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/nyaruka/gocommon/dbutil/assertdb"
+	"github.com/nyaruka/mailroom/v26/core/models"
+	"github.com/nyaruka/mailroom/v26/testsuite"
+	"github.com/nyaruka/mailroom/v26/testsuite/testdb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFrequencyCaps(t *testing.T) {
+	ctx, rt := testsuite.Runtime(t)
+
+	oa := testdb.Org1.Load(t, rt)
+	assert.Nil(t, oa.Org().FrequencyCaps())
+
+	rt.DB.MustExec(`UPDATE orgs_org SET config = config || '{"frequency_caps": {"day": 2, "week": 3}}'::jsonb WHERE id = $1`, testdb.Org1.ID)
+
+	oa, err := models.GetOrgAssetsWithRefresh(ctx, rt, testdb.Org1.ID, models.RefreshOrg)
+	require.NoError(t, err)
+
+	caps := oa.Org().FrequencyCaps()
+	require.NotNil(t, caps)
+	assert.Equal(t, &models.FrequencyCaps{Day: 2, Week: 3}, caps)
+
+	// 16:00 UTC is 09:00 in LA
+	now := time.Date(2025, 5, 5, 16, 0, 0, 0, time.UTC)
+	contactIDs := []models.ContactID{testdb.Ann.ID, testdb.Bob.ID, testdb.Cat.ID}
+
+	// Ann has been sent 2 messages today, Bob 1 today and 2 earlier in the week, Cat 1 yesterday
+	allowed, _, err := caps.Reserve(ctx, rt, oa, []models.ContactID{testdb.Bob.ID}, now.Add(-6*24*time.Hour))
+	require.NoError(t, err)
+	assert.Len(t, allowed, 1)
+	allowed, _, err = caps.Reserve(ctx, rt, oa, []models.ContactID{testdb.Bob.ID, testdb.Cat.ID}, now.Add(-24*time.Hour))
+	require.NoError(t, err)
+	assert.Len(t, allowed, 2)
+	allowed, _, err = caps.Reserve(ctx, rt, oa, []models.ContactID{testdb.Ann.ID, testdb.Ann.ID, testdb.Bob.ID}, now)
+	require.NoError(t, err)
+	assert.Len(t, allowed, 3)
+
+	allowed, capped, err := caps.Reserve(ctx, rt, oa, contactIDs, now)
+	require.NoError(t, err)
+	assert.Equal(t, []models.ContactID{testdb.Cat.ID}, allowed)
+	assert.Equal(t, []models.ContactID{testdb.Ann.ID, testdb.Bob.ID}, capped)
+
+	// Cat's send was reserved so only one more can be reserved today
+	allowed, capped, err = caps.Reserve(ctx, rt, oa, []models.ContactID{testdb.Cat.ID, testdb.Cat.ID}, now)
+	require.NoError(t, err)
+	assert.Equal(t, []models.ContactID{testdb.Cat.ID}, allowed)
+	assert.Equal(t, []models.ContactID{testdb.Cat.ID}, capped)
+
+	// until sends are released, and releasing more sends than were reserved doesn't make the count negative
+	require.NoError(t, models.ReleaseFrequencySends(ctx, rt, oa, []models.ContactID{testdb.Cat.ID, testdb.Cat.ID, testdb.Cat.ID}, now))
+
+	allowed, capped, err = caps.Reserve(ctx, rt, oa, []models.ContactID{testdb.Cat.ID, testdb.Cat.ID, testdb.Cat.ID}, now)
+	require.NoError(t, err)
+	assert.Equal(t, []models.ContactID{testdb.Cat.ID, testdb.Cat.ID}, allowed)
+	assert.Equal(t, []models.ContactID{testdb.Cat.ID}, capped)
+
+	require.NoError(t, models.ReleaseFrequencySends(ctx, rt, oa, []models.ContactID{testdb.Cat.ID, testdb.Cat.ID}, now))
+
+	// the next day, Ann's count for the day is reset and Bob's oldest send no longer counts towards the week
+	allowed, capped, err = caps.Reserve(ctx, rt, oa, []models.ContactID{testdb.Ann.ID, testdb.Bob.ID}, now.Add(24*time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, []models.ContactID{testdb.Ann.ID, testdb.Bob.ID}, allowed)
+	assert.Empty(t, capped)
+
+	// capped sends are deferred to midnight in the org timezone
+	assert.Equal(t, time.Date(2025, 5, 6, 7, 0, 0, 0, time.UTC), caps.DeferUntil(oa, now).UTC())
+
+	// counts of capped broadcast contacts accumulate
+	bcast := &models.Broadcast{ID: 12345, OrgID: testdb.Org1.ID}
+	count, err := models.GetBroadcastCapped(ctx, rt.ReadonlyDB, bcast)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, count)
+
+	require.NoError(t, models.RecordBroadcastCapped(ctx, rt.DB, bcast, 2))
+	require.NoError(t, models.RecordBroadcastCapped(ctx, rt.DB, bcast, 3))
+
+	count, err = models.GetBroadcastCapped(ctx, rt.ReadonlyDB, bcast)
+	assert.NoError(t, err)
+	assert.Equal(t, 5, count)
+
+	// capped campaign fires are deleted
+	for _, c := range []*testdb.Contact{testdb.Ann, testdb.Cat} {
+		testdb.InsertContactFire(t, rt, testdb.Org1, c, models.ContactFireTypeCampaignPoint, fmt.Sprintf("%d:1", testdb.RemindersPoint2.ID), time.Now().Add(-time.Second), "")
+	}
+
+	fires, err := models.LoadDueContactfires(ctx, rt, 10)
+	require.NoError(t, err)
+	require.Len(t, fires, 2)
+
+	due, numCapped, err := models.CapCampaignFires(ctx, rt, oa, fires, now)
+	require.NoError(t, err)
+	assert.Equal(t, 1, numCapped)
+	assert.Len(t, due, 1)
+	assert.Equal(t, testdb.Cat.ID, due[0].ContactID)
+
+	assertdb.Query(t, rt.DB, `SELECT contact_id FROM contacts_contactfire`).Returns(int64(testdb.Cat.ID))
+
+	// or if caps defer, pushed back to the next day
+	rt.DB.MustExec(`UPDATE orgs_org SET config = config || '{"frequency_caps": {"day": 2, "defer": true}}'::jsonb WHERE id = $1`, testdb.Org1.ID)
+	oa, err = models.GetOrgAssetsWithRefresh(ctx, rt, testdb.Org1.ID, models.RefreshOrg)
+	require.NoError(t, err)
+
+	testdb.InsertContactFire(t, rt, testdb.Org1, testdb.Ann, models.ContactFireTypeCampaignPoint, fmt.Sprintf("%d:1", testdb.RemindersPoint2.ID), time.Now().Add(-time.Second), "")
+
+	fires, err = models.LoadDueContactfires(ctx, rt, 10)
+	require.NoError(t, err)
+	require.Len(t, fires, 2)
+
+	due, numCapped, err = models.CapCampaignFires(ctx, rt, oa, fires, now)
+	require.NoError(t, err)
+	assert.Equal(t, 1, numCapped)
+	assert.Len(t, due, 1)
+
+	assertdb.Query(t, rt.DB, `SELECT fire_on = '2025-05-06T07:00:00Z' FROM contacts_contactfire WHERE contact_id = $1`, testdb.Ann.ID).Returns(true)
+}
@@ -3,6 +3,9 @@ package models
 import (
 	"context"
 	"database/sql/driver"
+	"fmt"
+	"regexp"
+	"strings"
 	"time"
 
 	"github.com/nyaruka/null/v3"
@@ -86,3 +89,59 @@ func (i *HTTPLogID) Scan(value any) error         { return null.ScanInt(value, i
 func (i HTTPLogID) Value() (driver.Value, error)  { return null.IntValue(i) }
 func (i *HTTPLogID) UnmarshalJSON(b []byte) error { return null.UnmarshalInt(b, i) }
 func (i HTTPLogID) MarshalJSON() ([]byte, error)  { return null.MarshalInt(i) }
+
+// the minimum length of a value for a log containing it to be considered as mentioning it, so that short values can't
+// match unrelated logs
+const httpLogMentionMinLength = 8
+
+// the number of ids in each range of HTTP logs we check for mentions, so that no single delete has to scan them all
+const httpLogMentionBatchSize = 10000
+
+const sqlSelectHTTPLogIDRange = `
+SELECT COALESCE(min(id), 0) AS min_id, COALESCE(max(id), 0) AS max_id FROM request_logs_httplog WHERE org_id = $1 AND created_on >= $2`
+
+const sqlDeleteHTTPLogsMentioning = `
+DELETE FROM request_logs_httplog
+ WHERE id >= $1 AND id < $2 AND org_id = $3 AND created_on >= $4 AND (url ~ $5 OR request ~ $5 OR response ~ $5)`
+
+// DeleteHTTPLogsMentioning deletes the HTTP logs in the given org created since the given time whose URL, request or
+// response contain any of the given values, e.g. a contact's UUID or URN paths, as whole tokens, i.e. not as part of a
+// longer number or word. Values shorter than the minimum length are ignored. Logs are checked in batches of id ranges.
+// Returns the number of logs deleted.
+func DeleteHTTPLogsMentioning(ctx context.Context, db DBorTx, orgID OrgID, since time.Time, values []string) (int, error) {
+	patterns := make([]string, 0, len(values))
+	for _, v := range values {
+		if len(v) >= httpLogMentionMinLength {
+			patterns = append(patterns, regexp.QuoteMeta(v))
+		}
+	}
+	if len(patterns) == 0 {
+		return 0, nil
+	}
+
+	pattern := `(^|[^0-9A-Za-z])(` + strings.Join(patterns, "|") + `)($|[^0-9A-Za-z])`
+
+	var ids struct {
+		Min HTTPLogID `db:"min_id"`
+		Max HTTPLogID `db:"max_id"`
+	}
+	if err := db.GetContext(ctx, &ids, sqlSelectHTTPLogIDRange, orgID, since); err != nil {
+		return 0, fmt.Errorf("error getting http log id range: %w", err)
+	}
+	if ids.Min == 0 {
+		return 0, nil
+	}
+
+	numDeleted := 0
+
+	for start := ids.Min; start <= ids.Max; start += httpLogMentionBatchSize {
+		res, err := db.ExecContext(ctx, sqlDeleteHTTPLogsMentioning, start, start+httpLogMentionBatchSize, orgID, since, pattern)
+		if err != nil {
+			return 0, fmt.Errorf("error deleting http logs: %w", err)
+		}
+		n, _ := res.RowsAffected()
+		numDeleted += int(n)
+	}
+
+	return numDeleted, nil
+}
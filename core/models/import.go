@@ -5,12 +5,14 @@ import (
 	"database/sql/driver"
 	"encoding/json"
 	"fmt"
+	"slices"
 	"time"
 
 	"github.com/nyaruka/gocommon/dates"
 	"github.com/nyaruka/gocommon/dbutil"
 	"github.com/nyaruka/gocommon/jsonx"
 	"github.com/nyaruka/gocommon/urns"
+	"github.com/nyaruka/gocommon/uuids"
 	"github.com/nyaruka/goflow/assets"
 	"github.com/nyaruka/goflow/core"
 	"github.com/nyaruka/null/v3"
@@ -52,13 +54,17 @@ type ContactImport struct {
 	NumRecords  int             `json:"num_records"`
 	FinishedOn  *time.Time      `json:"finished_on"`
 
+	File             string          `json:"file"`
+	OriginalFilename string          `json:"original_filename"`
+	Mappings         json.RawMessage `json:"mappings"`
+
 	BatchIDs      []ContactImportBatchID `json:"batch_ids"`      // ordered
 	BatchStatuses []ImportStatus         `json:"batch_statuses"` // unique values only
 }
 
 var sqlLoadContactImport = `
 SELECT row_to_json(r) FROM (
-         SELECT i.id, i.org_id, i.status, i.created_by_id, i.num_records, i.finished_on, array_agg(b.id ORDER BY b.id) AS "batch_ids", array_agg(DISTINCT b.status) AS "batch_statuses"
+         SELECT i.id, i.org_id, i.status, i.created_by_id, i.num_records, i.finished_on, i.file, i.original_filename, i.mappings, array_agg(b.id ORDER BY b.id) AS "batch_ids", array_agg(DISTINCT b.status) AS "batch_statuses"
            FROM contacts_contactimport i
 LEFT OUTER JOIN contacts_contactimportbatch b ON b.contact_import_id = i.id
           WHERE i.id = $1
@@ -77,6 +83,101 @@ func LoadContactImport(ctx context.Context, db *sqlx.DB, id ContactImportID) (*C
 	return i, nil
 }
 
+const sqlInsertContactImport = `
+INSERT INTO contacts_contactimport(uuid, org_id, file, original_filename, mappings, num_records, status, created_on, created_by_id, modified_on, modified_by_id, is_active)
+     VALUES($1, $2, $3, $4, $5, 0, 'P', NOW(), $6, NOW(), $6, TRUE)
+  RETURNING id`
+
+// InsertContactImport creates a new pending import of the given file, which is parsed into batches by a task
+func InsertContactImport(ctx context.Context, db DBorTx, orgID OrgID, userID UserID, file, filename string, mappings any) (*ContactImport, error) {
+	imp := &ContactImport{OrgID: orgID, Status: ImportStatusPending, CreatedByID: userID, File: file, OriginalFilename: filename, Mappings: jsonx.MustMarshal(mappings)}
+
+	if err := db.GetContext(ctx, &imp.ID, sqlInsertContactImport, uuids.NewV4(), orgID, file, filename, imp.Mappings, userID); err != nil {
+		return nil, fmt.Errorf("error inserting contact import: %w", err)
+	}
+	return imp, nil
+}
+
+const sqlUpdateContactImportProcessing = `
+UPDATE contacts_contactimport SET mappings = $2, num_records = $3, started_on = NOW(), status = 'O' WHERE id = $1`
+
+const sqlInsertContactImportBatch = `
+INSERT INTO contacts_contactimportbatch(contact_import_id, status, specs, record_start, record_end, num_created, num_updated, num_errored, errors, finished_on)
+     VALUES($1, $2, $3, $4, $5, 0, 0, $6, $7, $8)
+  RETURNING id`
+
+// InsertBatches splits the given specs into pending batches of the given size and marks this import as processing.
+// Errors for rows which couldn't be parsed are saved on the batch containing the next valid row, or if there are no
+// valid rows, on a single batch which is already complete.
+func (i *ContactImport) InsertBatches(ctx context.Context, db *sqlx.DB, mappings any, specs []*ContactSpec, errs []ImportError, batchSize int) error {
+	tx, err := db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	i.Mappings = jsonx.MustMarshal(mappings)
+	i.NumRecords = len(specs)
+	i.Status = ImportStatusProcessing
+	i.BatchIDs = nil
+	i.BatchStatuses = nil
+
+	if _, err := tx.ExecContext(ctx, sqlUpdateContactImportProcessing, i.ID, i.Mappings, i.NumRecords); err != nil {
+		return fmt.Errorf("error updating contact import: %w", err)
+	}
+
+	insertBatch := func(status ImportStatus, batchSpecs []*ContactSpec, start, end int, batchErrs []ImportError) error {
+		if batchErrs == nil {
+			batchErrs = []ImportError{}
+		}
+
+		var finishedOn *time.Time
+		if status == ImportStatusComplete {
+			now := dates.Now()
+			finishedOn = &now
+		}
+
+		var batchID ContactImportBatchID
+		if err := tx.GetContext(ctx, &batchID, sqlInsertContactImportBatch, i.ID, status, jsonx.MustMarshal(batchSpecs), start, end, len(batchErrs), jsonx.MustMarshal(batchErrs), finishedOn); err != nil {
+			return fmt.Errorf("error inserting contact import batch: %w", err)
+		}
+		i.BatchIDs = append(i.BatchIDs, batchID)
+		if !slices.Contains(i.BatchStatuses, status) {
+			i.BatchStatuses = append(i.BatchStatuses, status)
+		}
+		return nil
+	}
+
+	if len(specs) == 0 {
+		if err := insertBatch(ImportStatusComplete, []*ContactSpec{}, 0, 0, errs); err != nil {
+			return err
+		}
+	}
+
+	for start := 0; start < len(specs); start += batchSize {
+		end := min(start+batchSize, len(specs))
+
+		// take the errors for rows before the last row of this batch, or all remaining errors if this is the last batch
+		numErrs := len(errs)
+		if end < len(specs) {
+			numErrs = 0
+			for numErrs < len(errs) && errs[numErrs].Row < specs[end-1].ImportRow {
+				numErrs++
+			}
+		}
+
+		if err := insertBatch(ImportStatusPending, specs[start:end], start, end, errs[:numErrs]); err != nil {
+			return err
+		}
+		errs = errs[numErrs:]
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error committing contact import batches: %w", err)
+	}
+	return nil
+}
+
 func (i *ContactImport) SetFinished(ctx context.Context, db DBorTx, success bool) error {
 	i.Status = ImportStatusComplete
 	if !success {
@@ -140,8 +241,8 @@ func (b *ContactImportBatch) SetComplete(ctx context.Context, db DBorTx, numCrea
 			status = :status, 
 			num_created = :num_created, 
 			num_updated = :num_updated, 
-			num_errored = :num_errored, 
-			errors = :errors, 
+			num_errored = num_errored + :num_errored, 
+			errors = errors || :errors, 
 			finished_on = :finished_on 
 		WHERE 
 			id = :id`,
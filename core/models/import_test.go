@@ -61,3 +61,48 @@ func TestLoadContactImport(t *testing.T) {
 	assertdb.Query(t, rt.DB, `SELECT count(*) FROM contacts_contactimportbatch WHERE status = 'C' AND finished_on IS NOT NULL`).Returns(1)
 	assertdb.Query(t, rt.DB, `SELECT count(*) FROM contacts_contactimportbatch WHERE status = 'P' AND finished_on IS NULL`).Returns(2)
 }
+
+func TestInsertContactImport(t *testing.T) {
+	ctx, rt := testsuite.Runtime(t)
+
+	imp, err := models.InsertContactImport(ctx, rt.DB, testdb.Org1.ID, testdb.Admin.ID, "imports/1/contacts.csv", "contacts.csv", nil)
+	require.NoError(t, err)
+	assert.Equal(t, models.ImportStatusPending, imp.Status)
+
+	names := []string{"Norbert", "Leah", "Rowan", "Gloria", "Xavier"}
+	specs := make([]*models.ContactSpec, len(names))
+	for i := range names {
+		specs[i] = &models.ContactSpec{Name: &names[i], ImportRow: i + 3}
+	}
+
+	// errors for rows 2 and 9 which sit before the rows of the first and last batches
+	specs[4].ImportRow = 10
+	errs := []models.ImportError{{Record: 0, Row: 2, Message: "bad"}, {Record: 8, Row: 9, Message: "worse"}}
+
+	err = imp.InsertBatches(ctx, rt.DB, []string{"Name"}, specs, errs, 2)
+	require.NoError(t, err)
+	assert.Equal(t, 5, imp.NumRecords)
+	assert.Len(t, imp.BatchIDs, 3)
+
+	loaded, err := models.LoadContactImport(ctx, rt.DB, imp.ID)
+	require.NoError(t, err)
+	assert.Equal(t, testdb.Org1.ID, loaded.OrgID)
+	assert.Equal(t, testdb.Admin.ID, loaded.CreatedByID)
+	assert.Equal(t, models.ImportStatusProcessing, loaded.Status)
+	assert.Equal(t, 5, loaded.NumRecords)
+	assert.Equal(t, "imports/1/contacts.csv", loaded.File)
+	assert.Equal(t, "contacts.csv", loaded.OriginalFilename)
+	assert.JSONEq(t, `["Name"]`, string(loaded.Mappings))
+	assert.Equal(t, imp.BatchIDs, loaded.BatchIDs)
+	assert.Equal(t, []models.ImportStatus{models.ImportStatusPending}, loaded.BatchStatuses)
+
+	batch3, err := models.LoadContactImportBatch(ctx, rt.DB, imp.BatchIDs[2])
+	require.NoError(t, err)
+	assert.Equal(t, 4, batch3.RecordStart)
+	assert.Equal(t, 5, batch3.RecordEnd)
+	assert.JSONEq(t, `[{"uuid": "", "name": "Xavier", "language": null, "status": "", "urns": null, "fields": null, "groups": null, "_import_row": 10}]`, string(batch3.Specs))
+
+	assertdb.Query(t, rt.DB, `SELECT num_errored, errors->0->>'message' AS message FROM contacts_contactimportbatch WHERE id = $1`, imp.BatchIDs[0]).Columns(map[string]any{"num_errored": int64(1), "message": "bad"})
+	assertdb.Query(t, rt.DB, `SELECT num_errored FROM contacts_contactimportbatch WHERE id = $1`, imp.BatchIDs[1]).Returns(0)
+	assertdb.Query(t, rt.DB, `SELECT num_errored, errors->0->>'message' AS message FROM contacts_contactimportbatch WHERE id = $1`, imp.BatchIDs[2]).Columns(map[string]any{"num_errored": int64(1), "message": "worse"})
+}
@@ -33,6 +33,7 @@ type IncidentType string
 const (
 	IncidentTypeOrgFlagged        IncidentType = "org:flagged"
 	IncidentTypeWebhooksUnhealthy IncidentType = "webhooks:unhealthy"
+	IncidentTypeAirtimeLimit      IncidentType = "airtime:limit"
 )
 
 type Incident struct {
@@ -86,6 +87,18 @@ func IncidentWebhooksUnhealthy(ctx context.Context, db DBorTx, rp *valkey.Pool,
 	return id, notifications, nil
 }
 
+// IncidentAirtimeLimitReached ensures there is an open airtime limit incident for the given org and scope, which is
+// empty for the org-wide limits or the UUID of the flow whose limits were reached. It returns any notifications created
+// for a newly started incident so the caller can publish them.
+func IncidentAirtimeLimitReached(ctx context.Context, db DBorTx, oa *OrgAssets, scope string) (IncidentID, []*Notification, error) {
+	return getOrCreateIncident(ctx, db, oa, &Incident{
+		OrgID:     oa.OrgID(),
+		Type:      IncidentTypeAirtimeLimit,
+		StartedOn: dates.Now(),
+		Scope:     scope,
+	})
+}
+
 const sqlInsertIncident = `
 INSERT INTO notifications_incident(org_id, incident_type, scope, started_on, channel_id) 
      VALUES($1, $2, $3, $4, $5)
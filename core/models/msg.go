@@ -20,6 +20,7 @@ import (
 	"github.com/nyaruka/gocommon/i18n"
 	"github.com/nyaruka/gocommon/svclogs"
 	"github.com/nyaruka/gocommon/urns"
+	"github.com/nyaruka/gocommon/uuids"
 	"github.com/nyaruka/goflow/assets"
 	"github.com/nyaruka/goflow/core"
 	"github.com/nyaruka/goflow/core/events"
@@ -90,6 +91,7 @@ const (
 const (
 	UnsendableReasonOrgSuspended core.UnsendableReason = "org_suspended"
 	UnsendableReasonLooping      core.UnsendableReason = "looping"
+	UnsendableReasonWindowClosed core.UnsendableReason = "window_closed"
 )
 
 type MsgFailedReason null.String
@@ -103,6 +105,7 @@ const (
 	MsgFailedErrorLimit     = MsgFailedReason("E")
 	MsgFailedTooOld         = MsgFailedReason("O")
 	MsgFailedChannelRemoved = MsgFailedReason("R")
+	MsgFailedWindowClosed   = MsgFailedReason("W") // channel session window closed and no fallback template
 )
 
 var unsendableToFailedReason = map[core.UnsendableReason]MsgFailedReason{
@@ -112,6 +115,7 @@ var unsendableToFailedReason = map[core.UnsendableReason]MsgFailedReason{
 	core.UnsendableReasonNoRoute:         MsgFailedNoDestination,
 	UnsendableReasonOrgSuspended:         MsgFailedSuspended,
 	UnsendableReasonLooping:              MsgFailedLooping,
+	UnsendableReasonWindowClosed:         MsgFailedWindowClosed,
 }
 
 // Templating adds db support to the engine's templating struct
@@ -280,6 +284,31 @@ func NewIncomingAndroid(orgID OrgID, channelID ChannelID, contactID ContactID, u
 	return msg
 }
 
+// NewIncomingEmail creates a new incoming message from an email received by an email channel. The Message-ID of the
+// email is used as the external identifier so that replies to it can be threaded.
+func NewIncomingEmail(orgID OrgID, channelID ChannelID, contactID ContactID, urnID URNID, text string, attachments []utils.Attachment, messageID string, receivedOn time.Time) *Msg {
+	msg := &Msg{}
+	m := &msg.m
+	m.UUID = events.NewEventUUID()
+	m.OrgID = orgID
+	m.ChannelID = channelID
+	m.ContactID = contactID
+	m.ContactURNID = urnID
+	m.Text = text
+	m.Direction = DirectionIn
+	m.Status = MsgStatusPending
+	m.Visibility = VisibilityVisible
+	m.MsgType = MsgTypeText
+	m.ExternalIdentifier = null.String(messageID)
+	m.CreatedOn = dates.Now()
+	m.SentOn = &receivedOn
+
+	for _, a := range attachments {
+		m.Attachments = append(m.Attachments, string(a))
+	}
+	return msg
+}
+
 // NewIncomingIVR creates a new incoming IVR message for the passed in text and attachment
 func NewIncomingIVR(cfg *runtime.Config, orgID OrgID, call *Call, flow *Flow, event *events.MsgReceived) *Msg {
 	msg := &Msg{}
@@ -586,6 +615,62 @@ msgs_msg(uuid, text, attachments, quickreplies, locale, templating, high_priorit
 		 :contact_id, :contact_urn_id, :org_id, :flow_id, :broadcast_id, :ticket_uuid, :created_by_id)
 RETURNING id, modified_on`
 
+// EmailMessageID returns the Message-ID that an outgoing message on an email channel is sent with. It's generated from
+// the message UUID so that replies can be threaded back to the message without the provider's own id.
+func EmailMessageID(uuid events.EventUUID, ch *Channel) string {
+	_, domain, _ := strings.Cut(ch.Address(), "@")
+	if domain == "" {
+		domain = "mailroom"
+	}
+	return fmt.Sprintf("%s@%s", uuid, domain)
+}
+
+const sqlSelectIncomingEmail = `
+SELECT id FROM msgs_msg WHERE org_id = $1 AND channel_id = $2 AND direction = 'I' AND external_identifier = $3 LIMIT 1`
+
+// GetIncomingEmailID gets the id of an existing incoming message on the given channel with the given Message-ID, as
+// MTAs can deliver the same email more than once, returning NilMsgID if there isn't one
+func GetIncomingEmailID(ctx context.Context, db DBorTx, orgID OrgID, channelID ChannelID, messageID string) (MsgID, error) {
+	var id MsgID
+	err := db.GetContext(ctx, &id, sqlSelectIncomingEmail, orgID, channelID, messageID)
+	if err != nil && err != sql.ErrNoRows {
+		return NilMsgID, fmt.Errorf("error looking up incoming email: %w", err)
+	}
+	return id, nil
+}
+
+const sqlSelectThreadTicket = `
+  SELECT ticket_uuid
+    FROM msgs_msg
+   WHERE org_id = $1 AND contact_id = $2 AND ticket_uuid IS NOT NULL AND (
+         (direction = 'O' AND uuid = ANY($3::uuid[])) OR (direction = 'I' AND external_identifier = ANY($4))
+   )
+ORDER BY id DESC
+   LIMIT 1`
+
+// GetThreadTicketUUID gets the ticket of the most recent message for the given contact with one of the given Message-IDs,
+// e.g. those an email is in reply to, returning an empty UUID if there isn't one. Outgoing messages are matched by the
+// UUID in the Message-ID we generated for them, and incoming messages by the Message-ID they were received with.
+func GetThreadTicketUUID(ctx context.Context, db DBorTx, orgID OrgID, contactID ContactID, messageIDs []string) (core.TicketUUID, error) {
+	if len(messageIDs) == 0 {
+		return "", nil
+	}
+
+	msgUUIDs := make([]string, 0, len(messageIDs))
+	for _, id := range messageIDs {
+		if local, _, _ := strings.Cut(id, "@"); uuids.Is(local) {
+			msgUUIDs = append(msgUUIDs, local)
+		}
+	}
+
+	var ticketUUID core.TicketUUID
+	err := db.GetContext(ctx, &ticketUUID, sqlSelectThreadTicket, orgID, contactID, pq.Array(msgUUIDs), pq.Array(messageIDs))
+	if err != nil && err != sql.ErrNoRows {
+		return "", fmt.Errorf("error looking up thread ticket: %w", err)
+	}
+	return ticketUUID, nil
+}
+
 // MarkMessageHandled updates a message after handling
 func MarkMessageHandled(ctx context.Context, tx DBorTx, msgUUID events.EventUUID, status MsgStatus, visibility MsgVisibility, flow *Flow, ticket *Ticket, attachments []utils.Attachment, logUUIDs []svclogs.UUID) error {
 	flowID := NilFlowID
@@ -841,8 +926,24 @@ func FailChannelMessages(ctx context.Context, db *sql.DB, orgID OrgID, channelID
 	return nil
 }
 
-// CreateMsgOut creates a new outgoing message to the given contact, resolving the destination etc
-func CreateMsgOut(ctx context.Context, rt *runtime.Runtime, oa *OrgAssets, c *core.Contact, content *core.MsgContent, templateID TemplateID, templateVariables []string, locale i18n.Locale, expressionsContext *types.XObject) (*core.MsgOut, error) {
+// ExpressionsContext returns the context for evaluating expressions outside of a flow for the given contact
+func ExpressionsContext(oa *OrgAssets, contact *core.Contact) *types.XObject {
+	return types.NewXObject(expressionsContextValues(oa, contact))
+}
+
+func expressionsContextValues(oa *OrgAssets, contact *core.Contact) map[string]types.XValue {
+	return map[string]types.XValue{
+		"contact": core.Context(oa.Env(), contact),
+		"fields":  core.Context(oa.Env(), contact.Fields()),
+		"globals": core.Context(oa.Env(), oa.SessionAssets().Globals()),
+		"urns":    core.ContextFunc(oa.Env(), contact.URNs().MapContext),
+	}
+}
+
+// CreateMsgOut creates a new outgoing message to the given contact, resolving the destination etc. Callers creating
+// messages for many contacts should look up their open session windows in one go and pass them as windows, otherwise
+// if that's nil, the contact's windows are looked up if needed.
+func CreateMsgOut(ctx context.Context, rt *runtime.Runtime, oa *OrgAssets, c *core.Contact, content *core.MsgContent, templateID TemplateID, templateVariables []string, locale i18n.Locale, expressionsContext *types.XObject, windows OpenSessionWindows) (*core.MsgOut, error) {
 	// resolve URN + channel for this contact
 	urn := urns.NilURN
 	var channel *Channel
@@ -877,25 +978,7 @@ func CreateMsgOut(ctx context.Context, rt *runtime.Runtime, oa *OrgAssets, c *co
 	if templateID != NilTemplateID && channel != nil {
 		template := oa.TemplateByID(templateID)
 		if template != nil {
-			flowTemplate := core.NewTemplate(template)
-			flowChannel := core.NewChannel(channel)
-
-			// look for a translation in the contact's locale, or the org's default locale
-			locales := make([]i18n.Locale, 0, 2)
-			if c.Language() != "" {
-				locales = append(locales, c.Locale(oa.Env()))
-			}
-			locales = append(locales, oa.Env().DefaultLocale())
-
-			trans := flowTemplate.FindTranslation(flowChannel, locales)
-			if trans != nil {
-				translation := core.NewTemplateTranslation(trans)
-				templating = core.NewTemplate(template).Templating(translation, templateVariables)
-
-				// override message content to be a preview of template message and override locale to match the template translation
-				content = translation.Preview(templating.Variables)
-				locale = translation.Locale()
-			}
+			templating, content, locale = templateMsgContent(oa, c, channel, template, templateVariables, content, locale)
 		}
 	}
 
@@ -910,10 +993,30 @@ func CreateMsgOut(ctx context.Context, rt *runtime.Runtime, oa *OrgAssets, c *co
 	} else if urn == urns.NilURN || channel == nil {
 		unsendableReason = core.UnsendableReasonNoRoute
 	} else {
-		var err error
-		unsendableReason, err = msgCheckSendable(ctx, rt, oa.Org(), ContactID(c.ID()), content)
-		if err != nil {
-			return nil, fmt.Errorf("error checking if message is sendable: %w", err)
+		// freeform WhatsApp messages can only be sent within the contact's session window, otherwise we need a template
+		if templating == nil && urn.Scheme() == urns.WhatsApp.Prefix {
+			if windows == nil {
+				var err error
+				if windows, err = GetOpenSessionWindows(ctx, rt.DB, []ContactID{ContactID(c.ID())}, dates.Now()); err != nil {
+					return nil, err
+				}
+			}
+			if !windows.IsOpen(ContactID(c.ID()), channel.ID()) {
+				if fallback := oa.Org().SessionWindowFallback(); fallback != nil {
+					templating, content, locale = fallback.Apply(ctx, rt, oa, c, channel, content, locale)
+				}
+				if templating == nil {
+					unsendableReason = UnsendableReasonWindowClosed
+				}
+			}
+		}
+
+		if unsendableReason == "" {
+			var err error
+			unsendableReason, err = msgCheckSendable(ctx, rt, oa.Org(), ContactID(c.ID()), content)
+			if err != nil {
+				return nil, fmt.Errorf("error checking if message is sendable: %w", err)
+			}
 		}
 	}
 
@@ -207,6 +207,50 @@ func TestGetMessagesByUUID(t *testing.T) {
 	assert.Equal(t, "in 1", msgs[0].Text())
 }
 
+func TestGetThreadTicketUUID(t *testing.T) {
+	ctx, rt := testsuite.Runtime(t)
+
+	ticket1 := testdb.InsertClosedTicket(t, rt, "01992f54-5ab6-717a-a39e-e8ca91fb7262", testdb.Org1, testdb.Ann, testdb.DefaultTopic, nil)
+	ticket2 := testdb.InsertOpenTicket(t, rt, "01992f54-5ab6-725e-be9c-0c6407efd755", testdb.Org1, testdb.Ann, testdb.DefaultTopic, time.Now(), nil)
+
+	msg1 := testdb.InsertIncomingMsg(t, rt, testdb.Org1, "0199bad8-d4be-76c7-8a5c-a12caae7aa87", testdb.TwilioChannel, testdb.Ann, "in 1", models.MsgStatusHandled, ticket1.UUID)
+	msg2 := testdb.InsertIncomingMsg(t, rt, testdb.Org1, "0199bad8-f98d-75a3-b641-2718a25ac3f5", testdb.TwilioChannel, testdb.Ann, "in 2", models.MsgStatusHandled, ticket2.UUID)
+	msg3 := testdb.InsertIncomingMsg(t, rt, testdb.Org1, "0199bad9-9791-770d-a47d-8f4a6ea3ad13", testdb.TwilioChannel, testdb.Ann, "in 3", models.MsgStatusHandled, "")
+	rt.DB.MustExec(`UPDATE msgs_msg SET external_identifier = 'id1@example.com' WHERE id = $1`, msg1.ID)
+	rt.DB.MustExec(`UPDATE msgs_msg SET external_identifier = 'id2@example.com' WHERE id = $1`, msg2.ID)
+	rt.DB.MustExec(`UPDATE msgs_msg SET external_identifier = 'id3@example.com' WHERE id = $1`, msg3.ID)
+
+	emailChannel := testdb.InsertChannel(t, rt, testdb.Org1, "EM", "Support", "support@nyaruka.com", []string{"mailto"}, "SR", map[string]any{})
+	oa, err := models.GetOrgAssetsWithRefresh(ctx, rt, testdb.Org1.ID, models.RefreshChannels)
+	require.NoError(t, err)
+	assert.Equal(t, "0199bada-0b2e-7a5e-9b6f-5c3d2e1f0a9b@nyaruka.com", models.EmailMessageID("0199bada-0b2e-7a5e-9b6f-5c3d2e1f0a9b", oa.ChannelByID(emailChannel.ID)))
+
+	// outgoing messages are matched by the Message-ID we generated for them, not the provider's id
+	out1 := testdb.InsertOutgoingMsg(t, rt, testdb.Org1, "0199bada-0b2e-7a5e-9b6f-5c3d2e1f0a9b", testdb.TwilioChannel, testdb.Ann, "out 1", nil, models.MsgStatusSent, false)
+	rt.DB.MustExec(`UPDATE msgs_msg SET external_identifier = 'sg-123', ticket_uuid = $2 WHERE id = $1`, out1.ID, ticket1.UUID)
+
+	tcs := []struct {
+		contact  *testdb.Contact
+		ids      []string
+		expected core.TicketUUID
+	}{
+		{testdb.Ann, nil, ""},
+		{testdb.Ann, []string{"xyz@example.com"}, ""},
+		{testdb.Ann, []string{"id1@example.com"}, ticket1.UUID},
+		{testdb.Ann, []string{"id3@example.com"}, ""},                                       // message has no ticket
+		{testdb.Ann, []string{"id1@example.com", "id2@example.com"}, ticket2.UUID},          // most recent message wins
+		{testdb.Bob, []string{"id1@example.com", "id2@example.com", "id3@example.com"}, ""}, // other contact's messages
+		{testdb.Ann, []string{"0199bada-0b2e-7a5e-9b6f-5c3d2e1f0a9b@nyaruka.com"}, ticket1.UUID},
+		{testdb.Ann, []string{"sg-123"}, ""},
+	}
+
+	for i, tc := range tcs {
+		actual, err := models.GetThreadTicketUUID(ctx, rt.DB, testdb.Org1.ID, tc.contact.ID, tc.ids)
+		assert.NoError(t, err, "%d: unexpected error", i)
+		assert.Equal(t, tc.expected, actual, "%d: ticket mismatch", i)
+	}
+}
+
 func TestResendMessages(t *testing.T) {
 	ctx, rt := testsuite.Runtime(t)
 
@@ -488,7 +532,7 @@ func TestCreateMsgOut(t *testing.T) {
 		})
 	}
 
-	out, err := models.CreateMsgOut(ctx, rt, oa, bob, &core.MsgContent{Text: "hello @contact.name"}, models.NilTemplateID, nil, `eng`, evalContext(bob))
+	out, err := models.CreateMsgOut(ctx, rt, oa, bob, &core.MsgContent{Text: "hello @contact.name"}, models.NilTemplateID, nil, `eng`, evalContext(bob), nil)
 	assert.NoError(t, err)
 	assert.Equal(t, "hello Bob", out.Text())
 	assert.Equal(t, urns.URN("tel:+16055742222"), out.URN())
@@ -499,7 +543,7 @@ func TestCreateMsgOut(t *testing.T) {
 	msgContent := &core.MsgContent{Text: "hello"}
 	templateVariables := []string{"@contact.name", "mice"}
 
-	out, err = models.CreateMsgOut(ctx, rt, oa, ann, msgContent, testdb.ReviveTemplate.ID, templateVariables, `eng`, evalContext(ann))
+	out, err = models.CreateMsgOut(ctx, rt, oa, ann, msgContent, testdb.ReviveTemplate.ID, templateVariables, `eng`, evalContext(ann), nil)
 	assert.NoError(t, err)
 	assert.Equal(t, "Hi Ann, are you still experiencing problems with mice?", out.Text())
 	assert.Equal(t, urns.URN("facebook:123456789"), out.URN())
@@ -513,7 +557,7 @@ func TestCreateMsgOut(t *testing.T) {
 		Variables: []*core.TemplatingVariable{{Type: "text", Value: "Ann"}, {Type: "text", Value: "mice"}},
 	}, out.Templating())
 
-	out, err = models.CreateMsgOut(ctx, rt, oa, cat, msgContent, testdb.ReviveTemplate.ID, templateVariables, `eng`, evalContext(cat))
+	out, err = models.CreateMsgOut(ctx, rt, oa, cat, msgContent, testdb.ReviveTemplate.ID, templateVariables, `eng`, evalContext(cat), nil)
 	assert.NoError(t, err)
 	assert.Equal(t, "Hi Cat, are you still experiencing problems with mice?", out.Text())
 	assert.Equal(t, &core.MsgTemplating{
@@ -526,7 +570,7 @@ func TestCreateMsgOut(t *testing.T) {
 
 	bob.SetStatus(core.ContactStatusBlocked)
 
-	out, err = models.CreateMsgOut(ctx, rt, oa, bob, &core.MsgContent{Text: "hello"}, models.NilTemplateID, nil, `eng-US`, nil)
+	out, err = models.CreateMsgOut(ctx, rt, oa, bob, &core.MsgContent{Text: "hello"}, models.NilTemplateID, nil, `eng-US`, nil, nil)
 	assert.NoError(t, err)
 	assert.Equal(t, urns.URN("tel:+16055742222"), out.URN())
 	assert.Equal(t, assets.NewChannelReference("74729f45-7f29-4868-9dc4-90e491e3c7d8", "Twilio"), out.Channel())
@@ -535,13 +579,99 @@ func TestCreateMsgOut(t *testing.T) {
 	bob.SetStatus(core.ContactStatusActive)
 	bob.SetRoutes(nil)
 
-	out, err = models.CreateMsgOut(ctx, rt, oa, bob, &core.MsgContent{Text: "hello"}, models.NilTemplateID, nil, `eng-US`, nil)
+	out, err = models.CreateMsgOut(ctx, rt, oa, bob, &core.MsgContent{Text: "hello"}, models.NilTemplateID, nil, `eng-US`, nil, nil)
 	assert.NoError(t, err)
 	assert.Equal(t, urns.NilURN, out.URN())
 	assert.Nil(t, out.Channel())
 	assert.Equal(t, core.UnsendableReasonNoRoute, out.UnsendableReason())
 }
 
+func TestCreateMsgOutSessionWindow(t *testing.T) {
+	ctx, rt := testsuite.Runtime(t)
+
+	// add a WhatsApp channel which the revive_issue template also has a translation for, and give Ann and Cat URNs on it
+	wa := testdb.InsertChannel(t, rt, testdb.Org1, "WAC", "WhatsApp", "1234", []string{"whatsapp"}, "SR", map[string]any{})
+	rt.DB.MustExec(`INSERT INTO templates_templatetranslation(locale, components, variables, status, namespace, external_id, external_locale, is_supported, is_compatible, channel_id, template_id)
+		SELECT locale, components, variables, status, namespace, external_id, external_locale, is_supported, is_compatible, $1, template_id FROM templates_templatetranslation WHERE template_id = $2`, wa.ID, testdb.ReviveTemplate.ID)
+	testdb.InsertContactURN(t, rt, testdb.Org1, testdb.Ann, "whatsapp:16055741111", 1001, nil)
+	testdb.InsertContactURN(t, rt, testdb.Org1, testdb.Cat, "whatsapp:16055743333", 1001, nil)
+
+	// Cat last messaged us on WhatsApp an hour ago, Ann two days ago
+	in1 := testdb.InsertIncomingMsg(t, rt, testdb.Org1, "0199f6aa-7a8b-7c9d-8e0f-1a2b3c4d5e6f", wa, testdb.Cat, "Hi", models.MsgStatusHandled, "")
+	in2 := testdb.InsertIncomingMsg(t, rt, testdb.Org1, "0199f6aa-8b9c-7d0e-8f1a-2b3c4d5e6f7a", wa, testdb.Ann, "Hi", models.MsgStatusHandled, "")
+	rt.DB.MustExec(`UPDATE msgs_msg SET created_on = NOW() - INTERVAL '1 hour' WHERE id = $1`, in1.ID)
+	rt.DB.MustExec(`UPDATE msgs_msg SET created_on = NOW() - INTERVAL '48 hours' WHERE id = $1`, in2.ID)
+
+	oa, err := models.GetOrgAssetsWithRefresh(ctx, rt, testdb.Org1.ID, models.RefreshChannels|models.RefreshTemplates)
+	require.NoError(t, err)
+
+	mAnn, ann, _ := testdb.Ann.Load(t, rt, oa)
+	_, cat, _ := testdb.Cat.Load(t, rt, oa)
+
+	// Cat's window is open so they can be sent freeform messages
+	out, err := models.CreateMsgOut(ctx, rt, oa, cat, &core.MsgContent{Text: "mice"}, models.NilTemplateID, nil, `eng`, nil, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, urns.URN("whatsapp:16055743333"), out.URN())
+	assert.Equal(t, "mice", out.Text())
+	assert.Nil(t, out.Templating())
+	assert.Equal(t, core.UnsendableReason(""), out.UnsendableReason())
+
+	// windows can also be looked up for many contacts at once and passed in
+	windows, err := models.GetOpenSessionWindows(ctx, rt.DB, []models.ContactID{testdb.Ann.ID, testdb.Cat.ID}, time.Now())
+	require.NoError(t, err)
+	assert.True(t, windows.IsOpen(testdb.Cat.ID, wa.ID))
+	assert.False(t, windows.IsOpen(testdb.Cat.ID, testdb.TwilioChannel.ID))
+	assert.False(t, windows.IsOpen(testdb.Ann.ID, wa.ID))
+
+	out, err = models.CreateMsgOut(ctx, rt, oa, cat, &core.MsgContent{Text: "mice"}, models.NilTemplateID, nil, `eng`, nil, windows)
+	assert.NoError(t, err)
+	assert.Equal(t, "mice", out.Text())
+	assert.Equal(t, core.UnsendableReason(""), out.UnsendableReason())
+
+	// Ann's window is closed and there's no fallback template so the message can't be sent
+	out, err = models.CreateMsgOut(ctx, rt, oa, ann, &core.MsgContent{Text: "mice"}, models.NilTemplateID, nil, `eng`, nil, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, urns.URN("whatsapp:16055741111"), out.URN())
+	assert.Nil(t, out.Templating())
+	assert.Equal(t, models.UnsendableReasonWindowClosed, out.UnsendableReason())
+
+	// with a fallback template, the message is switched to that
+	rt.DB.MustExec(`UPDATE orgs_org SET config = config || '{"session_window_fallback": {"template": "9c22b594-fcab-4b29-9bcb-ce4404894a80", "variables": ["@contact.name", "@text"]}}'::jsonb WHERE id = $1`, testdb.Org1.ID)
+
+	oa, err = models.GetOrgAssetsWithRefresh(ctx, rt, testdb.Org1.ID, models.RefreshOrg)
+	require.NoError(t, err)
+
+	out, err = models.CreateMsgOut(ctx, rt, oa, ann, &core.MsgContent{Text: "mice"}, models.NilTemplateID, nil, `eng`, nil, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "Hi Ann, are you still experiencing problems with mice?", out.Text())
+	assert.Equal(t, i18n.Locale(`eng-US`), out.Locale())
+	assert.Equal(t, &core.MsgTemplating{
+		Template: assets.NewTemplateReference("9c22b594-fcab-4b29-9bcb-ce4404894a80", "revive_issue"),
+		Components: []*core.TemplatingComponent{
+			{Name: "body", Type: "body/text", Variables: map[string]int{"1": 0, "2": 1}},
+		},
+		Variables: []*core.TemplatingVariable{{Type: "text", Value: "Ann"}, {Type: "text", Value: "mice"}},
+	}, out.Templating())
+	assert.Equal(t, core.UnsendableReason(""), out.UnsendableReason())
+
+	// unless that template has no translation for the channel
+	rt.DB.MustExec(`DELETE FROM templates_templatetranslation WHERE channel_id = $1`, wa.ID)
+
+	oa, err = models.GetOrgAssetsWithRefresh(ctx, rt, testdb.Org1.ID, models.RefreshTemplates)
+	require.NoError(t, err)
+
+	out, err = models.CreateMsgOut(ctx, rt, oa, ann, &core.MsgContent{Text: "mice"}, models.NilTemplateID, nil, `eng`, nil, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "mice", out.Text())
+	assert.Equal(t, models.UnsendableReasonWindowClosed, out.UnsendableReason())
+
+	// and the message is created as failed
+	msg, err := models.NewOutgoingChatMsg(rt, oa.Org(), oa.ChannelByUUID(wa.UUID), mAnn, events.NewMsgCreated(out, "", ""), models.NilUserID)
+	require.NoError(t, err)
+	assert.Equal(t, models.MsgStatusFailed, msg.Status())
+	assert.Equal(t, models.MsgFailedWindowClosed, msg.FailedReason())
+}
+
 func TestMsgTemplating(t *testing.T) {
 	ctx, rt := testsuite.Runtime(t)
 
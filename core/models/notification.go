@@ -63,10 +63,12 @@ type Notification struct {
 	CreatedOn   time.Time        `db:"created_on"`
 
 	ContactImportID ContactImportID `db:"contact_import_id"`
+	ExportID        ExportID        `db:"export_id"`
 	IncidentID      IncidentID      `db:"incident_id"`
 
 	// transient context used to render the realtime socket payload, never persisted
 	contactImport *ContactImport
+	export        *Export
 	incident      *Incident
 }
 
@@ -98,6 +100,32 @@ func NotifyImportFinished(ctx context.Context, rt *runtime.Runtime, oa *OrgAsset
 	return nil
 }
 
+// NotifyExportFinished notifies the user who created an export that it has finished, and publishes that notification
+// to the user's realtime socket.
+func NotifyExportFinished(ctx context.Context, rt *runtime.Runtime, oa *OrgAssets, export *Export) error {
+	n := &Notification{
+		OrgID:       export.OrgID,
+		Type:        NotificationTypeExportFinished,
+		Scope:       fmt.Sprintf("%s:%d", export.Type, export.ID),
+		UserID:      export.CreatedByID,
+		Medium:      MediumUI,
+		EmailStatus: EmailStatusNone,
+		ExportID:    export.ID,
+		export:      export,
+	}
+
+	inserted, err := InsertNotifications(ctx, rt.DB, []*Notification{n})
+	if err != nil {
+		return err
+	}
+
+	if err := PublishNotifications(ctx, rt, oa, inserted); err != nil {
+		slog.Error("error publishing export finished notification", "error", err, "export_id", export.ID)
+	}
+
+	return nil
+}
+
 // NotifyIncidentStarted notifies administrators that an incident has started, returning the notifications that were
 // actually created so the caller can publish them once its transaction has committed.
 func NotifyIncidentStarted(ctx context.Context, db DBorTx, oa *OrgAssets, incident *Incident) ([]*Notification, error) {
@@ -151,8 +179,8 @@ func NewTicketActivityNotification(orgID OrgID, userID UserID) *Notification {
 }
 
 const sqlInsertNotification = `
-INSERT INTO notifications_notification(org_id,  notification_type,  scope,  user_id,  medium, is_seen,  email_status, created_on,  contact_import_id,  incident_id)
-                               VALUES(:org_id, :notification_type, :scope, :user_id, :medium,   FALSE, :email_status,      NOW(), :contact_import_id, :incident_id)
+INSERT INTO notifications_notification(org_id,  notification_type,  scope,  user_id,  medium, is_seen,  email_status, created_on,  contact_import_id,  export_id,  incident_id)
+                               VALUES(:org_id, :notification_type, :scope, :user_id, :medium,   FALSE, :email_status,      NOW(), :contact_import_id, :export_id, :incident_id)
                           ON CONFLICT DO NOTHING
                             RETURNING id, org_id, user_id, notification_type, scope, created_on`
 
@@ -226,6 +254,7 @@ type notificationPayload struct {
 
 	// at most one of these is set, depending on the notification type
 	Import   *importPayload   `json:"import,omitempty"`
+	Export   *exportPayload   `json:"export,omitempty"`
 	Incident *incidentPayload `json:"incident,omitempty"`
 }
 
@@ -234,6 +263,11 @@ type importPayload struct {
 	NumRecords int    `json:"num_records"`
 }
 
+type exportPayload struct {
+	Type       ExportType `json:"type"`
+	NumRecords int        `json:"num_records"`
+}
+
 type incidentPayload struct {
 	Type      IncidentType `json:"type"`
 	StartedOn time.Time    `json:"started_on"`
@@ -254,6 +288,10 @@ func (n *Notification) marshalForSocket() ([]byte, error) {
 		if n.contactImport != nil {
 			p.Import = &importPayload{Type: "contact", NumRecords: n.contactImport.NumRecords}
 		}
+	case NotificationTypeExportFinished:
+		if n.export != nil {
+			p.Export = &exportPayload{Type: n.export.Type, NumRecords: int(n.export.NumRecords)}
+		}
 	case NotificationTypeIncidentStarted:
 		if n.incident != nil {
 			p.Incident = &incidentPayload{Type: n.incident.Type, StartedOn: n.incident.StartedOn, EndedOn: n.incident.EndedOn}
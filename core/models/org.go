@@ -9,6 +9,7 @@ import (
 	"io"
 	"mime"
 	"net/http"
+	"net/url"
 	"path/filepath"
 	"slices"
 	"strconv"
@@ -30,6 +31,11 @@ import (
 	"github.com/nyaruka/mailroom/v26/core/goflow"
 	"github.com/nyaruka/mailroom/v26/runtime"
 	"github.com/nyaruka/mailroom/v26/services/airtime/dtone"
+	"github.com/nyaruka/mailroom/v26/services/airtime/reloadly"
+	"github.com/nyaruka/mailroom/v26/services/email/fake"
+	"github.com/nyaruka/mailroom/v26/services/email/mailgun"
+	"github.com/nyaruka/mailroom/v26/services/email/sendgrid"
+	"github.com/nyaruka/mailroom/v26/services/email/ses"
 	"github.com/nyaruka/null/v3"
 )
 
@@ -62,7 +68,13 @@ func emailServiceFactory(rt *runtime.Runtime) engine.EmailServiceFactory {
 		ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
 		defer cancel()
 
-		return orgFromAssets(sa).EmailService(ctx, rt, emailRetries)
+		oa := sa.Source().(*OrgAssets)
+
+		svc, err := oa.Org().EmailService(ctx, rt, emailRetries)
+		if err != nil {
+			return nil, err
+		}
+		return newTrackedEmailService(rt, oa, svc), nil
 	}
 }
 
@@ -70,7 +82,18 @@ func airtimeServiceFactory(rt *runtime.Runtime) engine.AirtimeServiceFactory {
 	airtimeHTTPRetries := httpx.NewFixedRetries(time.Second*5, time.Second*10)
 
 	return func(sa flows.SessionAssets) (flows.AirtimeService, error) {
-		return orgFromAssets(sa).AirtimeService(rt, rt.HTTP.Services, airtimeHTTPRetries)
+		oa := sa.Source().(*OrgAssets)
+
+		svc, err := oa.Org().AirtimeService(rt, rt.HTTP.Services, airtimeHTTPRetries)
+		if err != nil {
+			return nil, err
+		}
+
+		// if the org has configured limits, check transfers against them before they're created
+		if limits := oa.Org().AirtimeLimits(); limits != nil {
+			return &limitedAirtimeService{AirtimeService: svc, rt: rt, oa: oa, limits: limits}, nil
+		}
+		return svc, nil
 	}
 }
 
@@ -100,8 +123,27 @@ const (
 	// NilOrgID is the id 0 considered as nil org id
 	NilOrgID = OrgID(0)
 
-	configDTOneKey    = "dtone_key"
-	configDTOneSecret = "dtone_secret"
+	configAirtimeProvider      = "airtime_provider"
+	configDTOneKey             = "dtone_key"
+	configDTOneSecret          = "dtone_secret"
+	configReloadlyClientID     = "reloadly_client_id"
+	configReloadlyClientSecret = "reloadly_client_secret"
+)
+
+// email providers, other than SMTP, which can be selected by the scheme of the flow_smtp URL
+const (
+	emailProviderSendGrid = "sendgrid"
+	emailProviderMailgun  = "mailgun"
+	emailProviderSES      = "ses"
+	emailProviderFake     = "fake"
+)
+
+var emailHTTPRetries = httpx.NewFixedRetries(time.Second*3, time.Second*6)
+
+// airtime providers which an org can choose between via the airtime_provider config key
+const (
+	AirtimeProviderDTOne    = "dtone"
+	AirtimeProviderReloadly = "reloadly"
 )
 
 // features which can be enabled on an org - these are granted by staff and are a subset of the features
@@ -124,7 +166,8 @@ type Org struct {
 		PrometheusToken null.String   `json:"prometheus_token"`
 		Config          null.Map[any] `json:"config"`
 	}
-	env envs.Environment
+	env        envs.Environment
+	fieldsKeys []*fieldsKey // current key first
 }
 
 // Environment adds values from config
@@ -196,8 +239,55 @@ func (o *Org) ConfigValue(key string, def string) string {
 	return def
 }
 
-// EmailService returns the email service for this org
+// EmailService returns the email service for this org. Despite the name of the setting, the URL can also select an
+// HTTP API provider by its scheme, e.g. sendgrid://apikey:<key>@api.sendgrid.com?from=..., with credentials in the
+// userinfo and any provider options in the query string.
 func (o *Org) EmailService(ctx context.Context, rt *runtime.Runtime, retries *smtpx.RetryConfig) (flows.EmailService, error) {
+	smtpURL, err := o.emailURL(ctx, rt)
+	if err != nil {
+		return nil, err
+	}
+
+	u, err := url.Parse(smtpURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid email configuration: %w", err)
+	}
+
+	secret, _ := u.User.Password()
+	from := u.Query().Get("from")
+
+	switch u.Scheme {
+	case emailProviderSendGrid:
+		return sendgrid.NewService(rt.HTTP.Services, emailHTTPRetries, secret, from), nil
+	case emailProviderMailgun:
+		return mailgun.NewService(rt.HTTP.Services, emailHTTPRetries, secret, u.Hostname(), from, u.Query().Get("region") == "eu"), nil
+	case emailProviderSES:
+		return ses.NewService(rt.HTTP.Services, emailHTTPRetries, u.User.Username(), secret, u.Hostname(), from), nil
+	case emailProviderFake:
+		return fake.NewService(from), nil
+	}
+
+	return smtp.NewService(smtpURL, retries)
+}
+
+// EmailWebhookKey returns the key used to verify delivery event webhooks from this org's email provider, configured as
+// webhook_key in the query string of its email URL, i.e. the verification key of a SendGrid signed event webhook, a
+// Mailgun webhook signing key, or the ARN of the SNS topic which SES notifications are published to.
+func (o *Org) EmailWebhookKey(ctx context.Context, rt *runtime.Runtime) (string, error) {
+	smtpURL, err := o.emailURL(ctx, rt)
+	if err != nil {
+		return "", err
+	}
+
+	u, err := url.Parse(smtpURL)
+	if err != nil {
+		return "", fmt.Errorf("invalid email configuration: %w", err)
+	}
+	return u.Query().Get("webhook_key"), nil
+}
+
+// returns the email URL for this org, which is its own, or its parent's, or the default from our config
+func (o *Org) emailURL(ctx context.Context, rt *runtime.Runtime) (string, error) {
 	// first look for custom SMTP on this org
 	smtpURL := o.FlowSMTP()
 
@@ -205,7 +295,7 @@ func (o *Org) EmailService(ctx context.Context, rt *runtime.Runtime, retries *sm
 	if smtpURL == "" && o.o.ParentID != NilOrgID {
 		parent, err := GetOrgAssets(ctx, rt, o.o.ParentID)
 		if err != nil {
-			return nil, fmt.Errorf("error loading parent org: %w", err)
+			return "", fmt.Errorf("error loading parent org: %w", err)
 		}
 		smtpURL = parent.Org().FlowSMTP()
 	}
@@ -216,25 +306,44 @@ func (o *Org) EmailService(ctx context.Context, rt *runtime.Runtime, retries *sm
 	}
 
 	if smtpURL == "" {
-		return nil, errors.New("missing SMTP configuration")
+		return "", errors.New("missing SMTP configuration")
 	}
+	return smtpURL, nil
+}
 
-	return smtp.NewService(smtpURL, retries)
+// AirtimeProvider returns which airtime provider this org has chosen, defaulting to DT One for orgs which were
+// configured before there was a choice
+func (o *Org) AirtimeProvider() string {
+	return o.ConfigValue(configAirtimeProvider, AirtimeProviderDTOne)
 }
 
 // AirtimeService returns the airtime service for this org if one is configured
 func (o *Org) AirtimeService(rt *runtime.Runtime, httpClient *http.Client, httpRetries *httpx.RetryConfig) (flows.AirtimeService, error) {
-	key := o.ConfigValue(configDTOneKey, "")
-	secret := o.ConfigValue(configDTOneSecret, "")
+	switch o.AirtimeProvider() {
+	case AirtimeProviderDTOne:
+		key := o.ConfigValue(configDTOneKey, "")
+		secret := o.ConfigValue(configDTOneSecret, "")
 
-	if key == "" || secret == "" {
-		return nil, fmt.Errorf("missing %s or %s on DTOne configuration for org: %d", configDTOneKey, configDTOneSecret, o.ID())
-	}
-	callbackURL, err := DTOneCallbackURL(rt)
-	if err != nil {
-		return nil, err
+		if key == "" || secret == "" {
+			return nil, fmt.Errorf("missing %s or %s on DTOne configuration for org: %d", configDTOneKey, configDTOneSecret, o.ID())
+		}
+		callbackURL, err := DTOneCallbackURL(rt)
+		if err != nil {
+			return nil, err
+		}
+		return dtone.NewService(httpClient, httpRetries, key, secret, callbackURL), nil
+
+	case AirtimeProviderReloadly:
+		clientID := o.ConfigValue(configReloadlyClientID, "")
+		clientSecret := o.ConfigValue(configReloadlyClientSecret, "")
+
+		if clientID == "" || clientSecret == "" {
+			return nil, fmt.Errorf("missing %s or %s on Reloadly configuration for org: %d", configReloadlyClientID, configReloadlyClientSecret, o.ID())
+		}
+		return reloadly.NewService(httpClient, httpRetries, clientID, clientSecret), nil
 	}
-	return dtone.NewService(httpClient, httpRetries, key, secret, callbackURL), nil
+
+	return nil, fmt.Errorf("unknown airtime provider '%s' for org: %d", o.AirtimeProvider(), o.ID())
 }
 
 // StoreAttachment saves an attachment to storage
@@ -328,6 +437,7 @@ func LoadOrg(ctx context.Context, cfg *runtime.Config, db *sql.DB, orgID OrgID)
 	}
 
 	o.env = newEnvironment(o.env, cfg)
+	o.fieldsKeys = deriveFieldsKeys(o.ID(), cfg.FieldsEncryptionKeyParsed, cfg.FieldsEncryptionKeyOldParsed)
 	return o, nil
 }
 
@@ -359,6 +469,23 @@ func GetActiveOrgIDs(ctx context.Context, db Queryer) ([]OrgID, error) {
 	return ids, nil
 }
 
+const sqlSelectComputedFieldsOrgIDs = `SELECT id FROM orgs_org WHERE is_active = TRUE AND config->'computed_fields' IS NOT NULL ORDER BY id`
+
+// GetComputedFieldsOrgIDs returns the IDs of active orgs which have computed fields
+func GetComputedFieldsOrgIDs(ctx context.Context, db Queryer) ([]OrgID, error) {
+	rows, err := db.QueryContext(ctx, sqlSelectComputedFieldsOrgIDs)
+	if err != nil {
+		return nil, fmt.Errorf("error querying computed fields org IDs: %w", err)
+	}
+	defer rows.Close()
+
+	ids, err := dbutil.ScanAllSlice(rows, make([]OrgID, 0, 10))
+	if err != nil {
+		return nil, fmt.Errorf("error scanning computed fields org IDs: %w", err)
+	}
+	return ids, nil
+}
+
 const sqlSelectOutboxCounts = `
   SELECT org_id, SUM(count) 
     FROM orgs_itemcount 
@@ -69,8 +69,15 @@ type Schedule struct {
 	Broadcast *Broadcast `json:"broadcast,omitempty"`
 	Trigger   *Trigger   `json:"trigger,omitempty"`
 	Timezone  string     `json:"timezone"`
+
+	// optional cron expression (which takes precedence over the repeat period) and holidays from the org config
+	Cron     string           `json:"cron,omitempty"`
+	Holidays *HolidayCalendar `json:"holidays,omitempty"`
 }
 
+// we allow for small clock drifts between boxes or db when calculating next fires so we don't double schedule
+const scheduleClockDrift = time.Minute
+
 // NewSchedule creates a new schedule object
 func NewSchedule(oa *OrgAssets, start time.Time, repeatPeriod RepeatPeriod, repeatDaysOfWeek string) (*Schedule, error) {
 	// get start time in org timezone so that we always fire at the appropriate time regardless of timezone / dst changes
@@ -81,6 +88,7 @@ func NewSchedule(oa *OrgAssets, start time.Time, repeatPeriod RepeatPeriod, repe
 		OrgID:        oa.OrgID(),
 		RepeatPeriod: repeatPeriod,
 		Timezone:     tz.String(),
+		Holidays:     oa.Org().HolidayCalendar(),
 	}
 
 	if s.RepeatPeriod == RepeatPeriodNever {
@@ -126,19 +134,64 @@ func NewSchedule(oa *OrgAssets, start time.Time, repeatPeriod RepeatPeriod, repe
 	return s, nil
 }
 
+// NewCronSchedule creates a new schedule which repeats according to the given cron expression in the org timezone,
+// with its first fire after the given time. The expression is stored as schedule_crons in the org config, keyed by
+// schedule id, and the schedule itself doesn't repeat if that is removed.
+func NewCronSchedule(oa *OrgAssets, expression string, from time.Time) (*Schedule, error) {
+	if _, err := ParseCronExpression(expression); err != nil {
+		return nil, err
+	}
+
+	s := &Schedule{
+		OrgID:        oa.OrgID(),
+		RepeatPeriod: RepeatPeriodNever,
+		Timezone:     oa.Env().Timezone().String(),
+		Cron:         expression,
+		Holidays:     oa.Org().HolidayCalendar(),
+	}
+
+	next, err := s.GetNextFire(from)
+	if err != nil {
+		return nil, err
+	}
+	s.NextFire = next
+
+	return s, nil
+}
+
 const sqlInsertSchedule = `
 INSERT INTO schedules_schedule( org_id,  repeat_period,  repeat_hour_of_day,  repeat_minute_of_hour,  repeat_days_of_week,  repeat_day_of_month,  next_fire,  is_paused)
 	                    VALUES(:org_id, :repeat_period, :repeat_hour_of_day, :repeat_minute_of_hour, :repeat_days_of_week, :repeat_day_of_month, :next_fire,      FALSE)
   RETURNING id`
 
+const sqlUpdateOrgScheduleCron = `
+UPDATE orgs_org
+   SET config = config || jsonb_build_object('schedule_crons', COALESCE(config->'schedule_crons', '{}'::jsonb) || jsonb_build_object($2::text, $3::text))
+ WHERE id = $1`
+
+// Insert inserts this schedule, and if it repeats according to a cron expression, saves that to the org config
 func (s *Schedule) Insert(ctx context.Context, db DBorTx) error {
-	return BulkQuery(ctx, "insert schedule", db, sqlInsertSchedule, []any{s})
+	if err := BulkQuery(ctx, "insert schedule", db, sqlInsertSchedule, []any{s}); err != nil {
+		return err
+	}
+
+	if s.Cron != "" {
+		if _, err := db.ExecContext(ctx, sqlUpdateOrgScheduleCron, s.OrgID, s.ID, s.Cron); err != nil {
+			return fmt.Errorf("error saving schedule cron expression: %w", err)
+		}
+	}
+	return nil
 }
 
 func (s *Schedule) GetTimezone() (*time.Location, error) {
 	return time.LoadLocation(s.Timezone)
 }
 
+// IsRepeating returns whether this schedule fires more than once
+func (s *Schedule) IsRepeating() bool {
+	return s.Cron != "" || s.RepeatPeriod != RepeatPeriodNever
+}
+
 func (s *Schedule) GetRepeatDaysOfWeek() ([]time.Weekday, error) {
 	days := make([]time.Weekday, len(s.RepeatDaysOfWeek))
 
@@ -168,6 +221,12 @@ func (s *Schedule) DeleteWithTarget(ctx context.Context, tx *sql.Tx) error {
 		return fmt.Errorf("error deleting schedule: %w", err)
 	}
 
+	if s.Cron != "" {
+		if _, err := tx.ExecContext(ctx, `UPDATE orgs_org SET config = config #- ARRAY['schedule_crons', $2::text] WHERE id = $1`, s.OrgID, s.ID); err != nil {
+			return fmt.Errorf("error removing schedule cron expression: %w", err)
+		}
+	}
+
 	return nil
 }
 
@@ -182,8 +241,111 @@ func (s *Schedule) UpdateFires(ctx context.Context, tx DBorTx, last time.Time, n
 	return nil
 }
 
-// GetNextFire returns the next fire for this schedule (if any)
+// UpdateNextFire updates only the next fire for a schedule on the db
+func (s *Schedule) UpdateNextFire(ctx context.Context, tx DBorTx, next *time.Time) error {
+	if _, err := tx.ExecContext(ctx, `UPDATE schedules_schedule SET next_fire = $2 WHERE id = $1`, s.ID, next); err != nil {
+		return fmt.Errorf("error updating schedule next fire for: %d: %w", s.ID, err)
+	}
+	return nil
+}
+
+// GetNextFire returns the next fire for this schedule (if any), avoiding any holidays if this is a repeating schedule
 func (s *Schedule) GetNextFire(now time.Time) (*time.Time, error) {
+	next, err := s.nextFire(now)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.avoidHolidays(next)
+}
+
+// GetNextFires returns up to n upcoming fires for this schedule after the given time
+func (s *Schedule) GetNextFires(now time.Time, n int) ([]time.Time, error) {
+	var next *time.Time
+	var err error
+
+	if s.NextFire != nil && s.NextFire.After(now) {
+		next, err = s.avoidHolidays(s.NextFire)
+	} else {
+		next, err = s.GetNextFire(now)
+	}
+
+	fires := make([]time.Time, 0, n)
+
+	for next != nil && err == nil && len(fires) < n {
+		fires = append(fires, *next)
+
+		if !s.IsRepeating() {
+			break
+		}
+
+		// step back by the allowance for clock drift that GetNextFire adds so we don't miss any fires
+		next, err = s.GetNextFire(next.Add(-scheduleClockDrift))
+	}
+
+	return fires, err
+}
+
+// RescheduleForHoliday checks whether the due fire of this repeating schedule falls on a holiday, and if so returns
+// when it should fire instead
+func (s *Schedule) RescheduleForHoliday() (*time.Time, bool, error) {
+	if s.Holidays == nil || s.NextFire == nil || !s.IsRepeating() {
+		return nil, false, nil
+	}
+
+	tz, err := s.GetTimezone()
+	if err != nil {
+		return nil, false, fmt.Errorf("error loading timezone: %w", err)
+	}
+
+	if !s.Holidays.IsHoliday(*s.NextFire, tz) {
+		return nil, false, nil
+	}
+
+	next, err := s.avoidHolidays(s.NextFire)
+	return next, true, err
+}
+
+// if the given fire falls on a holiday, returns the fire after it which doesn't, or if the org shifts fires which fall
+// on holidays, the given fire moved to the next day which isn't a holiday
+func (s *Schedule) avoidHolidays(fire *time.Time) (*time.Time, error) {
+	if fire == nil || s.Holidays == nil || !s.IsRepeating() {
+		return fire, nil
+	}
+
+	tz, err := s.GetTimezone()
+	if err != nil {
+		return nil, fmt.Errorf("error loading timezone: %w", err)
+	}
+
+	for i := 0; i < cronSearchDays && s.Holidays.IsHoliday(*fire, tz); i++ {
+		if s.Holidays.Mode == HolidayModeShift {
+			shifted := s.Holidays.Shift(*fire, tz)
+			return &shifted, nil
+		}
+
+		if fire, err = s.nextFire(*fire); err != nil || fire == nil {
+			return fire, err
+		}
+	}
+
+	return fire, nil
+}
+
+func (s *Schedule) nextFire(now time.Time) (*time.Time, error) {
+	tz, err := s.GetTimezone()
+	if err != nil {
+		return nil, fmt.Errorf("error loading timezone: %w", err)
+	}
+
+	if s.Cron != "" {
+		expr, err := ParseCronExpression(s.Cron)
+		if err != nil {
+			return nil, err
+		}
+		return expr.Next(now.Add(scheduleClockDrift), tz), nil
+	}
+
 	// Never repeats? no next fire
 	if s.RepeatPeriod == RepeatPeriodNever {
 		return nil, nil
@@ -196,13 +358,9 @@ func (s *Schedule) GetNextFire(now time.Time) (*time.Time, error) {
 	if s.RepeatMinuteOfHour == nil {
 		return nil, errors.New("no repeat_minute_of_hour set")
 	}
-	tz, err := s.GetTimezone()
-	if err != nil {
-		return nil, fmt.Errorf("error loading timezone: %w", err)
-	}
 
 	// increment now by a minute, we don't want to double schedule in case of small clock drifts between boxes or db
-	now = now.Add(time.Minute)
+	now = now.Add(scheduleClockDrift)
 
 	// change our time to be in our location
 	start := now.In(tz)
@@ -295,6 +453,8 @@ SELECT ROW_TO_JSON(s) FROM (
         s.next_fire,
         s.last_fire,
         o.timezone AS timezone,
+        o.config->'schedule_crons'->>s.id::text AS cron,
+        CASE WHEN jsonb_typeof(o.config->'holidays'->'dates') = 'array' THEN o.config->'holidays' END AS holidays,
         (SELECT ROW_TO_JSON(sb) FROM (
             SELECT
                 b.id AS broadcast_id,
@@ -321,7 +481,8 @@ SELECT ROW_TO_JSON(s) FROM (
                 'S' AS trigger_type,
                 (SELECT ARRAY_AGG(tc.contact_id) FROM (SELECT contact_id FROM triggers_trigger_contacts WHERE trigger_id = t.id) tc) AS contact_ids,
                 (SELECT ARRAY_AGG(tg.contactgroup_id) FROM (SELECT contactgroup_id FROM triggers_trigger_groups WHERE trigger_id = t.id) tg) AS include_group_ids,
-                (SELECT ARRAY_AGG(te.contactgroup_id) FROM (SELECT contactgroup_id FROM triggers_trigger_exclude_groups WHERE trigger_id = t.id) te) AS exclude_group_ids
+                (SELECT ARRAY_AGG(te.contactgroup_id) FROM (SELECT contactgroup_id FROM triggers_trigger_exclude_groups WHERE trigger_id = t.id) te) AS exclude_group_ids,
+                CASE WHEN jsonb_typeof(o.config->'smart_starts'->t.id::text->'query') = 'string' THEN o.config->'smart_starts'->t.id::text END AS smart_start
             FROM triggers_trigger t 
             WHERE t.schedule_id = s.id AND t.is_active = TRUE AND t.is_archived = FALSE
         ) r) AS trigger
@@ -0,0 +1,235 @@
+package models
+
+import (
+	"fmt"
+	"log/slog"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nyaruka/gocommon/jsonx"
+)
+
+// how far ahead we look for a time matching a cron expression before deciding there isn't one
+const cronSearchDays = 366 * 5
+
+var cronMonthNames = map[string]int{"JAN": 1, "FEB": 2, "MAR": 3, "APR": 4, "MAY": 5, "JUN": 6, "JUL": 7, "AUG": 8, "SEP": 9, "OCT": 10, "NOV": 11, "DEC": 12}
+var cronDayNames = map[string]int{"SUN": 0, "MON": 1, "TUE": 2, "WED": 3, "THU": 4, "FRI": 5, "SAT": 6}
+
+// CronExpression is a parsed cron expression with the standard five fields (minute, hour, day of month, month and day
+// of week). Days of the week can also be given as D#N to match the Nth occurrence of that day in the month, e.g.
+// "30 10 * * TUE#2" is every 2nd Tuesday at 10:30. As with standard cron, if both day fields are restricted then a day
+// matching either matches.
+type CronExpression struct {
+	minutes []int
+	hours   []int
+	doms    []int
+	months  []int
+	dows    []int
+	nthDows [][2]int // pairs of day of week and occurrence
+
+	domAny bool
+	dowAny bool
+}
+
+// ParseCronExpression parses the given cron expression
+func ParseCronExpression(s string) (*CronExpression, error) {
+	fields := strings.Fields(s)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("cron expression '%s' must have 5 fields", s)
+	}
+
+	c := &CronExpression{domAny: fields[2] == "*", dowAny: fields[4] == "*"}
+	var err error
+
+	if c.minutes, err = parseCronField(fields[0], 0, 59, nil); err != nil {
+		return nil, fmt.Errorf("invalid minute field: %w", err)
+	}
+	if c.hours, err = parseCronField(fields[1], 0, 23, nil); err != nil {
+		return nil, fmt.Errorf("invalid hour field: %w", err)
+	}
+	if c.doms, err = parseCronField(fields[2], 1, 31, nil); err != nil {
+		return nil, fmt.Errorf("invalid day of month field: %w", err)
+	}
+	if c.months, err = parseCronField(fields[3], 1, 12, cronMonthNames); err != nil {
+		return nil, fmt.Errorf("invalid month field: %w", err)
+	}
+
+	// day of week field can contain D#N items which we parse separately
+	var dowItems []string
+	for item := range strings.SplitSeq(fields[4], ",") {
+		if day, nth, isNth := strings.Cut(item, "#"); isNth {
+			d, err := parseCronValue(day, 0, 6, cronDayNames)
+			if err != nil {
+				return nil, fmt.Errorf("invalid day of week field: %w", err)
+			}
+			n, err := strconv.Atoi(nth)
+			if err != nil || n < 1 || n > 5 {
+				return nil, fmt.Errorf("invalid day of week field: invalid occurrence '%s'", nth)
+			}
+			c.nthDows = append(c.nthDows, [2]int{d, n})
+		} else {
+			dowItems = append(dowItems, item)
+		}
+	}
+	if len(dowItems) > 0 {
+		if c.dows, err = parseCronField(strings.Join(dowItems, ","), 0, 7, cronDayNames); err != nil {
+			return nil, fmt.Errorf("invalid day of week field: %w", err)
+		}
+		// 7 is also Sunday
+		for i, d := range c.dows {
+			if d == 7 {
+				c.dows[i] = 0
+			}
+		}
+	}
+
+	return c, nil
+}
+
+// Next returns the first time after the given time which matches this expression in the given timezone, or nil if
+// there isn't one in the next few years
+func (c *CronExpression) Next(after time.Time, tz *time.Location) *time.Time {
+	after = after.In(tz)
+
+	for d := range cronSearchDays {
+		day := time.Date(after.Year(), after.Month(), after.Day()+d, 0, 0, 0, 0, tz)
+		if !c.matchesDay(day) {
+			continue
+		}
+
+		for _, h := range c.hours {
+			for _, m := range c.minutes {
+				t := time.Date(day.Year(), day.Month(), day.Day(), h, m, 0, 0, tz)
+				if t.After(after) {
+					return &t
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func (c *CronExpression) matchesDay(day time.Time) bool {
+	if !slices.Contains(c.months, int(day.Month())) {
+		return false
+	}
+
+	domMatch := slices.Contains(c.doms, day.Day())
+	dowMatch := slices.Contains(c.dows, int(day.Weekday()))
+	for _, nd := range c.nthDows {
+		if int(day.Weekday()) == nd[0] && (day.Day()-1)/7+1 == nd[1] {
+			dowMatch = true
+		}
+	}
+
+	if c.domAny && c.dowAny {
+		return true
+	} else if c.domAny {
+		return dowMatch
+	} else if c.dowAny {
+		return domMatch
+	}
+	return domMatch || dowMatch
+}
+
+// parses a cron field of comma separated items which can be *, values, ranges and steps, e.g. "1-5,*/15"
+func parseCronField(field string, lo, hi int, names map[string]int) ([]int, error) {
+	values := make([]int, 0, 10)
+
+	for item := range strings.SplitSeq(field, ",") {
+		rng, stepStr, hasStep := strings.Cut(item, "/")
+		step := 1
+		if hasStep {
+			var err error
+			if step, err = strconv.Atoi(stepStr); err != nil || step < 1 {
+				return nil, fmt.Errorf("invalid step '%s'", stepStr)
+			}
+		}
+
+		start, end := lo, hi
+		if rng != "*" {
+			from, to, isRange := strings.Cut(rng, "-")
+			var err error
+			if start, err = parseCronValue(from, lo, hi, names); err != nil {
+				return nil, err
+			}
+			if isRange {
+				if end, err = parseCronValue(to, lo, hi, names); err != nil {
+					return nil, err
+				}
+			} else if !hasStep {
+				end = start
+			}
+			if start > end {
+				return nil, fmt.Errorf("invalid range '%s'", rng)
+			}
+		}
+
+		for v := start; v <= end; v += step {
+			values = append(values, v)
+		}
+	}
+
+	slices.Sort(values)
+	return slices.Compact(values), nil
+}
+
+func parseCronValue(s string, lo, hi int, names map[string]int) (int, error) {
+	if v, ok := names[strings.ToUpper(s)]; ok {
+		return v, nil
+	}
+	v, err := strconv.Atoi(s)
+	if err != nil || v < lo || v > hi {
+		return 0, fmt.Errorf("invalid value '%s'", s)
+	}
+	return v, nil
+}
+
+// HolidayMode is what happens to schedule fires which fall on a holiday
+type HolidayMode string
+
+const (
+	HolidayModeSkip  = HolidayMode("skip")
+	HolidayModeShift = HolidayMode("shift")
+)
+
+const configHolidays = "holidays"
+
+// HolidayCalendar is an org's calendar of holidays on which repeating schedules don't fire, configured as holidays in
+// the org config, e.g. {"dates": ["2025-12-25", "2026-01-01"], "mode": "shift"}. Fires which fall on a holiday are
+// either skipped (the default) or shifted to the same time on the next day which isn't a holiday.
+type HolidayCalendar struct {
+	Dates []string    `json:"dates"`
+	Mode  HolidayMode `json:"mode,omitempty"`
+}
+
+// HolidayCalendar returns the holiday calendar configured for this org, or nil if there isn't one
+func (o *Org) HolidayCalendar() *HolidayCalendar {
+	raw, ok := o.o.Config[configHolidays]
+	if !ok || raw == nil {
+		return nil
+	}
+
+	cal := &HolidayCalendar{}
+	if err := jsonx.Unmarshal(jsonx.MustMarshal(raw), cal); err != nil {
+		slog.Error("invalid holiday calendar in org config", "org_id", o.ID(), "error", err)
+		return nil
+	}
+	return cal
+}
+
+// IsHoliday returns whether the given time falls on a holiday in the given timezone
+func (h *HolidayCalendar) IsHoliday(t time.Time, tz *time.Location) bool {
+	return h != nil && slices.Contains(h.Dates, t.In(tz).Format(time.DateOnly))
+}
+
+// Shift returns the given time moved forward to the first day which isn't a holiday in the given timezone
+func (h *HolidayCalendar) Shift(t time.Time, tz *time.Location) time.Time {
+	t = t.In(tz)
+	for i := 0; i <= len(h.Dates) && h.IsHoliday(t, tz); i++ {
+		t = t.AddDate(0, 0, 1)
+	}
+	return t
+}
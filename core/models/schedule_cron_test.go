@@ -0,0 +1,91 @@
+package models_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nyaruka/mailroom/v26/core/models"
+	"github.com/nyaruka/mailroom/v26/testsuite"
+	"github.com/nyaruka/mailroom/v26/testsuite/testdb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCronExpression(t *testing.T) {
+	la, err := time.LoadLocation("America/Los_Angeles")
+	require.NoError(t, err)
+
+	errorTcs := []struct {
+		expression string
+		err        string
+	}{
+		{"* * * *", "cron expression '* * * *' must have 5 fields"},
+		{"60 * * * *", "invalid minute field: invalid value '60'"},
+		{"* 24 * * *", "invalid hour field: invalid value '24'"},
+		{"* * 0 * *", "invalid day of month field: invalid value '0'"},
+		{"* * * FOO *", "invalid month field: invalid value 'FOO'"},
+		{"* * * * MON#6", "invalid day of week field: invalid occurrence '6'"},
+		{"*/0 * * * *", "invalid minute field: invalid step '0'"},
+		{"* 10-5 * * *", "invalid hour field: invalid range '10-5'"},
+	}
+
+	for _, tc := range errorTcs {
+		_, err := models.ParseCronExpression(tc.expression)
+		assert.EqualError(t, err, tc.err, "error mismatch for '%s'", tc.expression)
+	}
+
+	tcs := []struct {
+		expression string
+		after      time.Time
+		next       time.Time
+	}{
+		{"0 9 * * *", time.Date(2025, 5, 5, 8, 0, 0, 0, la), time.Date(2025, 5, 5, 9, 0, 0, 0, la)},
+		{"0 9 * * *", time.Date(2025, 5, 5, 9, 0, 0, 0, la), time.Date(2025, 5, 6, 9, 0, 0, 0, la)},
+		{"30 10 * * TUE#2", time.Date(2025, 5, 5, 0, 0, 0, 0, la), time.Date(2025, 5, 13, 10, 30, 0, 0, la)},
+		{"0 8 * * 7", time.Date(2025, 5, 5, 0, 0, 0, 0, la), time.Date(2025, 5, 11, 8, 0, 0, 0, la)},
+		{"15,45 */6 1 JAN-MAR *", time.Date(2025, 5, 5, 0, 0, 0, 0, la), time.Date(2026, 1, 1, 0, 15, 0, 0, la)},
+		{"0 12 29 2 *", time.Date(2025, 5, 5, 0, 0, 0, 0, la), time.Date(2028, 2, 29, 12, 0, 0, 0, la)},
+		{"0 9 * * *", time.Date(2025, 5, 5, 17, 0, 0, 0, time.UTC), time.Date(2025, 5, 6, 9, 0, 0, 0, la)}, // converted to timezone
+	}
+
+	for _, tc := range tcs {
+		expr, err := models.ParseCronExpression(tc.expression)
+		require.NoError(t, err)
+
+		next := expr.Next(tc.after, la)
+		if assert.NotNil(t, next, "next is nil for '%s'", tc.expression) {
+			assert.Equal(t, tc.next, *next, "next mismatch for '%s' after %s", tc.expression, tc.after)
+		}
+	}
+
+	// 30th of February never happens
+	expr, err := models.ParseCronExpression("0 0 30 2 *")
+	require.NoError(t, err)
+	assert.Nil(t, expr.Next(time.Date(2025, 5, 5, 0, 0, 0, 0, la), la))
+}
+
+func TestHolidayCalendar(t *testing.T) {
+	_, rt := testsuite.Runtime(t)
+
+	oa := testdb.Org1.Load(t, rt)
+	assert.Nil(t, oa.Org().HolidayCalendar())
+
+	rt.DB.MustExec(`UPDATE orgs_org SET config = config || '{"holidays": {"dates": ["2025-12-25", "2025-12-26"], "mode": "shift"}}'::jsonb WHERE id = $1`, testdb.Org1.ID)
+
+	oa = testdb.Org1.Load(t, rt)
+	cal := oa.Org().HolidayCalendar()
+	require.NotNil(t, cal)
+	assert.Equal(t, models.HolidayModeShift, cal.Mode)
+
+	la, err := time.LoadLocation("America/Los_Angeles")
+	require.NoError(t, err)
+
+	assert.True(t, cal.IsHoliday(time.Date(2025, 12, 25, 9, 0, 0, 0, la), la))
+	assert.False(t, cal.IsHoliday(time.Date(2025, 12, 24, 20, 0, 0, 0, la), la))
+	assert.True(t, cal.IsHoliday(time.Date(2025, 12, 25, 4, 0, 0, 0, time.UTC), time.UTC))
+	assert.False(t, cal.IsHoliday(time.Date(2025, 12, 25, 4, 0, 0, 0, time.UTC), la)) // still 24th in LA
+	assert.Equal(t, time.Date(2025, 12, 27, 9, 0, 0, 0, la), cal.Shift(time.Date(2025, 12, 25, 9, 0, 0, 0, la), la))
+
+	var nilCal *models.HolidayCalendar
+	assert.False(t, nilCal.IsHoliday(time.Date(2025, 12, 25, 9, 0, 0, 0, la), la))
+}
@@ -352,6 +352,65 @@ func TestGetNextFire(t *testing.T) {
 			Schedule:      []byte(`{"repeat_period": "Y", "repeat_hour_of_day": 12, "repeat_minute_of_hour": 35}`),
 			ExpectedNexts: []time.Time{time.Date(2020, 8, 20, 12, 35, 0, 0, la)},
 		},
+		{
+			Label:         "invalid cron expression",
+			Now:           time.Date(2019, 8, 20, 10, 57, 0, 0, la),
+			Timezone:      "America/Los_Angeles",
+			Schedule:      []byte(`{"cron": "* * *"}`),
+			ExpectedError: "cron expression '* * *' must have 5 fields",
+		},
+		{
+			Label:    "cron on 2nd tuesday of month",
+			Now:      time.Date(2019, 8, 20, 10, 57, 0, 0, la),
+			Timezone: "America/Los_Angeles",
+			Schedule: []byte(`{"cron": "30 10 * * TUE#2"}`),
+			ExpectedNexts: []time.Time{
+				time.Date(2019, 9, 10, 10, 30, 0, 0, la),
+				time.Date(2019, 10, 8, 10, 30, 0, 0, la),
+				time.Date(2019, 11, 12, 10, 30, 0, 0, la),
+			},
+		},
+		{
+			Label:    "cron with steps and ranges",
+			Now:      time.Date(2019, 8, 23, 10, 50, 0, 0, la),
+			Timezone: "America/Los_Angeles",
+			Schedule: []byte(`{"cron": "*/15 9-10 * * MON-FRI"}`),
+			ExpectedNexts: []time.Time{
+				time.Date(2019, 8, 26, 9, 0, 0, 0, la),
+				time.Date(2019, 8, 26, 9, 15, 0, 0, la),
+			},
+		},
+		{
+			Label:    "cron with day of month or day of week",
+			Now:      time.Date(2019, 8, 20, 10, 57, 0, 0, la),
+			Timezone: "America/Los_Angeles",
+			Schedule: []byte(`{"cron": "0 12 1 * MON"}`),
+			ExpectedNexts: []time.Time{
+				time.Date(2019, 8, 26, 12, 0, 0, 0, la),
+				time.Date(2019, 9, 1, 12, 0, 0, 0, la),
+				time.Date(2019, 9, 2, 12, 0, 0, 0, la),
+			},
+		},
+		{
+			Label:    "daily repeat which skips holidays",
+			Now:      time.Date(2019, 8, 20, 13, 57, 0, 0, la),
+			Timezone: "America/Los_Angeles",
+			Schedule: []byte(`{"repeat_period": "D", "repeat_hour_of_day": 12, "repeat_minute_of_hour": 35, "holidays": {"dates": ["2019-08-21"]}}`),
+			ExpectedNexts: []time.Time{
+				time.Date(2019, 8, 22, 12, 35, 0, 0, la),
+				time.Date(2019, 8, 23, 12, 35, 0, 0, la),
+			},
+		},
+		{
+			Label:    "weekly repeat which shifts holidays",
+			Now:      time.Date(2019, 8, 20, 13, 57, 0, 0, la),
+			Timezone: "America/Los_Angeles",
+			Schedule: []byte(`{"repeat_period": "W", "repeat_days_of_week": "M", "repeat_hour_of_day": 12, "repeat_minute_of_hour": 35, "holidays": {"dates": ["2019-08-26"], "mode": "shift"}}`),
+			ExpectedNexts: []time.Time{
+				time.Date(2019, 8, 27, 12, 35, 0, 0, la),
+				time.Date(2019, 9, 2, 12, 35, 0, 0, la),
+			},
+		},
 	}
 
 	for _, tc := range tcs {
@@ -383,3 +442,36 @@ func TestGetNextFire(t *testing.T) {
 		}
 	}
 }
+
+func TestGetNextFires(t *testing.T) {
+	la, err := time.LoadLocation("America/Los_Angeles")
+	require.NoError(t, err)
+
+	sched := &models.Schedule{Timezone: "America/Los_Angeles", Cron: "0 9 * * *", Holidays: &models.HolidayCalendar{Dates: []string{"2019-08-22"}}}
+
+	fires, err := sched.GetNextFires(time.Date(2019, 8, 20, 10, 57, 0, 0, la), 3)
+	assert.NoError(t, err)
+	assert.Equal(t, []time.Time{
+		time.Date(2019, 8, 21, 9, 0, 0, 0, la),
+		time.Date(2019, 8, 23, 9, 0, 0, 0, la),
+		time.Date(2019, 8, 24, 9, 0, 0, 0, la),
+	}, fires)
+
+	// if the schedule has a next fire, that's the first
+	next := time.Date(2019, 8, 30, 12, 0, 0, 0, la)
+	sched = &models.Schedule{Timezone: "America/Los_Angeles", RepeatPeriod: models.RepeatPeriodNever, NextFire: &next}
+
+	fires, err = sched.GetNextFires(time.Date(2019, 8, 20, 10, 57, 0, 0, la), 3)
+	assert.NoError(t, err)
+	assert.Equal(t, []time.Time{next}, fires)
+
+	// check fire due on a holiday is rescheduled
+	sched = &models.Schedule{Timezone: "America/Los_Angeles", Cron: "0 9 * * *", Holidays: &models.HolidayCalendar{Dates: []string{"2019-08-22"}, Mode: models.HolidayModeShift}}
+	next = time.Date(2019, 8, 22, 9, 0, 0, 0, la)
+	sched.NextFire = &next
+
+	rescheduled, isHoliday, err := sched.RescheduleForHoliday()
+	assert.NoError(t, err)
+	assert.True(t, isHoliday)
+	assert.Equal(t, time.Date(2019, 8, 23, 9, 0, 0, 0, la), *rescheduled)
+}
@@ -0,0 +1,166 @@
+package models
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// how far back we look at inbound messages to learn when contacts are active
+const activeHourLookback = 90 * 24 * time.Hour
+
+const sqlSelectInboundHours = `
+  SELECT contact_id, EXTRACT(HOUR FROM created_on AT TIME ZONE $2)::int AS hour, count(*) AS count
+    FROM msgs_msg
+   WHERE contact_id = ANY($1) AND direction = 'I' AND created_on > $3
+GROUP BY 1, 2`
+
+const sqlSelectLastSeenHours = `
+SELECT id, EXTRACT(HOUR FROM last_seen_on AT TIME ZONE $2)::int AS hour
+  FROM contacts_contact
+ WHERE id = ANY($1) AND last_seen_on IS NOT NULL`
+
+// GetContactActiveHours learns the hour of the day (0-23 in the org timezone) at which each of the given contacts is
+// typically active, from their inbound messages over the last 90 days and their last seen time. Contacts who have
+// never been seen are omitted.
+func GetContactActiveHours(ctx context.Context, db DBorTx, oa *OrgAssets, contactIDs []ContactID, now time.Time) (map[ContactID]int, error) {
+	tz := oa.Env().Timezone().String()
+	votes := make(map[ContactID][24]int, len(contactIDs))
+
+	for idBatch := range slices.Chunk(contactIDs, 1000) {
+		rows, err := db.QueryContext(ctx, sqlSelectInboundHours, pq.Array(idBatch), tz, now.Add(-activeHourLookback))
+		if err != nil {
+			return nil, fmt.Errorf("error querying inbound message hours: %w", err)
+		}
+		for rows.Next() {
+			var contactID ContactID
+			var hour, count int
+			if err := rows.Scan(&contactID, &hour, &count); err != nil {
+				rows.Close()
+				return nil, fmt.Errorf("error scanning inbound message hour: %w", err)
+			}
+			v := votes[contactID]
+			v[hour] += count
+			votes[contactID] = v
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, fmt.Errorf("error querying inbound message hours: %w", err)
+		}
+
+		// last seen counts as one more message so that it decides for contacts who've never sent one
+		rows, err = db.QueryContext(ctx, sqlSelectLastSeenHours, pq.Array(idBatch), tz)
+		if err != nil {
+			return nil, fmt.Errorf("error querying last seen hours: %w", err)
+		}
+		for rows.Next() {
+			var contactID ContactID
+			var hour int
+			if err := rows.Scan(&contactID, &hour); err != nil {
+				rows.Close()
+				return nil, fmt.Errorf("error scanning last seen hour: %w", err)
+			}
+			v := votes[contactID]
+			v[hour]++
+			votes[contactID] = v
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, fmt.Errorf("error querying last seen hours: %w", err)
+		}
+	}
+
+	hours := make(map[ContactID]int, len(votes))
+	for contactID, v := range votes {
+		best := 0
+		for h := 1; h < 24; h++ {
+			if v[h] > v[best] {
+				best = h
+			}
+		}
+		hours[contactID] = best
+	}
+	return hours, nil
+}
+
+// NextActiveHour returns the start of the next occurrence of the given hour of the day in the given timezone, or now
+// if we're currently in that hour
+func NextActiveHour(now time.Time, hour int, tz *time.Location) time.Time {
+	local := now.In(tz)
+	if local.Hour() == hour {
+		return now
+	}
+
+	next := time.Date(local.Year(), local.Month(), local.Day(), hour, 0, 0, 0, tz)
+	if !next.After(now) {
+		next = time.Date(local.Year(), local.Month(), local.Day()+1, hour, 0, 0, 0, tz)
+	}
+	return next
+}
+
+// DeferBroadcastSends defers sending the given batch of a broadcast to those of its contacts whose active hour falls
+// within its optimization window, by creating a contact fire for each at that hour. Returns the batch of contacts which
+// should be sent to now, which are those who are active in the current hour, who have no active hour or whose active
+// hour falls outside of the window.
+func DeferBroadcastSends(ctx context.Context, db DBorTx, oa *OrgAssets, bcast *Broadcast, batch *BroadcastBatch, now time.Time) (*BroadcastBatch, error) {
+	hours, err := GetContactActiveHours(ctx, db, oa, batch.ContactIDs, now)
+	if err != nil {
+		return nil, err
+	}
+
+	until := now.Add(time.Duration(bcast.OptimizeWithin) * time.Hour)
+	sendNow := make([]ContactID, 0, len(batch.ContactIDs))
+	fires := make([]*ContactFire, 0, len(hours))
+
+	for _, contactID := range batch.ContactIDs {
+		hour, learned := hours[contactID]
+		if !learned {
+			sendNow = append(sendNow, contactID)
+			continue
+		}
+
+		if sendOn := NextActiveHour(now, hour, oa.Env().Timezone()); sendOn.After(now) && !sendOn.After(until) {
+			fires = append(fires, NewContactFireForBroadcast(bcast.OrgID, contactID, batch, sendOn))
+		} else {
+			sendNow = append(sendNow, contactID)
+		}
+	}
+
+	if err := InsertContactFires(ctx, db, fires); err != nil {
+		return nil, fmt.Errorf("error inserting broadcast fires: %w", err)
+	}
+
+	return batch.ForContacts(sendNow), nil
+}
+
+// DeferBroadcastSendsUntil defers sending the given batch of a broadcast to the given contacts until the given time
+func DeferBroadcastSendsUntil(ctx context.Context, db DBorTx, bcast *Broadcast, batch *BroadcastBatch, contactIDs []ContactID, until time.Time) error {
+	fires := make([]*ContactFire, len(contactIDs))
+	for i, contactID := range contactIDs {
+		fires[i] = NewContactFireForBroadcast(bcast.OrgID, contactID, batch, until)
+	}
+
+	if err := InsertContactFires(ctx, db, fires); err != nil {
+		return fmt.Errorf("error inserting broadcast fires: %w", err)
+	}
+	return nil
+}
+
+const sqlCountDeferredBroadcastSends = `
+SELECT count(*) FROM contacts_contactfire
+ WHERE fire_type = 'B' AND (scope = $1 OR scope LIKE $2) AND NOT (fire_on <= NOW() AND contact_id = ANY(COALESCE($3::int[], '{}')))`
+
+// CountDeferredBroadcastSends returns the number of sends of the given broadcast which are still deferred, including
+// those which are due but haven't been fired yet. The due sends of the given contacts are excluded as those are the
+// contacts of the batch being sent, whose fires may not have been deleted yet.
+func CountDeferredBroadcastSends(ctx context.Context, db DBorTx, bcastID BroadcastID, sending []ContactID) (int, error) {
+	var count int
+	err := db.GetContext(ctx, &count, sqlCountDeferredBroadcastSends, fmt.Sprint(bcastID), fmt.Sprintf("%d:%%", bcastID), pq.Array(sending))
+	if err != nil {
+		return 0, fmt.Errorf("error counting deferred sends for broadcast #%d: %w", bcastID, err)
+	}
+	return count, nil
+}
@@ -0,0 +1,101 @@
+package models_test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/nyaruka/gocommon/dbutil/assertdb"
+	"github.com/nyaruka/gocommon/i18n"
+	"github.com/nyaruka/mailroom/v26/core/models"
+	"github.com/nyaruka/mailroom/v26/testsuite"
+	"github.com/nyaruka/mailroom/v26/testsuite/testdb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNextActiveHour(t *testing.T) {
+	la, _ := time.LoadLocation("America/Los_Angeles")
+	now := time.Date(2026, 10, 18, 16, 30, 0, 0, time.UTC) // 09:30 in LA
+
+	assert.Equal(t, now, models.NextActiveHour(now, 9, la))
+	assert.Equal(t, time.Date(2026, 10, 18, 10, 0, 0, 0, la), models.NextActiveHour(now, 10, la))
+	assert.Equal(t, time.Date(2026, 10, 18, 23, 0, 0, 0, la), models.NextActiveHour(now, 23, la))
+	assert.Equal(t, time.Date(2026, 10, 19, 8, 0, 0, 0, la), models.NextActiveHour(now, 8, la))
+	assert.Equal(t, time.Date(2026, 10, 19, 0, 0, 0, 0, la), models.NextActiveHour(now, 0, la))
+}
+
+func TestOptimizedBroadcastSends(t *testing.T) {
+	ctx, rt := testsuite.Runtime(t)
+
+	oa := testdb.Org1.Load(t, rt)
+	now := time.Date(2026, 10, 18, 16, 30, 0, 0, time.UTC) // 09:30 in the org timezone
+
+	rt.DB.MustExec(`UPDATE contacts_contact SET last_seen_on = NULL`)
+
+	// Ann mostly messages at 10:xx, Bob has never messaged but was last seen at 15:xx, Cat's only message is too old
+	// to count and Dan has never been seen
+	ann1 := testdb.InsertIncomingMsg(t, rt, testdb.Org1, "0199f6aa-7a8b-7c9d-8e0f-1a2b3c4d5e6f", testdb.TwilioChannel, testdb.Ann, "Hi", models.MsgStatusHandled, "")
+	ann2 := testdb.InsertIncomingMsg(t, rt, testdb.Org1, "0199f6aa-8b9c-7d0e-8f1a-2b3c4d5e6f7a", testdb.TwilioChannel, testdb.Ann, "Hi", models.MsgStatusHandled, "")
+	ann3 := testdb.InsertIncomingMsg(t, rt, testdb.Org1, "0199f6aa-9c0d-7e1f-8a2b-3c4d5e6f7a8b", testdb.TwilioChannel, testdb.Ann, "Hi", models.MsgStatusHandled, "")
+	cat1 := testdb.InsertIncomingMsg(t, rt, testdb.Org1, "0199f6aa-0d1e-7f2a-8b3c-4d5e6f7a8b9c", testdb.TwilioChannel, testdb.Cat, "Hi", models.MsgStatusHandled, "")
+	rt.DB.MustExec(`UPDATE msgs_msg SET created_on = '2026-10-10T17:30:00Z' WHERE id = $1`, ann1.ID)
+	rt.DB.MustExec(`UPDATE msgs_msg SET created_on = '2026-10-12T17:05:00Z' WHERE id = $1`, ann2.ID)
+	rt.DB.MustExec(`UPDATE msgs_msg SET created_on = '2026-10-14T03:00:00Z' WHERE id = $1`, ann3.ID)
+	rt.DB.MustExec(`UPDATE msgs_msg SET created_on = '2026-05-01T12:00:00Z' WHERE id = $1`, cat1.ID)
+	rt.DB.MustExec(`UPDATE contacts_contact SET last_seen_on = '2026-10-16T22:15:00Z' WHERE id = $1`, testdb.Bob.ID)
+
+	contactIDs := []models.ContactID{testdb.Ann.ID, testdb.Bob.ID, testdb.Cat.ID, testdb.Dan.ID}
+
+	hours, err := models.GetContactActiveHours(ctx, rt.DB, oa, contactIDs, now)
+	require.NoError(t, err)
+	assert.Equal(t, map[models.ContactID]int{testdb.Ann.ID: 10, testdb.Bob.ID: 15}, hours)
+
+	// with a window of 3 hours, only Ann's send is deferred
+	bcast1 := testdb.InsertBroadcast(t, rt, testdb.Org1, "0199f6a8-2b3c-7d4e-8f5a-6b7c8d9e0f1a", "eng", map[i18n.Language]string{"eng": "Hi"}, models.NilScheduleID, nil, nil)
+	sendNow, err := models.DeferBroadcastSends(ctx, rt.DB, oa, &models.Broadcast{ID: bcast1.ID, OrgID: testdb.Org1.ID, OptimizeWithin: 3}, &models.BroadcastBatch{BroadcastID: bcast1.ID, ContactIDs: contactIDs}, now)
+	require.NoError(t, err)
+	assert.Equal(t, []models.ContactID{testdb.Bob.ID, testdb.Cat.ID, testdb.Dan.ID}, sendNow.ContactIDs)
+
+	assertdb.Query(t, rt.DB, `SELECT count(*) FROM contacts_contactfire WHERE fire_type = 'B' AND scope = $1`, fmt.Sprint(bcast1.ID)).Returns(1)
+	assertdb.Query(t, rt.DB, `SELECT count(*) FROM contacts_contactfire WHERE fire_type = 'B' AND scope = $1 AND contact_id = $2 AND fire_on = '2026-10-18T17:00:00Z'`, fmt.Sprint(bcast1.ID), testdb.Ann.ID).Returns(1)
+
+	// with a window of 24 hours, Bob's send is deferred too, and fires record the batch's variant and created contacts
+	bcast2 := testdb.InsertBroadcast(t, rt, testdb.Org1, "0199f6a8-4d5e-7f6a-8b7c-8d9e0f1a2b3c", "eng", map[i18n.Language]string{"eng": "Hi"}, models.NilScheduleID, nil, nil)
+	batch2 := &models.BroadcastBatch{
+		BroadcastID:       bcast2.ID,
+		ContactIDs:        contactIDs,
+		CreatedContactIDs: []models.ContactID{testdb.Bob.ID, testdb.Dan.ID},
+		Variant:           &models.Variant{UUID: "0199f6a8-5e6f-7a8b-8c9d-0e1f2a3b4c5d", Name: "A", Percent: 50},
+	}
+	sendNow, err = models.DeferBroadcastSends(ctx, rt.DB, oa, &models.Broadcast{ID: bcast2.ID, OrgID: testdb.Org1.ID, OptimizeWithin: 24}, batch2, now)
+	require.NoError(t, err)
+	assert.Equal(t, []models.ContactID{testdb.Cat.ID, testdb.Dan.ID}, sendNow.ContactIDs)
+	assert.Equal(t, []models.ContactID{testdb.Dan.ID}, sendNow.CreatedContactIDs)
+	assert.Equal(t, batch2.Variant, sendNow.Variant)
+
+	annScope := fmt.Sprintf("%d:0199f6a8-5e6f-7a8b-8c9d-0e1f2a3b4c5d", bcast2.ID)
+	bobScope := fmt.Sprintf("%d:0199f6a8-5e6f-7a8b-8c9d-0e1f2a3b4c5d:created", bcast2.ID)
+	assertdb.Query(t, rt.DB, `SELECT count(*) FROM contacts_contactfire WHERE fire_type = 'B' AND scope = $1 AND contact_id = $2`, annScope, testdb.Ann.ID).Returns(1)
+	assertdb.Query(t, rt.DB, `SELECT count(*) FROM contacts_contactfire WHERE fire_type = 'B' AND scope = $1 AND contact_id = $2 AND fire_on = '2026-10-18T22:00:00Z'`, bobScope, testdb.Bob.ID).Returns(1)
+
+	// a send which is due but hasn't been fired yet is still deferred
+	rt.DB.MustExec(`UPDATE contacts_contactfire SET fire_on = NOW() - INTERVAL '1 minute' WHERE scope = $1 AND contact_id = $2`, annScope, testdb.Ann.ID)
+	rt.DB.MustExec(`UPDATE contacts_contactfire SET fire_on = NOW() + INTERVAL '1 hour' WHERE scope = $1 AND contact_id = $2`, bobScope, testdb.Bob.ID)
+
+	deferred, err := models.CountDeferredBroadcastSends(ctx, rt.DB, bcast2.ID, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, deferred)
+
+	// unless it's being sent
+	deferred, err = models.CountDeferredBroadcastSends(ctx, rt.DB, bcast2.ID, []models.ContactID{testdb.Ann.ID, testdb.Bob.ID})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, deferred)
+
+	// once Ann's send has been fired, only Bob's is still deferred
+	rt.DB.MustExec(`DELETE FROM contacts_contactfire WHERE scope = $1 AND contact_id = $2`, annScope, testdb.Ann.ID)
+
+	deferred, err = models.CountDeferredBroadcastSends(ctx, rt.DB, bcast2.ID, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, deferred)
+}
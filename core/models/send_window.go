@@ -0,0 +1,242 @@
+package models
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/nyaruka/gocommon/i18n"
+	"github.com/nyaruka/gocommon/jsonx"
+	"github.com/nyaruka/goflow/assets"
+	"github.com/nyaruka/phonenumbers/v2"
+)
+
+const configCampaignSendWindows = "campaign_send_windows"
+
+// CampaignSendWindows are the send windows an org can put on its campaign points, configured as campaign_send_windows
+// in the org config, e.g. {"timezone_field": "tz", "country_timezones": {"RW": "Africa/Kigali"}, "points":
+// {"<point-uuid>": {"start": "09:00", "end": "18:00", "days": [1, 2, 3, 4, 5]}}}. Windows are evaluated in the
+// contact's own timezone which is taken from the timezone field if set, then from the country of their phone number,
+// and finally falls back to the org timezone. A sensitive timezone field is ignored as its values are encrypted.
+type CampaignSendWindows struct {
+	TimezoneField    string                                   `json:"timezone_field,omitempty"`
+	CountryTimezones map[i18n.Country]string                  `json:"country_timezones,omitempty"`
+	Points           map[assets.CampaignPointUUID]*SendWindow `json:"points,omitempty"`
+}
+
+// SendWindow is a time of day range (start inclusive, end exclusive) on the given days of the week (0 = Sunday),
+// or every day if no days are given
+type SendWindow struct {
+	Start string         `json:"start"`
+	End   string         `json:"end"`
+	Days  []time.Weekday `json:"days,omitempty"`
+
+	start, end int // minutes since midnight
+}
+
+// CampaignSendWindows returns the campaign send windows configured for this org, or nil if there are none
+func (o *Org) CampaignSendWindows() *CampaignSendWindows {
+	raw, ok := o.o.Config[configCampaignSendWindows]
+	if !ok || raw == nil {
+		return nil
+	}
+
+	windows := &CampaignSendWindows{}
+	if err := jsonx.Unmarshal(jsonx.MustMarshal(raw), windows); err != nil {
+		slog.Error("invalid campaign send windows in org config", "org_id", o.ID(), "error", err)
+		return nil
+	}
+	for uuid, w := range windows.Points {
+		if err := w.parse(); err != nil {
+			slog.Error("invalid campaign send window in org config", "org_id", o.ID(), "point_uuid", uuid, "error", err)
+			return nil
+		}
+	}
+	return windows
+}
+
+// ForPoint returns the send window for the given campaign point, or nil if it doesn't have one
+func (s *CampaignSendWindows) ForPoint(p *CampaignPoint) *SendWindow {
+	if s == nil {
+		return nil
+	}
+	return s.Points[p.UUID]
+}
+
+func (w *SendWindow) parse() error {
+	start, err := time.Parse("15:04", w.Start)
+	if err != nil {
+		return fmt.Errorf("invalid start time '%s'", w.Start)
+	}
+	end, err := time.Parse("15:04", w.End)
+	if err != nil {
+		return fmt.Errorf("invalid end time '%s'", w.End)
+	}
+
+	w.start, w.end = start.Hour()*60+start.Minute(), end.Hour()*60+end.Minute()
+	if w.start >= w.end {
+		return fmt.Errorf("start time '%s' isn't before end time '%s'", w.Start, w.End)
+	}
+
+	for _, d := range w.Days {
+		if d < time.Sunday || d > time.Saturday {
+			return fmt.Errorf("invalid day of week %d", d)
+		}
+	}
+	return nil
+}
+
+func (w *SendWindow) allowsDay(d time.Weekday) bool {
+	if len(w.Days) == 0 {
+		return true
+	}
+	for _, wd := range w.Days {
+		if wd == d {
+			return true
+		}
+	}
+	return false
+}
+
+// Next returns the earliest time at or after t which falls within this window in the given timezone
+func (w *SendWindow) Next(t time.Time, tz *time.Location) time.Time {
+	t = t.In(tz)
+
+	for d := range 8 {
+		start := time.Date(t.Year(), t.Month(), t.Day()+d, w.start/60, w.start%60, 0, 0, tz)
+		end := time.Date(t.Year(), t.Month(), t.Day()+d, w.end/60, w.end%60, 0, 0, tz)
+
+		if !w.allowsDay(start.Weekday()) {
+			continue
+		}
+		if d == 0 {
+			if !t.Before(end) {
+				continue
+			}
+			if !t.Before(start) {
+				return t
+			}
+		}
+		return start
+	}
+
+	return t // can't happen as windows always allow at least one day
+}
+
+const sqlSelectContactTimezoneInfo = `
+SELECT c.id, COALESCE(c.fields->$2->>'text', '') AS timezone, COALESCE((
+    SELECT u.path FROM contacts_contacturn u WHERE u.contact_id = c.id AND u.scheme = 'tel' ORDER BY u.priority DESC, u.id LIMIT 1
+  ), '') AS phone
+  FROM contacts_contact c
+ WHERE c.id = ANY($1)`
+
+// ContactTimezones resolves the timezone in which send windows should be evaluated for each of the given contacts
+func (s *CampaignSendWindows) ContactTimezones(ctx context.Context, db Queryer, oa *OrgAssets, contactIDs []ContactID) (map[ContactID]*time.Location, error) {
+	// values of sensitive fields are encrypted so can't be read here, and a sensitive timezone field is ignored
+	var fieldUUID assets.FieldUUID
+	if f := oa.FieldByKey(s.TimezoneField); f != nil && !f.Sensitive() {
+		fieldUUID = f.UUID()
+	}
+
+	rows, err := db.QueryContext(ctx, sqlSelectContactTimezoneInfo, pq.Array(contactIDs), fieldUUID)
+	if err != nil {
+		return nil, fmt.Errorf("error querying contact timezones: %w", err)
+	}
+	defer rows.Close()
+
+	orgTZ := oa.Env().Timezone()
+	locations := make(map[string]*time.Location)
+	tzs := make(map[ContactID]*time.Location, len(contactIDs))
+
+	loadLocation := func(name string) *time.Location {
+		if loc, cached := locations[name]; cached {
+			return loc
+		}
+		loc, _ := time.LoadLocation(name) // nil if not a valid timezone
+		locations[name] = loc
+		return loc
+	}
+
+	for rows.Next() {
+		var contactID ContactID
+		var timezone, phone string
+		if err := rows.Scan(&contactID, &timezone, &phone); err != nil {
+			return nil, fmt.Errorf("error scanning contact timezone: %w", err)
+		}
+
+		var tz *time.Location
+		if timezone != "" {
+			tz = loadLocation(timezone)
+		}
+		if tz == nil && phone != "" {
+			if country := s.phoneCountry(phone); country != i18n.NilCountry && s.CountryTimezones[country] != "" {
+				tz = loadLocation(s.CountryTimezones[country])
+			}
+		}
+		if tz == nil {
+			tz = orgTZ
+		}
+		tzs[contactID] = tz
+	}
+
+	return tzs, rows.Err()
+}
+
+func (s *CampaignSendWindows) phoneCountry(phone string) i18n.Country {
+	parsed, err := phonenumbers.Parse(phone, "")
+	if err != nil {
+		return i18n.NilCountry
+	}
+	return i18n.Country(phonenumbers.GetRegionCodeForNumber(parsed))
+}
+
+const sqlUpdateContactFireOn = `
+UPDATE contacts_contactfire
+   SET fire_on = r.fire_on
+  FROM (VALUES(:id::bigint, :fire_on::timestamptz)) AS r(id, fire_on)
+ WHERE contacts_contactfire.id = r.id`
+
+// DeferCampaignFires defers those of the given due fires for the given campaign point which fall outside of its send
+// window to the next time allowed for each contact, returning the fires which can be fired now and the number deferred.
+func DeferCampaignFires(ctx context.Context, db DBorTx, oa *OrgAssets, point *CampaignPoint, fires []*ContactFire, now time.Time) ([]*ContactFire, int, error) {
+	windows := oa.Org().CampaignSendWindows()
+	window := windows.ForPoint(point)
+	if window == nil {
+		return fires, 0, nil
+	}
+
+	contactIDs := make([]ContactID, len(fires))
+	for i, f := range fires {
+		contactIDs[i] = f.ContactID
+	}
+
+	tzs, err := windows.ContactTimezones(ctx, db, oa, contactIDs)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	due := make([]*ContactFire, 0, len(fires))
+	deferred := make([]*ContactFire, 0, len(fires))
+
+	for _, f := range fires {
+		tz := tzs[f.ContactID]
+		if tz == nil {
+			tz = oa.Env().Timezone()
+		}
+
+		if next := window.Next(now, tz); next.After(now) {
+			f.FireOn = next
+			deferred = append(deferred, f)
+		} else {
+			due = append(due, f)
+		}
+	}
+
+	if err := BulkQueryBatches(ctx, "deferring campaign fires", db, sqlUpdateContactFireOn, 1000, deferred); err != nil {
+		return nil, 0, err
+	}
+
+	return due, len(deferred), nil
+}
@@ -0,0 +1,82 @@
+package models_test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/nyaruka/gocommon/dbutil/assertdb"
+	"github.com/nyaruka/mailroom/v26/core/models"
+	"github.com/nyaruka/mailroom/v26/testsuite"
+	"github.com/nyaruka/mailroom/v26/testsuite/testdb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSendWindows(t *testing.T) {
+	ctx, rt := testsuite.Runtime(t)
+
+	rt.DB.MustExec(`UPDATE orgs_org SET config = config || '{"campaign_send_windows": {"timezone_field": "gender", "country_timezones": {"EC": "America/Guayaquil"}, "points": {"3c8eca88-a5f8-4e27-96f4-e47f19cc0de8": {"start": "09:00", "end": "18:00", "days": [1, 2, 3, 4, 5]}}}}'::jsonb WHERE id = $1`, testdb.Org1.ID)
+	rt.DB.MustExec(`UPDATE contacts_contact SET fields = fields || jsonb_build_object($2::text, jsonb_build_object('text', 'Asia/Tokyo')) WHERE id = $1`, testdb.Bob.ID, testdb.GenderField.UUID)
+
+	oa := testdb.Org1.Load(t, rt)
+
+	windows := oa.Org().CampaignSendWindows()
+	require.NotNil(t, windows)
+	assert.Nil(t, windows.ForPoint(oa.CampaignPointByID(testdb.RemindersPoint2.ID)))
+
+	window := windows.ForPoint(oa.CampaignPointByID(testdb.RemindersPoint1.ID))
+	require.NotNil(t, window)
+
+	kigali, _ := time.LoadLocation("Africa/Kigali")
+
+	tcs := []struct {
+		now  time.Time
+		next time.Time
+	}{
+		{time.Date(2025, 5, 5, 10, 0, 0, 0, kigali), time.Date(2025, 5, 5, 10, 0, 0, 0, kigali)},  // Monday in window
+		{time.Date(2025, 5, 5, 9, 0, 0, 0, kigali), time.Date(2025, 5, 5, 9, 0, 0, 0, kigali)},    // start of window
+		{time.Date(2025, 5, 5, 8, 0, 0, 0, kigali), time.Date(2025, 5, 5, 9, 0, 0, 0, kigali)},    // before window
+		{time.Date(2025, 5, 5, 18, 0, 0, 0, kigali), time.Date(2025, 5, 6, 9, 0, 0, 0, kigali)},   // end of window
+		{time.Date(2025, 5, 9, 19, 0, 0, 0, kigali), time.Date(2025, 5, 12, 9, 0, 0, 0, kigali)},  // Friday evening
+		{time.Date(2025, 5, 10, 12, 0, 0, 0, kigali), time.Date(2025, 5, 12, 9, 0, 0, 0, kigali)}, // Saturday
+		{time.Date(2025, 5, 5, 6, 0, 0, 0, time.UTC), time.Date(2025, 5, 5, 9, 0, 0, 0, kigali)},  // converted to timezone
+	}
+
+	for _, tc := range tcs {
+		assert.Equal(t, tc.next, window.Next(tc.now, kigali), "next mismatch for %s", tc.now)
+	}
+
+	// Ann has a US number so uses the org timezone, Bob has a timezone field value, Dan has an Ecuadorian number
+	tzs, err := windows.ContactTimezones(ctx, rt.DB, oa, []models.ContactID{testdb.Ann.ID, testdb.Bob.ID, testdb.Dan.ID})
+	require.NoError(t, err)
+	assert.Equal(t, "America/Los_Angeles", tzs[testdb.Ann.ID].String())
+	assert.Equal(t, "Asia/Tokyo", tzs[testdb.Bob.ID].String())
+	assert.Equal(t, "America/Guayaquil", tzs[testdb.Dan.ID].String())
+
+	for _, c := range []*testdb.Contact{testdb.Ann, testdb.Bob, testdb.Dan} {
+		testdb.InsertContactFire(t, rt, testdb.Org1, c, models.ContactFireTypeCampaignPoint, fmt.Sprintf("%d:1", testdb.RemindersPoint1.ID), time.Now().Add(-time.Second), "")
+	}
+
+	fires, err := models.LoadDueContactfires(ctx, rt, 10)
+	require.NoError(t, err)
+	require.Len(t, fires, 3)
+
+	// at 16:00 UTC on a Monday, it's 09:00 in LA, 01:00 Tuesday in Tokyo and 11:00 in Ecuador
+	now := time.Date(2025, 5, 5, 16, 0, 0, 0, time.UTC)
+
+	due, numDeferred, err := models.DeferCampaignFires(ctx, rt.DB, oa, oa.CampaignPointByID(testdb.RemindersPoint1.ID), fires, now)
+	require.NoError(t, err)
+	assert.Equal(t, 1, numDeferred)
+	assert.Len(t, due, 2)
+	assert.Equal(t, testdb.Ann.ID, due[0].ContactID)
+	assert.Equal(t, testdb.Dan.ID, due[1].ContactID)
+
+	assertdb.Query(t, rt.DB, `SELECT fire_on = '2025-05-06T00:00:00Z' FROM contacts_contactfire WHERE contact_id = $1`, testdb.Bob.ID).Returns(true)
+
+	// fires for points without a window are all due
+	due, numDeferred, err = models.DeferCampaignFires(ctx, rt.DB, oa, oa.CampaignPointByID(testdb.RemindersPoint2.ID), fires, now)
+	require.NoError(t, err)
+	assert.Equal(t, 0, numDeferred)
+	assert.Len(t, due, 3)
+}
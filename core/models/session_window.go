@@ -0,0 +1,138 @@
+package models
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/nyaruka/gocommon/i18n"
+	"github.com/nyaruka/gocommon/jsonx"
+	"github.com/nyaruka/goflow/assets"
+	"github.com/nyaruka/goflow/core"
+	"github.com/nyaruka/goflow/excellent/types"
+	"github.com/nyaruka/mailroom/v26/core/goflow"
+	"github.com/nyaruka/mailroom/v26/runtime"
+)
+
+const configSessionWindowFallback = "session_window_fallback"
+
+// how long after a contact's last message on a channel we can send them freeform messages on channels which enforce a
+// session window, i.e. WhatsApp
+const sessionWindowDuration = 24 * time.Hour
+
+// SessionWindowFallback is the template to send instead of a freeform message when a contact's session window is closed,
+// configured as session_window_fallback in the org config, e.g. {"template": "9c22b594-...", "variables": ["@contact.name",
+// "@text"]}. Variables are evaluated with the contact, fields, globals and urns, and the text of the freeform message.
+type SessionWindowFallback struct {
+	Template  assets.TemplateUUID `json:"template"`
+	Variables []string            `json:"variables,omitempty"`
+}
+
+// SessionWindowFallback returns the session window fallback configured for this org, or nil if there isn't one
+func (o *Org) SessionWindowFallback() *SessionWindowFallback {
+	raw, ok := o.o.Config[configSessionWindowFallback]
+	if !ok || raw == nil {
+		return nil
+	}
+
+	fallback := &SessionWindowFallback{}
+	if err := jsonx.Unmarshal(jsonx.MustMarshal(raw), fallback); err != nil {
+		slog.Error("invalid session window fallback in org config", "org_id", o.ID(), "error", err)
+		return nil
+	}
+	if fallback.Template == "" {
+		return nil
+	}
+	return fallback
+}
+
+// Apply tries to replace the given freeform message content with the fallback template. Returns nil templating and the
+// original content and locale if the template doesn't exist or has no translation for the channel.
+func (f *SessionWindowFallback) Apply(ctx context.Context, rt *runtime.Runtime, oa *OrgAssets, c *core.Contact, channel *Channel, content *core.MsgContent, locale i18n.Locale) (*core.MsgTemplating, *core.MsgContent, i18n.Locale) {
+	template := oa.TemplateByUUID(f.Template)
+	if template == nil {
+		return nil, content, locale
+	}
+
+	values := expressionsContextValues(oa, c)
+	values["text"] = types.NewXText(content.Text)
+	evalContext := types.NewXObject(values)
+	ev := goflow.Engine(rt).Evaluator()
+
+	variables := make([]string, len(f.Variables))
+	for i, v := range f.Variables {
+		var err error
+		variables[i], _, err = ev.Template(ctx, oa.Env(), evalContext, v, nil)
+		if err != nil {
+			slog.Error("error evaluating session window fallback variable", "org_id", oa.OrgID(), "template", f.Template, "variable", v, "error", err)
+		}
+	}
+
+	return templateMsgContent(oa, c, channel, template, variables, content, locale)
+}
+
+// looks for a translation of the given template for the channel in the contact's locale or the org's default locale,
+// and if found, returns the templating with a preview of the template as the message content and the locale of the
+// translation. Otherwise returns nil templating and the given content and locale.
+func templateMsgContent(oa *OrgAssets, c *core.Contact, channel *Channel, template *Template, variables []string, content *core.MsgContent, locale i18n.Locale) (*core.MsgTemplating, *core.MsgContent, i18n.Locale) {
+	flowTemplate := core.NewTemplate(template)
+	flowChannel := core.NewChannel(channel)
+
+	locales := make([]i18n.Locale, 0, 2)
+	if c.Language() != "" {
+		locales = append(locales, c.Locale(oa.Env()))
+	}
+	locales = append(locales, oa.Env().DefaultLocale())
+
+	trans := flowTemplate.FindTranslation(flowChannel, locales)
+	if trans == nil {
+		return nil, content, locale
+	}
+
+	translation := core.NewTemplateTranslation(trans)
+	templating := flowTemplate.Templating(translation, variables)
+
+	return templating, translation.Preview(templating.Variables), translation.Locale()
+}
+
+const sqlSelectOpenSessionWindows = `
+SELECT DISTINCT contact_id, channel_id
+  FROM msgs_msg
+ WHERE contact_id = ANY($1) AND direction = 'I' AND channel_id IS NOT NULL AND created_on > $2`
+
+// OpenSessionWindows are the channels on which each contact has sent a message recently enough that we can still send
+// them freeform messages on it
+type OpenSessionWindows map[ContactID][]ChannelID
+
+// IsOpen returns whether the given contact has an open session window on the given channel
+func (w OpenSessionWindows) IsOpen(contactID ContactID, channelID ChannelID) bool {
+	return slices.Contains(w[contactID], channelID)
+}
+
+// GetOpenSessionWindows looks up the open session windows of the given contacts
+func GetOpenSessionWindows(ctx context.Context, db Queryer, contactIDs []ContactID, now time.Time) (OpenSessionWindows, error) {
+	windows := make(OpenSessionWindows, len(contactIDs))
+	if len(contactIDs) == 0 {
+		return windows, nil
+	}
+
+	rows, err := db.QueryContext(ctx, sqlSelectOpenSessionWindows, pq.Array(contactIDs), now.Add(-sessionWindowDuration))
+	if err != nil {
+		return nil, fmt.Errorf("error querying open session windows: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var contactID ContactID
+		var channelID ChannelID
+		if err := rows.Scan(&contactID, &channelID); err != nil {
+			return nil, fmt.Errorf("error scanning open session window: %w", err)
+		}
+		windows[contactID] = append(windows[contactID], channelID)
+	}
+
+	return windows, rows.Err()
+}
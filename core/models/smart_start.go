@@ -0,0 +1,130 @@
+package models
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	dbtypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/lib/pq"
+	"github.com/nyaruka/gocommon/aws/dynamo"
+	"github.com/nyaruka/gocommon/uuids"
+	"github.com/nyaruka/mailroom/v26/runtime"
+)
+
+// how many fires of a smart start we report
+const smartStartFiresMax = 100
+
+// SmartStart turns a scheduled trigger into a start of the contacts who match a query at the time of each fire, rather
+// than a fixed set of groups and contacts. Smart starts are configured as smart_starts in the org config, keyed by
+// trigger id, e.g. {"123": {"query": "enrolled = yes", "exclude_in_a_flow": true, "limit": 1000}}.
+type SmartStart struct {
+	Query                    string `json:"query"`
+	ExcludeStartedPreviously bool   `json:"exclude_started_previously,omitempty"`
+	ExcludeInAFlow           bool   `json:"exclude_in_a_flow,omitempty"`
+	Limit                    int    `json:"limit,omitempty"`
+}
+
+// SmartStartLink links a flow start to the trigger whose smart start created it
+type SmartStartLink struct {
+	OrgID     OrgID
+	TriggerID TriggerID
+	StartID   StartID
+}
+
+// DynamoKey returns the PK+SK combo used for persistence
+func (l *SmartStartLink) DynamoKey() dynamo.Key {
+	return dynamo.Key{PK: fmt.Sprintf("trg#%d", l.TriggerID), SK: fmt.Sprintf("sta#%d", l.StartID)}
+}
+
+func (l *SmartStartLink) MarshalDynamo() (*dynamo.Item, error) {
+	return &dynamo.Item{
+		Key:   l.DynamoKey(),
+		OrgID: int(l.OrgID),
+		Data:  map[string]any{"start_id": int(l.StartID)},
+	}, nil
+}
+
+// InsertSmartStartLink links the given start to the trigger of its smart start
+func InsertSmartStartLink(ctx context.Context, rt *runtime.Runtime, start *FlowStart) error {
+	item, err := (&SmartStartLink{OrgID: start.OrgID, TriggerID: start.TriggerID, StartID: start.ID}).MarshalDynamo()
+	if err != nil {
+		return err
+	}
+
+	if err := putDynamoItems(ctx, rt.Dynamo.Main, []*dynamo.Item{item}); err != nil {
+		return fmt.Errorf("error linking start #%d to trigger #%d: %w", start.ID, start.TriggerID, err)
+	}
+	return nil
+}
+
+// SmartStartFire is a single fire of a smart start
+type SmartStartFire struct {
+	StartUUID uuids.UUID `json:"start_uuid"`
+	FiredOn   time.Time  `json:"fired_on"`
+	Count     int        `json:"count"`
+}
+
+const sqlSelectSmartStartFires = `
+  SELECT uuid, created_on, COALESCE(contact_count, 0)
+    FROM flows_flowstart
+   WHERE org_id = $1 AND id = ANY($2)
+ORDER BY created_on DESC, id DESC
+   LIMIT $3`
+
+// GetSmartStartFires returns the recent fires of the smart start of the given trigger, most recent first
+func GetSmartStartFires(ctx context.Context, rt *runtime.Runtime, orgID OrgID, triggerID TriggerID) ([]*SmartStartFire, error) {
+	paginator := dynamodb.NewQueryPaginator(rt.Dynamo.Main.Client(), &dynamodb.QueryInput{
+		TableName:              aws.String(rt.Dynamo.Main.Table()),
+		KeyConditionExpression: aws.String("PK = :pk"),
+		ExpressionAttributeValues: map[string]dbtypes.AttributeValue{
+			":pk": &dbtypes.AttributeValueMemberS{Value: fmt.Sprintf("trg#%d", triggerID)},
+		},
+	})
+
+	startIDs := make([]StartID, 0)
+
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("error querying starts of trigger #%d: %w", triggerID, err)
+		}
+
+		for _, attrs := range page.Items {
+			item := &dynamo.Item{}
+			if err := attributevalue.UnmarshalMap(attrs, item); err != nil {
+				return nil, fmt.Errorf("error unmarshaling start link item: %w", err)
+			}
+			if item.OrgID != int(orgID) {
+				continue
+			}
+
+			startID, _ := item.Data["start_id"].(float64)
+			startIDs = append(startIDs, StartID(startID))
+		}
+	}
+
+	fires := make([]*SmartStartFire, 0, min(len(startIDs), smartStartFiresMax))
+	if len(startIDs) == 0 {
+		return fires, nil
+	}
+
+	rows, err := rt.ReadonlyDB.QueryContext(ctx, sqlSelectSmartStartFires, orgID, pq.Array(startIDs), smartStartFiresMax)
+	if err != nil {
+		return nil, fmt.Errorf("error querying starts of trigger #%d: %w", triggerID, err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		fire := &SmartStartFire{}
+		if err := rows.Scan(&fire.StartUUID, &fire.FiredOn, &fire.Count); err != nil {
+			return nil, fmt.Errorf("error scanning smart start fire: %w", err)
+		}
+		fires = append(fires, fire)
+	}
+
+	return fires, rows.Err()
+}
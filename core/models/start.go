@@ -94,6 +94,9 @@ type FlowStart struct {
 	ExcludeGroupIDs []GroupID   `json:"exclude_group_ids,omitempty"` // used when loading scheduled triggers as flow starts
 	Query           string      `json:"query,omitempty"`
 	Exclusions      Exclusions  `json:"exclusions"`
+	Variants        []*Variant  `json:"variants,omitempty"`   // experiment variants aren't saved in the db, only carried by the task
+	Limit           int         `json:"limit,omitempty"`      // maximum number of contacts to start, only carried by the task
+	TriggerID       TriggerID   `json:"trigger_id,omitempty"` // the trigger of a smart start, which the start is linked to
 
 	// used for non-persistent starts from flow actions
 	CreateContact  bool            `json:"create_contact"`
@@ -155,6 +158,11 @@ func (s *FlowStart) WithExcludeInAFlow(exclude bool) *FlowStart {
 	return s
 }
 
+func (s *FlowStart) WithLimit(limit int) *FlowStart {
+	s.Limit = limit
+	return s
+}
+
 func (s *FlowStart) WithCreateContact(create bool) *FlowStart {
 	s.CreateContact = create
 	return s
@@ -316,10 +324,11 @@ const sqlInsertStartGroup = `
 INSERT INTO flows_flowstart_groups(flowstart_id, contactgroup_id) VALUES(:flowstart_id, :contactgroup_id)`
 
 // CreateBatch creates a batch for this start using the passed in contact ids
-func (s *FlowStart) CreateBatch(contactIDs []ContactID, totalContacts int) *FlowStartBatch {
+func (s *FlowStart) CreateBatch(contactIDs []ContactID, totalContacts int, variant *Variant) *FlowStartBatch {
 	b := &FlowStartBatch{
 		ContactIDs:    contactIDs,
 		TotalContacts: totalContacts,
+		Variant:       variant,
 	}
 
 	if s.ID != NilStartID {
@@ -339,6 +348,9 @@ type FlowStartBatch struct {
 
 	ContactIDs    []ContactID `json:"contact_ids"`
 	TotalContacts int         `json:"total_contacts"`
+
+	// if the start is an experiment, the variant that these contacts were assigned
+	Variant *Variant `json:"variant,omitempty"`
 }
 
 // ReadSessionHistory reads a session history from the given JSON
@@ -208,6 +208,29 @@ func UpdateTickets(ctx context.Context, tx DBorTx, tickets []*Ticket) error {
 	return nil
 }
 
+const sqlUpdateTicketContact = `
+UPDATE tickets_ticket
+   SET contact_id = $2, modified_on = NOW()
+ WHERE id = ANY($1)`
+
+// MoveTickets moves the passed in tickets to the given contact, e.g. when merging contacts
+func MoveTickets(ctx context.Context, db DBorTx, tickets []*Ticket, contactID ContactID) error {
+	if len(tickets) == 0 {
+		return nil
+	}
+
+	ids := make([]TicketID, len(tickets))
+	for i, t := range tickets {
+		ids[i] = t.ID
+		t.ContactID = contactID
+	}
+
+	if _, err := db.ExecContext(ctx, sqlUpdateTicketContact, pq.Array(ids), contactID); err != nil {
+		return fmt.Errorf("error moving tickets: %w", err)
+	}
+	return nil
+}
+
 const sqlUpdateTicketRepliedOn = `
    UPDATE tickets_ticket t1
       SET last_activity_on = $2, replied_on = LEAST(t1.replied_on, $2)
@@ -65,6 +65,7 @@ type Trigger struct {
 		IncludeGroupIDs []GroupID      `json:"include_group_ids"`
 		ExcludeGroupIDs []GroupID      `json:"exclude_group_ids"`
 		ContactIDs      []ContactID    `json:"contact_ids,omitempty"`
+		SmartStart      *SmartStart    `json:"smart_start,omitempty"`
 	}
 }
 
@@ -81,6 +82,7 @@ func (t *Trigger) ReferrerID() string         { return t.t.ReferrerID }
 func (t *Trigger) IncludeGroupIDs() []GroupID { return t.t.IncludeGroupIDs }
 func (t *Trigger) ExcludeGroupIDs() []GroupID { return t.t.ExcludeGroupIDs }
 func (t *Trigger) ContactIDs() []ContactID    { return t.t.ContactIDs }
+func (t *Trigger) SmartStart() *SmartStart    { return t.t.SmartStart }
 func (t *Trigger) KeywordMatchType() triggers.KeywordMatchType {
 	if t.t.MatchType == MatchFirst {
 		return triggers.KeywordMatchTypeFirstWord
@@ -90,12 +92,24 @@ func (t *Trigger) KeywordMatchType() triggers.KeywordMatchType {
 
 func (t *Trigger) UnmarshalJSON(b []byte) error { return json.Unmarshal(b, &t.t) }
 
-// CreateStart generates an insertable flow start for scheduled trigger
+// CreateStart generates an insertable flow start for scheduled trigger, which for a smart start will resolve its query
+// when the start is processed
 func (t *Trigger) CreateStart() *FlowStart {
-	return NewFlowStart(t.t.OrgID, StartTypeTrigger, t.t.FlowID).
+	start := NewFlowStart(t.t.OrgID, StartTypeTrigger, t.t.FlowID).
 		WithContactIDs(t.t.ContactIDs).
 		WithGroupIDs(t.t.IncludeGroupIDs).
 		WithExcludeGroupIDs(t.t.ExcludeGroupIDs)
+
+	if ss := t.t.SmartStart; ss != nil {
+		start = start.
+			WithQuery(ss.Query).
+			WithExcludeStartedPreviously(ss.ExcludeStartedPreviously).
+			WithExcludeInAFlow(ss.ExcludeInAFlow).
+			WithLimit(ss.Limit)
+		start.TriggerID = t.t.ID
+	}
+
+	return start
 }
 
 // loadTriggers loads all non-schedule triggers for the passed in org
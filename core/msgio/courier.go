@@ -8,6 +8,7 @@ import (
 	"io"
 	"log/slog"
 	"net/http"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
@@ -89,6 +90,7 @@ type Msg struct {
 	Flow                 *FlowRef           `json:"flow,omitempty"`
 	UserID               models.UserID      `json:"user_id,omitempty"`
 	ResponseToExternalID string             `json:"response_to_external_id,omitempty"`
+	EmailMessageID       string             `json:"email_message_id,omitempty"`
 	IsResend             bool               `json:"is_resend,omitempty"`
 	PrevAttempts         int                `json:"prev_attempts,omitempty"`
 	Session              *Session           `json:"session,omitempty"`
@@ -163,6 +165,11 @@ func NewCourierMsg(oa *models.OrgAssets, mo *models.MsgOut, ch *models.Channel)
 	if mo.ReplyTo != nil {
 		msg.ResponseToExternalID = mo.ReplyTo.ExtID
 	}
+
+	// emails are sent with a Message-ID we generate so that replies can be threaded back to them
+	if slices.Contains(ch.Schemes(), urns.Email.Prefix) {
+		msg.EmailMessageID = models.EmailMessageID(mo.UUID(), ch)
+	}
 	if mo.Session != nil {
 		msg.Session = &Session{
 			UUID:       mo.Session.UUID(),
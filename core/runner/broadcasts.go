@@ -5,6 +5,8 @@ import (
 	"fmt"
 	"time"
 
+	"github.com/nyaruka/gocommon/dates"
+	"github.com/nyaruka/gocommon/urns"
 	"github.com/nyaruka/goflow/flows"
 	"github.com/nyaruka/mailroom/v26/core/models"
 	"github.com/nyaruka/mailroom/v26/runtime"
@@ -25,6 +27,18 @@ func BroadcastWithLock(ctx context.Context, rt *runtime.Runtime, oa *models.OrgA
 		}
 	}
 
+	// look up the session windows of contacts who'll be messaged on WhatsApp in one query rather than for each message
+	waContactIDs := make([]models.ContactID, 0, len(scenes))
+	for _, scene := range scenes {
+		if r := scene.Contact.ResolveRoute(); r != nil && r.URN.Scheme() == urns.WhatsApp.Prefix {
+			waContactIDs = append(waContactIDs, scene.ContactID())
+		}
+	}
+	windows, err := models.GetOpenSessionWindows(ctx, rt.DB, waContactIDs, dates.Now())
+	if err != nil {
+		return nil, nil, err
+	}
+
 	created := make(map[models.ContactID]bool, len(batch.CreatedContactIDs))
 	for _, id := range batch.CreatedContactIDs {
 		created[id] = true
@@ -45,7 +59,7 @@ func BroadcastWithLock(ctx context.Context, rt *runtime.Runtime, oa *models.OrgA
 
 		scene.Broadcast = broadcast
 
-		event, err := broadcast.Send(ctx, rt, oa, scene.Contact)
+		event, err := broadcast.Send(ctx, rt, oa, scene.Contact, windows)
 		if err != nil {
 			return nil, nil, fmt.Errorf("error creating broadcast message event for contact %d: %w", scene.Contact.ID(), err)
 		}
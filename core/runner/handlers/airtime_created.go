@@ -2,6 +2,7 @@ package handlers
 
 import (
 	"context"
+	"fmt"
 	"log/slog"
 	"time"
 
@@ -51,6 +52,27 @@ func handleAirtimeCreated(ctx context.Context, rt *runtime.Runtime, oa *models.O
 	}
 
 	scene.AttachPreCommitHook(hooks.InsertAirtimeTransfers, transfer)
+
+	// limits were checked before the transfer was created for the flow the session was started or resumed in, but a
+	// subflow entered in the same sprint can only be checked now that we know it created the transfer
+	if step := event.Step(); step != nil && step.Flow.UUID != models.AirtimeFlowFromContext(ctx) {
+		if err := models.CheckFlowAirtimeLimits(ctx, rt, oa, step.Flow.UUID, transfer); err != nil {
+			if !models.IsAirtimeLimitError(err) {
+				return fmt.Errorf("error checking flow airtime limits: %w", err)
+			}
+
+			// don't confirm the transfer so that it's never sent, record why on its event and release what it was
+			// counted as against the limits of the org and the flow of the session
+			slog.Error("airtime transfer by subflow exceeds its limits, cancelling", "transfer", transfer.UUID(), "flow", step.Flow.UUID, "reason", err)
+			transfer.Cancel(err.Error())
+
+			if err := models.ReleaseAirtimeUsage(ctx, rt, oa, transfer); err != nil {
+				slog.Error("error releasing airtime usage", "org_id", oa.OrgID(), "error", err)
+			}
+			return nil
+		}
+	}
+
 	scene.AttachPostCommitHook(hooks.ConfirmAirtimeTransfers, transfer)
 
 	return nil
@@ -2,6 +2,7 @@ package handlers
 
 import (
 	"context"
+	"fmt"
 	"log/slog"
 
 	"github.com/nyaruka/goflow/core/events"
@@ -14,11 +15,16 @@ func init() {
 	runner.RegisterEventHandler(events.TypeEmailSent, handleEmailSent)
 }
 
-// goflow now sends email so this just logs the event
+// goflow sends the email so we just need to match the event to the provider's message id, if there is one, so that
+// delivery events can be recorded against it
 func handleEmailSent(ctx context.Context, rt *runtime.Runtime, oa *models.OrgAssets, scene *runner.Scene, e events.Event, userID models.UserID) error {
 	event := e.(*events.EmailSent)
 
 	slog.Debug("email sent", "contact", scene.ContactUUID(), "session", scene.SessionUUID(), "subject", event.Subject, "body", event.Body)
 
+	if err := models.RecordEmailSent(ctx, rt, oa.OrgID(), scene.ContactUUID(), event); err != nil {
+		return fmt.Errorf("error recording email sent: %w", err)
+	}
+
 	return nil
 }
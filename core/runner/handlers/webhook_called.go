@@ -6,6 +6,7 @@ import (
 	"log/slog"
 	"time"
 
+	"github.com/nyaruka/gocommon/stringsx"
 	"github.com/nyaruka/goflow/core"
 	"github.com/nyaruka/goflow/core/events"
 	"github.com/nyaruka/mailroom/v26/core/models"
@@ -40,11 +41,12 @@ func handleWebhookCalled(ctx context.Context, rt *runtime.Runtime, oa *models.Or
 		return fmt.Errorf("unable to load flow with uuid: %s: %w", e.Step().Flow.UUID, err)
 	}
 
-	// create an HTTP log
+	// create an HTTP log with any values of sensitive fields redacted
+	redact := stringsx.NewRedactor(core.RedactionMask, models.SensitiveFieldValues(oa, scene.Contact)...)
 	httpLog := models.NewWebhookCalledLog(
 		oa.OrgID(),
 		flow.(*models.Flow).ID(),
-		event.URL, event.StatusCode, event.Request, event.Response,
+		redact(event.URL), event.StatusCode, redact(event.Request), redact(event.Response),
 		event.Status != core.CallStatusSuccess,
 		time.Millisecond*time.Duration(event.ElapsedMS),
 		event.Retries,
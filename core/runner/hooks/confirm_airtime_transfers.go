@@ -15,7 +15,10 @@ import (
 // ConfirmAirtimeTransfers is our post-commit hook that triggers the provider to actually send the airtime
 // for each pending transfer initiated during the sprint. Confirm failures are not retried and leave the
 // row pending; DT One auto-cancels held transactions after its expiration window and sends us a callback
-// that transitions the row to failed, so even the "transaction permanently stuck" case converges.
+// that transitions the row to failed, so even the "transaction permanently stuck" case converges. If that callback
+// is lost too, the reconcile_airtime cron will eventually ask the provider for the status. Providers without a held
+// state (i.e. Reloadly) only submit the transfer on Confirm and return their transaction id, which we save to the row
+// so that their callbacks can be matched to it.
 var ConfirmAirtimeTransfers runner.PostCommitHook = &confirmAirtimeTransfers{}
 
 type confirmAirtimeTransfers struct{}
@@ -50,7 +53,8 @@ func (h *confirmAirtimeTransfers) Execute(ctx context.Context, rt *runtime.Runti
 			transfer := arg.(*models.AirtimeTransfer)
 
 			logger := &core.HTTPLogger{}
-			confirmErr := svc.Confirm(ctx, &core.AirtimeTransfer{ExternalID: transfer.ExternalID()}, logger.Log)
+			confirmed := &core.AirtimeTransfer{ExternalID: transfer.ExternalID(), Recipient: transfer.Recipient(), Currency: transfer.Currency(), Amount: transfer.Amount()}
+			confirmErr := svc.Confirm(ctx, confirmed, logger.Log)
 
 			for _, l := range logger.Logs {
 				log := models.NewAirtimeTransferredLog(
@@ -70,6 +74,10 @@ func (h *confirmAirtimeTransfers) Execute(ctx context.Context, rt *runtime.Runti
 
 			if confirmErr != nil {
 				slog.Warn("airtime transfer failed to confirm, leaving pending", "transfer", transfer.UUID(), "error", confirmErr)
+			} else if confirmed.ExternalID != transfer.ExternalID() {
+				if err := models.UpdateAirtimeTransferExternalID(ctx, rt.DB, transfer, confirmed.ExternalID); err != nil {
+					slog.Error("error saving external id of confirmed airtime transfer", "transfer", transfer.UUID(), "error", err)
+				}
 			}
 		}
 	}
@@ -103,3 +103,35 @@ func TestConfirmAirtimeTransfers(t *testing.T) {
 		})
 	}
 }
+
+func TestConfirmAirtimeTransfersReloadly(t *testing.T) {
+	ctx, rt := testsuite.Runtime(t)
+
+	rt.DB.MustExec(`UPDATE orgs_org SET config = '{"airtime_provider": "reloadly", "reloadly_client_id": "id123", "reloadly_client_secret": "sesame"}'::jsonb WHERE id = $1`, testdb.Org1.ID)
+
+	oa, err := models.GetOrgAssets(ctx, rt, testdb.Org1.ID)
+	require.NoError(t, err)
+
+	rt.HTTP.Services.Transport, _ = testsuite.MockTransport(map[string][]*httpx.MockResponse{
+		"https://auth.reloadly.com/oauth/token":    {httpx.NewMockResponse(200, nil, []byte(`{"access_token": "tok123", "expires_in": 86400, "token_type": "Bearer"}`))},
+		"https://topups.reloadly.com/topups-async": {httpx.NewMockResponse(200, nil, []byte(`{"transactionId": 4602843}`))},
+	})
+
+	// Reloadly transfers are only reserved when created
+	uuid := events.NewEventUUID()
+	tr := models.NewAirtimeTransfer(testdb.Org1.ID, testdb.Ann.ID, events.NewAirtimeCreated(uuid, &core.AirtimeTransfer{
+		ExternalID: "reserved:341:" + string(uuid),
+		Recipient:  urns.URN("tel:+250788123456"),
+		Currency:   "RWF",
+		Amount:     decimal.RequireFromString("500"),
+	}, nil))
+	require.NoError(t, models.InsertAirtimeTransfers(ctx, rt.DB, []*models.AirtimeTransfer{tr}))
+
+	mc, contact, _ := testdb.Ann.Load(t, rt, oa)
+	scene := runner.NewScene(mc, contact)
+	require.NoError(t, hooks.ConfirmAirtimeTransfers.Execute(ctx, rt, oa, map[*runner.Scene][]any{scene: {tr}}))
+
+	// confirming submits the topup and saves its transaction id so that callbacks can be matched to the row
+	assertdb.Query(t, rt.DB, `SELECT external_id FROM airtime_airtimetransfer WHERE uuid = $1`, uuid).Returns("4602843")
+	assertdb.Query(t, rt.DB, `SELECT count(*) FROM request_logs_httplog WHERE airtime_transfer_id = $1`, tr.ID()).Returns(2)
+}
@@ -18,12 +18,17 @@ type insertAirtimeTransfers struct{}
 func (h *insertAirtimeTransfers) Order() int { return 10 }
 
 func (h *insertAirtimeTransfers) Execute(ctx context.Context, rt *runtime.Runtime, tx *sqlx.Tx, oa *models.OrgAssets, scenes map[*runner.Scene][]any) error {
-	// gather all our transfers
+	// gather all our transfers, and tags for those we cancelled so the reason is recorded on their events
 	transfers := make([]*models.AirtimeTransfer, 0, len(scenes))
-	for _, args := range scenes {
+	tags := make([]*models.EventTag, 0)
+	for s, args := range scenes {
 		for _, t := range args {
 			transfer := t.(*models.AirtimeTransfer)
 			transfers = append(transfers, transfer)
+
+			if transfer.Status() == models.AirtimeTransferStatusCancelled {
+				tags = append(tags, models.NewAirtimeCancelledTag(oa.OrgID(), s.ContactUUID(), transfer.UUID(), transfer.CancelReason()))
+			}
 		}
 	}
 
@@ -44,5 +49,11 @@ func (h *insertAirtimeTransfers) Execute(ctx context.Context, rt *runtime.Runtim
 		return fmt.Errorf("error inserting airtime transfer logs: %w", err)
 	}
 
+	for _, tag := range tags {
+		if _, err := rt.Dynamo.History.Queue(tag); err != nil {
+			return fmt.Errorf("error queuing airtime status tag to writer: %w", err)
+		}
+	}
+
 	return nil
 }
@@ -0,0 +1,52 @@
+package hooks
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/nyaruka/goflow/core"
+	"github.com/nyaruka/goflow/core/events"
+	"github.com/nyaruka/mailroom/v26/core/models"
+	"github.com/nyaruka/mailroom/v26/core/runner"
+	"github.com/nyaruka/mailroom/v26/runtime"
+)
+
+// InsertFieldChanges is our hook for recording contact field changes to the field history after the database
+// transaction has committed
+var InsertFieldChanges runner.PostCommitHook = &insertFieldChanges{}
+
+type insertFieldChanges struct{}
+
+func (h *insertFieldChanges) Order() int { return 10 }
+
+func (h *insertFieldChanges) Execute(ctx context.Context, rt *runtime.Runtime, oa *models.OrgAssets, scenes map[*runner.Scene][]any) error {
+	for scene, args := range scenes {
+		// values before this scene's changes are what was loaded from the database
+		values := make(map[string]*core.Value, len(args))
+		for key, v := range scene.DBContact.Fields() {
+			values[key] = v
+		}
+
+		for _, a := range args {
+			fc := a.(*FieldChanged)
+			field := oa.FieldByKey(fc.Event.Field.Key)
+			if field == nil {
+				continue
+			}
+
+			change := models.NewFieldChange(oa, scene.ContactUUID(), field, fc.Event, values[field.Key()], fc.UserID)
+			values[field.Key()] = fc.Event.Value
+
+			if _, err := rt.Dynamo.Main.Queue(change); err != nil {
+				return fmt.Errorf("error queuing field change to writer: %w", err)
+			}
+		}
+	}
+
+	return nil
+}
+
+type FieldChanged struct {
+	Event  *events.ContactFieldChanged
+	UserID models.UserID
+}
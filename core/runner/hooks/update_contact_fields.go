@@ -50,8 +50,22 @@ func (h *updateContactFields) Execute(ctx context.Context, rt *runtime.Runtime,
 			}
 		}
 
+		// values of sensitive fields are stored encrypted
+		stored := make(map[assets.FieldUUID]any, len(updates))
+		for k, v := range updates {
+			if oa.FieldByUUID(k).Sensitive() {
+				enc, err := oa.Org().EncryptFieldValue(k, v)
+				if err != nil {
+					return fmt.Errorf("error encrypting field value: %w", err)
+				}
+				stored[k] = enc
+			} else {
+				stored[k] = v
+			}
+		}
+
 		// marshal the rest of our updates to JSON
-		fieldJSON, err := json.Marshal(updates)
+		fieldJSON, err := json.Marshal(stored)
 		if err != nil {
 			return fmt.Errorf("error marshalling field values: %w", err)
 		}
@@ -0,0 +1,226 @@
+package runner
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"time"
+
+	"github.com/nyaruka/gocommon/i18n"
+	"github.com/nyaruka/gocommon/urns"
+	"github.com/nyaruka/goflow/core"
+	"github.com/nyaruka/goflow/core/events"
+	"github.com/nyaruka/goflow/flows"
+	"github.com/nyaruka/goflow/flows/modifiers"
+	"github.com/nyaruka/mailroom/v26/core/models"
+	"github.com/nyaruka/mailroom/v26/core/search"
+	"github.com/nyaruka/mailroom/v26/runtime"
+	"github.com/vinovest/sqlx"
+)
+
+// MergeFieldRule is how a field with values on both contacts being merged is resolved
+type MergeFieldRule string
+
+const (
+	MergeFieldKeepPrimary   MergeFieldRule = "primary"
+	MergeFieldKeepSecondary MergeFieldRule = "secondary"
+)
+
+// MergeRules are how conflicts are resolved when merging contacts
+type MergeRules struct {
+	Fields         MergeFieldRule            `json:"fields"          validate:"omitempty,eq=primary|eq=secondary"`
+	FieldOverrides map[string]MergeFieldRule `json:"field_overrides" validate:"omitempty,dive,eq=primary|eq=secondary"`
+}
+
+func (r *MergeRules) fieldRule(key string) MergeFieldRule {
+	if r == nil {
+		return MergeFieldKeepPrimary
+	}
+	if rule, ok := r.FieldOverrides[key]; ok {
+		return rule
+	}
+	if r.Fields != "" {
+		return r.Fields
+	}
+	return MergeFieldKeepPrimary
+}
+
+// MergeResult is what was moved from the secondary contact to the primary contact
+type MergeResult struct {
+	MovedURNs     []urns.URN
+	MovedTickets  int
+	CopiedHistory int
+}
+
+// MergeWithLock merges the secondary contact into the primary contact. Its URNs, field values, group memberships and
+// open tickets are moved to the primary by applying modifiers to both, so the usual events and hooks fire, and both are
+// committed in a single transaction which also releases the secondary. Its history is then copied to the primary.
+func MergeWithLock(ctx context.Context, rt *runtime.Runtime, oa *models.OrgAssets, userID models.UserID, primaryID, secondaryID models.ContactID, rules *MergeRules, via models.Via) (*MergeResult, error) {
+	scenes, skipped, unlock, err := LockAndLoad(ctx, rt, oa, []models.ContactID{primaryID, secondaryID}, nil, 10*time.Second)
+	if err != nil {
+		return nil, err
+	}
+
+	defer unlock() // contacts are unlocked whatever happens
+
+	if len(skipped) > 0 {
+		return nil, fmt.Errorf("unable to lock contacts %v", skipped)
+	}
+
+	var primary, secondary *Scene
+	for _, s := range scenes {
+		switch s.ContactID() {
+		case primaryID:
+			primary = s
+		case secondaryID:
+			secondary = s
+		}
+	}
+	if primary == nil || secondary == nil {
+		return nil, fmt.Errorf("unable to load contacts %d and %d", primaryID, secondaryID)
+	}
+
+	pc, sc := primary.DBContact, secondary.DBContact
+	sa := oa.SessionAssets()
+
+	moveURNs := make([]urns.URN, len(sc.URNs()))
+	for i, u := range sc.URNs() {
+		moveURNs[i] = u.Identity
+	}
+
+	moveGroups := make([]*core.Group, 0, len(sc.Groups()))
+	for _, g := range sc.Groups() {
+		if group := sa.Groups().Get(g.UUID()); group != nil && !group.UsesQuery() {
+			moveGroups = append(moveGroups, group)
+		}
+	}
+
+	// contacts should only have one open ticket, so if the primary has one, the secondary's are closed instead
+	var moveTickets []*models.Ticket
+	if len(pc.Tickets()) == 0 {
+		moveTickets = sc.Tickets()
+	}
+
+	// strip the secondary..
+	if err := secondary.InterruptWaiting(ctx, rt, oa, flows.SessionStatusInterrupted); err != nil {
+		return nil, fmt.Errorf("error interrupting secondary contact: %w", err)
+	}
+
+	secondaryMods := []flows.Modifier{modifiers.NewURNs(nil, modifiers.URNsSet)}
+	if len(moveGroups) > 0 {
+		secondaryMods = append(secondaryMods, modifiers.NewGroups(moveGroups, modifiers.GroupsRemove))
+	}
+	if len(pc.Tickets()) > 0 {
+		for _, t := range sc.Tickets() {
+			secondaryMods = append(secondaryMods, modifiers.NewTicketClose(t.UUID))
+		}
+	}
+
+	_, err = applyModifiers(ctx, rt, oa, userID, []*Scene{secondary}, map[models.ContactID][]flows.Modifier{secondaryID: secondaryMods}, via)
+	if err != nil {
+		return nil, err
+	}
+
+	// ..and add everything to the primary
+	var primaryMods []flows.Modifier
+	if len(moveURNs) > 0 {
+		primaryMods = append(primaryMods, modifiers.NewURNs(moveURNs, modifiers.URNsAppend))
+	}
+	if pc.Name() == "" && sc.Name() != "" {
+		primaryMods = append(primaryMods, modifiers.NewName(sc.Name()))
+	}
+	if pc.Language() == i18n.NilLanguage && sc.Language() != i18n.NilLanguage {
+		primaryMods = append(primaryMods, modifiers.NewLanguage(sc.Language()))
+	}
+
+	for _, key := range slices.Sorted(maps.Keys(sc.Fields())) { // for test determinism
+		value := sc.Fields()[key]
+		field := sa.Fields().Get(key)
+		if field == nil || value == nil || value.Text.Native() == "" {
+			continue
+		}
+
+		existing := pc.Fields()[key]
+		if existing != nil && existing.Text.Native() != "" && rules.fieldRule(key) == MergeFieldKeepPrimary {
+			continue
+		}
+
+		primaryMods = append(primaryMods, modifiers.NewField(field, value.Text.Native()))
+	}
+
+	if len(moveGroups) > 0 {
+		primaryMods = append(primaryMods, modifiers.NewGroups(moveGroups, modifiers.GroupsAdd))
+	}
+
+	_, err = applyModifiers(ctx, rt, oa, userID, []*Scene{primary}, map[models.ContactID][]flows.Modifier{primaryID: primaryMods}, via)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(moveTickets) > 0 {
+		primary.AttachPreCommitHook(moveTicketsHook, moveTickets)
+	}
+	secondary.AttachPreCommitHook(releaseContactsHook, userID)
+
+	// commit both contacts together, as the primary can only claim the secondary's URNs in the same transaction that
+	// detaches them, and we don't want to be left with a stripped secondary if the primary can't be committed
+	if err := bulkCommit(ctx, rt, oa, []*Scene{secondary, primary}, false); err != nil {
+		return nil, fmt.Errorf("error committing merged contacts: %w", err)
+	}
+
+	// copy the secondary's history now that the merge can't be rolled back, leaving out the events from it being
+	// stripped which may or may not have been written yet
+	mergeEvents := make(map[events.EventUUID]bool, len(secondary.persistEvents))
+	for _, e := range secondary.persistEvents {
+		mergeEvents[e.UUID()] = true
+	}
+
+	numHistory, err := models.CopyContactHistory(ctx, rt, oa.OrgID(), sc.UUID(), pc.UUID(), mergeEvents)
+	if err != nil {
+		return nil, fmt.Errorf("error copying contact history: %w", err)
+	}
+
+	if _, err := search.DeindexContactsByUUID(ctx, rt, oa.OrgID(), []core.ContactUUID{sc.UUID()}); err != nil {
+		return nil, fmt.Errorf("error de-indexing secondary contact: %w", err)
+	}
+	if err := search.DeindexMessagesByContact(ctx, rt, oa.OrgID(), []core.ContactUUID{sc.UUID()}); err != nil {
+		return nil, fmt.Errorf("error de-indexing secondary contact messages: %w", err)
+	}
+
+	return &MergeResult{MovedURNs: moveURNs, MovedTickets: len(moveTickets), CopiedHistory: numHistory}, nil
+}
+
+// moveTicketsHook moves the secondary's open tickets to the primary when committing a merge
+var moveTicketsHook PreCommitHook = &moveTickets{}
+
+type moveTickets struct{}
+
+func (h *moveTickets) Order() int { return 20 } // after any tickets are closed
+
+func (h *moveTickets) Execute(ctx context.Context, rt *runtime.Runtime, tx *sqlx.Tx, oa *models.OrgAssets, scenes map[*Scene][]any) error {
+	for scene, args := range scenes {
+		for _, tickets := range args {
+			if err := models.MoveTickets(ctx, tx, tickets.([]*models.Ticket), scene.ContactID()); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// releaseContactsHook releases the secondary contact when committing a merge
+var releaseContactsHook PreCommitHook = &releaseContacts{}
+
+type releaseContacts struct{}
+
+func (h *releaseContacts) Order() int { return 90 } // after its URNs and groups have been removed
+
+func (h *releaseContacts) Execute(ctx context.Context, rt *runtime.Runtime, tx *sqlx.Tx, oa *models.OrgAssets, scenes map[*Scene][]any) error {
+	for scene, args := range scenes {
+		if err := models.ReleaseContacts(ctx, tx, args[0].(models.UserID), []models.ContactID{scene.ContactID()}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
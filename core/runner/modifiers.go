@@ -84,3 +84,24 @@ func ReevaluateGroupsWithLock(ctx context.Context, rt *runtime.Runtime, oa *mode
 
 	return skipped, nil
 }
+
+// RecomputeFieldsWithLock re-evaluates computed fields for the given contacts
+func RecomputeFieldsWithLock(ctx context.Context, rt *runtime.Runtime, oa *models.OrgAssets, contactIDs []models.ContactID) ([]models.ContactID, error) {
+	scenes, skipped, unlock, err := LockAndLoad(ctx, rt, oa, contactIDs, nil, 30*time.Second)
+	if err != nil {
+		return nil, fmt.Errorf("error locking contacts: %w", err)
+	}
+	defer unlock()
+
+	for _, scene := range scenes {
+		if err := scene.RecomputeFields(ctx, rt, oa); err != nil {
+			return nil, fmt.Errorf("error recomputing fields: %w", err)
+		}
+	}
+
+	if err := BulkCommit(ctx, rt, oa, scenes); err != nil {
+		return nil, fmt.Errorf("error committing computed fields: %w", err)
+	}
+
+	return skipped, nil
+}
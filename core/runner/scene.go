@@ -51,6 +51,7 @@ type Scene struct {
 	persistEvents []*models.Event
 	publishEvents []events.Event
 	notifications []*models.Notification
+	fieldsStale   bool // whether computed fields need re-evaluated
 
 	// can be overridden by tests
 	Engine func(*runtime.Runtime) flows.Engine
@@ -102,6 +103,10 @@ func (s *Scene) AddEvent(ctx context.Context, rt *runtime.Runtime, oa *models.Or
 		return err
 	}
 
+	if changesComputedInputs(oa, e) {
+		s.fieldsStale = true
+	}
+
 	// turn our userID into a reference
 	var user *models.User
 	if userID != models.NilUserID {
@@ -120,6 +125,7 @@ func (s *Scene) AddEvent(ctx context.Context, rt *runtime.Runtime, oa *models.Or
 				Event:       e,
 				OrgID:       oa.OrgID(),
 				ContactUUID: s.ContactUUID(),
+				Redact:      models.IsSensitiveEvent(oa, e),
 			})
 		}
 		if models.PublishEvent(e) {
@@ -193,6 +199,52 @@ func (s *Scene) ReevaluateGroups(ctx context.Context, rt *runtime.Runtime, oa *m
 	return nil
 }
 
+// RecomputeFields re-evaluates computed fields for this scene's contact and applies any changed values.
+func (s *Scene) RecomputeFields(ctx context.Context, rt *runtime.Runtime, oa *models.OrgAssets) error {
+	s.fieldsStale = false
+
+	fields, _ := oa.Fields()
+	for _, f := range fields {
+		field := f.(*models.Field)
+		if !field.Computed() {
+			continue
+		}
+
+		value, err := models.ComputeFieldValue(ctx, rt, oa, field, s.Contact)
+		if err != nil {
+			slog.Warn("unable to compute field value", "error", err, "contact", s.ContactUUID())
+			continue
+		}
+
+		current := ""
+		if fv := s.Contact.Fields()[field.Key()]; fv != nil && fv.Value != nil {
+			current = fv.Value.Text.Native()
+		}
+		if value == current {
+			continue
+		}
+
+		mod := modifiers.NewField(oa.SessionAssets().Fields().Get(field.Key()), value)
+
+		if err := s.ApplyModifier(ctx, rt, oa, mod, models.NilUserID, ""); err != nil {
+			return fmt.Errorf("error applying computed field value: %w", err)
+		}
+	}
+	return nil
+}
+
+// whether the given event changes something that computed field values might depend on
+func changesComputedInputs(oa *models.OrgAssets, e events.Event) bool {
+	switch typed := e.(type) {
+	case *events.ContactFieldChanged:
+		field := oa.FieldByKey(typed.Field.Key)
+		return field != nil && !field.Computed()
+	case *events.ContactNameChanged, *events.ContactLanguageChanged, *events.ContactStatusChanged, *events.ContactURNsChanged, *events.ContactLastSeenChanged:
+		return true
+	}
+	return false
+}
+
 func (s *Scene) InterruptWaiting(ctx context.Context, rt *runtime.Runtime, oa *models.OrgAssets, status flows.SessionStatus) error {
 	return addInterruptEvents(ctx, rt, oa, []*Scene{s}, nil, status)
 }
@@ -206,6 +258,9 @@ func (s *Scene) StartSession(ctx context.Context, rt *runtime.Runtime, oa *model
 		}
 	}
 
+	// let the airtime service know which flow it's creating transfers for so that flow's limits can be enforced
+	ctx = models.WithAirtimeFlow(ctx, trigger.Flow().UUID)
+
 	session, sprint, err := s.Engine(rt).NewSession(ctx, oa.SessionAssets(), oa.Env(), s.Contact, trigger, s.Call)
 	if err != nil {
 		return fmt.Errorf("error starting contact %s in flow %s: %w", s.ContactUUID(), trigger.Flow().UUID, err)
@@ -253,6 +308,8 @@ func (s *Scene) ResumeSession(ctx context.Context, rt *runtime.Runtime, oa *mode
 		s.PriorRunModifiedOns[r.UUID()] = r.ModifiedOn()
 	}
 
+	ctx = models.WithAirtimeFlow(ctx, session.CurrentFlowUUID)
+
 	sprint, err := fs.Resume(ctx, resume)
 	if err != nil {
 		return fmt.Errorf("error resuming flow: %w", err)
@@ -395,10 +452,25 @@ func LockAndLoad(ctx context.Context, rt *runtime.Runtime, oa *models.OrgAssets,
 
 // BulkCommit commits the passed in scenes in a single transaction. If that fails, it retries committing each scene one at a time.
 func BulkCommit(ctx context.Context, rt *runtime.Runtime, oa *models.OrgAssets, scenes []*Scene) error {
+	return bulkCommit(ctx, rt, oa, scenes, true)
+}
+
+// commits the passed in scenes in a single transaction, optionally retrying each scene one at a time if that fails, which
+// callers whose scenes depend on each other's changes can't allow
+func bulkCommit(ctx context.Context, rt *runtime.Runtime, oa *models.OrgAssets, scenes []*Scene, retryIndividually bool) error {
 	if len(scenes) == 0 {
 		return nil // nothing to do
 	}
 
+	// computed fields are re-evaluated once all other changes to their inputs have been made
+	for _, scene := range scenes {
+		if scene.fieldsStale {
+			if err := scene.RecomputeFields(ctx, rt, oa); err != nil {
+				return fmt.Errorf("error recomputing fields for contact %s: %w", scene.ContactUUID(), err)
+			}
+		}
+	}
+
 	txCTX, cancel := context.WithTimeout(ctx, commitTimeout*time.Duration(len(scenes)))
 	defer cancel()
 
@@ -417,6 +489,11 @@ func BulkCommit(ctx context.Context, rt *runtime.Runtime, oa *models.OrgAssets,
 	committed := scenes
 
 	if err := tx.Commit(); err != nil {
+		if !retryIndividually {
+			tx.Rollback()
+			return fmt.Errorf("error committing scenes: %w", err)
+		}
+
 		// retry committing our scenes one at a time
 		slog.Debug("failed committing scenes in bulk, retrying one at a time", "error", err)
 
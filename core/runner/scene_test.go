@@ -16,6 +16,7 @@ import (
 	"github.com/nyaruka/goflow/core"
 	"github.com/nyaruka/goflow/core/events"
 	"github.com/nyaruka/goflow/flows"
+	"github.com/nyaruka/goflow/flows/modifiers"
 	"github.com/nyaruka/goflow/flows/resumes"
 	"github.com/nyaruka/goflow/flows/triggers"
 	"github.com/nyaruka/goflow/test"
@@ -667,8 +668,8 @@ func TestBroadcastWithLock(t *testing.T) {
 
 	defer test.MockUniverse()()
 
-	batch1 := bcast.CreateBatch([]models.ContactID{testdb.Ann.ID, testdb.Bob.ID}, nil)
-	batch2 := bcast.CreateBatch([]models.ContactID{testdb.Cat.ID}, nil)
+	batch1 := bcast.CreateBatch([]models.ContactID{testdb.Ann.ID, testdb.Bob.ID}, nil, nil)
+	batch2 := bcast.CreateBatch([]models.ContactID{testdb.Cat.ID}, nil, nil)
 
 	scenes, skipped, err := runner.BroadcastWithLock(ctx, rt, oa, bcast, batch1, models.StartModeBackground)
 	assert.NoError(t, err)
@@ -734,7 +735,7 @@ func TestBroadcastWithLock(t *testing.T) {
 	bcast2, err := models.GetBroadcastByID(ctx, rt.DB, b2.ID)
 	require.NoError(t, err)
 
-	skipBatch := bcast2.CreateBatch([]models.ContactID{testdb.Ann.ID, testdb.Bob.ID, testdb.Cat.ID}, nil)
+	skipBatch := bcast2.CreateBatch([]models.ContactID{testdb.Ann.ID, testdb.Bob.ID, testdb.Cat.ID}, nil, nil)
 	scenes, skipped, err = runner.BroadcastWithLock(ctx, rt, oa, bcast2, skipBatch, models.StartModeSkip)
 	assert.NoError(t, err)
 	assert.Len(t, skipped, 0) // all contacts were locked successfully
@@ -757,7 +758,7 @@ func TestBroadcastWithLock(t *testing.T) {
 	bcast3, err := models.GetBroadcastByID(ctx, rt.DB, b3.ID)
 	require.NoError(t, err)
 
-	intBatch := bcast3.CreateBatch([]models.ContactID{testdb.Ann.ID, testdb.Bob.ID, testdb.Cat.ID}, nil)
+	intBatch := bcast3.CreateBatch([]models.ContactID{testdb.Ann.ID, testdb.Bob.ID, testdb.Cat.ID}, nil, nil)
 	scenes, skipped, err = runner.BroadcastWithLock(ctx, rt, oa, bcast3, intBatch, models.StartModeInterrupt)
 	assert.NoError(t, err)
 	assert.Len(t, skipped, 0)
@@ -800,3 +801,30 @@ func assertFlowResultCounts(t *testing.T, rt *runtime.Runtime, flowID models.Flo
 
 	assert.Equal(t, expected, actual)
 }
+
+func TestRecomputeFields(t *testing.T) {
+	ctx, rt := testsuite.Runtime(t)
+
+	rt.DB.MustExec(`UPDATE orgs_org SET config = config || '{"computed_fields": {"gender": "@(upper(contact.name))"}}'::jsonb WHERE id = $1`, testdb.Org1.ID)
+
+	oa, err := models.GetOrgAssetsWithRefresh(ctx, rt, testdb.Org1.ID, models.RefreshFields)
+	require.NoError(t, err)
+
+	// changing the name of a contact recomputes the field on commit
+	scenes, err := runner.CreateScenes(ctx, rt, oa, []models.ContactID{testdb.Ann.ID}, nil)
+	require.NoError(t, err)
+
+	err = scenes[0].ApplyModifier(ctx, rt, oa, modifiers.NewName("Annie"), testdb.Admin.ID, models.ViaUI)
+	require.NoError(t, err)
+	err = scenes[0].Commit(ctx, rt, oa)
+	require.NoError(t, err)
+
+	assertdb.Query(t, rt.DB, `SELECT fields->$2->>'text' FROM contacts_contact WHERE id = $1`, testdb.Ann.ID, testdb.GenderField.UUID).Returns("ANNIE")
+
+	// and computed fields can be recomputed explicitly
+	skipped, err := runner.RecomputeFieldsWithLock(ctx, rt, oa, []models.ContactID{testdb.Bob.ID})
+	require.NoError(t, err)
+	assert.Len(t, skipped, 0)
+
+	assertdb.Query(t, rt.DB, `SELECT fields->$2->>'text' FROM contacts_contact WHERE id = $1`, testdb.Bob.ID, testdb.GenderField.UUID).Returns("BOB")
+}
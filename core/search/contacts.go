@@ -85,8 +85,9 @@ func NewContactDoc(oa *models.OrgAssets, c *core.Contact, currentFlowID models.F
 			continue
 		}
 
+		// values of sensitive fields aren't indexed
 		field := oa.FieldByKey(key)
-		if field == nil {
+		if field == nil || field.Sensitive() {
 			continue
 		}
 
@@ -113,6 +113,28 @@ func TestNewContactDoc(t *testing.T) {
 	assert.NotNil(t, ageField.Number)
 }
 
+func TestNewContactDocSensitiveFields(t *testing.T) {
+	ctx, rt := testsuite.Runtime(t)
+
+	rt.DB.MustExec(`UPDATE orgs_org SET config = config || '{"sensitive_fields": ["gender"]}'::jsonb WHERE id = $1`, testdb.Org1.ID)
+
+	oa, err := models.GetOrgAssetsWithRefresh(ctx, rt, testdb.Org1.ID, models.RefreshFields)
+	require.NoError(t, err)
+
+	mc, err := models.LoadContact(ctx, rt.DB, oa, testdb.Ann.ID)
+	require.NoError(t, err)
+	ann, err := mc.EngineContact(oa)
+	require.NoError(t, err)
+
+	doc := search.NewContactDoc(oa, ann, models.NilFlowID, nil)
+
+	// gender value isn't indexed but other fields are
+	for _, f := range doc.Fields {
+		assert.NotEqual(t, testdb.GenderField.UUID, f.Field)
+	}
+	assert.NotEmpty(t, doc.Fields)
+}
+
 func TestDeindexContacts(t *testing.T) {
 	ctx, rt := testsuite.Runtime(t)
 
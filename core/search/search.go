@@ -225,6 +225,43 @@ func GetContactUUIDsForQuery(ctx context.Context, rt *runtime.Runtime, oa *model
 	return getContactUUIDsForQuery(ctx, rt, oa, rt.Config.ElasticContactsIndex, eq, limit)
 }
 
+// GetContactUUIDsForQueryPages calls fn with each page of up to pageSize contact UUIDs that match the given query,
+// sorted by contact ID, so that callers needn't hold every match in memory at once
+func GetContactUUIDsForQueryPages(ctx context.Context, rt *runtime.Runtime, oa *models.OrgAssets, group *models.Group, status models.ContactStatus, query string, pageSize int, fn func([]core.ContactUUID) error) error {
+	var parsed *contactql.ContactQuery
+	var err error
+
+	if query != "" {
+		parsed, err = parse.Query(oa.Env(), query, oa.SessionAssets())
+		if err != nil {
+			return fmt.Errorf("error parsing query: %s: %w", query, err)
+		}
+	}
+
+	// a query that is a single condition on UUID is resolved from the database by GetContactUUIDsForQuery
+	if _, ok := queryAsUUID(parsed); ok {
+		uuids, err := GetContactUUIDsForQuery(ctx, rt, oa, group, status, query, 1)
+		if err != nil {
+			return err
+		}
+		if len(uuids) > 0 {
+			return fn(uuids)
+		}
+		return nil
+	}
+
+	if group != nil && !group.Visible() {
+		status = models.ContactStatus(group.Type())
+		group = nil
+	}
+
+	eq := buildContactQuery(oa, group, status, nil, parsed)
+
+	return iterateContactUUIDsForQuery(ctx, rt, oa, rt.Config.ElasticContactsIndex, eq, pageSize, func(page []core.ContactUUID) (bool, error) {
+		return true, fn(page)
+	})
+}
+
 func getContactUUIDsForQuery(ctx context.Context, rt *runtime.Runtime, oa *models.OrgAssets, index string, eq elastic.Query, limit int) ([]core.ContactUUID, error) {
 	sort := elastic.SortBy("id", true)
 	uuids := make([]core.ContactUUID, 0, 100)
@@ -247,10 +284,34 @@ func getContactUUIDsForQuery(ctx context.Context, rt *runtime.Runtime, oa *model
 		return appendUUIDsFromESHits(uuids, results.Hits.Hits), nil
 	}
 
-	// for larger limits we need to take a point in time and iterate through multiple search requests using search_after
+	// for larger limits we need to iterate through multiple search requests
+	pageSize := 10_000
+	if limit != -1 && limit < pageSize {
+		pageSize = limit
+	}
+
+	err := iterateContactUUIDsForQuery(ctx, rt, oa, index, eq, pageSize, func(page []core.ContactUUID) (bool, error) {
+		uuids = append(uuids, page...)
+
+		if limit != -1 && len(uuids) >= limit {
+			uuids = uuids[:limit]
+			return false, nil
+		}
+		return true, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return uuids, nil
+}
+
+// iterateContactUUIDsForQuery takes a point in time and iterates through the matches of the given query sorted by ID
+// using search_after, calling fn with each page of UUIDs until there are no more or fn returns false
+func iterateContactUUIDsForQuery(ctx context.Context, rt *runtime.Runtime, oa *models.OrgAssets, index string, eq elastic.Query, pageSize int, fn func([]core.ContactUUID) (bool, error)) error {
 	pit, err := rt.ES.Client.OpenPointInTime(index).Routing(oa.OrgID().String()).KeepAlive("1m").Do(ctx)
 	if err != nil {
-		return nil, fmt.Errorf("error creating ES point-in-time: %w", err)
+		return fmt.Errorf("error creating ES point-in-time: %w", err)
 	}
 	defer func() {
 		cctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
@@ -263,39 +324,30 @@ func getContactUUIDsForQuery(ctx context.Context, rt *runtime.Runtime, oa *model
 	src := map[string]any{
 		"_source":          false,
 		"query":            eq,
-		"sort":             []any{sort},
+		"sort":             []any{elastic.SortBy("id", true)},
 		"pit":              map[string]any{"id": pit.Id, "keep_alive": "1m"},
-		"size":             10_000,
+		"size":             pageSize,
 		"track_total_hits": false,
 	}
 
 	for {
 		results, err := rt.ES.Client.Search().Raw(bytes.NewReader(jsonx.MustMarshal(src))).Do(ctx)
 		if err != nil {
-			return nil, fmt.Errorf("error searching ES index: %w", err)
+			return fmt.Errorf("error searching ES index: %w", err)
 		}
 
 		if len(results.Hits.Hits) == 0 {
-			break
+			return nil
 		}
 
-		uuids = appendUUIDsFromESHits(uuids, results.Hits.Hits)
-
-		if limit != -1 && len(uuids) >= limit {
-			uuids = uuids[:limit]
-			break
-		}
-		if limit != -1 {
-			if remaining := limit - len(uuids); remaining < 10_000 {
-				src["size"] = remaining
-			}
+		more, err := fn(appendUUIDsFromESHits(make([]core.ContactUUID, 0, len(results.Hits.Hits)), results.Hits.Hits))
+		if err != nil || !more {
+			return err
 		}
 
 		lastHit := results.Hits.Hits[len(results.Hits.Hits)-1]
 		src["search_after"] = lastHit.Sort
 	}
-
-	return uuids, nil
 }
 
 // appendUUIDsFromESHits extracts contact UUIDs from Elasticsearch hits using the document _id
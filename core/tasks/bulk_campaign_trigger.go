@@ -38,6 +38,9 @@ type BulkCampaignTrigger struct {
 	PointID     models.PointID     `json:"point_id"`
 	FireVersion int                `json:"fire_version"`
 	ContactIDs  []models.ContactID `json:"contact_ids"`
+
+	// when sends to these contacts were reserved against the org's frequency caps, if they were
+	CappedOn time.Time `json:"capped_on,omitzero"`
 }
 
 func (t *BulkCampaignTrigger) Type() string {
@@ -71,6 +74,25 @@ func (t *BulkCampaignTrigger) Perform(ctx context.Context, rt *runtime.Runtime,
 		return fmt.Errorf("error triggering campaign point #%d: %w", p.ID, err)
 	}
 
+	// messages sent by message points count towards the org's frequency caps, and sends were reserved for these
+	// contacts when the fires were capped, so release those which weren't made
+	if p.Type == models.PointTypeMessage && !t.CappedOn.IsZero() {
+		wasStarted := make(map[models.ContactID]bool, len(started))
+		for _, id := range started {
+			wasStarted[id] = true
+		}
+		var notStarted []models.ContactID
+		for _, id := range t.ContactIDs {
+			if !wasStarted[id] {
+				notStarted = append(notStarted, id)
+			}
+		}
+
+		if err := models.ReleaseFrequencySends(ctx, rt, oa, notStarted, t.CappedOn); err != nil {
+			slog.Error("error releasing frequency sends", "point", p.ID, "error", err)
+		}
+	}
+
 	// store recent fires in redis for this event
 	recentSet := vkutil.NewCappedZSet(fmt.Sprintf(recentFiresKey, t.PointID), recentFiresCap, recentFiresExpire)
 
@@ -0,0 +1,81 @@
+package tasks
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/nyaruka/gocommon/dates"
+	"github.com/nyaruka/goflow/flows"
+	"github.com/nyaruka/goflow/flows/triggers"
+	"github.com/nyaruka/mailroom/v26/core/models"
+	"github.com/nyaruka/mailroom/v26/core/runner"
+	"github.com/nyaruka/mailroom/v26/runtime"
+)
+
+// TypeBulkDripStep is the type of the drip sequence step task
+const TypeBulkDripStep = "bulk_drip_step"
+
+func init() {
+	RegisterType(TypeBulkDripStep, func() Task { return &BulkDripStep{} })
+}
+
+// BulkDripStep is the task to start the flow of a drip sequence step for contacts and schedule the next step
+type BulkDripStep struct {
+	SequenceUUID models.DripSequenceUUID `json:"sequence_uuid"`
+	Step         int                     `json:"step"`
+	ContactIDs   []models.ContactID      `json:"contact_ids"`
+}
+
+func (t *BulkDripStep) Type() string {
+	return TypeBulkDripStep
+}
+
+func (t *BulkDripStep) Timeout() time.Duration {
+	return time.Minute * 15
+}
+
+func (t *BulkDripStep) WithAssets() models.Refresh {
+	return models.RefreshOrg
+}
+
+func (t *BulkDripStep) Perform(ctx context.Context, rt *runtime.Runtime, oa *models.OrgAssets, taskID TaskID) error {
+	seq := oa.Org().DripSequence(t.SequenceUUID)
+	if seq == nil || t.Step >= len(seq.Steps) {
+		slog.Info("skipping drip step for sequence or step that no longer exists", "sequence", t.SequenceUUID, "step", t.Step)
+		return nil
+	}
+
+	step := seq.Steps[t.Step]
+	sentOn := dates.Now()
+
+	f, err := oa.FlowByUUID(step.FlowUUID)
+	if err == models.ErrNotFound {
+		slog.Info("skipping drip step for flow that no longer exists", "sequence", t.SequenceUUID, "step", t.Step, "flow", step.FlowUUID)
+	} else if err != nil {
+		return fmt.Errorf("error loading drip step flow %s: %w", step.FlowUUID, err)
+	} else if flow := f.(*models.Flow); flow.FlowType() == models.FlowTypeVoice {
+		slog.Info("skipping drip step for voice flow", "sequence", t.SequenceUUID, "step", t.Step, "flow", step.FlowUUID)
+	} else {
+		triggerBuilder := func() flows.Trigger {
+			return triggers.NewBuilder(flow.Reference()).Manual().Build()
+		}
+
+		_, skipped, err := runner.StartWithLock(ctx, rt, oa, t.ContactIDs, triggerBuilder, step.StartMode, models.NilStartID)
+		if err != nil {
+			return fmt.Errorf("error starting flow for step %d of drip sequence %s: %w", t.Step, t.SequenceUUID, err)
+		}
+		if len(skipped) > 0 {
+			slog.Warn("failed to acquire locks for contacts", "contacts", skipped)
+		}
+	}
+
+	// the next step is relative to this one so it can be scheduled even if this step couldn't be started, but only for
+	// contacts which are still active, e.g. not those blocked or stopped since this step was due
+	if err := models.ScheduleDripStep(ctx, rt.DB, oa, seq, t.Step+1, t.ContactIDs, sentOn); err != nil {
+		return fmt.Errorf("error scheduling next step of drip sequence %s: %w", t.SequenceUUID, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,55 @@
+package tasks_test
+
+import (
+	"testing"
+
+	"github.com/nyaruka/gocommon/dbutil/assertdb"
+	"github.com/nyaruka/mailroom/v26/core/models"
+	_ "github.com/nyaruka/mailroom/v26/core/runner/handlers"
+	"github.com/nyaruka/mailroom/v26/core/tasks"
+	"github.com/nyaruka/mailroom/v26/testsuite"
+	"github.com/nyaruka/mailroom/v26/testsuite/testdb"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBulkDripStep(t *testing.T) {
+	ctx, rt := testsuite.Runtime(t)
+
+	rt.DB.MustExec(`UPDATE orgs_org SET config = config || '{"drip_sequences": {"6c3b2f4e-8a1d-4e5f-9b7c-2d4e6f8a0b1c": {"name": "Onboarding", "steps": [{"offset": 1, "unit": "D", "flow_uuid": "5890fe3a-f204-4661-b74d-025be4ee019c"}, {"offset": 2, "unit": "H", "flow_uuid": "9de3663f-c5c5-4c92-9f45-ecbc09abcc85"}]}}}'::jsonb WHERE id = $1`, testdb.Org1.ID)
+
+	oa := testdb.Org1.Load(t, rt)
+
+	// Cat has been blocked since the step was due
+	rt.DB.MustExec(`UPDATE contacts_contact SET status = 'B' WHERE id = $1`, testdb.Cat.ID)
+
+	// first step starts contacts in Pick A Number and schedules the second step for those still active
+	task := &tasks.BulkDripStep{SequenceUUID: "6c3b2f4e-8a1d-4e5f-9b7c-2d4e6f8a0b1c", Step: 0, ContactIDs: []models.ContactID{testdb.Ann.ID, testdb.Bob.ID, testdb.Cat.ID}}
+	err := task.Perform(ctx, rt, oa, testTaskID)
+	assert.NoError(t, err)
+
+	testsuite.AssertContactInFlow(t, rt, testdb.Ann, testdb.PickANumber)
+	testsuite.AssertContactInFlow(t, rt, testdb.Bob, testdb.PickANumber)
+
+	assertdb.Query(t, rt.DB, `SELECT count(*) FROM contacts_contactfire WHERE fire_type = 'Q' AND scope = '6c3b2f4e-8a1d-4e5f-9b7c-2d4e6f8a0b1c:1' AND fire_on > NOW() + INTERVAL '1 hour'`).Returns(2)
+	assertdb.Query(t, rt.DB, `SELECT count(*) FROM contacts_contactfire WHERE fire_type = 'Q' AND contact_id = $1`, testdb.Cat.ID).Returns(0)
+
+	// second step starts contacts in Favorites and there's nothing more to schedule
+	task = &tasks.BulkDripStep{SequenceUUID: "6c3b2f4e-8a1d-4e5f-9b7c-2d4e6f8a0b1c", Step: 1, ContactIDs: []models.ContactID{testdb.Ann.ID}}
+	err = task.Perform(ctx, rt, oa, testTaskID)
+	assert.NoError(t, err)
+
+	testsuite.AssertContactInFlow(t, rt, testdb.Ann, testdb.Favorites)
+
+	assertdb.Query(t, rt.DB, `SELECT count(*) FROM contacts_contactfire WHERE fire_type = 'Q'`).Returns(2)
+
+	// steps which no longer exist are ignored
+	task = &tasks.BulkDripStep{SequenceUUID: "6c3b2f4e-8a1d-4e5f-9b7c-2d4e6f8a0b1c", Step: 2, ContactIDs: []models.ContactID{testdb.Ann.ID}}
+	err = task.Perform(ctx, rt, oa, testTaskID)
+	assert.NoError(t, err)
+
+	task = &tasks.BulkDripStep{SequenceUUID: "d5a8c7e4-1f2b-4c3d-8e9f-0a1b2c3d4e5f", Step: 0, ContactIDs: []models.ContactID{testdb.Ann.ID}}
+	err = task.Perform(ctx, rt, oa, testTaskID)
+	assert.NoError(t, err)
+
+	testsuite.AssertContactInFlow(t, rt, testdb.Ann, testdb.Favorites)
+}
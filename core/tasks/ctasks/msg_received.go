@@ -39,6 +39,7 @@ type MsgReceived struct {
 	Payload       json.RawMessage  `json:"payload,omitempty"`
 	NewContact    bool             `json:"new_contact"`
 	NewURN        *NewURNSpec      `json:"new_urn,omitempty"`
+	TicketUUID    core.TicketUUID  `json:"ticket_uuid,omitempty"`
 }
 
 func (t *MsgReceived) Type() string {
@@ -82,9 +83,12 @@ func (t *MsgReceived) perform(ctx context.Context, rt *runtime.Runtime, oa *mode
 		}
 	}
 
-	// associate this message with the last open ticket for this contact if there is one
+	// associate this message with the ticket it was threaded to if that's still open, otherwise the last open ticket
+	// for this contact if there is one
 	var ticketUUID core.TicketUUID
-	if tks := mc.Tickets(); len(tks) > 0 {
+	if t.TicketUUID != "" && mc.FindTicket(t.TicketUUID) != nil {
+		ticketUUID = t.TicketUUID
+	} else if tks := mc.Tickets(); len(tks) > 0 {
 		ticketUUID = tks[len(tks)-1].UUID
 	}
 
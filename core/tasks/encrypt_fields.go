@@ -0,0 +1,84 @@
+package tasks
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/nyaruka/goflow/core"
+	"github.com/nyaruka/mailroom/v26/core/models"
+	"github.com/nyaruka/mailroom/v26/core/search"
+	"github.com/nyaruka/mailroom/v26/runtime"
+)
+
+// TypeEncryptFields is the type of the encrypt fields task
+const TypeEncryptFields = "encrypt_fields"
+
+// how many contacts we encrypt and reindex at a time
+const encryptFieldsBatchSize = 500
+
+func init() {
+	RegisterType(TypeEncryptFields, func() Task { return &EncryptFields{} })
+}
+
+// EncryptFields is our task to encrypt existing values of fields which have been marked as sensitive, and reindex the
+// contacts so that those values are removed from the search index
+type EncryptFields struct{}
+
+func (t *EncryptFields) Type() string {
+	return TypeEncryptFields
+}
+
+// Timeout is the maximum amount of time the task can run for
+func (t *EncryptFields) Timeout() time.Duration {
+	return time.Hour
+}
+
+func (t *EncryptFields) WithAssets() models.Refresh {
+	return models.RefreshFields | models.RefreshGroups
+}
+
+// Perform encrypts plaintext values of sensitive fields a page of contacts at a time. It can be re-queued safely as
+// contacts whose values are already encrypted are skipped.
+func (t *EncryptFields) Perform(ctx context.Context, rt *runtime.Runtime, oa *models.OrgAssets, taskID TaskID) error {
+	afterID := models.NilContactID
+
+	for {
+		contactIDs, err := models.EncryptContactFieldsPage(ctx, rt.DB, oa, afterID, encryptFieldsBatchSize)
+		if err != nil {
+			return err
+		}
+		if len(contactIDs) == 0 {
+			return nil
+		}
+
+		if err := t.reindex(ctx, rt, oa, contactIDs); err != nil {
+			return err
+		}
+
+		afterID = contactIDs[len(contactIDs)-1]
+	}
+}
+
+func (t *EncryptFields) reindex(ctx context.Context, rt *runtime.Runtime, oa *models.OrgAssets, contactIDs []models.ContactID) error {
+	mcs, err := models.LoadContacts(ctx, rt.DB, oa, contactIDs)
+	if err != nil {
+		return fmt.Errorf("error loading contacts: %w", err)
+	}
+
+	contacts := make([]*core.Contact, 0, len(mcs))
+	currentFlows := make(map[models.ContactID]models.FlowID, len(mcs))
+	for _, mc := range mcs {
+		contact, err := mc.EngineContact(oa)
+		if err != nil {
+			return fmt.Errorf("error creating engine contact: %w", err)
+		}
+		contacts = append(contacts, contact)
+		currentFlows[mc.ID()] = mc.CurrentFlowID()
+	}
+
+	if err := search.IndexContacts(ctx, rt, oa, contacts, currentFlows); err != nil {
+		return fmt.Errorf("error indexing contacts: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,41 @@
+package tasks_test
+
+import (
+	"testing"
+
+	"github.com/nyaruka/gocommon/dbutil/assertdb"
+	"github.com/nyaruka/mailroom/v26/core/models"
+	"github.com/nyaruka/mailroom/v26/core/tasks"
+	"github.com/nyaruka/mailroom/v26/testsuite"
+	"github.com/nyaruka/mailroom/v26/testsuite/testdb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEncryptFields(t *testing.T) {
+	ctx, rt := testsuite.Runtime(t)
+
+	rt.DB.MustExec(`UPDATE contacts_contact SET fields = fields || jsonb_build_object($2::text, '{"text": "F"}'::jsonb) WHERE id = $1`, testdb.Ann.ID, testdb.GenderField.UUID)
+	rt.DB.MustExec(`UPDATE contacts_contact SET fields = fields || jsonb_build_object($2::text, '{"text": "M"}'::jsonb) WHERE id = $1`, testdb.Bob.ID, testdb.GenderField.UUID)
+	rt.DB.MustExec(`UPDATE orgs_org SET config = config || '{"sensitive_fields": ["gender"]}'::jsonb WHERE id = $1`, testdb.Org1.ID)
+
+	testsuite.QueueBatchTask(t, rt, testdb.Org1, &tasks.EncryptFields{})
+	testsuite.FlushTasks(t, rt)
+
+	// values are now stored encrypted
+	assertdb.Query(t, rt.DB, `SELECT count(*) FROM contacts_contact WHERE fields->$1 ? 'text'`, testdb.GenderField.UUID).Returns(0)
+	assertdb.Query(t, rt.DB, `SELECT count(*) FROM contacts_contact WHERE fields->$1 ? 'enc'`, testdb.GenderField.UUID).Returns(2)
+
+	// but still decrypt when contacts are loaded
+	oa, err := models.GetOrgAssetsWithRefresh(ctx, rt, testdb.Org1.ID, models.RefreshFields)
+	require.NoError(t, err)
+
+	contact, err := models.LoadContact(ctx, rt.DB, oa, testdb.Ann.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "F", contact.Fields()["gender"].Text.Native())
+
+	// and a second run has nothing to do
+	contactIDs, err := models.EncryptContactFieldsPage(ctx, rt.DB, oa, models.NilContactID, 100)
+	assert.NoError(t, err)
+	assert.Len(t, contactIDs, 0)
+}
@@ -0,0 +1,123 @@
+package tasks
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/nyaruka/gocommon/urns"
+	"github.com/nyaruka/goflow/core"
+	"github.com/nyaruka/mailroom/v26/core/models"
+	"github.com/nyaruka/mailroom/v26/core/search"
+	"github.com/nyaruka/mailroom/v26/runtime"
+)
+
+// TypeEraseContact is the type of the erase contact task
+const TypeEraseContact = "erase_contact"
+
+func init() {
+	RegisterType(TypeEraseContact, func() Task { return &EraseContact{} })
+}
+
+// EraseContact is our task to erase everything we still hold about a released contact, i.e. its history, field
+// changes, stored attachments, data exports, search docs and any HTTP logs which mention it. A receipt of the erasure
+// is recorded.
+type EraseContact struct {
+	ContactUUID core.ContactUUID `json:"contact_uuid" validate:"required"`
+	UserID      models.UserID    `json:"user_id"`
+}
+
+func (t *EraseContact) Type() string {
+	return TypeEraseContact
+}
+
+// Timeout is the maximum amount of time the task can run for
+func (t *EraseContact) Timeout() time.Duration {
+	return 15 * time.Minute
+}
+
+func (t *EraseContact) WithAssets() models.Refresh {
+	return models.RefreshNone
+}
+
+func (t *EraseContact) Perform(ctx context.Context, rt *runtime.Runtime, oa *models.OrgAssets, taskID TaskID) error {
+	released, err := models.IsContactReleased(ctx, rt.DB, oa.OrgID(), t.ContactUUID)
+	if err != nil {
+		return err
+	}
+	if !released {
+		return fmt.Errorf("contact %s doesn't exist or hasn't been released", t.ContactUUID)
+	}
+
+	receipt := models.NewContactErasure(oa.OrgID(), t.ContactUUID, t.UserID)
+
+	history, err := models.LoadContactHistory(ctx, rt, oa.OrgID(), t.ContactUUID)
+	if err != nil {
+		return fmt.Errorf("error loading contact history: %w", err)
+	}
+
+	if receipt.Attachments, err = models.DeleteContactAttachments(ctx, rt, history); err != nil {
+		return fmt.Errorf("error deleting contact attachments: %w", err)
+	}
+	if receipt.DataExports, err = models.DeleteContactData(ctx, rt, oa.OrgID(), t.ContactUUID); err != nil {
+		return fmt.Errorf("error deleting contact data exports: %w", err)
+	}
+	if receipt.HistoryItems, err = models.DeleteContactHistory(ctx, rt, oa.OrgID(), t.ContactUUID); err != nil {
+		return fmt.Errorf("error deleting contact history: %w", err)
+	}
+	if receipt.FieldChanges, err = models.DeleteFieldChanges(ctx, rt, oa.OrgID(), t.ContactUUID); err != nil {
+		return fmt.Errorf("error deleting contact field changes: %w", err)
+	}
+
+	if _, err := search.DeindexContactsByUUID(ctx, rt, oa.OrgID(), []core.ContactUUID{t.ContactUUID}); err != nil {
+		return fmt.Errorf("error de-indexing contact: %w", err)
+	}
+	if err := search.DeindexMessagesByContact(ctx, rt, oa.OrgID(), []core.ContactUUID{t.ContactUUID}); err != nil {
+		return fmt.Errorf("error de-indexing contact messages: %w", err)
+	}
+
+	// logs mentioning the contact can't be older than the contact itself
+	createdOn, err := models.GetContactCreatedOn(ctx, rt.DB, oa.OrgID(), t.ContactUUID)
+	if err != nil {
+		return err
+	}
+
+	if receipt.HTTPLogs, err = models.DeleteHTTPLogsMentioning(ctx, rt.DB, oa.OrgID(), createdOn, contactMentions(t.ContactUUID, history)); err != nil {
+		return fmt.Errorf("error deleting HTTP logs: %w", err)
+	}
+
+	if _, err := rt.Dynamo.Main.Queue(receipt); err != nil {
+		return fmt.Errorf("error queuing erasure receipt: %w", err)
+	}
+
+	return nil
+}
+
+// gets the values which HTTP logs might use to mention a contact, i.e. its UUID and the paths of URNs it used to send
+// or receive messages, with phone numbers also without their + prefix - released contacts no longer have URNs so these
+// can only be found from its history
+func contactMentions(contactUUID core.ContactUUID, history []map[string]any) []string {
+	mentions := []string{string(contactUUID)}
+	seen := map[string]bool{}
+
+	add := func(m string) {
+		if m != "" && !seen[m] {
+			mentions = append(mentions, m)
+			seen[m] = true
+		}
+	}
+
+	for _, evt := range history {
+		msg, _ := evt["msg"].(map[string]any)
+		s, _ := msg["urn"].(string)
+		urn := urns.URN(s)
+
+		add(urn.Path())
+
+		if urn.Scheme() == urns.Phone.Prefix {
+			add(strings.TrimPrefix(urn.Path(), "+"))
+		}
+	}
+	return mentions
+}
@@ -0,0 +1,115 @@
+package tasks_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/nyaruka/gocommon/aws/dynamo"
+	"github.com/nyaruka/gocommon/aws/dynamo/dyntest"
+	"github.com/nyaruka/gocommon/dbutil/assertdb"
+	"github.com/nyaruka/mailroom/v26/core/models"
+	"github.com/nyaruka/mailroom/v26/core/tasks"
+	"github.com/nyaruka/mailroom/v26/testsuite"
+	"github.com/nyaruka/mailroom/v26/testsuite/testdb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type rawHistoryItem dynamo.Item
+
+func (i *rawHistoryItem) MarshalDynamo() (*dynamo.Item, error) { return (*dynamo.Item)(i), nil }
+
+func TestEraseContact(t *testing.T) {
+	ctx, rt := testsuite.Runtime(t)
+
+	oa := testdb.Org1.Load(t, rt)
+
+	rt.DB.MustExec(`UPDATE contacts_contact SET is_active = FALSE WHERE id = $1`, testdb.Bob.ID)
+
+	attachmentURL, err := rt.S3.PutObject(ctx, rt.Config.S3AttachmentsBucket, "attachments/1/bob.jpg", "image/jpeg", []byte("JPEG"), types.ObjectCannedACLPublicRead)
+	require.NoError(t, err)
+
+	for _, key := range []string{"contact_data/1/" + string(testdb.Bob.UUID) + "/1.json", "contact_data/1/" + string(testdb.Bob.UUID) + "/2.zip", "contact_data/1/" + string(testdb.Ann.UUID) + "/3.json"} {
+		_, err = rt.S3.PutObject(ctx, rt.Config.S3ExportsBucket, key, "application/json", []byte("{}"), types.ObjectCannedACLPrivate)
+		require.NoError(t, err)
+	}
+
+	for _, item := range []*rawHistoryItem{
+		{
+			Key:   dynamo.Key{PK: "con#" + string(testdb.Bob.UUID), SK: "evt#0198ab67-9c2e-7b7a-a0b3-7e3e8d7a1a01"},
+			OrgID: int(testdb.Org1.ID),
+			Data:  map[string]any{"type": "msg_received", "msg": map[string]any{"urn": "tel:+16055742222", "text": "Hi", "attachments": []any{"image/jpeg:" + attachmentURL}}},
+		},
+		{
+			Key:   dynamo.Key{PK: "con#" + string(testdb.Bob.UUID), SK: "evt#0198ab67-9c2e-7b7a-a0b3-7e3e8d7a1a01#del"},
+			OrgID: int(testdb.Org1.ID),
+			Data:  map[string]any{"by_contact": true},
+		},
+		{
+			Key:   dynamo.Key{PK: "con#" + string(testdb.Ann.UUID), SK: "evt#0198ab67-9c2e-7b7a-a0b3-7e3e8d7a1a02"},
+			OrgID: int(testdb.Org1.ID),
+			Data:  map[string]any{"type": "contact_name_changed", "name": "Ann"},
+		},
+	} {
+		_, err := rt.Dynamo.History.Queue(item)
+		require.NoError(t, err)
+	}
+	rt.Dynamo.History.Flush()
+
+	_, err = rt.Dynamo.Main.Queue(&rawHistoryItem{
+		Key:   dynamo.Key{PK: "con#" + string(testdb.Bob.UUID), SK: "fld#3a5891e4-756e-4dc9-8e12-b7a766168824#0198ab67-9c2e-7b7a-a0b3-7e3e8d7a1a03"},
+		OrgID: int(testdb.Org1.ID),
+		Data:  map[string]any{"field": map[string]any{"key": "gender", "name": "Gender"}, "new": map[string]any{"text": "M"}},
+	})
+	require.NoError(t, err)
+	rt.Dynamo.Main.Flush()
+
+	now := time.Now()
+	err = models.InsertHTTPLogs(ctx, rt.DB, []*models.HTTPLog{
+		models.NewWebhookCalledLog(testdb.Org1.ID, testdb.Favorites.ID, "http://example.com/?contact="+string(testdb.Bob.UUID), 200, "GET /", "OK", false, time.Second, 0, now),
+		models.NewWebhookCalledLog(testdb.Org1.ID, testdb.Favorites.ID, "http://example.com/", 200, `POST / {"phone": "+16055742222"}`, "OK", false, time.Second, 0, now),
+		models.NewWebhookCalledLog(testdb.Org1.ID, testdb.Favorites.ID, "http://example.com/", 200, `POST / {"phone": "16055742222"}`, "OK", false, time.Second, 0, now),
+		models.NewWebhookCalledLog(testdb.Org1.ID, testdb.Favorites.ID, "http://example.com/", 200, `POST / {"phone": "+16055741111"}`, "OK", false, time.Second, 0, now),
+		models.NewWebhookCalledLog(testdb.Org1.ID, testdb.Favorites.ID, "http://example.com/", 200, `POST / {"phone": "+160557422221"}`, "OK", false, time.Second, 0, now),
+		models.NewWebhookCalledLog(testdb.Org2.ID, models.NilFlowID, "http://example.com/", 200, `POST / {"phone": "+16055742222"}`, "OK", false, time.Second, 0, now),
+	})
+	require.NoError(t, err)
+
+	// can't erase a contact which is still active
+	err = (&tasks.EraseContact{ContactUUID: testdb.Ann.UUID, UserID: testdb.Admin.ID}).Perform(ctx, rt, oa, testTaskID)
+	assert.EqualError(t, err, "contact a393abc0-283d-4c9b-a1b3-641a035c34bf doesn't exist or hasn't been released")
+
+	err = (&tasks.EraseContact{ContactUUID: testdb.Bob.UUID, UserID: testdb.Admin.ID}).Perform(ctx, rt, oa, testTaskID)
+	require.NoError(t, err)
+
+	// only Ann's history remains
+	items := testsuite.GetHistoryItems(t, rt, false, time.Time{})
+	require.Len(t, items, 1)
+	assert.Equal(t, "con#"+string(testdb.Ann.UUID), items[0].PK)
+
+	_, _, err = rt.S3.GetObject(ctx, rt.Config.S3AttachmentsBucket, "attachments/1/bob.jpg")
+	assert.Error(t, err)
+
+	// only Ann's data export remains
+	_, _, err = rt.S3.GetObject(ctx, rt.Config.S3ExportsBucket, "contact_data/1/"+string(testdb.Bob.UUID)+"/1.json")
+	assert.Error(t, err)
+	_, _, err = rt.S3.GetObject(ctx, rt.Config.S3ExportsBucket, "contact_data/1/"+string(testdb.Ann.UUID)+"/3.json")
+	assert.NoError(t, err)
+
+	// logs which only contain Bob's number as part of a longer number are kept
+	assertdb.Query(t, rt.DB, `SELECT count(*) FROM request_logs_httplog WHERE org_id = $1`, testdb.Org1.ID).Returns(2)
+	assertdb.Query(t, rt.DB, `SELECT count(*) FROM request_logs_httplog WHERE org_id = $1`, testdb.Org2.ID).Returns(1)
+
+	// field changes are gone too and we have a receipt
+	rt.Dynamo.Main.Flush()
+	receipts := dyntest.ScanAll(t, rt.Dynamo.Main.Client(), rt.Dynamo.Main.Table())
+	require.Len(t, receipts, 1)
+	assert.Equal(t, dynamo.Key{PK: "org#1", SK: "era#b699a406-7e44-49be-9f01-1a82893e8a10"}, receipts[0].Key)
+	assert.Equal(t, float64(3), receipts[0].Data["user_id"])
+	assert.Equal(t, float64(2), receipts[0].Data["history_items"])
+	assert.Equal(t, float64(1), receipts[0].Data["field_changes"])
+	assert.Equal(t, float64(1), receipts[0].Data["attachments"])
+	assert.Equal(t, float64(2), receipts[0].Data["data_exports"])
+	assert.Equal(t, float64(3), receipts[0].Data["http_logs"])
+}
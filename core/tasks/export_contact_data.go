@@ -0,0 +1,88 @@
+package tasks
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/nyaruka/gocommon/jsonx"
+	"github.com/nyaruka/mailroom/v26/core/models"
+	"github.com/nyaruka/mailroom/v26/runtime"
+)
+
+// TypeExportContactData is the type of the contact data export task
+const TypeExportContactData = "export_contact_data"
+
+func init() {
+	RegisterType(TypeExportContactData, func() Task { return &ExportContactData{} })
+}
+
+// ExportContactData is our task to export everything we hold about a single contact, e.g. for a subject access request
+type ExportContactData struct {
+	ExportID models.ExportID `json:"export_id"`
+}
+
+func (t *ExportContactData) Type() string {
+	return TypeExportContactData
+}
+
+// Timeout is the maximum amount of time the task can run for
+func (t *ExportContactData) Timeout() time.Duration {
+	return time.Minute * 30
+}
+
+func (t *ExportContactData) WithAssets() models.Refresh {
+	return models.RefreshFields | models.RefreshGroups
+}
+
+// Perform writes the contact's data to a file in S3 and notifies the user who created the export
+func (t *ExportContactData) Perform(ctx context.Context, rt *runtime.Runtime, oa *models.OrgAssets, taskID TaskID) error {
+	export, err := models.LoadExport(ctx, rt.DB, t.ExportID)
+	if err != nil {
+		return err
+	}
+	if export.OrgID != oa.OrgID() || export.Type != models.ExportTypeContactData {
+		return fmt.Errorf("export %d is not a contact data export for org %d", export.ID, oa.OrgID())
+	}
+	if export.Status == models.ExportStatusComplete || export.Status == models.ExportStatusFailed {
+		return nil // nothing to do
+	}
+
+	if err := export.SetProcessing(ctx, rt.DB); err != nil {
+		return err
+	}
+
+	path, err := t.export(ctx, rt, oa, export)
+	if err != nil {
+		if err := export.SetFailed(ctx, rt.DB); err != nil {
+			slog.Error("error marking export as failed", "export_id", export.ID, "error", err)
+		}
+		return fmt.Errorf("error exporting contact data: %w", err)
+	}
+
+	if err := export.SetComplete(ctx, rt.DB, path, 1); err != nil {
+		return err
+	}
+
+	return models.NotifyExportFinished(ctx, rt, oa, export)
+}
+
+func (t *ExportContactData) export(ctx context.Context, rt *runtime.Runtime, oa *models.OrgAssets, export *models.Export) (string, error) {
+	cfg := &models.ContactDataExportConfig{}
+	if err := jsonx.Unmarshal(export.Config, cfg); err != nil {
+		return "", fmt.Errorf("error unmarshaling export config: %w", err)
+	}
+
+	contact, err := models.LoadContact(ctx, rt.ReadonlyDB, oa, cfg.ContactID)
+	if err != nil {
+		return "", fmt.Errorf("error loading contact: %w", err)
+	}
+
+	data, err := models.LoadContactData(ctx, rt, oa, contact)
+	if err != nil {
+		return "", err
+	}
+
+	return models.WriteContactData(ctx, rt, oa.OrgID(), contact, data, cfg.WithAttachments)
+}
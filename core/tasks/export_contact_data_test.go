@@ -0,0 +1,46 @@
+package tasks_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/nyaruka/gocommon/dbutil/assertdb"
+	"github.com/nyaruka/mailroom/v26/core/models"
+	"github.com/nyaruka/mailroom/v26/core/tasks"
+	"github.com/nyaruka/mailroom/v26/testsuite"
+	"github.com/nyaruka/mailroom/v26/testsuite/testdb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExportContactData(t *testing.T) {
+	ctx, rt := testsuite.Runtime(t)
+
+	oa := testdb.Org1.Load(t, rt)
+
+	exportID := testdb.InsertExport(t, rt, testdb.Org1, models.ExportTypeContactData, models.ExportStatusPending, map[string]any{"contact_id": testdb.Ann.ID}, testdb.Admin)
+
+	err := (&tasks.ExportContactData{ExportID: exportID}).Perform(ctx, rt, oa, testTaskID)
+	require.NoError(t, err)
+
+	export, err := models.LoadExport(ctx, rt.DB, exportID)
+	require.NoError(t, err)
+	assert.Equal(t, models.ExportStatusComplete, export.Status)
+	assert.True(t, strings.HasPrefix(string(export.Path), "contact_data/1/a393abc0-283d-4c9b-a1b3-641a035c34bf/"))
+	assert.True(t, strings.HasSuffix(string(export.Path), ".json"))
+
+	contentType, body, err := rt.S3.GetObject(ctx, rt.Config.S3ExportsBucket, string(export.Path))
+	require.NoError(t, err)
+	assert.Equal(t, "application/json", contentType)
+	assert.Contains(t, string(body), `"contact": {`)
+
+	assertdb.Query(t, rt.DB, `SELECT count(*) FROM notifications_notification WHERE export_id = $1 AND user_id = $2`, exportID, testdb.Admin.ID).Returns(1)
+
+	// export of a contact which doesn't exist fails
+	exportID = testdb.InsertExport(t, rt, testdb.Org1, models.ExportTypeContactData, models.ExportStatusPending, map[string]any{"contact_id": 123456}, testdb.Admin)
+
+	err = (&tasks.ExportContactData{ExportID: exportID}).Perform(ctx, rt, oa, testTaskID)
+	assert.ErrorContains(t, err, "error loading contact")
+
+	assertdb.Query(t, rt.DB, `SELECT status FROM orgs_export WHERE id = $1`, exportID).Returns("F")
+}
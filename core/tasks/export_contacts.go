@@ -0,0 +1,261 @@
+package tasks
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/nyaruka/goflow/core"
+	"github.com/nyaruka/mailroom/v26/core/models"
+	"github.com/nyaruka/mailroom/v26/core/search"
+	"github.com/nyaruka/mailroom/v26/runtime"
+	"github.com/nyaruka/mailroom/v26/utils/sheets"
+)
+
+// TypeExportContacts is the type of the contact export task
+const TypeExportContacts = "export_contacts"
+
+const exportContactsBatchSize = 1000
+
+var exportContactStatuses = map[models.ContactStatus]string{
+	models.ContactStatusActive:   "Active",
+	models.ContactStatusBlocked:  "Blocked",
+	models.ContactStatusStopped:  "Stopped",
+	models.ContactStatusArchived: "Archived",
+}
+
+func init() {
+	RegisterType(TypeExportContacts, func() Task { return &ExportContacts{} })
+}
+
+// ExportContacts is our task to export the contacts matching a search to a CSV or XLSX file
+type ExportContacts struct {
+	ExportID models.ExportID `json:"export_id"`
+}
+
+func (t *ExportContacts) Type() string {
+	return TypeExportContacts
+}
+
+// Timeout is the maximum amount of time the task can run for
+func (t *ExportContacts) Timeout() time.Duration {
+	return time.Hour
+}
+
+func (t *ExportContacts) WithAssets() models.Refresh {
+	return models.RefreshFields | models.RefreshGroups
+}
+
+// Perform writes the export file a batch of contacts at a time to a temporary file, uploads that to S3 and notifies
+// the user who created the export
+func (t *ExportContacts) Perform(ctx context.Context, rt *runtime.Runtime, oa *models.OrgAssets, taskID TaskID) error {
+	export, err := models.LoadExport(ctx, rt.DB, t.ExportID)
+	if err != nil {
+		return err
+	}
+	if export.OrgID != oa.OrgID() || export.Type != models.ExportTypeContact {
+		return fmt.Errorf("export %d is not a contact export for org %d", export.ID, oa.OrgID())
+	}
+	if export.Status == models.ExportStatusComplete || export.Status == models.ExportStatusFailed {
+		return nil // nothing to do
+	}
+
+	if err := export.SetProcessing(ctx, rt.DB); err != nil {
+		return err
+	}
+
+	path, numRecords, err := t.export(ctx, rt, oa, export)
+	if err != nil {
+		if err := export.SetFailed(ctx, rt.DB); err != nil {
+			slog.Error("error marking export as failed", "export_id", export.ID, "error", err)
+		}
+		return fmt.Errorf("error exporting contacts: %w", err)
+	}
+
+	if err := export.SetComplete(ctx, rt.DB, path, numRecords); err != nil {
+		return err
+	}
+
+	return models.NotifyExportFinished(ctx, rt, oa, export)
+}
+
+func (t *ExportContacts) export(ctx context.Context, rt *runtime.Runtime, oa *models.OrgAssets, export *models.Export) (string, int, error) {
+	cfg := &models.ContactExportConfig{}
+	if err := json.Unmarshal(export.Config, cfg); err != nil {
+		return "", 0, fmt.Errorf("error unmarshaling export config: %w", err)
+	}
+
+	format := sheets.Format(cfg.Format)
+	if format == "" {
+		format = sheets.FormatXLSX
+	}
+
+	group := oa.GroupByID(cfg.GroupID)
+	if group == nil {
+		return "", 0, fmt.Errorf("no such group with id %d", cfg.GroupID)
+	}
+
+	cols := newExportColumns(oa, cfg)
+
+	file, err := os.CreateTemp("", fmt.Sprintf("export-*.%s", format))
+	if err != nil {
+		return "", 0, fmt.Errorf("error creating temporary file: %w", err)
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	writer, err := sheets.NewWriter(format, file, "Contacts", cols.header())
+	if err != nil {
+		return "", 0, err
+	}
+
+	numRecords := 0
+
+	err = search.GetContactUUIDsForQueryPages(ctx, rt, oa, group, models.NilContactStatus, cfg.Search, exportContactsBatchSize, func(batch []core.ContactUUID) error {
+		contacts, err := models.LoadContactsByUUID(ctx, rt.ReadonlyDB, oa, batch)
+		if err != nil {
+			return fmt.Errorf("error loading contacts: %w", err)
+		}
+
+		// write rows in search order, skipping any contacts released since the search
+		byUUID := make(map[core.ContactUUID]*models.Contact, len(contacts))
+		for _, c := range contacts {
+			byUUID[c.UUID()] = c
+		}
+
+		for _, uuid := range batch {
+			if c := byUUID[uuid]; c != nil {
+				if err := writer.WriteRow(cols.row(c)); err != nil {
+					return fmt.Errorf("error writing export row: %w", err)
+				}
+				numRecords++
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return "", 0, fmt.Errorf("error searching contacts: %w", err)
+	}
+
+	if err := writer.Close(); err != nil {
+		return "", 0, fmt.Errorf("error writing export file: %w", err)
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		return "", 0, fmt.Errorf("error reading export file: %w", err)
+	}
+	if _, err := file.Seek(0, 0); err != nil {
+		return "", 0, fmt.Errorf("error reading export file: %w", err)
+	}
+
+	path := fmt.Sprintf("exports/%d/%s.%s", oa.OrgID(), export.UUID, format)
+
+	_, err = rt.S3.Client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:        aws.String(rt.Config.S3ExportsBucket),
+		Key:           aws.String(path),
+		Body:          file,
+		ContentType:   aws.String(format.ContentType()),
+		ContentLength: aws.Int64(info.Size()),
+		ACL:           types.ObjectCannedACLPrivate,
+	})
+	if err != nil {
+		return "", 0, fmt.Errorf("error uploading export file: %w", err)
+	}
+
+	slog.Info("exported contacts", "org_id", oa.OrgID(), "export_id", export.ID, "records", numRecords, "bytes", info.Size())
+
+	return path, numRecords, nil
+}
+
+// exportColumns are the columns of a contact export besides the fixed ones
+type exportColumns struct {
+	tz      *time.Location
+	schemes []string
+	fields  []*models.Field
+	groups  []*models.Group
+}
+
+func newExportColumns(oa *models.OrgAssets, cfg *models.ContactExportConfig) *exportColumns {
+	c := &exportColumns{tz: oa.Env().Timezone(), schemes: cfg.WithURNs}
+
+	for _, key := range cfg.WithFields {
+		if f := oa.FieldByKey(key); f != nil {
+			c.fields = append(c.fields, f)
+		}
+	}
+	for _, id := range cfg.WithGroups {
+		if g := oa.GroupByID(id); g != nil {
+			c.groups = append(c.groups, g)
+		}
+	}
+	return c
+}
+
+func (c *exportColumns) header() []string {
+	header := []string{"Contact UUID", "Name", "Language", "Status", "Created On", "Last Seen On"}
+	for _, s := range c.schemes {
+		header = append(header, "URN:"+s)
+	}
+	for _, f := range c.fields {
+		header = append(header, "Field:"+f.Name())
+	}
+	for _, g := range c.groups {
+		header = append(header, "Group:"+g.Name())
+	}
+	return header
+}
+
+func (c *exportColumns) row(contact *models.Contact) []string {
+	var lastSeenOn string
+	if contact.LastSeenOn() != nil {
+		lastSeenOn = c.formatTime(*contact.LastSeenOn())
+	}
+
+	row := []string{
+		string(contact.UUID()),
+		contact.Name(),
+		string(contact.Language()),
+		exportContactStatuses[contact.Status()],
+		c.formatTime(contact.CreatedOn()),
+		lastSeenOn,
+	}
+
+	// contacts can have multiple URNs of the same scheme so those are joined into a single cell
+	for _, scheme := range c.schemes {
+		var paths []string
+		for _, u := range contact.URNs() {
+			if u.Scheme == scheme {
+				paths = append(paths, u.Path)
+			}
+		}
+		row = append(row, strings.Join(paths, ", "))
+	}
+
+	for _, f := range c.fields {
+		var value string
+		if v := contact.Fields()[f.Key()]; v != nil {
+			value = v.Text.Native()
+		}
+		row = append(row, value)
+	}
+
+	for _, g := range c.groups {
+		inGroup := slices.ContainsFunc(contact.Groups(), func(cg *models.Group) bool { return cg.ID() == g.ID() })
+		row = append(row, fmt.Sprint(inGroup))
+	}
+
+	return row
+}
+
+func (c *exportColumns) formatTime(t time.Time) string {
+	return t.In(c.tz).Format("2006-01-02 15:04:05")
+}
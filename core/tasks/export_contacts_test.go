@@ -0,0 +1,83 @@
+package tasks_test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/nyaruka/gocommon/dbutil/assertdb"
+	"github.com/nyaruka/mailroom/v26/core/models"
+	"github.com/nyaruka/mailroom/v26/core/tasks"
+	"github.com/nyaruka/mailroom/v26/testsuite"
+	"github.com/nyaruka/mailroom/v26/testsuite/testdb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExportContacts(t *testing.T) {
+	ctx, rt := testsuite.Runtime(t)
+
+	exported := testdb.InsertContactGroup(t, rt, testdb.Org1, "", "Exported", "", testdb.Ann, testdb.Cat)
+
+	rt.DB.MustExec(`DELETE FROM contacts_contactgroup_contacts WHERE contactgroup_id = $1`, testdb.TestersGroup.ID)
+	testdb.TestersGroup.Add(rt, testdb.Cat)
+
+	rt.DB.MustExec(`UPDATE contacts_contact SET name = 'Ann', language = 'eng', created_on = '2025-01-02T12:00:00Z', last_seen_on = '2025-03-04T15:30:00Z', fields = '{"3a5891e4-756e-4dc9-8e12-b7a766168824": {"text": "F"}}' WHERE id = $1`, testdb.Ann.ID)
+	rt.DB.MustExec(`UPDATE contacts_contact SET name = 'Cat, Jr', language = NULL, status = 'B', created_on = '2025-01-05T08:00:00Z', last_seen_on = NULL, fields = '{}' WHERE id = $1`, testdb.Cat.ID)
+
+	testsuite.IndexContacts(t, rt)
+
+	oa, err := models.GetOrgAssetsWithRefresh(ctx, rt, testdb.Org1.ID, models.RefreshGroups)
+	require.NoError(t, err)
+
+	exportID := testdb.InsertExport(t, rt, testdb.Org1, models.ExportTypeContact, models.ExportStatusPending, map[string]any{
+		"group_id":    exported.ID,
+		"search":      "",
+		"with_fields": []string{"gender", "unknown"},
+		"with_groups": []models.GroupID{testdb.TestersGroup.ID},
+		"with_urns":   []string{"tel"},
+		"format":      "csv",
+	}, testdb.Admin)
+
+	err = (&tasks.ExportContacts{ExportID: exportID}).Perform(ctx, rt, oa, testTaskID)
+	require.NoError(t, err)
+
+	export, err := models.LoadExport(ctx, rt.DB, exportID)
+	require.NoError(t, err)
+	assert.Equal(t, models.ExportStatusComplete, export.Status)
+	assert.Equal(t, 2, int(export.NumRecords))
+	assert.Equal(t, fmt.Sprintf("exports/1/%s.csv", export.UUID), string(export.Path))
+
+	contentType, body, err := rt.S3.GetObject(ctx, rt.Config.S3ExportsBucket, string(export.Path))
+	require.NoError(t, err)
+	assert.Equal(t, "text/csv", contentType)
+
+	tz := oa.Env().Timezone()
+	fmtTime := func(s string) string {
+		t, _ := time.Parse(time.RFC3339, s)
+		return t.In(tz).Format("2006-01-02 15:04:05")
+	}
+
+	assert.Equal(t, fmt.Sprintf(
+		"Contact UUID,Name,Language,Status,Created On,Last Seen On,URN:tel,Field:%s,Group:%s\n"+
+			"%s,Ann,eng,Active,%s,%s,+16055741111,F,false\n"+
+			"%s,\"Cat, Jr\",,Blocked,%s,,+16055743333,,true\n",
+		oa.FieldByKey("gender").Name(), oa.GroupByID(testdb.TestersGroup.ID).Name(),
+		testdb.Ann.UUID, fmtTime("2025-01-02T12:00:00Z"), fmtTime("2025-03-04T15:30:00Z"),
+		testdb.Cat.UUID, fmtTime("2025-01-05T08:00:00Z"),
+	), string(body))
+
+	assertdb.Query(t, rt.DB, `SELECT count(*) FROM notifications_notification WHERE notification_type = 'export:finished' AND export_id = $1 AND user_id = $2`, exportID, testdb.Admin.ID).Returns(1)
+
+	// performing a completed export again does nothing
+	err = (&tasks.ExportContacts{ExportID: exportID}).Perform(ctx, rt, oa, testTaskID)
+	require.NoError(t, err)
+
+	// export of a group that no longer exists fails
+	exportID = testdb.InsertExport(t, rt, testdb.Org1, models.ExportTypeContact, models.ExportStatusPending, map[string]any{"group_id": 1234567}, testdb.Admin)
+
+	err = (&tasks.ExportContacts{ExportID: exportID}).Perform(ctx, rt, oa, testTaskID)
+	assert.EqualError(t, err, "error exporting contacts: no such group with id 1234567")
+
+	assertdb.Query(t, rt.DB, `SELECT status FROM orgs_export WHERE id = $1`, exportID).Returns("F")
+}
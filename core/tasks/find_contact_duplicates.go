@@ -0,0 +1,110 @@
+package tasks
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/nyaruka/gocommon/dates"
+	"github.com/nyaruka/mailroom/v26/core/models"
+	"github.com/nyaruka/mailroom/v26/runtime"
+	"github.com/nyaruka/vkutil/locks"
+)
+
+// TypeFindContactDuplicates is the type of the task to find probable duplicate contacts
+const TypeFindContactDuplicates = "find_contact_duplicates"
+
+const findContactDuplicatesLockKey = "lock:contact_dups_%d"
+const findContactDuplicatesPageSize = 1000
+
+// rescanned contacts are matched again harmlessly, so we overlap runs to allow for clock differences with the database
+const findContactDuplicatesOverlap = time.Minute
+
+func init() {
+	RegisterType(TypeFindContactDuplicates, func() Task { return &FindContactDuplicates{} })
+}
+
+// FindContactDuplicates is our task to find probable duplicate contacts in an org. Only contacts created or modified
+// since the last run are scanned, unless it's the first run or a full scan is requested.
+type FindContactDuplicates struct {
+	Full bool `json:"full,omitempty"`
+}
+
+func (t *FindContactDuplicates) Type() string {
+	return TypeFindContactDuplicates
+}
+
+// Timeout is the maximum amount of time the task can run for
+func (t *FindContactDuplicates) Timeout() time.Duration {
+	return time.Hour
+}
+
+func (t *FindContactDuplicates) WithAssets() models.Refresh {
+	return models.RefreshNone
+}
+
+// Perform scans the org's contacts a page at a time, recording any which are probable duplicates of other contacts
+func (t *FindContactDuplicates) Perform(ctx context.Context, rt *runtime.Runtime, oa *models.OrgAssets, taskID TaskID) error {
+	locker := locks.NewLocker(fmt.Sprintf(findContactDuplicatesLockKey, oa.OrgID()), time.Hour)
+	lock, err := locker.Grab(ctx, rt.VK, time.Minute*5)
+	if err != nil {
+		return fmt.Errorf("error grabbing lock to find contact duplicates: %w", err)
+	}
+	if lock == "" {
+		return fmt.Errorf("timeout waiting for lock to find contact duplicates")
+	}
+	defer locker.Release(ctx, rt.VK, lock)
+
+	if t.Full {
+		if err := models.ResetContactDuplicates(ctx, rt, oa.OrgID()); err != nil {
+			return err
+		}
+	}
+
+	scannedOn, err := models.GetContactDuplicatesScannedOn(ctx, rt, oa.OrgID())
+	if err != nil {
+		return err
+	}
+
+	start := dates.Now()
+	numScanned, numPairs := 0, 0
+	afterID := models.NilContactID
+
+	for {
+		var ids []models.ContactID
+		if scannedOn.IsZero() {
+			ids, err = models.GetContactIDsPage(ctx, rt.ReadonlyDB, oa.OrgID(), afterID, findContactDuplicatesPageSize)
+		} else {
+			ids, err = models.GetContactIDsModifiedSincePage(ctx, rt.ReadonlyDB, oa.OrgID(), scannedOn, afterID, findContactDuplicatesPageSize)
+		}
+		if err != nil {
+			return fmt.Errorf("error fetching contact ids: %w", err)
+		}
+		if len(ids) == 0 {
+			break
+		}
+
+		contacts, err := models.LoadContacts(ctx, rt.ReadonlyDB, oa, ids)
+		if err != nil {
+			return fmt.Errorf("error loading contacts: %w", err)
+		}
+
+		found, err := models.RecordContactDuplicates(ctx, rt, oa, contacts)
+		if err != nil {
+			return err
+		}
+
+		numScanned += len(contacts)
+		numPairs += found
+		afterID = ids[len(ids)-1]
+	}
+
+	if err := models.SetContactDuplicatesScannedOn(ctx, rt, oa.OrgID(), start.Add(-findContactDuplicatesOverlap)); err != nil {
+		return err
+	}
+
+	slog.Info("found contact duplicates", "org_id", oa.OrgID(), "full", scannedOn.IsZero(), "scanned", numScanned, "pairs", numPairs)
+
+	return nil
+}
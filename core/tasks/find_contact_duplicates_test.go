@@ -0,0 +1,60 @@
+package tasks_test
+
+import (
+	"testing"
+
+	"github.com/nyaruka/gocommon/i18n"
+	"github.com/nyaruka/gocommon/urns"
+	"github.com/nyaruka/mailroom/v26/core/models"
+	"github.com/nyaruka/mailroom/v26/core/tasks"
+	"github.com/nyaruka/mailroom/v26/testsuite"
+	"github.com/nyaruka/mailroom/v26/testsuite/testdb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFindContactDuplicates(t *testing.T) {
+	ctx, rt := testsuite.Runtime(t)
+
+	rt.DB.MustExec(`UPDATE contacts_contact SET name = '', fields = '{}' WHERE org_id = $1`, testdb.Org1.ID)
+	testdb.InsertContactURN(t, rt, testdb.Org1, testdb.Cat, urns.URN("whatsapp:16055741111"), 999, nil)
+
+	oa := testdb.Org1.Load(t, rt)
+
+	getPairs := func() [][2]models.ContactID {
+		dups, err := models.GetContactDuplicates(ctx, rt, oa, 10)
+		require.NoError(t, err)
+
+		pairs := make([][2]models.ContactID, len(dups))
+		for i, d := range dups {
+			pairs[i] = d.ContactIDs
+		}
+		return pairs
+	}
+
+	// first run is a full scan
+	err := (&tasks.FindContactDuplicates{}).Perform(ctx, rt, oa, testTaskID)
+	require.NoError(t, err)
+
+	assert.Equal(t, [][2]models.ContactID{{testdb.Ann.ID, testdb.Cat.ID}}, getPairs())
+
+	scannedOn, err := models.GetContactDuplicatesScannedOn(ctx, rt, testdb.Org1.ID)
+	require.NoError(t, err)
+	assert.False(t, scannedOn.IsZero())
+
+	// create a new contact with Bob's number in local format
+	eve := testdb.InsertContact(t, rt, testdb.Org1, "e2f9a8f3-6f4a-4c1b-8d27-3a4b9b1f2f10", "Eve", i18n.NilLanguage, models.ContactStatusActive)
+	testdb.InsertContactURN(t, rt, testdb.Org1, eve, urns.URN("tel:6055742222"), 1000, nil)
+
+	// next run only scans new and modified contacts
+	err = (&tasks.FindContactDuplicates{}).Perform(ctx, rt, oa, testTaskID)
+	require.NoError(t, err)
+
+	assert.Equal(t, [][2]models.ContactID{{testdb.Ann.ID, testdb.Cat.ID}, {testdb.Bob.ID, eve.ID}}, getPairs())
+
+	// a full scan starts over but finds the same pairs
+	err = (&tasks.FindContactDuplicates{Full: true}).Perform(ctx, rt, oa, testTaskID)
+	require.NoError(t, err)
+
+	assert.Equal(t, [][2]models.ContactID{{testdb.Ann.ID, testdb.Cat.ID}, {testdb.Bob.ID, eve.ID}}, getPairs())
+}
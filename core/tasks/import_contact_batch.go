@@ -7,6 +7,8 @@ import (
 	"slices"
 	"time"
 
+	"github.com/nyaruka/gocommon/dates"
+	"github.com/nyaruka/gocommon/uuids"
 	"github.com/nyaruka/mailroom/v26/core/imports"
 	"github.com/nyaruka/mailroom/v26/core/models"
 	"github.com/nyaruka/mailroom/v26/runtime"
@@ -87,3 +89,28 @@ func (t *ImportContactBatch) Perform(ctx context.Context, rt *runtime.Runtime, o
 
 	return nil
 }
+
+// QueueImportContactBatches queues a task for each batch of an import
+func QueueImportContactBatches(ctx context.Context, rt *runtime.Runtime, orgID models.OrgID, batchIDs []models.ContactImportBatchID) error {
+	// generate a UUID to own this set of batches since unlike other batch tasks, these have no parent task
+	ownerUUID := uuids.NewV7()
+
+	RecordQueued(ctx, rt, ownerUUID, &BatchInfo{
+		Type:     TypeImportContactBatch,
+		OrgID:    orgID,
+		Total:    len(batchIDs),
+		QueuedOn: dates.Now(),
+	})
+
+	// create tasks for all batches
+	for _, bID := range batchIDs {
+		task := &ImportContactBatch{
+			BatchTask:            BatchTask{BatchOwnerUUID: ownerUUID, TotalBatches: len(batchIDs)},
+			ContactImportBatchID: bID,
+		}
+		if err := Queue(ctx, rt, rt.Queues.Batch, orgID, task, false); err != nil {
+			return fmt.Errorf("error queuing import contact batch task: %w", err)
+		}
+	}
+	return nil
+}
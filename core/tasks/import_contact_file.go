@@ -0,0 +1,100 @@
+package tasks
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/nyaruka/gocommon/jsonx"
+	"github.com/nyaruka/mailroom/v26/core/imports"
+	"github.com/nyaruka/mailroom/v26/core/models"
+	"github.com/nyaruka/mailroom/v26/runtime"
+)
+
+// TypeImportContactFile is the type of the import contact file task
+const TypeImportContactFile = "import_contact_file"
+
+// the number of contacts in each batch of an import
+const importContactBatchSize = 100
+
+func init() {
+	RegisterType(TypeImportContactFile, func() Task { return &ImportContactFile{} })
+}
+
+// ImportContactFile is our task to parse the file of a pending import into batches and queue those to be imported
+type ImportContactFile struct {
+	ContactImportID models.ContactImportID `json:"contact_import_id"`
+}
+
+func (t *ImportContactFile) Type() string {
+	return TypeImportContactFile
+}
+
+// Timeout is the maximum amount of time the task can run for
+func (t *ImportContactFile) Timeout() time.Duration {
+	return time.Minute * 30
+}
+
+func (t *ImportContactFile) WithAssets() models.Refresh {
+	return models.RefreshFields | models.RefreshGroups
+}
+
+// Perform fetches and parses the import file, saves its rows as batches, along with errors for any invalid rows, and
+// queues the batches to be imported. If the file can't be imported at all, the import is marked as failed.
+func (t *ImportContactFile) Perform(ctx context.Context, rt *runtime.Runtime, oa *models.OrgAssets, taskID TaskID) error {
+	imp, err := models.LoadContactImport(ctx, rt.DB, t.ContactImportID)
+	if err != nil {
+		return fmt.Errorf("error loading contact import: %w", err)
+	}
+	if imp.OrgID != oa.OrgID() {
+		return fmt.Errorf("contact import %d doesn't belong to org %d", imp.ID, oa.OrgID())
+	}
+	if imp.Status != models.ImportStatusPending {
+		return nil // already parsed
+	}
+
+	var mappings []*imports.Mapping
+	if err := jsonx.Unmarshal(imp.Mappings, &mappings); err != nil {
+		return fmt.Errorf("error unmarshaling import mappings: %w", err)
+	}
+
+	columns, specs, importErrs, err := imports.ParseFile(ctx, rt, oa, imp.File, imp.OriginalFilename, mappings)
+	if err != nil {
+		// if the problem is with the file itself, save that as an error on the import
+		var fileErr *imports.FileError
+		if errors.As(err, &fileErr) {
+			if err := imp.InsertBatches(ctx, rt.DB, mappings, nil, []models.ImportError{{Row: 1, Message: fileErr.Error()}}, importContactBatchSize); err != nil {
+				return err
+			}
+			return t.finish(ctx, rt, oa, imp, false)
+		}
+
+		if err := t.finish(ctx, rt, oa, imp, false); err != nil {
+			slog.Error("error marking import as failed", "import_id", imp.ID, "error", err)
+		}
+		return fmt.Errorf("error parsing contact import file: %w", err)
+	}
+
+	if err := imp.InsertBatches(ctx, rt.DB, columns, specs, importErrs, importContactBatchSize); err != nil {
+		return err
+	}
+
+	// if there were no valid rows, there's nothing to import
+	if len(specs) == 0 {
+		return t.finish(ctx, rt, oa, imp, true)
+	}
+
+	return QueueImportContactBatches(ctx, rt, oa.OrgID(), imp.BatchIDs)
+}
+
+func (t *ImportContactFile) finish(ctx context.Context, rt *runtime.Runtime, oa *models.OrgAssets, imp *models.ContactImport, success bool) error {
+	if err := imp.SetFinished(ctx, rt.DB, success); err != nil {
+		return err
+	}
+	if err := models.NotifyImportFinished(ctx, rt, oa, imp); err != nil {
+		return fmt.Errorf("error creating import finished notification: %w", err)
+	}
+	return nil
+}
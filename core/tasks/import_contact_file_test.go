@@ -0,0 +1,51 @@
+package tasks_test
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/nyaruka/gocommon/dbutil/assertdb"
+	"github.com/nyaruka/mailroom/v26/core/imports"
+	"github.com/nyaruka/mailroom/v26/core/models"
+	"github.com/nyaruka/mailroom/v26/core/tasks"
+	"github.com/nyaruka/mailroom/v26/testsuite"
+	"github.com/nyaruka/mailroom/v26/testsuite/testdb"
+	"github.com/stretchr/testify/require"
+)
+
+func TestImportContactFile(t *testing.T) {
+	ctx, rt := testsuite.Runtime(t)
+
+	_, err := rt.S3.PutObject(ctx, rt.Config.S3ExportsBucket, "imports/1/contacts.csv", "text/csv", []byte(
+		"Name,URN:tel\n"+
+			"Norbert,+16055740001\n"+
+			"Rowan,call me\n"+
+			"Leah,+16055740002\n",
+	), types.ObjectCannedACLPrivate)
+	require.NoError(t, err)
+
+	imp, err := models.InsertContactImport(ctx, rt.DB, testdb.Org1.ID, testdb.Admin.ID, "imports/1/contacts.csv", "contacts.csv", nil)
+	require.NoError(t, err)
+
+	testsuite.QueueBatchTask(t, rt, testdb.Org1, &tasks.ImportContactFile{ContactImportID: imp.ID})
+	testsuite.FlushTasks(t, rt)
+
+	// valid rows are imported and the invalid row is saved as an error on the import
+	assertdb.Query(t, rt.DB, `SELECT count(*) FROM contacts_contact WHERE name IN ('Norbert', 'Leah')`).Returns(2)
+	assertdb.Query(t, rt.DB, `SELECT status, num_records FROM contacts_contactimport WHERE id = $1`, imp.ID).Columns(map[string]any{"status": "C", "num_records": int64(2)})
+	assertdb.Query(t, rt.DB, `SELECT num_created, num_errored, errors->0->>'message' AS message FROM contacts_contactimportbatch WHERE contact_import_id = $1`, imp.ID).
+		Columns(map[string]any{"num_created": int64(2), "num_errored": int64(1), "message": "'call me' is not a valid tel URN"})
+	assertdb.Query(t, rt.DB, `SELECT count(*) FROM notifications_notification WHERE contact_import_id = $1`, imp.ID).Returns(1)
+
+	// a file with no column which identifies contacts fails without any batches to import
+	imp, err = models.InsertContactImport(ctx, rt.DB, testdb.Org1.ID, testdb.Admin.ID, "imports/1/contacts.csv", "contacts.csv", []*imports.Mapping{{Type: imports.MappingTypeAttribute, Name: "name"}, {Type: imports.MappingTypeIgnore}})
+	require.NoError(t, err)
+
+	testsuite.QueueBatchTask(t, rt, testdb.Org1, &tasks.ImportContactFile{ContactImportID: imp.ID})
+	testsuite.FlushTasks(t, rt)
+
+	assertdb.Query(t, rt.DB, `SELECT status, num_records FROM contacts_contactimport WHERE id = $1`, imp.ID).Columns(map[string]any{"status": "F", "num_records": int64(0)})
+	assertdb.Query(t, rt.DB, `SELECT specs::text, errors->0->>'message' AS message FROM contacts_contactimportbatch WHERE contact_import_id = $1`, imp.ID).
+		Columns(map[string]any{"specs": "[]", "message": "import must have a UUID or URN column"})
+	assertdb.Query(t, rt.DB, `SELECT count(*) FROM notifications_notification WHERE contact_import_id = $1`, imp.ID).Returns(1)
+}
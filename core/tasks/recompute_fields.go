@@ -0,0 +1,175 @@
+package tasks
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	valkey "github.com/gomodule/redigo/redis"
+	"github.com/nyaruka/gocommon/dates"
+	"github.com/nyaruka/goflow/assets"
+	"github.com/nyaruka/mailroom/v26/core/models"
+	"github.com/nyaruka/mailroom/v26/core/runner"
+	"github.com/nyaruka/mailroom/v26/runtime"
+)
+
+// TypeRecomputeFields is the type of the task to recompute time dependent computed fields
+const TypeRecomputeFields = "recompute_fields"
+
+const recomputeFieldsPageSize = 100
+
+// how long we keep the progress of a recompute, which is long enough for it to be resumed by the next hourly run
+const recomputeFieldsProgressExpiry = 7 * 24 * time.Hour
+
+func init() {
+	RegisterType(TypeRecomputeFields, func() Task { return &RecomputeFields{} })
+}
+
+// RecomputeFields is our task to re-evaluate the computed fields of contacts in an org whose values can change with
+// the passage of time alone, e.g. an age computed from a date of birth. Fields which call now() are re-evaluated every
+// run, and fields which only call today() are re-evaluated on the first run of each day in the org's timezone. The
+// task records its progress so a run which times out is resumed by the next one.
+type RecomputeFields struct{}
+
+func (t *RecomputeFields) Type() string {
+	return TypeRecomputeFields
+}
+
+// Timeout is the maximum amount of time the task can run for, which is less than the period of the cron which queues
+// it so that runs don't overlap
+func (t *RecomputeFields) Timeout() time.Duration {
+	return time.Minute * 45
+}
+
+func (t *RecomputeFields) WithAssets() models.Refresh {
+	return models.RefreshFields
+}
+
+// Perform re-evaluates computed fields for the org's contacts a page at a time
+func (t *RecomputeFields) Perform(ctx context.Context, rt *runtime.Runtime, oa *models.OrgAssets, taskID TaskID) error {
+	progress, err := getRecomputeFieldsProgress(ctx, rt, oa.OrgID())
+	if err != nil {
+		return err
+	}
+
+	// if we're not resuming a previous run, work out whether this run includes the once a day fields
+	if progress.AfterID == models.NilContactID {
+		today := dates.Now().In(oa.Env().Timezone()).Format(time.DateOnly)
+		progress.Daily = progress.Day != today
+		progress.Day = today
+	}
+
+	fieldUUIDs, allContacts := recomputeFieldsInputs(oa, progress.Daily)
+	if !allContacts && len(fieldUUIDs) == 0 {
+		return nil // nothing to recompute
+	}
+
+	numContacts, numSkipped := 0, 0
+
+	for {
+		var ids []models.ContactID
+		if allContacts {
+			ids, err = models.GetContactIDsPage(ctx, rt.ReadonlyDB, oa.OrgID(), progress.AfterID, recomputeFieldsPageSize)
+		} else {
+			ids, err = models.GetContactIDsWithFieldsPage(ctx, rt.ReadonlyDB, oa.OrgID(), fieldUUIDs, progress.AfterID, recomputeFieldsPageSize)
+		}
+		if err != nil {
+			return fmt.Errorf("error fetching contact ids: %w", err)
+		}
+		if len(ids) == 0 {
+			break
+		}
+
+		skipped, err := runner.RecomputeFieldsWithLock(ctx, rt, oa, ids)
+		if err != nil {
+			return err
+		}
+
+		numContacts += len(ids) - len(skipped)
+		numSkipped += len(skipped)
+		progress.AfterID = ids[len(ids)-1]
+
+		if err := setRecomputeFieldsProgress(ctx, rt, oa.OrgID(), progress); err != nil {
+			return err
+		}
+	}
+
+	// clear our position so the next run starts from the beginning
+	progress.AfterID = models.NilContactID
+	if err := setRecomputeFieldsProgress(ctx, rt, oa.OrgID(), progress); err != nil {
+		return err
+	}
+
+	slog.Info("recomputed fields", "org_id", oa.OrgID(), "daily", progress.Daily, "contacts", numContacts, "skipped", numSkipped)
+
+	return nil
+}
+
+// returns the UUIDs of the fields that the time dependent computed fields due to be recomputed read, and whether they
+// also depend on something other than fields and so all contacts have to be recomputed
+func recomputeFieldsInputs(oa *models.OrgAssets, daily bool) ([]assets.FieldUUID, bool) {
+	fields, _ := oa.Fields()
+	fieldUUIDs := make([]assets.FieldUUID, 0, 2)
+	allContacts := false
+
+	for _, f := range fields {
+		field := f.(*models.Field)
+		if !field.TimeDependent() || (!daily && !field.DependsOnNow()) {
+			continue
+		}
+
+		keys, only := field.InputFieldKeys()
+		if !only {
+			allContacts = true
+		}
+		for _, key := range keys {
+			if input := oa.FieldByKey(key); input != nil {
+				fieldUUIDs = append(fieldUUIDs, input.UUID())
+			}
+		}
+	}
+	return fieldUUIDs, allContacts
+}
+
+type recomputeFieldsProgress struct {
+	AfterID models.ContactID `redis:"after_id"`
+	Daily   bool             `redis:"daily"`
+	Day     string           `redis:"day"`
+}
+
+func recomputeFieldsProgressKey(orgID models.OrgID) string {
+	return fmt.Sprintf("recompute_fields:%d", orgID)
+}
+
+func getRecomputeFieldsProgress(ctx context.Context, rt *runtime.Runtime, orgID models.OrgID) (*recomputeFieldsProgress, error) {
+	vc := rt.VK.Get()
+	defer vc.Close()
+
+	values, err := valkey.Values(valkey.DoContext(vc, ctx, "HGETALL", recomputeFieldsProgressKey(orgID)))
+	if err != nil {
+		return nil, fmt.Errorf("error reading recompute fields progress: %w", err)
+	}
+
+	progress := &recomputeFieldsProgress{}
+	if err := valkey.ScanStruct(values, progress); err != nil {
+		return nil, fmt.Errorf("error scanning recompute fields progress: %w", err)
+	}
+	return progress, nil
+}
+
+func setRecomputeFieldsProgress(ctx context.Context, rt *runtime.Runtime, orgID models.OrgID, progress *recomputeFieldsProgress) error {
+	vc := rt.VK.Get()
+	defer vc.Close()
+
+	key := recomputeFieldsProgressKey(orgID)
+
+	vc.Send("MULTI")
+	vc.Send("HSET", valkey.Args{}.Add(key).AddFlat(progress)...)
+	vc.Send("EXPIRE", key, int(recomputeFieldsProgressExpiry/time.Second))
+
+	if _, err := valkey.DoContext(vc, ctx, "EXEC"); err != nil {
+		return fmt.Errorf("error saving recompute fields progress: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,90 @@
+package tasks_test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/nyaruka/gocommon/dates"
+	"github.com/nyaruka/gocommon/dbutil/assertdb"
+	"github.com/nyaruka/mailroom/v26/core/models"
+	"github.com/nyaruka/mailroom/v26/core/tasks"
+	"github.com/nyaruka/mailroom/v26/testsuite"
+	"github.com/nyaruka/mailroom/v26/testsuite/testdb"
+	"github.com/nyaruka/vkutil/assertvk"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecomputeFields(t *testing.T) {
+	ctx, rt := testsuite.Runtime(t)
+
+	dates.SetNowFunc(dates.NewFixedNow(time.Date(2025, 5, 4, 12, 0, 0, 0, time.UTC)))
+	defer dates.SetNowFunc(time.Now)
+
+	// computed field which isn't time dependent is left alone
+	rt.DB.MustExec(`UPDATE orgs_org SET config = config || '{"computed_fields": {"gender": "@(upper(contact.name))"}}'::jsonb WHERE id = $1`, testdb.Org1.ID)
+
+	oa, err := models.GetOrgAssetsWithRefresh(ctx, rt, testdb.Org1.ID, models.RefreshFields)
+	require.NoError(t, err)
+
+	err = (&tasks.RecomputeFields{}).Perform(ctx, rt, oa, testTaskID)
+	require.NoError(t, err)
+
+	assertdb.Query(t, rt.DB, `SELECT count(*) FROM contacts_contact WHERE org_id = $1 AND fields ? $2`, testdb.Org1.ID, testdb.GenderField.UUID).Returns(0)
+
+	rt.DB.MustExec(`UPDATE orgs_org SET config = config || '{"computed_fields": {"gender": "@(upper(contact.name)) @(format_date(today(), \"YYYY\"))"}}'::jsonb WHERE id = $1`, testdb.Org1.ID)
+
+	oa, err = models.GetOrgAssetsWithRefresh(ctx, rt, testdb.Org1.ID, models.RefreshFields)
+	require.NoError(t, err)
+
+	err = (&tasks.RecomputeFields{}).Perform(ctx, rt, oa, testTaskID)
+	require.NoError(t, err)
+
+	assertdb.Query(t, rt.DB, `SELECT fields->$2->>'text' FROM contacts_contact WHERE id = $1`, testdb.Ann.ID, testdb.GenderField.UUID).Returns("ANN 2025")
+	assertdb.Query(t, rt.DB, `SELECT fields->$2->>'text' FROM contacts_contact WHERE id = $1`, testdb.Bob.ID, testdb.GenderField.UUID).Returns("BOB 2025")
+
+	// fields which only call today() are only recomputed once a day
+	rt.DB.MustExec(`UPDATE contacts_contact SET fields = fields || jsonb_build_object($2::text, '{"text": "X"}'::jsonb) WHERE id = $1`, testdb.Ann.ID, testdb.GenderField.UUID)
+
+	err = (&tasks.RecomputeFields{}).Perform(ctx, rt, oa, testTaskID)
+	require.NoError(t, err)
+
+	assertdb.Query(t, rt.DB, `SELECT fields->$2->>'text' FROM contacts_contact WHERE id = $1`, testdb.Ann.ID, testdb.GenderField.UUID).Returns("X")
+
+	dates.SetNowFunc(dates.NewFixedNow(time.Date(2025, 5, 5, 12, 0, 0, 0, time.UTC)))
+
+	err = (&tasks.RecomputeFields{}).Perform(ctx, rt, oa, testTaskID)
+	require.NoError(t, err)
+
+	assertdb.Query(t, rt.DB, `SELECT fields->$2->>'text' FROM contacts_contact WHERE id = $1`, testdb.Ann.ID, testdb.GenderField.UUID).Returns("ANN 2025")
+
+	// fields which call now() are recomputed every run, but only for contacts with values for their inputs
+	rt.DB.MustExec(`UPDATE orgs_org SET config = config - 'computed_fields' || '{"computed_fields": {"gender": "@(if(fields.age, format_date(now(), \"YYYY\"), \"\"))"}}'::jsonb WHERE id = $1`, testdb.Org1.ID)
+	rt.DB.MustExec(`UPDATE contacts_contact SET fields = fields - $1::text - $2::text WHERE org_id = $3`, testdb.GenderField.UUID, testdb.AgeField.UUID, testdb.Org1.ID)
+	rt.DB.MustExec(`UPDATE contacts_contact SET fields = fields || jsonb_build_object($2::text, '{"text": "30", "number": 30}'::jsonb) WHERE id = $1`, testdb.Bob.ID, testdb.AgeField.UUID)
+
+	oa, err = models.GetOrgAssetsWithRefresh(ctx, rt, testdb.Org1.ID, models.RefreshFields)
+	require.NoError(t, err)
+
+	err = (&tasks.RecomputeFields{}).Perform(ctx, rt, oa, testTaskID)
+	require.NoError(t, err)
+
+	assertdb.Query(t, rt.DB, `SELECT fields->$2->>'text' FROM contacts_contact WHERE id = $1`, testdb.Bob.ID, testdb.GenderField.UUID).Returns("2025")
+	assertdb.Query(t, rt.DB, `SELECT count(*) FROM contacts_contact WHERE fields ? $1`, testdb.GenderField.UUID).Returns(1)
+
+	// a run which didn't finish is resumed from where it got to
+	rt.DB.MustExec(`UPDATE contacts_contact SET fields = fields - $1::text WHERE org_id = $2`, testdb.GenderField.UUID, testdb.Org1.ID)
+	rt.DB.MustExec(`UPDATE contacts_contact SET fields = fields || jsonb_build_object($2::text, '{"text": "30", "number": 30}'::jsonb) WHERE id = $1`, testdb.Ann.ID, testdb.AgeField.UUID)
+
+	vc := rt.VK.Get()
+	defer vc.Close()
+	_, err = vc.Do("HSET", fmt.Sprintf("recompute_fields:%d", testdb.Org1.ID), "after_id", testdb.Ann.ID)
+	require.NoError(t, err)
+
+	err = (&tasks.RecomputeFields{}).Perform(ctx, rt, oa, testTaskID)
+	require.NoError(t, err)
+
+	assertdb.Query(t, rt.DB, `SELECT count(*) FROM contacts_contact WHERE id = $1 AND fields ? $2`, testdb.Ann.ID, testdb.GenderField.UUID).Returns(0)
+	assertdb.Query(t, rt.DB, `SELECT fields->$2->>'text' FROM contacts_contact WHERE id = $1`, testdb.Bob.ID, testdb.GenderField.UUID).Returns("2025")
+	assertvk.HGetAll(t, vc, fmt.Sprintf("recompute_fields:%d", testdb.Org1.ID), map[string]string{"after_id": "0", "daily": "0", "day": "2025-05-05"})
+}
@@ -111,16 +111,13 @@ func createBroadcastBatches(ctx context.Context, rt *runtime.Runtime, oa *models
 		createdIDs[id] = true
 	}
 
-	// create tasks for batches of contacts
-	idBatches := slices.Collect(slices.Chunk(contactIDs, broadcastBatchSize))
-
-	RecordQueued(ctx, rt, uuids.UUID(bcast.UUID), &BatchInfo{
-		Type:     TypeSendBroadcastBatch,
-		OrgID:    bcast.OrgID,
-		Total:    len(idBatches),
-		QueuedOn: dates.Now(),
-	})
+	// create batches of contacts, splitting them between variants if this is an experiment
+	idBatches, variants, err := splitVariantBatches(ctx, rt, bcast.OrgID, uuids.UUID(bcast.UUID), bcast.Variants, contactIDs, broadcastBatchSize)
+	if err != nil {
+		return err
+	}
 
+	batches := make([]*models.BroadcastBatch, 0, len(idBatches))
 	for i, idBatch := range idBatches {
 		var createdBatch []models.ContactID
 		for _, id := range idBatch {
@@ -129,9 +126,36 @@ func createBroadcastBatches(ctx context.Context, rt *runtime.Runtime, oa *models
 			}
 		}
 
-		batch := bcast.CreateBatch(idBatch, createdBatch)
+		batch := bcast.CreateBatch(idBatch, createdBatch, variants[i])
+
+		// if send times are being optimized, defer sends to contacts who'll be active later within the window
+		if bcast.OptimizeWithin > 0 && bcast.ID != models.NilBroadcastID {
+			batch, err = models.DeferBroadcastSends(ctx, rt.DB, oa, bcast, batch, dates.Now())
+			if err != nil {
+				return fmt.Errorf("error deferring broadcast sends: %w", err)
+			}
+		}
+
+		if len(batch.ContactIDs) > 0 {
+			batches = append(batches, batch)
+		}
+	}
+
+	// if every send was deferred, the fires will create the batches
+	if len(batches) == 0 {
+		return nil
+	}
+
+	RecordQueued(ctx, rt, uuids.UUID(bcast.UUID), &BatchInfo{
+		Type:     TypeSendBroadcastBatch,
+		OrgID:    bcast.OrgID,
+		Total:    len(batches),
+		QueuedOn: dates.Now(),
+	})
+
+	for i, batch := range batches {
 		batchTask := &SendBroadcastBatch{
-			BatchTask:      BatchTask{BatchOwnerUUID: uuids.UUID(bcast.UUID), TotalBatches: len(idBatches)},
+			BatchTask:      BatchTask{BatchOwnerUUID: uuids.UUID(bcast.UUID), TotalBatches: len(batches)},
 			BroadcastBatch: batch,
 		}
 		err = Queue(ctx, rt, q, bcast.OrgID, batchTask, false)
@@ -146,3 +170,31 @@ func createBroadcastBatches(ctx context.Context, rt *runtime.Runtime, oa *models
 
 	return nil
 }
+
+// splits the given contacts into batches of the given size, and if there are variants, first splits them between the
+// variants and records the experiment and their assignments. Returns the batches and the variant of each batch.
+func splitVariantBatches(ctx context.Context, rt *runtime.Runtime, orgID models.OrgID, experimentUUID uuids.UUID, variants []*models.Variant, contactIDs []models.ContactID, batchSize int) ([][]models.ContactID, []*models.Variant, error) {
+	if len(variants) == 0 {
+		idBatches := slices.Collect(slices.Chunk(contactIDs, batchSize))
+		return idBatches, make([]*models.Variant, len(idBatches)), nil
+	}
+
+	var idBatches [][]models.ContactID
+	var batchVariants []*models.Variant
+	var assignments []*models.VariantAssignment
+
+	for i, variantIDs := range models.SplitVariants(experimentUUID, variants, contactIDs) {
+		for idBatch := range slices.Chunk(variantIDs, batchSize) {
+			assignments = append(assignments, models.NewVariantAssignment(orgID, experimentUUID, variants[i], len(idBatches), idBatch))
+			idBatches = append(idBatches, idBatch)
+			batchVariants = append(batchVariants, variants[i])
+		}
+	}
+
+	// results can't be reported without the assignments so they must be recorded before anything is sent
+	if err := models.InsertExperiment(ctx, rt, models.NewExperiment(orgID, experimentUUID, variants), assignments); err != nil {
+		return nil, nil, fmt.Errorf("error recording experiment: %w", err)
+	}
+
+	return idBatches, batchVariants, nil
+}
@@ -4,8 +4,11 @@ import (
 	"context"
 	"fmt"
 	"log/slog"
+	"slices"
 	"time"
 
+	"github.com/nyaruka/gocommon/dates"
+	"github.com/nyaruka/gocommon/uuids"
 	"github.com/nyaruka/mailroom/v26/core/models"
 	"github.com/nyaruka/mailroom/v26/core/runner"
 	"github.com/nyaruka/mailroom/v26/runtime"
@@ -57,16 +60,54 @@ func (t *SendBroadcastBatch) Perform(ctx context.Context, rt *runtime.Runtime, o
 		return nil
 	}
 
-	// if we're the first batch of the set to start, mark the broadcast itself as started
-	if t.RecordStarted(ctx, rt) {
+	// if we're the first batch of the set to start, mark the broadcast itself as started - deferred batches aren't
+	// part of the set so start the broadcast if every send was deferred
+	if t.RecordStarted(ctx, rt) || (t.Deferred && bcast.Status == models.BroadcastStatusQueued) {
 		if err := bcast.SetStarted(ctx, rt.DB); err != nil {
 			return fmt.Errorf("error marking broadcast as started: %w", err)
 		}
 	}
 
+	// deferred batches only carry the UUID of their variant so load its content from the experiment
+	batch := t.BroadcastBatch
+	if batch.Variant == nil && batch.VariantUUID != "" {
+		variant, err := models.GetExperimentVariant(ctx, rt, bcast.OrgID, uuids.UUID(bcast.UUID), batch.VariantUUID)
+		if err != nil {
+			return fmt.Errorf("error loading experiment variant for broadcast: %w", err)
+		}
+		if variant == nil {
+			return fmt.Errorf("no such variant %s in experiment for broadcast #%d", batch.VariantUUID, bcast.ID)
+		}
+
+		withVariant := *batch
+		withVariant.Variant = variant
+		batch = &withVariant
+	}
+
+	// if this batch is for a variant of an experiment, send that variant's content
+	send := bcast
+	if batch.Variant != nil {
+		send = bcast.ForVariant(batch.Variant)
+	}
+
+	// persisted broadcasts are subject to the org's frequency caps
+	caps := oa.Org().FrequencyCaps()
+	cappedOn := dates.Now()
+	if caps != nil && bcast.ID != models.NilBroadcastID {
+		batch, err = t.applyFrequencyCaps(ctx, rt, oa, bcast, batch, caps, cappedOn)
+		if err != nil {
+			return err
+		}
+	}
+
 	// create this batch of messages
-	_, skipped, err := runner.BroadcastWithLock(ctx, rt, oa, bcast, t.BroadcastBatch, models.StartModeBackground)
+	scenes, skipped, err := runner.BroadcastWithLock(ctx, rt, oa, send, batch, models.StartModeBackground)
 	if err != nil {
+		if caps != nil && bcast.ID != models.NilBroadcastID {
+			if err := models.ReleaseFrequencySends(ctx, rt, oa, batch.ContactIDs, cappedOn); err != nil {
+				slog.Error("error releasing frequency sends", "broadcast", bcast.ID, "error", err)
+			}
+		}
 		return fmt.Errorf("error creating broadcast messages: %w", err)
 	}
 
@@ -74,8 +115,42 @@ func (t *SendBroadcastBatch) Perform(ctx context.Context, rt *runtime.Runtime, o
 		slog.Warn("failed to acquire locks for contacts", "contacts", skipped)
 	}
 
-	// mark broadcast as done if this was the last batch to complete
-	if t.RecordComplete(ctx, rt, taskID) {
+	// sends were reserved for every contact allowed by the caps, so release those which weren't made
+	if caps != nil && bcast.ID != models.NilBroadcastID {
+		sent := make(map[models.ContactID]bool, len(scenes))
+		for _, scene := range scenes {
+			if scene.Broadcast != nil {
+				sent[scene.DBContact.ID()] = true
+			}
+		}
+		var unsent []models.ContactID
+		for _, id := range batch.ContactIDs {
+			if !sent[id] {
+				unsent = append(unsent, id)
+			}
+		}
+		if err := models.ReleaseFrequencySends(ctx, rt, oa, unsent, cappedOn); err != nil {
+			slog.Error("error releasing frequency sends", "broadcast", bcast.ID, "error", err)
+		}
+	}
+
+	// mark broadcast as done if this was the last batch to complete, or for broadcasts whose sends can be deferred,
+	// if this was a deferred batch and there are no more deferred sends
+	complete := t.RecordComplete(ctx, rt, taskID)
+	canDefer := t.Optimized || t.Deferred || (caps != nil && caps.Defer)
+	if canDefer && (complete || t.Deferred) {
+		var sending []models.ContactID
+		if t.Deferred {
+			sending = t.ContactIDs
+		}
+		deferred, err := models.CountDeferredBroadcastSends(ctx, rt.DB, bcast.ID, sending)
+		if err != nil {
+			return err
+		}
+		complete = deferred == 0
+	}
+
+	if complete {
 		if err := bcast.SetCompleted(ctx, rt.DB); err != nil {
 			return fmt.Errorf("error marking broadcast as complete: %w", err)
 		}
@@ -83,3 +158,39 @@ func (t *SendBroadcastBatch) Perform(ctx context.Context, rt *runtime.Runtime, o
 
 	return nil
 }
+
+// removes contacts who have reached a frequency cap from the given batch, deferring their sends if the caps say so, and
+// reserves sends for the remaining contacts
+func (t *SendBroadcastBatch) applyFrequencyCaps(ctx context.Context, rt *runtime.Runtime, oa *models.OrgAssets, bcast *models.Broadcast, batch *models.BroadcastBatch, caps *models.FrequencyCaps, now time.Time) (*models.BroadcastBatch, error) {
+	allowed, capped, err := caps.Reserve(ctx, rt, oa, batch.ContactIDs, now)
+	if err != nil {
+		return nil, fmt.Errorf("error applying frequency caps: %w", err)
+	}
+
+	if len(capped) > 0 {
+		// contacts in a deferred batch may have been capped and counted by an earlier batch of this broadcast
+		numNewlyCapped := 0
+		for _, id := range capped {
+			if !slices.Contains(batch.CappedContactIDs, id) {
+				numNewlyCapped++
+			}
+		}
+
+		if caps.Defer {
+			deferBatch := batch.ForContacts(capped)
+			deferBatch.CappedContactIDs = capped
+
+			if err := models.DeferBroadcastSendsUntil(ctx, rt.DB, bcast, deferBatch, capped, caps.DeferUntil(oa, now)); err != nil {
+				return nil, fmt.Errorf("error deferring capped broadcast sends: %w", err)
+			}
+		}
+
+		if numNewlyCapped > 0 {
+			if err := models.RecordBroadcastCapped(ctx, rt.DB, bcast, numNewlyCapped); err != nil {
+				slog.Error("error recording capped contacts for broadcast", "broadcast", bcast.ID, "error", err)
+			}
+		}
+	}
+
+	return batch.ForContacts(allowed), nil
+}
@@ -2,14 +2,17 @@ package tasks_test
 
 import (
 	"bytes"
+	"fmt"
 	"testing"
 	"time"
 
+	"github.com/lib/pq"
 	"github.com/nyaruka/gocommon/dbutil/assertdb"
 	"github.com/nyaruka/gocommon/elastic"
 	"github.com/nyaruka/gocommon/i18n"
 	"github.com/nyaruka/gocommon/jsonx"
 	"github.com/nyaruka/gocommon/urns"
+	"github.com/nyaruka/gocommon/uuids"
 	"github.com/nyaruka/goflow/assets"
 	"github.com/nyaruka/goflow/core"
 	"github.com/nyaruka/goflow/core/events"
@@ -336,3 +339,178 @@ func TestSendBroadcastTask(t *testing.T) {
 		time.Sleep(5 * time.Millisecond)
 	}
 }
+
+func TestSendBroadcastExperiment(t *testing.T) {
+	ctx, rt := testsuite.Runtime(t)
+
+	oa, err := models.GetOrgAssets(ctx, rt, testdb.Org1.ID)
+	require.NoError(t, err)
+
+	a := &models.Variant{UUID: models.NewVariantUUID(), Name: "A", Percent: 50, Translations: core.BroadcastTranslations{"eng": {Text: "hello A"}}}
+	b := &models.Variant{UUID: models.NewVariantUUID(), Name: "B", Percent: 50, Translations: core.BroadcastTranslations{"eng": {Text: "hello B"}}}
+
+	bcast := models.NewBroadcast(oa.OrgID(), core.BroadcastTranslations{"eng": {Text: "hello"}}, "eng", false, []models.GroupID{testdb.DoctorsGroup.ID}, nil, nil, "", models.NoExclusions, testdb.Admin.ID)
+	bcast.Variants = []*models.Variant{a, b}
+	err = models.InsertBroadcast(ctx, rt.DB, bcast)
+	require.NoError(t, err)
+
+	err = tasks.Queue(ctx, rt, rt.Queues.Batch, testdb.Org1.ID, &tasks.SendBroadcast{Broadcast: bcast}, false)
+	require.NoError(t, err)
+
+	taskCounts := testsuite.FlushTasks(t, rt)
+	assert.GreaterOrEqual(t, taskCounts["send_broadcast_batch"], 2) // at least one batch per variant
+
+	// every contact in the group gets one of the variants and none get the base translations
+	assertdb.Query(t, rt.DB, `SELECT count(*) FROM msgs_msg WHERE broadcast_id = $1`, bcast.ID).Returns(121)
+	assertdb.Query(t, rt.DB, `SELECT count(*) FROM msgs_msg WHERE broadcast_id = $1 AND text = 'hello'`, bcast.ID).Returns(0)
+
+	// and the assignments are recorded
+	rt.Dynamo.Main.Flush()
+
+	exp, assignments, err := models.LoadExperiment(ctx, rt, testdb.Org1.ID, uuids.UUID(bcast.UUID))
+	require.NoError(t, err)
+	require.NotNil(t, exp)
+	assert.Len(t, exp.Variants, 2)
+	assert.Equal(t, 121, len(assignments[a.UUID])+len(assignments[b.UUID]))
+
+	assertdb.Query(t, rt.DB, `SELECT count(*) FROM msgs_msg WHERE broadcast_id = $1 AND text = 'hello A' AND contact_id = ANY($2)`, bcast.ID, pq.Array(assignments[a.UUID])).Returns(len(assignments[a.UUID]))
+	assertdb.Query(t, rt.DB, `SELECT count(*) FROM msgs_msg WHERE broadcast_id = $1 AND text = 'hello B' AND contact_id = ANY($2)`, bcast.ID, pq.Array(assignments[b.UUID])).Returns(len(assignments[b.UUID]))
+}
+
+func TestSendBroadcastOptimized(t *testing.T) {
+	ctx, rt := testsuite.Runtime(t)
+
+	oa, err := models.GetOrgAssets(ctx, rt, testdb.Org1.ID)
+	require.NoError(t, err)
+
+	// Ann is active in a few hours, Bob has never been seen
+	rt.DB.MustExec(`UPDATE contacts_contact SET last_seen_on = NOW() + INTERVAL '3 hours' WHERE id = $1`, testdb.Ann.ID)
+	rt.DB.MustExec(`UPDATE contacts_contact SET last_seen_on = NULL WHERE id = $1`, testdb.Bob.ID)
+
+	bcast := models.NewBroadcast(oa.OrgID(), core.BroadcastTranslations{"eng": {Text: "hello"}}, "eng", false, nil, []models.ContactID{testdb.Ann.ID, testdb.Bob.ID}, nil, "", models.NoExclusions, testdb.Admin.ID)
+	bcast.OptimizeWithin = 24
+	err = models.InsertBroadcast(ctx, rt.DB, bcast)
+	require.NoError(t, err)
+
+	err = tasks.Queue(ctx, rt, rt.Queues.Batch, testdb.Org1.ID, &tasks.SendBroadcast{Broadcast: bcast}, false)
+	require.NoError(t, err)
+
+	testsuite.FlushTasks(t, rt)
+
+	// Bob is sent to now, Ann's send is deferred so the broadcast isn't complete
+	assertdb.Query(t, rt.DB, `SELECT contact_id FROM msgs_msg WHERE broadcast_id = $1`, bcast.ID).Returns(int64(testdb.Bob.ID))
+	assertdb.Query(t, rt.DB, `SELECT count(*) FROM contacts_contactfire WHERE fire_type = 'B' AND contact_id = $1 AND fire_on > NOW()`, testdb.Ann.ID).Returns(1)
+	assertdb.Query(t, rt.DB, `SELECT status FROM msgs_broadcast WHERE id = $1`, bcast.ID).Returns("S")
+
+	// once Ann's send is fired, the broadcast is complete
+	rt.DB.MustExec(`DELETE FROM contacts_contactfire WHERE fire_type = 'B'`)
+
+	err = tasks.Queue(ctx, rt, rt.Queues.Throttled, testdb.Org1.ID, &tasks.SendBroadcastBatch{BroadcastBatch: models.CreateDeferredBatch(bcast.ID, "", []models.ContactID{testdb.Ann.ID}, false, false)}, true)
+	require.NoError(t, err)
+
+	testsuite.FlushTasks(t, rt)
+
+	assertdb.Query(t, rt.DB, `SELECT count(*) FROM msgs_msg WHERE broadcast_id = $1`, bcast.ID).Returns(2)
+	assertdb.Query(t, rt.DB, `SELECT status FROM msgs_broadcast WHERE id = $1`, bcast.ID).Returns("C")
+}
+
+func TestSendBroadcastOptimizedExperiment(t *testing.T) {
+	ctx, rt := testsuite.Runtime(t)
+
+	oa, err := models.GetOrgAssets(ctx, rt, testdb.Org1.ID)
+	require.NoError(t, err)
+
+	// Ann is active in a few hours, Bob has never been seen
+	rt.DB.MustExec(`UPDATE contacts_contact SET last_seen_on = NOW() + INTERVAL '3 hours' WHERE id = $1`, testdb.Ann.ID)
+	rt.DB.MustExec(`UPDATE contacts_contact SET last_seen_on = NULL WHERE id = $1`, testdb.Bob.ID)
+
+	a := &models.Variant{UUID: models.NewVariantUUID(), Name: "A", Percent: 50, Translations: core.BroadcastTranslations{"eng": {Text: "hello A"}}}
+	b := &models.Variant{UUID: models.NewVariantUUID(), Name: "B", Percent: 50, Translations: core.BroadcastTranslations{"eng": {Text: "hello B"}}}
+
+	bcast := models.NewBroadcast(oa.OrgID(), core.BroadcastTranslations{"eng": {Text: "hello"}}, "eng", false, nil, []models.ContactID{testdb.Ann.ID, testdb.Bob.ID}, nil, "", models.NoExclusions, testdb.Admin.ID)
+	bcast.Variants = []*models.Variant{a, b}
+	bcast.OptimizeWithin = 24
+	err = models.InsertBroadcast(ctx, rt.DB, bcast)
+	require.NoError(t, err)
+
+	err = tasks.Queue(ctx, rt, rt.Queues.Batch, testdb.Org1.ID, &tasks.SendBroadcast{Broadcast: bcast}, false)
+	require.NoError(t, err)
+
+	testsuite.FlushTasks(t, rt)
+
+	annVariant := a
+	if len(models.SplitVariants(uuids.UUID(bcast.UUID), bcast.Variants, []models.ContactID{testdb.Ann.ID})[1]) > 0 {
+		annVariant = b
+	}
+
+	// Ann's send is deferred with the variant Ann was assigned
+	assertdb.Query(t, rt.DB, `SELECT count(*) FROM msgs_msg WHERE broadcast_id = $1 AND contact_id = $2`, bcast.ID, testdb.Ann.ID).Returns(0)
+	assertdb.Query(t, rt.DB, `SELECT scope FROM contacts_contactfire WHERE fire_type = 'B' AND contact_id = $1`, testdb.Ann.ID).Returns(fmt.Sprintf("%d:%s", bcast.ID, annVariant.UUID))
+
+	// and once it's fired, Ann is sent that variant's content
+	rt.DB.MustExec(`DELETE FROM contacts_contactfire WHERE fire_type = 'B'`)
+
+	err = tasks.Queue(ctx, rt, rt.Queues.Throttled, testdb.Org1.ID, &tasks.SendBroadcastBatch{BroadcastBatch: models.CreateDeferredBatch(bcast.ID, annVariant.UUID, []models.ContactID{testdb.Ann.ID}, false, false)}, true)
+	require.NoError(t, err)
+
+	testsuite.FlushTasks(t, rt)
+
+	assertdb.Query(t, rt.DB, `SELECT text FROM msgs_msg WHERE broadcast_id = $1 AND contact_id = $2`, bcast.ID, testdb.Ann.ID).Returns("hello " + annVariant.Name)
+	assertdb.Query(t, rt.DB, `SELECT status FROM msgs_broadcast WHERE id = $1`, bcast.ID).Returns("C")
+}
+
+func TestSendBroadcastFrequencyCaps(t *testing.T) {
+	ctx, rt := testsuite.Runtime(t)
+
+	rt.DB.MustExec(`UPDATE orgs_org SET config = config || '{"frequency_caps": {"day": 1, "defer": true}}'::jsonb WHERE id = $1`, testdb.Org1.ID)
+
+	oa, err := models.GetOrgAssetsWithRefresh(ctx, rt, testdb.Org1.ID, models.RefreshOrg)
+	require.NoError(t, err)
+
+	// Ann has already been sent a message today
+	allowed, _, err := oa.Org().FrequencyCaps().Reserve(ctx, rt, oa, []models.ContactID{testdb.Ann.ID}, time.Now())
+	require.NoError(t, err)
+	assert.Len(t, allowed, 1)
+
+	bcast := models.NewBroadcast(oa.OrgID(), core.BroadcastTranslations{"eng": {Text: "hello"}}, "eng", false, nil, []models.ContactID{testdb.Ann.ID, testdb.Bob.ID, testdb.Cat.ID}, nil, "", models.NoExclusions, testdb.Admin.ID)
+	err = models.InsertBroadcast(ctx, rt.DB, bcast)
+	require.NoError(t, err)
+
+	err = tasks.Queue(ctx, rt, rt.Queues.Batch, testdb.Org1.ID, &tasks.SendBroadcast{Broadcast: bcast}, false)
+	require.NoError(t, err)
+
+	testsuite.FlushTasks(t, rt)
+
+	// Bob and Cat are sent the broadcast, Ann's send is deferred to tomorrow so the broadcast isn't complete
+	assertdb.Query(t, rt.DB, `SELECT count(*) FROM msgs_msg WHERE broadcast_id = $1 AND contact_id != $2`, bcast.ID, testdb.Ann.ID).Returns(2)
+	assertdb.Query(t, rt.DB, `SELECT count(*) FROM msgs_msg WHERE broadcast_id = $1 AND contact_id = $2`, bcast.ID, testdb.Ann.ID).Returns(0)
+	assertdb.Query(t, rt.DB, `SELECT count(*) FROM contacts_contactfire WHERE fire_type = 'B' AND contact_id = $1 AND fire_on > NOW()`, testdb.Ann.ID).Returns(1)
+	assertdb.Query(t, rt.DB, `SELECT status FROM msgs_broadcast WHERE id = $1`, bcast.ID).Returns("S")
+
+	capped, err := models.GetBroadcastCapped(ctx, rt.ReadonlyDB, bcast)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, capped)
+
+	// Ann's fire records that Ann has been counted as capped
+	assertdb.Query(t, rt.DB, `SELECT scope FROM contacts_contactfire WHERE fire_type = 'B' AND contact_id = $1`, testdb.Ann.ID).Returns(fmt.Sprintf("%d:capped", bcast.ID))
+
+	// if that deferred send is capped again, it's deferred again but not counted again
+	rt.DB.MustExec(`DELETE FROM contacts_contactfire WHERE contact_id = $1`, testdb.Ann.ID)
+
+	err = tasks.Queue(ctx, rt, rt.Queues.Throttled, testdb.Org1.ID, &tasks.SendBroadcastBatch{BroadcastBatch: models.CreateDeferredBatch(bcast.ID, "", []models.ContactID{testdb.Ann.ID}, false, true)}, true)
+	require.NoError(t, err)
+
+	testsuite.FlushTasks(t, rt)
+
+	assertdb.Query(t, rt.DB, `SELECT count(*) FROM contacts_contactfire WHERE fire_type = 'B' AND contact_id = $1 AND fire_on > NOW()`, testdb.Ann.ID).Returns(1)
+	assertdb.Query(t, rt.DB, `SELECT status FROM msgs_broadcast WHERE id = $1`, bcast.ID).Returns("S")
+
+	capped, err = models.GetBroadcastCapped(ctx, rt.ReadonlyDB, bcast)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, capped)
+
+	// and Bob and Cat have reached the cap now too
+	_, cappedIDs, err := oa.Org().FrequencyCaps().Reserve(ctx, rt, oa, []models.ContactID{testdb.Ann.ID, testdb.Bob.ID, testdb.Cat.ID}, time.Now())
+	require.NoError(t, err)
+	assert.Equal(t, []models.ContactID{testdb.Ann.ID, testdb.Bob.ID, testdb.Cat.ID}, cappedIDs)
+}
@@ -4,7 +4,6 @@ import (
 	"context"
 	"fmt"
 	"log/slog"
-	"slices"
 	"time"
 
 	"github.com/nyaruka/gocommon/dates"
@@ -80,6 +79,8 @@ func createFlowStartBatches(ctx context.Context, rt *runtime.Runtime, oa *models
 		limit := -1
 		if string(start.Query) != "" && start.StartType == models.StartTypeFlowAction {
 			limit = 1
+		} else if start.Limit > 0 {
+			limit = start.Limit
 		}
 
 		// created contacts don't need explicit indexing here because starting them in a flow will index them
@@ -115,8 +116,11 @@ func createFlowStartBatches(ctx context.Context, rt *runtime.Runtime, oa *models
 		q = rt.Queues.Realtime
 	}
 
-	// split the contact ids into batches to become batch tasks
-	idBatches := slices.Collect(slices.Chunk(contactIDs, FlowStartBatchSize))
+	// split the contact ids into batches to become batch tasks, splitting them between variants if this is an experiment
+	idBatches, variants, err := splitVariantBatches(ctx, rt, start.OrgID, start.UUID, start.Variants, contactIDs, FlowStartBatchSize)
+	if err != nil {
+		return err
+	}
 
 	RecordQueued(ctx, rt, start.UUID, &BatchInfo{
 		Type:     TypeStartFlowBatch,
@@ -129,7 +133,7 @@ func createFlowStartBatches(ctx context.Context, rt *runtime.Runtime, oa *models
 	for i, idBatch := range idBatches {
 		batchTask := &StartFlowBatch{
 			BatchTask:      BatchTask{BatchOwnerUUID: start.UUID, TotalBatches: len(idBatches)},
-			FlowStartBatch: start.CreateBatch(idBatch, len(contactIDs)),
+			FlowStartBatch: start.CreateBatch(idBatch, len(contactIDs), variants[i]),
 		}
 
 		if err := Queue(ctx, rt, q, start.OrgID, batchTask, false); err != nil {
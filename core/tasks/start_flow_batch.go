@@ -90,9 +90,15 @@ func (t *StartFlowBatch) Perform(ctx context.Context, rt *runtime.Runtime, oa *m
 }
 
 func (t *StartFlowBatch) start(ctx context.Context, rt *runtime.Runtime, oa *models.OrgAssets, start *models.FlowStart) error {
-	flow, err := oa.FlowByID(start.FlowID)
+	// if this batch is for a variant of an experiment, it may start a different flow
+	flowID := start.FlowID
+	if t.Variant != nil && t.Variant.FlowID != models.NilFlowID {
+		flowID = t.Variant.FlowID
+	}
+
+	flow, err := oa.FlowByID(flowID)
 	if err == models.ErrNotFound {
-		slog.Info("skipping flow start, flow no longer active or archived", "flow_id", start.FlowID)
+		slog.Info("skipping flow start, flow no longer active or archived", "flow_id", flowID)
 		return nil
 	}
 	if err != nil {
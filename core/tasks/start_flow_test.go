@@ -11,6 +11,7 @@ import (
 	"github.com/nyaruka/mailroom/v26/testsuite/testdb"
 	"github.com/nyaruka/mailroom/v26/utils/queues"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestStartFlowTask(t *testing.T) {
@@ -257,3 +258,39 @@ func TestStartFlowTaskNonPersistedStart(t *testing.T) {
 
 	assertdb.Query(t, rt.DB, `SELECT count(*) FROM flows_flowrun`).Returns(2)
 }
+
+func TestStartFlowTaskSmartStart(t *testing.T) {
+	ctx, rt := testsuite.Runtime(t)
+
+	testsuite.IndexContacts(t, rt)
+
+	// create a start like a scheduled trigger with a smart start creates, which is limited to 10 contacts
+	triggerID := testdb.InsertScheduledTrigger(t, rt, testdb.Org1, testdb.Favorites, models.NilScheduleID, nil, nil, nil)
+	start := models.NewFlowStart(testdb.Org1.ID, models.StartTypeTrigger, testdb.Favorites.ID).
+		WithQuery(`group = "Doctors"`).
+		WithExcludeInAFlow(true).
+		WithLimit(10)
+	start.TriggerID = triggerID
+
+	err := models.InsertFlowStart(ctx, rt.DB, start)
+	require.NoError(t, err)
+	err = models.InsertSmartStartLink(ctx, rt, start)
+	require.NoError(t, err)
+
+	err = tasks.Queue(ctx, rt, rt.Queues.Batch, testdb.Org1.ID, &tasks.StartFlow{FlowStart: start}, false)
+	require.NoError(t, err)
+
+	taskCounts := testsuite.FlushTasks(t, rt)
+	assert.Equal(t, 1, taskCounts["start_flow_batch"])
+
+	assertdb.Query(t, rt.DB, `SELECT count(*) FROM flows_flowrun WHERE flow_id = $1 AND start_id = $2`, testdb.Favorites.ID, start.ID).Returns(10)
+	assertdb.Query(t, rt.DB, `SELECT contact_count FROM flows_flowstart WHERE id = $1`, start.ID).Returns(10)
+
+	// and the fire should be reported from the start with the number of contacts resolved
+	fires, err := models.GetSmartStartFires(ctx, rt, testdb.Org1.ID, triggerID)
+	require.NoError(t, err)
+	if assert.Len(t, fires, 1) {
+		assert.Equal(t, start.UUID, fires[0].StartUUID)
+		assert.Equal(t, 10, fires[0].Count)
+	}
+}
@@ -26,6 +26,7 @@ require (
 	github.com/nyaruka/gocommon v1.93.1
 	github.com/nyaruka/goflow v0.293.0
 	github.com/nyaruka/null/v3 v3.0.0
+	github.com/nyaruka/phonenumbers/v2 v2.0.7
 	github.com/nyaruka/vkutil v0.22.0
 	github.com/openai/openai-go/v3 v3.50.0
 	github.com/prometheus/client_model v0.6.2
@@ -109,7 +110,6 @@ require (
 	github.com/munnerz/goautoneg v0.0.0-20191010083416-a7dc8b61c822 // indirect
 	github.com/naoina/go-stringutil v0.1.0 // indirect
 	github.com/naoina/toml v0.1.1 // indirect
-	github.com/nyaruka/phonenumbers/v2 v2.0.7 // indirect
 	github.com/pb33f/ordered-map/v2 v2.3.1 // indirect
 	github.com/planetscale/vtprotobuf v0.6.1-0.20240319094008-0393e58bdf10 // indirect
 	github.com/pmezard/go-difflib v1.0.1-0.20181226105442-5d4384ee4fb2 // indirect
@@ -62,6 +62,7 @@ type Config struct {
 
 	S3Endpoint          string `help:"S3 service endpoint, e.g. https://s3.amazonaws.com"`
 	S3AttachmentsBucket string `help:"S3 bucket to write attachments to"`
+	S3ExportsBucket     string `help:"private S3 bucket to write exports to and read imports from"`
 	S3PathStyle         bool   `help:"S3 should use path style URLs"`
 
 	CourierEndpoint  string `help:"the base URL used for internal calls to courier" validate:"url"`
@@ -77,19 +78,24 @@ type Config struct {
 	MetricsReporting    string `validate:"eq=off|eq=basic|eq=advanced"     help:"the level of metrics reporting"`
 	CloudwatchNamespace string `help:"the namespace to use for cloudwatch metrics"`
 	DeploymentID        string `help:"the deployment identifier to use for metrics"`
+	DevRoutes           bool   `help:"whether to serve routes for simulating provider callbacks, which should only be enabled for local development"`
 
 	AndroidCredentialsFile string `help:"path to JSON file with FCM service account credentials used to sync Android relayers"`
 	IDObfuscationKey       string `help:"key used to decode obfuscated IDs, as 4 comma separated integers" validate:"omitempty,hexadecimal,len=32"`
+	FieldsEncryptionKey    string `help:"key used to derive the per-org keys which encrypt sensitive contact field values, as 64 hex characters" validate:"omitempty,hexadecimal,len=64"`
+	FieldsEncryptionKeyOld string `help:"previous fields encryption key, which values can still be decrypted with until they're re-encrypted" validate:"omitempty,hexadecimal,len=64"`
 
 	LogLevel slog.Level `help:"the logging level courier should use"`
 	UUIDSeed int        `help:"seed to use for UUID generation in a testing environment"`
 	Version  string     `help:"the version of this mailroom install"`
 
 	// parsed values that can't be set directly
-	DisallowedIPs          []net.IP
-	DisallowedNets         []*net.IPNet
-	IDObfuscationKeyParsed [4]uint32
-	WebhookProxyURLParsed  *url.URL
+	DisallowedIPs                []net.IP
+	DisallowedNets               []*net.IPNet
+	IDObfuscationKeyParsed       [4]uint32
+	FieldsEncryptionKeyParsed    []byte
+	FieldsEncryptionKeyOldParsed []byte
+	WebhookProxyURLParsed        *url.URL
 }
 
 // NewDefaultConfig returns a new default configuration object
@@ -136,12 +142,16 @@ func NewDefaultConfig() *Config {
 
 		S3Endpoint:          "https://s3.amazonaws.com",
 		S3AttachmentsBucket: "temba-attachments",
+		S3ExportsBucket:     "temba-exports",
 
 		MetricsReporting:    "off",
 		CloudwatchNamespace: "Mailroom",
 		DeploymentID:        "dev",
+		DevRoutes:           false,
 
-		IDObfuscationKey: "000A3B1C000D2E3F0001A2B300C0FFEE",
+		IDObfuscationKey:       "000A3B1C000D2E3F0001A2B300C0FFEE",
+		FieldsEncryptionKey:    "",
+		FieldsEncryptionKeyOld: "",
 
 		LogLevel: slog.LevelWarn,
 		UUIDSeed: 0,
@@ -199,6 +209,14 @@ func (c *Config) Parse() error {
 	}
 	c.IDObfuscationKeyParsed = key
 
+	// parse our fields encryption keys
+	if c.FieldsEncryptionKeyParsed, err = hex.DecodeString(c.FieldsEncryptionKey); err != nil {
+		return fmt.Errorf("invalid hex string: %v", err)
+	}
+	if c.FieldsEncryptionKeyOldParsed, err = hex.DecodeString(c.FieldsEncryptionKeyOld); err != nil {
+		return fmt.Errorf("invalid hex string: %v", err)
+	}
+
 	return nil
 }
 
@@ -92,3 +92,21 @@ func TestIDObfuscationKeyParsing(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, [4]uint32{0xFFFFFFFF, 0xFFFFFFFF, 0xFFFFFFFF, 0xFFFFFFFF}, cfg.IDObfuscationKeyParsed)
 }
+
+func TestFieldsEncryptionKeyParsing(t *testing.T) {
+	cfg, err := runtime.LoadConfig(runtime.NewDefaultConfig(), "--log-level=warn")
+	assert.NoError(t, err)
+	assert.Len(t, cfg.FieldsEncryptionKeyParsed, 0)
+
+	cfg, err = runtime.LoadConfig(runtime.NewDefaultConfig(), "--fields-encryption-key=5E0F1C2D3B4A59687786950A1B2C3D4E5F60718293A4B5C6D7E8F90112233445")
+	assert.NoError(t, err)
+	assert.Len(t, cfg.FieldsEncryptionKeyParsed, 32)
+	assert.Len(t, cfg.FieldsEncryptionKeyOldParsed, 0)
+
+	cfg, err = runtime.LoadConfig(runtime.NewDefaultConfig(), "--fields-encryption-key=5E0F1C2D3B4A59687786950A1B2C3D4E5F60718293A4B5C6D7E8F90112233445", "--fields-encryption-key-old=00112233445566778899AABBCCDDEEFF00112233445566778899AABBCCDDEEFF")
+	assert.NoError(t, err)
+	assert.Len(t, cfg.FieldsEncryptionKeyOldParsed, 32)
+
+	_, err = runtime.LoadConfig(runtime.NewDefaultConfig(), "--fields-encryption-key=1234")
+	assert.Error(t, err)
+}
@@ -202,6 +202,17 @@ func (c *Client) ConfirmTransaction(ctx context.Context, transactionID int64) (*
 	return response, trace, nil
 }
 
+// Transaction fetches a previously-created transaction, see
+// https://dvs-api-doc.dtone.com/#tag/Transactions/operation/getTransactionById
+func (c *Client) Transaction(ctx context.Context, transactionID int64) (*Transaction, *httpx.Trace, error) {
+	var response *Transaction
+	trace, err := c.request(ctx, "GET", fmt.Sprintf("transactions/%d", transactionID), nil, &response)
+	if err != nil {
+		return nil, trace, err
+	}
+	return response, trace, nil
+}
+
 func (c *Client) request(ctx context.Context, method, endpoint string, payload any, response any) (*httpx.Trace, error) {
 	endpointURL := apiURL + endpoint
 	headers := map[string]string{}
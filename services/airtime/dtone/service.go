@@ -16,6 +16,18 @@ import (
 	"github.com/shopspring/decimal"
 )
 
+// statusNames maps status classes to the provider-neutral names of transfer statuses
+var statusNames = map[StatusCID]string{
+	StatusCIDCreated:   "created",
+	StatusCIDConfirmed: "confirmed",
+	StatusCIDSubmitted: "submitted",
+	StatusCIDCompleted: "completed",
+	StatusCIDReversed:  "reversed",
+	StatusCIDRejected:  "rejected",
+	StatusCIDCancelled: "cancelled",
+	StatusCIDDeclined:  "declined",
+}
+
 type service struct {
 	client      *Client
 	redactor    stringsx.Redactor
@@ -135,3 +147,26 @@ func (s *service) Confirm(ctx context.Context, transfer *core.AirtimeTransfer, l
 	}
 	return nil
 }
+
+// CheckStatus fetches the current status of the transaction with the given id for reconciling transfers whose status
+// callbacks we never received.
+func (s *service) CheckStatus(ctx context.Context, externalID string, logHTTP core.HTTPLogCallback) (string, error) {
+	txID, err := strconv.ParseInt(externalID, 10, 64)
+	if err != nil {
+		return "", fmt.Errorf("invalid transaction id %q: %w", externalID, err)
+	}
+
+	tx, trace, err := s.client.Transaction(ctx, txID)
+	if trace != nil {
+		logHTTP(core.NewHTTPLog(trace, core.HTTPStatusFromCode, s.redactor))
+	}
+	if err != nil {
+		return "", fmt.Errorf("transaction fetch failed: %w", err)
+	}
+
+	status, ok := statusNames[tx.Status.Class.ID]
+	if !ok {
+		return "", fmt.Errorf("transaction has unknown status class %d", tx.Status.Class.ID)
+	}
+	return status, nil
+}
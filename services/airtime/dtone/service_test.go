@@ -120,3 +120,34 @@ func TestServiceConfirm(t *testing.T) {
 
 	assert.False(t, mocks.HasUnused())
 }
+
+func TestServiceCheckStatus(t *testing.T) {
+	ctx := context.Background()
+
+	reset := test.MockUniverse()
+	defer reset()
+
+	client, mocks := test.MockedHTTP(map[string][]*httpx.MockResponse{
+		"https://dvs-api.dtone.com/v1/transactions/2237512891": {
+			httpx.NewMockResponse(200, nil, []byte(transactionConfirmedResponse)),
+			httpx.NewMockResponse(404, nil, errorResp(1003001, "Transaction not found")),
+		},
+	})
+	svc := dtone.NewService(client, nil, "key123", "sesame", callbackURL).(interface {
+		CheckStatus(context.Context, string, core.HTTPLogCallback) (string, error)
+	})
+
+	logger := &core.HTTPLogger{}
+	status, err := svc.CheckStatus(ctx, "2237512891", logger.Log)
+	assert.NoError(t, err)
+	assert.Equal(t, "confirmed", status)
+	assert.Len(t, logger.Logs, 1)
+
+	_, err = svc.CheckStatus(ctx, "2237512891", logger.Log)
+	assert.EqualError(t, err, "transaction fetch failed: Transaction not found")
+
+	_, err = svc.CheckStatus(ctx, "not-an-int", logger.Log)
+	assert.ErrorContains(t, err, `invalid transaction id "not-an-int"`)
+
+	assert.False(t, mocks.HasUnused())
+}
@@ -0,0 +1,224 @@
+package reloadly
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/nyaruka/gocommon/dates"
+	"github.com/nyaruka/gocommon/httpx"
+	"github.com/nyaruka/gocommon/jsonx"
+	"github.com/nyaruka/mailroom/v26/utils"
+	"github.com/shopspring/decimal"
+)
+
+type Status string
+
+const (
+	authURL     = "https://auth.reloadly.com/oauth/token"
+	apiURL      = "https://topups.reloadly.com/"
+	apiAudience = "https://topups.reloadly.com"
+	apiAccept   = "application/com.reloadly.topups-v1+json"
+
+	// see https://docs.reloadly.com/airtime/transactions/topup-status
+	StatusPending    Status = "PENDING"
+	StatusProcessing Status = "PROCESSING"
+	StatusSuccessful Status = "SUCCESSFUL"
+	StatusRefunded   Status = "REFUNDED"
+	StatusFailed     Status = "FAILED"
+
+	DenominationFixed = "FIXED"
+	DenominationRange = "RANGE"
+)
+
+// Client is a Reloadly airtime client, see https://docs.reloadly.com/airtime for API docs
+type Client struct {
+	httpClient   *http.Client
+	clientID     string
+	clientSecret string
+
+	token        string
+	tokenExpires time.Time
+}
+
+// NewClient creates a new Reloadly client. As with the DT One client, retries are composed inside a tracer on a copy
+// of the given client so that the number of retries performed ends up on each trace.
+func NewClient(httpClient *http.Client, httpRetries *httpx.RetryConfig, clientID, clientSecret string) *Client {
+	traced := *httpClient
+	traced.Transport = httpx.WithTraces(httpx.WithRetries(httpClient.Transport, httpRetries))
+
+	return &Client{httpClient: &traced, clientID: clientID, clientSecret: clientSecret}
+}
+
+// error response returned when a request fails
+type errorResponse struct {
+	ErrorCode string `json:"errorCode"`
+	Message   string `json:"message"`
+}
+
+func (e *errorResponse) Error() string {
+	return e.Message
+}
+
+// Token returns the current access token, or empty if we haven't authenticated yet
+func (c *Client) Token() string {
+	return c.token
+}
+
+// Authenticate fetches a new access token if we don't have one or the one we have has expired. If no request was
+// necessary the returned trace is nil. See https://docs.reloadly.com/airtime/authentication
+func (c *Client) Authenticate(ctx context.Context) (*httpx.Trace, error) {
+	if c.token != "" && dates.Now().Before(c.tokenExpires) {
+		return nil, nil
+	}
+
+	payload := &struct {
+		ClientID     string `json:"client_id"`
+		ClientSecret string `json:"client_secret"`
+		GrantType    string `json:"grant_type"`
+		Audience     string `json:"audience"`
+	}{
+		ClientID:     c.clientID,
+		ClientSecret: c.clientSecret,
+		GrantType:    "client_credentials",
+		Audience:     apiAudience,
+	}
+	response := &struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}{}
+
+	trace, err := c.request(ctx, "POST", authURL, payload, response)
+	if err != nil {
+		return trace, err
+	}
+
+	// give ourselves a minute of leeway so we don't use a token which expires mid-request
+	c.token = response.AccessToken
+	c.tokenExpires = dates.Now().Add(time.Duration(response.ExpiresIn)*time.Second - time.Minute)
+
+	return trace, nil
+}
+
+// Operator is a mobile operator along with the amounts it can be topped up with
+type Operator struct {
+	ID                      int               `json:"operatorId"`
+	Name                    string            `json:"name"`
+	DenominationType        string            `json:"denominationType"`
+	SupportsLocalAmounts    bool              `json:"supportsLocalAmounts"`
+	DestinationCurrencyCode string            `json:"destinationCurrencyCode"`
+	LocalMinAmount          decimal.Decimal   `json:"localMinAmount"`
+	LocalMaxAmount          decimal.Decimal   `json:"localMaxAmount"`
+	LocalFixedAmounts       []decimal.Decimal `json:"localFixedAmounts"`
+	Country                 struct {
+		ISOName string `json:"isoName"`
+		Name    string `json:"name"`
+	} `json:"country"`
+}
+
+// AutoDetectOperator see https://docs.reloadly.com/airtime/operators/auto-detect-operator
+func (c *Client) AutoDetectOperator(ctx context.Context, phoneNumber, countryCode string) (*Operator, *httpx.Trace, error) {
+	response := &Operator{}
+
+	trace, err := c.request(ctx, "GET", fmt.Sprintf("%soperators/auto-detect/phone/%s/countries/%s", apiURL, url.PathEscape(phoneNumber), countryCode), nil, response)
+	if err != nil {
+		return nil, trace, err
+	}
+
+	return response, trace, nil
+}
+
+// TopupAsync see https://docs.reloadly.com/airtime/top-ups/make-asynchronous-top-up. Amounts are always given in
+// the operator's local currency. Unlike DT One there is no held state - the topup is sent as soon as it's accepted.
+func (c *Client) TopupAsync(ctx context.Context, customIdentifier string, operatorID int, amount decimal.Decimal, phoneNumber, countryCode string) (int64, *httpx.Trace, error) {
+	type phone struct {
+		CountryCode string `json:"countryCode"`
+		Number      string `json:"number"`
+	}
+
+	payload := &struct {
+		OperatorID       int             `json:"operatorId"`
+		Amount           decimal.Decimal `json:"amount"`
+		UseLocalAmount   bool            `json:"useLocalAmount"`
+		CustomIdentifier string          `json:"customIdentifier"`
+		RecipientPhone   phone           `json:"recipientPhone"`
+	}{
+		OperatorID:       operatorID,
+		Amount:           amount,
+		UseLocalAmount:   true,
+		CustomIdentifier: customIdentifier,
+		RecipientPhone:   phone{CountryCode: countryCode, Number: phoneNumber},
+	}
+	response := &struct {
+		TransactionID int64 `json:"transactionId"`
+	}{}
+
+	trace, err := c.request(ctx, "POST", apiURL+"topups-async", payload, response)
+	if err != nil {
+		return 0, trace, err
+	}
+
+	return response.TransactionID, trace, nil
+}
+
+// TopupStatus see https://docs.reloadly.com/airtime/transactions/topup-status
+func (c *Client) TopupStatus(ctx context.Context, transactionID int64) (Status, *httpx.Trace, error) {
+	response := &struct {
+		Status Status `json:"status"`
+	}{}
+
+	trace, err := c.request(ctx, "GET", fmt.Sprintf("%stopups/%d/status", apiURL, transactionID), nil, response)
+	if err != nil {
+		return "", trace, err
+	}
+
+	return response.Status, trace, nil
+}
+
+func (c *Client) request(ctx context.Context, method, endpointURL string, payload any, response any) (*httpx.Trace, error) {
+	headers := map[string]string{}
+	var body io.Reader
+
+	if payload != nil {
+		data, err := jsonx.Marshal(payload)
+		if err != nil {
+			return nil, err
+		}
+		body = bytes.NewReader(data)
+		headers["Content-Type"] = "application/json"
+	}
+
+	// everything but the token request itself goes to the API and needs our token
+	if endpointURL != authURL {
+		headers["Accept"] = apiAccept
+		headers["Authorization"] = "Bearer " + c.token
+	}
+
+	req, err := httpx.NewRequest(ctx, method, endpointURL, body, headers)
+	if err != nil {
+		return nil, err
+	}
+
+	trace, _, err := utils.DoTraced(c.httpClient, req)
+	if err != nil {
+		return trace, err
+	}
+
+	if trace.Response.StatusCode >= 400 {
+		response := &errorResponse{}
+		jsonx.Unmarshal(trace.ResponseBody, response)
+		if response.Message == "" {
+			response.Message = fmt.Sprintf("unexpected response status %d", trace.Response.StatusCode)
+		}
+		return trace, response
+	}
+
+	if response != nil {
+		return trace, jsonx.Unmarshal(trace.ResponseBody, response)
+	}
+	return trace, nil
+}
@@ -0,0 +1,162 @@
+package reloadly_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/nyaruka/gocommon/dates"
+	"github.com/nyaruka/gocommon/httpx"
+	"github.com/nyaruka/goflow/test"
+	"github.com/nyaruka/mailroom/v26/services/airtime/reloadly"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+)
+
+var tokenResponse = `{
+	"access_token": "eyJraWQiOiI1N2JjZjNhNy01YmYwLTQ1M2QtODQ0Mi03ODhlMTA4OWI3MDIiLCJhbGciOiJSUzI1NiJ9",
+	"scope": "send-topups read-operators read-promotions read-topups-history read-prepaid-balance read-prepaid-commissions",
+	"expires_in": 5184000,
+	"token_type": "Bearer"
+}`
+
+var fixedOperatorResponse = `{
+	"id": 344,
+	"operatorId": 344,
+	"name": "MTN Rwanda",
+	"bundle": false,
+	"data": false,
+	"pin": false,
+	"supportsLocalAmounts": true,
+	"denominationType": "FIXED",
+	"senderCurrencyCode": "USD",
+	"senderCurrencySymbol": "$",
+	"destinationCurrencyCode": "RWF",
+	"destinationCurrencySymbol": "FRw",
+	"commission": 4.42,
+	"internationalDiscount": 4.42,
+	"localDiscount": 0,
+	"mostPopularAmount": null,
+	"minAmount": null,
+	"maxAmount": null,
+	"localMinAmount": null,
+	"localMaxAmount": null,
+	"country": {"isoName": "RW", "name": "Rwanda"},
+	"fx": {"rate": 1150.5, "currencyCode": "RWF"},
+	"logoUrls": [],
+	"fixedAmounts": [0.09, 0.44, 0.87],
+	"fixedAmountsDescriptions": {},
+	"localFixedAmounts": [100, 500, 1000],
+	"localFixedAmountsDescriptions": {},
+	"suggestedAmounts": [],
+	"suggestedAmountsMap": {},
+	"promotions": []
+}`
+
+var rangeOperatorResponse = `{
+	"id": 345,
+	"operatorId": 345,
+	"name": "Airtel Rwanda",
+	"supportsLocalAmounts": true,
+	"denominationType": "RANGE",
+	"senderCurrencyCode": "USD",
+	"destinationCurrencyCode": "RWF",
+	"minAmount": 0.05,
+	"maxAmount": 40,
+	"localMinAmount": 50,
+	"localMaxAmount": 50000,
+	"country": {"isoName": "RW", "name": "Rwanda"},
+	"fixedAmounts": [],
+	"localFixedAmounts": []
+}`
+
+var topupAsyncResponse = `{"transactionId": 4602843}`
+
+var topupStatusResponse = `{
+	"code": null,
+	"message": null,
+	"status": "SUCCESSFUL",
+	"transaction": {
+		"transactionId": 4602843,
+		"status": "SUCCESSFUL",
+		"operatorTransactionId": "7297929551:7297929551",
+		"customIdentifier": "01970fa4-1e58-79d5-bca8-1234567890ab",
+		"recipientPhone": "250788123456",
+		"countryCode": "RW",
+		"operatorId": 344,
+		"operatorName": "MTN Rwanda",
+		"requestedAmount": 100,
+		"requestedAmountCurrencyCode": "RWF",
+		"deliveredAmount": 100,
+		"deliveredAmountCurrencyCode": "RWF",
+		"transactionDate": "2026-10-09 10:25:30"
+	}
+}`
+
+func TestClient(t *testing.T) {
+	ctx := context.Background()
+
+	defer dates.SetNowFunc(time.Now)
+	dates.SetNowFunc(dates.NewSequentialNow(time.Date(2026, 10, 9, 15, 25, 30, 123456789, time.UTC), time.Second))
+
+	client, mocks := test.MockedHTTP(map[string][]*httpx.MockResponse{
+		"https://auth.reloadly.com/oauth/token": {
+			httpx.NewMockResponse(401, nil, []byte(`{"errorCode": "INVALID_CREDENTIALS", "message": "Access Denied"}`)),
+			httpx.NewMockResponse(200, nil, []byte(tokenResponse)),
+		},
+		"https://topups.reloadly.com/operators/auto-detect/phone/788123456/countries/RW": {
+			httpx.NewMockResponse(200, nil, []byte(fixedOperatorResponse)),
+			httpx.NewMockResponse(404, nil, []byte(`{"errorCode": "COULD_NOT_AUTO_DETECT_OPERATOR", "message": "Could not auto detect operator"}`)),
+		},
+		"https://topups.reloadly.com/topups-async": {
+			httpx.NewMockResponse(200, nil, []byte(topupAsyncResponse)),
+		},
+		"https://topups.reloadly.com/topups/4602843/status": {
+			httpx.NewMockResponse(200, nil, []byte(topupStatusResponse)),
+			httpx.NewMockResponse(500, nil, []byte(`oops`)),
+		},
+	})
+
+	cl := reloadly.NewClient(client, nil, "id123", "sesame")
+
+	// bad credentials
+	trace, err := cl.Authenticate(ctx)
+	assert.EqualError(t, err, "Access Denied")
+	assert.NotNil(t, trace)
+	assert.Equal(t, "", cl.Token())
+
+	trace, err = cl.Authenticate(ctx)
+	assert.NoError(t, err)
+	assert.NotNil(t, trace)
+	assert.Equal(t, "eyJraWQiOiI1N2JjZjNhNy01YmYwLTQ1M2QtODQ0Mi03ODhlMTA4OWI3MDIiLCJhbGciOiJSUzI1NiJ9", cl.Token())
+
+	// token is still valid so no request is made
+	trace, err = cl.Authenticate(ctx)
+	assert.NoError(t, err)
+	assert.Nil(t, trace)
+
+	operator, trace, err := cl.AutoDetectOperator(ctx, "788123456", "RW")
+	assert.NoError(t, err)
+	assert.Equal(t, 344, operator.ID)
+	assert.Equal(t, "MTN Rwanda", operator.Name)
+	assert.Equal(t, reloadly.DenominationFixed, operator.DenominationType)
+	assert.Equal(t, "RWF", operator.DestinationCurrencyCode)
+	assert.Len(t, operator.LocalFixedAmounts, 3)
+	assert.Equal(t, "Bearer eyJraWQiOiI1N2JjZjNhNy01YmYwLTQ1M2QtODQ0Mi03ODhlMTA4OWI3MDIiLCJhbGciOiJSUzI1NiJ9", trace.Request.Header.Get("Authorization"))
+
+	_, _, err = cl.AutoDetectOperator(ctx, "788123456", "RW")
+	assert.EqualError(t, err, "Could not auto detect operator")
+
+	txID, _, err := cl.TopupAsync(ctx, "01970fa4-1e58-79d5-bca8-1234567890ab", 344, decimal.RequireFromString("100"), "788123456", "RW")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(4602843), txID)
+
+	status, _, err := cl.TopupStatus(ctx, 4602843)
+	assert.NoError(t, err)
+	assert.Equal(t, reloadly.StatusSuccessful, status)
+
+	_, _, err = cl.TopupStatus(ctx, 4602843)
+	assert.EqualError(t, err, "unexpected response status 500")
+
+	assert.False(t, mocks.HasUnused())
+}
@@ -0,0 +1,195 @@
+package reloadly
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/nyaruka/gocommon/httpx"
+	"github.com/nyaruka/gocommon/stringsx"
+	"github.com/nyaruka/gocommon/urns"
+	"github.com/nyaruka/goflow/core"
+	"github.com/nyaruka/goflow/core/events"
+	"github.com/nyaruka/goflow/flows"
+	"github.com/nyaruka/phonenumbers/v2"
+	"github.com/shopspring/decimal"
+)
+
+// statusNames maps topup statuses to the provider-neutral names of transfer statuses
+var statusNames = map[Status]string{
+	StatusPending:    "submitted",
+	StatusProcessing: "submitted",
+	StatusSuccessful: "completed",
+	StatusRefunded:   "reversed",
+	StatusFailed:     "rejected",
+}
+
+// the prefix of the external ids of transfers which have been created but whose topups haven't yet been submitted
+const reservationPrefix = "reserved:"
+
+type service struct {
+	client       *Client
+	clientSecret string
+}
+
+// NewService creates a new Reloadly airtime service. Reloadly status callbacks are configured per account in their
+// dashboard rather than per transaction, so unlike DT One there's no callback URL to pass in here.
+func NewService(httpClient *http.Client, httpRetries *httpx.RetryConfig, clientID, clientSecret string) flows.AirtimeService {
+	return &service{
+		client:       NewClient(httpClient, httpRetries, clientID, clientSecret),
+		clientSecret: clientSecret,
+	}
+}
+
+// Create detects the operator for the recipient and picks an amount it supports in its local currency. Reloadly has no
+// held state, so nothing is sent to Reloadly here. Instead the returned ExternalID is a reservation which carries the
+// operator and transferUUID through to Confirm, which submits the topup once the host has committed the transfer.
+func (s *service) Create(ctx context.Context, transferUUID events.EventUUID, sender urns.URN, recipient urns.URN, amounts map[string]decimal.Decimal, logHTTP core.HTTPLogCallback) (*core.AirtimeTransfer, error) {
+	transfer := &core.AirtimeTransfer{
+		Sender:    sender,
+		Recipient: recipient,
+		Currency:  "",
+		Amount:    decimal.Zero,
+	}
+
+	number, country, err := parseRecipient(recipient)
+	if err != nil {
+		return transfer, err
+	}
+
+	trace, err := s.client.Authenticate(ctx)
+	s.log(trace, logHTTP)
+	if err != nil {
+		return transfer, fmt.Errorf("authentication failed: %w", err)
+	}
+
+	operator, trace, err := s.client.AutoDetectOperator(ctx, number, country)
+	s.log(trace, logHTTP)
+	if err != nil {
+		return transfer, fmt.Errorf("operator detection failed: %w", err)
+	}
+
+	amount, ok := amounts[operator.DestinationCurrencyCode]
+	if !ok || !operator.SupportsLocalAmounts || !operator.supportsAmount(amount) {
+		return transfer, fmt.Errorf("unable to find a suitable amount for operator '%s'", operator.Name)
+	}
+
+	transfer.Currency = operator.DestinationCurrencyCode
+	transfer.Amount = amount
+	transfer.ExternalID = fmt.Sprintf("%s%d:%s", reservationPrefix, operator.ID, transferUUID)
+	return transfer, nil
+}
+
+// Confirm submits the async topup for a transfer reserved by Create, using the transfer's recipient and amount. The
+// transferUUID is passed to Reloadly as our custom identifier so that status callbacks echo it back, and on success
+// the transfer's ExternalID is replaced with Reloadly's transaction id.
+func (s *service) Confirm(ctx context.Context, transfer *core.AirtimeTransfer, logHTTP core.HTTPLogCallback) error {
+	operatorID, transferUUID, err := parseReservation(transfer.ExternalID)
+	if err != nil {
+		return err
+	}
+
+	number, country, err := parseRecipient(transfer.Recipient)
+	if err != nil {
+		return err
+	}
+
+	trace, err := s.client.Authenticate(ctx)
+	s.log(trace, logHTTP)
+	if err != nil {
+		return fmt.Errorf("authentication failed: %w", err)
+	}
+
+	txID, trace, err := s.client.TopupAsync(ctx, transferUUID, operatorID, transfer.Amount, number, country)
+	s.log(trace, logHTTP)
+	if err != nil {
+		return fmt.Errorf("topup creation failed: %w", err)
+	}
+
+	transfer.ExternalID = strconv.FormatInt(txID, 10)
+	return nil
+}
+
+// CheckStatus fetches the current status of the topup with the given transaction id for reconciling transfers whose
+// webhooks we never received.
+func (s *service) CheckStatus(ctx context.Context, externalID string, logHTTP core.HTTPLogCallback) (string, error) {
+	if strings.HasPrefix(externalID, reservationPrefix) {
+		return "", fmt.Errorf("topup for reservation %s was never submitted", externalID)
+	}
+
+	txID, err := strconv.ParseInt(externalID, 10, 64)
+	if err != nil {
+		return "", fmt.Errorf("invalid transaction id %q: %w", externalID, err)
+	}
+
+	trace, err := s.client.Authenticate(ctx)
+	s.log(trace, logHTTP)
+	if err != nil {
+		return "", fmt.Errorf("authentication failed: %w", err)
+	}
+
+	status, trace, err := s.client.TopupStatus(ctx, txID)
+	s.log(trace, logHTTP)
+	if err != nil {
+		return "", fmt.Errorf("topup status fetch failed: %w", err)
+	}
+
+	name, ok := statusNames[status]
+	if !ok {
+		return "", fmt.Errorf("topup has unknown status %s", status)
+	}
+	return name, nil
+}
+
+// log records the given trace, if any, redacting our secret and the access token we authenticated with
+func (s *service) log(trace *httpx.Trace, logHTTP core.HTTPLogCallback) {
+	if trace == nil {
+		return
+	}
+
+	secrets := []string{s.clientSecret}
+	if s.client.Token() != "" {
+		secrets = append(secrets, s.client.Token())
+	}
+
+	logHTTP(core.NewHTTPLog(trace, core.HTTPStatusFromCode, stringsx.NewRedactor(core.RedactionMask, secrets...)))
+}
+
+// supportsAmount returns whether the given local amount can be sent to this operator
+func (o *Operator) supportsAmount(amount decimal.Decimal) bool {
+	switch o.DenominationType {
+	case DenominationFixed:
+		return slices.ContainsFunc(o.LocalFixedAmounts, amount.Equal)
+	case DenominationRange:
+		return amount.GreaterThanOrEqual(o.LocalMinAmount) && amount.LessThanOrEqual(o.LocalMaxAmount)
+	}
+	return false
+}
+
+// parseReservation parses the operator id and transfer UUID from the external id of a transfer returned by Create
+func parseReservation(externalID string) (int, string, error) {
+	operator, transferUUID, found := strings.Cut(strings.TrimPrefix(externalID, reservationPrefix), ":")
+	operatorID, err := strconv.Atoi(operator)
+	if !strings.HasPrefix(externalID, reservationPrefix) || !found || err != nil {
+		return 0, "", fmt.Errorf("invalid reservation %q", externalID)
+	}
+	return operatorID, transferUUID, nil
+}
+
+// parseRecipient parses the national number and country of the given recipient
+func parseRecipient(recipient urns.URN) (string, string, error) {
+	recipientPhone := recipient.Path()
+	if !strings.HasPrefix(recipientPhone, "+") {
+		recipientPhone = "+" + recipientPhone
+	}
+
+	parsed, err := phonenumbers.Parse(recipientPhone, "")
+	if err != nil {
+		return "", "", fmt.Errorf("unable to parse number %s: %w", recipientPhone, err)
+	}
+
+	return phonenumbers.GetNationalSignificantNumber(parsed), phonenumbers.GetRegionCodeForNumber(parsed), nil
+}
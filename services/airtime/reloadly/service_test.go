@@ -0,0 +1,164 @@
+package reloadly_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/nyaruka/gocommon/httpx"
+	"github.com/nyaruka/gocommon/urns"
+	"github.com/nyaruka/goflow/core"
+	"github.com/nyaruka/goflow/core/events"
+	"github.com/nyaruka/goflow/test"
+	"github.com/nyaruka/mailroom/v26/services/airtime/reloadly"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestServiceCreate(t *testing.T) {
+	ctx := context.Background()
+
+	reset := test.MockUniverse()
+	defer reset()
+
+	client, mocks := test.MockedHTTP(map[string][]*httpx.MockResponse{
+		"https://auth.reloadly.com/oauth/token": {
+			httpx.NewMockResponse(200, nil, []byte(tokenResponse)),
+		},
+		"https://topups.reloadly.com/operators/auto-detect/phone/788123456/countries/RW": {
+			httpx.NewMockResponse(200, nil, []byte(fixedOperatorResponse)),
+			httpx.NewMockResponse(200, nil, []byte(rangeOperatorResponse)),
+			httpx.NewMockResponse(200, nil, []byte(fixedOperatorResponse)),
+		},
+	})
+	svc := reloadly.NewService(client, nil, "id123", "sesame")
+	transferUUID := events.EventUUID("01970fa4-1e58-79d5-bca8-1234567890ab")
+
+	// success with an operator with fixed amounts — authenticates and detects operator but doesn't submit the topup
+	logger := &core.HTTPLogger{}
+	transfer, err := svc.Create(
+		ctx,
+		transferUUID,
+		urns.URN("tel:+250788000000"),
+		urns.URN("tel:+250788123456"),
+		map[string]decimal.Decimal{
+			"USD": decimal.RequireFromString("3"),
+			"RWF": decimal.RequireFromString("500"),
+		},
+		logger.Log,
+	)
+	assert.NoError(t, err)
+	assert.Equal(t, "reserved:344:01970fa4-1e58-79d5-bca8-1234567890ab", transfer.ExternalID)
+	assert.Equal(t, urns.URN("tel:+250788000000"), transfer.Sender)
+	assert.Equal(t, urns.URN("tel:+250788123456"), transfer.Recipient)
+	assert.Equal(t, "RWF", transfer.Currency)
+	assert.Equal(t, decimal.RequireFromString("500"), transfer.Amount)
+	assert.Equal(t, 2, len(logger.Logs))
+
+	// neither the secret nor the token should end up in the logs
+	for _, l := range logger.Logs {
+		assert.NotContains(t, l.Request, "sesame")
+		assert.NotContains(t, l.Request, "eyJraWQiOiI1N2JjZjNhNy01YmYwLTQ1M2QtODQ0Mi03ODhlMTA4OWI3MDIiLCJhbGciOiJSUzI1NiJ9")
+		assert.NotContains(t, l.Response, "eyJraWQiOiI1N2JjZjNhNy01YmYwLTQ1M2QtODQ0Mi03ODhlMTA4OWI3MDIiLCJhbGciOiJSUzI1NiJ9")
+	}
+
+	// success with an operator with a range of amounts, reusing our token
+	logger = &core.HTTPLogger{}
+	transfer, err = svc.Create(ctx, transferUUID, urns.NilURN, urns.URN("tel:+250788123456"), map[string]decimal.Decimal{"RWF": decimal.RequireFromString("1234")}, logger.Log)
+	assert.NoError(t, err)
+	assert.Equal(t, "reserved:345:01970fa4-1e58-79d5-bca8-1234567890ab", transfer.ExternalID)
+	assert.Equal(t, decimal.RequireFromString("1234"), transfer.Amount)
+	assert.Equal(t, 1, len(logger.Logs))
+
+	// no amount in the operator's currency
+	_, err = svc.Create(ctx, transferUUID, urns.NilURN, urns.URN("tel:+250788123456"), map[string]decimal.Decimal{"USD": decimal.RequireFromString("3")}, logger.Log)
+	assert.EqualError(t, err, "unable to find a suitable amount for operator 'MTN Rwanda'")
+
+	// unparseable number
+	_, err = svc.Create(ctx, transferUUID, urns.NilURN, urns.URN("tel:+0"), map[string]decimal.Decimal{"RWF": decimal.RequireFromString("100")}, logger.Log)
+	assert.ErrorContains(t, err, "unable to parse number +0")
+
+	assert.False(t, mocks.HasUnused())
+}
+
+func TestServiceConfirm(t *testing.T) {
+	ctx := context.Background()
+
+	reset := test.MockUniverse()
+	defer reset()
+
+	client, mocks := test.MockedHTTP(map[string][]*httpx.MockResponse{
+		"https://auth.reloadly.com/oauth/token": {
+			httpx.NewMockResponse(200, nil, []byte(tokenResponse)),
+		},
+		"https://topups.reloadly.com/topups-async": {
+			httpx.NewMockResponse(200, nil, []byte(topupAsyncResponse)),
+			httpx.NewMockResponse(400, nil, []byte(`{"errorCode": "INSUFFICIENT_BALANCE", "message": "Insufficient balance"}`)),
+		},
+	})
+	svc := reloadly.NewService(client, nil, "id123", "sesame")
+
+	reserved := func() *core.AirtimeTransfer {
+		return &core.AirtimeTransfer{
+			ExternalID: "reserved:341:01970fa4-1e58-79d5-bca8-1234567890ab",
+			Recipient:  urns.URN("tel:+250788123456"),
+			Currency:   "RWF",
+			Amount:     decimal.RequireFromString("500"),
+		}
+	}
+
+	// confirming submits the topup and replaces the reservation with Reloadly's transaction id
+	logger := &core.HTTPLogger{}
+	transfer := reserved()
+	err := svc.Confirm(ctx, transfer, logger.Log)
+	assert.NoError(t, err)
+	assert.Equal(t, "4602843", transfer.ExternalID)
+	assert.Len(t, logger.Logs, 2)
+	assert.Contains(t, logger.Logs[1].Request, `"customIdentifier":"01970fa4-1e58-79d5-bca8-1234567890ab"`)
+	assert.Contains(t, logger.Logs[1].Request, `"operatorId":341`)
+
+	// topup submission fails
+	transfer = reserved()
+	err = svc.Confirm(ctx, transfer, logger.Log)
+	assert.EqualError(t, err, "topup creation failed: Insufficient balance")
+	assert.Equal(t, "reserved:341:01970fa4-1e58-79d5-bca8-1234567890ab", transfer.ExternalID)
+
+	// not a reservation
+	err = svc.Confirm(ctx, &core.AirtimeTransfer{ExternalID: "4602843"}, logger.Log)
+	assert.EqualError(t, err, `invalid reservation "4602843"`)
+
+	assert.False(t, mocks.HasUnused())
+}
+
+func TestServiceCheckStatus(t *testing.T) {
+	ctx := context.Background()
+
+	reset := test.MockUniverse()
+	defer reset()
+
+	client, mocks := test.MockedHTTP(map[string][]*httpx.MockResponse{
+		"https://auth.reloadly.com/oauth/token": {
+			httpx.NewMockResponse(200, nil, []byte(tokenResponse)),
+		},
+		"https://topups.reloadly.com/topups/4602843/status": {
+			httpx.NewMockResponse(200, nil, []byte(topupStatusResponse)),
+			httpx.NewMockResponse(200, nil, []byte(`{"status": "EXPLODED"}`)),
+		},
+	})
+	svc := reloadly.NewService(client, nil, "id123", "sesame").(interface {
+		CheckStatus(context.Context, string, core.HTTPLogCallback) (string, error)
+	})
+
+	logger := &core.HTTPLogger{}
+	status, err := svc.CheckStatus(ctx, "4602843", logger.Log)
+	assert.NoError(t, err)
+	assert.Equal(t, "completed", status)
+	assert.Len(t, logger.Logs, 2)
+
+	_, err = svc.CheckStatus(ctx, "4602843", logger.Log)
+	assert.EqualError(t, err, "topup has unknown status EXPLODED")
+
+	_, err = svc.CheckStatus(ctx, "reserved:341:01970fa4-1e58-79d5-bca8-1234567890ab", logger.Log)
+	assert.EqualError(t, err, "topup for reservation reserved:341:01970fa4-1e58-79d5-bca8-1234567890ab was never submitted")
+
+	assert.False(t, mocks.HasUnused())
+}
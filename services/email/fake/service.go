@@ -0,0 +1,43 @@
+package fake
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+
+	"github.com/nyaruka/gocommon/uuids"
+)
+
+// prefix of the ids of messages sent by this service so that simulated events can't be recorded for real messages
+const messageIDPrefix = "fake-"
+
+// IsMessageID returns whether the given message id is one given out by this service
+func IsMessageID(messageID string) bool {
+	return strings.HasPrefix(messageID, messageIDPrefix)
+}
+
+// Service is a fake email service for local development which logs emails rather than sending them
+type Service struct {
+	from string
+}
+
+// NewService creates a new fake email service
+func NewService(from string) *Service {
+	return &Service{from: from}
+}
+
+// Send logs an email to the given addresses
+func (s *Service) Send(ctx context.Context, addresses []string, subject, body string) error {
+	_, err := s.SendMessage(ctx, addresses, subject, body)
+	return err
+}
+
+// SendMessage logs an email to the given addresses, returning a fake message id which can be used to simulate
+// delivery events
+func (s *Service) SendMessage(ctx context.Context, addresses []string, subject, body string) (string, error) {
+	messageID := messageIDPrefix + string(uuids.NewV7())
+
+	slog.Info("fake email sent", "message_id", messageID, "from", s.from, "to", addresses, "subject", subject, "body", body)
+
+	return messageID, nil
+}
@@ -0,0 +1,87 @@
+package mailgun
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/nyaruka/gocommon/httpx"
+	"github.com/nyaruka/gocommon/jsonx"
+	"github.com/nyaruka/mailroom/v26/utils"
+)
+
+const (
+	apiURL   = "https://api.mailgun.net/v3/"
+	apiURLEU = "https://api.eu.mailgun.net/v3/"
+)
+
+// Service is a Mailgun email service, see https://documentation.mailgun.com/docs/mailgun/api-reference/
+type Service struct {
+	httpClient *http.Client
+	baseURL    string
+	apiKey     string
+	domain     string
+	from       string
+}
+
+// NewService creates a new Mailgun email service which sends from the given address via the given sending domain.
+// Domains in Mailgun's EU region have their own API host.
+func NewService(httpClient *http.Client, httpRetries *httpx.RetryConfig, apiKey, domain, from string, eu bool) *Service {
+	traced := *httpClient
+	traced.Transport = httpx.WithTraces(httpx.WithRetries(httpClient.Transport, httpRetries))
+
+	baseURL := apiURL
+	if eu {
+		baseURL = apiURLEU
+	}
+
+	return &Service{httpClient: &traced, baseURL: baseURL, apiKey: apiKey, domain: domain, from: from}
+}
+
+// Send sends an email to the given addresses
+func (s *Service) Send(ctx context.Context, addresses []string, subject, body string) error {
+	_, err := s.SendMessage(ctx, addresses, subject, body)
+	return err
+}
+
+// SendMessage sends an email to the given addresses, returning the message id that Mailgun will include in any
+// delivery events for it
+func (s *Service) SendMessage(ctx context.Context, addresses []string, subject, body string) (string, error) {
+	form := url.Values{
+		"from":    []string{s.from},
+		"to":      addresses,
+		"subject": []string{subject},
+		"text":    []string{body},
+	}
+
+	req, err := httpx.NewRequest(ctx, "POST", s.baseURL+url.PathEscape(s.domain)+"/messages", strings.NewReader(form.Encode()), map[string]string{
+		"Content-Type": "application/x-www-form-urlencoded",
+	})
+	if err != nil {
+		return "", err
+	}
+	req.SetBasicAuth("api", s.apiKey)
+
+	trace, resp, err := utils.DoTraced(s.httpClient, req)
+	if err != nil {
+		return "", fmt.Errorf("error sending email: %w", err)
+	}
+
+	response := &struct {
+		ID      string `json:"id"`
+		Message string `json:"message"`
+	}{}
+	jsonx.Unmarshal(trace.ResponseBody, response)
+
+	if resp.StatusCode/100 != 2 {
+		if response.Message == "" {
+			response.Message = fmt.Sprintf("unexpected response status %d", resp.StatusCode)
+		}
+		return "", fmt.Errorf("error sending email: %s", response.Message)
+	}
+
+	// ids are returned as <id> but webhook events give us the bare message-id header
+	return strings.Trim(response.ID, "<>"), nil
+}
@@ -0,0 +1,59 @@
+package mailgun_test
+
+import (
+	"context"
+	"io"
+	"net/url"
+	"testing"
+
+	"github.com/nyaruka/gocommon/httpx"
+	"github.com/nyaruka/mailroom/v26/services/email/mailgun"
+	"github.com/nyaruka/mailroom/v26/testsuite"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestService(t *testing.T) {
+	ctx := context.Background()
+
+	client, mocks := testsuite.MockedHTTP(map[string][]*httpx.MockResponse{
+		"https://api.mailgun.net/v3/mg.example.com/messages": {
+			httpx.NewMockResponse(200, nil, []byte(`{"id": "<20251018120000.1.5817@mg.example.com>", "message": "Queued. Thank you."}`)),
+			httpx.NewMockResponse(401, nil, []byte(`{"message": "Invalid private key"}`)),
+		},
+		"https://api.eu.mailgun.net/v3/mg.example.eu/messages": {
+			httpx.NewMockResponse(200, nil, []byte(`{"id": "<20251018120000.2.5817@mg.example.eu>", "message": "Queued. Thank you."}`)),
+		},
+	})
+
+	svc := mailgun.NewService(client, nil, "key-123", "mg.example.com", "flows@example.com", false)
+
+	messageID, err := svc.SendMessage(ctx, []string{"bob@example.com", "jim@example.com"}, "Hi", "Hello there")
+	assert.NoError(t, err)
+	assert.Equal(t, "20251018120000.1.5817@mg.example.com", messageID)
+
+	req := mocks.Requests()[0]
+	user, pass, _ := req.BasicAuth()
+	assert.Equal(t, "api", user)
+	assert.Equal(t, "key-123", pass)
+
+	body, _ := io.ReadAll(req.Body)
+	form, _ := url.ParseQuery(string(body))
+	assert.Equal(t, url.Values{
+		"from":    {"flows@example.com"},
+		"to":      {"bob@example.com", "jim@example.com"},
+		"subject": {"Hi"},
+		"text":    {"Hello there"},
+	}, form)
+
+	err = svc.Send(ctx, []string{"bob@example.com"}, "Hi", "Hello there")
+	assert.EqualError(t, err, "error sending email: Invalid private key")
+
+	// domains in the EU region use a different API host
+	svc = mailgun.NewService(client, nil, "key-123", "mg.example.eu", "flows@example.eu", true)
+
+	messageID, err = svc.SendMessage(ctx, []string{"bob@example.com"}, "Hi", "Hello there")
+	assert.NoError(t, err)
+	assert.Equal(t, "20251018120000.2.5817@mg.example.eu", messageID)
+
+	assert.False(t, mocks.HasUnused())
+}
@@ -0,0 +1,40 @@
+package mailgun
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+	"time"
+
+	"github.com/nyaruka/gocommon/dates"
+)
+
+// how far the timestamp of a signature can be from now, so that captured requests can't be replayed later
+const webhookTolerance = time.Minute * 5
+
+// WebhookSignature is the signature included in every webhook request, see
+// https://documentation.mailgun.com/docs/mailgun/user-manual/webhooks/securing-webhooks
+type WebhookSignature struct {
+	Timestamp string `json:"timestamp"`
+	Token     string `json:"token"`
+	Signature string `json:"signature"`
+}
+
+// Verify returns whether this signature, which is an HMAC of the timestamp followed by the token, is valid for the
+// given webhook signing key and recent enough to not be a replay
+func (s *WebhookSignature) Verify(signingKey string) bool {
+	ts, err := strconv.ParseInt(s.Timestamp, 10, 64)
+	if err != nil || dates.Since(time.Unix(ts, 0)).Abs() > webhookTolerance {
+		return false
+	}
+
+	mac := hmac.New(sha256.New, []byte(signingKey))
+	mac.Write([]byte(s.Timestamp + s.Token))
+
+	expected, err := hex.DecodeString(s.Signature)
+	if err != nil {
+		return false
+	}
+	return hmac.Equal(mac.Sum(nil), expected)
+}
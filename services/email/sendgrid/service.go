@@ -0,0 +1,100 @@
+package sendgrid
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/nyaruka/gocommon/httpx"
+	"github.com/nyaruka/gocommon/jsonx"
+	"github.com/nyaruka/mailroom/v26/utils"
+)
+
+const sendURL = "https://api.sendgrid.com/v3/mail/send"
+
+// Service is a SendGrid email service, see https://www.twilio.com/docs/sendgrid/api-reference/mail-send/mail-send
+type Service struct {
+	httpClient *http.Client
+	apiKey     string
+	from       string
+}
+
+// NewService creates a new SendGrid email service which sends from the given address
+func NewService(httpClient *http.Client, httpRetries *httpx.RetryConfig, apiKey, from string) *Service {
+	traced := *httpClient
+	traced.Transport = httpx.WithTraces(httpx.WithRetries(httpClient.Transport, httpRetries))
+
+	return &Service{httpClient: &traced, apiKey: apiKey, from: from}
+}
+
+// Send sends an email to the given addresses
+func (s *Service) Send(ctx context.Context, addresses []string, subject, body string) error {
+	_, err := s.SendMessage(ctx, addresses, subject, body)
+	return err
+}
+
+// SendMessage sends an email to the given addresses, returning the message id that SendGrid will include in any
+// delivery events for it
+func (s *Service) SendMessage(ctx context.Context, addresses []string, subject, body string) (string, error) {
+	type address struct {
+		Email string `json:"email"`
+	}
+	type personalization struct {
+		To []address `json:"to"`
+	}
+	type content struct {
+		Type  string `json:"type"`
+		Value string `json:"value"`
+	}
+
+	to := make([]address, len(addresses))
+	for i, a := range addresses {
+		to[i] = address{Email: a}
+	}
+
+	payload := &struct {
+		Personalizations []personalization `json:"personalizations"`
+		From             address           `json:"from"`
+		Subject          string            `json:"subject"`
+		Content          []content         `json:"content"`
+	}{
+		Personalizations: []personalization{{To: to}},
+		From:             address{Email: s.from},
+		Subject:          subject,
+		Content:          []content{{Type: "text/plain", Value: body}},
+	}
+
+	req, err := httpx.NewRequest(ctx, "POST", sendURL, bytes.NewReader(jsonx.MustMarshal(payload)), map[string]string{
+		"Content-Type":  "application/json",
+		"Authorization": "Bearer " + s.apiKey,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	trace, resp, err := utils.DoTraced(s.httpClient, req)
+	if err != nil {
+		return "", fmt.Errorf("error sending email: %w", err)
+	}
+	if resp.StatusCode/100 != 2 {
+		return "", fmt.Errorf("error sending email: %s", errorMessage(trace))
+	}
+
+	return resp.Header.Get("X-Message-Id"), nil
+}
+
+// errorMessage extracts the first error message from a failed response
+func errorMessage(trace *httpx.Trace) string {
+	response := &struct {
+		Errors []struct {
+			Message string `json:"message"`
+		} `json:"errors"`
+	}{}
+	jsonx.Unmarshal(trace.ResponseBody, response)
+
+	if len(response.Errors) > 0 && response.Errors[0].Message != "" {
+		return response.Errors[0].Message
+	}
+	return fmt.Sprintf("unexpected response status %d", trace.Response.StatusCode)
+}
@@ -0,0 +1,47 @@
+package sendgrid_test
+
+import (
+	"context"
+	"io"
+	"testing"
+
+	"github.com/nyaruka/gocommon/httpx"
+	"github.com/nyaruka/mailroom/v26/services/email/sendgrid"
+	"github.com/nyaruka/mailroom/v26/testsuite"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestService(t *testing.T) {
+	ctx := context.Background()
+
+	client, mocks := testsuite.MockedHTTP(map[string][]*httpx.MockResponse{
+		"https://api.sendgrid.com/v3/mail/send": {
+			httpx.NewMockResponse(202, map[string]string{"X-Message-Id": "14c5d75ce93"}, nil),
+			httpx.NewMockResponse(401, nil, []byte(`{"errors": [{"message": "The provided authorization grant is invalid, expired, or revoked", "field": null}]}`)),
+			httpx.NewMockResponse(500, nil, []byte(`Server Error`)),
+		},
+	})
+	svc := sendgrid.NewService(client, nil, "SG.key123", "flows@example.com")
+
+	messageID, err := svc.SendMessage(ctx, []string{"bob@example.com", "jim@example.com"}, "Hi", "Hello there")
+	assert.NoError(t, err)
+	assert.Equal(t, "14c5d75ce93", messageID)
+
+	req := mocks.Requests()[0]
+	body, _ := io.ReadAll(req.Body)
+	assert.Equal(t, "Bearer SG.key123", req.Header.Get("Authorization"))
+	assert.JSONEq(t, `{
+		"personalizations": [{"to": [{"email": "bob@example.com"}, {"email": "jim@example.com"}]}],
+		"from": {"email": "flows@example.com"},
+		"subject": "Hi",
+		"content": [{"type": "text/plain", "value": "Hello there"}]
+	}`, string(body))
+
+	err = svc.Send(ctx, []string{"bob@example.com"}, "Hi", "Hello there")
+	assert.EqualError(t, err, "error sending email: The provided authorization grant is invalid, expired, or revoked")
+
+	err = svc.Send(ctx, []string{"bob@example.com"}, "Hi", "Hello there")
+	assert.EqualError(t, err, "error sending email: unexpected response status 500")
+
+	assert.False(t, mocks.HasUnused())
+}
@@ -0,0 +1,54 @@
+package sendgrid
+
+import (
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"strconv"
+	"time"
+
+	"github.com/nyaruka/gocommon/dates"
+)
+
+// headers on event webhook requests which carry the signature, see
+// https://www.twilio.com/docs/sendgrid/for-developers/tracking-events/getting-started-event-webhook-security-features
+const (
+	SignatureHeader = "X-Twilio-Email-Event-Webhook-Signature"
+	TimestampHeader = "X-Twilio-Email-Event-Webhook-Timestamp"
+)
+
+// how far the timestamp of a signed request can be from now, so that captured requests can't be replayed later
+const webhookTolerance = time.Minute * 5
+
+// VerifyWebhook returns whether the given signature of an event webhook request, which is an ECDSA signature of the
+// timestamp followed by the payload, is valid for the given base64 encoded verification key and recent enough to not be
+// a replay
+func VerifyWebhook(verificationKey, signature, timestamp string, payload []byte) bool {
+	ts, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil || dates.Since(time.Unix(ts, 0)).Abs() > webhookTolerance {
+		return false
+	}
+
+	keyBytes, err := base64.StdEncoding.DecodeString(verificationKey)
+	if err != nil {
+		return false
+	}
+	key, err := x509.ParsePKIXPublicKey(keyBytes)
+	if err != nil {
+		return false
+	}
+	ecKey, ok := key.(*ecdsa.PublicKey)
+	if !ok {
+		return false
+	}
+
+	sig, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil {
+		return false
+	}
+
+	hash := sha256.Sum256(append([]byte(timestamp), payload...))
+
+	return ecdsa.VerifyASN1(ecKey, hash[:], sig)
+}
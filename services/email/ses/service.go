@@ -0,0 +1,98 @@
+package ses
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+	"github.com/nyaruka/gocommon/dates"
+	"github.com/nyaruka/gocommon/httpx"
+	"github.com/nyaruka/gocommon/jsonx"
+	"github.com/nyaruka/mailroom/v26/utils"
+)
+
+// Service is an Amazon SES email service which calls the v2 API directly rather than pulling in the whole SDK, see
+// https://docs.aws.amazon.com/ses/latest/APIReference-V2/API_SendEmail.html
+type Service struct {
+	httpClient  *http.Client
+	signer      *v4.Signer
+	credentials aws.Credentials
+	region      string
+	from        string
+}
+
+// NewService creates a new SES email service which sends from the given address
+func NewService(httpClient *http.Client, httpRetries *httpx.RetryConfig, accessKeyID, secretAccessKey, region, from string) *Service {
+	traced := *httpClient
+	traced.Transport = httpx.WithTraces(httpx.WithRetries(httpClient.Transport, httpRetries))
+
+	return &Service{
+		httpClient:  &traced,
+		signer:      v4.NewSigner(),
+		credentials: aws.Credentials{AccessKeyID: accessKeyID, SecretAccessKey: secretAccessKey},
+		region:      region,
+		from:        from,
+	}
+}
+
+// Send sends an email to the given addresses
+func (s *Service) Send(ctx context.Context, addresses []string, subject, body string) error {
+	_, err := s.SendMessage(ctx, addresses, subject, body)
+	return err
+}
+
+// SendMessage sends an email to the given addresses, returning the message id that SES will include in any bounce,
+// complaint or delivery notifications for it
+func (s *Service) SendMessage(ctx context.Context, addresses []string, subject, body string) (string, error) {
+	type content struct {
+		Data string `json:"Data"`
+	}
+
+	payload := map[string]any{
+		"FromEmailAddress": s.from,
+		"Destination":      map[string]any{"ToAddresses": addresses},
+		"Content": map[string]any{
+			"Simple": map[string]any{
+				"Subject": content{Data: subject},
+				"Body":    map[string]any{"Text": content{Data: body}},
+			},
+		},
+	}
+	data := jsonx.MustMarshal(payload)
+
+	sendURL := fmt.Sprintf("https://email.%s.amazonaws.com/v2/email/outbound-emails", s.region)
+	req, err := httpx.NewRequest(ctx, "POST", sendURL, bytes.NewReader(data), map[string]string{"Content-Type": "application/json"})
+	if err != nil {
+		return "", err
+	}
+
+	payloadHash := sha256.Sum256(data)
+	if err := s.signer.SignHTTP(ctx, s.credentials, req, hex.EncodeToString(payloadHash[:]), "ses", s.region, dates.Now()); err != nil {
+		return "", fmt.Errorf("error signing request: %w", err)
+	}
+
+	trace, resp, err := utils.DoTraced(s.httpClient, req)
+	if err != nil {
+		return "", fmt.Errorf("error sending email: %w", err)
+	}
+
+	response := &struct {
+		MessageID string `json:"MessageId"`
+		Message   string `json:"message"`
+	}{}
+	jsonx.Unmarshal(trace.ResponseBody, response)
+
+	if resp.StatusCode/100 != 2 {
+		if response.Message == "" {
+			response.Message = fmt.Sprintf("unexpected response status %d", resp.StatusCode)
+		}
+		return "", fmt.Errorf("error sending email: %s", response.Message)
+	}
+
+	return response.MessageID, nil
+}
@@ -0,0 +1,44 @@
+package ses_test
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/nyaruka/gocommon/httpx"
+	"github.com/nyaruka/mailroom/v26/services/email/ses"
+	"github.com/nyaruka/mailroom/v26/testsuite"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestService(t *testing.T) {
+	ctx := context.Background()
+
+	client, mocks := testsuite.MockedHTTP(map[string][]*httpx.MockResponse{
+		"https://email.eu-west-1.amazonaws.com/v2/email/outbound-emails": {
+			httpx.NewMockResponse(200, nil, []byte(`{"MessageId": "0102019a1b2c3d4e-5f6a7b8c-1234-5678-9abc-def012345678-000000"}`)),
+			httpx.NewMockResponse(400, nil, []byte(`{"message": "Email address is not verified. The following identities failed the check in region EU-WEST-1: flows@example.com"}`)),
+		},
+	})
+	svc := ses.NewService(client, nil, "AKIA123", "sesame", "eu-west-1", "flows@example.com")
+
+	messageID, err := svc.SendMessage(ctx, []string{"bob@example.com"}, "Hi", "Hello there")
+	assert.NoError(t, err)
+	assert.Equal(t, "0102019a1b2c3d4e-5f6a7b8c-1234-5678-9abc-def012345678-000000", messageID)
+
+	req := mocks.Requests()[0]
+	body, _ := io.ReadAll(req.Body)
+	assert.True(t, strings.HasPrefix(req.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=AKIA123/"))
+	assert.Contains(t, req.Header.Get("Authorization"), "/eu-west-1/ses/aws4_request")
+	assert.JSONEq(t, `{
+		"FromEmailAddress": "flows@example.com",
+		"Destination": {"ToAddresses": ["bob@example.com"]},
+		"Content": {"Simple": {"Subject": {"Data": "Hi"}, "Body": {"Text": {"Data": "Hello there"}}}}
+	}`, string(body))
+
+	err = svc.Send(ctx, []string{"bob@example.com"}, "Hi", "Hello there")
+	assert.EqualError(t, err, "error sending email: Email address is not verified. The following identities failed the check in region EU-WEST-1: flows@example.com")
+
+	assert.False(t, mocks.HasUnused())
+}
@@ -0,0 +1,152 @@
+package ses
+
+import (
+	"context"
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/nyaruka/gocommon/httpx"
+)
+
+// SNS endpoints which we'll fetch signing certificates and confirm subscriptions from
+var snsHostRegex = regexp.MustCompile(`^sns\.[a-z0-9\-]+\.amazonaws\.com(\.cn)?$`)
+
+// signing certificates rarely change so we only fetch each one once
+var snsCerts sync.Map
+
+// SNSMessage is an SNS message envelope, see https://docs.aws.amazon.com/sns/latest/dg/sns-message-and-json-formats.html
+type SNSMessage struct {
+	Type             string `json:"Type"`
+	MessageID        string `json:"MessageId"`
+	Token            string `json:"Token"`
+	TopicArn         string `json:"TopicArn"`
+	Subject          string `json:"Subject"`
+	Message          string `json:"Message"`
+	Timestamp        string `json:"Timestamp"`
+	SignatureVersion string `json:"SignatureVersion"`
+	Signature        string `json:"Signature"`
+	SigningCertURL   string `json:"SigningCertURL"`
+	SubscribeURL     string `json:"SubscribeURL"`
+}
+
+// StringToSign returns the canonical form of this message which is signed by SNS, see
+// https://docs.aws.amazon.com/sns/latest/dg/sns-verify-signature-of-message.html
+func (m *SNSMessage) StringToSign() string {
+	fields := [][2]string{{"Message", m.Message}, {"MessageId", m.MessageID}}
+
+	if m.Type == "Notification" {
+		if m.Subject != "" {
+			fields = append(fields, [2]string{"Subject", m.Subject})
+		}
+		fields = append(fields, [2]string{"Timestamp", m.Timestamp}, [2]string{"TopicArn", m.TopicArn}, [2]string{"Type", m.Type})
+	} else {
+		fields = append(fields, [2]string{"SubscribeURL", m.SubscribeURL}, [2]string{"Timestamp", m.Timestamp}, [2]string{"Token", m.Token}, [2]string{"TopicArn", m.TopicArn}, [2]string{"Type", m.Type})
+	}
+
+	sb := &strings.Builder{}
+	for _, f := range fields {
+		sb.WriteString(f[0] + "\n" + f[1] + "\n")
+	}
+	return sb.String()
+}
+
+// Verify checks the signature of this message using the signing certificate it references, which must be hosted by SNS
+func (m *SNSMessage) Verify(ctx context.Context, httpClient *http.Client) error {
+	var hash crypto.Hash
+	switch m.SignatureVersion {
+	case "1":
+		hash = crypto.SHA1
+	case "2":
+		hash = crypto.SHA256
+	default:
+		return fmt.Errorf("unsupported signature version: %s", m.SignatureVersion)
+	}
+
+	if !IsSNSURL(m.SigningCertURL) || !strings.HasSuffix(m.SigningCertURL, ".pem") {
+		return errors.New("invalid signing certificate URL")
+	}
+
+	cert, err := fetchSNSCert(ctx, httpClient, m.SigningCertURL)
+	if err != nil {
+		return err
+	}
+	key, ok := cert.PublicKey.(*rsa.PublicKey)
+	if !ok {
+		return errors.New("signing certificate doesn't have an RSA key")
+	}
+
+	sig, err := base64.StdEncoding.DecodeString(m.Signature)
+	if err != nil {
+		return errors.New("invalid signature encoding")
+	}
+
+	var digest []byte
+	if hash == crypto.SHA1 {
+		d := sha1.Sum([]byte(m.StringToSign()))
+		digest = d[:]
+	} else {
+		d := sha256.Sum256([]byte(m.StringToSign()))
+		digest = d[:]
+	}
+
+	if err := rsa.VerifyPKCS1v15(key, hash, digest, sig); err != nil {
+		return errors.New("invalid signature")
+	}
+	return nil
+}
+
+// IsSNSURL returns whether the given URL is an HTTPS URL on an SNS endpoint
+func IsSNSURL(s string) bool {
+	u, err := url.Parse(s)
+	return err == nil && u.Scheme == "https" && snsHostRegex.MatchString(u.Hostname())
+}
+
+func fetchSNSCert(ctx context.Context, httpClient *http.Client, certURL string) (*x509.Certificate, error) {
+	if cert, ok := snsCerts.Load(certURL); ok {
+		return cert.(*x509.Certificate), nil
+	}
+
+	req, err := httpx.NewRequest(ctx, "GET", certURL, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching signing certificate: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("error fetching signing certificate: unexpected response status %d", resp.StatusCode)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	if err != nil {
+		return nil, fmt.Errorf("error reading signing certificate: %w", err)
+	}
+
+	block, _ := pem.Decode(body)
+	if block == nil {
+		return nil, errors.New("signing certificate isn't PEM encoded")
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing signing certificate: %w", err)
+	}
+
+	snsCerts.Store(certURL, cert)
+	return cert, nil
+}
@@ -35,6 +35,8 @@ func Runtime(t *testing.T) (context.Context, *runtime.Runtime) {
 
 	cfg := runtime.NewDefaultConfig()
 	cfg.DeploymentID = "test"
+	cfg.DevRoutes = true
+	cfg.FieldsEncryptionKey = "5E0F1C2D3B4A59687786950A1B2C3D4E5F60718293A4B5C6D7E8F90112233445"
 	cfg.InternetPort = slotPortBase + 2*slot
 	cfg.InternalPort = cfg.InternetPort + 1
 	cfg.DB = fmt.Sprintf(dbTestDSNFormat, dbName)
@@ -53,7 +55,8 @@ func Runtime(t *testing.T) (context.Context, *runtime.Runtime) {
 	t.Setenv("AWS_REGION", "us-east-1")
 
 	cfg.S3Endpoint = "http://localstack:4566"
-	cfg.S3AttachmentsBucket = s3AttachmentsBucket() // this binary's own bucket, emptied before every test - see storage.go
+	cfg.S3AttachmentsBucket = s3AttachmentsBucket() // this binary's own buckets, emptied before every test - see storage.go
+	cfg.S3ExportsBucket = s3ExportsBucket()
 	cfg.S3PathStyle = true
 	cfg.DynamoEndpoint = "http://dynamodb:8000"
 	cfg.DynamoTablePrefix = dynTablePrefix() // this binary's own tables, cleared before every test - see dynamo.go
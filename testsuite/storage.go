@@ -14,23 +14,30 @@ import (
 	"github.com/stretchr/testify/require"
 )
 
-// Each test binary gets its own attachments bucket (suffixed with its process identifier), so concurrently
-// running binaries never see each other's files. Within a binary, clearStorage runs at the start of every
-// test so each starts with an empty bucket - assuming sequential tests, as elsewhere. Ownership and
+// Each test binary gets its own attachments and exports buckets (suffixed with its process identifier), so
+// concurrently running binaries never see each other's files. Within a binary, clearStorage runs at the start
+// of every test so each starts with empty buckets - assuming sequential tests, as elsewhere. Ownership and
 // sweeping of dead runs' buckets works as for all per-binary resources - see binary.go.
 
 const s3TestPrefix = "test-attachments-"
+const s3ExportsTestPrefix = "test-exports-"
 
-// per-binary bucket name
+// per-binary bucket names
 func s3AttachmentsBucket() string {
 	return s3TestPrefix + binProcID()
 }
+func s3ExportsBucket() string {
+	return s3ExportsTestPrefix + binProcID()
+}
 
-// setupStorage creates this binary's attachments bucket and sweeps the buckets of dead runs
+// setupStorage creates this binary's buckets and sweeps the buckets of dead runs
 func setupStorage(ctx context.Context, rt *runtime.Runtime) error {
 	if _, err := rt.S3.Client.CreateBucket(ctx, &s3.CreateBucketInput{Bucket: aws.String(s3AttachmentsBucket())}); err != nil {
 		return fmt.Errorf("error creating attachments bucket: %w", err)
 	}
+	if _, err := rt.S3.Client.CreateBucket(ctx, &s3.CreateBucketInput{Bucket: aws.String(s3ExportsBucket())}); err != nil {
+		return fmt.Errorf("error creating exports bucket: %w", err)
+	}
 
 	return sweepStaleStorage(ctx, rt)
 }
@@ -45,7 +52,11 @@ func sweepStaleStorage(ctx context.Context, rt *runtime.Runtime) error {
 	byProcID := make(map[string][]string)
 	for _, b := range resp.Buckets {
 		name := aws.ToString(b.Name)
-		byProcID[strings.TrimPrefix(name, s3TestPrefix)] = []string{name}
+		for _, prefix := range []string{s3TestPrefix, s3ExportsTestPrefix} {
+			if procID, ok := strings.CutPrefix(name, prefix); ok {
+				byProcID[procID] = append(byProcID[procID], name)
+			}
+		}
 	}
 
 	return sweepDeadBinaries(ctx, byProcID, func(name string) error {
@@ -66,10 +77,10 @@ func isNoSuchBucket(err error) bool {
 	return errors.As(err, &ae) && ae.ErrorCode() == "NoSuchBucket"
 }
 
-// clearStorage empties this binary's attachments bucket - runs at the start of every test
+// clearStorage empties this binary's buckets - runs at the start of every test
 func clearStorage(t *testing.T, rt *runtime.Runtime) {
 	t.Helper()
 
-	err := rt.S3.EmptyBucket(t.Context(), rt.Config.S3AttachmentsBucket)
-	require.NoError(t, err)
+	require.NoError(t, rt.S3.EmptyBucket(t.Context(), rt.Config.S3AttachmentsBucket))
+	require.NoError(t, rt.S3.EmptyBucket(t.Context(), rt.Config.S3ExportsBucket))
 }
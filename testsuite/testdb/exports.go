@@ -0,0 +1,22 @@
+package testdb
+
+import (
+	"testing"
+
+	"github.com/nyaruka/gocommon/dates"
+	"github.com/nyaruka/gocommon/jsonx"
+	"github.com/nyaruka/gocommon/uuids"
+	"github.com/nyaruka/mailroom/v26/core/models"
+	"github.com/nyaruka/mailroom/v26/runtime"
+	"github.com/stretchr/testify/require"
+)
+
+// InsertExport inserts an export
+func InsertExport(t *testing.T, rt *runtime.Runtime, org *Org, typ models.ExportType, status models.ExportStatus, config any, createdBy *User) models.ExportID {
+	var exportID models.ExportID
+	err := rt.DB.Get(&exportID, `INSERT INTO orgs_export(uuid, org_id, export_type, status, config, created_on, created_by_id, modified_on)
+					          VALUES($1, $2, $3, $4, $5, $6, $7, $6) RETURNING id`, uuids.NewV4(), org.ID, typ, status, jsonx.MustMarshal(config), dates.Now(), createdBy.ID,
+	)
+	require.NoError(t, err)
+	return exportID
+}
@@ -215,10 +215,11 @@ func RunWebTests(t *testing.T, rt *runtime.Runtime, truthFile string) {
 	}
 }
 
-// overwriteTestBucket rewrites this binary's per-binary bucket name (see storage.go) to the stable
-// "test-attachments" so that snapshots don't vary by binary
+// overwriteTestBucket rewrites this binary's per-binary bucket names (see storage.go) to the stable
+// "test-attachments" and "test-exports" so that snapshots don't vary by binary
 func overwriteTestBucket(rt *runtime.Runtime, b []byte) []byte {
-	return bytes.ReplaceAll(b, []byte(rt.Config.S3AttachmentsBucket), []byte("test-attachments"))
+	b = bytes.ReplaceAll(b, []byte(rt.Config.S3AttachmentsBucket), []byte("test-attachments"))
+	return bytes.ReplaceAll(b, []byte(rt.Config.S3ExportsBucket), []byte("test-exports"))
 }
 
 // overwriteTestBucketJSON is overwriteTestBucket applied through a JSON round trip of the given value
@@ -0,0 +1,490 @@
+package sheets
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/csv"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MaxFileSize is the maximum size of a file which can be read
+const MaxFileSize = 50 << 20
+
+const (
+	maxRows    = 1048576 // the row and column limits of XLSX
+	maxColumns = 16384
+
+	maxUncompressedSize = 250 << 20 // limit on each part of an XLSX file so a zip bomb can't exhaust memory
+	maxCells            = 10000000  // limit on the cells we'll hold in memory including empty ones
+
+	maxDateSerial = 2958466 // the day after 9999-12-31, the last date XLSX supports
+)
+
+// FormatFromFilename returns the format of a file based on its extension
+func FormatFromFilename(filename string) (Format, error) {
+	switch strings.ToLower(path.Ext(filename)) {
+	case ".csv":
+		return FormatCSV, nil
+	case ".xlsx":
+		return FormatXLSX, nil
+	}
+	return "", fmt.Errorf("unsupported file type: %s", filename)
+}
+
+// ReadRows reads all the rows of a CSV file or of the first worksheet of an XLSX file. Trailing empty cells are
+// trimmed from each row. XLSX cells with date formats are converted to ISO8601, e.g. 2025-10-18 or 2025-10-18T14:30:00.
+func ReadRows(format Format, data []byte) ([][]string, error) {
+	if len(data) > MaxFileSize {
+		return nil, fmt.Errorf("file is larger than the maximum of %d MB", MaxFileSize>>20)
+	}
+
+	switch format {
+	case FormatCSV:
+		return readCSV(data)
+	case FormatXLSX:
+		return readXLSX(data)
+	}
+	return nil, fmt.Errorf("unsupported format: %s", format)
+}
+
+func readCSV(data []byte) ([][]string, error) {
+	r := csv.NewReader(bytes.NewReader(bytes.TrimPrefix(data, []byte("\ufeff"))))
+	r.FieldsPerRecord = -1
+
+	rows, err := r.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("unable to read CSV: %w", err)
+	}
+	for i := range rows {
+		rows[i] = trimRow(rows[i])
+	}
+	return rows, nil
+}
+
+func readXLSX(data []byte) ([][]string, error) {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("unable to read XLSX: %w", err)
+	}
+
+	files := make(map[string]*zip.File, len(zr.File))
+	for _, f := range zr.File {
+		files[f.Name] = f
+	}
+
+	workbook := &xlsxWorkbook{}
+	if err := decodeXMLFile(files["xl/workbook.xml"], workbook); err != nil {
+		return nil, err
+	}
+
+	sheetPath, err := firstSheetPath(files, workbook)
+	if err != nil {
+		return nil, err
+	}
+
+	var sharedStrings []string
+	if f := files["xl/sharedStrings.xml"]; f != nil {
+		if sharedStrings, err = readSharedStrings(f); err != nil {
+			return nil, err
+		}
+	}
+
+	var dateStyles map[int]dateFormat
+	if f := files["xl/styles.xml"]; f != nil {
+		if dateStyles, err = readDateStyles(f); err != nil {
+			return nil, err
+		}
+	}
+
+	f := files[sheetPath]
+	if f == nil {
+		return nil, fmt.Errorf("unable to read XLSX: missing worksheet %s", sheetPath)
+	}
+
+	epoch := time.Date(1899, 12, 30, 0, 0, 0, 0, time.UTC)
+	if workbook.Properties.Date1904 {
+		epoch = time.Date(1904, 1, 1, 0, 0, 0, 0, time.UTC)
+	}
+
+	return readSheet(f, &cellContext{sharedStrings: sharedStrings, dateStyles: dateStyles, epoch: epoch})
+}
+
+type xlsxWorkbook struct {
+	Properties struct {
+		Date1904 bool `xml:"date1904,attr"`
+	} `xml:"workbookPr"`
+	Sheets []struct {
+		RID string `xml:"http://schemas.openxmlformats.org/officeDocument/2006/relationships id,attr"`
+	} `xml:"sheets>sheet"`
+}
+
+// firstSheetPath looks up the path of the first worksheet in the workbook
+func firstSheetPath(files map[string]*zip.File, workbook *xlsxWorkbook) (string, error) {
+	rels := struct {
+		Relationships []struct {
+			ID     string `xml:"Id,attr"`
+			Target string `xml:"Target,attr"`
+		} `xml:"Relationship"`
+	}{}
+
+	if err := decodeXMLFile(files["xl/_rels/workbook.xml.rels"], &rels); err != nil {
+		return "", err
+	}
+	if len(workbook.Sheets) == 0 {
+		return "", errors.New("unable to read XLSX: workbook has no worksheets")
+	}
+
+	for _, r := range rels.Relationships {
+		if r.ID == workbook.Sheets[0].RID {
+			if strings.HasPrefix(r.Target, "/") {
+				return strings.TrimPrefix(r.Target, "/"), nil
+			}
+			return path.Join("xl", r.Target), nil
+		}
+	}
+	return "", errors.New("unable to read XLSX: can't find first worksheet")
+}
+
+func readSharedStrings(f *zip.File) ([]string, error) {
+	sst := struct {
+		Items []richText `xml:"si"`
+	}{}
+	if err := decodeXMLFile(f, &sst); err != nil {
+		return nil, err
+	}
+
+	strs := make([]string, len(sst.Items))
+	for i, si := range sst.Items {
+		strs[i] = si.String()
+	}
+	return strs, nil
+}
+
+// richText is a string which is either a single <t> or a sequence of <r><t> runs
+type richText struct {
+	T    string `xml:"t"`
+	Runs []struct {
+		T string `xml:"t"`
+	} `xml:"r"`
+}
+
+func (t *richText) String() string {
+	if len(t.Runs) == 0 {
+		return t.T
+	}
+	b := &strings.Builder{}
+	for _, r := range t.Runs {
+		b.WriteString(r.T)
+	}
+	return b.String()
+}
+
+// dateFormat is whether a number format displays a date, a time or both
+type dateFormat int
+
+const (
+	dateFormatNone dateFormat = iota
+	dateFormatDate
+	dateFormatTime
+	dateFormatDateTime
+)
+
+// the built-in number formats which display dates and times
+var builtinDateFormats = map[int]dateFormat{
+	14: dateFormatDate, 15: dateFormatDate, 16: dateFormatDate, 17: dateFormatDate,
+	18: dateFormatTime, 19: dateFormatTime, 20: dateFormatTime, 21: dateFormatTime,
+	22: dateFormatDateTime,
+	45: dateFormatTime, 46: dateFormatTime, 47: dateFormatTime,
+}
+
+// readDateStyles reads the cell styles of a workbook, returning the indexes of those with date or time formats
+func readDateStyles(f *zip.File) (map[int]dateFormat, error) {
+	styles := struct {
+		NumFmts []struct {
+			ID   int    `xml:"numFmtId,attr"`
+			Code string `xml:"formatCode,attr"`
+		} `xml:"numFmts>numFmt"`
+		CellXfs []struct {
+			NumFmtID int `xml:"numFmtId,attr"`
+		} `xml:"cellXfs>xf"`
+	}{}
+	if err := decodeXMLFile(f, &styles); err != nil {
+		return nil, err
+	}
+
+	formats := make(map[int]dateFormat, len(styles.NumFmts))
+	for _, nf := range styles.NumFmts {
+		formats[nf.ID] = parseDateFormat(nf.Code)
+	}
+
+	dateStyles := make(map[int]dateFormat)
+	for i, xf := range styles.CellXfs {
+		df, custom := formats[xf.NumFmtID]
+		if !custom {
+			df = builtinDateFormats[xf.NumFmtID]
+		}
+		if df != dateFormatNone {
+			dateStyles[i] = df
+		}
+	}
+	return dateStyles, nil
+}
+
+// parseDateFormat determines whether a custom number format code like dd/mm/yyyy displays a date or time by looking
+// for day, year, hour and second placeholders outside of quoted text, escaped characters and [...] sections
+func parseDateFormat(code string) dateFormat {
+	var hasDate, hasTime, quoted, bracketed, escaped bool
+
+	for _, r := range strings.ToLower(code) {
+		switch {
+		case escaped:
+			escaped = false
+		case quoted:
+			quoted = r != '"'
+		case bracketed:
+			bracketed = r != ']'
+		case r == '\\':
+			escaped = true
+		case r == '"':
+			quoted = true
+		case r == '[':
+			bracketed = true
+		case r == ';':
+			// only the first section of a format applies to positive numbers
+			return newDateFormat(hasDate, hasTime)
+		case r == 'd' || r == 'y':
+			hasDate = true
+		case r == 'h' || r == 's':
+			hasTime = true
+		}
+	}
+	return newDateFormat(hasDate, hasTime)
+}
+
+func newDateFormat(hasDate, hasTime bool) dateFormat {
+	switch {
+	case hasDate && hasTime:
+		return dateFormatDateTime
+	case hasDate:
+		return dateFormatDate
+	case hasTime:
+		return dateFormatTime
+	}
+	return dateFormatNone
+}
+
+type xlsxCell struct {
+	Ref    string   `xml:"r,attr"`
+	Type   string   `xml:"t,attr"`
+	Style  int      `xml:"s,attr"`
+	Value  string   `xml:"v"`
+	Inline richText `xml:"is"`
+}
+
+// cellContext is what we need from the rest of the workbook to get the values of cells
+type cellContext struct {
+	sharedStrings []string
+	dateStyles    map[int]dateFormat
+	epoch         time.Time
+}
+
+// readSheet streams through the rows of a worksheet so that only the cell values are kept in memory
+func readSheet(f *zip.File, cc *cellContext) ([][]string, error) {
+	rc, err := openZipFile(f)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	rows := make([][]string, 0, 100)
+	var row []string
+	numCells := 0
+
+	d := xml.NewDecoder(rc)
+	for {
+		tok, err := d.Token()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("unable to read XLSX: %w", err)
+		}
+
+		switch el := tok.(type) {
+		case xml.StartElement:
+			switch el.Name.Local {
+			case "row":
+				// rows without any cells can be omitted so use the row number to fill any gaps
+				for _, a := range el.Attr {
+					if a.Name.Local == "r" {
+						if num, _ := strconv.Atoi(a.Value); num > 0 {
+							if num > maxRows {
+								return nil, fmt.Errorf("unable to read XLSX: row %d is beyond the maximum of %d", num, maxRows)
+							}
+							for len(rows) < num-1 {
+								rows = append(rows, []string{})
+							}
+						}
+					}
+				}
+				if len(rows) >= maxRows {
+					return nil, fmt.Errorf("unable to read XLSX: more than the maximum of %d rows", maxRows)
+				}
+				row = []string{}
+			case "c":
+				cell := &xlsxCell{}
+				if err := d.DecodeElement(cell, &el); err != nil {
+					return nil, fmt.Errorf("unable to read XLSX: %w", err)
+				}
+
+				col := columnIndex(cell.Ref)
+				if col < 0 {
+					col = len(row)
+				}
+				if col >= maxColumns {
+					return nil, fmt.Errorf("unable to read XLSX: cell %s is beyond the maximum of %d columns", cell.Ref, maxColumns)
+				}
+				if numCells += max(col+1-len(row), 0); numCells > maxCells {
+					return nil, fmt.Errorf("unable to read XLSX: more than the maximum of %d cells", maxCells)
+				}
+				for len(row) <= col {
+					row = append(row, "")
+				}
+				row[col] = cc.value(cell)
+			}
+		case xml.EndElement:
+			if el.Name.Local == "row" {
+				rows = append(rows, trimRow(row))
+			}
+		}
+	}
+
+	return rows, nil
+}
+
+func (cc *cellContext) value(c *xlsxCell) string {
+	switch c.Type {
+	case "s":
+		if i, err := strconv.Atoi(c.Value); err == nil && i >= 0 && i < len(cc.sharedStrings) {
+			return cc.sharedStrings[i]
+		}
+		return ""
+	case "inlineStr":
+		return c.Inline.String()
+	case "b":
+		if c.Value == "1" {
+			return "true"
+		}
+		return "false"
+	case "", "n":
+		// dates are stored as the number of days since the epoch, formatted by the cell's style
+		if df := cc.dateStyles[c.Style]; df != dateFormatNone {
+			if days, err := strconv.ParseFloat(c.Value, 64); err == nil && days >= 0 && days < maxDateSerial {
+				return formatDate(cc.epoch, days, df)
+			}
+		}
+
+		// large numbers such as phone numbers can be stored in exponent form
+		if strings.ContainsAny(c.Value, "Ee") {
+			if f, err := strconv.ParseFloat(c.Value, 64); err == nil {
+				return strconv.FormatFloat(f, 'f', -1, 64)
+			}
+		}
+	}
+	return c.Value
+}
+
+// formatDate formats a date serial number as an ISO8601 date, time or datetime
+func formatDate(epoch time.Time, days float64, df dateFormat) string {
+	secs := math.Round(days * 86400)
+	whole := math.Floor(secs / 86400)
+	t := epoch.AddDate(0, 0, int(whole)).Add(time.Duration(secs-whole*86400) * time.Second)
+
+	switch df {
+	case dateFormatDate:
+		return t.Format("2006-01-02")
+	case dateFormatTime:
+		return t.Format("15:04:05")
+	}
+	return t.Format("2006-01-02T15:04:05")
+}
+
+// columnIndex converts a cell reference to a zero-based column index, e.g. B3 -> 1, or -1 if it's not valid. Columns
+// beyond the maximum return the maximum.
+func columnIndex(ref string) int {
+	col := 0
+	for i, r := range ref {
+		if r >= 'A' && r <= 'Z' {
+			col = min(col*26+int(r-'A')+1, maxColumns+1)
+		} else {
+			if i == 0 {
+				return -1
+			}
+			break
+		}
+	}
+	return col - 1
+}
+
+func decodeXMLFile(f *zip.File, v any) error {
+	if f == nil {
+		return errors.New("unable to read XLSX: missing workbook")
+	}
+
+	rc, err := openZipFile(f)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	if err := xml.NewDecoder(rc).Decode(v); err != nil {
+		return fmt.Errorf("unable to read XLSX: %w", err)
+	}
+	return nil
+}
+
+// openZipFile opens a file in a zip for reading, limiting how much can be read from it because its declared
+// uncompressed size can't be trusted
+func openZipFile(f *zip.File) (io.ReadCloser, error) {
+	if f.UncompressedSize64 > maxUncompressedSize {
+		return nil, fmt.Errorf("unable to read XLSX: %s is larger than the maximum of %d MB", f.Name, maxUncompressedSize>>20)
+	}
+
+	rc, err := f.Open()
+	if err != nil {
+		return nil, fmt.Errorf("unable to read XLSX: %w", err)
+	}
+	return &limitedReadCloser{ReadCloser: rc, name: f.Name, remaining: maxUncompressedSize}, nil
+}
+
+type limitedReadCloser struct {
+	io.ReadCloser
+	name      string
+	remaining int64
+}
+
+func (r *limitedReadCloser) Read(p []byte) (int, error) {
+	if r.remaining <= 0 {
+		return 0, fmt.Errorf("%s is larger than the maximum of %d MB", r.name, maxUncompressedSize>>20)
+	}
+	if int64(len(p)) > r.remaining {
+		p = p[:r.remaining+1] // read one byte more than allowed so that we know it's been exceeded
+	}
+	n, err := r.ReadCloser.Read(p)
+	r.remaining -= int64(n)
+	return n, err
+}
+
+func trimRow(row []string) []string {
+	for len(row) > 0 && strings.TrimSpace(row[len(row)-1]) == "" {
+		row = row[:len(row)-1]
+	}
+	return row
+}
@@ -0,0 +1,116 @@
+package sheets_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"testing"
+
+	"github.com/nyaruka/mailroom/v26/utils/sheets"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFormatFromFilename(t *testing.T) {
+	f, err := sheets.FormatFromFilename("contacts.CSV")
+	assert.NoError(t, err)
+	assert.Equal(t, sheets.FormatCSV, f)
+
+	f, err = sheets.FormatFromFilename("imports/1/contacts.xlsx")
+	assert.NoError(t, err)
+	assert.Equal(t, sheets.FormatXLSX, f)
+
+	_, err = sheets.FormatFromFilename("contacts.xls")
+	assert.EqualError(t, err, "unsupported file type: contacts.xls")
+}
+
+func TestReadRows(t *testing.T) {
+	rows, err := sheets.ReadRows(sheets.FormatCSV, []byte("\ufeffName,Phone,\nAnn,+16055741111,\n\"Bob, Jr\",\n"))
+	require.NoError(t, err)
+	assert.Equal(t, [][]string{{"Name", "Phone"}, {"Ann", "+16055741111"}, {"Bob, Jr"}}, rows)
+
+	_, err = sheets.ReadRows(sheets.FormatCSV, []byte("Name\n\"Ann\n"))
+	assert.ErrorContains(t, err, "unable to read CSV")
+
+	// files we write can be read back
+	b := &bytes.Buffer{}
+	w, err := sheets.NewWriter(sheets.FormatXLSX, b, "Contacts", []string{"Name", "Phone"})
+	require.NoError(t, err)
+	require.NoError(t, w.WriteRow([]string{"Ann & Co", "+16055741111"}))
+	require.NoError(t, w.WriteRow([]string{"", "+16055742222"}))
+	require.NoError(t, w.Close())
+
+	rows, err = sheets.ReadRows(sheets.FormatXLSX, b.Bytes())
+	require.NoError(t, err)
+	assert.Equal(t, [][]string{{"Name", "Phone"}, {"Ann & Co", "+16055741111"}, {"", "+16055742222"}}, rows)
+
+	// as can files written by spreadsheet apps with shared strings, rich text and numbers
+	rows, err = sheets.ReadRows(sheets.FormatXLSX, writeXLSX(t, map[string]string{
+		"xl/sharedStrings.xml": `<sst xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><si><t>Name</t></si><si><t>Phone</t></si><si><r><t>Cat</t></r><r><t xml:space="preserve"> Jones</t></r></si></sst>`,
+		"xl/worksheets/data.xml": `<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>` +
+			`<row r="1"><c r="A1" t="s"><v>0</v></c><c r="B1" t="s"><v>1</v></c><c r="C1" t="str"><v>Active</v></c></row>` +
+			`<row r="3"><c r="A3" t="s"><v>2</v></c><c r="B3"><v>1.6055743333E+10</v></c><c r="C3" t="b"><v>1</v></c></row>` +
+			`<row r="4"><c r="B4"><v>32</v></c></row>` +
+			`</sheetData></worksheet>`,
+	}))
+	require.NoError(t, err)
+	assert.Equal(t, [][]string{{"Name", "Phone", "Active"}, {}, {"Cat Jones", "16055743333", "true"}, {"", "32"}}, rows)
+
+	// dates are stored as numbers and converted according to the format of their style
+	rows, err = sheets.ReadRows(sheets.FormatXLSX, writeXLSX(t, map[string]string{
+		"xl/styles.xml": `<styleSheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">` +
+			`<numFmts><numFmt numFmtId="164" formatCode="dd/mm/yyyy\ hh:mm"/><numFmt numFmtId="165" formatCode="&quot;day&quot;\ 0"/></numFmts>` +
+			`<cellXfs><xf numFmtId="0"/><xf numFmtId="14"/><xf numFmtId="164"/><xf numFmtId="20"/><xf numFmtId="165"/></cellXfs></styleSheet>`,
+		"xl/worksheets/data.xml": `<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>` +
+			`<row r="1"><c r="A1"><v>45948</v></c><c r="B1" s="1"><v>45948</v></c><c r="C1" s="2"><v>45948.6041666667</v></c><c r="D1" s="3"><v>0.5</v></c><c r="E1" s="4"><v>12</v></c></row>` +
+			`</sheetData></worksheet>`,
+	}))
+	require.NoError(t, err)
+	assert.Equal(t, [][]string{{"45948", "2025-10-18", "2025-10-18T14:30:00", "12:00:00", "12"}}, rows)
+
+	_, err = sheets.ReadRows(sheets.FormatXLSX, []byte("not a zip"))
+	assert.ErrorContains(t, err, "unable to read XLSX")
+}
+
+func TestReadRowsLimits(t *testing.T) {
+	_, err := sheets.ReadRows(sheets.FormatCSV, make([]byte, sheets.MaxFileSize+1))
+	assert.EqualError(t, err, "file is larger than the maximum of 50 MB")
+
+	_, err = sheets.ReadRows(sheets.FormatXLSX, writeXLSX(t, map[string]string{
+		"xl/worksheets/data.xml": `<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData><row r="1"><c r="XFE1"><v>1</v></c></row></sheetData></worksheet>`,
+	}))
+	assert.EqualError(t, err, "unable to read XLSX: cell XFE1 is beyond the maximum of 16384 columns")
+
+	_, err = sheets.ReadRows(sheets.FormatXLSX, writeXLSX(t, map[string]string{
+		"xl/worksheets/data.xml": `<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData><row r="1048577"><c><v>1</v></c></row></sheetData></worksheet>`,
+	}))
+	assert.EqualError(t, err, "unable to read XLSX: row 1048577 is beyond the maximum of 1048576")
+
+	// parts which declare a huge uncompressed size aren't read
+	b := &bytes.Buffer{}
+	zw := zip.NewWriter(b)
+	f, err := zw.CreateRaw(&zip.FileHeader{Name: "xl/workbook.xml", Method: zip.Store, CompressedSize64: 4, UncompressedSize64: 1 << 40})
+	require.NoError(t, err)
+	f.Write([]byte("<a/>"))
+	require.NoError(t, zw.Close())
+
+	_, err = sheets.ReadRows(sheets.FormatXLSX, b.Bytes())
+	assert.EqualError(t, err, "unable to read XLSX: xl/workbook.xml is larger than the maximum of 250 MB")
+}
+
+// writeXLSX creates an XLSX file whose first worksheet is xl/worksheets/data.xml from the given parts
+func writeXLSX(t *testing.T, parts map[string]string) []byte {
+	b := &bytes.Buffer{}
+	zw := zip.NewWriter(b)
+
+	parts["xl/workbook.xml"] = `<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"><sheets><sheet name="Data" sheetId="1" r:id="rId3"/></sheets></workbook>`
+	parts["xl/_rels/workbook.xml.rels"] = `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships"><Relationship Id="rId3" Target="/xl/worksheets/data.xml"/></Relationships>`
+
+	for name, content := range parts {
+		f, err := zw.Create(name)
+		require.NoError(t, err)
+		f.Write([]byte(content))
+	}
+	require.NoError(t, zw.Close())
+
+	return b.Bytes()
+}
@@ -0,0 +1,212 @@
+package sheets
+
+import (
+	"archive/zip"
+	"encoding/csv"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Format is a spreadsheet file format
+type Format string
+
+const (
+	FormatCSV  Format = "csv"
+	FormatXLSX Format = "xlsx"
+)
+
+// ContentType returns the MIME type of files in this format
+func (f Format) ContentType() string {
+	if f == FormatXLSX {
+		return "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+	}
+	return "text/csv"
+}
+
+// MaxXLSXRows is the maximum number of rows in a worksheet, including the header row, after which rows continue on a
+// new worksheet
+var MaxXLSXRows = 1048576
+
+// Writer writes rows to a spreadsheet file as they're generated, so the whole file is never in memory
+type Writer interface {
+	WriteRow([]string) error
+	Close() error
+}
+
+// NewWriter creates a new writer for the given format which writes the given header row first
+func NewWriter(format Format, w io.Writer, sheetName string, header []string) (Writer, error) {
+	switch format {
+	case FormatCSV:
+		return newCSVWriter(w, header)
+	case FormatXLSX:
+		return newXLSXWriter(w, sheetName, header)
+	}
+	return nil, fmt.Errorf("unsupported format: %s", format)
+}
+
+type csvWriter struct {
+	w *csv.Writer
+}
+
+func newCSVWriter(w io.Writer, header []string) (*csvWriter, error) {
+	cw := &csvWriter{w: csv.NewWriter(w)}
+	if err := cw.WriteRow(header); err != nil {
+		return nil, err
+	}
+	return cw, nil
+}
+
+func (w *csvWriter) WriteRow(row []string) error {
+	return w.w.Write(row)
+}
+
+func (w *csvWriter) Close() error {
+	w.w.Flush()
+	return w.w.Error()
+}
+
+// xlsxWriter writes a minimal XLSX file using inline strings so that rows can be streamed into the worksheet part of
+// the zip. The other parts are written on close once we know how many worksheets there are.
+type xlsxWriter struct {
+	zw        *zip.Writer
+	sheetName string
+	header    []string
+
+	sheet     io.Writer
+	numSheets int
+	numRows   int // in current sheet
+}
+
+func newXLSXWriter(w io.Writer, sheetName string, header []string) (*xlsxWriter, error) {
+	xw := &xlsxWriter{zw: zip.NewWriter(w), sheetName: sheetName, header: header}
+	if err := xw.startSheet(); err != nil {
+		return nil, err
+	}
+	return xw, nil
+}
+
+func (w *xlsxWriter) startSheet() error {
+	if w.sheet != nil {
+		if _, err := io.WriteString(w.sheet, `</sheetData></worksheet>`); err != nil {
+			return err
+		}
+	}
+
+	w.numSheets++
+	w.numRows = 0
+
+	sheet, err := w.zw.Create(fmt.Sprintf("xl/worksheets/sheet%d.xml", w.numSheets))
+	if err != nil {
+		return err
+	}
+	w.sheet = sheet
+
+	if _, err := io.WriteString(w.sheet, xml.Header+`<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`); err != nil {
+		return err
+	}
+	return w.writeRow(w.header)
+}
+
+func (w *xlsxWriter) WriteRow(row []string) error {
+	if w.numRows >= MaxXLSXRows {
+		if err := w.startSheet(); err != nil {
+			return err
+		}
+	}
+	return w.writeRow(row)
+}
+
+func (w *xlsxWriter) writeRow(row []string) error {
+	w.numRows++
+
+	b := &strings.Builder{}
+	fmt.Fprintf(b, `<row r="%d">`, w.numRows)
+	for i, v := range row {
+		if v == "" {
+			continue
+		}
+		fmt.Fprintf(b, `<c r="%s%d" t="inlineStr"><is><t xml:space="preserve">`, columnName(i), w.numRows)
+		escapeXML(b, v)
+		b.WriteString(`</t></is></c>`)
+	}
+	b.WriteString(`</row>`)
+
+	_, err := io.WriteString(w.sheet, b.String())
+	return err
+}
+
+func (w *xlsxWriter) Close() error {
+	if _, err := io.WriteString(w.sheet, `</sheetData></worksheet>`); err != nil {
+		return err
+	}
+
+	sheets, sheetRels, sheetTypes := &strings.Builder{}, &strings.Builder{}, &strings.Builder{}
+	for i := 1; i <= w.numSheets; i++ {
+		name := w.sheetName
+		if i > 1 {
+			name = fmt.Sprintf("%s (%d)", w.sheetName, i)
+		}
+
+		sheets.WriteString(`<sheet name="`)
+		escapeXML(sheets, name)
+		fmt.Fprintf(sheets, `" sheetId="%d" r:id="rId%d"/>`, i, i)
+		fmt.Fprintf(sheetRels, `<Relationship Id="rId%d" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet%d.xml"/>`, i, i)
+		fmt.Fprintf(sheetTypes, `<Override PartName="/xl/worksheets/sheet%d.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>`, i)
+	}
+
+	parts := []struct{ name, content string }{
+		{"[Content_Types].xml", `<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">` +
+			`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>` +
+			`<Default Extension="xml" ContentType="application/xml"/>` +
+			`<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>` +
+			sheetTypes.String() + `</Types>`},
+		{"_rels/.rels", `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+			`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>` +
+			`</Relationships>`},
+		{"xl/workbook.xml", `<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">` +
+			`<sheets>` + sheets.String() + `</sheets></workbook>`},
+		{"xl/_rels/workbook.xml.rels", `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+			sheetRels.String() + `</Relationships>`},
+	}
+
+	for _, p := range parts {
+		f, err := w.zw.Create(p.name)
+		if err != nil {
+			return err
+		}
+		if _, err := io.WriteString(f, xml.Header+p.content); err != nil {
+			return err
+		}
+	}
+
+	return w.zw.Close()
+}
+
+// columnName converts a zero-based column index to a column name, e.g. 0 -> A, 26 -> AA
+func columnName(i int) string {
+	name := ""
+	for i++; i > 0; i = (i - 1) / 26 {
+		name = string(rune('A'+(i-1)%26)) + name
+	}
+	return name
+}
+
+// escapeXML writes the given text escaped for XML, dropping any characters which aren't allowed in XML documents
+func escapeXML(b *strings.Builder, s string) {
+	for _, r := range s {
+		switch {
+		case r == '<':
+			b.WriteString("&lt;")
+		case r == '>':
+			b.WriteString("&gt;")
+		case r == '&':
+			b.WriteString("&amp;")
+		case r == '"':
+			b.WriteString("&quot;")
+		case r == '\t' || r == '\n' || r == '\r' || (r >= 0x20 && r <= 0xD7FF) || (r >= 0xE000 && r <= 0xFFFD) || r > 0xFFFF:
+			b.WriteRune(r)
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package sheets_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/nyaruka/mailroom/v26/utils/sheets"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCSVWriter(t *testing.T) {
+	b := &bytes.Buffer{}
+	w, err := sheets.NewWriter(sheets.FormatCSV, b, "Contacts", []string{"Name", "Age"})
+	require.NoError(t, err)
+
+	require.NoError(t, w.WriteRow([]string{"Ann", "23"}))
+	require.NoError(t, w.WriteRow([]string{"Bob, Jr", ""}))
+	require.NoError(t, w.Close())
+
+	assert.Equal(t, "Name,Age\nAnn,23\n\"Bob, Jr\",\n", b.String())
+	assert.Equal(t, "text/csv", sheets.FormatCSV.ContentType())
+}
+
+func TestXLSXWriter(t *testing.T) {
+	defer func() { sheets.MaxXLSXRows = 1048576 }()
+
+	sheets.MaxXLSXRows = 3
+
+	b := &bytes.Buffer{}
+	w, err := sheets.NewWriter(sheets.FormatXLSX, b, "Contacts", []string{"Name", "Age"})
+	require.NoError(t, err)
+
+	require.NoError(t, w.WriteRow([]string{"Ann", "23"}))
+	require.NoError(t, w.WriteRow([]string{"Bob & <Co>", ""}))
+	require.NoError(t, w.WriteRow([]string{"Cat\x00", "45"}))
+	require.NoError(t, w.Close())
+
+	zr, err := zip.NewReader(bytes.NewReader(b.Bytes()), int64(b.Len()))
+	require.NoError(t, err)
+
+	files := make(map[string]string, len(zr.File))
+	for _, f := range zr.File {
+		r, err := f.Open()
+		require.NoError(t, err)
+		content, err := io.ReadAll(r)
+		require.NoError(t, err)
+		files[f.Name] = string(content)
+	}
+
+	assert.Len(t, files, 6)
+	assert.Contains(t, files["xl/worksheets/sheet1.xml"], `<row r="1"><c r="A1" t="inlineStr"><is><t xml:space="preserve">Name</t></is></c><c r="B1" t="inlineStr"><is><t xml:space="preserve">Age</t></is></c></row>`)
+	assert.Contains(t, files["xl/worksheets/sheet1.xml"], `<row r="3"><c r="A3" t="inlineStr"><is><t xml:space="preserve">Bob &amp; &lt;Co&gt;</t></is></c></row></sheetData></worksheet>`)
+	assert.Contains(t, files["xl/worksheets/sheet2.xml"], `<row r="2"><c r="A2" t="inlineStr"><is><t xml:space="preserve">Cat</t></is></c><c r="B2" t="inlineStr"><is><t xml:space="preserve">45</t></is></c></row>`)
+	assert.Contains(t, files["xl/workbook.xml"], `<sheet name="Contacts" sheetId="1" r:id="rId1"/><sheet name="Contacts (2)" sheetId="2" r:id="rId2"/>`)
+	assert.Contains(t, files["[Content_Types].xml"], `/xl/worksheets/sheet2.xml`)
+
+	_, err = sheets.NewWriter("pdf", b, "Contacts", []string{"Name"})
+	assert.EqualError(t, err, "unsupported format: pdf")
+}
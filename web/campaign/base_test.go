@@ -4,6 +4,7 @@ import (
 	"testing"
 
 	"github.com/nyaruka/mailroom/v26/testsuite"
+	"github.com/nyaruka/mailroom/v26/testsuite/testdb"
 )
 
 func TestSchedule(t *testing.T) {
@@ -11,3 +12,17 @@ func TestSchedule(t *testing.T) {
 
 	testsuite.RunWebTests(t, rt, "testdata/schedule.json")
 }
+
+func TestPreview(t *testing.T) {
+	_, rt := testsuite.Runtime(t)
+
+	testsuite.RunWebTests(t, rt, "testdata/preview.json")
+}
+
+func TestDripEnroll(t *testing.T) {
+	_, rt := testsuite.Runtime(t)
+
+	rt.DB.MustExec(`UPDATE orgs_org SET config = config || '{"drip_sequences": {"6c3b2f4e-8a1d-4e5f-9b7c-2d4e6f8a0b1c": {"name": "Onboarding", "steps": [{"offset": 1, "unit": "D", "flow_uuid": "9de3663f-c5c5-4c92-9f45-ecbc09abcc85"}]}, "d5a8c7e4-1f2b-4c3d-8e9f-0a1b2c3d4e5f": {"name": "Empty", "steps": []}}}'::jsonb WHERE id = $1`, testdb.Org1.ID)
+
+	testsuite.RunWebTests(t, rt, "testdata/drip_enroll.json")
+}
@@ -0,0 +1,56 @@
+package campaign
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/nyaruka/gocommon/dates"
+	"github.com/nyaruka/mailroom/v26/core/models"
+	"github.com/nyaruka/mailroom/v26/runtime"
+	"github.com/nyaruka/mailroom/v26/web"
+)
+
+func init() {
+	web.InternalRoute(http.MethodPost, "/campaign/drip_enroll", web.JSONPayload(handleDripEnroll))
+}
+
+// Request to enroll contacts in a drip sequence, scheduling its first step for them. Contacts already enrolled in the
+// sequence start again from the first step.
+//
+//	{
+//	  "org_id": 1,
+//	  "sequence_uuid": "5e4a2d8c-3b4f-4c8e-9e0a-1d2c3b4a5f6e",
+//	  "contact_ids": [10000, 10001]
+//	}
+//
+//	{
+//	  "enrolled": [10000, 10001]
+//	}
+type dripEnrollRequest struct {
+	OrgID        models.OrgID            `json:"org_id"        validate:"required"`
+	SequenceUUID models.DripSequenceUUID `json:"sequence_uuid" validate:"required"`
+	ContactIDs   []models.ContactID      `json:"contact_ids"   validate:"required"`
+}
+
+func handleDripEnroll(ctx context.Context, rt *runtime.Runtime, r *dripEnrollRequest) (any, int, error) {
+	oa, err := models.GetOrgAssets(ctx, rt, r.OrgID)
+	if err != nil {
+		return nil, 0, fmt.Errorf("error loading org assets: %w", err)
+	}
+
+	seq := oa.Org().DripSequence(r.SequenceUUID)
+	if seq == nil {
+		return fmt.Errorf("no such drip sequence with uuid %s", r.SequenceUUID), http.StatusBadRequest, nil
+	}
+	if len(seq.Steps) == 0 {
+		return fmt.Errorf("drip sequence %s has no steps", r.SequenceUUID), http.StatusBadRequest, nil
+	}
+
+	enrolled, err := models.EnrollInDripSequence(ctx, rt.DB, oa, seq, r.ContactIDs, dates.Now())
+	if err != nil {
+		return nil, 0, fmt.Errorf("error enrolling contacts in drip sequence: %w", err)
+	}
+
+	return map[string]any{"enrolled": enrolled}, http.StatusOK, nil
+}
@@ -0,0 +1,92 @@
+package campaign
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/nyaruka/mailroom/v26/core/models"
+	"github.com/nyaruka/mailroom/v26/runtime"
+	"github.com/nyaruka/mailroom/v26/web"
+)
+
+const (
+	previewDefaultDays = 30
+	previewNumSamples  = 10
+)
+
+func init() {
+	web.InternalRoute(http.MethodPost, "/campaign/preview", web.JSONPayload(handlePreview))
+}
+
+// Request to preview when the points of a campaign, or a single point, would fire for currently eligible contacts over
+// the next number of days (defaults to 30).
+//
+//	{
+//	  "org_id": 1,
+//	  "campaign_id": 123,
+//	  "days": 14
+//	}
+//
+// Returns the projected fires per day and hour in the org's timezone, the busiest hour and a sample of the earliest
+// fires:
+//
+//	{
+//	  "total": 2,
+//	  "days": [
+//	    {"date": "2025-05-06", "count": 2, "hours": [0, 0, 0, 0, 0, 0, 0, 0, 0, 2, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0]}
+//	  ],
+//	  "peak": {"date": "2025-05-06", "hour": 9, "count": 2},
+//	  "samples": [
+//	    {
+//	      "contact": {"uuid": "a393abc0-283d-4c9b-a1b3-641a035c34bf", "name": "Ann"},
+//	      "point_id": 10000,
+//	      "scheduled": "2025-05-06T09:00:00-07:00"
+//	    },
+//	    ...
+//	  ]
+//	}
+type previewRequest struct {
+	OrgID      models.OrgID      `json:"org_id"      validate:"required"`
+	CampaignID models.CampaignID `json:"campaign_id"`
+	PointID    models.PointID    `json:"point_id"`
+	Days       int               `json:"days"        validate:"omitempty,min=1,max=365"`
+}
+
+func handlePreview(ctx context.Context, rt *runtime.Runtime, r *previewRequest) (any, int, error) {
+	oa, err := models.GetOrgAssets(ctx, rt, r.OrgID)
+	if err != nil {
+		return nil, 0, fmt.Errorf("error loading org assets: %w", err)
+	}
+
+	var points []*models.CampaignPoint
+
+	if r.PointID != 0 {
+		p := oa.CampaignPointByID(r.PointID)
+		if p == nil {
+			return fmt.Errorf("no such campaign point with id %d", r.PointID), http.StatusBadRequest, nil
+		}
+		points = []*models.CampaignPoint{p}
+	} else if r.CampaignID != 0 {
+		c := oa.CampaignByID(r.CampaignID)
+		if c == nil {
+			return fmt.Errorf("no such campaign with id %d", r.CampaignID), http.StatusBadRequest, nil
+		}
+		points = c.Points()
+	} else {
+		return errors.New("one of campaign_id or point_id is required"), http.StatusBadRequest, nil
+	}
+
+	days := r.Days
+	if days == 0 {
+		days = previewDefaultDays
+	}
+
+	preview, err := models.PreviewCampaignPoints(ctx, rt, oa, points, days, previewNumSamples)
+	if err != nil {
+		return nil, 0, fmt.Errorf("error previewing campaign: %w", err)
+	}
+
+	return preview, http.StatusOK, nil
+}
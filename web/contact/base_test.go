@@ -4,10 +4,12 @@ import (
 	"testing"
 	"time"
 
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
 	"github.com/nyaruka/gocommon/i18n"
 	"github.com/nyaruka/gocommon/urns"
 	"github.com/nyaruka/goflow/assets"
 	"github.com/nyaruka/goflow/core"
+	"github.com/nyaruka/goflow/core/events"
 	"github.com/nyaruka/goflow/envs"
 	"github.com/nyaruka/goflow/test"
 	"github.com/nyaruka/mailroom/v26/core/models"
@@ -30,6 +32,12 @@ func TestCreate(t *testing.T) {
 	testsuite.RunWebTests(t, rt, "testdata/create.json")
 }
 
+func TestDataExport(t *testing.T) {
+	_, rt := testsuite.Runtime(t)
+
+	testsuite.RunWebTests(t, rt, "testdata/data_export.json")
+}
+
 func TestDeindex(t *testing.T) {
 	ctx, rt := testsuite.Runtime(t)
 
@@ -74,6 +82,29 @@ func TestReindex(t *testing.T) {
 	testsuite.RunWebTests(t, rt, "testdata/reindex.json")
 }
 
+func TestDuplicates(t *testing.T) {
+	ctx, rt := testsuite.Runtime(t)
+
+	// give Cat Ann's number as a WhatsApp URN and record duplicates
+	testdb.InsertContactURN(t, rt, testdb.Org1, testdb.Cat, urns.URN("whatsapp:16055741111"), 999, nil)
+
+	oa := testdb.Org1.Load(t, rt)
+	mcs, err := models.LoadContacts(ctx, rt.DB, oa, []models.ContactID{testdb.Ann.ID, testdb.Cat.ID})
+	require.NoError(t, err)
+	_, err = models.RecordContactDuplicates(ctx, rt, oa, mcs)
+	require.NoError(t, err)
+
+	testsuite.RunWebTests(t, rt, "testdata/duplicates.json")
+}
+
+func TestErase(t *testing.T) {
+	_, rt := testsuite.Runtime(t)
+
+	rt.DB.MustExec(`UPDATE contacts_contact SET is_active = FALSE WHERE id = $1`, testdb.Bob.ID)
+
+	testsuite.RunWebTests(t, rt, "testdata/erase.json")
+}
+
 func TestExport(t *testing.T) {
 	_, rt := testsuite.Runtime(t)
 
@@ -82,6 +113,16 @@ func TestExport(t *testing.T) {
 	testsuite.RunWebTests(t, rt, "testdata/export.json")
 }
 
+func TestExportFile(t *testing.T) {
+	_, rt := testsuite.Runtime(t)
+
+	testdb.InsertExport(t, rt, testdb.Org1, models.ExportTypeContact, models.ExportStatusPending, map[string]any{"group_id": testdb.TestersGroup.ID}, testdb.Admin)
+	testdb.InsertExport(t, rt, testdb.Org1, "message", models.ExportStatusPending, map[string]any{}, testdb.Admin)
+	testdb.InsertExport(t, rt, testdb.Org1, models.ExportTypeContact, models.ExportStatusComplete, map[string]any{"group_id": testdb.TestersGroup.ID}, testdb.Admin)
+
+	testsuite.RunWebTests(t, rt, "testdata/export_file.json")
+}
+
 func TestExportPreview(t *testing.T) {
 	_, rt := testsuite.Runtime(t)
 
@@ -90,6 +131,22 @@ func TestExportPreview(t *testing.T) {
 	testsuite.RunWebTests(t, rt, "testdata/export_preview.json")
 }
 
+func TestFieldHistory(t *testing.T) {
+	_, rt := testsuite.Runtime(t)
+
+	oa := testdb.Org1.Load(t, rt)
+
+	// record a change to Ann's age made by a user
+	e, err := events.Read([]byte(`{"uuid": "0197b335-6ded-79a4-95a6-3af85b57f101", "type": "contact_field_changed", "created_on": "2025-05-01T12:00:00Z", "field": {"key": "age", "name": "Age"}, "value": {"text": "44", "number": 44}}`))
+	require.NoError(t, err)
+
+	_, err = rt.Dynamo.Main.Queue(models.NewFieldChange(oa, testdb.Ann.UUID, oa.FieldByKey("age"), e.(*events.ContactFieldChanged), nil, testdb.Admin.ID))
+	require.NoError(t, err)
+	rt.Dynamo.Main.Flush()
+
+	testsuite.RunWebTests(t, rt, "testdata/field_history.json")
+}
+
 func TestImport(t *testing.T) {
 	_, rt := testsuite.Runtime(t)
 
@@ -109,6 +166,20 @@ func TestImport(t *testing.T) {
 	testsuite.RunWebTests(t, rt, "testdata/import.json")
 }
 
+func TestImportFile(t *testing.T) {
+	ctx, rt := testsuite.Runtime(t)
+
+	_, err := rt.S3.PutObject(ctx, rt.Config.S3ExportsBucket, "imports/1/contacts.csv", "text/csv", []byte(
+		"Name,URN:tel,Field:Gender,Group:Testers\n"+
+			"Norbert,+16055740001,M,yes\n"+
+			"Leah,+16055740002,F,\n"+
+			"Rowan,call me,,\n",
+	), types.ObjectCannedACLPrivate)
+	require.NoError(t, err)
+
+	testsuite.RunWebTests(t, rt, "testdata/import_file.json")
+}
+
 func TestInspect(t *testing.T) {
 	_, rt := testsuite.Runtime(t)
 
@@ -118,6 +189,20 @@ func TestInspect(t *testing.T) {
 	testsuite.RunWebTests(t, rt, "testdata/inspect.json")
 }
 
+func TestMerge(t *testing.T) {
+	_, rt := testsuite.Runtime(t)
+
+	rt.DB.MustExec(`UPDATE contacts_contact SET name = '', fields = '{"3a5891e4-756e-4dc9-8e12-b7a766168824": {"text": "F"}}' WHERE id = $1`, testdb.Ann.ID)
+	rt.DB.MustExec(`UPDATE contacts_contact SET fields = '{"3a5891e4-756e-4dc9-8e12-b7a766168824": {"text": "M"}, "903f51da-2717-47c7-a0d3-f2f32877013d": {"text": "32", "number": 32}}' WHERE id = $1`, testdb.Bob.ID)
+	rt.DB.MustExec(`UPDATE contacts_contact SET fields = '{"3a5891e4-756e-4dc9-8e12-b7a766168824": {"text": "X"}}' WHERE id = $1`, testdb.Cat.ID)
+
+	testdb.TestersGroup.Add(rt, testdb.Bob)
+	testdb.InsertOpenTicket(t, rt, "01992f54-5ab6-717a-a39e-e8ca91fb7262", testdb.Org1, testdb.Bob, testdb.DefaultTopic, time.Now(), nil)
+	testdb.InsertOpenTicket(t, rt, "01992f54-5ab6-725e-be9c-0c6407efd755", testdb.Org1, testdb.Cat, testdb.DefaultTopic, time.Now(), nil)
+
+	testsuite.RunWebTests(t, rt, "testdata/merge.json")
+}
+
 func TestModify(t *testing.T) {
 	ctx, rt := testsuite.Runtime(t)
 
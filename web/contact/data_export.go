@@ -0,0 +1,65 @@
+package contact
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/nyaruka/mailroom/v26/core/models"
+	"github.com/nyaruka/mailroom/v26/core/tasks"
+	"github.com/nyaruka/mailroom/v26/runtime"
+	"github.com/nyaruka/mailroom/v26/web"
+)
+
+func init() {
+	web.InternalRoute(http.MethodPost, "/contact/data_export", web.JSONPayload(handleDataExport))
+}
+
+// Request that everything we hold about a contact is exported to a file, e.g. to fulfil a subject access request. An
+// export is created and a task queued which writes the file to S3 and notifies the requesting user when it's done. If
+// with_attachments is set, the file is a zip which also contains attachments on the contact's messages.
+//
+//	{
+//	  "org_id": 1,
+//	  "user_id": 3,
+//	  "contact_id": 10000,
+//	  "with_attachments": true
+//	}
+//
+// Returns the id of the export:
+//
+//	{
+//	  "export_id": 123
+//	}
+type dataExportRequest struct {
+	OrgID           models.OrgID     `json:"org_id"           validate:"required"`
+	UserID          models.UserID    `json:"user_id"          validate:"required"`
+	ContactID       models.ContactID `json:"contact_id"       validate:"required"`
+	WithAttachments bool             `json:"with_attachments"`
+}
+
+func handleDataExport(ctx context.Context, rt *runtime.Runtime, r *dataExportRequest) (any, int, error) {
+	oa, err := models.GetOrgAssets(ctx, rt, r.OrgID)
+	if err != nil {
+		return nil, 0, fmt.Errorf("unable to load org assets: %w", err)
+	}
+
+	if _, err := models.LoadContact(ctx, rt.ReadonlyDB, oa, r.ContactID); errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("no such contact with id %d", r.ContactID), http.StatusBadRequest, nil
+	} else if err != nil {
+		return nil, 0, fmt.Errorf("error loading contact: %w", err)
+	}
+
+	export, err := models.InsertExport(ctx, rt.DB, r.OrgID, models.ExportTypeContactData, &models.ContactDataExportConfig{ContactID: r.ContactID, WithAttachments: r.WithAttachments}, r.UserID)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if err := tasks.Queue(ctx, rt, rt.Queues.Batch, r.OrgID, &tasks.ExportContactData{ExportID: export.ID}, true); err != nil {
+		return nil, 0, fmt.Errorf("error queuing export contact data task: %w", err)
+	}
+
+	return map[string]any{"export_id": export.ID}, http.StatusOK, nil
+}
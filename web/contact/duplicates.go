@@ -0,0 +1,83 @@
+package contact
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/nyaruka/mailroom/v26/core/models"
+	"github.com/nyaruka/mailroom/v26/core/tasks"
+	"github.com/nyaruka/mailroom/v26/runtime"
+	"github.com/nyaruka/mailroom/v26/web"
+)
+
+func init() {
+	web.InternalRoute(http.MethodPost, "/contact/find_duplicates", web.JSONPayload(handleFindDuplicates))
+	web.InternalRoute(http.MethodPost, "/contact/duplicates", web.JSONPayload(handleDuplicates))
+}
+
+// Triggers a search for probable duplicate contacts in a task. Unless full is set, only contacts created or modified
+// since the last search are checked.
+//
+//	{
+//	  "org_id": 1,
+//	  "full": false
+//	}
+type findDuplicatesRequest struct {
+	OrgID models.OrgID `json:"org_id" validate:"required"`
+	Full  bool         `json:"full"`
+}
+
+// handles a request to find probable duplicate contacts
+func handleFindDuplicates(ctx context.Context, rt *runtime.Runtime, r *findDuplicatesRequest) (any, int, error) {
+	task := &tasks.FindContactDuplicates{Full: r.Full}
+
+	if err := tasks.Queue(ctx, rt, rt.Queues.Batch, r.OrgID, task, true); err != nil {
+		return nil, 0, fmt.Errorf("error queuing find contact duplicates task: %w", err)
+	}
+
+	return map[string]any{}, http.StatusOK, nil
+}
+
+// Lists the highest scoring pairs of probable duplicate contacts found by previous searches.
+//
+//	{
+//	  "org_id": 1,
+//	  "limit": 50
+//	}
+type duplicatesRequest struct {
+	OrgID models.OrgID `json:"org_id" validate:"required"`
+	Limit int          `json:"limit"`
+}
+
+// Response for a duplicates request.
+//
+//	{
+//	  "duplicates": [
+//	    {"contact_ids": [10000, 10002], "score": 0.96, "reasons": ["email", "name_fields"]}
+//	  ]
+//	}
+type duplicatesResponse struct {
+	Duplicates []*models.ContactDuplicate `json:"duplicates"`
+}
+
+// handles a request to list probable duplicate contacts
+func handleDuplicates(ctx context.Context, rt *runtime.Runtime, r *duplicatesRequest) (any, int, error) {
+	oa, err := models.GetOrgAssets(ctx, rt, r.OrgID)
+	if err != nil {
+		return nil, 0, fmt.Errorf("error loading org assets: %w", err)
+	}
+
+	limit := r.Limit
+	if limit <= 0 {
+		limit = 50
+	}
+	limit = min(limit, 1000)
+
+	duplicates, err := models.GetContactDuplicates(ctx, rt, oa, limit)
+	if err != nil {
+		return nil, 0, fmt.Errorf("error getting contact duplicates: %w", err)
+	}
+
+	return &duplicatesResponse{Duplicates: duplicates}, http.StatusOK, nil
+}
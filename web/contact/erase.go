@@ -0,0 +1,49 @@
+package contact
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/nyaruka/goflow/core"
+	"github.com/nyaruka/mailroom/v26/core/models"
+	"github.com/nyaruka/mailroom/v26/core/tasks"
+	"github.com/nyaruka/mailroom/v26/runtime"
+	"github.com/nyaruka/mailroom/v26/web"
+)
+
+func init() {
+	web.InternalRoute(http.MethodPost, "/contact/erase", web.JSONPayload(handleErase))
+}
+
+// Triggers erasure of everything we still hold about a released contact in a task.
+//
+//	{
+//	  "org_id": 1,
+//	  "user_id": 3,
+//	  "contact_uuid": "548f43fb-f32a-491f-abb7-0c29a453a06e"
+//	}
+type eraseRequest struct {
+	OrgID       models.OrgID     `json:"org_id"       validate:"required"`
+	UserID      models.UserID    `json:"user_id"      validate:"required"`
+	ContactUUID core.ContactUUID `json:"contact_uuid" validate:"required"`
+}
+
+// handles a request to erase a contact
+func handleErase(ctx context.Context, rt *runtime.Runtime, r *eraseRequest) (any, int, error) {
+	released, err := models.IsContactReleased(ctx, rt.DB, r.OrgID, r.ContactUUID)
+	if err != nil {
+		return nil, 0, err
+	}
+	if !released {
+		return fmt.Errorf("contact %s doesn't exist or hasn't been released", r.ContactUUID), http.StatusBadRequest, nil
+	}
+
+	task := &tasks.EraseContact{ContactUUID: r.ContactUUID, UserID: r.UserID}
+
+	if err := tasks.Queue(ctx, rt, rt.Queues.Batch, r.OrgID, task, true); err != nil {
+		return nil, 0, fmt.Errorf("error queuing erase contact task: %w", err)
+	}
+
+	return map[string]any{}, http.StatusOK, nil
+}
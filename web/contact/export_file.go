@@ -0,0 +1,50 @@
+package contact
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/nyaruka/mailroom/v26/core/models"
+	"github.com/nyaruka/mailroom/v26/core/tasks"
+	"github.com/nyaruka/mailroom/v26/runtime"
+	"github.com/nyaruka/mailroom/v26/web"
+)
+
+func init() {
+	web.InternalRoute(http.MethodPost, "/contact/export_file", web.JSONPayload(handleExportFile))
+}
+
+// Request that a pending contact export is performed in a task which writes the file to S3 and notifies the user who
+// created it when it's done.
+//
+//	{
+//	  "org_id": 1,
+//	  "export_id": 123
+//	}
+type exportFileRequest struct {
+	OrgID    models.OrgID    `json:"org_id"    validate:"required"`
+	ExportID models.ExportID `json:"export_id" validate:"required"`
+}
+
+func handleExportFile(ctx context.Context, rt *runtime.Runtime, r *exportFileRequest) (any, int, error) {
+	export, err := models.LoadExport(ctx, rt.DB, r.ExportID)
+	if err != nil {
+		return nil, 0, err
+	}
+	if export.OrgID != r.OrgID {
+		return fmt.Errorf("export does not belong to org"), http.StatusBadRequest, nil
+	}
+	if export.Type != models.ExportTypeContact {
+		return fmt.Errorf("export is not a contact export"), http.StatusBadRequest, nil
+	}
+	if export.Status != models.ExportStatusPending {
+		return fmt.Errorf("export is not pending"), http.StatusBadRequest, nil
+	}
+
+	if err := tasks.Queue(ctx, rt, rt.Queues.Batch, r.OrgID, &tasks.ExportContacts{ExportID: export.ID}, true); err != nil {
+		return nil, 0, fmt.Errorf("error queuing export contacts task: %w", err)
+	}
+
+	return map[string]any{}, http.StatusOK, nil
+}
@@ -0,0 +1,112 @@
+package contact
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/nyaruka/goflow/assets"
+	"github.com/nyaruka/goflow/core"
+	"github.com/nyaruka/mailroom/v26/core/models"
+	"github.com/nyaruka/mailroom/v26/runtime"
+	"github.com/nyaruka/mailroom/v26/web"
+)
+
+func init() {
+	web.InternalRoute(http.MethodPost, "/contact/field_history", web.JSONPayload(handleFieldHistory))
+}
+
+// Gets the timeline of changes to the fields of a contact, optionally only for the given field. If as_of is provided
+// then the value of the given field at that time is also returned.
+//
+//	{
+//	  "org_id": 1,
+//	  "contact_id": 10000,
+//	  "field_key": "gender",
+//	  "as_of": "2025-05-04T12:30:45.123456789Z"
+//	}
+//
+//	{
+//	  "changes": [
+//	    {
+//	      "uuid": "0198ab67-9c2e-7b7a-a0b3-7e3e8d7a1a01",
+//	      "field": {"key": "gender", "name": "Gender"},
+//	      "old_value": null,
+//	      "new_value": {"text": "Female"},
+//	      "flow": {"uuid": "9de3663f-c5c5-4c92-9f45-ecbc09abcc85", "name": "Favorites"},
+//	      "user": null,
+//	      "changed_on": "2025-05-04T12:30:45.123456789Z"
+//	    }
+//	  ],
+//	  "value": {"text": "Female"}
+//	}
+type fieldHistoryRequest struct {
+	OrgID     models.OrgID     `json:"org_id"     validate:"required"`
+	ContactID models.ContactID `json:"contact_id" validate:"required"`
+	FieldKey  string           `json:"field_key"`
+	AsOf      *time.Time       `json:"as_of"`
+}
+
+type fieldChange struct {
+	UUID      string                 `json:"uuid"`
+	Field     *assets.FieldReference `json:"field"`
+	OldValue  *core.Value            `json:"old_value"`
+	NewValue  *core.Value            `json:"new_value"`
+	Flow      *assets.FlowReference  `json:"flow"`
+	User      *assets.UserReference  `json:"user"`
+	ChangedOn time.Time              `json:"changed_on"`
+}
+
+func handleFieldHistory(ctx context.Context, rt *runtime.Runtime, r *fieldHistoryRequest) (any, int, error) {
+	if r.AsOf != nil && r.FieldKey == "" {
+		return errors.New("field_key is required when as_of is provided"), http.StatusBadRequest, nil
+	}
+
+	oa, err := models.GetOrgAssets(ctx, rt, r.OrgID)
+	if err != nil {
+		return nil, 0, fmt.Errorf("unable to load org assets: %w", err)
+	}
+
+	var field *models.Field
+	if r.FieldKey != "" {
+		if field = oa.FieldByKey(r.FieldKey); field == nil {
+			return fmt.Errorf("no such field with key '%s'", r.FieldKey), http.StatusBadRequest, nil
+		}
+	}
+
+	contact, err := models.LoadContact(ctx, rt.ReadonlyDB, oa, r.ContactID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("no such contact with id %d", r.ContactID), http.StatusBadRequest, nil
+	} else if err != nil {
+		return nil, 0, fmt.Errorf("error loading contact: %w", err)
+	}
+
+	changes, err := models.LoadFieldChanges(ctx, rt, oa, contact.UUID(), field)
+	if err != nil {
+		return nil, 0, fmt.Errorf("error loading field changes: %w", err)
+	}
+
+	response := map[string]any{}
+	timeline := make([]*fieldChange, len(changes))
+	for i, c := range changes {
+		timeline[i] = &fieldChange{
+			UUID:      string(c.UUID),
+			Field:     c.Field,
+			OldValue:  c.OldValue,
+			NewValue:  c.NewValue,
+			Flow:      c.Flow,
+			User:      oa.UserByID(c.UserID).Reference(),
+			ChangedOn: c.ChangedOn,
+		}
+	}
+	response["changes"] = timeline
+
+	if r.AsOf != nil {
+		response["value"] = models.FieldValueAt(changes, contact.Fields()[field.Key()], *r.AsOf)
+	}
+
+	return response, http.StatusOK, nil
+}
@@ -5,8 +5,6 @@ import (
 	"fmt"
 	"net/http"
 
-	"github.com/nyaruka/gocommon/dates"
-	"github.com/nyaruka/gocommon/uuids"
 	"github.com/nyaruka/mailroom/v26/core/models"
 	"github.com/nyaruka/mailroom/v26/core/tasks"
 	"github.com/nyaruka/mailroom/v26/runtime"
@@ -40,25 +38,8 @@ func handleImport(ctx context.Context, rt *runtime.Runtime, r *importRequest) (a
 		return nil, 0, fmt.Errorf("import is not processing")
 	}
 
-	// generate a UUID to own this set of batches since unlike other batch tasks, these have no parent task
-	ownerUUID := uuids.NewV7()
-
-	tasks.RecordQueued(ctx, rt, ownerUUID, &tasks.BatchInfo{
-		Type:     tasks.TypeImportContactBatch,
-		OrgID:    r.OrgID,
-		Total:    len(imp.BatchIDs),
-		QueuedOn: dates.Now(),
-	})
-
-	// create tasks for all batches
-	for _, bID := range imp.BatchIDs {
-		task := &tasks.ImportContactBatch{
-			BatchTask:            tasks.BatchTask{BatchOwnerUUID: ownerUUID, TotalBatches: len(imp.BatchIDs)},
-			ContactImportBatchID: bID,
-		}
-		if err := tasks.Queue(ctx, rt, rt.Queues.Batch, r.OrgID, task, false); err != nil {
-			return nil, 0, fmt.Errorf("error queuing import contact batch task: %w", err)
-		}
+	if err := tasks.QueueImportContactBatches(ctx, rt, r.OrgID, imp.BatchIDs); err != nil {
+		return nil, 0, err
 	}
 
 	return map[string]any{"batches": len(imp.BatchIDs)}, http.StatusOK, nil
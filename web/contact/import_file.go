@@ -0,0 +1,81 @@
+package contact
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/nyaruka/mailroom/v26/core/imports"
+	"github.com/nyaruka/mailroom/v26/core/models"
+	"github.com/nyaruka/mailroom/v26/core/tasks"
+	"github.com/nyaruka/mailroom/v26/runtime"
+	"github.com/nyaruka/mailroom/v26/utils/sheets"
+	"github.com/nyaruka/mailroom/v26/web"
+)
+
+func init() {
+	web.InternalRoute(http.MethodPost, "/contact/import_file", web.JSONPayload(handleImportFile))
+}
+
+// Request that a CSV or XLSX file already uploaded to S3 is imported. A pending import is created and a task queued which
+// parses the file into batches. If mappings aren't provided, they're derived from the header row using the same column
+// headers as contact exports. Rows with invalid values are skipped and saved as errors on the import. If dry_run is set,
+// no import is created and instead the file is parsed here and a report is returned of what the import would do.
+//
+//	{
+//	  "org_id": 1,
+//	  "user_id": 3,
+//	  "path": "imports/1/contacts.xlsx",
+//	  "filename": "contacts.xlsx",
+//	  "mappings": [{"type": "attribute", "name": "name"}, {"type": "scheme", "scheme": "tel"}],
+//	  "dry_run": false
+//	}
+type importFileRequest struct {
+	OrgID    models.OrgID       `json:"org_id"   validate:"required"`
+	UserID   models.UserID      `json:"user_id"  validate:"required"`
+	Path     string             `json:"path"     validate:"required"`
+	Filename string             `json:"filename" validate:"required"`
+	Mappings []*imports.Mapping `json:"mappings"`
+	DryRun   bool               `json:"dry_run"`
+}
+
+func handleImportFile(ctx context.Context, rt *runtime.Runtime, r *importFileRequest) (any, int, error) {
+	if _, err := sheets.FormatFromFilename(r.Filename); err != nil {
+		return err, http.StatusBadRequest, nil
+	}
+
+	if r.DryRun {
+		oa, err := models.GetOrgAssets(ctx, rt, r.OrgID)
+		if err != nil {
+			return nil, 0, fmt.Errorf("unable to load org assets: %w", err)
+		}
+
+		_, specs, importErrs, err := imports.ParseFile(ctx, rt, oa, r.Path, r.Filename, r.Mappings)
+		if err != nil {
+			var fileErr *imports.FileError
+			if errors.As(err, &fileErr) {
+				return err, http.StatusBadRequest, nil
+			}
+			return nil, 0, err
+		}
+
+		report, err := imports.DryRun(ctx, rt, oa, specs)
+		if err != nil {
+			return nil, 0, fmt.Errorf("error performing import dry run: %w", err)
+		}
+
+		return map[string]any{"num_records": len(specs), "errors": importErrs, "dry_run": report}, http.StatusOK, nil
+	}
+
+	imp, err := models.InsertContactImport(ctx, rt.DB, r.OrgID, r.UserID, r.Path, r.Filename, r.Mappings)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if err := tasks.Queue(ctx, rt, rt.Queues.Batch, r.OrgID, &tasks.ImportContactFile{ContactImportID: imp.ID}, true); err != nil {
+		return nil, 0, fmt.Errorf("error queuing import contact file task: %w", err)
+	}
+
+	return map[string]any{"import_id": imp.ID}, http.StatusOK, nil
+}
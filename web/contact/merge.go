@@ -0,0 +1,84 @@
+package contact
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/nyaruka/gocommon/urns"
+	"github.com/nyaruka/mailroom/v26/core/models"
+	"github.com/nyaruka/mailroom/v26/core/runner"
+	"github.com/nyaruka/mailroom/v26/runtime"
+	"github.com/nyaruka/mailroom/v26/web"
+)
+
+func init() {
+	web.InternalRoute(http.MethodPost, "/contact/merge", web.JSONPayload(handleMerge))
+}
+
+// Request that a duplicate contact is merged into another. Fields with values on both contacts keep the primary's value
+// unless the rules say otherwise.
+//
+//	{
+//	  "org_id": 1,
+//	  "user_id": 3,
+//	  "primary_id": 234,
+//	  "secondary_id": 345,
+//	  "rules": {"fields": "primary", "field_overrides": {"gender": "secondary"}},
+//	  "via": "ui"
+//	}
+type mergeRequest struct {
+	OrgID       models.OrgID      `json:"org_id"       validate:"required"`
+	UserID      models.UserID     `json:"user_id"      validate:"required"`
+	PrimaryID   models.ContactID  `json:"primary_id"   validate:"required"`
+	SecondaryID models.ContactID  `json:"secondary_id" validate:"required"`
+	Rules       runner.MergeRules `json:"rules"`
+	Via         models.Via        `json:"via"          validate:"required,eq=api|eq=ui"`
+}
+
+// Response for a contact merge.
+//
+//	{
+//	  "moved_urns": ["tel:+250788123123"],
+//	  "moved_tickets": 1,
+//	  "copied_history": 23
+//	}
+type mergeResponse struct {
+	MovedURNs     []urns.URN `json:"moved_urns"`
+	MovedTickets  int        `json:"moved_tickets"`
+	CopiedHistory int        `json:"copied_history"`
+}
+
+func handleMerge(ctx context.Context, rt *runtime.Runtime, r *mergeRequest) (any, int, error) {
+	if r.PrimaryID == r.SecondaryID {
+		return fmt.Errorf("can't merge a contact with itself"), http.StatusBadRequest, nil
+	}
+
+	oa, err := models.GetOrgAssets(ctx, rt, r.OrgID)
+	if err != nil {
+		return nil, 0, fmt.Errorf("error loading org assets: %w", err)
+	}
+
+	for key := range r.Rules.FieldOverrides {
+		if oa.FieldByKey(key) == nil {
+			return fmt.Errorf("unknown contact field '%s'", key), http.StatusBadRequest, nil
+		}
+	}
+
+	for _, contactID := range []models.ContactID{r.PrimaryID, r.SecondaryID} {
+		if _, err := models.LoadContact(ctx, rt.DB, oa, contactID); errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("no such contact with id %d", contactID), http.StatusBadRequest, nil
+		} else if err != nil {
+			return nil, 0, fmt.Errorf("error loading contact: %w", err)
+		}
+	}
+
+	result, err := runner.MergeWithLock(ctx, rt, oa, r.UserID, r.PrimaryID, r.SecondaryID, &r.Rules, r.Via)
+	if err != nil {
+		return nil, 0, fmt.Errorf("error merging contacts: %w", err)
+	}
+
+	return &mergeResponse{MovedURNs: result.MovedURNs, MovedTickets: result.MovedTickets, CopiedHistory: result.CopiedHistory}, http.StatusOK, nil
+}
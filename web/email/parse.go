@@ -0,0 +1,195 @@
+package email
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"html"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"regexp"
+	"strings"
+)
+
+// inboundEmail is what we need from a received MIME message
+type inboundEmail struct {
+	messageID   string
+	inReplyTo   []string // Message-IDs from In-Reply-To and References, most relevant first
+	from        string
+	subject     string
+	text        string
+	html        string
+	attachments []*inboundAttachment
+}
+
+type inboundAttachment struct {
+	filename    string
+	contentType string
+	content     []byte
+}
+
+// parseEmail parses a raw RFC 5322 message, collecting the first plain text and HTML bodies and any attachments
+func parseEmail(raw []byte) (*inboundEmail, error) {
+	msg, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		return nil, fmt.Errorf("unable to read message: %w", err)
+	}
+
+	from, err := msg.Header.AddressList("From")
+	if err != nil || len(from) == 0 {
+		return nil, fmt.Errorf("missing or invalid From header")
+	}
+
+	messageIDs := parseMessageIDs(msg.Header.Get("Message-ID"))
+	if len(messageIDs) == 0 {
+		return nil, fmt.Errorf("missing Message-ID header")
+	}
+
+	subject, err := (&mime.WordDecoder{}).DecodeHeader(msg.Header.Get("Subject"))
+	if err != nil {
+		subject = msg.Header.Get("Subject")
+	}
+
+	// In-Reply-To should be the direct parent but References lists the whole thread oldest first, so check those
+	// newest first after it
+	inReplyTo := parseMessageIDs(msg.Header.Get("In-Reply-To"))
+	references := parseMessageIDs(msg.Header.Get("References"))
+	for i := len(references) - 1; i >= 0; i-- {
+		inReplyTo = append(inReplyTo, references[i])
+	}
+
+	e := &inboundEmail{
+		messageID: messageIDs[0],
+		inReplyTo: inReplyTo,
+		from:      from[0].Address,
+		subject:   strings.TrimSpace(subject),
+	}
+
+	if err := e.readPart(textproto.MIMEHeader(msg.Header), msg.Body); err != nil {
+		return nil, err
+	}
+
+	return e, nil
+}
+
+func (e *inboundEmail) readPart(header textproto.MIMEHeader, body io.Reader) error {
+	mediaType, params, err := mime.ParseMediaType(header.Get("Content-Type"))
+	if err != nil {
+		mediaType, params = "text/plain", nil
+	}
+
+	if strings.HasPrefix(mediaType, "multipart/") {
+		mr := multipart.NewReader(body, params["boundary"])
+		for {
+			part, err := mr.NextRawPart()
+			if err == io.EOF {
+				return nil
+			} else if err != nil {
+				return fmt.Errorf("unable to read multipart body: %w", err)
+			}
+
+			if err := e.readPart(part.Header, part); err != nil {
+				return err
+			}
+		}
+	}
+
+	content, err := io.ReadAll(decodeTransfer(header.Get("Content-Transfer-Encoding"), body))
+	if err != nil {
+		return fmt.Errorf("unable to decode %s part: %w", mediaType, err)
+	}
+
+	disposition, dispParams, _ := mime.ParseMediaType(header.Get("Content-Disposition"))
+	filename := dispParams["filename"]
+	if filename == "" {
+		filename = params["name"]
+	}
+
+	if disposition != "attachment" && filename == "" {
+		if mediaType == "text/plain" && e.text == "" {
+			e.text = string(content)
+			return nil
+		}
+		if mediaType == "text/html" && e.html == "" {
+			e.html = string(content)
+			return nil
+		}
+		if strings.HasPrefix(mediaType, "text/") {
+			return nil // other bodies such as calendar invites
+		}
+	}
+
+	e.attachments = append(e.attachments, &inboundAttachment{filename: filename, contentType: mediaType, content: content})
+	return nil
+}
+
+// msgText returns the text to use for the message - the body without any quoted reply, falling back to the HTML body
+// stripped of tags, and prefixed by the subject if this isn't a reply
+func (e *inboundEmail) msgText() string {
+	body := e.text
+	if strings.TrimSpace(body) == "" && e.html != "" {
+		body = htmlToText(e.html)
+	}
+
+	body = strings.TrimSpace(stripQuotedReply(strings.ReplaceAll(body, "\r\n", "\n")))
+
+	if len(e.inReplyTo) == 0 && e.subject != "" {
+		if body == "" {
+			return e.subject
+		}
+		return e.subject + "\n\n" + body
+	}
+	return body
+}
+
+func decodeTransfer(encoding string, r io.Reader) io.Reader {
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "base64":
+		return base64.NewDecoder(base64.StdEncoding, r)
+	case "quoted-printable":
+		return quotedprintable.NewReader(r)
+	}
+	return r
+}
+
+// parseMessageIDs parses a list of <id> values from a header, returning them without the angle brackets
+func parseMessageIDs(s string) []string {
+	ids := make([]string, 0, 1)
+	for _, f := range strings.Fields(s) {
+		id := strings.Trim(f, "<>,")
+		if id != "" {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+var quoteHeaderRegex = regexp.MustCompile(`(?m)^On .+wrote:\s*$`)
+
+// stripQuotedReply removes the quoted previous message which most clients append to replies
+func stripQuotedReply(text string) string {
+	if loc := quoteHeaderRegex.FindStringIndex(text); loc != nil {
+		text = text[:loc[0]]
+	}
+
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		if strings.HasPrefix(line, ">") {
+			return strings.Join(lines[:i], "\n")
+		}
+	}
+	return text
+}
+
+var htmlTagRegex = regexp.MustCompile(`(?s)<(script|style)[^>]*>.*?</(script|style)>|<[^>]+>`)
+var htmlBreakRegex = regexp.MustCompile(`(?i)<br\s*/?>|</p>|</div>`)
+
+func htmlToText(s string) string {
+	s = htmlBreakRegex.ReplaceAllString(s, "\n")
+	s = htmlTagRegex.ReplaceAllString(s, "")
+	return strings.ReplaceAll(html.UnescapeString(s), "\u00a0", " ")
+}
@@ -0,0 +1,104 @@
+package email
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseEmail(t *testing.T) {
+	raw := strings.Join([]string{
+		"From: =?UTF-8?Q?Bob_Mart=C3=ADn?= <Bob@Example.com>",
+		"To: support@nyaruka.com",
+		"Subject: =?UTF-8?Q?Caf=C3=A9?= opening hours",
+		"Date: Wed, 01 May 2024 10:30:00 +0000",
+		"Message-ID: <abc123@example.com>",
+		"MIME-Version: 1.0",
+		`Content-Type: multipart/mixed; boundary="outer"`,
+		"",
+		"--outer",
+		`Content-Type: multipart/alternative; boundary="inner"`,
+		"",
+		"--inner",
+		"Content-Type: text/plain; charset=utf-8",
+		"Content-Transfer-Encoding: quoted-printable",
+		"",
+		"When does the caf=C3=A9 open?",
+		"--inner",
+		"Content-Type: text/html; charset=utf-8",
+		"",
+		"<p>When does the café open?</p>",
+		"--inner--",
+		"--outer",
+		`Content-Type: image/png; name="photo.png"`,
+		`Content-Disposition: attachment; filename="photo.png"`,
+		"Content-Transfer-Encoding: base64",
+		"",
+		"iVBORw0K",
+		"GgoAAAAN",
+		"--outer--",
+		"",
+	}, "\r\n")
+
+	e, err := parseEmail([]byte(raw))
+	require.NoError(t, err)
+	assert.Equal(t, "abc123@example.com", e.messageID)
+	assert.Equal(t, []string{}, e.inReplyTo)
+	assert.Equal(t, "Bob@Example.com", e.from)
+	assert.Equal(t, "Café opening hours", e.subject)
+	assert.Equal(t, "When does the café open?", e.text)
+	assert.Equal(t, "<p>When does the café open?</p>", e.html)
+	require.Len(t, e.attachments, 1)
+	assert.Equal(t, "photo.png", e.attachments[0].filename)
+	assert.Equal(t, "image/png", e.attachments[0].contentType)
+	assert.Equal(t, []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\x0d"), e.attachments[0].content)
+	assert.Equal(t, "Café opening hours\n\nWhen does the café open?", e.msgText())
+
+	// a reply which is HTML only
+	raw = strings.Join([]string{
+		"From: bob@example.com",
+		"Subject: Re: Café opening hours",
+		"Message-ID: <def456@example.com>",
+		"In-Reply-To: <out1@nyaruka.com>",
+		"References: <abc123@example.com> <out1@nyaruka.com>",
+		"Content-Type: text/html",
+		"",
+		"<div>Thanks &amp; bye<br>Bob</div><blockquote>",
+		"",
+	}, "\r\n")
+
+	e, err = parseEmail([]byte(raw))
+	require.NoError(t, err)
+	assert.Equal(t, "def456@example.com", e.messageID)
+	assert.Equal(t, []string{"out1@nyaruka.com", "out1@nyaruka.com", "abc123@example.com"}, e.inReplyTo)
+	assert.Equal(t, "", e.text)
+	assert.Len(t, e.attachments, 0)
+	assert.Equal(t, "Thanks & bye\nBob", e.msgText())
+
+	_, err = parseEmail([]byte("From: bob@example.com\r\n\r\nHi"))
+	assert.EqualError(t, err, "missing Message-ID header")
+
+	_, err = parseEmail([]byte("Message-ID: <abc@example.com>\r\n\r\nHi"))
+	assert.EqualError(t, err, "missing or invalid From header")
+
+	_, err = parseEmail([]byte("Hi there"))
+	assert.EqualError(t, err, "unable to read message: malformed header line: \"Hi there\"")
+}
+
+func TestStripQuotedReply(t *testing.T) {
+	tcs := []struct {
+		text     string
+		expected string
+	}{
+		{"Hi there", "Hi there"},
+		{"Yes please\n\nOn Wed, 1 May 2024 at 10:30, Support <support@nyaruka.com> wrote:\n> Do you want it?", "Yes please\n\n"},
+		{"Yes please\n> Do you want it?\n> Really?", "Yes please"},
+		{"Yes\n> Do you want it?\nAnd also this", "Yes"},
+	}
+
+	for _, tc := range tcs {
+		assert.Equal(t, tc.expected, stripQuotedReply(tc.text), "stripped text mismatch for %q", tc.text)
+	}
+}
@@ -0,0 +1,136 @@
+package email
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"path/filepath"
+	"slices"
+
+	"github.com/nyaruka/gocommon/dates"
+	"github.com/nyaruka/gocommon/dbutil"
+	"github.com/nyaruka/gocommon/stringsx"
+	"github.com/nyaruka/gocommon/urns"
+	"github.com/nyaruka/gocommon/uuids"
+	"github.com/nyaruka/goflow/utils"
+	"github.com/nyaruka/mailroom/v26/core/models"
+	"github.com/nyaruka/mailroom/v26/core/tasks"
+	"github.com/nyaruka/mailroom/v26/core/tasks/ctasks"
+	"github.com/nyaruka/mailroom/v26/runtime"
+	"github.com/nyaruka/mailroom/v26/web"
+)
+
+func init() {
+	web.InternalRoute(http.MethodPost, "/email/receive", web.JSONPayload(handleReceive))
+}
+
+// Creates a new incoming message from an email received for an email channel, e.g. by a local MTA or a provider's
+// inbound webhook. Replies are threaded to the ticket of the message they reply to.
+//
+//	{
+//	  "org_id": 1,
+//	  "channel_id": 12,
+//	  "mime": "From: Bob <bob@example.com>\r\nMessage-ID: <123@example.com>\r\n..."
+//	}
+type receiveRequest struct {
+	OrgID     models.OrgID     `json:"org_id"      validate:"required"`
+	ChannelID models.ChannelID `json:"channel_id"  validate:"required"`
+	MIME      string           `json:"mime"        validate:"required"`
+}
+
+func handleReceive(ctx context.Context, rt *runtime.Runtime, r *receiveRequest) (any, int, error) {
+	oa, err := models.GetOrgAssets(ctx, rt, r.OrgID)
+	if err != nil {
+		return nil, 0, fmt.Errorf("error loading org assets: %w", err)
+	}
+
+	channel := oa.ChannelByID(r.ChannelID)
+	if channel == nil || !slices.Contains(channel.Schemes(), urns.Email.Prefix) {
+		return fmt.Errorf("no such email channel with id %d", r.ChannelID), http.StatusBadRequest, nil
+	}
+
+	inbound, err := parseEmail([]byte(r.MIME))
+	if err != nil {
+		return fmt.Errorf("invalid email: %w", err), http.StatusBadRequest, nil
+	}
+
+	// MTAs can deliver the same email more than once
+	existingID, err := models.GetIncomingEmailID(ctx, rt.DB, r.OrgID, r.ChannelID, inbound.messageID)
+	if err != nil {
+		return nil, 0, fmt.Errorf("error checking for duplicate message: %w", err)
+	}
+	if existingID != models.NilMsgID {
+		return map[string]any{"id": existingID, "duplicate": true}, http.StatusOK, nil
+	}
+
+	urn, err := urns.New(urns.Email, inbound.from)
+	if err != nil {
+		return fmt.Errorf("invalid sender address: %w", err), http.StatusBadRequest, nil
+	}
+
+	userID, err := models.GetSystemUserID(ctx, rt.DB.DB)
+	if err != nil {
+		return nil, 0, fmt.Errorf("error getting system user id: %w", err)
+	}
+
+	mc, _, created, err := models.GetOrCreateContact(ctx, rt.DB, oa, userID, []urns.URN{urn}, r.ChannelID)
+	if err != nil {
+		return nil, 0, fmt.Errorf("error getting or creating contact: %w", err)
+	}
+
+	var urnID models.URNID
+	if cu := mc.FindURN(urn); cu != nil {
+		urnID = cu.ID
+	}
+
+	ticketUUID, err := models.GetThreadTicketUUID(ctx, rt.DB, r.OrgID, mc.ID(), inbound.inReplyTo)
+	if err != nil {
+		return nil, 0, fmt.Errorf("error looking up ticket for thread: %w", err)
+	}
+
+	attachments := make([]utils.Attachment, 0, len(inbound.attachments))
+	for _, a := range inbound.attachments {
+		filename := string(uuids.NewV4()) + filepath.Ext(a.filename)
+
+		attachment, err := oa.Org().StoreAttachment(ctx, rt, filename, a.contentType, io.NopCloser(bytes.NewReader(a.content)))
+		if err != nil {
+			return nil, 0, fmt.Errorf("error storing attachment: %w", err)
+		}
+		attachments = append(attachments, attachment)
+	}
+
+	// the Date header is when the sender says they wrote it, which could be anything, so use when we received it
+	receivedOn := dates.Now()
+
+	text := dbutil.ToValidUTF8(stringsx.Truncate(inbound.msgText(), 640))
+
+	m := models.NewIncomingEmail(r.OrgID, r.ChannelID, mc.ID(), urnID, text, attachments, inbound.messageID, receivedOn)
+	if err := models.InsertMessages(ctx, rt.DB, []*models.Msg{m}); err != nil {
+		return nil, 0, fmt.Errorf("error inserting message: %w", err)
+	}
+
+	// attachments are already stored so the task can use them as is
+	attachmentURLs := make([]string, len(attachments))
+	for i, a := range attachments {
+		attachmentURLs[i] = string(a)
+	}
+
+	err = tasks.QueueContact(ctx, rt, r.OrgID, m.ContactID(), &ctasks.MsgReceived{
+		ChannelID:     m.ChannelID(),
+		MsgUUID:       m.UUID(),
+		MsgExternalID: m.ExternalIdentifier(),
+		URN:           urn,
+		URNID:         m.ContactURNID(),
+		Text:          m.Text(),
+		Attachments:   attachmentURLs,
+		NewContact:    created,
+		TicketUUID:    ticketUUID,
+	})
+	if err != nil {
+		return nil, 0, fmt.Errorf("error queueing handle task: %w", err)
+	}
+
+	return map[string]any{"id": m.ID(), "duplicate": false, "ticket_uuid": ticketUUID}, http.StatusOK, nil
+}
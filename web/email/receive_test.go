@@ -0,0 +1,25 @@
+package email
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nyaruka/gocommon/urns"
+	"github.com/nyaruka/mailroom/v26/core/models"
+	"github.com/nyaruka/mailroom/v26/testsuite"
+	"github.com/nyaruka/mailroom/v26/testsuite/testdb"
+)
+
+func TestReceive(t *testing.T) {
+	_, rt := testsuite.Runtime(t)
+
+	testdb.InsertChannel(t, rt, testdb.Org1, "EM", "Support", "support@nyaruka.com", []string{"mailto"}, "SR", map[string]any{})
+
+	// Bob has an open ticket and was sent an email from it which he'll reply to
+	testdb.InsertContactURN(t, rt, testdb.Org1, testdb.Bob, urns.URN("mailto:bob@example.com"), 1000, nil)
+	ticket := testdb.InsertOpenTicket(t, rt, "01992f54-5ab6-717a-a39e-e8ca91fb7262", testdb.Org1, testdb.Bob, testdb.DefaultTopic, time.Now(), nil)
+	out := testdb.InsertOutgoingMsg(t, rt, testdb.Org1, "0199bad8-f98d-75a3-b641-2718a25ac3f5", testdb.TwilioChannel, testdb.Bob, "How can we help?", nil, models.MsgStatusSent, false)
+	rt.DB.MustExec(`UPDATE msgs_msg SET external_identifier = 'sg-14c5d75ce93', ticket_uuid = $2 WHERE id = $1`, out.ID, ticket.UUID)
+
+	testsuite.RunWebTests(t, rt, "testdata/receive.json")
+}
@@ -0,0 +1,38 @@
+package experiment_test
+
+import (
+	"testing"
+
+	"github.com/nyaruka/gocommon/i18n"
+	"github.com/nyaruka/gocommon/uuids"
+	"github.com/nyaruka/mailroom/v26/core/models"
+	"github.com/nyaruka/mailroom/v26/testsuite"
+	"github.com/nyaruka/mailroom/v26/testsuite/testdb"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResults(t *testing.T) {
+	_, rt := testsuite.Runtime(t)
+
+	a := &models.Variant{UUID: "2c1a7c1e-4f5b-4c8e-9d3a-6b7e8f9a0b1c", Name: "A", Percent: 50}
+	b := &models.Variant{UUID: "8e3b4d2f-1a6c-4e7d-8f9a-0b1c2d3e4f5a", Name: "B", Percent: 50}
+
+	// broadcast #30000 is an experiment where Ann got A and Bob got B, broadcast #30001 isn't an experiment
+	bcast := testdb.InsertBroadcast(t, rt, testdb.Org1, "0199f6a8-2b3c-7d4e-8f5a-6b7c8d9e0f1a", "eng", map[i18n.Language]string{"eng": "Hi"}, models.NilScheduleID, nil, nil)
+	testdb.InsertBroadcast(t, rt, testdb.Org1, "0199f6a8-4d5e-7f6a-8b7c-8d9e0f1a2b3c", "eng", map[i18n.Language]string{"eng": "Hey"}, models.NilScheduleID, nil, nil)
+
+	_, err := rt.Dynamo.Main.Queue(models.NewExperiment(testdb.Org1.ID, uuids.UUID(bcast.UUID), []*models.Variant{a, b}))
+	require.NoError(t, err)
+	_, err = rt.Dynamo.Main.Queue(models.NewVariantAssignment(testdb.Org1.ID, uuids.UUID(bcast.UUID), a, 0, []models.ContactID{testdb.Ann.ID}))
+	require.NoError(t, err)
+	_, err = rt.Dynamo.Main.Queue(models.NewVariantAssignment(testdb.Org1.ID, uuids.UUID(bcast.UUID), b, 1, []models.ContactID{testdb.Bob.ID}))
+	require.NoError(t, err)
+	rt.Dynamo.Main.Flush()
+
+	// Ann's message was delivered, Bob's wasn't
+	out1 := testdb.InsertOutgoingMsg(t, rt, testdb.Org1, "0199f6a9-1a2b-7c3d-8e4f-5a6b7c8d9e0f", testdb.TwilioChannel, testdb.Ann, "Hi", nil, models.MsgStatusDelivered, false)
+	out2 := testdb.InsertOutgoingMsg(t, rt, testdb.Org1, "0199f6a9-3c4d-7e5f-8a6b-7c8d9e0f1a2b", testdb.TwilioChannel, testdb.Bob, "Hi", nil, models.MsgStatusErrored, false)
+	rt.DB.MustExec(`UPDATE msgs_msg SET broadcast_id = $1 WHERE id IN ($2, $3)`, bcast.ID, out1.ID, out2.ID)
+
+	testsuite.RunWebTests(t, rt, "testdata/results.json")
+}
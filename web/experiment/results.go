@@ -0,0 +1,91 @@
+package experiment
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/nyaruka/gocommon/uuids"
+	"github.com/nyaruka/mailroom/v26/core/models"
+	"github.com/nyaruka/mailroom/v26/runtime"
+	"github.com/nyaruka/mailroom/v26/web"
+)
+
+func init() {
+	web.InternalRoute(http.MethodPost, "/experiment/results", web.JSONPayload(handleResults))
+}
+
+// Request for the results of each variant of an experiment on a broadcast or flow start. Rates are the proportion of
+// contacts assigned the variant who had a message delivered, who replied or who completed the flow.
+//
+//	{
+//	  "org_id": 1,
+//	  "broadcast_id": 123
+//	}
+//
+//	{
+//	  "variants": [
+//	    {
+//	      "uuid": "4d6d5fbc-cd0b-4b4a-bd0d-2dbd2c1b1a0e",
+//	      "name": "Short",
+//	      "percent": 50,
+//	      "contacts": 120,
+//	      "delivered": 110,
+//	      "delivery_rate": 0.917,
+//	      "replied": 30,
+//	      "reply_rate": 0.25
+//	    },
+//	    ...
+//	  ]
+//	}
+type resultsRequest struct {
+	OrgID       models.OrgID       `json:"org_id"       validate:"required"`
+	BroadcastID models.BroadcastID `json:"broadcast_id"`
+	StartID     models.StartID     `json:"start_id"`
+}
+
+func handleResults(ctx context.Context, rt *runtime.Runtime, r *resultsRequest) (any, int, error) {
+	var experimentUUID uuids.UUID
+	var ownerOrgID models.OrgID
+
+	if r.BroadcastID != models.NilBroadcastID {
+		bcast, err := models.GetBroadcastByID(ctx, rt.DB, r.BroadcastID)
+		if err != nil {
+			return fmt.Errorf("no such broadcast with id %d", r.BroadcastID), http.StatusBadRequest, nil
+		}
+		experimentUUID, ownerOrgID = uuids.UUID(bcast.UUID), bcast.OrgID
+	} else if r.StartID != models.NilStartID {
+		start, err := models.GetFlowStartByID(ctx, rt.DB, r.StartID)
+		if err != nil {
+			return fmt.Errorf("no such flow start with id %d", r.StartID), http.StatusBadRequest, nil
+		}
+		experimentUUID, ownerOrgID = start.UUID, start.OrgID
+	} else {
+		return errors.New("one of broadcast_id or start_id is required"), http.StatusBadRequest, nil
+	}
+
+	if ownerOrgID != r.OrgID {
+		return errors.New("no such experiment"), http.StatusBadRequest, nil
+	}
+
+	exp, assignments, err := models.LoadExperiment(ctx, rt, r.OrgID, experimentUUID)
+	if err != nil {
+		return nil, 0, fmt.Errorf("error loading experiment: %w", err)
+	}
+	if exp == nil {
+		return errors.New("no such experiment"), http.StatusBadRequest, nil
+	}
+
+	var results []*models.VariantResults
+	if r.BroadcastID != models.NilBroadcastID {
+		results, err = models.GetBroadcastVariantResults(ctx, rt.DB, r.BroadcastID, exp, assignments)
+	} else {
+		results, err = models.GetStartVariantResults(ctx, rt.DB, r.StartID, exp, assignments)
+	}
+	if err != nil {
+		return nil, 0, fmt.Errorf("error getting experiment results: %w", err)
+	}
+
+	return map[string]any{"variants": results}, http.StatusOK, nil
+}
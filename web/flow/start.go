@@ -30,6 +30,17 @@ func init() {
 //	  "contact_ids": [4646],
 //	  "urns": [4646]
 //	}
+//
+// A start can also be an experiment which splits its recipients between variants which can start different flows:
+//
+//	{
+//	  "org_id": 1,
+//	  ...
+//	  "variants": [
+//	    {"name": "Control", "percent": 80},
+//	    {"name": "Shorter", "percent": 20, "flow_id": 124}
+//	  ]
+//	}
 type startRequest struct {
 	OrgID      models.OrgID       `json:"org_id"       validate:"required"`
 	UserID     models.UserID      `json:"user_id"      validate:"required"`
@@ -41,6 +52,7 @@ type startRequest struct {
 	Query      string             `json:"query"`
 	Exclude    models.Exclusions  `json:"exclude"`
 	Params     json.RawMessage    `json:"params"`
+	Variants   []*models.Variant  `json:"variants"     validate:"omitempty,dive"`
 }
 
 func handleStart(ctx context.Context, rt *runtime.Runtime, r *startRequest) (any, int, error) {
@@ -48,6 +60,28 @@ func handleStart(ctx context.Context, rt *runtime.Runtime, r *startRequest) (any
 		return errors.New("can't create flow start with no recipients"), http.StatusBadRequest, nil
 	}
 
+	if len(r.Variants) > 0 {
+		if err := models.ValidateVariants(r.Variants); err != nil {
+			return err, http.StatusBadRequest, nil
+		}
+
+		oa, err := models.GetOrgAssets(ctx, rt, r.OrgID)
+		if err != nil {
+			return nil, 0, fmt.Errorf("error loading org assets: %w", err)
+		}
+
+		for _, v := range r.Variants {
+			if v.FlowID != models.NilFlowID {
+				if _, err := oa.FlowByID(v.FlowID); err == models.ErrNotFound {
+					return fmt.Errorf("variant '%s' has a flow which doesn't exist", v.Name), http.StatusBadRequest, nil
+				} else if err != nil {
+					return nil, 0, fmt.Errorf("error loading flow for variant '%s': %w", v.Name, err)
+				}
+			}
+			v.UUID = models.NewVariantUUID()
+		}
+	}
+
 	tx, err := rt.DB.BeginTxx(ctx, nil)
 	if err != nil {
 		return nil, 0, fmt.Errorf("error beginning transaction: %w", err)
@@ -66,6 +100,7 @@ func handleStart(ctx context.Context, rt *runtime.Runtime, r *startRequest) (any
 		Exclusions:  r.Exclude,
 		Params:      r.Params,
 		CreatedByID: r.UserID,
+		Variants:    r.Variants,
 	}
 
 	if err := models.InsertFlowStart(ctx, tx, start); err != nil {
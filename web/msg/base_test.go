@@ -4,6 +4,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/nyaruka/gocommon/i18n"
 	"github.com/nyaruka/goflow/core"
 	"github.com/nyaruka/mailroom/v26/core/models"
 	"github.com/nyaruka/mailroom/v26/testsuite"
@@ -92,6 +93,31 @@ func TestBroadcastPreview(t *testing.T) {
 	testsuite.RunWebTests(t, rt, "testdata/broadcast_preview.json")
 }
 
+func TestBroadcastStats(t *testing.T) {
+	ctx, rt := testsuite.Runtime(t)
+
+	bcast := testdb.InsertBroadcast(t, rt, testdb.Org1, "0199f6a8-2b3c-7d4e-8f5a-6b7c8d9e0f1a", "eng", map[i18n.Language]string{"eng": "Hi"}, models.NilScheduleID, nil, nil)
+
+	// Ann's message was delivered, Bob's failed for lack of a channel and Cat's is still queued
+	out1 := testdb.InsertOutgoingMsg(t, rt, testdb.Org1, "0199f6a9-1a2b-7c3d-8e4f-5a6b7c8d9e0f", testdb.TwilioChannel, testdb.Ann, "Hi", nil, models.MsgStatusDelivered, false)
+	out2 := testdb.InsertOutgoingMsg(t, rt, testdb.Org1, "0199f6a9-3c4d-7e5f-8a6b-7c8d9e0f1a2b", testdb.TwilioChannel, testdb.Bob, "Hi", nil, models.MsgStatusFailed, false)
+	out3 := testdb.InsertOutgoingMsg(t, rt, testdb.Org1, "0199f6a9-5e6f-7a8b-9c0d-1e2f3a4b5c6d", testdb.TwilioChannel, testdb.Cat, "Hola", nil, models.MsgStatusQueued, false)
+	rt.DB.MustExec(`UPDATE msgs_msg SET broadcast_id = $1, created_on = '2025-01-01T10:00:00Z' WHERE id IN ($2, $3, $4)`, bcast.ID, out1.ID, out2.ID, out3.ID)
+	rt.DB.MustExec(`UPDATE msgs_msg SET channel_id = NULL, failed_reason = 'D' WHERE id = $1`, out2.ID)
+	rt.DB.MustExec(`UPDATE msgs_msg SET locale = 'spa-EC' WHERE id = $1`, out3.ID)
+
+	// Ann replies after an hour, Bob after two days
+	in1 := testdb.InsertIncomingMsg(t, rt, testdb.Org1, "0199f6aa-7a8b-7c9d-8e0f-1a2b3c4d5e6f", testdb.TwilioChannel, testdb.Ann, "Hello", models.MsgStatusHandled, "")
+	in2 := testdb.InsertIncomingMsg(t, rt, testdb.Org1, "0199f6aa-8b9c-7d0e-8f1a-2b3c4d5e6f7a", testdb.TwilioChannel, testdb.Bob, "Hello", models.MsgStatusHandled, "")
+	rt.DB.MustExec(`UPDATE msgs_msg SET created_on = '2025-01-01T11:00:00Z' WHERE id = $1`, in1.ID)
+	rt.DB.MustExec(`UPDATE msgs_msg SET created_on = '2025-01-03T10:00:00Z' WHERE id = $1`, in2.ID)
+
+	// and one other contact was skipped by a frequency cap
+	require.NoError(t, models.RecordBroadcastCapped(ctx, rt.DB, &models.Broadcast{ID: bcast.ID, OrgID: testdb.Org1.ID}, 1))
+
+	testsuite.RunWebTests(t, rt, "testdata/broadcast_stats.json")
+}
+
 func TestSearch(t *testing.T) {
 	_, rt := testsuite.Runtime(t)
 
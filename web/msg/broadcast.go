@@ -7,6 +7,7 @@ import (
 	"net/http"
 	"time"
 
+	"github.com/nyaruka/gocommon/dates"
 	"github.com/nyaruka/gocommon/i18n"
 	"github.com/nyaruka/gocommon/urns"
 	"github.com/nyaruka/goflow/core"
@@ -36,6 +37,36 @@ func init() {
 //	    "repeat_days_of_week": "MF"
 //	  }
 //	}
+//
+// A scheduled broadcast can instead repeat according to a cron expression, with its first fire after the start:
+//
+//	{
+//	  "org_id": 1,
+//	  ...
+//	  "schedule": {"start": "2024-06-20T09:04:30Z", "cron": "30 10 * * TUE#2"}
+//	}
+//
+// A broadcast which isn't scheduled can instead be an experiment which splits its recipients between variants with
+// their own translations:
+//
+//	{
+//	  "org_id": 1,
+//	  ...
+//	  "variants": [
+//	    {"name": "Short", "percent": 50, "translations": {"eng": {"text": "Hi!"}}},
+//	    {"name": "Long", "percent": 50, "translations": {"eng": {"text": "Hello there @contact"}}}
+//	  ]
+//	}
+//
+// Or it can optimize send times, deferring each contact's message to the hour of the day at which they're typically
+// active if that falls within the given number of hours (defaults to 24):
+//
+//	{
+//	  "org_id": 1,
+//	  ...
+//	  "optimize_send_time": true,
+//	  "optimize_within": 24
+//	}
 type broadcastRequest struct {
 	OrgID             models.OrgID               `json:"org_id"        validate:"required"`
 	UserID            models.UserID              `json:"user_id"       validate:"required"`
@@ -53,7 +84,11 @@ type broadcastRequest struct {
 		Start            time.Time           `json:"start"`
 		RepeatPeriod     models.RepeatPeriod `json:"repeat_period"`
 		RepeatDaysOfWeek string              `json:"repeat_days_of_week"`
+		Cron             string              `json:"cron"`
 	} `json:"schedule"`
+	Variants         []*models.Variant `json:"variants"           validate:"omitempty,dive"`
+	OptimizeSendTime bool              `json:"optimize_send_time"`
+	OptimizeWithin   int               `json:"optimize_within"    validate:"omitempty,min=1,max=168"`
 }
 
 // handles a request to create the given broadcast
@@ -67,6 +102,39 @@ func handleBroadcast(ctx context.Context, rt *runtime.Runtime, r *broadcastReque
 		return errors.New("can't create broadcast with no recipients"), http.StatusBadRequest, nil
 	}
 
+	if len(r.Variants) > 0 {
+		if r.Schedule != nil {
+			return errors.New("can't schedule broadcast with variants"), http.StatusBadRequest, nil
+		}
+		if err := models.ValidateVariants(r.Variants); err != nil {
+			return err, http.StatusBadRequest, nil
+		}
+		for _, v := range r.Variants {
+			if len(v.Translations) == 0 {
+				return fmt.Errorf("variant '%s' has no translations", v.Name), http.StatusBadRequest, nil
+			}
+			if _, ok := v.Translations[r.BaseLanguage]; !ok {
+				return fmt.Errorf("variant '%s' has no translation in base language '%s'", v.Name, r.BaseLanguage), http.StatusBadRequest, nil
+			}
+			v.UUID = models.NewVariantUUID()
+		}
+	}
+
+	var optimizeWithin int
+	if r.OptimizeSendTime {
+		if r.Schedule != nil {
+			return errors.New("can't schedule broadcast with optimized send time"), http.StatusBadRequest, nil
+		}
+		if len(r.Variants) > 0 {
+			return errors.New("can't optimize send time of broadcast with variants"), http.StatusBadRequest, nil
+		}
+
+		optimizeWithin = r.OptimizeWithin
+		if optimizeWithin == 0 {
+			optimizeWithin = 24
+		}
+	}
+
 	tx, err := rt.DB.BeginTxx(ctx, nil)
 	if err != nil {
 		return nil, 0, fmt.Errorf("error beginning transaction: %w", err)
@@ -88,10 +156,22 @@ func handleBroadcast(ctx context.Context, rt *runtime.Runtime, r *broadcastReque
 		NodeUUID:          r.NodeUUID,
 		Exclusions:        r.Exclude,
 		CreatedByID:       r.UserID,
+		Variants:          r.Variants,
+		OptimizeWithin:    optimizeWithin,
 	}
 
 	if r.Schedule != nil {
-		sched, err := models.NewSchedule(oa, r.Schedule.Start, r.Schedule.RepeatPeriod, r.Schedule.RepeatDaysOfWeek)
+		var sched *models.Schedule
+		if r.Schedule.Cron != "" {
+			// first fire is after the start if that's in the future
+			from := dates.Now()
+			if r.Schedule.Start.After(from) {
+				from = r.Schedule.Start
+			}
+			sched, err = models.NewCronSchedule(oa, r.Schedule.Cron, from)
+		} else {
+			sched, err = models.NewSchedule(oa, r.Schedule.Start, r.Schedule.RepeatPeriod, r.Schedule.RepeatDaysOfWeek)
+		}
 		if err != nil {
 			return fmt.Errorf("error creating schedule: %w", err), http.StatusBadRequest, nil
 		}
@@ -0,0 +1,72 @@
+package msg
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/nyaruka/mailroom/v26/core/models"
+	"github.com/nyaruka/mailroom/v26/runtime"
+	"github.com/nyaruka/mailroom/v26/web"
+)
+
+func init() {
+	web.InternalRoute(http.MethodPost, "/msg/broadcast_stats", web.JSONPayload(handleBroadcastStats))
+}
+
+// Summarizes how the messages of a broadcast have fared. Replies are counted for contacts who sent a message within the
+// reply window in hours (defaults to 24) of being sent the broadcast. Capped is the number of sends that were skipped or
+// deferred by the org's frequency caps.
+//
+//	{
+//	  "org_id": 1,
+//	  "broadcast_id": 123,
+//	  "reply_window": 48
+//	}
+//
+//	{
+//	  "total": 5,
+//	  "statuses": {"queued": 1, "delivered": 3, "failed": 1},
+//	  "failed_reasons": {"no_destination": 1},
+//	  "channels": [{"uuid": "74729f45-7f29-4868-9dc4-90e491e3c7d8", "name": "Twilio", "count": 4}, {"count": 1}],
+//	  "languages": {"eng": 4, "spa": 1},
+//	  "contacts": 5,
+//	  "replied": 2,
+//	  "reply_rate": 0.4,
+//	  "capped": 0
+//	}
+type broadcastStatsRequest struct {
+	OrgID       models.OrgID       `json:"org_id"       validate:"required"`
+	BroadcastID models.BroadcastID `json:"broadcast_id" validate:"required"`
+	ReplyWindow int                `json:"reply_window" validate:"omitempty,min=1,max=720"`
+}
+
+func handleBroadcastStats(ctx context.Context, rt *runtime.Runtime, r *broadcastStatsRequest) (any, int, error) {
+	oa, err := models.GetOrgAssets(ctx, rt, r.OrgID)
+	if err != nil {
+		return nil, 0, fmt.Errorf("error loading org assets: %w", err)
+	}
+
+	bcast, err := models.GetBroadcastByID(ctx, rt.DB, r.BroadcastID)
+	if err != nil || bcast.OrgID != r.OrgID {
+		return fmt.Errorf("no such broadcast with id %d", r.BroadcastID), http.StatusBadRequest, nil
+	}
+
+	replyWindow := r.ReplyWindow
+	if replyWindow == 0 {
+		replyWindow = 24
+	}
+
+	stats, err := models.GetBroadcastStats(ctx, rt.ReadonlyDB, oa, bcast.ID, time.Duration(replyWindow)*time.Hour)
+	if err != nil {
+		return nil, 0, fmt.Errorf("error getting broadcast stats: %w", err)
+	}
+
+	stats.Capped, err = models.GetBroadcastCapped(ctx, rt.ReadonlyDB, bcast)
+	if err != nil {
+		return nil, 0, fmt.Errorf("error getting broadcast capped count: %w", err)
+	}
+
+	return stats, http.StatusOK, nil
+}
@@ -43,3 +43,9 @@ func TestDeindex(t *testing.T) {
 	defer vc.Close()
 	assertvk.SMembers(t, vc, "deindex:contacts", []string{"1"})
 }
+
+func TestEncryptFields(t *testing.T) {
+	_, rt := testsuite.Runtime(t)
+
+	testsuite.RunWebTests(t, rt, "testdata/encrypt_fields.json")
+}
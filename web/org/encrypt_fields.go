@@ -0,0 +1,38 @@
+package org
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/nyaruka/mailroom/v26/core/models"
+	"github.com/nyaruka/mailroom/v26/core/tasks"
+	"github.com/nyaruka/mailroom/v26/runtime"
+	"github.com/nyaruka/mailroom/v26/web"
+)
+
+func init() {
+	web.InternalRoute(http.MethodPost, "/org/encrypt_fields", web.JSONPayload(handleEncryptFields))
+}
+
+// Requests encryption of existing values of the org's sensitive fields, e.g. after marking a field as sensitive.
+//
+//	{
+//	  "org_id": 1
+//	}
+type encryptFieldsRequest struct {
+	OrgID models.OrgID `json:"org_id"  validate:"required"`
+}
+
+func handleEncryptFields(ctx context.Context, rt *runtime.Runtime, r *encryptFieldsRequest) (any, int, error) {
+	if len(rt.Config.FieldsEncryptionKeyParsed) == 0 {
+		return errors.New("no fields encryption key configured"), http.StatusBadRequest, nil
+	}
+
+	if err := tasks.Queue(ctx, rt, rt.Queues.Batch, r.OrgID, &tasks.EncryptFields{}, true); err != nil {
+		return nil, 0, fmt.Errorf("error queuing encrypt fields task: %w", err)
+	}
+
+	return map[string]any{}, http.StatusOK, nil
+}
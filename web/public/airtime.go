@@ -11,11 +11,13 @@ import (
 	"github.com/nyaruka/mailroom/v26/core/models"
 	"github.com/nyaruka/mailroom/v26/runtime"
 	"github.com/nyaruka/mailroom/v26/services/airtime/dtone"
+	"github.com/nyaruka/mailroom/v26/services/airtime/reloadly"
 	"github.com/nyaruka/mailroom/v26/web"
 )
 
 func init() {
 	web.InternetRoute(http.MethodPost, "/airtime/dtone/status", handleDTOneStatus)
+	web.InternetRoute(http.MethodPost, "/airtime/reloadly/status", handleReloadlyStatus)
 }
 
 // dtoneStatusBody is the subset of DT One's transaction callback payload we care about. See
@@ -79,11 +81,63 @@ func handleDTOneStatus(ctx context.Context, rt *runtime.Runtime, r *http.Request
 		return web.WriteMarshalled(w, http.StatusOK, map[string]string{"status": "ignored"})
 	}
 
+	return applyAirtimeStatus(ctx, rt, w, "dtone", transferUUID, providerID, newStatus)
+}
+
+// reloadlyStatusBody is the subset of Reloadly's airtime transaction webhook payload we care about. See
+// https://docs.reloadly.com/airtime/webhooks
+type reloadlyStatusBody struct {
+	Type string `json:"type"`
+	Data struct {
+		TransactionID    int64           `json:"transactionId"`
+		CustomIdentifier string          `json:"customIdentifier"`
+		Status           reloadly.Status `json:"status"`
+	} `json:"data"`
+}
+
+// handleReloadlyStatus receives Reloadly's airtime transaction webhooks. Authentication works the same way as for
+// DT One: Reloadly echoes back the airtime_created event UUID (which we passed as their customIdentifier) and its own
+// transaction id (which we stored on the row at Create time), and both must match the row.
+func handleReloadlyStatus(ctx context.Context, rt *runtime.Runtime, r *http.Request, w http.ResponseWriter) error {
+	body := &reloadlyStatusBody{}
+	if err := web.ReadAndValidateJSON(r, body); err != nil {
+		return writeAirtimeStatusError(w, http.StatusBadRequest, fmt.Sprintf("invalid body: %s", err))
+	}
+
+	if body.Data.CustomIdentifier == "" {
+		return writeAirtimeStatusError(w, http.StatusBadRequest, "missing customIdentifier")
+	}
+	if body.Data.TransactionID == 0 {
+		return writeAirtimeStatusError(w, http.StatusBadRequest, "missing transactionId")
+	}
+
+	transferUUID := events.EventUUID(body.Data.CustomIdentifier)
+	providerID := strconv.FormatInt(body.Data.TransactionID, 10)
+
+	var newStatus models.AirtimeTransferStatus
+	switch body.Data.Status {
+	case reloadly.StatusPending, reloadly.StatusProcessing:
+		newStatus = models.AirtimeTransferStatusSubmitted
+	case reloadly.StatusSuccessful:
+		newStatus = models.AirtimeTransferStatusCompleted
+	case reloadly.StatusFailed:
+		newStatus = models.AirtimeTransferStatusRejected
+	case reloadly.StatusRefunded:
+		newStatus = models.AirtimeTransferStatusReversed
+	default:
+		slog.Warn("ignoring reloadly callback with unmapped status", "transfer", transferUUID, "type", body.Type, "status", body.Data.Status)
+		return web.WriteMarshalled(w, http.StatusOK, map[string]string{"status": "ignored"})
+	}
+
+	return applyAirtimeStatus(ctx, rt, w, "reloadly", transferUUID, providerID, newStatus)
+}
+
+// applyAirtimeStatus applies a provider's status callback to the matching transfer and writes the response.
+func applyAirtimeStatus(ctx context.Context, rt *runtime.Runtime, w http.ResponseWriter, provider string, transferUUID events.EventUUID, providerID string, newStatus models.AirtimeTransferStatus) error {
 	// compare-and-swap directly on the row by (UUID, provider tx id) — concurrent callbacks race safely
 	// on a single SQL statement (no SELECT, no TOCTOU window). Rows affected of zero means the UUID is
-	// unknown, the provider id doesn't match what we stored, or the row's current status doesn't admit
-	// this transition (duplicate / out-of-order callback). The right reply to the provider is 2XX
-	// either way so it stops retrying — the distinction isn't actionable for DT One.
+	// unknown or the provider id doesn't match what we stored. The right reply to the provider is 2XX
+	// either way so it stops retrying — the distinction isn't actionable for the provider.
 	tag, err := models.UpdateAirtimeTransferStatus(ctx, rt.DB, transferUUID, providerID, newStatus)
 	if err != nil {
 		return fmt.Errorf("error updating airtime transfer status: %w", err)
@@ -91,7 +145,7 @@ func handleDTOneStatus(ctx context.Context, rt *runtime.Runtime, r *http.Request
 	if tag == nil {
 		// debug rather than info — the UUID is a capability token and we don't want to surface it in
 		// aggregated logs by default
-		slog.Debug("ignoring no-op dtone callback", "transfer", transferUUID, "to", newStatus)
+		slog.Debug("ignoring no-op airtime callback", "provider", provider, "transfer", transferUUID, "to", newStatus)
 		return web.WriteMarshalled(w, http.StatusOK, map[string]string{"status": "ignored"})
 	}
 
@@ -147,3 +147,84 @@ func TestDTOneStatusCallback(t *testing.T) {
 	// missing id → 400
 	assert.Equal(t, http.StatusBadRequest, post(t, fmt.Sprintf(`{"external_id":%q,"status":{"class":{"id":7}}}`, string(uuid))))
 }
+
+func TestReloadlyStatusCallback(t *testing.T) {
+	ctx, rt := testsuite.Runtime(t)
+
+	wg := &sync.WaitGroup{}
+	server := web.NewServer(ctx, rt, wg)
+	server.Start()
+	defer server.Stop()
+	time.Sleep(100 * time.Millisecond)
+
+	const callbackPath = "/mr/airtime/reloadly/status"
+
+	seed := func(t *testing.T) events.EventUUID {
+		rt.DB.MustExec(`DELETE FROM airtime_airtimetransfer`)
+		uuid := events.NewEventUUID()
+		tr := models.NewAirtimeTransfer(testdb.Org1.ID, testdb.Ann.ID, events.NewAirtimeCreated(uuid, &core.AirtimeTransfer{
+			ExternalID: "4602843",
+			Sender:     urns.URN("tel:+250700000001"),
+			Recipient:  urns.URN("tel:+250700000002"),
+			Currency:   "RWF",
+			Amount:     decimal.RequireFromString("100"),
+		}, nil))
+		require.NoError(t, models.InsertAirtimeTransfers(ctx, rt.DB, []*models.AirtimeTransfer{tr}))
+		return uuid
+	}
+
+	post := func(t *testing.T, body string) int {
+		req, err := http.NewRequest("POST", fmt.Sprintf("http://localhost:%d", rt.Config.InternetPort)+callbackPath, strings.NewReader(body))
+		require.NoError(t, err)
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	rowStatus := func(t *testing.T, uuid events.EventUUID) models.AirtimeTransferStatus {
+		var status models.AirtimeTransferStatus
+		require.NoError(t, rt.DB.GetContext(ctx, &status, `SELECT status FROM airtime_airtimetransfer WHERE uuid = $1`, uuid))
+		return status
+	}
+
+	body := func(uuid events.EventUUID, txID int, status string) string {
+		return fmt.Sprintf(`{"id":"5f0b1c2d","type":"airtime_transaction.status","data":{"transactionId":%d,"customIdentifier":%q,"status":%q}}`, txID, string(uuid), status)
+	}
+
+	testsuite.GetHistoryItems(t, rt, true, time.Time{})
+
+	uuid := seed(t)
+	assert.Equal(t, http.StatusOK, post(t, body(uuid, 4602843, "PROCESSING")))
+	assert.Equal(t, models.AirtimeTransferStatusSubmitted, rowStatus(t, uuid))
+	assert.Equal(t, http.StatusOK, post(t, body(uuid, 4602843, "SUCCESSFUL")))
+	assert.Equal(t, models.AirtimeTransferStatusCompleted, rowStatus(t, uuid))
+	assert.Equal(t, http.StatusOK, post(t, body(uuid, 4602843, "REFUNDED")))
+	assert.Equal(t, models.AirtimeTransferStatusReversed, rowStatus(t, uuid))
+
+	items := testsuite.GetHistoryItems(t, rt, true, time.Time{})
+	if assert.Len(t, items, 1) {
+		assert.Equal(t, fmt.Sprintf("evt#%s#sts", uuid), items[0].SK)
+		data, err := items[0].GetData()
+		require.NoError(t, err)
+		assert.Equal(t, "reversed", data["status"])
+	}
+
+	uuid = seed(t)
+	assert.Equal(t, http.StatusOK, post(t, body(uuid, 4602843, "FAILED")))
+	assert.Equal(t, models.AirtimeTransferStatusRejected, rowStatus(t, uuid))
+
+	// unknown status is ignored
+	uuid = seed(t)
+	assert.Equal(t, http.StatusOK, post(t, body(uuid, 4602843, "EXPLODED")))
+	assert.Equal(t, models.AirtimeTransferStatusCreated, rowStatus(t, uuid))
+
+	// wrong transaction id is a no-op
+	assert.Equal(t, http.StatusOK, post(t, body(uuid, 99999999, "SUCCESSFUL")))
+	assert.Equal(t, models.AirtimeTransferStatusCreated, rowStatus(t, uuid))
+
+	// missing custom identifier or transaction id → 400
+	assert.Equal(t, http.StatusBadRequest, post(t, `{"data":{"transactionId":4602843,"status":"SUCCESSFUL"}}`))
+	assert.Equal(t, http.StatusBadRequest, post(t, fmt.Sprintf(`{"data":{"customIdentifier":%q,"status":"SUCCESSFUL"}}`, string(uuid))))
+}
@@ -0,0 +1,308 @@
+package public
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/nyaruka/gocommon/httpx"
+	"github.com/nyaruka/gocommon/jsonx"
+	"github.com/nyaruka/mailroom/v26/core/models"
+	"github.com/nyaruka/mailroom/v26/runtime"
+	"github.com/nyaruka/mailroom/v26/services/email/fake"
+	"github.com/nyaruka/mailroom/v26/services/email/mailgun"
+	"github.com/nyaruka/mailroom/v26/services/email/sendgrid"
+	"github.com/nyaruka/mailroom/v26/services/email/ses"
+	"github.com/nyaruka/mailroom/v26/utils"
+	"github.com/nyaruka/mailroom/v26/web"
+)
+
+func init() {
+	web.InternetRoute(http.MethodPost, "/email/sendgrid/events", handleSendGridEvents)
+	web.InternetRoute(http.MethodPost, "/email/mailgun/events", handleMailgunEvents)
+	web.InternetRoute(http.MethodPost, "/email/ses/events", handleSESEvents)
+	web.DevRoute(http.MethodPost, "/email/fake/events", handleFakeEvents)
+}
+
+// SendGrid batches up to a few thousand events per request
+const maxEmailEventsBytes = 1024 * 1024 * 5
+
+// emailDelivery is a delivery event from a provider for one of our sent messages
+type emailDelivery struct {
+	messageID string
+	status    string
+}
+
+// sendgridEvent is the subset of a SendGrid event webhook item we care about. See
+// https://www.twilio.com/docs/sendgrid/for-developers/tracking-events/event
+type sendgridEvent struct {
+	Event       string `json:"event"`
+	SGMessageID string `json:"sg_message_id"`
+}
+
+// handleSendGridEvents receives batches of events from SendGrid's signed event webhook. Events refer to the message by
+// the X-Message-Id we were given when sending, with a suffix added by their filtering, e.g. <id>.filter0001.16648.5.
+// Requests must be signed with the key configured for the orgs which sent the messages.
+func handleSendGridEvents(ctx context.Context, rt *runtime.Runtime, r *http.Request, w http.ResponseWriter) error {
+	// payload is a JSON array so can't go through the usual struct validation
+	data, err := io.ReadAll(io.LimitReader(r.Body, maxEmailEventsBytes))
+	if err != nil {
+		return writeEmailEventsError(w, http.StatusBadRequest, fmt.Sprintf("unable to read body: %s", err))
+	}
+
+	var body []*sendgridEvent
+	if err := jsonx.Unmarshal(data, &body); err != nil {
+		return writeEmailEventsError(w, http.StatusBadRequest, fmt.Sprintf("invalid body: %s", err))
+	}
+
+	deliveries := make([]emailDelivery, 0, len(body))
+	for _, e := range body {
+		messageID, _, _ := strings.Cut(e.SGMessageID, ".")
+
+		var status string
+		switch e.Event {
+		case "delivered":
+			status = models.EmailDeliveryDelivered
+		case "bounce":
+			status = models.EmailDeliveryBounced
+		case "dropped":
+			status = models.EmailDeliveryFailed
+		case "spamreport":
+			status = models.EmailDeliveryComplained
+		default:
+			continue // processed, deferred, open, click etc
+		}
+
+		deliveries = append(deliveries, emailDelivery{messageID: messageID, status: status})
+	}
+
+	signature, timestamp := r.Header.Get(sendgrid.SignatureHeader), r.Header.Get(sendgrid.TimestampHeader)
+	verify := func(key string) bool { return sendgrid.VerifyWebhook(key, signature, timestamp, data) }
+
+	return applyEmailDeliveries(ctx, rt, w, "sendgrid", deliveries, verify)
+}
+
+// mailgunEvent is the subset of a Mailgun webhook payload we care about. See
+// https://documentation.mailgun.com/docs/mailgun/user-manual/events/webhooks
+type mailgunEvent struct {
+	Signature mailgun.WebhookSignature `json:"signature"`
+	EventData struct {
+		Event    string `json:"event"`
+		Severity string `json:"severity"`
+		Message  struct {
+			Headers struct {
+				MessageID string `json:"message-id"`
+			} `json:"headers"`
+		} `json:"message"`
+	} `json:"event-data"`
+}
+
+// handleMailgunEvents receives single events from Mailgun's webhooks. Events refer to the message by its Message-Id
+// header which is the id we were given when sending. Events must be signed with the webhook signing key configured for
+// the org which sent the message.
+func handleMailgunEvents(ctx context.Context, rt *runtime.Runtime, r *http.Request, w http.ResponseWriter) error {
+	body := &mailgunEvent{}
+	if err := web.ReadAndValidateJSON(r, body); err != nil {
+		return writeEmailEventsError(w, http.StatusBadRequest, fmt.Sprintf("invalid body: %s", err))
+	}
+
+	var status string
+	switch body.EventData.Event {
+	case "delivered":
+		status = models.EmailDeliveryDelivered
+	case "failed":
+		// temporary failures will be retried by Mailgun
+		if body.EventData.Severity != "permanent" {
+			return web.WriteMarshalled(w, http.StatusOK, map[string]string{"status": "ignored"})
+		}
+		status = models.EmailDeliveryBounced
+	case "complained":
+		status = models.EmailDeliveryComplained
+	default:
+		return web.WriteMarshalled(w, http.StatusOK, map[string]string{"status": "ignored"})
+	}
+
+	return applyEmailDeliveries(ctx, rt, w, "mailgun", []emailDelivery{{messageID: body.EventData.Message.Headers.MessageID, status: status}}, body.Signature.Verify)
+}
+
+// sesMessage is the subset of an SES notification we care about, which can come from either SES notifications or
+// event publishing. See https://docs.aws.amazon.com/ses/latest/dg/notification-contents.html
+type sesMessage struct {
+	NotificationType string `json:"notificationType"`
+	EventType        string `json:"eventType"`
+	Mail             struct {
+		MessageID string `json:"messageId"`
+	} `json:"mail"`
+	Bounce struct {
+		BounceType string `json:"bounceType"`
+	} `json:"bounce"`
+}
+
+// handleSESEvents receives SES notifications delivered via an SNS topic subscription. Messages must be signed by SNS
+// and subscription confirmations are confirmed automatically but only if the URL we're given to confirm with is on SNS
+// itself.
+func handleSESEvents(ctx context.Context, rt *runtime.Runtime, r *http.Request, w http.ResponseWriter) error {
+	body := &ses.SNSMessage{}
+	if err := web.ReadAndValidateJSON(r, body); err != nil {
+		return writeEmailEventsError(w, http.StatusBadRequest, fmt.Sprintf("invalid body: %s", err))
+	}
+
+	if err := body.Verify(ctx, rt.HTTP.Services); err != nil {
+		return writeEmailEventsError(w, http.StatusForbidden, err.Error())
+	}
+
+	if body.Type == "SubscriptionConfirmation" {
+		if err := confirmSNSSubscription(ctx, rt, body.SubscribeURL); err != nil {
+			return writeEmailEventsError(w, http.StatusBadRequest, err.Error())
+		}
+		return web.WriteMarshalled(w, http.StatusOK, map[string]string{"status": "confirmed"})
+	} else if body.Type != "Notification" {
+		return web.WriteMarshalled(w, http.StatusOK, map[string]string{"status": "ignored"})
+	}
+
+	msg := &sesMessage{}
+	if err := jsonx.Unmarshal([]byte(body.Message), msg); err != nil {
+		return writeEmailEventsError(w, http.StatusBadRequest, fmt.Sprintf("invalid notification message: %s", err))
+	}
+
+	eventType := msg.NotificationType
+	if eventType == "" {
+		eventType = msg.EventType
+	}
+
+	var status string
+	switch eventType {
+	case "Delivery":
+		status = models.EmailDeliveryDelivered
+	case "Bounce":
+		// transient bounces may yet be delivered
+		if msg.Bounce.BounceType != "Permanent" {
+			return web.WriteMarshalled(w, http.StatusOK, map[string]string{"status": "ignored"})
+		}
+		status = models.EmailDeliveryBounced
+	case "Complaint":
+		status = models.EmailDeliveryComplained
+	case "Reject":
+		status = models.EmailDeliveryFailed
+	default:
+		return web.WriteMarshalled(w, http.StatusOK, map[string]string{"status": "ignored"})
+	}
+
+	// any AWS account can publish signed messages so also check they're from the topic configured for the org
+	verify := func(key string) bool { return key == body.TopicArn }
+
+	return applyEmailDeliveries(ctx, rt, w, "ses", []emailDelivery{{messageID: msg.Mail.MessageID, status: status}}, verify)
+}
+
+func confirmSNSSubscription(ctx context.Context, rt *runtime.Runtime, subscribeURL string) error {
+	if !ses.IsSNSURL(subscribeURL) {
+		return fmt.Errorf("invalid SubscribeURL")
+	}
+
+	req, err := httpx.NewRequest(ctx, "GET", subscribeURL, nil, nil)
+	if err != nil {
+		return err
+	}
+
+	_, resp, err := utils.DoTraced(rt.HTTP.Services, req)
+	if err != nil {
+		return fmt.Errorf("error confirming subscription: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("error confirming subscription: unexpected response status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// fakeEvent is a delivery event for a message sent by the fake email service, posted by hand during development
+type fakeEvent struct {
+	MessageID string `json:"message_id" validate:"required"`
+	Status    string `json:"status"     validate:"required,oneof=delivered bounced complained failed"`
+}
+
+// handleFakeEvents lets us simulate delivery events for messages logged by the fake email service. Events for any other
+// messages are ignored since these requests aren't signed.
+func handleFakeEvents(ctx context.Context, rt *runtime.Runtime, r *http.Request, w http.ResponseWriter) error {
+	body := &fakeEvent{}
+	if err := web.ReadAndValidateJSON(r, body); err != nil {
+		return writeEmailEventsError(w, http.StatusBadRequest, fmt.Sprintf("invalid body: %s", err))
+	}
+
+	if !fake.IsMessageID(body.MessageID) {
+		return web.WriteMarshalled(w, http.StatusOK, map[string]string{"status": "ignored"})
+	}
+
+	return applyEmailDeliveries(ctx, rt, w, "fake", []emailDelivery{{messageID: body.MessageID, status: body.Status}}, nil)
+}
+
+// applyEmailDeliveries records delivery events from a provider against the matching email_sent events and writes the
+// response. Events for messages we don't know about are ignored but still get a 2XX so the provider stops retrying. If
+// verify is provided, the request must pass it with the webhook key of every org which the events belong to, before
+// any are recorded.
+func applyEmailDeliveries(ctx context.Context, rt *runtime.Runtime, w http.ResponseWriter, provider string, deliveries []emailDelivery, verify func(string) bool) error {
+	type sentDelivery struct {
+		sent   *models.SentEmail
+		status string
+	}
+
+	known := make([]sentDelivery, 0, len(deliveries))
+
+	for _, d := range deliveries {
+		if d.messageID == "" {
+			continue
+		}
+
+		sent, err := models.GetSentEmail(ctx, rt, d.messageID)
+		if err != nil {
+			return fmt.Errorf("error looking up sent email: %w", err)
+		}
+		if sent == nil {
+			slog.Debug("ignoring email event for unknown message", "provider", provider, "message_id", d.messageID, "status", d.status)
+			continue
+		}
+
+		known = append(known, sentDelivery{sent: sent, status: d.status})
+	}
+
+	if verify != nil {
+		verified := make(map[models.OrgID]bool)
+
+		for _, d := range known {
+			if verified[d.sent.OrgID] {
+				continue
+			}
+
+			oa, err := models.GetOrgAssets(ctx, rt, d.sent.OrgID)
+			if err != nil {
+				return fmt.Errorf("error loading org assets: %w", err)
+			}
+			key, err := oa.Org().EmailWebhookKey(ctx, rt)
+			if err != nil {
+				return fmt.Errorf("error getting email webhook key: %w", err)
+			}
+
+			if key == "" || !verify(key) {
+				return writeEmailEventsError(w, http.StatusForbidden, "invalid signature")
+			}
+			verified[d.sent.OrgID] = true
+		}
+	}
+
+	for _, d := range known {
+		if _, err := rt.Dynamo.History.Queue(models.NewEmailStatusTag(d.sent, d.status)); err != nil {
+			return fmt.Errorf("error queuing email status tag: %w", err)
+		}
+	}
+
+	if len(known) == 0 {
+		return web.WriteMarshalled(w, http.StatusOK, map[string]string{"status": "ignored"})
+	}
+	return web.WriteMarshalled(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+func writeEmailEventsError(w http.ResponseWriter, status int, msg string) error {
+	return web.WriteMarshalled(w, status, map[string]string{"error": msg})
+}
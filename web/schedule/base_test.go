@@ -0,0 +1,16 @@
+package schedule_test
+
+import (
+	"testing"
+
+	"github.com/nyaruka/mailroom/v26/testsuite"
+	"github.com/nyaruka/mailroom/v26/testsuite/testdb"
+)
+
+func TestPreview(t *testing.T) {
+	_, rt := testsuite.Runtime(t)
+
+	rt.DB.MustExec(`UPDATE orgs_org SET config = config || '{"holidays": {"dates": ["2030-01-02"]}}'::jsonb WHERE id = $1`, testdb.Org1.ID)
+
+	testsuite.RunWebTests(t, rt, "testdata/preview.json")
+}
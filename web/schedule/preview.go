@@ -0,0 +1,93 @@
+package schedule
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/nyaruka/gocommon/dates"
+	"github.com/nyaruka/mailroom/v26/core/models"
+	"github.com/nyaruka/mailroom/v26/runtime"
+	"github.com/nyaruka/mailroom/v26/web"
+)
+
+const previewDefaultCount = 10
+
+func init() {
+	web.InternalRoute(http.MethodPost, "/schedule/preview", web.JSONPayload(handlePreview))
+}
+
+// Request to preview the next fires of a schedule defined either by a cron expression or by a start time and repeat
+// period, taking into account the org's holiday calendar. Fires are listed from after the given time or from now.
+//
+//	{
+//	  "org_id": 1,
+//	  "cron": "30 10 * * TUE#2",
+//	  "count": 3
+//	}
+//
+//	{
+//	  "fires": [
+//	    "2025-05-13T10:30:00-07:00",
+//	    "2025-06-10T10:30:00-07:00",
+//	    "2025-07-08T10:30:00-07:00"
+//	  ]
+//	}
+type previewRequest struct {
+	OrgID            models.OrgID        `json:"org_id"              validate:"required"`
+	Cron             string              `json:"cron"`
+	Start            *time.Time          `json:"start"`
+	RepeatPeriod     models.RepeatPeriod `json:"repeat_period"`
+	RepeatDaysOfWeek string              `json:"repeat_days_of_week"`
+	After            *time.Time          `json:"after"`
+	Count            int                 `json:"count"               validate:"omitempty,min=1,max=100"`
+}
+
+func handlePreview(ctx context.Context, rt *runtime.Runtime, r *previewRequest) (any, int, error) {
+	oa, err := models.GetOrgAssets(ctx, rt, r.OrgID)
+	if err != nil {
+		return nil, 0, fmt.Errorf("error loading org assets: %w", err)
+	}
+
+	after := dates.Now()
+	if r.After != nil {
+		after = *r.After
+	}
+
+	var sched *models.Schedule
+
+	if r.Cron != "" {
+		sched, err = models.NewCronSchedule(oa, r.Cron, after)
+	} else if r.Start != nil {
+		repeatPeriod := r.RepeatPeriod
+		if repeatPeriod == "" {
+			repeatPeriod = models.RepeatPeriodNever
+		}
+		sched, err = models.NewSchedule(oa, *r.Start, repeatPeriod, r.RepeatDaysOfWeek)
+	} else {
+		return errors.New("one of cron or start is required"), http.StatusBadRequest, nil
+	}
+	if err != nil {
+		return fmt.Errorf("invalid schedule: %w", err), http.StatusBadRequest, nil
+	}
+
+	count := r.Count
+	if count == 0 {
+		count = previewDefaultCount
+	}
+
+	fires, err := sched.GetNextFires(after, count)
+	if err != nil {
+		return nil, 0, fmt.Errorf("error calculating schedule fires: %w", err)
+	}
+
+	// return fires in the org timezone
+	tz := oa.Env().Timezone()
+	for i := range fires {
+		fires[i] = fires[i].In(tz)
+	}
+
+	return map[string]any{"fires": fires}, http.StatusOK, nil
+}
@@ -30,12 +30,19 @@ type route struct {
 
 var internetRoutes []*route
 var internalRoutes []*route
+var devRoutes []*route
 
 // InternetRoute registers a route that handles direct requests from the internet
 func InternetRoute(method string, pattern string, handler Handler) {
 	internetRoutes = append(internetRoutes, &route{method: method, pattern: pattern, handler: handler})
 }
 
+// DevRoute registers a route that handles direct requests from the internet but only when dev routes are explicitly
+// enabled in the config, e.g. for simulating provider callbacks
+func DevRoute(method string, pattern string, handler Handler) {
+	devRoutes = append(devRoutes, &route{method: method, pattern: pattern, handler: handler})
+}
+
 // InternalRoute registers a route that handles internal requests between components
 func InternalRoute(method string, pattern string, handler Handler) {
 	internalRoutes = append(internalRoutes, &route{method: method, pattern: pattern, handler: requireAuthToken(handler)})
@@ -69,6 +76,11 @@ func NewServer(ctx context.Context, rt *runtime.Runtime, wg *sync.WaitGroup) *Se
 	for _, route := range internetRoutes {
 		internetRouter.Method(route.method, "/mr"+route.pattern, s.WrapHandler(route.handler))
 	}
+	if rt.Config.DevRoutes {
+		for _, route := range devRoutes {
+			internetRouter.Method(route.method, "/mr"+route.pattern, s.WrapHandler(route.handler))
+		}
+	}
 
 	// internal listener — only /mi/* routes, no internet-facing concerns
 	internalRouter := chi.NewRouter()
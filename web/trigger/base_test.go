@@ -0,0 +1,36 @@
+package trigger_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nyaruka/gocommon/uuids"
+	"github.com/nyaruka/mailroom/v26/core/models"
+	"github.com/nyaruka/mailroom/v26/testsuite"
+	"github.com/nyaruka/mailroom/v26/testsuite/testdb"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSmartStartFires(t *testing.T) {
+	ctx, rt := testsuite.Runtime(t)
+
+	// trigger #30000 is a smart start which has fired twice
+	sched := testdb.InsertSchedule(t, rt, testdb.Org1, models.RepeatPeriodWeekly, time.Now().Add(time.Hour))
+	triggerID := testdb.InsertScheduledTrigger(t, rt, testdb.Org1, testdb.Favorites, sched, nil, nil, nil)
+
+	fire := func(uuid uuids.UUID, firedOn time.Time, count int) {
+		start := models.NewFlowStart(testdb.Org1.ID, models.StartTypeTrigger, testdb.Favorites.ID).WithQuery("enrolled = yes")
+		start.UUID = uuid
+		start.TriggerID = triggerID
+
+		require.NoError(t, models.InsertFlowStart(ctx, rt.DB, start))
+		require.NoError(t, models.InsertSmartStartLink(ctx, rt, start))
+
+		rt.DB.MustExec(`UPDATE flows_flowstart SET created_on = $2, contact_count = $3 WHERE id = $1`, start.ID, firedOn, count)
+	}
+
+	fire("4b5c6d7e-8f9a-4b0c-9d1e-2f3a4b5c6d7e", time.Date(2026, 10, 5, 16, 0, 0, 0, time.UTC), 218)
+	fire("e2a3b4c5-d6e7-4f8a-9b0c-1d2e3f4a5b6c", time.Date(2026, 10, 12, 16, 0, 0, 0, time.UTC), 234)
+
+	testsuite.RunWebTests(t, rt, "testdata/smart_start_fires.json")
+}
@@ -0,0 +1,43 @@
+package trigger
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/nyaruka/mailroom/v26/core/models"
+	"github.com/nyaruka/mailroom/v26/runtime"
+	"github.com/nyaruka/mailroom/v26/web"
+)
+
+func init() {
+	web.InternalRoute(http.MethodPost, "/trigger/smart_start_fires", web.JSONPayload(handleSmartStartFires))
+}
+
+// Lists the recent fires of the smart start of a scheduled trigger, most recent first, with the number of contacts
+// which the query resolved to for each.
+//
+//	{
+//	  "org_id": 1,
+//	  "trigger_id": 123
+//	}
+//
+//	{
+//	  "fires": [
+//	    {"start_uuid": "e2a3b4c5-d6e7-4f8a-9b0c-1d2e3f4a5b6c", "fired_on": "2026-10-12T09:00:00Z", "count": 234},
+//	    {"start_uuid": "4b5c6d7e-8f9a-4b0c-9d1e-2f3a4b5c6d7e", "fired_on": "2026-10-05T09:00:00Z", "count": 218}
+//	  ]
+//	}
+type smartStartFiresRequest struct {
+	OrgID     models.OrgID     `json:"org_id"     validate:"required"`
+	TriggerID models.TriggerID `json:"trigger_id" validate:"required"`
+}
+
+func handleSmartStartFires(ctx context.Context, rt *runtime.Runtime, r *smartStartFiresRequest) (any, int, error) {
+	fires, err := models.GetSmartStartFires(ctx, rt, r.OrgID, r.TriggerID)
+	if err != nil {
+		return nil, 0, fmt.Errorf("error getting smart start fires: %w", err)
+	}
+
+	return map[string]any{"fires": fires}, http.StatusOK, nil
+}